@@ -0,0 +1,244 @@
+// Package client is a Go client for the 0G sandbox billing proxy.
+//
+// Every request is authenticated with EIP-191 wallet-signature headers
+// (X-Wallet-Address, X-Signed-Message, X-Wallet-Signature) built from the
+// caller's private key; request bodies are bound to the signature with
+// body_hash. Error responses are returned as *APIError.
+//
+//	c := client.NewClient("http://provider-host:8080", key)
+//	sb, err := c.CreateSandbox(ctx, client.CreateRequest{Snapshot: "ubuntu"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// DefaultTimeout bounds each HTTP round trip. Sandbox creation can take a
+	// minute or more on a first image pull.
+	DefaultTimeout = 2 * time.Minute
+	// DefaultSignatureTTL is how long a signed request stays valid. The proxy
+	// rejects expiries more than AUTH_MAX_VALIDITY_SEC (default 5 minutes)
+	// ahead.
+	DefaultSignatureTTL = 3 * time.Minute
+	// DefaultAPIPrefix is the path prefix of the proxy's routes, which
+	// follows the provider's DAYTONA_API_PREFIX.
+	DefaultAPIPrefix = "/api"
+)
+
+// Client calls the billing proxy as the wallet of its private key.
+// It is safe for concurrent use.
+type Client struct {
+	baseURL   string
+	apiPrefix string // e.g. "/api"; see SetAPIPrefix
+	key       *ecdsa.PrivateKey
+	addr      common.Address
+	hc        *http.Client
+	ttl       time.Duration
+}
+
+// NewClient returns a client for the proxy at baseURL (e.g.
+// "http://provider-host:8080") signing with privKey.
+func NewClient(baseURL string, privKey *ecdsa.PrivateKey) *Client {
+	return &Client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiPrefix: DefaultAPIPrefix,
+		key:       privKey,
+		addr:      crypto.PubkeyToAddress(privKey.PublicKey),
+		hc:        &http.Client{Timeout: DefaultTimeout},
+		ttl:       DefaultSignatureTTL,
+	}
+}
+
+// SetAPIPrefix sets the path prefix of the proxy's routes, for a provider
+// whose DAYTONA_API_PREFIX is not DefaultAPIPrefix (e.g. "/api/v2"). An
+// empty prefix restores the default.
+func (c *Client) SetAPIPrefix(p string) {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		c.apiPrefix = DefaultAPIPrefix
+		return
+	}
+	c.apiPrefix = "/" + p
+}
+
+// SetTimeout sets the per-request timeout; 0 disables it (the context still
+// applies).
+func (c *Client) SetTimeout(d time.Duration) {
+	hc := *c.hc
+	hc.Timeout = d
+	c.hc = &hc
+}
+
+// SetHTTPClient replaces the underlying HTTP client, e.g. to customise the
+// transport. Its Timeout is used as-is.
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.hc = hc
+}
+
+// SetSignatureTTL sets how long each signed request stays valid.
+func (c *Client) SetSignatureTTL(d time.Duration) {
+	c.ttl = d
+}
+
+// Address returns the wallet address requests are signed as.
+func (c *Client) Address() common.Address {
+	return c.addr
+}
+
+// signedRequest mirrors the JSON the proxy verifies in X-Signed-Message.
+type signedRequest struct {
+	Action     string          `json:"action"`
+	BodyHash   string          `json:"body_hash,omitempty"`
+	ExpiresAt  int64           `json:"expires_at"`
+	Nonce      string          `json:"nonce"`
+	Payload    json.RawMessage `json:"payload"`
+	ResourceID string          `json:"resource_id"`
+}
+
+// Headers are the three auth headers of one signed request.
+type Headers struct {
+	WalletAddress string // X-Wallet-Address
+	SignedMessage string // X-Signed-Message (base64 JSON)
+	Signature     string // X-Wallet-Signature (0x hex, V = 27/28)
+}
+
+// Apply sets h on req.
+func (h Headers) Apply(req *http.Request) {
+	req.Header.Set("X-Wallet-Address", h.WalletAddress)
+	req.Header.Set("X-Signed-Message", h.SignedMessage)
+	req.Header.Set("X-Wallet-Signature", h.Signature)
+}
+
+// Sign builds auth headers for one request with a fresh nonce. body is the
+// exact HTTP body that will be sent; when non-empty it is signed as both the
+// payload and its body_hash. Each Headers value may be used only once.
+func Sign(privKey *ecdsa.PrivateKey, action, resourceID string, body []byte, ttl time.Duration) (Headers, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Headers{}, fmt.Errorf("nonce: %w", err)
+	}
+	req := signedRequest{
+		Action:     action,
+		ExpiresAt:  time.Now().Add(ttl).Unix(),
+		Nonce:      hex.EncodeToString(nonce),
+		Payload:    json.RawMessage(`{}`),
+		ResourceID: resourceID,
+	}
+	if len(body) > 0 {
+		req.BodyHash = "0x" + hex.EncodeToString(crypto.Keccak256(body))
+		if json.Valid(body) {
+			req.Payload = body
+		}
+	}
+	msg, err := json.Marshal(req)
+	if err != nil {
+		return Headers{}, fmt.Errorf("marshal signed request: %w", err)
+	}
+	// EIP-191: keccak256("\x19Ethereum Signed Message:\n" + len(msg) + msg)
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(msg))
+	sig, err := crypto.Sign(crypto.Keccak256([]byte(prefix), msg), privKey)
+	if err != nil {
+		return Headers{}, fmt.Errorf("sign: %w", err)
+	}
+	sig[64] += 27 // V: 0/1 → 27/28 (Ethereum convention)
+	return Headers{
+		WalletAddress: crypto.PubkeyToAddress(privKey.PublicKey).Hex(),
+		SignedMessage: base64.StdEncoding.EncodeToString(msg),
+		Signature:     "0x" + hex.EncodeToString(sig),
+	}, nil
+}
+
+// APIError is a non-2xx response from the proxy.
+type APIError struct {
+	StatusCode int
+	Message    string // "error" field, or the raw body if it was not JSON
+	Code       string // machine-readable "code" field, e.g. SANDBOX_LIMIT; may be empty
+	RequestID  string // "request_id" field, set on internal errors
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("proxy: HTTP %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("proxy: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// maxErrorBody caps how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+func parseAPIError(resp *http.Response) *APIError {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &APIError{StatusCode: resp.StatusCode}
+	var body struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(raw, &body) == nil && body.Error != "" {
+		e.Message, e.Code, e.RequestID = body.Error, body.Code, body.RequestID
+	} else {
+		e.Message = strings.TrimSpace(string(raw))
+	}
+	return e
+}
+
+// Do sends a signed request to path (e.g. "/api/sandbox", used as given) and
+// decodes a JSON response into out when out is non-nil. in, when non-nil, is
+// sent as the JSON body. Non-2xx responses are returned as *APIError.
+func (c *Client) Do(ctx context.Context, method, path, action, resourceID string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+	}
+	h, err := Sign(c.key, action, resourceID, body, c.ttl)
+	if err != nil {
+		return err
+	}
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, rd)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	h.Apply(req)
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return parseAPIError(resp)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/auth"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestServer serves a few proxy routes behind the real auth middleware.
+func newTestServer(t *testing.T) *httptest.Server {
+	return newTestServerAt(t, DefaultAPIPrefix)
+}
+
+// newTestServerAt is newTestServer with the routes under prefix.
+func newTestServerAt(t *testing.T, prefix string) *httptest.Server {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	r := gin.New()
+	api := r.Group(prefix, auth.Middleware(rdb))
+	api.POST("/sandbox", auth.RequireBodyHash(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		if string(body) == `{"snapshot":"full"}` {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "sandbox limit reached", "code": "SANDBOX_LIMIT"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": "sb-1", "state": "started", "cpu": 2, "memory": 4})
+	})
+	api.GET("/account", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"wallet": c.GetString("wallet_address"), "running_sandboxes": 1, "max_sandboxes": 5})
+	})
+	api.POST("/sandbox/:id/stop", func(c *gin.Context) {
+		time.Sleep(200 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(t *testing.T, url string) *Client {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(url+"/", key) // trailing slash is trimmed
+}
+
+func TestClient_SignedRequestsAreAccepted(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv.URL)
+	ctx := context.Background()
+
+	sb, err := c.CreateSandbox(ctx, CreateRequest{Snapshot: "ubuntu"})
+	if err != nil {
+		t.Fatalf("CreateSandbox: %v", err)
+	}
+	if sb.ID != "sb-1" || sb.CPU != 2 || sb.Memory != 4 {
+		t.Errorf("sandbox: got %+v", sb)
+	}
+
+	acct, err := c.GetAccount(ctx)
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+	if acct.Wallet != c.Address().Hex() || acct.RunningSandboxes != 1 || acct.MaxSandboxes != 5 {
+		t.Errorf("account: got %+v, wallet want %s", acct, c.Address().Hex())
+	}
+}
+
+func TestClient_APIPrefix(t *testing.T) {
+	srv := newTestServerAt(t, "/api/v2")
+	c := newTestClient(t, srv.URL)
+	ctx := context.Background()
+
+	var apiErr *APIError
+	if _, err := c.GetAccount(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("default prefix against /api/v2: got %v, want 404", err)
+	}
+	c.SetAPIPrefix("api/v2/")
+	if _, err := c.GetAccount(ctx); err != nil {
+		t.Fatalf("GetAccount under /api/v2: %v", err)
+	}
+}
+
+func TestClient_ParsesStructuredError(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv.URL)
+
+	_, err := c.CreateSandbox(context.Background(), CreateRequest{Snapshot: "full"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Code != "SANDBOX_LIMIT" || apiErr.Message != "sandbox limit reached" {
+		t.Errorf("APIError: got %+v", apiErr)
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv.URL)
+	c.SetTimeout(50 * time.Millisecond)
+
+	err := c.StopSandbox(context.Background(), "sb-1")
+	var apiErr *APIError
+	if err == nil || errors.As(err, &apiErr) {
+		t.Fatalf("expected a transport timeout, got %v", err)
+	}
+
+	c.SetTimeout(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.StopSandbox(ctx, "sb-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline, got %v", err)
+	}
+}
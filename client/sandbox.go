@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Sandbox is a sandbox as returned by the proxy.
+type Sandbox struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	State    string            `json:"state"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	CPU      int               `json:"cpu"`
+	Memory   int               `json:"memory"` // GB
+	Snapshot string            `json:"snapshot,omitempty"`
+}
+
+// CreateRequest is the body of POST /api/sandbox. All fields are optional.
+type CreateRequest struct {
+	Name     string            `json:"name,omitempty"`
+	Image    string            `json:"image,omitempty"`
+	Snapshot string            `json:"snapshot,omitempty"`
+	Class    string            `json:"class,omitempty"` // small | medium | large
+	CPU      int               `json:"cpu,omitempty"`
+	Memory   int               `json:"memory,omitempty"` // GB
+	Disk     int               `json:"disk,omitempty"`   // GB
+	Sealed   bool              `json:"sealed,omitempty"`
+	SealID   string            `json:"seal_id,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// Account is the caller's account summary (GET /api/account).
+type Account struct {
+	Wallet           string `json:"wallet"`
+	RunningSandboxes int    `json:"running_sandboxes"`
+	MaxSandboxes     int    `json:"max_sandboxes"` // 0 = unlimited
+}
+
+// CreateSandbox creates a sandbox owned by the client's wallet.
+func (c *Client) CreateSandbox(ctx context.Context, req CreateRequest) (*Sandbox, error) {
+	var sb Sandbox
+	if err := c.Do(ctx, http.MethodPost, c.apiPrefix+"/sandbox", "create", "", req, &sb); err != nil {
+		return nil, err
+	}
+	return &sb, nil
+}
+
+// ListSandboxes lists the caller's sandboxes.
+func (c *Client) ListSandboxes(ctx context.Context) ([]Sandbox, error) {
+	var list []Sandbox
+	if err := c.Do(ctx, http.MethodGet, c.apiPrefix+"/sandbox", "list", "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetSandbox fetches one of the caller's sandboxes.
+func (c *Client) GetSandbox(ctx context.Context, id string) (*Sandbox, error) {
+	var sb Sandbox
+	if err := c.Do(ctx, http.MethodGet, c.apiPrefix+"/sandbox/"+url.PathEscape(id), "list", id, nil, &sb); err != nil {
+		return nil, err
+	}
+	return &sb, nil
+}
+
+// StartSandbox starts a stopped sandbox.
+func (c *Client) StartSandbox(ctx context.Context, id string) error {
+	return c.Do(ctx, http.MethodPost, c.apiPrefix+"/sandbox/"+url.PathEscape(id)+"/start", "start", id, nil, nil)
+}
+
+// StopSandbox stops a running sandbox.
+func (c *Client) StopSandbox(ctx context.Context, id string) error {
+	return c.Do(ctx, http.MethodPost, c.apiPrefix+"/sandbox/"+url.PathEscape(id)+"/stop", "stop", id, nil, nil)
+}
+
+// DeleteSandbox deletes a sandbox.
+func (c *Client) DeleteSandbox(ctx context.Context, id string) error {
+	return c.Do(ctx, http.MethodDelete, c.apiPrefix+"/sandbox/"+url.PathEscape(id), "delete", id, nil, nil)
+}
+
+// GetAccount returns the caller's account summary.
+func (c *Client) GetAccount(ctx context.Context) (*Account, error) {
+	var a Account
+	if err := c.Do(ctx, http.MethodGet, c.apiPrefix+"/account", "list", "", nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
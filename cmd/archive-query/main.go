@@ -0,0 +1,99 @@
+// cmd/archive-query/main.go — prints a wallet's archived settled vouchers
+// (see internal/archive) as JSON lines, oldest first.
+//
+// Usage:
+//
+//	go run ./cmd/archive-query/ --dir /data/voucher-archive \
+//	  --provider 0x... --wallet 0x... --from 2026-01-01 --to 2026-01-31
+//
+// With ARCHIVE_BACKEND=redis the archive is read from --redis (default
+// $REDIS_ADDR, password $REDIS_PASSWORD) instead of --dir.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/archive"
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/storage"
+)
+
+func main() {
+	backend := flag.String("backend", envOr("ARCHIVE_BACKEND", "fs"), "archive backend: fs or redis (default $ARCHIVE_BACKEND, else fs)")
+	dir := flag.String("dir", os.Getenv("ARCHIVE_DIR"), "archive directory, fs backend (default $ARCHIVE_DIR)")
+	redisAddr := flag.String("redis", os.Getenv("REDIS_ADDR"), "Redis address, redis backend (default $REDIS_ADDR)")
+	provider := flag.String("provider", os.Getenv("PROVIDER_ADDRESS"), "provider address (default $PROVIDER_ADDRESS)")
+	wallet := flag.String("wallet", "", "user wallet address (required)")
+	from := flag.String("from", "", "first day, YYYY-MM-DD UTC (required)")
+	to := flag.String("to", "", "last day, YYYY-MM-DD UTC (default: --from)")
+	flag.Parse()
+
+	missing := *dir == ""
+	if *backend == "redis" {
+		missing = *redisAddr == ""
+	}
+	if missing || !common.IsHexAddress(*provider) || !common.IsHexAddress(*wallet) || *from == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *to == "" {
+		*to = *from
+	}
+	start, err := time.Parse(time.DateOnly, *from)
+	if err != nil {
+		fatalf("invalid --from: %v", err)
+	}
+	end, err := time.Parse(time.DateOnly, *to)
+	if err != nil {
+		fatalf("invalid --to: %v", err)
+	}
+	// --to names a whole day.
+	end = end.Add(24*time.Hour - time.Second)
+
+	var store storage.Store
+	switch *backend {
+	case "fs":
+		fs, err := storage.NewFSStore(*dir)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		store = fs
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: *redisAddr, Password: os.Getenv("REDIS_PASSWORD")})
+		defer rdb.Close()
+		store = storage.NewRedisStore(rdb, config.ArchiveRedisPrefix)
+	default:
+		fatalf("invalid --backend %q (must be fs or redis)", *backend)
+	}
+	records, err := archive.Query(context.Background(), store, *provider, common.HexToAddress(*wallet), start, end)
+	if err != nil {
+		fatalf("query: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			fatalf("write: %v", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d voucher(s)\n", len(records))
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "archive-query: "+format+"\n", args...)
+	os.Exit(1)
+}
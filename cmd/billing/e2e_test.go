@@ -216,7 +216,7 @@ func setupE2E(teeKeyHex string) (*e2eEnv, error) {
 	stopCh := make(chan settler.StopSignal, 100)
 	go settler.Run(bgCtx, cfg, rdb, onchain, stopCh, zap.NewNop())
 	go billing.RunGenerator(bgCtx, rdb, bh, zap.NewNop())
-	go runStopHandler(bgCtx, stopCh, dtona, rdb, zap.NewNop(), nil)
+	go runStopHandler(bgCtx, stopCh, dtona, rdb, 1, zap.NewNop(), nil)
 
 	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, providerAddr.Hex())
 
@@ -31,11 +31,18 @@ package main
 //  5. TestComponent_BrokerDeregisterOnDelete
 //     After sandbox deletion, billing proxy calls broker
 //     DELETE /api/session/:id.
+//
+//  6. TestComponent_BrokerTopUpOnStart
+//     Restart with a balance below the minimum → broker tops up →
+//     Daytona start is forwarded.
+//
+//  7. TestComponent_DeleteWaitsForSettlement
+//     DELETE /sandbox/:id?wait=true blocks until the settler has settled the
+//     sandbox's last voucher on the simulated chain, and reports its receipt.
 
 import (
 	"context"
 	"crypto/ecdsa"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -62,11 +69,13 @@ import (
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/client"
 	"github.com/0gfoundation/0g-sandbox/internal/auth"
 	"github.com/0gfoundation/0g-sandbox/internal/billing"
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
 	"github.com/0gfoundation/0g-sandbox/internal/config"
 	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona/daytonatest"
 	"github.com/0gfoundation/0g-sandbox/internal/proxy"
 	"github.com/0gfoundation/0g-sandbox/internal/settler"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
@@ -193,7 +202,8 @@ type simChainClient struct {
 
 // SettleFeesWithTEE submits the vouchers to the simulated chain.
 // Statuses are read via PreviewSettlementResults BEFORE the tx so they are
-// accurate for all outcomes (success, insufficient balance, etc.).
+// accurate for all outcomes (success, insufficient balance, etc.), as in
+// chain.Client.SettleFeesWithTEE.
 func (c *simChainClient) SettleFeesWithTEE(ctx context.Context, vs []voucher.SandboxVoucher) ([]chain.SettlementStatus, error) {
 	cvs := make([]chain.SandboxServingSandboxVoucher, len(vs))
 	for i, v := range vs {
@@ -204,7 +214,7 @@ func (c *simChainClient) SettleFeesWithTEE(ctx context.Context, vs []voucher.San
 		}
 	}
 
-	// Preview statuses before the tx; From must equal voucher.Provider.
+	// Preview statuses before the tx, from the provider as chain.Client does.
 	previewOpts := &bind.CallOpts{Context: ctx, From: c.providerAuth.From}
 	rawStatuses, err := c.contract.PreviewSettlementResults(previewOpts, cvs)
 	if err != nil {
@@ -235,68 +245,6 @@ func (c *simChainClient) SettleFeesWithTEE(ctx context.Context, vs []voucher.San
 	return statuses, nil
 }
 
-// ── e2eMockDaytona: records creates and stops ─────────────────────────────────
-
-type e2eMockDaytona struct {
-	mu      sync.Mutex
-	created []string // sandbox IDs returned by POST /api/sandbox
-	stopped []string // sandbox IDs stopped by POST /api/sandbox/:id/stop
-	srv     *httptest.Server
-}
-
-func newE2EMockDaytona(t *testing.T) *e2eMockDaytona {
-	t.Helper()
-	m := &e2eMockDaytona{}
-	m.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path, method := r.URL.Path, r.Method
-
-		// POST /api/sandbox → create sandbox, return new ID
-		if method == http.MethodPost && path == "/api/sandbox" {
-			m.mu.Lock()
-			id := fmt.Sprintf("sb-e2e-%d", len(m.created)+1)
-			m.created = append(m.created, id)
-			m.mu.Unlock()
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusCreated)
-			fmt.Fprintf(w, `{"id":%q}`, id)
-			return
-		}
-
-		// POST /api/sandbox/:id/stop → stop sandbox
-		if method == http.MethodPost && strings.HasSuffix(path, "/stop") {
-			// path = /api/sandbox/:id/stop → split gives ["api","sandbox",id,"stop"]
-			parts := strings.Split(strings.Trim(path, "/"), "/")
-			if len(parts) == 4 && parts[0] == "api" && parts[1] == "sandbox" {
-				m.mu.Lock()
-				m.stopped = append(m.stopped, parts[2])
-				m.mu.Unlock()
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		w.WriteHeader(http.StatusNotFound)
-	}))
-	t.Cleanup(m.srv.Close)
-	return m
-}
-
-func (m *e2eMockDaytona) createdIDs() []string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := make([]string, len(m.created))
-	copy(out, m.created)
-	return out
-}
-
-func (m *e2eMockDaytona) stoppedIDs() []string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := make([]string, len(m.stopped))
-	copy(out, m.stopped)
-	return out
-}
-
 // ── shared helpers ────────────────────────────────────────────────────────────
 
 // e2eLoadArtifact reads a Foundry JSON artifact. Skips the test if not found.
@@ -333,22 +281,11 @@ func e2eSignedHeaders(t *testing.T, privKeyHex string) (walletAddr, msgB64, sigH
 	if err != nil {
 		t.Fatalf("parse private key: %v", err)
 	}
-	walletAddr = crypto.PubkeyToAddress(privKey.PublicKey).Hex()
-	req := auth.SignedRequest{
-		Action:    "create",
-		ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
-		Nonce:     fmt.Sprintf("e2e-%d", time.Now().UnixNano()),
-	}
-	msgBytes, _ := json.Marshal(req)
-	hash := auth.HashMessage(msgBytes)
-	sig, err := crypto.Sign(hash, privKey)
+	h, err := client.Sign(privKey, "create", "", nil, 5*time.Minute)
 	if err != nil {
 		t.Fatalf("sign: %v", err)
 	}
-	sig[64] += 27 // normalize V to Ethereum convention (27/28)
-	return walletAddr,
-		base64.StdEncoding.EncodeToString(msgBytes),
-		"0x" + hex.EncodeToString(sig)
+	return h.WalletAddress, h.SignedMessage, h.Signature
 }
 
 // waitFor polls f() until it returns true or timeout elapses.
@@ -370,7 +307,7 @@ func buildServer(t *testing.T, dtona *daytona.Client, bh proxy.BillingHooks, rdb
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 	api := r.Group("/api", auth.Middleware(rdb))
-	proxy.NewHandler(dtona, bh, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), "", nil, "", rdb, zap.NewNop(), "", nil, 0).Register(api)
+	proxy.NewHandler(dtona, bh, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), "", nil, "", rdb, zap.NewNop(), "", nil, 0, 0, nil).Register(api)
 	srv := httptest.NewServer(r)
 	t.Cleanup(srv.Close)
 	return srv
@@ -436,8 +373,8 @@ func TestComponent_HappyPath(t *testing.T) {
 	// Redis + Daytona mock
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
-	mock := newE2EMockDaytona(t)
-	dtona := daytona.NewClient(mock.srv.URL, "test-key")
+	mock := daytonatest.NewServer(t, "sb-e2e")
+	dtona := mock.Client()
 
 	// Billing: createFee=100 neuron so OnCreate enqueues a non-trivial voucher.
 	signer := billing.NewSigner(fix.providerKey, e2eChainID, fix.proxyAddr, fix.providerAddr,
@@ -452,9 +389,9 @@ func TestComponent_HappyPath(t *testing.T) {
 
 	// ── Assert: Daytona received the create request ───────────────────────────
 	waitFor(t, "Daytona create request", 3*time.Second, func() bool {
-		return len(mock.createdIDs()) == 1
+		return len(mock.Created()) == 1
 	})
-	createdID := mock.createdIDs()[0]
+	createdID := mock.Created()[0]
 	t.Logf("Daytona create confirmed: sandbox ID = %q", createdID)
 
 	// ── 2. Wait for OnCreate to enqueue the voucher ───────────────────────────
@@ -518,8 +455,8 @@ func TestComponent_InsufficientBalance(t *testing.T) {
 	// Redis + Daytona mock
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
-	mock := newE2EMockDaytona(t)
-	dtona := daytona.NewClient(mock.srv.URL, "test-key")
+	mock := daytonatest.NewServer(t, "sb-e2e")
+	dtona := mock.Client()
 
 	// createFee=100 neuron: OnCreate enqueues a voucher that will fail due to
 	// the user's zero balance.
@@ -535,9 +472,9 @@ func TestComponent_InsufficientBalance(t *testing.T) {
 
 	// Wait for Daytona to receive the create request.
 	waitFor(t, "Daytona create request", 3*time.Second, func() bool {
-		return len(mock.createdIDs()) == 1
+		return len(mock.Created()) == 1
 	})
-	sandboxID := mock.createdIDs()[0]
+	sandboxID := mock.Created()[0]
 	t.Logf("Daytona create confirmed: sandbox ID = %q", sandboxID)
 
 	// Wait for the create-fee voucher to land in the queue.
@@ -562,11 +499,11 @@ func TestComponent_InsufficientBalance(t *testing.T) {
 	settlerCtx, settlerCancel := context.WithCancel(ctx)
 	defer settlerCancel()
 	go settler.Run(settlerCtx, cfg, rdb, onchain, signer, stopCh, zap.NewNop())
-	go runStopHandler(ctx, stopCh, dtona, rdb, zap.NewNop(), nil)
+	go runStopHandler(ctx, stopCh, dtona, rdb, 1, zap.NewNop(), nil)
 
 	// ── 3. Assert: Daytona received stop for the correct sandbox ──────────────
 	waitFor(t, fmt.Sprintf("Daytona stop for %q", sandboxID), 10*time.Second, func() bool {
-		for _, id := range mock.stoppedIDs() {
+		for _, id := range mock.Stopped() {
 			if id == sandboxID {
 				return true
 			}
@@ -590,89 +527,16 @@ func TestComponent_InsufficientBalance(t *testing.T) {
 // Used by tests that only care about proxy/ownership behavior, not billing.
 type noopBillingHooks struct{}
 
-func (n *noopBillingHooks) OnCreate(_ context.Context, _, _ string, _, _ int) {}
-func (n *noopBillingHooks) OnStart(_ context.Context, _, _ string, _, _ int)  {}
-func (n *noopBillingHooks) OnStop(_ context.Context, _ string)            {}
-func (n *noopBillingHooks) OnDelete(_ context.Context, _ string)          {}
-func (n *noopBillingHooks) OnArchive(_ context.Context, _ string)         {}
-func (n *noopBillingHooks) EnsureSession(_ context.Context, _, _ string)  {}
-
-// ── ownerMockDaytona ─────────────────────────────────────────────────────────
-
-// ownerMockDaytona is a stateful mock Daytona server that stores sandboxes with
-// their labels so the proxy's ownership-filter and ownership-check logic can be
-// exercised without a real Daytona instance.
-type ownerMockDaytona struct {
-	mu        sync.Mutex
-	sandboxes map[string]daytona.Sandbox
-	nextID    int
-	srv       *httptest.Server
-}
-
-func newOwnerMockDaytona(t *testing.T) *ownerMockDaytona {
-	t.Helper()
-	m := &ownerMockDaytona{sandboxes: make(map[string]daytona.Sandbox)}
-	m.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path, method := r.URL.Path, r.Method
-		w.Header().Set("Content-Type", "application/json")
-
-		// POST /api/sandbox → create sandbox, extract injected labels
-		if method == http.MethodPost && path == "/api/sandbox" {
-			var body map[string]any
-			_ = json.NewDecoder(r.Body).Decode(&body)
-			labels := map[string]string{}
-			if ls, ok := body["labels"].(map[string]any); ok {
-				for k, v := range ls {
-					if s, ok := v.(string); ok {
-						labels[k] = s
-					}
-				}
-			}
-			m.mu.Lock()
-			m.nextID++
-			id := fmt.Sprintf("sb-owner-%d", m.nextID)
-			sb := daytona.Sandbox{ID: id, State: "running", Labels: labels}
-			m.sandboxes[id] = sb
-			m.mu.Unlock()
-			w.WriteHeader(http.StatusCreated)
-			_ = json.NewEncoder(w).Encode(sb)
-			return
-		}
-
-		// GET /api/sandbox → list all (proxy does the owner-label filtering)
-		if method == http.MethodGet && path == "/api/sandbox" {
-			m.mu.Lock()
-			list := make([]daytona.Sandbox, 0, len(m.sandboxes))
-			for _, s := range m.sandboxes {
-				list = append(list, s)
-			}
-			m.mu.Unlock()
-			_ = json.NewEncoder(w).Encode(list)
-			return
-		}
-
-		// GET /api/sandbox/:id → single sandbox lookup
-		// path = "/api/sandbox/<id>" → trim leading "/" → split into 3 parts
-		parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 4)
-		if method == http.MethodGet && len(parts) == 3 &&
-			parts[0] == "api" && parts[1] == "sandbox" {
-			id := parts[2]
-			m.mu.Lock()
-			sb, ok := m.sandboxes[id]
-			m.mu.Unlock()
-			if !ok {
-				http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
-				return
-			}
-			_ = json.NewEncoder(w).Encode(sb)
-			return
-		}
-
-		w.WriteHeader(http.StatusNotFound)
-	}))
-	t.Cleanup(m.srv.Close)
-	return m
+func (n *noopBillingHooks) OnCreate(_ context.Context, _, _ string, _, _ int, _ map[string]string) error {
+	return nil
 }
+func (n *noopBillingHooks) OnStart(_ context.Context, _, _ string, _, _ int, _ map[string]string)  {}
+func (n *noopBillingHooks) OnStop(_ context.Context, _ string)                                     {}
+func (n *noopBillingHooks) OnDelete(_ context.Context, _ string)                                   {}
+func (n *noopBillingHooks) OnArchive(_ context.Context, _ string)                                  {}
+func (n *noopBillingHooks) EnsureSession(_ context.Context, _, _ string)                           {}
+func (n *noopBillingHooks) PauseBilling(_ context.Context, _ string) error                         { return nil }
+func (n *noopBillingHooks) ResumeBilling(_ context.Context, _ string) error                        { return nil }
 
 // ── ownership helpers ─────────────────────────────────────────────────────────
 
@@ -769,8 +633,8 @@ func TestComponent_OwnershipFiltering(t *testing.T) {
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
 
-	mock := newOwnerMockDaytona(t)
-	dtona := daytona.NewClient(mock.srv.URL, "test-key")
+	mock := daytonatest.NewServer(t, "sb-owner")
+	dtona := mock.Client()
 	srv := buildServer(t, dtona, &noopBillingHooks{}, rdb)
 
 	// Two distinct Anvil test wallets.
@@ -873,93 +737,13 @@ func (m *mockBrokerServer) deleteCalls() []string {
 	return out
 }
 
-// brokerMockDaytona is a Daytona mock that tracks sandbox owner labels so
-// ownership checks (GET /api/sandbox/:id) return the correct daytona-owner.
-type brokerMockDaytona struct {
-	mu        sync.Mutex
-	sandboxes map[string]string // id → owner wallet
-	started   []string          // sandbox IDs that received a /start request
-	srv       *httptest.Server
-}
-
-func newBrokerMockDaytona(t *testing.T) *brokerMockDaytona {
-	t.Helper()
-	m := &brokerMockDaytona{sandboxes: make(map[string]string)}
-	m.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path, method := r.URL.Path, r.Method
-
-		// POST /api/sandbox → create, extract owner label, return ID with resources
-		if method == http.MethodPost && path == "/api/sandbox" {
-			var body map[string]any
-			json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
-			owner := ""
-			if labels, ok := body["labels"].(map[string]any); ok {
-				owner, _ = labels["daytona-owner"].(string)
-			}
-			m.mu.Lock()
-			id := fmt.Sprintf("sb-broker-%d", len(m.sandboxes)+1)
-			m.sandboxes[id] = owner
-			m.mu.Unlock()
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusCreated)
-			fmt.Fprintf(w, `{"id":%q,"cpu":2,"memory":4}`, id)
-			return
-		}
-
-		// POST /api/sandbox/:id/start → record and return 200
-		if method == http.MethodPost && strings.HasSuffix(path, "/start") {
-			parts := strings.Split(strings.Trim(path, "/"), "/")
-			if len(parts) == 4 {
-				m.mu.Lock()
-				m.started = append(m.started, parts[2])
-				m.mu.Unlock()
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// GET /api/sandbox/:id → return sandbox with owner label + resources
-		if method == http.MethodGet && strings.HasPrefix(path, "/api/sandbox/") {
-			id := strings.TrimPrefix(path, "/api/sandbox/")
-			m.mu.Lock()
-			owner, ok := m.sandboxes[id]
-			m.mu.Unlock()
-			if !ok {
-				w.WriteHeader(http.StatusNotFound)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			fmt.Fprintf(w, `{"id":%q,"cpu":2,"memory":4,"labels":{"daytona-owner":%q}}`, id, owner)
-			return
-		}
-
-		// DELETE /api/sandbox/:id → success
-		if method == http.MethodDelete && strings.HasPrefix(path, "/api/sandbox/") {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		w.WriteHeader(http.StatusNotFound)
-	}))
-	t.Cleanup(m.srv.Close)
-	return m
-}
-
-func (m *brokerMockDaytona) startedIDs() []string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := make([]string, len(m.started))
-	copy(out, m.started)
-	return out
-}
-
 // buildServerWithBroker wires up the billing proxy with a real broker client.
 func buildServerWithBroker(t *testing.T, dtona *daytona.Client, bh proxy.BillingHooks, rdb *redis.Client, brokerURL string, teeKey *ecdsa.PrivateKey) *httptest.Server {
 	t.Helper()
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 	api := r.Group("/api", auth.Middleware(rdb))
-	proxy.NewHandler(dtona, bh, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), "", nil, "", rdb, zap.NewNop(), brokerURL, teeKey, 60).Register(api)
+	proxy.NewHandler(dtona, bh, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), "", nil, "", rdb, zap.NewNop(), brokerURL, teeKey, 60, 0, nil).Register(api)
 	srv := httptest.NewServer(r)
 	t.Cleanup(srv.Close)
 	return srv
@@ -999,8 +783,8 @@ func TestComponent_BrokerRegisterOnCreate(t *testing.T) {
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
 
-	mockDaytona := newBrokerMockDaytona(t)
-	dtona := daytona.NewClient(mockDaytona.srv.URL, "test-key")
+	mockDaytona := daytonatest.NewServer(t, "sb-broker")
+	dtona := mockDaytona.Client()
 	broker := newMockBroker(t)
 	teeKey, _ := crypto.GenerateKey()
 	srv := buildServerWithBroker(t, dtona, &noopBillingHooks{}, rdb, broker.srv.URL, teeKey)
@@ -1032,8 +816,8 @@ func TestComponent_BrokerDeregisterOnDelete(t *testing.T) {
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
 
-	mockDaytona := newBrokerMockDaytona(t)
-	dtona := daytona.NewClient(mockDaytona.srv.URL, "test-key")
+	mockDaytona := daytonatest.NewServer(t, "sb-broker")
+	dtona := mockDaytona.Client()
 	broker := newMockBroker(t)
 	teeKey, _ := crypto.GenerateKey()
 	srv := buildServerWithBroker(t, dtona, &noopBillingHooks{}, rdb, broker.srv.URL, teeKey)
@@ -1082,7 +866,7 @@ func buildServerFull(t *testing.T, dtona *daytona.Client, bh proxy.BillingHooks,
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 	api := r.Group("/api", auth.Middleware(rdb))
-	proxy.NewHandler(dtona, bh, balCheck, nil, nil, minBalance, big.NewInt(0), big.NewInt(0), big.NewInt(0), "", nil, "", rdb, zap.NewNop(), brokerURL, teeKey, 60).Register(api)
+	proxy.NewHandler(dtona, bh, balCheck, nil, nil, minBalance, big.NewInt(0), big.NewInt(0), big.NewInt(0), "", nil, "", rdb, zap.NewNop(), brokerURL, teeKey, 60, 0, nil).Register(api)
 	srv := httptest.NewServer(r)
 	t.Cleanup(srv.Close)
 	return srv
@@ -1123,8 +907,8 @@ func TestComponent_BrokerTopUpOnStart(t *testing.T) {
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
 
-	mockDaytona := newBrokerMockDaytona(t)
-	dtona := daytona.NewClient(mockDaytona.srv.URL, "test-key")
+	mockDaytona := daytonatest.NewServer(t, "sb-broker")
+	dtona := mockDaytona.Client()
 	broker := newMockBroker(t)
 	teeKey, _ := crypto.GenerateKey()
 
@@ -1157,9 +941,113 @@ func TestComponent_BrokerTopUpOnStart(t *testing.T) {
 	}
 
 	// Daytona must have received the start request.
-	startedIDs := mockDaytona.startedIDs()
+	startedIDs := mockDaytona.Started()
 	if len(startedIDs) == 0 || startedIDs[0] != sbID {
 		t.Errorf("Daytona start not called for %q; started=%v", sbID, startedIDs)
 	}
 	t.Log("broker top-up on restart: PASS")
 }
+
+// ── Test 7: delete waits for the final settlement ────────────────────────────
+
+// TestComponent_DeleteWaitsForSettlement exercises DELETE ?wait=true on a
+// simulated chain:
+//
+//  1. POST /api/sandbox → billing enqueues the create-fee voucher.
+//  2. DELETE /api/sandbox/:id?wait=true is sent before the settler runs.
+//  3. The settler settles the voucher on-chain while the DELETE waits.
+//  4. The DELETE answers 200 with the settled receipt of nonce 1.
+func TestComponent_DeleteWaitsForSettlement(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	fix := deployE2EFixture(t)
+
+	fix.userAuth.Value, _ = new(big.Int).SetString("10000000000000000000", 10)
+	if _, err := fix.contract.Deposit(fix.userAuth, fix.userAddr, fix.providerAddr); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	fix.backend.Commit()
+	fix.userAuth.Value = big.NewInt(0)
+	if _, err := fix.contract.AcknowledgeTEESigner(fix.userAuth, fix.providerAddr, true); err != nil {
+		t.Fatalf("acknowledgeTEESigner: %v", err)
+	}
+	fix.backend.Commit()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mock := daytonatest.NewServer(t, "sb-del")
+
+	signer := billing.NewSigner(fix.providerKey, e2eChainID, fix.proxyAddr, fix.providerAddr,
+		rdb, &e2eNonceReader{fix.contract}, zap.NewNop())
+	bh := billing.NewEventHandler(rdb, fix.providerAddr.Hex(),
+		big.NewInt(0), big.NewInt(100), new(big.Int), new(big.Int), 1, signer, zap.NewNop())
+	srv := buildServer(t, mock.Client(), bh, rdb)
+
+	// ── 1. Create; the create-fee voucher is queued ───────────────────────────
+	sbID := postSandboxGetID(t, ctx, srv.URL, e2eUserKeyHex)
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, fix.providerAddr.Hex())
+	waitFor(t, "voucher in Redis queue", 3*time.Second, func() bool {
+		n, _ := rdb.LLen(ctx, queueKey).Result()
+		return n >= 1
+	})
+
+	// ── 2-3. The settler starts only once the DELETE is waiting ───────────────
+	onchain := &simChainClient{
+		contract:     fix.contract,
+		providerAuth: fix.providerAuth,
+		simClient:    fix.simClient,
+		backend:      fix.backend,
+	}
+	cfg := &config.Config{
+		Chain:   config.ChainConfig{ProviderAddress: fix.providerAddr.Hex()},
+		Billing: config.BillingConfig{VoucherIntervalSec: 1},
+	}
+	settlerCtx, settlerCancel := context.WithCancel(ctx)
+	defer settlerCancel()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		settler.Run(settlerCtx, cfg, rdb, onchain, signer, make(chan settler.StopSignal, 4), zap.NewNop())
+	}()
+
+	walletAddr, msgB64, sigHex := e2eSignedHeaders(t, e2eUserKeyHex)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, srv.URL+"/api/sandbox/"+sbID+"?wait=true", nil)
+	if err != nil {
+		t.Fatalf("build delete request: %v", err)
+	}
+	req.Header.Set("X-Wallet-Address", walletAddr)
+	req.Header.Set("X-Signed-Message", msgB64)
+	req.Header.Set("X-Wallet-Signature", sigHex)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE /api/sandbox/%s?wait=true: %v", sbID, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// ── 4. Assert: the final settlement is reported ───────────────────────────
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE ?wait=true: got HTTP %d, want 200; body: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Settlement struct {
+			Settled bool   `json:"settled"`
+			Status  string `json:"status"`
+			Receipt struct {
+				Nonce string `json:"nonce"`
+			} `json:"receipt"`
+		} `json:"settlement"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("decode %q: %v", body, err)
+	}
+	if s := result.Settlement; !s.Settled || s.Status != "success" || s.Receipt.Nonce != "1" {
+		t.Errorf("settlement: got %+v", s)
+	}
+	if n, err := fix.contract.GetLastNonce(&bind.CallOpts{}, fix.userAddr, fix.providerAddr); err != nil || n.Int64() != 1 {
+		t.Errorf("on-chain lastNonce: got %v, %v; want 1", n, err)
+	}
+	if deleted := mock.Deleted(); len(deleted) != 1 || deleted[0] != sbID {
+		t.Errorf("Daytona delete: got %v", deleted)
+	}
+}
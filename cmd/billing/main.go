@@ -2,43 +2,68 @@ package main
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
+	"net/http/pprof"
 	"net/url"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/archive"
 	"github.com/0gfoundation/0g-sandbox/internal/auth"
 	"github.com/0gfoundation/0g-sandbox/internal/billing"
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
 	"github.com/0gfoundation/0g-sandbox/internal/config"
 	"github.com/0gfoundation/0g-sandbox/internal/daytona"
 	"github.com/0gfoundation/0g-sandbox/internal/events"
+	"github.com/0gfoundation/0g-sandbox/internal/logging"
+	"github.com/0gfoundation/0g-sandbox/internal/metrics"
 	"github.com/0gfoundation/0g-sandbox/internal/proxy"
 	"github.com/0gfoundation/0g-sandbox/internal/registry"
 	"github.com/0gfoundation/0g-sandbox/internal/settler"
+	"github.com/0gfoundation/0g-sandbox/internal/storage"
 	"github.com/0gfoundation/0g-sandbox/internal/tee"
+	"github.com/0gfoundation/0g-sandbox/internal/units"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 	"github.com/0gfoundation/0g-sandbox/web"
 )
 
 func main() {
-	log, _ := zap.NewProduction()
-	defer log.Sync() //nolint:errcheck
-
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("config load failed", zap.Error(err))
+		boot, _ := zap.NewProduction()
+		boot.Fatal("config load failed", zap.Error(err))
+	}
+	log, logLevel, err := logging.New(cfg.Server)
+	if err != nil {
+		boot, _ := zap.NewProduction()
+		boot.Fatal("logger init failed", zap.Error(err))
+	}
+	defer log.Sync() //nolint:errcheck
+	if cfg.DryRun {
+		// Every line of a dry-run process is labelled, so its logs cannot be
+		// mistaken for a real deployment's.
+		log = log.With(zap.Bool("dry_run", true))
+		log.Warn("DRY RUN: no chain — settlement is only logged, balance and acknowledgement checks are skipped")
+	}
+	// config cannot import chain (chain reads config), so CHAIN_ERROR_RULES
+	// is checked here, with the parser the settler uses.
+	if _, err := chain.ParseErrorRules(cfg.Chain.ErrorRules); err != nil {
+		log.Fatal("invalid CHAIN_ERROR_RULES", zap.Error(err))
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -63,15 +88,41 @@ func main() {
 	cfg.Chain.TEEPrivateKey = appKey.PrivateKeyHex
 
 	// ── Chain client (TEE private key + ABI binding) ──────────────────────────
-	onchain, err := chain.NewClient(cfg)
+	// Under DRY_RUN a chain.DryRunClient stands in; live stays nil, and the
+	// features that need a real chain are refused by config.Load.
+	var onchain chainClient
+	var live *chain.Client
+	if cfg.DryRun {
+		onchain, err = chain.NewDryRunClient(cfg, log)
+	} else {
+		live, err = chain.NewClient(cfg)
+		onchain = live
+	}
 	if err != nil {
 		log.Fatal("chain client init failed", zap.Error(err))
 	}
+	// Settlement txs are sent (and their gas paid) by GAS_PAYER_KEY when set,
+	// else by the TEE key; this address must hold 0G for gas.
+	log.Info("chain transaction sender", zap.String("address", onchain.SenderAddress().Hex()),
+		zap.Bool("separate_gas_payer", cfg.Chain.GasPayerKey != ""))
+
+	// ── Service registration ──────────────────────────────────────────────────
+	// Refuse to start unless PROVIDER_ADDRESS has a service on-chain naming
+	// this TEE key as signer (or, during a rotation, the outgoing key):
+	// otherwise every voucher would fail settlement.
+	var prevSigner []common.Address
+	if cfg.Chain.TEEPreviousPrivateKey != "" {
+		k, _ := cfg.Chain.PreviousTEEKey() // validated by config.Load
+		prevSigner = append(prevSigner, crypto.PubkeyToAddress(k.PublicKey))
+	}
+	if err := onchain.VerifyService(ctx, prevSigner...); err != nil {
+		log.Fatal("provider service check failed", zap.Error(err))
+	}
 
 	// ── Pricing: on-chain service registration is the source of truth ────────
 	// Read per-resource prices and createFee from the contract so users can
 	// verify the actual billing rate on the chain explorer.
-	// Fall back to env vars only when the service is not yet registered.
+	// Fall back to env vars only when the on-chain price is zero.
 	chainCPUPerSec, chainMemPerSec, createFee, err := onchain.GetServicePricing(ctx, common.HexToAddress(cfg.Chain.ProviderAddress))
 	if err != nil {
 		log.Warn("could not read on-chain service pricing; falling back to env vars", zap.Error(err))
@@ -82,9 +133,11 @@ func main() {
 	if pricePerCPUPerSec == nil || pricePerCPUPerSec.Sign() == 0 {
 		pricePerCPUPerSec = new(big.Int)
 		if cfg.Billing.PricePerCPUPerSec != "0" && cfg.Billing.PricePerCPUPerSec != "" {
-			if _, ok := pricePerCPUPerSec.SetString(cfg.Billing.PricePerCPUPerSec, 10); !ok {
-				log.Fatal("invalid PRICE_PER_CPU_PER_SEC")
+			p, err := units.ParseAmount(cfg.Billing.PricePerCPUPerSec)
+			if err != nil {
+				log.Fatal("invalid PRICE_PER_CPU_PER_SEC", zap.Error(err))
 			}
+			pricePerCPUPerSec = p
 		}
 		log.Info("using env PRICE_PER_CPU_PER_SEC (service not on-chain or zero)", zap.String("value", pricePerCPUPerSec.String()))
 	} else {
@@ -96,9 +149,11 @@ func main() {
 	if pricePerMemGBPerSec == nil || pricePerMemGBPerSec.Sign() == 0 {
 		pricePerMemGBPerSec = new(big.Int)
 		if cfg.Billing.PricePerMemGBPerSec != "0" && cfg.Billing.PricePerMemGBPerSec != "" {
-			if _, ok := pricePerMemGBPerSec.SetString(cfg.Billing.PricePerMemGBPerSec, 10); !ok {
-				log.Fatal("invalid PRICE_PER_MEM_GB_PER_SEC")
+			p, err := units.ParseAmount(cfg.Billing.PricePerMemGBPerSec)
+			if err != nil {
+				log.Fatal("invalid PRICE_PER_MEM_GB_PER_SEC", zap.Error(err))
 			}
+			pricePerMemGBPerSec = p
 		}
 		log.Info("using env PRICE_PER_MEM_GB_PER_SEC (service not on-chain or zero)", zap.String("value", pricePerMemGBPerSec.String()))
 	} else {
@@ -109,26 +164,37 @@ func main() {
 	// Seeded from env var; not read from chain anymore (chain now stores per-resource).
 	computePricePerSec := new(big.Int)
 	if pricePerCPUPerSec.Sign() == 0 && pricePerMemGBPerSec.Sign() == 0 {
-		var ok bool
-		computePricePerSec, ok = new(big.Int).SetString(cfg.Billing.ComputePricePerSec, 10)
-		if !ok {
-			log.Fatal("invalid COMPUTE_PRICE_PER_SEC")
+		var err error
+		computePricePerSec, err = units.ParseAmount(cfg.Billing.ComputePricePerSec)
+		if err != nil {
+			log.Fatal("invalid COMPUTE_PRICE_PER_SEC", zap.Error(err))
 		}
 		log.Info("using flat COMPUTE_PRICE_PER_SEC (both per-resource prices are 0)", zap.String("value", computePricePerSec.String()))
 	}
 
 	// Create fee: on-chain takes priority; fall back to env var.
 	if createFee == nil || createFee.Sign() == 0 {
-		var ok bool
-		createFee, ok = new(big.Int).SetString(cfg.Billing.CreateFee, 10)
-		if !ok {
-			log.Fatal("invalid CREATE_FEE")
+		var err error
+		createFee, err = units.ParseAmount(cfg.Billing.CreateFee)
+		if err != nil {
+			log.Fatal("invalid CREATE_FEE", zap.Error(err))
 		}
 		log.Info("using env CREATE_FEE (service not on-chain)", zap.String("value", createFee.String()))
 	} else {
 		log.Info("using on-chain create fee", zap.String("value", createFee.String()))
 	}
 
+	// A disabled fee is not charged at all, so it also drops out of the
+	// balance users need to create or start a sandbox.
+	if !cfg.Billing.CreateFeeEnabled {
+		createFee = new(big.Int)
+		log.Info("create fee disabled (CREATE_FEE_ENABLED=false)")
+	}
+	if !cfg.Billing.ComputeFeeEnabled {
+		pricePerCPUPerSec, pricePerMemGBPerSec, computePricePerSec = new(big.Int), new(big.Int), new(big.Int)
+		log.Info("compute fee disabled (COMPUTE_FEE_ENABLED=false)")
+	}
+
 	signer := billing.NewSigner(
 		onchain.PrivateKey(),
 		onchain.ChainID(),
@@ -138,9 +204,60 @@ func main() {
 		onchain,
 		log,
 	)
+	// Vouchers at rest in Redis (queue, DLQ, archive queue) are encrypted
+	// when REDIS_ENCRYPTION_KEY is set; the settler derives the same codec.
+	codec, err := voucher.NewCodec(cfg.Redis.EncryptionKey) // validated by config.Load
+	if err != nil {
+		log.Fatal("parse REDIS_ENCRYPTION_KEY", zap.Error(err))
+	}
+	if codec != nil {
+		log.Info("voucher encryption at rest enabled", zap.String("key_id", codec.KeyID()))
+	}
+	signer.SetCodec(codec)
+	if cfg.Chain.EIP712DomainName != voucher.DefaultDomainName || cfg.Chain.EIP712DomainVersion != voucher.DefaultDomainVersion {
+		signer.SetDomainSeparator(voucher.DomainSeparatorFor(
+			cfg.Chain.EIP712DomainName, cfg.Chain.EIP712DomainVersion, onchain.ChainID(), onchain.ContractAddress()))
+		log.Info("custom EIP-712 domain",
+			zap.String("name", cfg.Chain.EIP712DomainName),
+			zap.String("version", cfg.Chain.EIP712DomainVersion))
+	}
+	if live != nil {
+		// Tells INVALID_SIGNATURE rejections caused by a signer change apart.
+		signer.SetSignerSource(live)
+
+		// A domain the contract does not use makes every voucher revert with
+		// INVALID_SIGNATURE. UPGRADE_MODE resign/pause reconciles it below.
+		if sep, err := live.DomainSeparator(ctx); err != nil {
+			log.Warn("read contract domainSeparator", zap.Error(err))
+		} else if sep != signer.DomainSeparator() {
+			log.Error("EIP712_DOMAIN_NAME/EIP712_DOMAIN_VERSION do not match the contract's domainSeparator()",
+				zap.String("name", cfg.Chain.EIP712DomainName),
+				zap.String("version", cfg.Chain.EIP712DomainVersion),
+				zap.String("contract", common.Hash(sep).Hex()))
+		}
+	}
+
+	// ── TEE key rotation (optional) ───────────────────────────────────────────
+	// While TEE_PREVIOUS_PRIVATE_KEY is set the signer also holds the outgoing
+	// key until TEE_ROTATION_CUTOFF (see billing.Rotation).
+	var rotation *billing.Rotation
+	if cfg.Chain.TEEPreviousPrivateKey != "" {
+		prevKey, _ := cfg.Chain.PreviousTEEKey() // validated by config.Load
+		cutoff, _ := cfg.Chain.RotationCutoff()  // validated by config.Load
+		rotation = billing.NewRotation(live, signer, prevKey, cutoff, rdb, log)
+	}
 
 	// ── Daytona client ────────────────────────────────────────────────────────
-	dtona := daytona.NewClient(cfg.Daytona.APIURL, cfg.Daytona.AdminKey)
+	dtona := daytona.NewClientWithOptions(cfg.Daytona.APIURL, cfg.Daytona.AdminKey, cfg.Daytona.APIPrefix, daytona.TransportOptions{
+		MaxIdleConnsPerHost: cfg.Daytona.MaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Duration(cfg.Daytona.IdleConnTimeoutSec) * time.Second,
+		HTTP2:               cfg.Daytona.HTTP2,
+	})
+	if ver, err := dtona.Version(ctx); err != nil {
+		log.Warn("daytona version probe failed", zap.String("api_prefix", dtona.APIPrefix()), zap.Error(err))
+	} else {
+		log.Info("daytona reachable", zap.String("api_prefix", dtona.APIPrefix()), zap.String("version", ver))
+	}
 
 	// ── Billing event handler ─────────────────────────────────────────────────
 	billingHandler := billing.NewEventHandler(
@@ -154,18 +271,115 @@ func main() {
 		signer,
 		log,
 	)
+	billingHandler.SetFeesEnabled(cfg.Billing.CreateFeeEnabled, cfg.Billing.ComputeFeeEnabled)
+	billingHandler.SetUsageHashVersion(cfg.Billing.UsageHashVersion)
+	billingHandler.SetSessionTTL(time.Duration(cfg.Billing.SessionTTLSec) * time.Second)
+	billingHandler.SetMaxPause(time.Duration(cfg.Billing.MaxPauseSec) * time.Second)
+	billingHandler.SetMaxPausedTotal(time.Duration(cfg.Billing.MaxPausedTotalSec) * time.Second)
+	billingHandler.SetMaxClockSkew(time.Duration(cfg.Billing.ClockMaxSkewSec) * time.Second)
+	billingHandler.SetIntervalBounds(cfg.Billing.VoucherIntervalMinSec, cfg.Billing.VoucherIntervalMaxSec)
+	billingHandler.SetReceiptLabels(strings.Split(cfg.Billing.ReceiptLabels, ","))
+	billingHandler.SetTrustedWallets(strings.Split(cfg.Billing.TrustedWallets, ","))
+	if err := billingHandler.SetPeriodAlignment(cfg.Billing.PeriodAlignment); err != nil {
+		log.Fatal("period alignment", zap.Error(err))
+	}
+	// Each session bills at the on-chain rates it opened with; a price update
+	// applies from the next session on. The low-balance warning reads balances
+	// from chain, so like the fee schedule it is off under DRY_RUN.
+	if live != nil {
+		billingHandler.SetFeeSchedule(live)
+		billingHandler.SetLowBalanceWarning(live, cfg.Billing.LowBalanceWarnPeriods)
+	}
 
 	// Minimum balance = createFee + one voucher interval of compute fees (per-second pricing).
 	minBalance := new(big.Int).Add(createFee, new(big.Int).Mul(computePricePerSec, big.NewInt(cfg.Billing.VoucherIntervalSec)))
 
 	// ── Stop channel (settler → stop handler, buffered) ───────────────────────
 	stopCh := make(chan settler.StopSignal, 100)
+	// Every stopCh writer is counted in stopWriters so shutdown can wait for
+	// them before the stop handler drains. Once writersClosed is set, a stop
+	// scheduled by a request still in flight is only persisted; the next
+	// start recovers it from stop:sandbox:*.
+	var (
+		stopWriters   sync.WaitGroup
+		stopWritersMu sync.Mutex
+		writersClosed bool
+	)
+	scheduleStop := func(ctx context.Context, sandboxID string, reason settler.StopReason) {
+		stopWritersMu.Lock()
+		if writersClosed {
+			stopWritersMu.Unlock()
+			rdb.Set(ctx, settler.StopKey(sandboxID), string(reason), 0)
+			return
+		}
+		stopWriters.Add(1)
+		stopWritersMu.Unlock()
+		defer stopWriters.Done()
+		settler.ScheduleStop(ctx, rdb, stopCh, sandboxID, reason, log)
+	}
+	billingHandler.SetStopScheduler(scheduleStop)
 
 	// ── Goroutines ────────────────────────────────────────────────────────────
+	// Producers run on their own context so shutdown can stop them, and wait
+	// for the stopCh writers to exit, before the stop handler is told to drain.
+	producerCtx, cancelProducers := context.WithCancel(ctx)
+	defer cancelProducers()
+	stopWriters.Add(2)
 	// Recovery must start after stopCh is ready but before settler writes to it.
-	go recoverPendingStops(ctx, rdb, stopCh, log)
-	go settler.Run(ctx, cfg, rdb, onchain, signer, stopCh, log)
-	go billing.RunGenerator(ctx, rdb, billingHandler, log)
+	go func() {
+		defer stopWriters.Done()
+		recoverPendingStops(producerCtx, rdb, stopCh, log)
+	}()
+	go func() {
+		defer stopWriters.Done()
+		settler.Run(producerCtx, cfg, rdb, onchain, signer, stopCh, log)
+	}()
+	// Settled vouchers are archived to ARCHIVE_BACKEND when it is redis or
+	// ARCHIVE_DIR is set. The archiver runs on ctx, not producerCtx, so its
+	// final flush happens after the settler has stopped enqueueing.
+	var voucherArchiveDone chan struct{}
+	if cfg.Archive.Enabled() {
+		var store storage.Store = storage.NewRedisStore(rdb, config.ArchiveRedisPrefix)
+		if cfg.Archive.Backend != "redis" {
+			fs, err := storage.NewFSStore(cfg.Archive.Dir)
+			if err != nil {
+				log.Fatal("voucher archive init failed", zap.Error(err))
+			}
+			store = fs
+		}
+		archiver := archive.NewArchiver(rdb, store, cfg.Chain.ProviderAddress, cfg.Archive.BatchSize,
+			time.Duration(cfg.Archive.FlushIntervalSec)*time.Second, log)
+		archiver.SetCodec(codec)
+		voucherArchiveDone = make(chan struct{})
+		go func() {
+			defer close(voucherArchiveDone)
+			archiver.Run(ctx)
+		}()
+	}
+	if cfg.Billing.SandboxCheckSec > 0 {
+		billingHandler.SetSandboxCheck(dtona, time.Duration(cfg.Billing.SandboxCheckSec)*time.Second)
+	}
+	go billing.RunGenerator(producerCtx, rdb, billingHandler, log)
+	if cfg.Billing.SessionReapIntervalSec > 0 {
+		go billing.RunSessionReaper(producerCtx, rdb, billingHandler, dtona, time.Duration(cfg.Billing.SessionReapIntervalSec)*time.Second, log)
+	}
+	if live != nil {
+		go billingHandler.RunFeeSchedule(producerCtx)
+		go billing.RunUpgradeWatcher(producerCtx, live, signer, cfg.Billing.UpgradeMode, log)
+	}
+	sampler := metrics.NewQueueSampler(rdb, cfg.Chain.ProviderAddress, queueSampleInterval, log)
+	sampler.SetCodec(codec)
+	go sampler.Run(ctx)
+	var settleReporter *settler.Reporter
+	if cfg.Billing.SettleReportIntervalSec > 0 {
+		settleReporter = settler.NewReporter(rdb, cfg.Chain.ProviderAddress, codec,
+			time.Duration(cfg.Billing.SettleReportIntervalSec)*time.Second, cfg.Billing.VoucherIntervalSec, log)
+		settleReporter.SetMaxBatchSize(cfg.Billing.SettleMaxBatchSize)
+		go settleReporter.Run(ctx)
+	}
+	if rotation != nil {
+		go rotation.Run(producerCtx)
+	}
 
 	// ── HTTP server ───────────────────────────────────────────────────────────
 	gin.SetMode(gin.ReleaseMode)
@@ -185,6 +399,8 @@ func main() {
 	r.GET("/healthz", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	})
+	// Prometheus metrics: settlement queue depth and oldest-voucher age.
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 	r.GET("/dashboard", func(c *gin.Context) {
 		c.Header("Cache-Control", "no-store")
 		c.Data(http.StatusOK, "text/html; charset=utf-8", web.DashboardHTML)
@@ -195,22 +411,13 @@ func main() {
 	r.GET("/static/logo.svg", func(c *gin.Context) {
 		c.Data(http.StatusOK, "image/svg+xml", web.LogoSVG)
 	})
+	// Public routes share the proxied routes' prefix (Daytona's API prefix).
+	apiPrefix := dtona.APIPrefix()
 	// Public providers list — returns known providers with their on-chain service data.
-	r.GET("/api/providers", func(c *gin.Context) {
-		type ProviderInfo struct {
-			Address               string `json:"address"`
-			URL                   string `json:"url"`
-			TEESigner             string `json:"tee_signer"`
-			PricePerCPUPerMin     string `json:"price_per_cpu_per_min"`
-			PricePerCPUPerSec     string `json:"price_per_cpu_per_sec"`
-			PricePerMemGBPerMin   string `json:"price_per_mem_gb_per_min"`
-			PricePerMemGBPerSec   string `json:"price_per_mem_gb_per_sec"`
-			CreateFee             string `json:"create_fee"`
-			SignerVersion         string `json:"signer_version"`
-		}
+	r.GET(apiPrefix+"/providers", func(c *gin.Context) {
 		// For now: just the configured provider.  Extend via KNOWN_PROVIDERS in the future.
 		addrs := []string{cfg.Chain.ProviderAddress}
-		var providers []ProviderInfo
+		var providers []proxy.ProviderInfo
 		for _, addr := range addrs {
 			if addr == "" {
 				continue
@@ -219,25 +426,20 @@ func main() {
 			if err != nil || svcInfo == nil {
 				continue
 			}
-			cpuPerSec := new(big.Int).Div(svcInfo.PricePerCPUPerMin, big.NewInt(60))
-			memPerSec := new(big.Int).Div(svcInfo.PricePerMemGBPerMin, big.NewInt(60))
-			providers = append(providers, ProviderInfo{
-				Address:             addr,
-				URL:                 svcInfo.URL,
-				TEESigner:           svcInfo.TEESignerAddress.Hex(),
-				PricePerCPUPerMin:   svcInfo.PricePerCPUPerMin.String(),
-				PricePerCPUPerSec:   cpuPerSec.String(),
-				PricePerMemGBPerMin: svcInfo.PricePerMemGBPerMin.String(),
-				PricePerMemGBPerSec: memPerSec.String(),
-				CreateFee:           svcInfo.CreateFee.String(),
-				SignerVersion:       svcInfo.SignerVersion.String(),
-			})
+			providers = append(providers, proxy.NewProviderInfo(addr, svcInfo))
 		}
 		if providers == nil {
-			providers = []ProviderInfo{}
+			providers = []proxy.ProviderInfo{}
 		}
 		c.JSON(http.StatusOK, providers)
 	})
+	// Public service discovery — on-chain services(address) lookup.
+	proxy.RegisterProviderService(r.Group(apiPrefix), onchain, cfg.Chain.ProviderAddress)
+	// Public deployment parameters (beacon, implementation, LOCK_TIME, stake).
+	proxy.RegisterSystem(r.Group(apiPrefix), onchain, cfg.Chain.ProviderAddress, log)
+	// Public voucher check: recovered signer, EIP-712 digest and whether the
+	// signer is the provider's on-chain teeSignerAddress.
+	proxy.RegisterVerifyVoucher(r.Group(apiPrefix), onchain, signer.DomainSeparator, cfg.Chain.EIP712DomainName, cfg.Chain.EIP712DomainVersion, log)
 
 	rpcOrigin := cfg.Chain.RPCURL
 	if u, err := url.Parse(cfg.Chain.RPCURL); err == nil {
@@ -251,6 +453,8 @@ func main() {
 			"rpc_url":               rpcOrigin,
 			"compute_price_per_sec": computePricePerSec.String(),
 			"create_fee":            createFee.String(),
+			"create_fee_enabled":    cfg.Billing.CreateFeeEnabled,
+			"compute_fee_enabled":   cfg.Billing.ComputeFeeEnabled,
 			"voucher_interval_sec":  cfg.Billing.VoucherIntervalSec,
 			"min_balance":           minBalance.String(),
 		})
@@ -258,7 +462,7 @@ func main() {
 
 	// Public snapshots list — no signing required; snapshots are provider-managed
 	// base images visible to all users.
-	r.GET("/api/snapshots", func(c *gin.Context) {
+	r.GET(apiPrefix+"/snapshots", func(c *gin.Context) {
 		snaps, err := dtona.ListSnapshots(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusBadGateway, gin.H{"error": "upstream error"})
@@ -272,7 +476,7 @@ func main() {
 
 	// Registry images — lists Docker images in the internal registry.
 	// Used by the provider dashboard to populate the snapshot image dropdown.
-	r.GET("/api/registry/images", func(c *gin.Context) {
+	r.GET(apiPrefix+"/registry/images", func(c *gin.Context) {
 		registryURL := cfg.Daytona.RegistryURL
 		httpClient := &http.Client{Timeout: 10 * time.Second}
 		resp, err := httpClient.Get(registryURL + "/v2/_catalog")
@@ -319,7 +523,7 @@ func main() {
 
 	// Public sandbox list — no signing required, filters by ?wallet= query param.
 	// Sandbox ownership is public (on-chain labels), so this exposes no sensitive data.
-	r.GET("/api/sandbox_list", func(c *gin.Context) {
+	r.GET(apiPrefix+"/sandbox_list", func(c *gin.Context) {
 		wallet := c.Query("wallet")
 		if wallet == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "wallet required"})
@@ -342,10 +546,125 @@ func main() {
 		c.JSON(http.StatusOK, filtered)
 	})
 
-	api := r.Group("/api", auth.Middleware(rdb))
-	proxyHandler := proxy.NewHandler(dtona, billingHandler, onchain, onchain, onchain, createFee, pricePerCPUPerSec, pricePerMemGBPerSec, computePricePerSec, cfg.Chain.ProviderAddress, cfg.Chain.AdminList(), cfg.Server.SSHGatewayHost, rdb, log, cfg.Server.BrokerURL, onchain.PrivateKey(), cfg.Billing.VoucherIntervalSec)
+	// Proxied routes share Daytona's API prefix so inbound paths are forwarded unchanged.
+	authOpts := auth.Options{
+		MaxValidity: time.Duration(cfg.Auth.MaxValiditySec) * time.Second,
+		ClockSkew:   time.Duration(cfg.Auth.ClockSkewSec) * time.Second,
+		// Browsers cannot sign a WebSocket upgrade; only the event stream
+		// takes a token from /auth/token instead.
+		TokenRoutes: []string{apiPrefix + "/events"},
+	}
+	api := r.Group(apiPrefix, auth.MiddlewareWithOptions(rdb, authOpts))
+	fwdPolicy, err := proxy.NewForwardPolicy(cfg.Server.ForwardAllow, cfg.Server.ForwardDeny)
+	if err != nil {
+		log.Fatal("forward policy", zap.Error(err))
+	}
+	// The balance and acknowledgement pre-checks, and the events endpoint,
+	// read the chain; under DRY_RUN they are off.
+	var balCheck proxy.BalanceChecker
+	var ackCheck proxy.AckChecker
+	var eventFetcher proxy.EventFetcher
+	if live != nil {
+		balCheck, ackCheck, eventFetcher = live, live, live
+	}
+	proxyHandler := proxy.NewHandler(dtona, billingHandler, balCheck, ackCheck, eventFetcher, createFee, pricePerCPUPerSec, pricePerMemGBPerSec, computePricePerSec, cfg.Chain.ProviderAddress, cfg.Chain.AdminList(), cfg.Server.SSHGatewayHost, rdb, log, cfg.Server.BrokerURL, onchain.PrivateKey(), cfg.Billing.VoucherIntervalSec, cfg.Billing.MaxSandboxesPerOwner, &fwdPolicy)
+	proxyHandler.SetMaxBodyBytes(cfg.Server.MaxBodyBytes)
+	proxyHandler.SetDeleteWaitTimeout(time.Duration(cfg.Server.DeleteWaitTimeoutSec) * time.Second)
+	proxyHandler.SetAmountPlaces(cfg.Server.AmountDecimals)
+	proxyHandler.SetGzip(cfg.Server.EnableGzip)
+	proxyHandler.SetCreateIDPaths(strings.Split(cfg.Daytona.CreateIDPaths, ","))
+	proxyHandler.SetPublicBaseURL(cfg.Daytona.PublicBaseURL)
+	proxyHandler.SetDepositContract(onchain.ContractAddress().Hex())
+	proxyHandler.SetStopScheduler(scheduleStop)
+	proxyHandler.SetSessionReaper(billingHandler)
+	proxyHandler.SetCreateQuota(cfg.Billing.CreateQuota, time.Duration(cfg.Billing.CreateQuotaWindowSec)*time.Second)
+	if err := proxyHandler.SetPreflightFailureMode(cfg.Billing.PreflightFailureMode); err != nil {
+		log.Fatal("preflight failure mode", zap.Error(err))
+	}
+	if live != nil {
+		proxyHandler.SetAckRelay(live)
+	}
+	if cfg.Billing.RelayDepositEnabled {
+		relayMax, err := units.ParseAmount(cfg.Billing.RelayDepositMax)
+		if err != nil {
+			log.Fatal("invalid RELAY_DEPOSIT_MAX", zap.Error(err))
+		}
+		relayBudget, err := units.ParseAmount(cfg.Billing.RelayDepositDailyBudget)
+		if err != nil {
+			log.Fatal("invalid RELAY_DEPOSIT_DAILY_BUDGET", zap.Error(err))
+		}
+		// The budget is counted in Redis, as an int64.
+		if !relayMax.IsInt64() || !relayBudget.IsInt64() {
+			log.Fatal("RELAY_DEPOSIT_MAX and RELAY_DEPOSIT_DAILY_BUDGET must be below 9.2 0G")
+		}
+		log.Warn("EXPERIMENTAL deposit relay enabled — deposits are paid from provider funds",
+			zap.String("max_per_deposit", relayMax.String()),
+			zap.Int("per_wallet_per_day", cfg.Billing.RelayDepositsPerDay),
+			zap.String("daily_budget", relayBudget.String()),
+		)
+		if relayBudget.Sign() == 0 {
+			relayBudget = nil // unlimited
+		}
+		proxyHandler.SetDepositRelay(live, relayMax, cfg.Billing.RelayDepositsPerDay, relayBudget)
+	}
 	proxyHandler.Register(api)
-	go runStopHandler(ctx, stopCh, dtona, rdb, log, proxyHandler.BrokerDeregister)
+	stopHandlerDone := make(chan struct{})
+	go func() {
+		defer close(stopHandlerDone)
+		runStopHandler(ctx, stopCh, dtona, rdb, cfg.Billing.StopWorkers, log, proxyHandler.BrokerDeregister)
+	}()
+
+	// Admin-only: read or change the log level at runtime, e.g. to capture
+	// debug logs from production without a restart.
+	levelHandler := logging.LevelHandler(logLevel, log)
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		api.Handle(method, "/admin/loglevel", func(c *gin.Context) {
+			if !cfg.Chain.IsAdmin(c.GetString("wallet_address")) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+				return
+			}
+			levelHandler(c)
+		})
+	}
+
+	// Admin-only: TEE key rotation state (signing key vs on-chain signer,
+	// cutoff, vouchers deferred for users who have not re-acknowledged).
+	api.GET("/admin/tee-rotation", func(c *gin.Context) {
+		if !cfg.Chain.IsAdmin(c.GetString("wallet_address")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+			return
+		}
+		if rotation == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no TEE key rotation configured"})
+			return
+		}
+		c.JSON(http.StatusOK, rotation.Status(c.Request.Context()))
+	})
+
+	// Admin-only: the latest settlement throughput report (advisory tuning
+	// hints; see settler.Report).
+	api.GET("/admin/settle-report", func(c *gin.Context) {
+		if !cfg.Chain.IsAdmin(c.GetString("wallet_address")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+			return
+		}
+		if settleReporter == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "settlement report disabled (SETTLE_REPORT_INTERVAL_SEC=0)"})
+			return
+		}
+		rep := settleReporter.Latest()
+		if rep == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no report yet; the first is produced one SETTLE_REPORT_INTERVAL_SEC after startup"})
+			return
+		}
+		c.JSON(http.StatusOK, rep)
+	})
+
+	// Admin-only, off by default: runtime profiles of this process.
+	if cfg.Server.EnablePprof {
+		registerPprof(r.Group("/debug/pprof", auth.MiddlewareWithOptions(rdb, authOpts)), cfg.Chain.IsAdmin)
+		log.Warn("pprof handlers enabled at /debug/pprof (admin only)")
+	}
 
 	// Admin-only: pull an image from an external registry into the internal registry.
 	// The import runs synchronously (crane.Copy) — may take minutes for large images.
@@ -461,7 +780,29 @@ func main() {
 	<-quit
 
 	log.Info("shutting down...")
+	// Stop producers first and wait for the stopCh writers to exit, then let
+	// the stop handler drain what is left so no in-flight stop is dropped.
+	// Anything still unprocessed stays in stop:sandbox:* for the next start.
+	stopWritersMu.Lock()
+	writersClosed = true
+	stopWritersMu.Unlock()
+	cancelProducers()
+	if !waitTimeout(&stopWriters, 15*time.Second) {
+		log.Warn("shutdown: stop-signal writers did not exit in time")
+	}
 	cancel()
+	select {
+	case <-stopHandlerDone:
+	case <-time.After(2 * stopDrainTimeout):
+		log.Warn("shutdown: stop handler did not finish draining")
+	}
+	if voucherArchiveDone != nil {
+		select {
+		case <-voucherArchiveDone:
+		case <-time.After(35 * time.Second):
+			log.Warn("shutdown: voucher archiver did not finish its final flush")
+		}
+	}
 
 	// Archive all running sandboxes before exiting so they can be restarted
 	// after the stack comes back up (state is backed up to object storage).
@@ -477,6 +818,63 @@ func main() {
 	log.Info("shutdown complete")
 }
 
+// chainClient is what the billing service reads and sends on chain: a
+// *chain.Client, or a *chain.DryRunClient under DRY_RUN.
+type chainClient interface {
+	settler.ChainClient
+	billing.NonceReader
+	proxy.SystemReader
+	PrivateKey() *ecdsa.PrivateKey
+	SenderAddress() common.Address
+	VerifyService(ctx context.Context, extra ...common.Address) error
+	GetServicePricing(ctx context.Context, provider common.Address) (pricePerCPUPerSec, pricePerMemGBPerSec, createFee *big.Int, err error)
+}
+
+// registerPprof mounts the net/http/pprof handlers on g, which is expected to
+// be /debug/pprof behind wallet auth; only admin wallets get through. Profiles
+// are named by the last path element (heap, goroutine, allocs, ...), as with
+// the standard /debug/pprof/ mux.
+func registerPprof(g *gin.RouterGroup, isAdmin func(wallet string) bool) {
+	g.Use(func(c *gin.Context) {
+		if !isAdmin(c.GetString("wallet_address")) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+			return
+		}
+		c.Next()
+	})
+	g.Any("/*profile", func(c *gin.Context) {
+		switch c.Param("profile") {
+		case "/cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "/profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "/symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "/trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			// Index serves the listing and, for /debug/pprof/<name>, the
+			// named profile.
+			pprof.Index(c.Writer, c.Request)
+		}
+	})
+}
+
+// waitTimeout waits for wg and reports whether it finished within d.
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
 // archiveRunningOnShutdown archives all started/starting/stopped sandboxes so
 // their container state is preserved in object storage across a redeploy.
 func archiveRunningOnShutdown(ctx context.Context, dtona *daytona.Client, log *zap.Logger) {
@@ -511,80 +909,195 @@ func archiveRunningOnShutdown(ctx context.Context, dtona *daytona.Client, log *z
 	}
 }
 
+// recoveredKeyPrefix + sandbox ID claims a pending stop for one recovery
+// push, for recoveredTTL, so a key SCAN returns twice or a rescan sees again
+// is not queued twice. processStop releases the claim.
+const (
+	recoveredKeyPrefix = "recovered:"
+	recoveredTTL       = 10 * time.Minute
+)
+
+// recoverSendTimeout bounds how long recovery waits for room in stopCh, and
+// recoverBackoffMax caps the pause before the next pass. Vars for tests.
+var (
+	recoverSendTimeout = 5 * time.Second
+	recoverBackoffMax  = 30 * time.Second
+)
+
 // recoverPendingStops scans stop:sandbox:* on startup and re-queues any
 // sandboxes that were scheduled for stop but not yet processed (crash recovery).
+// Each is claimed with SETNX recovered:<id> before it is queued, and skipped if
+// already claimed. When stopCh stays full for recoverSendTimeout the claim is
+// released and the pass ends; the scan is repeated with exponential backoff
+// until a pass queues everything it finds.
 func recoverPendingStops(ctx context.Context, rdb *redis.Client, stopCh chan<- settler.StopSignal, log *zap.Logger) {
+	backoff := recoverSendTimeout
+	for !recoverPass(ctx, rdb, stopCh, log) {
+		log.Warn("recoverPendingStops: stop handler backed up, rescanning later", zap.Duration("backoff", backoff))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, recoverBackoffMax)
+	}
+}
+
+// recoverPass makes one scan, reporting false if it stopped early because
+// stopCh was full. A failed scan or a cancelled ctx also ends recovery.
+func recoverPass(ctx context.Context, rdb *redis.Client, stopCh chan<- settler.StopSignal, log *zap.Logger) bool {
 	var cursor uint64
 	for {
-		keys, next, err := rdb.Scan(ctx, cursor, "stop:sandbox:*", 100).Result()
+		keys, next, err := rdb.Scan(ctx, cursor, settler.StopKey("*"), 100).Result()
 		if err != nil {
-			log.Error("recoverPendingStops: scan", zap.Error(err))
-			return
+			if ctx.Err() == nil {
+				log.Error("recoverPendingStops: scan", zap.Error(err))
+			}
+			return true
 		}
 		for _, key := range keys {
+			sandboxID := strings.TrimPrefix(key, settler.StopKey(""))
+			claimed, err := rdb.SetNX(ctx, recoveredKeyPrefix+sandboxID, 1, recoveredTTL).Result()
+			if err != nil || !claimed {
+				continue // in flight already, or retried on the next pass
+			}
 			reason, _ := rdb.Get(ctx, key).Result()
-			sandboxID := key[len("stop:sandbox:"):]
+			timer := time.NewTimer(recoverSendTimeout)
 			select {
-			case stopCh <- settler.StopSignal{SandboxID: sandboxID, Reason: reason}:
+			case stopCh <- settler.StopSignal{SandboxID: sandboxID, Reason: settler.StopReason(reason)}:
+				timer.Stop()
 				log.Info("recovered pending stop", zap.String("sandbox", sandboxID), zap.String("reason", reason))
+			case <-timer.C:
+				rdb.Del(context.WithoutCancel(ctx), recoveredKeyPrefix+sandboxID) //nolint:errcheck
+				return false
 			case <-ctx.Done():
-				return
+				timer.Stop()
+				rdb.Del(context.WithoutCancel(ctx), recoveredKeyPrefix+sandboxID) //nolint:errcheck
+				return true
 			}
 		}
 		if next == 0 {
-			break
+			return true
 		}
 		cursor = next
 	}
 }
 
-// runStopHandler consumes StopSignals, archives the sandbox (preserving state in
-// object storage so it can be restarted later), and cleans up Redis.
-func runStopHandler(ctx context.Context, stopCh <-chan settler.StopSignal, dtona *daytona.Client, rdb *redis.Client, log *zap.Logger, deregisterBroker func(context.Context, string)) {
+// queueSampleInterval is how often the settlement-queue metrics are refreshed.
+const queueSampleInterval = 15 * time.Second
+
+// stopDrainTimeout bounds each stop processed after shutdown has begun.
+const stopDrainTimeout = 30 * time.Second
+
+// runStopHandler consumes StopSignals with workers goroutines (at least one);
+// each archives the sandbox (preserving state in object storage so it can be
+// restarted later) and cleans up Redis. A signal for a sandbox another worker
+// is already stopping is dropped: that stop covers it.
+//
+// Once ctx is cancelled the signals still buffered in stopCh are drained
+// before returning, so main must stop every writer (settler, recovery) before
+// cancelling ctx.
+func runStopHandler(ctx context.Context, stopCh <-chan settler.StopSignal, dtona *daytona.Client, rdb *redis.Client, workers int, log *zap.Logger, deregisterBroker func(context.Context, string)) {
+	var inflight sync.Map // sandbox ID → struct{}: stops being processed
+	process := func(ctx context.Context, sig settler.StopSignal) {
+		if _, busy := inflight.LoadOrStore(sig.SandboxID, struct{}{}); busy {
+			log.Debug("stop already in progress", zap.String("sandbox", sig.SandboxID))
+			return
+		}
+		defer inflight.Delete(sig.SandboxID)
+		processStop(ctx, sig, dtona, rdb, log, deregisterBroker)
+	}
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopWorker(ctx, stopCh, process)
+		}()
+	}
+	wg.Wait()
+}
+
+// stopWorker passes each signal from stopCh to process until ctx is
+// cancelled, then drains what is still buffered.
+func stopWorker(ctx context.Context, stopCh <-chan settler.StopSignal, process func(context.Context, settler.StopSignal)) {
 	for {
 		select {
 		case sig := <-stopCh:
-			// Daytona requires stopped state before archive.
-			// Step 1: stop (removes container from runner).
-			if err := dtona.StopSandbox(ctx, sig.SandboxID); err != nil {
-				log.Warn("stop sandbox failed (may already be stopped/archived)",
-					zap.String("sandbox", sig.SandboxID),
-					zap.Error(err),
-				)
-			}
-			// Step 2: wait for stopped state (stop is async in Daytona).
-			// Use a 2-minute timeout so a stuck archive job doesn't block this goroutine forever.
-			waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-			if err := dtona.WaitStopped(waitCtx, sig.SandboxID); err != nil {
-				log.Warn("wait stopped failed",
-					zap.String("sandbox", sig.SandboxID),
-					zap.Error(err),
-				)
-			}
-			cancel()
-			// Step 3: archive (backup filesystem to MinIO for later restore).
-			if err := dtona.ArchiveSandbox(ctx, sig.SandboxID); err != nil {
-				log.Warn("archive sandbox failed (may already be archived)",
-					zap.String("sandbox", sig.SandboxID),
-					zap.Error(err),
-				)
-			}
-			rdb.Del(ctx, "billing:compute:"+sig.SandboxID) //nolint:errcheck
-			rdb.Del(ctx, "stop:sandbox:"+sig.SandboxID)    //nolint:errcheck
-			if deregisterBroker != nil {
-				deregisterBroker(ctx, sig.SandboxID)
-			}
-			log.Info("sandbox archived",
-				zap.String("sandbox", sig.SandboxID),
-				zap.String("reason", sig.Reason),
-			)
-			_ = events.Push(ctx, rdb, events.Event{
-				Type:      events.TypeAutoStopped,
-				Message:   fmt.Sprintf("Sandbox %s archived: %s", sig.SandboxID, sig.Reason),
-				SandboxID: sig.SandboxID,
-			})
+			process(ctx, sig)
 		case <-ctx.Done():
-			return
+			for {
+				select {
+				case sig := <-stopCh:
+					process(ctx, sig)
+				default:
+					return
+				}
+			}
 		}
 	}
 }
+
+// processStop stops and archives one sandbox and clears its billing state.
+// When ctx is already cancelled (shutdown drain) it runs on a fresh context
+// bounded by stopDrainTimeout instead.
+func processStop(ctx context.Context, sig settler.StopSignal, dtona *daytona.Client, rdb *redis.Client, log *zap.Logger, deregisterBroker func(context.Context, string)) {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), stopDrainTimeout)
+		defer cancel()
+	}
+	// Daytona requires stopped state before archive.
+	// Step 1: stop (removes container from runner).
+	if err := dtona.StopSandbox(ctx, sig.SandboxID); err != nil {
+		log.Warn("stop sandbox failed (may already be stopped/archived)",
+			zap.String("sandbox", sig.SandboxID),
+			zap.Error(err),
+		)
+	}
+	// Step 2: wait for stopped state (stop is async in Daytona).
+	// Use a 2-minute timeout so a stuck archive job doesn't block this goroutine forever.
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	if err := dtona.WaitStopped(waitCtx, sig.SandboxID); err != nil {
+		log.Warn("wait stopped failed",
+			zap.String("sandbox", sig.SandboxID),
+			zap.Error(err),
+		)
+	}
+	cancel()
+	// Step 3: archive (backup filesystem to MinIO for later restore).
+	if err := dtona.ArchiveSandbox(ctx, sig.SandboxID); err != nil {
+		log.Warn("archive sandbox failed (may already be archived)",
+			zap.String("sandbox", sig.SandboxID),
+			zap.Error(err),
+		)
+	}
+	owner := ""
+	if sess, _ := billing.GetSession(ctx, rdb, sig.SandboxID); sess != nil {
+		owner = sess.Owner
+	}
+	billing.DeleteSession(ctx, rdb, sig.SandboxID) //nolint:errcheck
+	// Keep the reason for GET /api/sandbox/:id/billing once the pending stop
+	// is cleared.
+	if err := settler.RecordStop(ctx, rdb, sig.SandboxID, sig.Reason, time.Now()); err != nil {
+		log.Warn("record stop reason", zap.String("sandbox", sig.SandboxID), zap.Error(err))
+	}
+	rdb.Del(ctx, settler.StopKey(sig.SandboxID), recoveredKeyPrefix+sig.SandboxID) //nolint:errcheck
+	if deregisterBroker != nil {
+		deregisterBroker(ctx, sig.SandboxID)
+	}
+	log.Info("sandbox archived",
+		zap.String("sandbox", sig.SandboxID),
+		zap.String("reason", string(sig.Reason)),
+	)
+	_ = events.Push(ctx, rdb, events.Event{
+		Type:      events.TypeAutoStopped,
+		Message:   fmt.Sprintf("Sandbox %s archived: %s", sig.SandboxID, sig.Reason),
+		SandboxID: sig.SandboxID,
+	})
+	_ = events.Publish(ctx, rdb, owner, events.StreamEvent{
+		Type:      events.TypeAutoStopped,
+		SandboxID: sig.SandboxID,
+		Message:   string(sig.Reason),
+	})
+}
@@ -2,19 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sort"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
 	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona/daytonatest"
 	"github.com/0gfoundation/0g-sandbox/internal/settler"
 )
 
@@ -26,56 +28,6 @@ func newTestRedis(t *testing.T) *redis.Client {
 	return redis.NewClient(&redis.Options{Addr: mr.Addr()})
 }
 
-// mockDaytona returns a test HTTP server that records which sandbox IDs were
-// stopped, and optionally injects failures for specific IDs.
-type mockDaytona struct {
-	mu      sync.Mutex
-	stopped []string
-	failIDs map[string]bool
-	srv     *httptest.Server
-}
-
-func newMockDaytona(t *testing.T) *mockDaytona {
-	t.Helper()
-	m := &mockDaytona{failIDs: make(map[string]bool)}
-	m.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only handle POST /api/sandbox/{id}/stop
-		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/stop") {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		// Extract ID: /api/sandbox/{id}/stop → parts[3]
-		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-		if len(parts) < 4 {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		id := parts[2] // ["api","sandbox",id,"stop"]
-		m.mu.Lock()
-		defer m.mu.Unlock()
-		if m.failIDs[id] {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		m.stopped = append(m.stopped, id)
-		w.WriteHeader(http.StatusOK)
-	}))
-	t.Cleanup(m.srv.Close)
-	return m
-}
-
-func (m *mockDaytona) client() *daytona.Client {
-	return daytona.NewClient(m.srv.URL, "test-key")
-}
-
-func (m *mockDaytona) stoppedIDs() []string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := make([]string, len(m.stopped))
-	copy(out, m.stopped)
-	return out
-}
-
 // waitKeyGone polls until the Redis key disappears or the timeout elapses.
 func waitKeyGone(t *testing.T, rdb *redis.Client, key string, timeout time.Duration) {
 	t.Helper()
@@ -148,7 +100,7 @@ func TestRecoverPendingStops_MultipleKeys(t *testing.T) {
 	got := map[string]string{}
 	for len(stopCh) > 0 {
 		sig := <-stopCh
-		got[sig.SandboxID] = sig.Reason
+		got[sig.SandboxID] = string(sig.Reason)
 	}
 	for _, id := range []string{"sb-a", "sb-b", "sb-c"} {
 		if _, ok := got[id]; !ok {
@@ -207,37 +159,117 @@ func TestRecoverPendingStops_ContextCancelled(t *testing.T) {
 	}
 }
 
+func TestRecoverPendingStops_PushesEachOnce(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	stopCh := make(chan settler.StopSignal, 16)
+
+	ids := []string{"sb-1", "sb-2", "sb-3", "sb-4", "sb-5"}
+	for _, id := range ids {
+		rdb.Set(ctx, settler.StopKey(id), "insufficient_balance", 0) //nolint:errcheck
+	}
+
+	// A second scan while the first signals are still in flight.
+	recoverPendingStops(ctx, rdb, stopCh, zap.NewNop())
+	recoverPendingStops(ctx, rdb, stopCh, zap.NewNop())
+
+	got := map[string]int{}
+	for len(stopCh) > 0 {
+		got[(<-stopCh).SandboxID]++
+	}
+	for _, id := range ids {
+		if got[id] != 1 {
+			t.Errorf("%s pushed %d times, want 1", id, got[id])
+		}
+		if ttl := rdb.TTL(ctx, "recovered:"+id).Val(); ttl <= 0 {
+			t.Errorf("%s: claim TTL %v, want one set", id, ttl)
+		}
+	}
+}
+
+func TestRecoverPendingStops_WaitsForRoom(t *testing.T) {
+	saved := recoverSendTimeout
+	recoverSendTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { recoverSendTimeout = saved })
+
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	stopCh := make(chan settler.StopSignal, 1)
+	ids := []string{"sb-a", "sb-b", "sb-c", "sb-d"}
+	for _, id := range ids {
+		rdb.Set(ctx, settler.StopKey(id), "insufficient_balance", 0) //nolint:errcheck
+	}
+
+	done := make(chan struct{})
+	go func() {
+		recoverPendingStops(ctx, rdb, stopCh, zap.NewNop())
+		close(done)
+	}()
+
+	// The stop handler only starts consuming after a send has timed out.
+	time.Sleep(50 * time.Millisecond)
+	got := map[string]int{}
+	deadline := time.After(3 * time.Second)
+	for len(got) < len(ids) {
+		select {
+		case sig := <-stopCh:
+			got[sig.SandboxID]++
+		case <-deadline:
+			t.Fatalf("recovered %v, want all of %v", got, ids)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("recoverPendingStops did not return once everything was queued")
+	}
+	if len(stopCh) != 0 {
+		t.Errorf("%d extra signals queued", len(stopCh))
+	}
+	for _, id := range ids {
+		if got[id] != 1 {
+			t.Errorf("%s pushed %d times, want 1", id, got[id])
+		}
+	}
+}
+
 // ── runStopHandler ────────────────────────────────────────────────────────────
 
 func TestRunStopHandler_StopsAndCleansRedis(t *testing.T) {
 	rdb := newTestRedis(t)
-	mock := newMockDaytona(t)
+	mock := daytonatest.NewServer(t, "sb")
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	stopCh := make(chan settler.StopSignal, 4)
 
-	// Pre-populate both Redis keys that the handler should delete
+	// Pre-populate the Redis keys that the handler should delete
 	bg := context.Background()
 	rdb.Set(bg, "billing:compute:sb-1", "session", 0)          //nolint:errcheck
 	rdb.Set(bg, "stop:sandbox:sb-1", "insufficient_balance", 0) //nolint:errcheck
+	rdb.Set(bg, "recovered:sb-1", 1, time.Minute)               //nolint:errcheck
 
-	go runStopHandler(ctx, stopCh, mock.client(), rdb, zap.NewNop(), nil)
+	go runStopHandler(ctx, stopCh, mock.Client(), rdb, 1, zap.NewNop(), nil)
 
 	stopCh <- settler.StopSignal{SandboxID: "sb-1", Reason: "insufficient_balance"}
 
 	waitKeyGone(t, rdb, "stop:sandbox:sb-1", time.Second)
 	waitKeyGone(t, rdb, "billing:compute:sb-1", time.Second)
+	waitKeyGone(t, rdb, "recovered:sb-1", time.Second)
 
-	ids := mock.stoppedIDs()
+	ids := mock.Stopped()
 	if len(ids) != 1 || ids[0] != "sb-1" {
 		t.Errorf("Daytona stopped: got %v want [sb-1]", ids)
 	}
+	// The reason outlives the pending stop.
+	if rec, _ := settler.GetStopRecord(bg, rdb, "sb-1"); rec == nil || rec.Reason != settler.StopInsufficientBalance {
+		t.Errorf("stop record: got %+v", rec)
+	}
 }
 
 func TestRunStopHandler_DaytonaError_StillCleansRedis(t *testing.T) {
 	rdb := newTestRedis(t)
-	mock := newMockDaytona(t)
-	mock.failIDs["sb-err"] = true // simulate Daytona returning 500
+	mock := daytonatest.NewServer(t, "sb")
+	mock.Fail("sb-err", http.StatusInternalServerError)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -247,7 +279,7 @@ func TestRunStopHandler_DaytonaError_StillCleansRedis(t *testing.T) {
 	rdb.Set(bg, "billing:compute:sb-err", "session", 0)    //nolint:errcheck
 	rdb.Set(bg, "stop:sandbox:sb-err", "not_acknowledged", 0) //nolint:errcheck
 
-	go runStopHandler(ctx, stopCh, mock.client(), rdb, zap.NewNop(), nil)
+	go runStopHandler(ctx, stopCh, mock.Client(), rdb, 1, zap.NewNop(), nil)
 
 	stopCh <- settler.StopSignal{SandboxID: "sb-err", Reason: "not_acknowledged"}
 
@@ -258,7 +290,7 @@ func TestRunStopHandler_DaytonaError_StillCleansRedis(t *testing.T) {
 
 func TestRunStopHandler_MultipleSignals(t *testing.T) {
 	rdb := newTestRedis(t)
-	mock := newMockDaytona(t)
+	mock := daytonatest.NewServer(t, "sb")
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	stopCh := make(chan settler.StopSignal, 8)
@@ -268,7 +300,7 @@ func TestRunStopHandler_MultipleSignals(t *testing.T) {
 		rdb.Set(bg, "stop:sandbox:"+id, "insufficient_balance", 0) //nolint:errcheck
 	}
 
-	go runStopHandler(ctx, stopCh, mock.client(), rdb, zap.NewNop(), nil)
+	go runStopHandler(ctx, stopCh, mock.Client(), rdb, 1, zap.NewNop(), nil)
 
 	for _, id := range []string{"sb-x", "sb-y", "sb-z"} {
 		stopCh <- settler.StopSignal{SandboxID: id, Reason: "insufficient_balance"}
@@ -278,7 +310,7 @@ func TestRunStopHandler_MultipleSignals(t *testing.T) {
 		waitKeyGone(t, rdb, "stop:sandbox:"+id, time.Second)
 	}
 
-	ids := mock.stoppedIDs()
+	ids := mock.Stopped()
 	sort.Strings(ids)
 	want := []string{"sb-x", "sb-y", "sb-z"}
 	for i, w := range want {
@@ -288,15 +320,60 @@ func TestRunStopHandler_MultipleSignals(t *testing.T) {
 	}
 }
 
+// TestRunStopHandler_WorkersStopFloodInParallel floods the handler with
+// slow stops, each sandbox signalled twice: with several workers they all
+// finish well within the time one worker would need, and no sandbox is
+// handled by two workers at once.
+func TestRunStopHandler_WorkersStopFloodInParallel(t *testing.T) {
+	rdb := newTestRedis(t)
+	mock := daytonatest.NewServer(t, "sb")
+	mock.SetLatency(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const n = 20
+	stopCh := make(chan settler.StopSignal, 2*n)
+	bg := context.Background()
+	for i := range n {
+		id := fmt.Sprintf("sb-%d", i)
+		mock.Add(daytona.Sandbox{ID: id})
+		rdb.Set(bg, "stop:sandbox:"+id, "insufficient_balance", 0) //nolint:errcheck
+		stopCh <- settler.StopSignal{SandboxID: id, Reason: "insufficient_balance"}
+		stopCh <- settler.StopSignal{SandboxID: id, Reason: "insufficient_balance"}
+	}
+
+	start := time.Now()
+	go runStopHandler(ctx, stopCh, mock.Client(), rdb, 8, zap.NewNop(), nil)
+	for i := range n {
+		waitKeyGone(t, rdb, fmt.Sprintf("stop:sandbox:sb-%d", i), 3*time.Second)
+	}
+	// Each stop is three Daytona calls (stop, state poll, archive), so one
+	// worker needs n × 150ms = 3s for the first signal of each sandbox.
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("%d stops took %v with 8 workers", n, elapsed)
+	}
+
+	if o := mock.Overlaps(); o != 0 {
+		t.Errorf("%d Daytona calls overlapped another for the same sandbox", o)
+	}
+	seen := map[string]bool{}
+	for _, id := range mock.Stopped() {
+		seen[id] = true
+	}
+	if len(seen) != n {
+		t.Errorf("stopped %d distinct sandboxes, want %d", len(seen), n)
+	}
+}
+
 func TestRunStopHandler_ContextCancel_Exits(t *testing.T) {
 	rdb := newTestRedis(t)
-	mock := newMockDaytona(t)
+	mock := daytonatest.NewServer(t, "sb")
 	ctx, cancel := context.WithCancel(context.Background())
 	stopCh := make(chan settler.StopSignal)
 
 	done := make(chan struct{})
 	go func() {
-		runStopHandler(ctx, stopCh, mock.client(), rdb, zap.NewNop(), nil)
+		runStopHandler(ctx, stopCh, mock.Client(), rdb, 1, zap.NewNop(), nil)
 		close(done)
 	}()
 
@@ -309,3 +386,78 @@ func TestRunStopHandler_ContextCancel_Exits(t *testing.T) {
 		t.Error("runStopHandler did not exit after context cancellation")
 	}
 }
+
+// TestRunStopHandler_DrainsOnShutdown checks that a signal enqueued right
+// before shutdown is still processed: the handler drains stopCh on a fresh
+// context instead of returning as soon as its context is cancelled.
+func TestRunStopHandler_DrainsOnShutdown(t *testing.T) {
+	rdb := newTestRedis(t)
+	mock := daytonatest.NewServer(t, "sb")
+	stopCh := make(chan settler.StopSignal, 4)
+
+	bg := context.Background()
+	rdb.Set(bg, "billing:compute:sb-late", "session", 0)          //nolint:errcheck
+	rdb.Set(bg, "stop:sandbox:sb-late", "insufficient_balance", 0) //nolint:errcheck
+
+	// Producers have stopped and the handler's context is cancelled by the
+	// time it gets to look at the signal.
+	stopCh <- settler.StopSignal{SandboxID: "sb-late", Reason: "insufficient_balance"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		runStopHandler(ctx, stopCh, mock.Client(), rdb, 1, zap.NewNop(), nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("runStopHandler did not return after draining")
+	}
+
+	if ids := mock.Stopped(); len(ids) != 1 || ids[0] != "sb-late" {
+		t.Errorf("Daytona stopped: got %v want [sb-late]", ids)
+	}
+	for _, key := range []string{"stop:sandbox:sb-late", "billing:compute:sb-late"} {
+		if n, _ := rdb.Exists(bg, key).Result(); n != 0 {
+			t.Errorf("%s not cleaned up", key)
+		}
+	}
+	if len(stopCh) != 0 {
+		t.Errorf("stopCh not drained: %d left", len(stopCh))
+	}
+}
+
+// ── registerPprof ─────────────────────────────────────────────────────────────
+
+func TestRegisterPprof_AdminOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// Stand-in for auth.Middleware: the wallet comes from a header.
+	g := r.Group("/debug/pprof", func(c *gin.Context) {
+		c.Set("wallet_address", c.GetHeader("X-Wallet-Address"))
+		c.Next()
+	})
+	registerPprof(g, func(wallet string) bool { return wallet == "0xadmin" })
+
+	for _, tc := range []struct {
+		wallet, path string
+		want         int
+		body         string
+	}{
+		{"0xuser", "/debug/pprof/", http.StatusForbidden, "admin only"},
+		{"0xuser", "/debug/pprof/heap", http.StatusForbidden, "admin only"},
+		{"0xadmin", "/debug/pprof/", http.StatusOK, "goroutine"},
+		{"0xadmin", "/debug/pprof/goroutine?debug=1", http.StatusOK, "TestRegisterPprof_AdminOnly"},
+		{"0xadmin", "/debug/pprof/cmdline", http.StatusOK, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("X-Wallet-Address", tc.wallet)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want || !strings.Contains(w.Body.String(), tc.body) {
+			t.Errorf("%s %s: got %d %.200q, want %d containing %q", tc.wallet, tc.path, w.Code, w.Body.String(), tc.want, tc.body)
+		}
+	}
+}
@@ -19,18 +19,23 @@ import (
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
 	"github.com/0gfoundation/0g-sandbox/internal/config"
 	"github.com/0gfoundation/0g-sandbox/internal/indexer"
+	"github.com/0gfoundation/0g-sandbox/internal/logging"
 	"github.com/0gfoundation/0g-sandbox/internal/tee"
 	"github.com/0gfoundation/0g-sandbox/web"
 )
 
 func main() {
-	log, _ := zap.NewProduction()
-	defer log.Sync() //nolint:errcheck
-
 	cfg, err := config.LoadBroker()
 	if err != nil {
-		log.Fatal("config load failed", zap.Error(err))
+		boot, _ := zap.NewProduction()
+		boot.Fatal("config load failed", zap.Error(err))
 	}
+	log, _, err := logging.New(cfg.Server)
+	if err != nil {
+		boot, _ := zap.NewProduction()
+		boot.Fatal("logger init failed", zap.Error(err))
+	}
+	defer log.Sync() //nolint:errcheck
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -69,6 +74,7 @@ func main() {
 
 	// ── Provider indexer ──────────────────────────────────────────────────────
 	idx := indexer.New(onchain, rdb, log)
+	idx.SetStartBlock(cfg.Chain.StartBlock)
 	idx.LoadFromRedis(ctx)
 	go idx.Run(ctx)
 
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/hex"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// abiDiff compares the function selectors of binding, the ABI the abigen Go
+// bindings were generated from, with those of a compiled artifact. missing
+// lists binding functions the artifact lacks: calls the Go code makes that
+// the deployed bytecode would revert. extra lists artifact functions the
+// binding lacks. Entries read "sig 0xselector", sorted by signature.
+func abiDiff(binding, artifact abi.ABI) (missing, extra []string) {
+	have := selectors(artifact)
+	want := selectors(binding)
+	for id, sig := range want {
+		if _, ok := have[id]; !ok {
+			missing = append(missing, sig)
+		}
+	}
+	for id, sig := range have {
+		if _, ok := want[id]; !ok {
+			extra = append(extra, sig)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// selectors maps each function's 4-byte selector (hex) to "sig 0xselector".
+func selectors(a abi.ABI) map[string]string {
+	out := make(map[string]string, len(a.Methods))
+	for _, m := range a.Methods {
+		id := hex.EncodeToString(m.ID)
+		out[id] = m.Sig + " 0x" + id
+	}
+	return out
+}
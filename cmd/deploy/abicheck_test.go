@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+func TestABIDiff(t *testing.T) {
+	binding, err := abi.JSON(strings.NewReader(chain.SandboxServingMetaData.ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing, extra := abiDiff(binding, binding); len(missing) != 0 || len(extra) != 0 {
+		t.Errorf("identical ABIs: missing %v, extra %v", missing, extra)
+	}
+
+	// A stale artifact: compiled before settleFeesWithTEE existed, with a
+	// function since removed from the contract.
+	stale, err := abi.JSON(strings.NewReader(chain.SandboxServingMetaData.ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settle string
+	for name, m := range stale.Methods {
+		if strings.EqualFold(name, "settleFeesWithTEE") {
+			settle = m.Sig
+			delete(stale.Methods, name)
+		}
+	}
+	if settle == "" {
+		t.Fatal("binding has no settleFeesWithTEE")
+	}
+	old, err := abi.JSON(strings.NewReader(`[{"type":"function","name":"legacySettle","inputs":[{"name":"n","type":"uint256"}],"outputs":[],"stateMutability":"nonpayable"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.Methods["legacySettle"] = old.Methods["legacySettle"]
+
+	missing, extra := abiDiff(binding, stale)
+	if len(missing) != 1 || !strings.HasPrefix(missing[0], settle+" 0x") {
+		t.Errorf("missing: got %v, want %s", missing, settle)
+	}
+	if len(extra) != 1 || !strings.HasPrefix(extra[0], "legacySettle(uint256) 0x") {
+		t.Errorf("extra: got %v, want legacySettle(uint256)", extra)
+	}
+}
@@ -6,15 +6,26 @@
 //   3. Deploy BeaconProxy(beacon, initialize(providerStake)) — this is the stable address
 //
 // Usage:
-//   go run ./cmd/deploy/ --rpc <url> --key <hex> --chain-id <id> [--stake <neuron>]
+//   go run ./cmd/deploy/ --rpc <url> --key <hex> --chain-id <id> [--stake <neuron | "N 0G">] [--output json] [--strict]
+//
+// Before deploying, the SandboxServing and UpgradeableBeacon artifacts' ABIs
+// are compared with the Go bindings (chain.*MetaData.ABI): a mismatch means
+// the bindings were regenerated without recompiling the contracts, or the
+// other way round. Mismatches are warnings; with --strict a binding function
+// missing from the artifact aborts the deploy. --check-abi=false skips it.
+//
+// With --output json, progress goes to stderr and stdout carries only
+//   {"impl", "beacon", "proxy", "txHashes": {"impl", "beacon", "proxy"}}
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"math/big"
 	"os"
 	"strings"
@@ -26,19 +37,46 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/units"
 )
 
+// deployResult is what --output json prints to stdout.
+type deployResult struct {
+	Impl     string         `json:"impl"`
+	Beacon   string         `json:"beacon"`
+	Proxy    string         `json:"proxy"`
+	TxHashes deployTxHashes `json:"txHashes"`
+}
+
+type deployTxHashes struct {
+	Impl   string `json:"impl"`
+	Beacon string `json:"beacon"`
+	Proxy  string `json:"proxy"`
+}
+
 func main() {
-	rpcURL  := flag.String("rpc",      "https://evmrpc-testnet.0g.ai", "EVM RPC endpoint")
-	keyHex  := flag.String("key",      "",    "deployer private key (hex, with or without 0x)")
-	chainID := flag.Int64("chain-id",  16602, "chain ID")
-	stake   := flag.String("stake",    "0",   "providerStake for initialize() (neuron)")
+	rpcURL   := flag.String("rpc",       "https://evmrpc-testnet.0g.ai", "EVM RPC endpoint")
+	keyHex   := flag.String("key",       "",    "deployer private key (hex, with or without 0x)")
+	chainID  := flag.Int64("chain-id",   16602, "chain ID")
+	stake    := flag.String("stake",     "0",   "providerStake for initialize() (neuron, or e.g. \"0.5 0G\")")
+	output   := flag.String("output",    "text", "output format: text or json (result on stdout, progress on stderr)")
+	checkABI := flag.Bool("check-abi",   true,  "compare the artifact ABIs with the Go bindings before deploying")
+	strict   := flag.Bool("strict",      false, "abort if a Go binding function is missing from its artifact ABI")
 	flag.Parse()
 
 	if *keyHex == "" {
 		fmt.Fprintln(os.Stderr, "error: --key is required")
 		os.Exit(1)
 	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "error: --output must be text or json, got %q\n", *output)
+		os.Exit(1)
+	}
+	// Human-readable progress; kept off stdout when it carries JSON.
+	var out io.Writer = os.Stdout
+	if *output == "json" {
+		out = os.Stderr
+	}
 
 	// ── private key ───────────────────────────────────────────────────────────
 	keyStr := strings.TrimPrefix(*keyHex, "0x")
@@ -48,7 +86,7 @@ func main() {
 		os.Exit(1)
 	}
 	deployer := crypto.PubkeyToAddress(privKey.PublicKey)
-	fmt.Printf("Deployer : %s\n", deployer.Hex())
+	fmt.Fprintf(out, "Deployer : %s\n", deployer.Hex())
 
 	// ── chain client ──────────────────────────────────────────────────────────
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
@@ -69,20 +107,21 @@ func main() {
 	auth.Context = ctx
 
 	// ── parse providerStake ───────────────────────────────────────────────────
-	providerStake := new(big.Int)
-	if _, ok := providerStake.SetString(*stake, 10); !ok {
-		fmt.Fprintf(os.Stderr, "invalid stake value: %s\n", *stake)
+	providerStake, err := units.ParseAmount(*stake)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid stake value: %v\n", err)
 		os.Exit(1)
 	}
 
-	// ── helper: load bytecode from Foundry artifact ───────────────────────────
-	loadBytecode := func(artifactPath string) []byte {
+	// ── helper: load bytecode and ABI from Foundry artifact ────────────────────
+	loadArtifact := func(artifactPath string) ([]byte, json.RawMessage) {
 		raw, err := os.ReadFile(artifactPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "read artifact %s: %v\n", artifactPath, err)
 			os.Exit(1)
 		}
 		var artifact struct {
+			ABI      json.RawMessage `json:"abi"`
 			Bytecode struct {
 				Object string `json:"object"`
 			} `json:"bytecode"`
@@ -96,25 +135,62 @@ func main() {
 			fmt.Fprintf(os.Stderr, "decode bytecode %s: %v\n", artifactPath, err)
 			os.Exit(1)
 		}
-		return b
+		return b, artifact.ABI
 	}
 
-	// ── Step 1: Deploy SandboxServing implementation ──────────────────────────
-	fmt.Printf("\n[1/3] Deploying SandboxServing implementation (chainID=%d)...\n", *chainID)
+	// ── helper: compare an artifact's ABI with its Go binding ─────────────────
+	verifyABI := func(name string, binding abi.ABI, artifactABI json.RawMessage) {
+		compiled, err := abi.JSON(bytes.NewReader(artifactABI))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s artifact ABI unreadable: %v\n", name, err)
+			if *strict {
+				os.Exit(1)
+			}
+			return
+		}
+		missing, extra := abiDiff(binding, compiled)
+		for _, sig := range missing {
+			fmt.Fprintf(os.Stderr, "warning: %s: Go binding function %s is missing from the artifact\n", name, sig)
+		}
+		for _, sig := range extra {
+			fmt.Fprintf(os.Stderr, "warning: %s: artifact function %s is not in the Go binding\n", name, sig)
+		}
+		if len(missing) > 0 && *strict {
+			fmt.Fprintf(os.Stderr, "%s artifact does not match the Go bindings: recompile the contracts (make build-contracts) or regenerate the bindings (make abigen)\n", name)
+			os.Exit(1)
+		}
+		if len(missing) == 0 && len(extra) == 0 {
+			fmt.Fprintf(out, "  %s artifact ABI matches the Go binding\n", name)
+		}
+	}
 
 	implABI, err := abi.JSON(strings.NewReader(chain.SandboxServingMetaData.ABI))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "parse SandboxServing ABI: %v\n", err)
 		os.Exit(1)
 	}
-	implBytecode := loadBytecode("contracts/out/SandboxServing.sol/SandboxServing.json")
+	beaconABI, err := abi.JSON(strings.NewReader(chain.UpgradeableBeaconMetaData.ABI))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse UpgradeableBeacon ABI: %v\n", err)
+		os.Exit(1)
+	}
+	implBytecode, implArtifactABI := loadArtifact("contracts/out/SandboxServing.sol/SandboxServing.json")
+	beaconBytecode, beaconArtifactABI := loadArtifact("contracts/out/UpgradeableBeacon.sol/UpgradeableBeacon.json")
+	proxyBytecode, _ := loadArtifact("contracts/out/BeaconProxy.sol/BeaconProxy.json")
+	if *checkABI || *strict {
+		verifyABI("SandboxServing", implABI, implArtifactABI)
+		verifyABI("UpgradeableBeacon", beaconABI, beaconArtifactABI)
+	}
+
+	// ── Step 1: Deploy SandboxServing implementation ──────────────────────────
+	fmt.Fprintf(out, "\n[1/3] Deploying SandboxServing implementation (chainID=%d)...\n", *chainID)
 
 	implAddr, implTx, _, err := bind.DeployContract(auth, implABI, implBytecode, client)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "deploy impl: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("  Tx hash : %s\n", implTx.Hash().Hex())
+	fmt.Fprintf(out, "  Tx hash : %s\n", implTx.Hash().Hex())
 	implReceipt, err := bind.WaitMined(ctx, client, implTx)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "wait mined (impl): %v\n", err)
@@ -124,26 +200,19 @@ func main() {
 		fmt.Fprintln(os.Stderr, "impl deploy tx reverted")
 		os.Exit(1)
 	}
-	fmt.Printf("  Impl    : %s\n", implAddr.Hex())
+	fmt.Fprintf(out, "  Impl    : %s\n", implAddr.Hex())
 
 	// ── Step 2: Deploy UpgradeableBeacon(impl, deployer) ─────────────────────
-	fmt.Printf("\n[2/3] Deploying UpgradeableBeacon(impl=%s, owner=%s)...\n",
+	fmt.Fprintf(out, "\n[2/3] Deploying UpgradeableBeacon(impl=%s, owner=%s)...\n",
 		implAddr.Hex(), deployer.Hex())
 
-	beaconABI, err := abi.JSON(strings.NewReader(chain.UpgradeableBeaconMetaData.ABI))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "parse UpgradeableBeacon ABI: %v\n", err)
-		os.Exit(1)
-	}
-	beaconBytecode := loadBytecode("contracts/out/UpgradeableBeacon.sol/UpgradeableBeacon.json")
-
 	beaconAddr, beaconTx, _, err := bind.DeployContract(auth, beaconABI, beaconBytecode, client,
 		implAddr, deployer)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "deploy beacon: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("  Tx hash : %s\n", beaconTx.Hash().Hex())
+	fmt.Fprintf(out, "  Tx hash : %s\n", beaconTx.Hash().Hex())
 	beaconReceipt, err := bind.WaitMined(ctx, client, beaconTx)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "wait mined (beacon): %v\n", err)
@@ -153,10 +222,10 @@ func main() {
 		fmt.Fprintln(os.Stderr, "beacon deploy tx reverted")
 		os.Exit(1)
 	}
-	fmt.Printf("  Beacon  : %s\n", beaconAddr.Hex())
+	fmt.Fprintf(out, "  Beacon  : %s\n", beaconAddr.Hex())
 
 	// ── Step 3: Deploy BeaconProxy(beacon, initialize(providerStake)) ─────────
-	fmt.Printf("\n[3/3] Deploying BeaconProxy(beacon=%s, stake=%s neuron)...\n",
+	fmt.Fprintf(out, "\n[3/3] Deploying BeaconProxy(beacon=%s, stake=%s neuron)...\n",
 		beaconAddr.Hex(), providerStake)
 
 	// Build initialize(providerStake) calldata
@@ -180,7 +249,6 @@ func main() {
 		fmt.Fprintf(os.Stderr, "parse proxy constructor ABI: %v\n", err)
 		os.Exit(1)
 	}
-	proxyBytecode := loadBytecode("contracts/out/BeaconProxy.sol/BeaconProxy.json")
 
 	proxyAddr, proxyTx, _, err := bind.DeployContract(auth, proxyConstructorABI, proxyBytecode, client,
 		beaconAddr, initCalldata)
@@ -188,7 +256,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "deploy proxy: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("  Tx hash : %s\n", proxyTx.Hash().Hex())
+	fmt.Fprintf(out, "  Tx hash : %s\n", proxyTx.Hash().Hex())
 	proxyReceipt, err := bind.WaitMined(ctx, client, proxyTx)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "wait mined (proxy): %v\n", err)
@@ -198,10 +266,29 @@ func main() {
 		fmt.Fprintln(os.Stderr, "proxy deploy tx reverted")
 		os.Exit(1)
 	}
-	fmt.Printf("  Proxy   : %s\n", proxyAddr.Hex())
+	fmt.Fprintf(out, "  Proxy   : %s\n", proxyAddr.Hex())
 
 	// ── Summary ───────────────────────────────────────────────────────────────
-	fmt.Printf(`
+	res := deployResult{
+		Impl:   implAddr.Hex(),
+		Beacon: beaconAddr.Hex(),
+		Proxy:  proxyAddr.Hex(),
+		TxHashes: deployTxHashes{
+			Impl:   implTx.Hash().Hex(),
+			Beacon: beaconTx.Hash().Hex(),
+			Proxy:  proxyTx.Hash().Hex(),
+		},
+	}
+	if err := printResult(os.Stdout, out, *output, res); err != nil {
+		fmt.Fprintf(os.Stderr, "encode result: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printResult writes the DEPLOY COMPLETE banner to out (stderr with --output
+// json) and, with --output json, r to stdout.
+func printResult(stdout, out io.Writer, format string, r deployResult) error {
+	fmt.Fprintf(out, `
 ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 DEPLOY COMPLETE
 ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
@@ -215,6 +302,11 @@ Set in .env:
 Explorer (proxy):
   https://chainscan-galileo.0g.ai/address/%s
 ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-`, implAddr.Hex(), beaconAddr.Hex(), proxyAddr.Hex(),
-		proxyAddr.Hex(), proxyAddr.Hex())
+`, r.Impl, r.Beacon, r.Proxy, r.Proxy, r.Proxy)
+	if format != "json" {
+		return nil
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPrintResult(t *testing.T) {
+	r := deployResult{
+		Impl:     "0x1111111111111111111111111111111111111111",
+		Beacon:   "0x2222222222222222222222222222222222222222",
+		Proxy:    "0x3333333333333333333333333333333333333333",
+		TxHashes: deployTxHashes{Impl: "0xaa", Beacon: "0xbb", Proxy: "0xcc"},
+	}
+
+	// --output json: stdout is only the result; the banner goes to stderr.
+	var stdout, stderr bytes.Buffer
+	if err := printResult(&stdout, &stderr, "json", r); err != nil {
+		t.Fatal(err)
+	}
+	printed := stdout.String()
+	var got deployResult
+	dec := json.NewDecoder(strings.NewReader(printed))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("stdout is not a deploy result: %v", err)
+	}
+	if got != r {
+		t.Errorf("result: got %+v want %+v", got, r)
+	}
+	if dec.More() {
+		t.Error("stdout carries more than the result")
+	}
+	if !strings.Contains(stderr.String(), "DEPLOY COMPLETE") {
+		t.Errorf("banner missing from stderr: %q", stderr.String())
+	}
+	var raw map[string]any
+	json.Unmarshal([]byte(printed), &raw) //nolint:errcheck
+	if txs, ok := raw["txHashes"].(map[string]any); !ok || txs["proxy"] != "0xcc" {
+		t.Errorf("JSON shape: got %s", printed)
+	}
+
+	// --output text: the banner is the output.
+	stdout.Reset()
+	if err := printResult(&stdout, &stdout, "text", r); err != nil {
+		t.Fatal(err)
+	}
+	if s := stdout.String(); !strings.Contains(s, "DEPLOY COMPLETE") || strings.Contains(s, "{") {
+		t.Errorf("text output: %q", s)
+	}
+}
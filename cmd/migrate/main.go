@@ -0,0 +1,91 @@
+// cmd/migrate/main.go — migrates the billing Redis key schema (see
+// internal/migrate), e.g. backfilling an index a new release reads.
+//
+// Run it before starting a release that needs a newer schema. It applies the
+// pending migrations in order, records the schema version in Redis and is
+// safe to re-run: an up-to-date schema is a no-op.
+//
+// Usage:
+//
+//	go run ./cmd/migrate/ --redis redis:6379 [--to N] [--dry-run]
+//	go run ./cmd/migrate/ --status
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/migrate"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+func main() {
+	addr := flag.String("redis", envOr("REDIS_ADDR", "redis:6379"), "Redis address (default $REDIS_ADDR)")
+	to := flag.Int("to", 0, "migrate up to this schema version (default: latest)")
+	dryRun := flag.Bool("dry-run", false, "report what each migration would change without writing")
+	status := flag.Bool("status", false, "print the applied and available migrations and exit")
+	flag.Parse()
+
+	// REDIS_ENCRYPTION_KEY opens encrypted queue items; it is read from the
+	// environment only, like the billing server does.
+	codec, err := voucher.NewCodec(os.Getenv("REDIS_ENCRYPTION_KEY"))
+	if err != nil {
+		fatalf("invalid REDIS_ENCRYPTION_KEY: %v", err)
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: *addr, Password: os.Getenv("REDIS_PASSWORD")})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	current, err := migrate.CurrentVersion(ctx, rdb)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *status {
+		fmt.Printf("schema version %d of %d\n", current, len(migrate.Migrations))
+		for _, m := range migrate.Migrations {
+			mark := " "
+			if m.Version <= current {
+				mark = "x"
+			}
+			fmt.Printf("[%s] %d %-16s %s\n", mark, m.Version, m.Name, m.Description)
+		}
+		return
+	}
+
+	results, err := migrate.Run(ctx, migrate.Env{RDB: rdb, Codec: codec}, migrate.Migrations, *to, *dryRun)
+	verb := "changed"
+	if *dryRun {
+		verb = "would change"
+	}
+	for _, r := range results {
+		fmt.Printf("%d %-16s %s %d item(s), skipped %d unreadable\n", r.Version, r.Name, verb, r.Changed, r.Skipped)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("schema version %d is up to date\n", current)
+		return
+	}
+	if *dryRun {
+		fmt.Printf("dry run: schema stays at version %d\n", current)
+		return
+	}
+	fmt.Printf("schema version %d\n", results[len(results)-1].Version)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "migrate: "+format+"\n", args...)
+	os.Exit(1)
+}
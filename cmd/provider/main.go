@@ -4,7 +4,7 @@
 //
 //	register       Register (or update) the service on the settlement contract
 //	status         Show provider registration, stake, and earnings
-//	withdraw       Withdraw accumulated earnings
+//	withdraw       Withdraw accumulated earnings, optionally sweeping them to a cold wallet
 //	set-stake      (owner only) Update the minimum stake required for new providers
 //	push-image     Load a local Docker image into the internal registry via the runner
 //	snapshot       Register a registry image as a named Daytona snapshot
@@ -21,6 +21,8 @@
 //
 //	PROVIDER_KEY=0x<hex> go run ./cmd/provider/ status   --contract 0x...
 //	PROVIDER_KEY=0x<hex> go run ./cmd/provider/ withdraw --contract 0x...
+//	PROVIDER_KEY=0x<hex> go run ./cmd/provider/ withdraw --contract 0x... \
+//	  --sweep-to 0x<cold-wallet> --sweep-gas-reserve "0.01 0G"
 //	OWNER_KEY=0x<hex>    go run ./cmd/provider/ set-stake --contract 0x... --stake 100000000000000000
 //
 //	go run ./cmd/provider/ push-image --image rust-sandbox:1.0.0
@@ -45,12 +47,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/units"
 )
 
 const (
@@ -240,17 +246,34 @@ func runStatus(args []string) {
 
 // ── withdraw ──────────────────────────────────────────────────────────────────
 
+// runWithdraw withdraws the provider's earnings to the provider address and,
+// with --sweep-to (or EARNINGS_SWEEP_ADDRESS), forwards the withdrawn amount
+// minus --sweep-gas-reserve to that address, e.g. a cold wallet.
 func runWithdraw(args []string) {
 	fs := flag.NewFlagSet("withdraw", flag.ExitOnError)
-	rpc         := fs.String("rpc",      defaultRPC,      "RPC endpoint")
-	chainID     := fs.Int64("chain-id",  defaultChainID,  "Chain ID")
-	contractHex := fs.String("contract", defaultContract, "Settlement contract address")
-	keyHex      := fs.String("key",      "",              "Provider private key; or set PROVIDER_KEY env")
+	rpc         := fs.String("rpc",               defaultRPC,      "RPC endpoint")
+	chainID     := fs.Int64("chain-id",           defaultChainID,  "Chain ID")
+	contractHex := fs.String("contract",          defaultContract, "Settlement contract address")
+	keyHex      := fs.String("key",               "",              "Provider private key; or set PROVIDER_KEY env")
+	sweepTo     := fs.String("sweep-to",          "",              "Forward the withdrawn earnings to this address; or set EARNINGS_SWEEP_ADDRESS env (default: no sweep)")
+	gasReserve  := fs.String("sweep-gas-reserve", "",              "Amount kept back from the sweep for gas, in neuron or \"<decimal> 0G\"; or set EARNINGS_SWEEP_GAS_RESERVE env (default 0)")
 	_ = fs.Parse(args)
 
 	privKey := resolveKey(*keyHex, "PROVIDER_KEY")
 	providerAddr := crypto.PubkeyToAddress(privKey.PublicKey)
 
+	sweepHex := optionalEnv(*sweepTo, "EARNINGS_SWEEP_ADDRESS")
+	if sweepHex != "" && !common.IsHexAddress(sweepHex) {
+		fatalf("invalid sweep address: %s", sweepHex)
+	}
+	reserve := new(big.Int)
+	if v := optionalEnv(*gasReserve, "EARNINGS_SWEEP_GAS_RESERVE"); v != "" {
+		var err error
+		if reserve, err = units.ParseAmount(v); err != nil {
+			fatalf("sweep gas reserve: %v", err)
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
 	defer cancel()
 	eth, contract := dialContract(ctx, *rpc, *contractHex)
@@ -274,10 +297,80 @@ func runWithdraw(args []string) {
 		fatalf("WithdrawEarnings: %v", err)
 	}
 	fmt.Printf("  tx: %s\n", tx.Hash().Hex())
-	if _, err := bind.WaitMined(ctx, eth, tx); err != nil {
+	receipt, err := bind.WaitMined(ctx, eth, tx)
+	if err != nil {
 		fatalf("wait mined: %v", err)
 	}
-	fmt.Printf("  confirmed ✓  (%s neuron withdrawn)\n", earnings.String())
+	if receipt.Status == types.ReceiptStatusFailed {
+		fatalf("withdraw tx reverted: %s", tx.Hash().Hex())
+	}
+	// Earnings may have grown between the read and the withdrawal; the
+	// EarningsWithdrawn event carries the amount actually paid out.
+	withdrawn := earnings
+	for _, l := range receipt.Logs {
+		if ev, err := contract.ParseEarningsWithdrawn(*l); err == nil {
+			withdrawn = ev.Amount
+			break
+		}
+	}
+	fmt.Printf("  confirmed ✓  (%s neuron withdrawn)\n", withdrawn.String())
+
+	if sweepHex != "" {
+		sweepEarnings(ctx, eth, privKey, *chainID, common.HexToAddress(sweepHex), withdrawn, reserve)
+	}
+}
+
+// sweepEarnings sends withdrawn minus reserve from the provider account to
+// `to` in a plain value transfer, paying its gas from the provider account.
+// The sweep is skipped when nothing is left after the reserve, or what is left
+// does not cover the transfer's own gas cost.
+func sweepEarnings(ctx context.Context, eth *ethclient.Client, privKey *ecdsa.PrivateKey, chainID int64, to common.Address, withdrawn, reserve *big.Int) {
+	from := crypto.PubkeyToAddress(privKey.PublicKey)
+	fmt.Printf("\nSweeping earnings to %s...\n", to.Hex())
+
+	amount := new(big.Int).Sub(withdrawn, reserve)
+	if amount.Sign() <= 0 {
+		fmt.Printf("  skipped: %s neuron withdrawn does not exceed the gas reserve of %s neuron\n", withdrawn, reserve)
+		return
+	}
+	gasPrice, err := eth.SuggestGasPrice(ctx)
+	if err != nil {
+		fatalf("suggest gas price: %v", err)
+	}
+	// A contract wallet (e.g. a multisig) may need more than 21000 gas to
+	// receive value, so the limit is estimated rather than assumed.
+	gas, err := eth.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Value: amount})
+	if err != nil {
+		fatalf("estimate sweep gas: %v", err)
+	}
+	gasCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	if amount.Cmp(gasCost) <= 0 {
+		fmt.Printf("  skipped: %s neuron to sweep does not cover the sweep's gas cost of %s neuron\n", amount, gasCost)
+		return
+	}
+
+	nonce, err := eth.PendingNonceAt(ctx, from)
+	if err != nil {
+		fatalf("fetch account nonce: %v", err)
+	}
+	tx, err := types.SignTx(
+		types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Value: amount, Gas: gas, GasPrice: gasPrice}),
+		types.NewEIP155Signer(big.NewInt(chainID)), privKey)
+	if err != nil {
+		fatalf("sign sweep tx: %v", err)
+	}
+	if err := eth.SendTransaction(ctx, tx); err != nil {
+		fatalf("send sweep tx: %v", err)
+	}
+	fmt.Printf("  tx: %s\n", tx.Hash().Hex())
+	receipt, err := bind.WaitMined(ctx, eth, tx)
+	if err != nil {
+		fatalf("wait mined: %v", err)
+	}
+	if receipt.Status == types.ReceiptStatusFailed {
+		fatalf("sweep tx reverted: %s", tx.Hash().Hex())
+	}
+	fmt.Printf("  confirmed ✓  (%s neuron swept, %s neuron kept as gas reserve)\n", amount, reserve)
 }
 
 // ── set-stake ─────────────────────────────────────────────────────────────────
@@ -480,7 +573,7 @@ func createSnapshot(privKey *ecdsa.PrivateKey, apiURL, imageName, name string, c
 	payloadBytes, _ := json.Marshal(body)
 	msg, sig, walletAddr := signRequest(privKey, "snapshot", "", json.RawMessage(payloadBytes))
 
-	req, err := http.NewRequest(http.MethodPost, apiURL+"/api/snapshots", bytes.NewReader(payloadBytes))
+	req, err := http.NewRequest(http.MethodPost, apiURL+apiPath("/snapshots"), bytes.NewReader(payloadBytes))
 	if err != nil {
 		return fmt.Errorf("build request: %w", err)
 	}
@@ -522,7 +615,7 @@ func runListSnapshots(args []string) {
 	privKey := resolveKey(*keyHex, "PROVIDER_KEY")
 	msg, sig, walletAddr := signRequest(privKey, "list", "", json.RawMessage(`{}`))
 
-	req, err := http.NewRequest(http.MethodGet, *apiURL+"/api/snapshots", nil)
+	req, err := http.NewRequest(http.MethodGet, *apiURL+apiPath("/snapshots"), nil)
 	if err != nil {
 		fatalf("build request: %v", err)
 	}
@@ -572,7 +665,7 @@ func runDeleteSnapshot(args []string) {
 	privKey := resolveKey(*keyHex, "PROVIDER_KEY")
 	msg, sig, walletAddr := signRequest(privKey, "delete-snapshot", *id, json.RawMessage(`{}`))
 
-	req, err := http.NewRequest(http.MethodDelete, *apiURL+"/api/snapshots/"+*id, nil)
+	req, err := http.NewRequest(http.MethodDelete, *apiURL+apiPath("/snapshots/")+*id, nil)
 	if err != nil {
 		fatalf("build request: %v", err)
 	}
@@ -604,7 +697,7 @@ func runGCImages(args []string) {
 	privKey := resolveKey(*keyHex, "PROVIDER_KEY")
 	msg, sig, walletAddr := signRequest(privKey, "gc-images", "", json.RawMessage(`{}`))
 
-	url := *apiURL + "/api/registry/gc"
+	url := *apiURL + apiPath("/registry/gc")
 	if *dryRun {
 		url += "?dry_run=true"
 	}
@@ -700,6 +793,14 @@ func resolveEnv(flagVal, envVar, label string) string {
 	return ""
 }
 
+// optionalEnv returns flagVal, or the envVar value when the flag is unset.
+func optionalEnv(flagVal, envVar string) string {
+	if flagVal != "" {
+		return flagVal
+	}
+	return os.Getenv(envVar)
+}
+
 func resolveKey(flagVal, envVar string) *ecdsa.PrivateKey {
 	hex := flagVal
 	if hex == "" {
@@ -748,3 +849,9 @@ func fatalf(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
 	os.Exit(1)
 }
+
+// apiPath returns the proxy route path p (e.g. "/snapshots") under the proxy's
+// API prefix: DAYTONA_API_PREFIX, or "/api" when unset.
+func apiPath(p string) string {
+	return daytona.NormalizePrefix(os.Getenv("DAYTONA_API_PREFIX")) + p
+}
@@ -0,0 +1,116 @@
+// cmd/reconcile/main.go — compares the billing Redis nonce counters
+// (billing:nonce:<user>:<provider>) with the contract's getLastNonce, e.g.
+// after a Redis restore or a settlement incident.
+//
+// A counter behind the chain makes the next voucher reuse a settled nonce and
+// be rejected; --fix raises it to the chain's value. A counter ahead of the
+// chain is reported but expected: its vouchers are signed and queued, or were
+// discarded. Counters are never lowered.
+//
+// Exits 1 if any counter is still behind, or could not be compared, once the
+// run is done (so a dry run fails while discrepancies exist).
+//
+// Usage:
+//
+//	go run ./cmd/reconcile/ --redis redis:6379 --rpc https://evmrpc-testnet.0g.ai \
+//	  --contract 0x... [--provider 0x...] [--fix] [--all]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+func main() {
+	addr := flag.String("redis", envOr("REDIS_ADDR", "redis:6379"), "Redis address (default $REDIS_ADDR)")
+	rpcURL := flag.String("rpc", envOr("RPC_URL", "https://evmrpc-testnet.0g.ai"), "chain RPC URL (default $RPC_URL)")
+	contract := flag.String("contract", os.Getenv("SETTLEMENT_CONTRACT"), "settlement contract address (default $SETTLEMENT_CONTRACT)")
+	provider := flag.String("provider", "", "only reconcile this provider's counters (default: all)")
+	fix := flag.Bool("fix", false, "raise counters that are behind the chain to the chain's lastNonce")
+	all := flag.Bool("all", false, "list every counter, not only discrepancies")
+	flag.Parse()
+
+	if !common.IsHexAddress(*contract) || (*provider != "" && !common.IsHexAddress(*provider)) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	eth, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		fatalf("dial rpc: %v", err)
+	}
+	defer eth.Close()
+	binding, err := chain.NewSandboxServing(common.HexToAddress(*contract), eth)
+	if err != nil {
+		fatalf("bind contract: %v", err)
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: *addr, Password: os.Getenv("REDIS_PASSWORD")})
+	defer rdb.Close()
+
+	var only common.Address
+	if *provider != "" {
+		only = common.HexToAddress(*provider)
+	}
+	rows, err := reconcile(context.Background(), rdb, contractReader{binding}, only, *fix)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tPROVIDER\tREDIS\tCHAIN\tSTATE\t")
+	for _, r := range rows {
+		counts[r.State]++
+		if r.State == stateOK && !*all {
+			continue
+		}
+		chainNonce, state := "-", r.State
+		if r.Chain != nil {
+			chainNonce = r.Chain.String()
+		}
+		if r.Err != nil {
+			state += ": " + r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", r.User.Hex(), r.Provider.Hex(), r.Redis, chainNonce, state)
+	}
+	w.Flush() //nolint:errcheck
+	fmt.Printf("\n%d counter(s): %d ok, %d ahead, %d behind, %d fixed, %d error\n",
+		len(rows), counts[stateOK], counts[stateAhead], counts[stateBehind], counts[stateFixed], counts[stateError])
+
+	if n := unresolved(rows); n > 0 {
+		if !*fix && counts[stateBehind] > 0 {
+			fmt.Println("re-run with --fix to raise the counters that are behind")
+		}
+		os.Exit(1)
+	}
+}
+
+// contractReader reads getLastNonce from the contract binding, so the tool
+// needs no TEE key (chain.NewClient does).
+type contractReader struct{ c *chain.SandboxServing }
+
+func (r contractReader) GetLastNonce(ctx context.Context, user, provider common.Address) (*big.Int, error) {
+	return r.c.GetLastNonce(&bind.CallOpts{Context: ctx}, user, provider)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "reconcile: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// NonceReader reads the contract's last settled nonce of a (user, provider)
+// pair. Satisfied by *chain.Client and by contractReader.
+type NonceReader interface {
+	GetLastNonce(ctx context.Context, user, provider common.Address) (*big.Int, error)
+}
+
+// Row states.
+const (
+	stateOK     = "ok"
+	stateBehind = "behind" // Redis would re-issue a nonce the contract has already accepted
+	stateAhead  = "ahead"  // nonces signed but not (yet) settled; expected while vouchers are in flight
+	stateError  = "error"
+	stateFixed  = "fixed"
+)
+
+// row is the reconciliation result of one billing:nonce:<user>:<provider> key.
+type row struct {
+	User, Provider common.Address
+	Redis, Chain   *big.Int // Chain is nil when the read failed
+	State          string
+	Err            error
+}
+
+// reconcile compares every nonce counter in Redis — only provider's when it
+// is non-zero — with the contract's getLastNonce. With fix, a counter behind
+// the chain is raised to it (max(redis, chain)); counters are never lowered.
+func reconcile(ctx context.Context, rdb *redis.Client, chain NonceReader, provider common.Address, fix bool) ([]row, error) {
+	var rows []row
+	pattern := strings.Replace(voucher.NonceKeyFmt, "%s:%s", "*", 1)
+	iter := rdb.Scan(ctx, 0, pattern, 500).Iterator()
+	for iter.Next(ctx) {
+		user, prov, ok := parseNonceKey(iter.Val())
+		if !ok || (provider != (common.Address{}) && prov != provider) {
+			continue
+		}
+		r := row{User: user, Provider: prov}
+		raw, err := rdb.Get(ctx, iter.Val()).Result()
+		if err == redis.Nil {
+			continue // deleted since the scan
+		}
+		if err != nil {
+			return rows, fmt.Errorf("read %s: %w", iter.Val(), err)
+		}
+		var okNum bool
+		if r.Redis, okNum = new(big.Int).SetString(raw, 10); !okNum {
+			r.State, r.Err = stateError, fmt.Errorf("redis value %q is not a number", raw)
+			rows = append(rows, r)
+			continue
+		}
+		if r.Chain, err = chain.GetLastNonce(ctx, user, prov); err != nil {
+			r.State, r.Err = stateError, err
+			rows = append(rows, r)
+			continue
+		}
+		switch r.Redis.Cmp(r.Chain) {
+		case 0:
+			r.State = stateOK
+		case 1:
+			r.State = stateAhead
+		default:
+			r.State = stateBehind
+			if fix {
+				if _, err := billing.RaiseNonce(ctx, rdb, user, prov, r.Chain); err != nil {
+					r.Err = err
+				} else {
+					r.State = stateFixed
+				}
+			}
+		}
+		rows = append(rows, r)
+	}
+	return rows, iter.Err()
+}
+
+// parseNonceKey splits billing:nonce:<user>:<provider> into its addresses.
+func parseNonceKey(key string) (user, provider common.Address, ok bool) {
+	prefix := strings.SplitN(voucher.NonceKeyFmt, "%s", 2)[0]
+	parts := strings.Split(strings.TrimPrefix(key, prefix), ":")
+	if !strings.HasPrefix(key, prefix) || len(parts) != 2 ||
+		!common.IsHexAddress(parts[0]) || !common.IsHexAddress(parts[1]) {
+		return common.Address{}, common.Address{}, false
+	}
+	return common.HexToAddress(parts[0]), common.HexToAddress(parts[1]), true
+}
+
+// unresolved counts the rows that still need an operator: counters behind
+// the chain that were not fixed, and pairs that could not be compared.
+func unresolved(rows []row) int {
+	n := 0
+	for _, r := range rows {
+		if r.State == stateBehind || r.State == stateError {
+			n++
+		}
+	}
+	return n
+}
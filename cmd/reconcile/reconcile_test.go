@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// fakeChain serves lastNonce per user; a user without an entry fails.
+type fakeChain map[common.Address]int64
+
+func (f fakeChain) GetLastNonce(_ context.Context, user, _ common.Address) (*big.Int, error) {
+	n, ok := f[user]
+	if !ok {
+		return nil, errors.New("rpc down")
+	}
+	return big.NewInt(n), nil
+}
+
+func TestReconcile(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	provider := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	user := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(0xa0 + i))) }
+	key := func(u, p common.Address) string {
+		return fmt.Sprintf(voucher.NonceKeyFmt, strings.ToLower(u.Hex()), strings.ToLower(p.Hex()))
+	}
+	rdb.Set(ctx, key(user(1), provider), "5", 0) // ok
+	rdb.Set(ctx, key(user(2), provider), "9", 0) // ahead
+	rdb.Set(ctx, key(user(3), provider), "2", 0) // behind
+	rdb.Set(ctx, key(user(4), provider), "1", 0) // chain read fails
+	rdb.Set(ctx, key(user(5), other), "0", 0)    // another provider
+	rdb.Set(ctx, "billing:nonce:garbage", "1", 0)
+	chain := fakeChain{user(1): 5, user(2): 4, user(3): 7, user(5): 3}
+
+	states := func(rows []row) map[common.Address]string {
+		m := map[common.Address]string{}
+		for _, r := range rows {
+			m[r.User] = r.State
+		}
+		return m
+	}
+
+	// Dry run: reports, changes nothing, and leaves discrepancies unresolved.
+	rows, err := reconcile(ctx, rdb, chain, provider, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := states(rows)
+	want := map[common.Address]string{user(1): stateOK, user(2): stateAhead, user(3): stateBehind, user(4): stateError}
+	if len(got) != len(want) {
+		t.Fatalf("rows: got %v", got)
+	}
+	for u, s := range want {
+		if got[u] != s {
+			t.Errorf("%s: got %q want %q", u.Hex(), got[u], s)
+		}
+	}
+	if n := unresolved(rows); n != 2 {
+		t.Errorf("unresolved after dry run: got %d want 2", n)
+	}
+	if v, _ := rdb.Get(ctx, key(user(3), provider)).Result(); v != "2" {
+		t.Errorf("dry run changed a counter: %s", v)
+	}
+
+	// --fix raises the counter behind the chain and never lowers one ahead.
+	chain[user(4)] = 1
+	rows, err = reconcile(ctx, rdb, chain, provider, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := states(rows); got[user(3)] != stateFixed || got[user(2)] != stateAhead || got[user(4)] != stateOK {
+		t.Errorf("fix: got %v", got)
+	}
+	if n := unresolved(rows); n != 0 {
+		t.Errorf("unresolved after fix: got %d", n)
+	}
+	if v, _ := rdb.Get(ctx, key(user(3), provider)).Result(); v != "7" {
+		t.Errorf("fixed counter: got %s want 7", v)
+	}
+	if v, _ := rdb.Get(ctx, key(user(2), provider)).Result(); v != "9" {
+		t.Errorf("counter ahead must not be lowered: got %s", v)
+	}
+
+	// No provider filter: the other provider's counter is checked too.
+	rows, _ = reconcile(ctx, rdb, chain, common.Address{}, false)
+	if got := states(rows); got[user(5)] != stateBehind || len(rows) != 5 {
+		t.Errorf("all providers: got %v", got)
+	}
+}
@@ -0,0 +1,139 @@
+// cmd/reindex/main.go — rebuilds billing state in Redis from the settlement
+// contract's VoucherSettled events, for disaster recovery (e.g. a lost or
+// stale Redis).
+//
+// Each event raises its billing:nonce:<user>:<provider> counter to the
+// settled nonce, so no voucher reuses one the contract has accepted. With
+// --revenue, successful settlements are also added to the revenue and spend
+// totals (revenue:total, spend:total, spend:rank); use it only when those
+// were lost, since a voucher is deduplicated for 30 days only. Per-sandbox
+// receipts, audit timelines and lifetime costs cannot be rebuilt: the events
+// carry no sandbox ID.
+//
+// Blocks are queried --range at a time (halved, after a backoff, while the
+// RPC rejects a range, and widened again once queries succeed) from
+// --since-block, normally the contract's deployment block. The
+// last replayed block is checkpointed in reindex:cursor:<provider|all> after
+// every range, so a re-run resumes there; --restart ignores it.
+//
+// Usage:
+//
+//	go run ./cmd/reindex/ --redis redis:6379 --rpc https://evmrpc-testnet.0g.ai \
+//	  --contract 0x... --since-block N [--provider 0x...] [--to-block M] \
+//	  [--range 5000] [--revenue] [--restart]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+func main() {
+	addr := flag.String("redis", envOr("REDIS_ADDR", "redis:6379"), "Redis address (default $REDIS_ADDR)")
+	rpcURL := flag.String("rpc", envOr("RPC_URL", "https://evmrpc-testnet.0g.ai"), "chain RPC URL (default $RPC_URL)")
+	contract := flag.String("contract", os.Getenv("SETTLEMENT_CONTRACT"), "settlement contract address (default $SETTLEMENT_CONTRACT)")
+	provider := flag.String("provider", "", "only replay this provider's events (default: all)")
+	since := flag.Uint64("since-block", envUint("CHAIN_START_BLOCK"), "first block to replay (default $CHAIN_START_BLOCK)")
+	to := flag.Uint64("to-block", 0, "last block to replay (default: the latest block)")
+	rangeSize := flag.Uint64("range", 5000, "blocks per log query")
+	revenue := flag.Bool("revenue", false, "also rebuild the revenue and spend totals")
+	restart := flag.Bool("restart", false, "ignore the saved cursor and start at --since-block")
+	flag.Parse()
+
+	if !common.IsHexAddress(*contract) || (*provider != "" && !common.IsHexAddress(*provider)) || *since == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	eth, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		fatalf("dial rpc: %v", err)
+	}
+	defer eth.Close()
+	binding, err := chain.NewSandboxServing(common.HexToAddress(*contract), eth)
+	if err != nil {
+		fatalf("bind contract: %v", err)
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: *addr, Password: os.Getenv("REDIS_PASSWORD")})
+	defer rdb.Close()
+
+	opts := options{Since: *since, To: *to, Range: *rangeSize, Revenue: *revenue, Restart: *restart}
+	if *provider != "" {
+		opts.Provider = common.HexToAddress(*provider)
+	}
+	res, err := reindex(context.Background(), rdb, contractSource{eth, binding}, opts, func(from, to uint64, events int) {
+		fmt.Printf("blocks %d-%d: %d event(s)\n", from, to, events)
+	})
+	if res.From > res.To && err == nil {
+		fmt.Printf("nothing to replay: the cursor is at block %d\n", res.From-1)
+		return
+	}
+	fmt.Printf("\nreplayed blocks %d-%d: %d event(s), %d nonce counter(s) raised, %d settlement(s) counted toward revenue\n",
+		res.From, res.To, res.Events, res.NoncesRaised, res.Revenue)
+	if err != nil {
+		fatalf("%v (re-run to resume from the cursor)", err)
+	}
+}
+
+// contractSource reads events through the contract binding, so the tool
+// needs no TEE key (chain.NewClient does).
+type contractSource struct {
+	eth *ethclient.Client
+	c   *chain.SandboxServing
+}
+
+func (s contractSource) BlockNumber(ctx context.Context) (uint64, error) {
+	return s.eth.BlockNumber(ctx)
+}
+
+func (s contractSource) VoucherSettled(ctx context.Context, from, to uint64, provider common.Address) ([]chain.VoucherEvent, error) {
+	var providers []common.Address
+	if provider != (common.Address{}) {
+		providers = []common.Address{provider}
+	}
+	iter, err := s.c.FilterVoucherSettled(&bind.FilterOpts{Start: from, End: &to, Context: ctx}, nil, providers)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	var events []chain.VoucherEvent
+	for iter.Next() {
+		e := iter.Event
+		events = append(events, chain.VoucherEvent{
+			User:     e.User,
+			Provider: e.Provider,
+			TotalFee: e.TotalFee,
+			Nonce:    e.Nonce,
+			Status:   chain.SettlementStatus(e.Status),
+			TxHash:   e.Raw.TxHash.Hex(),
+			Block:    e.Raw.BlockNumber,
+		})
+	}
+	return events, iter.Error()
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envUint(key string) uint64 {
+	n, _ := strconv.ParseUint(os.Getenv(key), 10, 64)
+	return n
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "reindex: "+format+"\n", args...)
+	os.Exit(1)
+}
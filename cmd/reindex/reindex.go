@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// cursorKeyPrefix is suffixed with the lowercase provider address, or "all".
+// It holds the last block whose events were fully replayed.
+const cursorKeyPrefix = "reindex:cursor:"
+
+// retryDelay is the pause before retrying a failed query with a narrower
+// range; it doubles with each consecutive failure, up to maxRetryDelay. A var
+// for tests.
+var retryDelay = time.Second
+
+const maxRetryDelay = 30 * time.Second
+
+// growAfter is how many queries in a row must succeed before a narrowed
+// range is doubled again, back toward opts.Range.
+const growAfter = 10
+
+// EventSource reads VoucherSettled events from the settlement contract.
+type EventSource interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	// VoucherSettled returns the events of blocks from..to (inclusive), in
+	// chain order; provider filters them when non-zero.
+	VoucherSettled(ctx context.Context, from, to uint64, provider common.Address) ([]chain.VoucherEvent, error)
+}
+
+type options struct {
+	Provider common.Address // zero = every provider
+	Since    uint64         // first block, unless the cursor is past it
+	To       uint64         // last block; 0 = the latest block at start
+	Range    uint64         // blocks per query at most; halved while the RPC rejects it
+	Revenue  bool           // also rebuild the revenue and spend totals
+	Restart  bool           // ignore the cursor and start at Since
+}
+
+type result struct {
+	From, To     uint64 // blocks replayed
+	Events       int
+	NoncesRaised int
+	Revenue      int // successful settlements counted toward revenue
+}
+
+func cursorKey(provider common.Address) string {
+	if provider == (common.Address{}) {
+		return cursorKeyPrefix + "all"
+	}
+	return cursorKeyPrefix + strings.ToLower(provider.Hex())
+}
+
+// reindex replays VoucherSettled events into Redis in ranges of at most
+// opts.Range blocks, saving the cursor after each range so an interrupted
+// run resumes where it stopped. A failed query is retried after a backoff
+// with half the range; the range grows back after growAfter successes. Every event raises its (user, provider)
+// nonce counter to the event's nonce (settled or not, the contract committed
+// it); with opts.Revenue a successful one also counts toward the revenue and
+// spend totals, once per voucher. Both are idempotent, so replaying a range
+// twice is harmless. progress, if set, is called after each range.
+func reindex(ctx context.Context, rdb *redis.Client, src EventSource, opts options, progress func(from, to uint64, events int)) (result, error) {
+	res := result{From: max(opts.Since, 1)}
+	if !opts.Restart {
+		raw, err := rdb.Get(ctx, cursorKey(opts.Provider)).Result()
+		if err != nil && err != redis.Nil {
+			return res, fmt.Errorf("read cursor: %w", err)
+		}
+		if cursor, err := strconv.ParseUint(raw, 10, 64); err == nil && cursor >= res.From {
+			res.From = cursor + 1
+		}
+	}
+	res.To = opts.To
+	if res.To == 0 {
+		latest, err := src.BlockNumber(ctx)
+		if err != nil {
+			return res, fmt.Errorf("get block number: %w", err)
+		}
+		res.To = latest
+	}
+	maxStep := max(opts.Range, 1)
+	step, delay, streak := maxStep, retryDelay, 0
+
+	for from := res.From; from <= res.To; {
+		to := min(from+step-1, res.To)
+		events, err := src.VoucherSettled(ctx, from, to, opts.Provider)
+		if err != nil {
+			if step > 1 && ctx.Err() == nil {
+				step /= 2 // e.g. too many results or too wide a range for the node
+				streak = 0
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+				}
+				delay = min(2*delay, maxRetryDelay)
+				continue
+			}
+			return res, fmt.Errorf("blocks %d-%d: %w", from, to, err)
+		}
+		// A transient failure must not slow the rest of the run: once
+		// queries succeed again, widen the range back toward opts.Range.
+		delay = retryDelay
+		if streak++; streak >= growAfter && step < maxStep {
+			step, streak = min(2*step, maxStep), 0
+		}
+		for _, ev := range events {
+			raised, err := billing.RaiseNonce(ctx, rdb, ev.User, ev.Provider, ev.Nonce)
+			if err != nil {
+				return res, fmt.Errorf("block %d: raise nonce: %w", ev.Block, err)
+			}
+			if raised {
+				res.NoncesRaised++
+			}
+			if opts.Revenue && ev.Status == chain.StatusSuccess {
+				settler.RecordRevenue(ctx, rdb, voucher.SandboxVoucher{
+					User: ev.User, Provider: ev.Provider, TotalFee: ev.TotalFee, Nonce: ev.Nonce,
+				})
+				res.Revenue++
+			}
+		}
+		res.Events += len(events)
+		if err := rdb.Set(ctx, cursorKey(opts.Provider), to, 0).Err(); err != nil {
+			return res, fmt.Errorf("save cursor: %w", err)
+		}
+		if progress != nil {
+			progress(from, to, len(events))
+		}
+		from = to + 1
+	}
+	return res, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// fakeSource serves events from memory. Queries wider than maxRange fail,
+// like a node limiting eth_getLogs; so does any query covering block failAt.
+type fakeSource struct {
+	latest   uint64
+	events   []chain.VoucherEvent
+	maxRange uint64
+	failAt   uint64
+	failures int // the next queries to fail, whatever their range
+	queries  [][2]uint64
+}
+
+func (f *fakeSource) BlockNumber(context.Context) (uint64, error) { return f.latest, nil }
+
+func (f *fakeSource) VoucherSettled(_ context.Context, from, to uint64, provider common.Address) ([]chain.VoucherEvent, error) {
+	if f.maxRange > 0 && to-from+1 > f.maxRange {
+		return nil, errors.New("query exceeds max block range")
+	}
+	if f.failAt >= from && f.failAt <= to {
+		return nil, errors.New("rpc down")
+	}
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("timeout")
+	}
+	f.queries = append(f.queries, [2]uint64{from, to})
+	var out []chain.VoucherEvent
+	for _, ev := range f.events {
+		if ev.Block >= from && ev.Block <= to && (provider == (common.Address{}) || ev.Provider == provider) {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func TestReindex(t *testing.T) {
+	old := retryDelay
+	retryDelay = 0
+	t.Cleanup(func() { retryDelay = old })
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	provider := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	alice := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	bob := common.HexToAddress("0x00000000000000000000000000000000000000a2")
+	ev := func(block uint64, user, prov common.Address, nonce, fee int64, st chain.SettlementStatus) chain.VoucherEvent {
+		return chain.VoucherEvent{User: user, Provider: prov, Nonce: big.NewInt(nonce), TotalFee: big.NewInt(fee), Status: st, Block: block}
+	}
+	nonce := func(user, prov common.Address) string {
+		v, _ := rdb.Get(ctx, fmt.Sprintf(voucher.NonceKeyFmt, strings.ToLower(user.Hex()), strings.ToLower(prov.Hex()))).Result()
+		return v
+	}
+
+	src := &fakeSource{
+		latest:   1_250,
+		maxRange: 100,
+		failAt:   1_180,
+		events: []chain.VoucherEvent{
+			ev(1_010, alice, provider, 1, 500, chain.StatusSuccess),
+			ev(1_020, alice, provider, 2, 300, chain.StatusSuccess),
+			ev(1_150, bob, provider, 1, 200, chain.StatusSuccess),
+			ev(1_190, alice, provider, 3, 300, chain.StatusInsufficientBalance),
+			ev(1_200, bob, other, 4, 700, chain.StatusSuccess),
+		},
+	}
+	opts := options{Provider: provider, Since: 1_000, Range: 400, Revenue: true}
+
+	// The RPC rejects wide ranges and cannot serve block 1180: the range is
+	// narrowed down to that block, then the run stops with the cursor at the
+	// last fully replayed block.
+	res, err := reindex(ctx, rdb, src, opts, nil)
+	if err == nil {
+		t.Fatal("expected the injected RPC failure")
+	}
+	if res.Events != 3 || nonce(alice, provider) != "2" || nonce(bob, provider) != "1" {
+		t.Errorf("partial run: %+v, alice %s, bob %s", res, nonce(alice, provider), nonce(bob, provider))
+	}
+	cursor, _ := rdb.Get(ctx, cursorKey(provider)).Uint64()
+	if cursor != 1_179 {
+		t.Errorf("cursor after failure: got %d", cursor)
+	}
+	for _, q := range src.queries {
+		if q[1]-q[0]+1 > src.maxRange {
+			t.Errorf("query %v wider than the node allows", q)
+		}
+	}
+
+	// Re-run once the node recovers: resumes after the cursor and finishes.
+	src.failAt = 0
+	res, err = reindex(ctx, rdb, src, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.From != cursor+1 || res.To != 1_250 {
+		t.Errorf("resumed range: %d-%d", res.From, res.To)
+	}
+	if nonce(alice, provider) != "3" || nonce(bob, other) != "" {
+		t.Errorf("nonces: alice %s, bob with the other provider %q", nonce(alice, provider), nonce(bob, other))
+	}
+	if c, _ := rdb.Get(ctx, cursorKey(provider)).Uint64(); c != 1_250 {
+		t.Errorf("final cursor: got %d", c)
+	}
+	if total, _ := settler.ProviderRevenue(ctx, rdb, provider); total != "1000" {
+		t.Errorf("revenue: got %s want 1000 (insufficient balance not counted)", total)
+	}
+
+	// Replaying from scratch changes nothing: counters only rise and each
+	// voucher counts toward revenue once.
+	opts.Restart = true
+	if _, err := reindex(ctx, rdb, src, opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := settler.ProviderRevenue(ctx, rdb, provider); total != "1000" || nonce(alice, provider) != "3" {
+		t.Errorf("after replay: revenue %s, alice %s", total, nonce(alice, provider))
+	}
+
+	// A counter already ahead of the chain is left alone.
+	rdb.Set(ctx, fmt.Sprintf(voucher.NonceKeyFmt, strings.ToLower(bob.Hex()), strings.ToLower(provider.Hex())), "9", 0)
+	res, _ = reindex(ctx, rdb, src, opts, nil)
+	if res.NoncesRaised != 0 || nonce(bob, provider) != "9" {
+		t.Errorf("counter ahead: raised %d, bob %s", res.NoncesRaised, nonce(bob, provider))
+	}
+}
+
+// One transient failure narrows the range only until queries succeed again.
+func TestReindex_RangeGrowsBack(t *testing.T) {
+	old := retryDelay
+	retryDelay = 0
+	t.Cleanup(func() { retryDelay = old })
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	src := &fakeSource{latest: 10_000, failures: 1}
+
+	if _, err := reindex(context.Background(), rdb, src, options{Since: 1, Range: 100}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if first := src.queries[0]; first[1]-first[0]+1 != 50 {
+		t.Errorf("first query after the failure: %v, want 50 blocks", first)
+	}
+	if last := src.queries[len(src.queries)-2]; last[1]-last[0]+1 != 100 {
+		t.Errorf("query %v: range did not grow back to 100 blocks", last)
+	}
+}
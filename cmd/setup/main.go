@@ -41,6 +41,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/units"
 )
 
 // defaultSnapshots are pre-provisioned when DAYTONA_API_URL is available.
@@ -52,7 +53,7 @@ func main() {
 	rpc := flag.String("rpc", "https://evmrpc-testnet.0g.ai", "RPC endpoint")
 	chainID := flag.Int64("chain-id", 16602, "Chain ID")
 	contractHex := flag.String("contract", "0x2024eB0Cc14316fF8Cc425bFB7CC37FD8713E9b3", "Contract address")
-	depositEth := flag.Float64("deposit", 0.01, "0G amount to deposit into the contract")
+	depositOG := flag.String("deposit", "0.01", "0G amount to deposit into the contract")
 	serviceURL        := flag.String("url",               "https://0g-sandbox.io", "Provider service URL")
 	pricePerCPUPerMin := flag.String("price-per-cpu-min", "0",                     "Price per CPU per minute in neuron")
 	pricePerMemPerMin := flag.String("price-per-mem-min", "0",                     "Price per GB memory per minute in neuron")
@@ -144,8 +145,11 @@ func main() {
 
 	// ── 2. Deposit ────────────────────────────────────────────────────────────
 	// Deposit for self as provider (setup uses a single key for provider/user).
-	fmt.Printf("\n[2/3] Deposit %.4f 0G (for provider %s)...\n", *depositEth, addr.Hex())
-	depositWei := ogToNeuron(*depositEth)
+	depositWei, err := units.ParseOG(*depositOG)
+	if err != nil {
+		fatalf("--deposit: %v", err)
+	}
+	fmt.Printf("\n[2/3] Deposit %s 0G (for provider %s)...\n", units.FormatOG(depositWei), addr.Hex())
 	auth.Value = depositWei
 	tx, err = contract.Deposit(auth, addr, addr)
 	if err != nil {
@@ -238,14 +242,6 @@ func ensureSnapshot(apiURL, adminKey, name, imageName string) error {
 	return nil
 }
 
-func ogToNeuron(og float64) *big.Int {
-	// 1 0G = 1e18 neuron; use integer arithmetic to avoid float precision issues.
-	ogBig := new(big.Float).SetFloat64(og)
-	neuronBig := new(big.Float).Mul(ogBig, new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)))
-	neuron, _ := neuronBig.Int(nil)
-	return neuron
-}
-
 func fatalf(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
 	os.Exit(1)
@@ -16,6 +16,9 @@
 //	  --key      0x<deployer-private-key>      \
 //	  --chain-id 16602                         \
 //	  --proxy    0x<proxy-address>
+//
+// With --output json, progress goes to stderr and stdout carries only
+// {"newImpl", "upgradeTx", "beacon"}.
 package main
 
 import (
@@ -24,6 +27,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"math/big"
 	"os"
 	"strings"
@@ -42,12 +46,20 @@ import (
 // = keccak256("eip1967.proxy.beacon") - 1
 var beaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
 
+// upgradeResult is what --output json prints to stdout.
+type upgradeResult struct {
+	NewImpl   string `json:"newImpl"`
+	UpgradeTx string `json:"upgradeTx"`
+	Beacon    string `json:"beacon"`
+}
+
 func main() {
 	rpcURL   := flag.String("rpc",      "https://evmrpc-testnet.0g.ai", "EVM RPC endpoint")
 	keyHex   := flag.String("key",      "", "deployer/owner private key (hex)")
 	chainID  := flag.Int64("chain-id",  16602, "chain ID")
 	proxyHex := flag.String("proxy",    "", "BeaconProxy address (beacon derived automatically)")
 	beaconHex := flag.String("beacon",  "", "UpgradeableBeacon address (alternative to --proxy)")
+	output   := flag.String("output",   "text", "output format: text or json (result on stdout, progress on stderr)")
 	flag.Parse()
 
 	if *keyHex == "" {
@@ -58,6 +70,15 @@ func main() {
 		fmt.Fprintln(os.Stderr, "error: --proxy or --beacon is required")
 		os.Exit(1)
 	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "error: --output must be text or json, got %q\n", *output)
+		os.Exit(1)
+	}
+	// Human-readable progress; kept off stdout when it carries JSON.
+	var out io.Writer = os.Stdout
+	if *output == "json" {
+		out = os.Stderr
+	}
 
 	// ── private key ───────────────────────────────────────────────────────────
 	privKey, err := crypto.HexToECDSA(strings.TrimPrefix(*keyHex, "0x"))
@@ -88,13 +109,13 @@ func main() {
 			os.Exit(1)
 		}
 		beaconAddr = common.BytesToAddress(raw)
-		fmt.Printf("Proxy    : %s\n", proxyAddr.Hex())
-		fmt.Printf("Beacon   : %s  (resolved from proxy)\n", beaconAddr.Hex())
+		fmt.Fprintf(out, "Proxy    : %s\n", proxyAddr.Hex())
+		fmt.Fprintf(out, "Beacon   : %s  (resolved from proxy)\n", beaconAddr.Hex())
 	} else {
 		beaconAddr = common.HexToAddress(*beaconHex)
-		fmt.Printf("Beacon   : %s\n", beaconAddr.Hex())
+		fmt.Fprintf(out, "Beacon   : %s\n", beaconAddr.Hex())
 	}
-	fmt.Printf("Deployer : %s\n", deployer.Hex())
+	fmt.Fprintf(out, "Deployer : %s\n", deployer.Hex())
 
 	auth, err := bind.NewKeyedTransactorWithChainID(privKey, big.NewInt(*chainID))
 	if err != nil {
@@ -104,7 +125,7 @@ func main() {
 	auth.Context = ctx
 
 	// ── Step 1: Deploy new SandboxServing implementation ──────────────────────
-	fmt.Printf("\n[1/2] Deploying new SandboxServing implementation...\n")
+	fmt.Fprintf(out, "\n[1/2] Deploying new SandboxServing implementation...\n")
 
 	raw, err := os.ReadFile("contracts/out/SandboxServing.sol/SandboxServing.json")
 	if err != nil {
@@ -135,7 +156,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "deploy new impl: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("  Tx hash  : %s\n", implTx.Hash().Hex())
+	fmt.Fprintf(out, "  Tx hash  : %s\n", implTx.Hash().Hex())
 
 	implReceipt, err := bind.WaitMined(ctx, client, implTx)
 	if err != nil {
@@ -146,10 +167,10 @@ func main() {
 		fmt.Fprintln(os.Stderr, "impl deploy tx reverted")
 		os.Exit(1)
 	}
-	fmt.Printf("  New impl : %s\n", newImplAddr.Hex())
+	fmt.Fprintf(out, "  New impl : %s\n", newImplAddr.Hex())
 
 	// ── Step 2: beacon.upgradeTo(newImpl) ─────────────────────────────────────
-	fmt.Printf("\n[2/2] Calling beacon.upgradeTo(%s)...\n", newImplAddr.Hex())
+	fmt.Fprintf(out, "\n[2/2] Calling beacon.upgradeTo(%s)...\n", newImplAddr.Hex())
 
 	beacon, err := chain.NewUpgradeableBeacon(beaconAddr, client)
 	if err != nil {
@@ -162,7 +183,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "upgradeTo: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("  Tx hash  : %s\n", upgradeTx.Hash().Hex())
+	fmt.Fprintf(out, "  Tx hash  : %s\n", upgradeTx.Hash().Hex())
 
 	upgradeReceipt, err := bind.WaitMined(ctx, client, upgradeTx)
 	if err != nil {
@@ -187,6 +208,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(upgradeResult{
+			NewImpl:   newImplAddr.Hex(),
+			UpgradeTx: upgradeTx.Hash().Hex(),
+			Beacon:    beaconAddr.Hex(),
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "encode result: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	fmt.Printf(`
 ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 UPGRADE COMPLETE
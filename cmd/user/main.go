@@ -13,7 +13,8 @@
 //	stop     Stop a running sandbox
 //	delete   Delete a sandbox
 //
-// Private key via --key flag or USER_KEY env var.
+// Private key via --key flag or USER_KEY env var. API subcommands use the
+// route prefix in API_PREFIX (the provider's DAYTONA_API_PREFIX), default /api.
 //
 // Examples:
 //
@@ -40,9 +41,6 @@ import (
 	"bytes"
 	"context"
 	"crypto/ecdsa"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -59,7 +57,10 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 
+	"github.com/0gfoundation/0g-sandbox/client"
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/units"
 )
 
 func main() {
@@ -196,7 +197,7 @@ func runDeposit(args []string) {
 	fs := flag.NewFlagSet("deposit", flag.ExitOnError)
 	cf := addChainFlags(fs)
 	keyHex      := fs.String("key",      "", "User private key (hex); or set USER_KEY env")
-	amount      := fs.Float64("amount",  0.01, "Amount to deposit in 0G (e.g. 0.01)")
+	amount      := fs.String("amount",   "0.01", "Amount to deposit in 0G (e.g. 0.01)")
 	providerHex := fs.String("provider", "", "Provider address to deposit for (required)")
 	_ = fs.Parse(args)
 
@@ -204,6 +205,11 @@ func runDeposit(args []string) {
 		fatalf("--provider is required")
 	}
 
+	depositWei, err := units.ParseOG(*amount)
+	if err != nil {
+		fatalf("--amount: %v", err)
+	}
+
 	privKey := mustLoadKey(*keyHex)
 	userAddr := crypto.PubkeyToAddress(privKey.PublicKey)
 	providerAddr := common.HexToAddress(*providerHex)
@@ -220,12 +226,11 @@ func runDeposit(args []string) {
 	}
 	auth.Context = ctx
 
-	depositWei := ogToNeuron(*amount)
 	auth.Value = depositWei
 
 	fmt.Printf("User:     %s\n", userAddr.Hex())
 	fmt.Printf("Provider: %s\n", providerAddr.Hex())
-	fmt.Printf("Amount:   %.6f 0G (%s neuron)\n", *amount, depositWei)
+	fmt.Printf("Amount:   %s 0G (%s neuron)\n", units.FormatOG(depositWei), depositWei)
 	fmt.Printf("Contract: %s\n", cf.contract)
 
 	fmt.Println("\n[1/1] Deposit...")
@@ -433,12 +438,9 @@ func runCreate(args []string) {
 	}
 	payloadBytes, _ := json.Marshal(body)
 
-	msg, sig, walletAddr := signRequest(privKey, "create", "", json.RawMessage(payloadBytes))
+	msg, sig, walletAddr := signRequest(privKey, "create", "", payloadBytes)
 
-	var bodyBuf bytes.Buffer
-	json.NewEncoder(&bodyBuf).Encode(body) //nolint:errcheck
-
-	req, err := http.NewRequest(http.MethodPost, *apiURL+"/api/sandbox", &bodyBuf)
+	req, err := http.NewRequest(http.MethodPost, *apiURL+apiPath("/sandbox"), bytes.NewReader(payloadBytes))
 	if err != nil {
 		fatalf("build request: %v", err)
 	}
@@ -472,9 +474,9 @@ func runList(args []string) {
 	_ = fs.Parse(args)
 
 	privKey := mustLoadKey(*keyHex)
-	msg, sig, walletAddr := signRequest(privKey, "list", "", json.RawMessage(`{}`))
+	msg, sig, walletAddr := signRequest(privKey, "list", "", nil)
 
-	req, err := http.NewRequest(http.MethodGet, *apiURL+"/api/sandbox", nil)
+	req, err := http.NewRequest(http.MethodGet, *apiURL+apiPath("/sandbox"), nil)
 	if err != nil {
 		fatalf("build request: %v", err)
 	}
@@ -520,9 +522,9 @@ func runStop(args []string) {
 		fatalf("--id is required")
 	}
 	privKey := mustLoadKey(*keyHex)
-	msg, sig, walletAddr := signRequest(privKey, "stop", *id, json.RawMessage(`{}`))
+	msg, sig, walletAddr := signRequest(privKey, "stop", *id, nil)
 
-	req, err := http.NewRequest(http.MethodPost, *apiURL+"/api/sandbox/"+*id+"/stop", nil)
+	req, err := http.NewRequest(http.MethodPost, *apiURL+apiPath("/sandbox/")+*id+"/stop", nil)
 	if err != nil {
 		fatalf("build request: %v", err)
 	}
@@ -556,9 +558,9 @@ func runDelete(args []string) {
 		fatalf("--id is required")
 	}
 	privKey := mustLoadKey(*keyHex)
-	msg, sig, walletAddr := signRequest(privKey, "delete", *id, json.RawMessage(`{}`))
+	msg, sig, walletAddr := signRequest(privKey, "delete", *id, nil)
 
-	req, err := http.NewRequest(http.MethodDelete, *apiURL+"/api/sandbox/"+*id, nil)
+	req, err := http.NewRequest(http.MethodDelete, *apiURL+apiPath("/sandbox/")+*id, nil)
 	if err != nil {
 		fatalf("build request: %v", err)
 	}
@@ -599,10 +601,10 @@ func runExec(args []string) {
 	}
 
 	privKey := mustLoadKey(*keyHex)
-	msg, sig, walletAddr := signRequest(privKey, "toolbox", *id, json.RawMessage(`{}`))
+	msg, sig, walletAddr := signRequest(privKey, "toolbox", *id, nil)
 
 	body, _ := json.Marshal(map[string]any{"command": *command, "timeout": *timeout})
-	url := *apiURL + "/api/toolbox/" + *id + "/toolbox/process/execute"
+	url := *apiURL + apiPath("/toolbox/") + *id + "/toolbox/process/execute"
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		fatalf("build request: %v", err)
@@ -709,9 +711,9 @@ func runToolbox(args []string) {
 	}
 
 	privKey := mustLoadKey(*keyHex)
-	msg, sig, walletAddr := signRequest(privKey, "toolbox", *id, json.RawMessage(`{}`))
+	msg, sig, walletAddr := signRequest(privKey, "toolbox", *id, nil)
 
-	url := *apiURL + "/api/toolbox/" + *id + "/toolbox/" + strings.TrimPrefix(*action, "/")
+	url := *apiURL + apiPath("/toolbox/") + *id + "/toolbox/" + strings.TrimPrefix(*action, "/")
 	req, err := http.NewRequest(strings.ToUpper(*method), url, strings.NewReader(*body))
 	if err != nil {
 		fatalf("build request: %v", err)
@@ -750,9 +752,9 @@ func runStart(args []string) {
 	}
 
 	privKey := mustLoadKey(*keyHex)
-	msg, sig, walletAddr := signRequest(privKey, "start", *id, json.RawMessage(`{}`))
+	msg, sig, walletAddr := signRequest(privKey, "start", *id, nil)
 
-	url := *apiURL + "/api/sandbox/" + *id + "/start"
+	url := *apiURL + apiPath("/sandbox/") + *id + "/start"
 	req, err := http.NewRequest(http.MethodPost, url, nil)
 	if err != nil {
 		fatalf("build request: %v", err)
@@ -788,9 +790,9 @@ func runSSHAccess(args []string) {
 	}
 
 	privKey := mustLoadKey(*keyHex)
-	msg, sig, walletAddr := signRequest(privKey, "ssh-access", *id, json.RawMessage(`{}`))
+	msg, sig, walletAddr := signRequest(privKey, "ssh-access", *id, nil)
 
-	url := *apiURL + "/api/sandbox/" + *id + "/ssh-access"
+	url := *apiURL + apiPath("/sandbox/") + *id + "/ssh-access"
 	req, err := http.NewRequest(http.MethodPost, url, nil)
 	if err != nil {
 		fatalf("build request: %v", err)
@@ -838,7 +840,7 @@ func runListSnapshots(args []string) {
 	apiURL := fs.String("api", "http://localhost:8080", "0G Sandbox service URL")
 	_ = fs.Parse(args)
 
-	req, err := http.NewRequest(http.MethodGet, *apiURL+"/api/snapshots", nil)
+	req, err := http.NewRequest(http.MethodGet, *apiURL+apiPath("/snapshots"), nil)
 	if err != nil {
 		fatalf("build request: %v", err)
 	}
@@ -874,47 +876,14 @@ func runListSnapshots(args []string) {
 // ── Helpers ──────────────────────────────────────────────────────────────────
 
 // signRequest builds the three auth headers required by the billing proxy.
+// body is the exact request body, bound to the signature when non-empty.
 // Returns (X-Signed-Message value, X-Wallet-Signature value, X-Wallet-Address value).
-func signRequest(privKey *ecdsa.PrivateKey, action, resourceID string, payload json.RawMessage) (signedMsg, sig, walletAddr string) {
-	addr := crypto.PubkeyToAddress(privKey.PublicKey)
-
-	nonceBuf := make([]byte, 16)
-	rand.Read(nonceBuf) //nolint:errcheck
-	nonce := hex.EncodeToString(nonceBuf)
-
-	type signedRequest struct {
-		Action     string          `json:"action"`
-		ExpiresAt  int64           `json:"expires_at"`
-		Nonce      string          `json:"nonce"`
-		Payload    json.RawMessage `json:"payload"`
-		ResourceID string          `json:"resource_id"`
-	}
-
-	reqObj := signedRequest{
-		Action:     action,
-		ExpiresAt:  time.Now().Add(3 * time.Minute).Unix(),
-		Nonce:      nonce,
-		Payload:    payload,
-		ResourceID: resourceID,
-	}
-	msgBytes, err := json.Marshal(reqObj)
+func signRequest(privKey *ecdsa.PrivateKey, action, resourceID string, body []byte) (signedMsg, sig, walletAddr string) {
+	h, err := client.Sign(privKey, action, resourceID, body, client.DefaultSignatureTTL)
 	if err != nil {
-		fatalf("marshal signed request: %v", err)
+		fatalf("sign request: %v", err)
 	}
-
-	// EIP-191: keccak256("\x19Ethereum Signed Message:\n<len><msg>")
-	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(msgBytes))
-	hash := crypto.Keccak256([]byte(prefix), msgBytes)
-
-	sigBytes, err := crypto.Sign(hash, privKey)
-	if err != nil {
-		fatalf("sign: %v", err)
-	}
-	sigBytes[64] += 27 // V: 0/1 → 27/28 (Ethereum convention)
-
-	return base64.StdEncoding.EncodeToString(msgBytes),
-		"0x" + hex.EncodeToString(sigBytes),
-		addr.Hex()
+	return h.SignedMessage, h.Signature, h.WalletAddress
 }
 
 // mustLoadKey loads a private key from the flag value or USER_KEY env var.
@@ -947,14 +916,6 @@ func mustDialContract(ctx context.Context, rpcURL, contractHex string) (*ethclie
 	return eth, contract
 }
 
-func ogToNeuron(og float64) *big.Int {
-	ogBig := new(big.Float).SetFloat64(og)
-	neuronBig := new(big.Float).Mul(ogBig,
-		new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)))
-	n, _ := neuronBig.Int(nil)
-	return n
-}
-
 func neuronTo0G(neuron *big.Int) float64 {
 	f, _ := new(big.Float).Quo(
 		new(big.Float).SetInt(neuron),
@@ -980,3 +941,9 @@ func fatalf(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
 	os.Exit(1)
 }
+
+// apiPath returns the proxy route path p (e.g. "/sandbox") under the proxy's
+// API prefix: the provider's DAYTONA_API_PREFIX, set as API_PREFIX, or "/api" when unset.
+func apiPath(p string) string {
+	return daytona.NormalizePrefix(os.Getenv("API_PREFIX")) + p
+}
@@ -12,9 +12,19 @@
 //     --source-key src/proxy/UpgradeableBeacon.sol \
 //     --contract-name src/proxy/UpgradeableBeacon.sol:UpgradeableBeacon \
 //     --constructor-args <abi-encoded-hex>
+//
+//   # From the proxy address alone: the implementation is read from the
+//   # beacon (ERC-1967 beacon slot → beacon.implementation()) and verified,
+//   # since that is where the source lives
+//   go run ./cmd/verify/ --proxy 0x...
+//
+//   # The beacon or the proxy itself, with constructor args derived on-chain
+//   go run ./cmd/verify/ --proxy 0x... --target beacon
+//   go run ./cmd/verify/ --proxy 0x... --target proxy
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -24,6 +34,8 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // standardJSONInput builds the solc standard-JSON input for a single source file.
@@ -66,13 +78,67 @@ func main() {
 	chainID      := flag.String("chain-id",      "16602", "chain ID")
 	apiKey       := flag.String("apikey",        "00", "API key (dummy value)")
 	constructorArgs := flag.String("constructor-args", "", "ABI-encoded constructor args (hex, no 0x); empty for no args")
+	proxyAddr    := flag.String("proxy",         "", "BeaconProxy address: resolve --target from it instead of --contract")
+	targetName   := flag.String("target",        targetImpl, "with --proxy: contract to verify (impl, beacon or proxy)")
+	rpcURL       := flag.String("rpc",           "https://evmrpc-testnet.0g.ai", "RPC endpoint (with --proxy)")
 	flag.Parse()
 
-	if *contractAddr == "" {
-		fmt.Fprintln(os.Stderr, "error: --contract is required")
+	if (*contractAddr == "") == (*proxyAddr == "") {
+		fmt.Fprintln(os.Stderr, "error: exactly one of --contract or --proxy is required")
 		os.Exit(1)
 	}
 
+	if *proxyAddr != "" {
+		t, ok := targets[*targetName]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "error: --target must be %s, %s or %s\n", targetImpl, targetBeacon, targetProxy)
+			os.Exit(1)
+		}
+		if !common.IsHexAddress(*proxyAddr) {
+			fmt.Fprintf(os.Stderr, "error: invalid --proxy address %q\n", *proxyAddr)
+			os.Exit(1)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		d, err := resolveProxy(ctx, *rpcURL, common.HexToAddress(*proxyAddr))
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "resolve proxy: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Proxy         : %s\n", d.proxy.Hex())
+		fmt.Printf("Beacon        : %s\n", d.beacon.Hex())
+		fmt.Printf("Impl          : %s\n", d.impl.Hex())
+		fmt.Printf("Beacon owner  : %s\n", d.owner.Hex())
+		fmt.Printf("Provider stake: %s neuron\n\n", d.stake)
+
+		// Flags set explicitly win over what the target implies.
+		set := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		*contractAddr = d.address(*targetName).Hex()
+		if !set["source"] {
+			*sourcePath = t.source
+		}
+		if !set["source-key"] {
+			*sourceKey = t.sourceKey
+		}
+		if !set["contract-name"] {
+			*contractName = t.contractName
+		}
+		if !set["constructor-args"] {
+			args, err := d.constructorArgs(*targetName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "constructor args: %v\n", err)
+				os.Exit(1)
+			}
+			*constructorArgs = args
+			if args != "" {
+				fmt.Println("Constructor args are rebuilt from current chain state; if the beacon was")
+				fmt.Println("upgraded or transferred, or the stake changed, since deployment, pass the")
+				fmt.Printf("original ones with --constructor-args.\n\n")
+			}
+		}
+	}
+
 	addr := strings.ToLower(*contractAddr)
 	if !strings.HasPrefix(addr, "0x") {
 		addr = "0x" + addr
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+// beaconSlot is the ERC-1967 storage slot for the beacon address.
+// = keccak256("eip1967.proxy.beacon") - 1
+var beaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+
+// proxyConstructorABI is BeaconProxy's constructor(address beacon, bytes data);
+// BeaconProxy has no generated binding.
+const proxyConstructorABI = `[{
+	"type": "constructor",
+	"inputs": [
+		{"name": "beacon", "type": "address"},
+		{"name": "data",   "type": "bytes"}
+	],
+	"stateMutability": "payable"
+}]`
+
+// Verification targets selectable with --target.
+const (
+	targetImpl   = "impl"
+	targetBeacon = "beacon"
+	targetProxy  = "proxy"
+)
+
+// target is what to verify for a --target, and where its source lives.
+type target struct {
+	source       string // path on disk
+	sourceKey    string // compiler path in standard-JSON
+	contractName string // fully-qualified name
+}
+
+var targets = map[string]target{
+	targetImpl:   {"contracts/src/SandboxServing.sol", "src/SandboxServing.sol", "src/SandboxServing.sol:SandboxServing"},
+	targetBeacon: {"contracts/src/proxy/UpgradeableBeacon.sol", "src/proxy/UpgradeableBeacon.sol", "src/proxy/UpgradeableBeacon.sol:UpgradeableBeacon"},
+	targetProxy:  {"contracts/src/proxy/BeaconProxy.sol", "src/proxy/BeaconProxy.sol", "src/proxy/BeaconProxy.sol:BeaconProxy"},
+}
+
+// deployment is a BeaconProxy deployment as read from the chain.
+type deployment struct {
+	proxy, beacon, impl, owner common.Address
+	stake                      *big.Int // providerStake, the initialize() argument
+}
+
+// resolveProxy reads the beacon from the proxy's ERC-1967 slot, then the
+// beacon's implementation() and owner(), and the proxy's providerStake().
+func resolveProxy(ctx context.Context, rpcURL string, proxy common.Address) (*deployment, error) {
+	client, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("dial rpc: %w", err)
+	}
+	defer client.Close()
+
+	raw, err := client.StorageAt(ctx, proxy, beaconSlot, nil)
+	if err != nil {
+		return nil, fmt.Errorf("read beacon slot: %w", err)
+	}
+	d := &deployment{proxy: proxy, beacon: common.BytesToAddress(raw)}
+	if d.beacon == (common.Address{}) {
+		return nil, fmt.Errorf("%s has no ERC-1967 beacon: not a BeaconProxy", proxy.Hex())
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	beacon, err := chain.NewUpgradeableBeaconCaller(d.beacon, client)
+	if err != nil {
+		return nil, fmt.Errorf("bind beacon: %w", err)
+	}
+	if d.impl, err = beacon.Implementation(opts); err != nil {
+		return nil, fmt.Errorf("beacon.implementation(): %w", err)
+	}
+	if d.owner, err = beacon.Owner(opts); err != nil {
+		return nil, fmt.Errorf("beacon.owner(): %w", err)
+	}
+	serving, err := chain.NewSandboxServingCaller(proxy, client)
+	if err != nil {
+		return nil, fmt.Errorf("bind proxy: %w", err)
+	}
+	if d.stake, err = serving.ProviderStake(opts); err != nil {
+		return nil, fmt.Errorf("providerStake(): %w", err)
+	}
+	return d, nil
+}
+
+// address returns the contract --target names in d.
+func (d *deployment) address(t string) common.Address {
+	switch t {
+	case targetBeacon:
+		return d.beacon
+	case targetProxy:
+		return d.proxy
+	default:
+		return d.impl
+	}
+}
+
+// constructorArgs ABI-encodes (hex, no 0x) the constructor arguments of the
+// contract --target names: none for the implementation,
+// UpgradeableBeacon(impl, owner) and BeaconProxy(beacon, initialize(stake)).
+//
+// They are rebuilt from the current on-chain state, so they match the
+// deployment only while the beacon has not been upgraded or changed hands
+// and providerStake has not been changed with setProviderStake; otherwise
+// pass the original arguments with --constructor-args.
+func (d *deployment) constructorArgs(t string) (string, error) {
+	switch t {
+	case targetBeacon:
+		beaconABI, err := chain.UpgradeableBeaconMetaData.GetAbi()
+		if err != nil {
+			return "", err
+		}
+		packed, err := beaconABI.Constructor.Inputs.Pack(d.impl, d.owner)
+		if err != nil {
+			return "", fmt.Errorf("pack beacon constructor: %w", err)
+		}
+		return hex.EncodeToString(packed), nil
+	case targetProxy:
+		implABI, err := chain.SandboxServingMetaData.GetAbi()
+		if err != nil {
+			return "", err
+		}
+		initCalldata, err := implABI.Pack("initialize", d.stake)
+		if err != nil {
+			return "", fmt.Errorf("pack initialize: %w", err)
+		}
+		proxyABI, err := abi.JSON(strings.NewReader(proxyConstructorABI))
+		if err != nil {
+			return "", err
+		}
+		packed, err := proxyABI.Constructor.Inputs.Pack(d.beacon, initCalldata)
+		if err != nil {
+			return "", fmt.Errorf("pack proxy constructor: %w", err)
+		}
+		return hex.EncodeToString(packed), nil
+	default:
+		return "", nil
+	}
+}
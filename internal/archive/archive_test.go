@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/storage"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const testProvider = "0x1111111111111111111111111111111111111111"
+
+var (
+	alice = common.HexToAddress("0xAAAA000000000000000000000000000000000001")
+	bob   = common.HexToAddress("0xBBBB000000000000000000000000000000000002")
+	day1  = time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	day2  = day1.Add(2 * time.Hour)
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func settled(user common.Address, nonce int64) voucher.SandboxVoucher {
+	return voucher.SandboxVoucher{
+		SandboxID: "sb-1",
+		User:      user,
+		Provider:  common.HexToAddress(testProvider),
+		TotalFee:  big.NewInt(1000),
+		Nonce:     big.NewInt(nonce),
+	}
+}
+
+// failingStore fails every Append after the first ok ones.
+type failingStore struct {
+	storage.Store
+	ok int
+}
+
+func (f *failingStore) Append(ctx context.Context, name string, data []byte) error {
+	if f.ok == 0 {
+		return errors.New("disk full")
+	}
+	f.ok--
+	return storage.Append(ctx, f.Store, name, data)
+}
+
+func TestArchiver_FlushAndQuery(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	store, _ := storage.NewFSStore(t.TempDir())
+
+	Enqueue(ctx, rdb, nil, testProvider, settled(alice, 1), "success", day1)
+	Enqueue(ctx, rdb, nil, testProvider, settled(bob, 1), "success", day1)
+	Enqueue(ctx, rdb, nil, testProvider, settled(alice, 2), "success", day2)
+
+	a := NewArchiver(rdb, store, testProvider, 2, time.Minute, zap.NewNop())
+	if n, err := a.Flush(ctx); err != nil || n != 2 {
+		t.Fatalf("first flush: n=%d err=%v", n, err)
+	}
+	if n, err := a.Flush(ctx); err != nil || n != 1 {
+		t.Fatalf("second flush: n=%d err=%v", n, err)
+	}
+	if l := rdb.LLen(ctx, pendingKeyPrefix+testProvider).Val(); l != 0 {
+		t.Errorf("pending: got %d want 0", l)
+	}
+
+	got, err := Query(ctx, store, testProvider, alice, day1.Truncate(24*time.Hour), day2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Voucher.Nonce.Int64() != 1 || got[1].Voucher.Nonce.Int64() != 2 {
+		t.Fatalf("alice: got %+v", got)
+	}
+	// A range covering only the first day excludes the second voucher.
+	if got, _ := Query(ctx, store, testProvider, alice, day1, day1); len(got) != 1 {
+		t.Errorf("day1 only: got %d records", len(got))
+	}
+}
+
+// TestArchiver_ResumesFromCursor checks that a flush interrupted after
+// writing one daily file neither loses nor rewrites records on retry.
+func TestArchiver_ResumesFromCursor(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	fs, _ := storage.NewFSStore(t.TempDir())
+	store := &failingStore{Store: fs, ok: 1}
+
+	Enqueue(ctx, rdb, nil, testProvider, settled(alice, 1), "success", day1)
+	Enqueue(ctx, rdb, nil, testProvider, settled(alice, 2), "success", day2)
+
+	a := NewArchiver(rdb, store, testProvider, 10, time.Minute, zap.NewNop())
+	if _, err := a.Flush(ctx); err == nil {
+		t.Fatal("expected the second file write to fail")
+	}
+	store.ok = 10
+	if n, err := a.Flush(ctx); err != nil || n != 2 {
+		t.Fatalf("retry: n=%d err=%v", n, err)
+	}
+
+	data, _ := fs.Get(ctx, FileName(testProvider, day1))
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("day1 file: got %d lines want 1", lines)
+	}
+	if got, _ := Query(ctx, store, testProvider, alice, day1, day2); len(got) != 2 {
+		t.Errorf("query: got %d records want 2", len(got))
+	}
+}
+
+func TestQuery_DropsDuplicatesAndValidatesRange(t *testing.T) {
+	ctx := context.Background()
+	store, _ := storage.NewFSStore(t.TempDir())
+	line := `{"seq":7,"status":"success","settled_at":` + strconv.FormatInt(day1.Unix(), 10) + `,"voucher":{"user":"` + alice.Hex() + `","nonce":3}}` + "\n"
+	store.Append(ctx, FileName(testProvider, day1), []byte(line+line))
+
+	if got, _ := Query(ctx, store, testProvider, alice, day1, day1); len(got) != 1 {
+		t.Errorf("duplicates: got %d records want 1", len(got))
+	}
+	if _, err := Query(ctx, store, testProvider, alice, day2, day1); err == nil {
+		t.Error("reversed range must fail")
+	}
+	if _, err := Query(ctx, store, testProvider, alice, day1, day1.AddDate(2, 0, 0)); err == nil {
+		t.Error("multi-year range must fail")
+	}
+}
+
+func TestFSStore_RejectsEscapingNames(t *testing.T) {
+	store, _ := storage.NewFSStore(t.TempDir())
+	for _, name := range []string{"../x.jsonl", "/etc/passwd", "."} {
+		if err := store.Append(context.Background(), name, []byte("x")); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+}
+
+// TestArchiver_RedisStore runs the archive on a non-filesystem backend.
+func TestArchiver_RedisStore(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	store := storage.Namespace(storage.NewRedisStore(rdb, "storage:"), "archive")
+
+	Enqueue(ctx, rdb, nil, testProvider, settled(alice, 1), "success", day1)
+	Enqueue(ctx, rdb, nil, testProvider, settled(alice, 2), "success", day2)
+	Enqueue(ctx, rdb, nil, testProvider, settled(alice, 3), "success", day2.AddDate(0, 0, 5))
+
+	a := NewArchiver(rdb, store, testProvider, 10, time.Minute, zap.NewNop())
+	if n, err := a.Flush(ctx); err != nil || n != 3 {
+		t.Fatalf("flush: n=%d err=%v", n, err)
+	}
+	got, err := Query(ctx, store, testProvider, alice, day1, day2)
+	if err != nil || len(got) != 2 || got[0].Seq != 1 || got[1].Seq != 2 {
+		t.Errorf("query: %+v, %v; want seqs 1 and 2 (the third is outside the range)", got, err)
+	}
+}
+
+func TestArchiver_EncryptedQueue(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	store, _ := storage.NewFSStore(t.TempDir())
+	codec, err := voucher.NewCodec("k1:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Enqueue(ctx, rdb, codec, testProvider, settled(alice, 1), "success", day1)
+	item := rdb.LIndex(ctx, pendingKeyPrefix+testProvider, 0).Val()
+	if !strings.HasPrefix(item, "enc:k1:") {
+		t.Fatalf("queued record %q is not sealed", item)
+	}
+
+	a := NewArchiver(rdb, store, testProvider, 10, time.Minute, zap.NewNop())
+	a.SetCodec(codec)
+	if n, err := a.Flush(ctx); err != nil || n != 1 {
+		t.Fatalf("flush: n=%d err=%v", n, err)
+	}
+	// Archive files hold the plaintext record.
+	if got, _ := Query(ctx, store, testProvider, alice, day1, day1); len(got) != 1 || got[0].Voucher.Nonce.Int64() != 1 {
+		t.Fatalf("query: got %+v", got)
+	}
+
+	// Without the key the record stays queued instead of being dropped.
+	Enqueue(ctx, rdb, codec, testProvider, settled(alice, 2), "success", day1)
+	a.SetCodec(nil)
+	if _, err := a.Flush(ctx); !errors.Is(err, voucher.ErrUnknownKey) {
+		t.Fatalf("flush without key: got %v want ErrUnknownKey", err)
+	}
+	if l := rdb.LLen(ctx, pendingKeyPrefix+testProvider).Val(); l != 1 {
+		t.Errorf("pending: got %d want 1", l)
+	}
+}
@@ -0,0 +1,195 @@
+// Package archive retains settled vouchers durably, outside Redis.
+//
+// The settler enqueues every successfully settled voucher to a per-provider
+// Redis list; an Archiver drains that list in batches into append-only daily
+// files (<provider>/<YYYY-MM-DD>.jsonl) on a storage.Store. Query reads them
+// back for a wallet and date range (see cmd/archive-query).
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/storage"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// Redis key prefixes; each is suffixed with the configured provider address.
+const (
+	pendingKeyPrefix = "archive:pending:" // list of Record JSON awaiting archival
+	seqKeyPrefix     = "archive:seq:"     // last assigned Record.Seq
+	cursorKeyPrefix  = "archive:cursor:"  // last Record.Seq written to the Store
+)
+
+// Record is one archived voucher together with its settlement receipt.
+type Record struct {
+	Seq       int64                  `json:"seq"`
+	Status    string                 `json:"status"` // lowercased chain.SettlementStatus
+	SettledAt int64                  `json:"settled_at"`
+	Voucher   voucher.SandboxVoucher `json:"voucher"`
+}
+
+// FileName is the archive file holding records settled on day t (UTC). The
+// provider directory is always the checksummed address.
+func FileName(provider string, t time.Time) string {
+	return common.HexToAddress(provider).Hex() + "/" + t.UTC().Format(time.DateOnly) + ".jsonl"
+}
+
+// Enqueue queues a settled voucher for archival. Each record gets the next
+// per-provider sequence number, which the Archiver's cursor tracks. The
+// record is sealed with codec (nil = plaintext) while it waits in Redis.
+func Enqueue(ctx context.Context, rdb *redis.Client, codec *voucher.Codec, provider string, v voucher.SandboxVoucher, status string, settledAt time.Time) error {
+	seq, err := rdb.Incr(ctx, seqKeyPrefix+provider).Result()
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(Record{Seq: seq, Status: status, SettledAt: settledAt.Unix(), Voucher: v})
+	if err != nil {
+		return err
+	}
+	item, err := codec.Seal(raw)
+	if err != nil {
+		return err
+	}
+	return rdb.RPush(ctx, pendingKeyPrefix+provider, item).Err()
+}
+
+// Archiver moves queued records from Redis to a storage.Store in batches.
+type Archiver struct {
+	rdb       *redis.Client
+	store     storage.Store
+	provider  string
+	batchSize int
+	interval  time.Duration
+	codec     *voucher.Codec
+	log       *zap.Logger
+}
+
+// NewArchiver returns an Archiver that flushes up to batchSize records per
+// write, every interval. Writes append to the day's file (see
+// storage.Append): a store that cannot append natively rewrites it, which
+// is safe because only one Archiver writes a provider's files.
+func NewArchiver(rdb *redis.Client, store storage.Store, provider string, batchSize int, interval time.Duration, log *zap.Logger) *Archiver {
+	return &Archiver{rdb: rdb, store: store, provider: provider, batchSize: batchSize, interval: interval, log: log}
+}
+
+// SetCodec sets the codec queued records were sealed with (see Enqueue);
+// nil = plaintext. Archive files are always written in plaintext.
+func (a *Archiver) SetCodec(c *voucher.Codec) {
+	a.codec = c
+}
+
+// Run flushes the pending queue every interval until ctx is cancelled, then
+// makes a final flush so records settled during shutdown are not left behind.
+func (a *Archiver) Run(ctx context.Context) {
+	a.log.Info("archiver started", zap.String("provider", a.provider), zap.Duration("interval", a.interval))
+	defer a.log.Info("archiver stopped")
+
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+			a.drain(drainCtx)
+			cancel()
+			return
+		case <-t.C:
+			a.drain(ctx)
+		}
+	}
+}
+
+// drain flushes batches until the queue is empty or a flush fails.
+func (a *Archiver) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := a.Flush(ctx)
+		if err != nil {
+			a.log.Error("archiver: flush failed", zap.Error(err))
+			return
+		}
+		if n < a.batchSize {
+			return
+		}
+	}
+}
+
+// Flush archives up to batchSize queued records and returns how many were
+// taken off the queue.
+//
+// Records are appended to their daily file in sequence order and the cursor
+// is advanced after each file write, so a crash resumes from the last write
+// that completed: records at or below the cursor are dropped from the queue
+// without being written again. A crash between a write and its cursor update
+// can repeat that write's records; Query drops such duplicates.
+func (a *Archiver) Flush(ctx context.Context) (int, error) {
+	pendingKey := pendingKeyPrefix + a.provider
+	cursorKey := cursorKeyPrefix + a.provider
+
+	raw, err := a.rdb.LRange(ctx, pendingKey, 0, int64(a.batchSize)-1).Result()
+	if err != nil || len(raw) == 0 {
+		return 0, err
+	}
+	cursor, err := a.rdb.Get(ctx, cursorKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	var (
+		buf      bytes.Buffer
+		file     string
+		fileLast int64
+	)
+	flushFile := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		if err := storage.Append(ctx, a.store, file, buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+		cursor = fileLast
+		return a.rdb.Set(ctx, cursorKey, strconv.FormatInt(cursor, 10), 0).Err()
+	}
+	for _, item := range raw {
+		plain, err := a.codec.Open(item)
+		if err != nil {
+			// Sealed under a key that is no longer configured: stop here
+			// rather than drop a settled record.
+			return 0, err
+		}
+		var r Record
+		if err := json.Unmarshal(plain, &r); err != nil {
+			a.log.Error("archiver: dropping malformed record", zap.String("raw", item), zap.Error(err))
+			continue
+		}
+		if r.Seq <= cursor {
+			continue // written before a crash, but not yet trimmed
+		}
+		name := FileName(a.provider, time.Unix(r.SettledAt, 0))
+		if name != file {
+			if err := flushFile(); err != nil {
+				return 0, err
+			}
+			file = name
+		}
+		buf.Write(bytes.TrimSpace(plain))
+		buf.WriteByte('\n')
+		fileLast = r.Seq
+	}
+	if err := flushFile(); err != nil {
+		return 0, err
+	}
+	if err := a.rdb.LTrim(ctx, pendingKey, int64(len(raw)), -1).Err(); err != nil {
+		return 0, err
+	}
+	return len(raw), nil
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/0gfoundation/0g-sandbox/internal/storage"
+)
+
+// maxQueryDays bounds a single Query so a typo in the range cannot make it
+// read years of files.
+const maxQueryDays = 366
+
+// Query returns the archived records of user's vouchers with provider settled
+// in [from, to], both inclusive, ordered by sequence number. Only the days
+// that have an archive file are read (one List over the range); records
+// repeated by a crash-interrupted flush are returned once.
+func Query(ctx context.Context, store storage.Store, provider string, user common.Address, from, to time.Time) ([]Record, error) {
+	from, to = from.UTC(), to.UTC()
+	if to.Before(from) {
+		return nil, fmt.Errorf("range end %s is before start %s", to.Format(time.DateOnly), from.Format(time.DateOnly))
+	}
+	firstDay := from.Truncate(24 * time.Hour)
+	if days := int(to.Sub(firstDay) / (24 * time.Hour)); days >= maxQueryDays {
+		return nil, fmt.Errorf("range spans %d days (max %d)", days+1, maxQueryDays)
+	}
+
+	dayAfter := to.Truncate(24*time.Hour).AddDate(0, 0, 1)
+	files, err := store.List(ctx, common.HexToAddress(provider).Hex()+"/", storage.ListOptions{
+		Start: FileName(provider, firstDay),
+		End:   FileName(provider, dayAfter),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list archive files: %w", err)
+	}
+
+	var out []Record
+	seen := make(map[int64]bool)
+	for _, file := range files {
+		data, err := store.Get(ctx, file)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for sc.Scan() {
+			var r Record
+			if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+				continue
+			}
+			if r.Voucher.User != user || seen[r.Seq] {
+				continue
+			}
+			if r.SettledAt < from.Unix() || r.SettledAt > to.Unix() {
+				continue
+			}
+			seen[r.Seq] = true
+			out = append(out, r)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", file, err)
+		}
+	}
+	return out, nil
+}
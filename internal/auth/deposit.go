@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DepositAuthorization is a wallet's EIP-712 request that the relayer deposit
+// Amount into Recipient's balance with Provider, paying the value and gas
+// itself. Nonce is chosen by the signer and may be used once; the
+// authorization is void after Deadline (unix seconds).
+type DepositAuthorization struct {
+	Recipient common.Address
+	Provider  common.Address
+	Amount    *big.Int
+	Nonce     *big.Int
+	Deadline  int64
+}
+
+var depositAuthTypeHash = crypto.Keccak256Hash([]byte(
+	"DepositAuthorization(address recipient,address provider,uint256 amount,uint256 nonce,uint256 deadline)",
+))
+
+// depositDomainSeparator uses its own domain name so a deposit authorization
+// can never be replayed as a settlement voucher or vice versa.
+func depositDomainSeparator(chainID *big.Int, contractAddr common.Address) [32]byte {
+	domainTypeHash := crypto.Keccak256Hash([]byte(
+		"EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)",
+	))
+	nameHash := crypto.Keccak256Hash([]byte("0G Sandbox Deposit Relay"))
+	versionHash := crypto.Keccak256Hash([]byte("1"))
+
+	encoded := make([]byte, 5*32)
+	copy(encoded[0:32], domainTypeHash[:])
+	copy(encoded[32:64], nameHash[:])
+	copy(encoded[64:96], versionHash[:])
+	chainID.FillBytes(encoded[96:128])
+	copy(encoded[140:160], contractAddr.Bytes())
+	return crypto.Keccak256Hash(encoded)
+}
+
+// Digest returns the EIP-712 digest the wallet signs.
+func (a *DepositAuthorization) Digest(chainID *big.Int, contractAddr common.Address) [32]byte {
+	encoded := make([]byte, 6*32)
+	copy(encoded[0:32], depositAuthTypeHash[:])
+	copy(encoded[44:64], a.Recipient.Bytes())
+	copy(encoded[76:96], a.Provider.Bytes())
+	a.Amount.FillBytes(encoded[96:128])
+	a.Nonce.FillBytes(encoded[128:160])
+	big.NewInt(a.Deadline).FillBytes(encoded[160:192])
+	structHash := crypto.Keccak256Hash(encoded)
+
+	sep := depositDomainSeparator(chainID, contractAddr)
+	msg := make([]byte, 2+32+32)
+	msg[0] = 0x19
+	msg[1] = 0x01
+	copy(msg[2:34], sep[:])
+	copy(msg[34:66], structHash[:])
+	return crypto.Keccak256Hash(msg)
+}
+
+// Sign signs the authorization with key (V = 27/28, as eth_signTypedData
+// produces).
+func (a *DepositAuthorization) Sign(key *ecdsa.PrivateKey, chainID *big.Int, contractAddr common.Address) ([]byte, error) {
+	digest := a.Digest(chainID, contractAddr)
+	sig, err := crypto.Sign(digest[:], key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// Signer recovers the address that signed the authorization.
+func (a *DepositAuthorization) Signer(sig []byte, chainID *big.Int, contractAddr common.Address) (common.Address, error) {
+	if len(sig) != 65 {
+		return common.Address{}, errors.New("signature must be 65 bytes")
+	}
+	if !isUint256(a.Amount) || !isUint256(a.Nonce) || a.Deadline < 0 {
+		return common.Address{}, errors.New("amount, nonce and deadline must fit uint256")
+	}
+	s := make([]byte, 65)
+	copy(s, sig)
+	if s[64] >= 27 {
+		s[64] -= 27
+	}
+	digest := a.Digest(chainID, contractAddr)
+	pub, err := crypto.SigToPub(digest[:], s)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+func isUint256(n *big.Int) bool {
+	return n != nil && n.Sign() >= 0 && n.BitLen() <= 256
+}
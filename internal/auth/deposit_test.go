@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	testChainID  = big.NewInt(16602)
+	testContract = common.HexToAddress("0x24cD979DBd0Ae924a3f0c832a724CF4C58E5C210")
+)
+
+func testAuthorization() DepositAuthorization {
+	return DepositAuthorization{
+		Recipient: common.HexToAddress("0x3333333333333333333333333333333333333333"),
+		Provider:  common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		Amount:    big.NewInt(1e16),
+		Nonce:     big.NewInt(1),
+		Deadline:  1900000000,
+	}
+}
+
+func TestDepositAuthorization_SignRecover(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	a := testAuthorization()
+	sig, err := a.Sign(key, testChainID, testContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := a.Signer(sig, testChainID, testContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crypto.PubkeyToAddress(key.PublicKey); got != want {
+		t.Errorf("signer: got %s want %s", got.Hex(), want.Hex())
+	}
+}
+
+// TestDepositAuthorization_BoundFields checks that every signed field and the
+// domain change the recovered signer when altered.
+func TestDepositAuthorization_BoundFields(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	want := crypto.PubkeyToAddress(key.PublicKey)
+	a := testAuthorization()
+	sig, _ := a.Sign(key, testChainID, testContract)
+
+	for name, mutate := range map[string]func(*DepositAuthorization){
+		"recipient": func(a *DepositAuthorization) {
+			a.Recipient = common.HexToAddress("0x4444444444444444444444444444444444444444")
+		},
+		"provider": func(a *DepositAuthorization) {
+			a.Provider = common.HexToAddress("0x2222222222222222222222222222222222222222")
+		},
+		"amount":   func(a *DepositAuthorization) { a.Amount = big.NewInt(1e17) },
+		"nonce":    func(a *DepositAuthorization) { a.Nonce = big.NewInt(2) },
+		"deadline": func(a *DepositAuthorization) { a.Deadline++ },
+	} {
+		m := testAuthorization()
+		mutate(&m)
+		if got, err := m.Signer(sig, testChainID, testContract); err == nil && got == want {
+			t.Errorf("%s: altered authorization still recovers the signer", name)
+		}
+	}
+	if got, err := a.Signer(sig, big.NewInt(1), testContract); err == nil && got == want {
+		t.Error("other chain ID still recovers the signer")
+	}
+}
+
+func TestDepositAuthorization_RejectsOversizedFields(t *testing.T) {
+	a := testAuthorization()
+	a.Nonce = new(big.Int).Lsh(big.NewInt(1), 256)
+	if _, err := a.Signer(make([]byte, 65), testChainID, testContract); err == nil {
+		t.Error("nonce >= 2^256 must be rejected")
+	}
+}
@@ -8,10 +8,16 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// eip191Prefix starts every auth digest: EIP-191 version 0x45 ("E",
+// personal_sign). EIP-712 digests — settlement vouchers and deposit
+// authorizations — start with version 0x01 instead, so no auth signature
+// verifies as one of those or vice versa without a keccak256 collision.
+const eip191Prefix = "\x19Ethereum Signed Message:\n"
+
 // HashMessage constructs the EIP-191 prefixed hash:
 // keccak256("\x19Ethereum Signed Message:\n" + len(msg) + msg)
 func HashMessage(msg []byte) []byte {
-	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(msg))
+	prefix := fmt.Sprintf("%s%d", eip191Prefix, len(msg))
 	return crypto.Keccak256([]byte(prefix), msg)
 }
 
@@ -1,9 +1,14 @@
 package auth
 
 import (
+	"encoding/json"
+	"math/big"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
 // TestHashMessage_Prefix verifies the EIP-191 prefix is applied correctly.
@@ -107,3 +112,65 @@ func TestRecover_InvalidSigLength(t *testing.T) {
 		t.Fatal("expected error for short signature")
 	}
 }
+
+// ── Cross-protocol signature reuse ───────────────────────────────────────────
+
+var (
+	crossChainID  = big.NewInt(16602)
+	crossContract = common.HexToAddress("0x24cD979DDA16A1a4f8C8f2d6cA2a4D5aB1c1E4f0")
+)
+
+// An auth signature must not pass as a voucher signature by the same key,
+// whether the voucher commits to the auth message or the attacker picks the
+// voucher fields freely.
+func TestCrossProtocol_AuthSignatureIsNotAVoucherSignature(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	msg, _ := json.Marshal(SignedRequest{Action: "create", ExpiresAt: 1760000000, Nonce: "n-1"})
+	sig, _ := crypto.Sign(HashMessage(msg), key)
+	sig[64] += 27
+
+	for name, v := range map[string]*voucher.SandboxVoucher{
+		"usage hash = auth message hash": {UsageHash: crypto.Keccak256Hash(msg)},
+		"usage hash = auth digest":       {UsageHash: common.BytesToHash(HashMessage(msg))},
+		"arbitrary voucher":              {UsageHash: [32]byte{1}},
+	} {
+		v.User, v.Provider = signer, signer
+		v.TotalFee, v.Nonce, v.Signature = big.NewInt(1), big.NewInt(1), sig
+		if got, err := voucher.Verify(v, crossChainID, crossContract); err == nil && got == signer {
+			t.Errorf("%s: auth signature verified as a voucher signed by %s", name, signer.Hex())
+		}
+	}
+}
+
+// A TEE voucher signature must not authenticate a request as the TEE address,
+// whichever bytes are presented as the signed message.
+func TestCrossProtocol_VoucherSignatureIsNotAnAuthSignature(t *testing.T) {
+	teeKey, _ := crypto.GenerateKey()
+	tee := crypto.PubkeyToAddress(teeKey.PublicKey)
+	v := &voucher.SandboxVoucher{
+		User:      common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		Provider:  common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		UsageHash: [32]byte{7},
+		TotalFee:  big.NewInt(1_000_000),
+		Nonce:     big.NewInt(1),
+	}
+	if err := voucher.Sign(v, teeKey, crossChainID, crossContract); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := voucher.Verify(v, crossChainID, crossContract); err != nil || got != tee {
+		t.Fatalf("voucher does not verify: %s, %v", got.Hex(), err)
+	}
+	digest := v.Digest(crossChainID, crossContract)
+	asJSON, _ := json.Marshal(v)
+
+	for name, msg := range map[string][]byte{
+		"voucher digest": digest[:],
+		"voucher JSON":   asJSON,
+		"empty message":  {},
+	} {
+		if got, err := Recover(msg, v.Signature); err == nil && got == tee {
+			t.Errorf("%s: voucher signature recovered as auth signature of the TEE", name)
+		}
+	}
+}
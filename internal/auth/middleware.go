@@ -1,40 +1,99 @@
 package auth
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
 )
 
 // SignedRequest is the JSON payload inside X-Signed-Message (fields sorted).
 type SignedRequest struct {
 	Action     string          `json:"action"`
+	BodyHash   string          `json:"body_hash,omitempty"` // 0x keccak256 of the raw HTTP body; checked by RequireBodyHash
 	ExpiresAt  int64           `json:"expires_at"`
 	Nonce      string          `json:"nonce"`
 	Payload    json.RawMessage `json:"payload"`
 	ResourceID string          `json:"resource_id"`
 }
 
-const maxFutureWindow = 5 * time.Minute
+// DefaultMaxValidity is how far ahead of now expires_at may lie when
+// Options.MaxValidity is not set.
+const DefaultMaxValidity = 5 * time.Minute
+
+// Options tunes Middleware's expiry checks. The zero value gives
+// DefaultMaxValidity, no clock skew and the real clock.
+type Options struct {
+	// MaxValidity is the furthest expires_at may lie ahead of now. It bounds
+	// how long a signature stays usable, since expires_at is chosen by the
+	// client.
+	MaxValidity time.Duration
+	// ClockSkew tolerates client clocks that disagree with ours: a signature
+	// is still accepted up to ClockSkew after its expires_at, and expires_at
+	// may exceed MaxValidity by ClockSkew.
+	ClockSkew time.Duration
+	Clock     clock.Clock
+	// TokenRoutes are the route patterns (gin's FullPath, e.g. "/api/events")
+	// on which a WebSocket upgrade may authenticate with a ?token= from
+	// IssueToken instead of the signed headers. None by default.
+	TokenRoutes []string
+}
+
+// Middleware returns a Gin handler that validates EIP-191 wallet signatures
+// with the default Options. Expiry is checked against clk if given, else the
+// real clock.
+func Middleware(rdb *redis.Client, clk ...clock.Clock) gin.HandlerFunc {
+	var opts Options
+	if len(clk) > 0 {
+		opts.Clock = clk[0]
+	}
+	return MiddlewareWithOptions(rdb, opts)
+}
 
-// Middleware returns a Gin handler that validates EIP-191 wallet signatures.
-func Middleware(rdb *redis.Client) gin.HandlerFunc {
+// MiddlewareWithOptions is Middleware with configurable expiry checks.
+// Expired signatures are rejected with 401 SIG_EXPIRED, and signatures valid
+// for longer than MaxValidity with 401 SIG_TOO_LONG.
+func MiddlewareWithOptions(rdb *redis.Client, opts Options) gin.HandlerFunc {
+	nowFn := clock.OrReal(opts.Clock).Now
+	maxValidity := opts.MaxValidity
+	if maxValidity <= 0 {
+		maxValidity = DefaultMaxValidity
+	}
+	maxAhead := int64((maxValidity + opts.ClockSkew) / time.Second)
+	skew := int64(opts.ClockSkew / time.Second)
 	return func(c *gin.Context) {
 		walletAddr := c.GetHeader("X-Wallet-Address")
 		signedMsgB64 := c.GetHeader("X-Signed-Message")
 		sigHex := c.GetHeader("X-Wallet-Signature")
 
+		if walletAddr == "" && signedMsgB64 == "" && sigHex == "" && isWebSocketUpgrade(c.Request) &&
+			slices.Contains(opts.TokenRoutes, c.FullPath()) {
+			tokenAuth(c, rdb, nowFn())
+			return
+		}
 		if walletAddr == "" || signedMsgB64 == "" || sigHex == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing auth headers"})
 			return
 		}
+		wallet, err := ParseWallet(walletAddr)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "BAD_WALLET"})
+			return
+		}
 
 		// Decode signed message
 		msgBytes, err := base64.StdEncoding.DecodeString(signedMsgB64)
@@ -49,15 +108,15 @@ func Middleware(rdb *redis.Client) gin.HandlerFunc {
 			return
 		}
 
-		now := time.Now().Unix()
+		now := nowFn().Unix()
 
 		// Check expiry
-		if req.ExpiresAt <= now {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "request expired"})
+		if req.ExpiresAt+skew <= now {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "request expired", "code": "SIG_EXPIRED"})
 			return
 		}
-		if req.ExpiresAt > now+int64(maxFutureWindow.Seconds()) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "expires_at too far in future"})
+		if req.ExpiresAt > now+maxAhead {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "expires_at too far in future", "code": "SIG_TOO_LONG"})
 			return
 		}
 
@@ -75,14 +134,14 @@ func Middleware(rdb *redis.Client) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
 			return
 		}
-		if !strings.EqualFold(recovered.Hex(), walletAddr) {
+		if recovered != wallet {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
 			return
 		}
 
-		// Nonce dedup via Redis SET NX
+		// Nonce dedup via Redis SET NX, for as long as the signature is accepted
 		nonceKey := "nonce:" + req.Nonce
-		ttl := time.Duration(req.ExpiresAt-now) * time.Second
+		ttl := time.Duration(req.ExpiresAt+skew-now) * time.Second
 		set, err := rdb.SetNX(context.Background(), nonceKey, 1, ttl).Result()
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
@@ -93,7 +152,113 @@ func Middleware(rdb *redis.Client) gin.HandlerFunc {
 			return
 		}
 
-		c.Set("wallet_address", walletAddr)
+		// Downstream handlers only ever see the EIP-55 checksummed form.
+		c.Set("wallet_address", wallet.Hex())
+		c.Set(signedRequestKey, req)
+		c.Next()
+	}
+}
+
+// ParseWallet parses an X-Wallet-Address value: 0x followed by 40 hex digits.
+// All-lowercase and all-uppercase addresses are accepted as-is; a mixed-case
+// address must carry a valid EIP-55 checksum.
+func ParseWallet(s string) (common.Address, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") || !common.IsHexAddress(s) {
+		return common.Address{}, errors.New("malformed X-Wallet-Address")
+	}
+	addr := common.HexToAddress(s)
+	digits := s[2:]
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && digits != addr.Hex()[2:] {
+		return common.Address{}, errors.New("X-Wallet-Address fails EIP-55 checksum")
+	}
+	return addr, nil
+}
+
+// signedRequestKey is the gin context key under which Middleware stores the
+// verified SignedRequest.
+const signedRequestKey = "signed_request"
+
+// tokenExpiresKey is the gin context key under which tokenAuth stores the
+// unix expiry of the token the request was authenticated with.
+const tokenExpiresKey = "token_expires_at"
+
+// tokenAuth authenticates a WebSocket upgrade by its ?token= query parameter,
+// since browsers cannot attach the signed-request headers to a WebSocket.
+// Tokens are never accepted on plain HTTP requests, where they would end up
+// in access logs without adding anything over the signed headers, nor
+// outside Options.TokenRoutes.
+func tokenAuth(c *gin.Context, rdb *redis.Client, now time.Time) {
+	wallet, expiresAt, err := lookupToken(c.Request.Context(), rdb, c.Query("token"), now)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	c.Set("wallet_address", wallet)
+	c.Set(tokenExpiresKey, expiresAt)
+	c.Next()
+}
+
+// TokenExpiresAt returns the expiry of the token that authenticated c, and
+// false when the request was authenticated by signature instead.
+func TokenExpiresAt(c *gin.Context) (int64, bool) {
+	v, ok := c.Get(tokenExpiresKey)
+	exp, _ := v.(int64)
+	return exp, ok
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// maxHashedBodySize caps how much of a request body RequireBodyHash buffers.
+const maxHashedBodySize = 10 << 20
+
+// BodyHash returns the 0x-prefixed keccak256 of body, the value clients put
+// in SignedRequest.BodyHash.
+func BodyHash(body []byte) string {
+	return "0x" + hex.EncodeToString(crypto.Keccak256(body))
+}
+
+// RequireBodyHash binds the request body to the signature on routes that opt
+// in. When the signed message carries a body_hash, the raw body is buffered,
+// hashed and compared; a mismatch is rejected with 401 BODY_TAMPERED. The
+// body is restored so downstream handlers can still read it. Requests signed
+// without body_hash (older clients) and requests that did not pass Middleware
+// are let through unchanged. Must run after Middleware.
+func RequireBodyHash() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(signedRequestKey)
+		req, _ := v.(SignedRequest)
+		if !ok || req.BodyHash == "" {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(c.Request.Body, maxHashedBodySize+1))
+			c.Request.Body.Close()
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "read body"})
+				return
+			}
+			if len(body) > maxHashedBodySize {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "body too large"})
+				return
+			}
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		want := strings.TrimPrefix(strings.ToLower(req.BodyHash), "0x")
+		if strings.TrimPrefix(BodyHash(body), "0x") != want {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "request body does not match signed body_hash",
+				"code":  "BODY_TAMPERED",
+			})
+			return
+		}
 		c.Next()
 	}
 }
@@ -1,11 +1,15 @@
 package auth
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +17,8 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
 )
 
 func init() {
@@ -35,6 +41,12 @@ func testSetup(t *testing.T) (*miniredis.Miniredis, *redis.Client, *gin.Engine)
 // buildRequest creates a valid signed HTTP request for testing.
 // expiresOffset is relative to now (e.g. +2*time.Minute for valid, -1 for expired).
 func buildRequest(t *testing.T, expiresOffset time.Duration, nonce string) (*http.Request, string) {
+	t.Helper()
+	return buildRequestAt(t, time.Now().Add(expiresOffset).Unix(), nonce)
+}
+
+// buildRequestAt is buildRequest with an absolute expires_at.
+func buildRequestAt(t *testing.T, expiresAt int64, nonce string) (*http.Request, string) {
 	t.Helper()
 	privKey, err := crypto.GenerateKey()
 	if err != nil {
@@ -44,7 +56,7 @@ func buildRequest(t *testing.T, expiresOffset time.Duration, nonce string) (*htt
 
 	sr := SignedRequest{
 		Action:     "test",
-		ExpiresAt:  time.Now().Add(expiresOffset).Unix(),
+		ExpiresAt:  expiresAt,
 		Nonce:      nonce,
 		Payload:    json.RawMessage(`{}`),
 		ResourceID: "sb-test",
@@ -108,8 +120,8 @@ func TestMiddleware_Expired(t *testing.T) {
 	}
 	var resp map[string]string
 	json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp["error"] != "request expired" {
-		t.Errorf("unexpected error: %s", resp["error"])
+	if resp["error"] != "request expired" || resp["code"] != "SIG_EXPIRED" {
+		t.Errorf("unexpected error: %s (%s)", resp["error"], resp["code"])
 	}
 }
 
@@ -125,8 +137,87 @@ func TestMiddleware_TooFarInFuture(t *testing.T) {
 	}
 	var resp map[string]string
 	json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp["error"] != "expires_at too far in future" {
-		t.Errorf("unexpected error: %s", resp["error"])
+	if resp["error"] != "expires_at too far in future" || resp["code"] != "SIG_TOO_LONG" {
+		t.Errorf("unexpected error: %s (%s)", resp["error"], resp["code"])
+	}
+}
+
+// TestMiddleware_ExpiryAtTheInstant pins the clock to check the exact
+// boundaries: expires_at == now is expired, now+DefaultMaxValidity is accepted.
+func TestMiddleware_ExpiryAtTheInstant(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	fake := clock.NewFake(time.Unix(1_800_000_000, 0))
+	r := gin.New()
+	r.POST("/test", Middleware(rdb, fake), func(c *gin.Context) { c.Status(http.StatusOK) })
+	now := fake.Now().Unix()
+
+	cases := []struct {
+		name      string
+		expiresAt int64
+		want      int
+	}{
+		{"expires now", now, http.StatusUnauthorized},
+		{"expires in 1s", now + 1, http.StatusOK},
+		{"at future limit", now + int64(DefaultMaxValidity.Seconds()), http.StatusOK},
+		{"past future limit", now + int64(DefaultMaxValidity.Seconds()) + 1, http.StatusUnauthorized},
+	}
+	for i, tc := range cases {
+		req, _ := buildRequestAt(t, tc.expiresAt, fmt.Sprintf("nonce-instant-%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestMiddleware_ValidityAndSkewBoundaries checks a configured MaxValidity
+// and ClockSkew at their exact edges.
+func TestMiddleware_ValidityAndSkewBoundaries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	fake := clock.NewFake(time.Unix(1_800_000_000, 0))
+	r := gin.New()
+	r.POST("/test", MiddlewareWithOptions(rdb, Options{
+		MaxValidity: 60 * time.Second,
+		ClockSkew:   5 * time.Second,
+		Clock:       fake,
+	}), func(c *gin.Context) { c.Status(http.StatusOK) })
+	now := fake.Now().Unix()
+
+	cases := []struct {
+		name      string
+		expiresAt int64
+		want      int
+		code      string
+	}{
+		{"expired beyond skew", now - 5, http.StatusUnauthorized, "SIG_EXPIRED"},
+		{"expired within skew", now - 4, http.StatusOK, ""},
+		{"expires now", now, http.StatusOK, ""},
+		{"at validity limit", now + 60, http.StatusOK, ""},
+		{"validity limit plus skew", now + 65, http.StatusOK, ""},
+		{"past validity limit plus skew", now + 66, http.StatusUnauthorized, "SIG_TOO_LONG"},
+		{"a year ahead", now + 365*24*3600, http.StatusUnauthorized, "SIG_TOO_LONG"},
+	}
+	for i, tc := range cases {
+		req, _ := buildRequestAt(t, tc.expiresAt, fmt.Sprintf("nonce-skew-%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, w.Code, w.Body.String())
+			continue
+		}
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp) //nolint:errcheck
+		if resp["code"] != tc.code {
+			t.Errorf("%s: code %q want %q", tc.name, resp["code"], tc.code)
+		}
+	}
+
+	// A nonce accepted within the skew stays reserved until the skew ends.
+	if ttl := mr.TTL("nonce:nonce-skew-1"); ttl != time.Second {
+		t.Errorf("nonce TTL: got %v want 1s (expires_at + skew - now)", ttl)
 	}
 }
 
@@ -149,6 +240,49 @@ func TestMiddleware_InvalidSignature(t *testing.T) {
 	}
 }
 
+func TestMiddleware_BadWallet(t *testing.T) {
+	_, _, r := testSetup(t)
+
+	for i, addr := range []string{
+		"not-an-address",
+		"0x1234",
+		"000000000000000000000000000000000000dEaD",   // no 0x prefix
+		"0x000000000000000000000000000000000000DeaD", // mixed case, bad checksum
+	} {
+		req, _ := buildRequest(t, 2*time.Minute, fmt.Sprintf("nonce-badwallet-%d", i))
+		req.Header.Set("X-Wallet-Address", addr)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected 400, got %d: %s", addr, w.Code, w.Body.String())
+		}
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp) //nolint:errcheck
+		if resp["code"] != "BAD_WALLET" {
+			t.Errorf("%q: code: got %q want BAD_WALLET", addr, resp["code"])
+		}
+	}
+}
+
+func TestMiddleware_NormalizesWallet(t *testing.T) {
+	_, _, r := testSetup(t)
+
+	req, wallet := buildRequest(t, 2*time.Minute, "nonce-lower-1")
+	req.Header.Set("X-Wallet-Address", strings.ToLower(wallet))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp) //nolint:errcheck
+	if resp["wallet"] != wallet {
+		t.Errorf("wallet_address: got %q want checksummed %q", resp["wallet"], wallet)
+	}
+}
+
 func TestMiddleware_NonceReplay(t *testing.T) {
 	_, _, r := testSetup(t)
 
@@ -195,3 +329,137 @@ func TestMiddleware_NonceExpires(t *testing.T) {
 	// (We can't send the exact same request again as expires_at would also be expired)
 	t.Log("nonce TTL behaviour verified via miniredis FastForward")
 }
+
+// ── RequireBodyHash ───────────────────────────────────────────────────────────
+
+// buildBodyRequest signs a request whose SignedRequest carries bodyHash and
+// whose HTTP body is body.
+func buildBodyRequest(t *testing.T, nonce, bodyHash, body string) *http.Request {
+	t.Helper()
+	privKey, _ := crypto.GenerateKey()
+	sr := SignedRequest{
+		Action:    "create",
+		BodyHash:  bodyHash,
+		ExpiresAt: time.Now().Add(2 * time.Minute).Unix(),
+		Nonce:     nonce,
+		Payload:   json.RawMessage(`{}`),
+	}
+	msgBytes, _ := json.Marshal(sr)
+	sig, _ := crypto.Sign(HashMessage(msgBytes), privKey)
+	sig[64] += 27
+
+	req := httptest.NewRequest(http.MethodPost, "/body", strings.NewReader(body))
+	req.Header.Set("X-Wallet-Address", crypto.PubkeyToAddress(privKey.PublicKey).Hex())
+	req.Header.Set("X-Signed-Message", base64.StdEncoding.EncodeToString(msgBytes))
+	req.Header.Set("X-Wallet-Signature", "0x"+hex.EncodeToString(sig))
+	return req
+}
+
+func bodyHashEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	_, rdb, r := testSetup(t)
+	r.POST("/body", Middleware(rdb), RequireBodyHash(), func(c *gin.Context) {
+		b, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(b))
+	})
+	return r
+}
+
+func TestRequireBodyHash_Match_BodyStillReadable(t *testing.T) {
+	r := bodyHashEngine(t)
+	body := `{"name":"sb"}`
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, buildBodyRequest(t, "n-bh-1", BodyHash([]byte(body)), body))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != body {
+		t.Errorf("downstream body: got %q want %q", w.Body.String(), body)
+	}
+}
+
+func TestRequireBodyHash_Tampered(t *testing.T) {
+	r := bodyHashEngine(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, buildBodyRequest(t, "n-bh-2", BodyHash([]byte(`{"cpu":1}`)), `{"cpu":64}`))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["code"] != "BODY_TAMPERED" {
+		t.Errorf("code: got %q want BODY_TAMPERED", resp["code"])
+	}
+}
+
+func TestRequireBodyHash_NoHashSigned_PassesThrough(t *testing.T) {
+	r := bodyHashEngine(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, buildBodyRequest(t, "n-bh-3", "", `{"cpu":64}`))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("request signed without body_hash should pass, got %d", w.Code)
+	}
+}
+
+// ── Token auth (WebSocket upgrades) ───────────────────────────────────────────
+
+func TestMiddleware_Token_WebSocketUpgrade(t *testing.T) {
+	mr, rdb, _ := testSetup(t)
+	r := gin.New()
+	mw := MiddlewareWithOptions(rdb, Options{TokenRoutes: []string{"/test"}})
+	echo := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"wallet": c.GetString("wallet_address")}) }
+	r.POST("/test", mw, echo)
+	r.POST("/other", mw, echo)
+	token, _, err := IssueToken(context.Background(), rdb, "0xWALLET", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsReq := func(tok string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/test?token="+tok, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, wsReq(token))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "0xWALLET") {
+		t.Fatalf("valid token: got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, wsReq("bogus"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown token: expected 401, got %d", w.Code)
+	}
+
+	// Tokens are not accepted on plain HTTP requests.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/test?token="+token, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("token on plain request: expected 401, got %d", w.Code)
+	}
+
+	// Nor on upgrades of routes outside TokenRoutes.
+	other := wsReq(token)
+	other.URL.Path = "/other"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, other)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("token on another route: expected 401, got %d", w.Code)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, wsReq(token))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expired token: expected 401, got %d", w.Code)
+	}
+}
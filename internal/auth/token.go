@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenTTL is the lifetime of a token issued by IssueToken.
+const TokenTTL = 15 * time.Minute
+
+const tokenKeyPrefix = "auth:token:"
+
+// ErrInvalidToken is returned by LookupToken for unknown or expired tokens.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// IssueToken creates a short-lived bearer token for wallet. Tokens let clients
+// that cannot set the signed-request headers (browser WebSockets) authenticate
+// as a wallet they already proved ownership of.
+func IssueToken(ctx context.Context, rdb *redis.Client, wallet string, ttl time.Duration) (token string, expiresAt int64, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", 0, err
+	}
+	token = hex.EncodeToString(b)
+	expiresAt = time.Now().Add(ttl).Unix()
+	key := tokenKeyPrefix + token
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, "wallet", wallet, "expires_at", expiresAt)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", 0, err
+	}
+	return token, expiresAt, nil
+}
+
+// LookupToken returns the wallet and expiry of a token issued by IssueToken.
+func LookupToken(ctx context.Context, rdb *redis.Client, token string) (wallet string, expiresAt int64, err error) {
+	return lookupToken(ctx, rdb, token, time.Now())
+}
+
+func lookupToken(ctx context.Context, rdb *redis.Client, token string, now time.Time) (wallet string, expiresAt int64, err error) {
+	if token == "" {
+		return "", 0, ErrInvalidToken
+	}
+	vals, err := rdb.HGetAll(ctx, tokenKeyPrefix+token).Result()
+	if err != nil {
+		return "", 0, err
+	}
+	expiresAt, _ = strconv.ParseInt(vals["expires_at"], 10, 64)
+	if vals["wallet"] == "" || expiresAt <= now.Unix() {
+		return "", 0, ErrInvalidToken
+	}
+	return vals["wallet"], expiresAt, nil
+}
@@ -0,0 +1,59 @@
+package billing
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sweepReading is the time of a generator sweep on the handler's clock (wall)
+// and on the monotonic clock.
+type sweepReading struct {
+	wall, mono time.Time
+}
+
+// SetMaxClockSkew turns on clock-jump detection in the generator: if, between
+// two sweeps of this process, the wall clock moved more than maxSkew further
+// (or less) than the monotonic clock, it jumped (e.g. an NTP step). A sweep
+// that merely runs late (a Redis outage, a stalled or slow sweep) is not a
+// jump, since both clocks advance alike. After a forward jump, due periods
+// skip the jumped span but the time that really elapsed is still billed;
+// after a backward jump nothing is due until the clock passes the prepaid
+// periods again. 0 (the default) turns detection off.
+func (h *EventHandler) SetMaxClockSkew(maxSkew time.Duration) {
+	h.maxClockSkewSec = int64(maxSkew / time.Second)
+}
+
+// detectClockJump compares the wall-clock time since this process's previous
+// sweep with the monotonic time elapsed, records the sweep, and returns how
+// many seconds the clock jumped forward (0 if it did not). The first sweep of
+// a process has nothing to compare with, so a gap across a restart is never
+// a jump.
+func (h *EventHandler) detectClockJump(now time.Time, log *zap.Logger) (forwardSec int64) {
+	if h.maxClockSkewSec <= 0 {
+		return 0
+	}
+	monotonic := h.monotonic
+	if monotonic == nil {
+		monotonic = time.Now
+	}
+	prev := h.lastSweep
+	h.lastSweep = sweepReading{wall: now, mono: monotonic()}
+	if prev.mono.IsZero() {
+		return 0
+	}
+	wall := now.Round(0).Sub(prev.wall.Round(0)) // Round(0) strips the monotonic reading
+	elapsed := h.lastSweep.mono.Sub(prev.mono)
+	drift := int64((wall - elapsed) / time.Second)
+	if drift >= -h.maxClockSkewSec && drift <= h.maxClockSkewSec {
+		return 0
+	}
+	log.Warn("clock_jump",
+		zap.Int64("last_sweep", prev.wall.Unix()),
+		zap.Int64("now", now.Unix()),
+		zap.Duration("elapsed", elapsed),
+		zap.Int64("jump_sec", drift),
+		zap.Int64("max_skew_sec", h.maxClockSkewSec),
+	)
+	return max(drift, 0)
+}
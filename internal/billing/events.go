@@ -2,18 +2,36 @@ package billing
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
+	"net"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
 	"github.com/0gfoundation/0g-sandbox/internal/events"
+	"github.com/0gfoundation/0g-sandbox/internal/metrics"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
+// ErrBillingInitFailed is returned by OnCreate when a new sandbox's opening
+// vouchers could not be queued. A stop has been scheduled for the sandbox so
+// it does not run unbilled.
+var ErrBillingInitFailed = errors.New("billing initialisation failed")
+
+// StopReasonBillingInitFailed is the stop reason OnCreate records.
+const StopReasonBillingInitFailed = settler.StopBillingInitFailed
+
+// createRetryDelays are the pauses between OnCreate's enqueue attempts.
+var createRetryDelays = []time.Duration{100 * time.Millisecond, 400 * time.Millisecond}
+
 // EventHandler handles billing lifecycle events from the proxy layer.
 type EventHandler struct {
 	rdb                 *redis.Client
@@ -22,8 +40,29 @@ type EventHandler struct {
 	pricePerCPUPerSec   *big.Int // per CPU core/sec (0 = use flat rate)
 	pricePerMemGBPerSec *big.Int // per GB memory/sec (0 = use flat rate)
 	createFee           *big.Int
+	createFeeDisabled   bool // no create-fee voucher at all; see SetFeesEnabled
+	computeFeeDisabled  bool // no compute-period vouchers at all; see SetFeesEnabled
 	voucherIntervalSec  int64
+	minIntervalSec      int64 // per-sandbox interval bounds; see SetIntervalBounds
+	maxIntervalSec      int64
 	signer              VoucherSigner
+	receiptLabels       []string        // user label keys echoed into receipts; see SetReceiptLabels
+	trustedWallets      map[string]bool // lowercased; see SetTrustedWallets
+	periodAlignment     string          // PeriodRelative or PeriodWallclock; see SetPeriodAlignment
+	usageHashVersion    int             // voucher.UsageHashV1 or V2; see SetUsageHashVersion
+	clock               clock.Clock
+	scheduleStop        func(ctx context.Context, sandboxID string, reason settler.StopReason) // see SetStopScheduler
+	sessionTTL          time.Duration                                                          // see SetSessionTTL
+	sandboxStates       *sandboxStates                                                         // see SetSandboxCheck
+	feeSource           FeeScheduleSource                                                      // see SetFeeSchedule
+	schedule            atomic.Pointer[feeSchedule]                                            // last on-chain read; see RunFeeSchedule
+	balances            BalanceReader                                                          // see SetLowBalanceWarning
+	warnPeriods         int64
+	maxClockSkewSec     int64            // see SetMaxClockSkew
+	maxPauseSec         int64            // see SetMaxPause
+	maxPausedTotalSec   int64            // see SetMaxPausedTotal
+	lastSweep           sweepReading     // this process's previous generator sweep; see SetMaxClockSkew
+	monotonic           func() time.Time // monotonic clock for detectClockJump; time.Now if nil
 	log                 *zap.Logger
 }
 
@@ -34,6 +73,20 @@ type VoucherSigner interface {
 	Enqueue(ctx context.Context, v *voucher.SandboxVoucher) error
 }
 
+// BatchEnqueuer is an optional VoucherSigner extension that queues several
+// vouchers in one Redis round trip, in order (see Signer.EnqueueBatch). With
+// it, the generator queues each sweep's vouchers at once.
+type BatchEnqueuer interface {
+	EnqueueBatch(ctx context.Context, vs []*voucher.SandboxVoucher) error
+}
+
+// OpenEnqueuer is an optional VoucherSigner extension that queues a sweep's
+// vouchers in one atomic step, each only while its session still exists (see
+// Signer.EnqueueOpen). The generator prefers it to BatchEnqueuer.
+type OpenEnqueuer interface {
+	EnqueueOpen(ctx context.Context, vs []*voucher.SandboxVoucher) (queued []bool, err error)
+}
+
 func NewEventHandler(
 	rdb *redis.Client,
 	providerAddress string,
@@ -54,81 +107,252 @@ func NewEventHandler(
 		createFee:           createFee,
 		voucherIntervalSec:  voucherIntervalSec,
 		signer:              signer,
+		clock:               clock.Real{},
 		log:                 log,
 	}
 }
 
+// SetClock replaces the real clock used for session timestamps and period
+// boundaries, here and in RunGenerator. A nil clock restores the real one.
+func (h *EventHandler) SetClock(c clock.Clock) {
+	h.clock = clock.OrReal(c)
+}
+
+// SetFeesEnabled turns the create fee and the compute fee on or off
+// independently. A disabled fee emits no voucher at all, so it costs no nonce
+// or settlement gas; an enabled create fee of zero still emits a zero-value
+// create voucher. Both are enabled by default.
+func (h *EventHandler) SetFeesEnabled(createFee, computeFee bool) {
+	h.createFeeDisabled = !createFee
+	h.computeFeeDisabled = !computeFee
+	if !createFee {
+		h.createFee = new(big.Int)
+	}
+}
+
+// SetUsageHashVersion selects the usageHash schema of new vouchers
+// (voucher.UsageHashV1 by default; V2 also commits to the fee).
+func (h *EventHandler) SetUsageHashVersion(v int) {
+	h.usageHashVersion = v
+}
+
+// SetMaxPause caps how long billing may stay paused: the generator resumes a
+// session paused for longer, charging from then on, so a paused sandbox cannot
+// run for free indefinitely. 0 (the default) = no limit.
+func (h *EventHandler) SetMaxPause(d time.Duration) {
+	h.maxPauseSec = int64(d / time.Second)
+}
+
+// SetMaxPausedTotal caps a session's PausedSec, the paused time it has left
+// unbilled in all: the generator resumes a session whose pause reaches the
+// cap, and PauseBilling refuses one already there, so repeated pauses cannot
+// add up to free compute either. 0 (the default) = no limit.
+func (h *EventHandler) SetMaxPausedTotal(d time.Duration) {
+	h.maxPausedTotalSec = int64(d / time.Second)
+}
+
+// SetStopScheduler sets how OnCreate stops a sandbox whose billing could not
+// be initialised. Without one, OnCreate only records stop:sandbox:{id}, which
+// the stop handler picks up on its next start.
+func (h *EventHandler) SetStopScheduler(fn func(ctx context.Context, sandboxID string, reason settler.StopReason)) {
+	h.scheduleStop = fn
+}
+
+// SetSessionTTL gives billing sessions a sliding TTL, refreshed with every
+// compute voucher, so a session whose stop, delete or archive event was missed
+// eventually expires instead of being billed forever. It must exceed the
+// voucher interval. A paused session does not expire. 0 (the default) = none.
+func (h *EventHandler) SetSessionTTL(ttl time.Duration) {
+	h.sessionTTL = ttl
+}
+
+// touchSession restarts the session's TTL (see SetSessionTTL). A paused
+// session is left without one.
+func (h *EventHandler) touchSession(ctx context.Context, sandboxID string) {
+	if h.sessionTTL <= 0 {
+		return
+	}
+	if err := TouchSession(ctx, h.rdb, sandboxID, h.sessionTTL); err != nil {
+		h.log.Warn("refresh session TTL", zap.String("sandbox", sandboxID), zap.Error(err))
+	}
+}
+
 // computePrice returns the per-second billing rate for a sandbox with the given
-// resources. If per-resource pricing is configured (either unit price > 0),
-// uses cpu*pricePerCPU + mem*pricePerMem; otherwise falls back to the flat rate.
-func (h *EventHandler) computePrice(cpu, memGB int) *big.Int {
-	if h.pricePerCPUPerSec.Sign() > 0 || h.pricePerMemGBPerSec.Sign() > 0 {
+// resources under sched. If per-resource pricing is configured (either unit
+// price > 0), uses cpu*pricePerCPU + mem*pricePerMem; otherwise falls back to
+// the flat rate.
+func (h *EventHandler) computePrice(sched feeSchedule, cpu, memGB int) *big.Int {
+	if h.computeFeeDisabled {
+		return new(big.Int)
+	}
+	if sched.cpuPerSec.Sign() > 0 || sched.memGBPerSec.Sign() > 0 {
 		p := new(big.Int)
-		p.Add(p, new(big.Int).Mul(big.NewInt(int64(cpu)), h.pricePerCPUPerSec))
-		p.Add(p, new(big.Int).Mul(big.NewInt(int64(memGB)), h.pricePerMemGBPerSec))
+		p.Add(p, new(big.Int).Mul(big.NewInt(int64(cpu)), sched.cpuPerSec))
+		p.Add(p, new(big.Int).Mul(big.NewInt(int64(memGB)), sched.memGBPerSec))
 		return p
 	}
 	return new(big.Int).Set(h.computePricePerSec)
 }
 
-// emitPeriodVoucher signs and enqueues a pre-charge voucher covering one full
-// voucherIntervalSec window starting at periodStart. Returns the next
-// NextVoucherAt value (periodStart + voucherIntervalSec).
-func (h *EventHandler) emitPeriodVoucher(ctx context.Context, sandboxID, ownerAddr string, price *big.Int, periodStart int64) (int64, error) {
-	nextVoucherAt := periodStart + h.voucherIntervalSec
-	fee := new(big.Int).Mul(price, big.NewInt(h.voucherIntervalSec))
-	if fee.Sign() == 0 {
-		return nextVoucherAt, nil
+// emitPeriodVoucher signs and enqueues a pre-charge voucher covering the
+// period of intervalSec (0 = global) starting at periodStart (see periodEnd),
+// clamped to the lifetime of the session opened at sessionStart (see
+// clampPeriod). Returns the next NextVoucherAt value (the period's end) and
+// the fee charged. No voucher is emitted for a zero fee or while the compute
+// fee is disabled.
+func (h *EventHandler) emitPeriodVoucher(ctx context.Context, sandboxID, ownerAddr string, price *big.Int, sessionStart, periodStart, intervalSec int64, labels map[string]string) (int64, *big.Int, error) {
+	v, nextVoucherAt, fee, err := h.periodVoucher(sandboxID, ownerAddr, price, sessionStart, periodStart, intervalSec, labels)
+	if err != nil {
+		return 0, nil, err
 	}
-	v := &voucher.SandboxVoucher{
-		SandboxID: sandboxID,
-		User:      common.HexToAddress(ownerAddr),
-		Provider:  common.HexToAddress(h.providerAddress),
-		TotalFee:  fee,
-		UsageHash: voucher.BuildUsageHash(sandboxID, periodStart, nextVoucherAt, h.voucherIntervalSec),
+	if v != nil {
+		if err := h.signer.Enqueue(ctx, v); err != nil {
+			return 0, nil, err
+		}
+	}
+	return nextVoucherAt, fee, nil
+}
+
+// periodVoucher builds the voucher emitPeriodVoucher enqueues, nil when there
+// is nothing to charge, along with the next NextVoucherAt value and the fee.
+func (h *EventHandler) periodVoucher(sandboxID, ownerAddr string, price *big.Int, sessionStart, periodStart, intervalSec int64, labels map[string]string) (*voucher.SandboxVoucher, int64, *big.Int, error) {
+	periodStart, nextVoucherAt := h.clampPeriod(sandboxID, sessionStart, periodStart, h.periodEnd(periodStart, intervalSec))
+	v, fee, err := h.usageVoucher(sandboxID, ownerAddr, price, periodStart, nextVoucherAt, labels)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return v, nextVoucherAt, fee, nil
+}
+
+// emitUsageVoucher signs and enqueues a compute voucher for [start, end) at
+// price and returns the fee charged; see emitPeriodVoucher.
+func (h *EventHandler) emitUsageVoucher(ctx context.Context, sandboxID, ownerAddr string, price *big.Int, start, end int64, labels map[string]string) (*big.Int, error) {
+	v, fee, err := h.usageVoucher(sandboxID, ownerAddr, price, start, end, labels)
+	if err != nil || v == nil {
+		return fee, err
 	}
 	if err := h.signer.Enqueue(ctx, v); err != nil {
-		return 0, err
+		return nil, err
 	}
-	return nextVoucherAt, nil
+	return fee, nil
 }
 
-// OnCreate handles POST /sandbox success: emit createFee voucher, pre-charge
-// the first compute period, and open the billing session.
-// cpu and memGB are the sandbox's allocated resources used to compute billing rate.
-func (h *EventHandler) OnCreate(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int) {
-	now := time.Now().Unix()
-	v := &voucher.SandboxVoucher{
+// usageVoucher builds the compute voucher for [start, end) at price and
+// returns it with the fee, or a nil voucher and a zero fee when there is
+// nothing to charge.
+func (h *EventHandler) usageVoucher(sandboxID, ownerAddr string, price *big.Int, start, end int64, labels map[string]string) (*voucher.SandboxVoucher, *big.Int, error) {
+	length := end - start
+	usage := voucher.UsageBreakdown{
+		PeriodStart: start,
+		PeriodEnd:   end,
+		UsageUnits:  length,
+		Rate:        new(big.Int).Set(price),
+		Version:     h.usageHashVersion,
+	}
+	// A corrupted session time must not turn into a huge (or negative) fee.
+	if err := usage.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("sandbox %s: %w", sandboxID, err)
+	}
+	fee := new(big.Int).Mul(price, big.NewInt(length))
+	if fee.Sign() <= 0 || h.computeFeeDisabled {
+		// Nothing to charge (a zero rate, or a period clamped to no time): a
+		// voucher would only spend a nonce and gas. Callers still advance the
+		// session, so the period is not billed later.
+		return nil, new(big.Int), nil
+	}
+	return &voucher.SandboxVoucher{
 		SandboxID: sandboxID,
 		User:      common.HexToAddress(ownerAddr),
 		Provider:  common.HexToAddress(h.providerAddress),
-		TotalFee:  new(big.Int).Set(h.createFee),
-		UsageHash: voucher.BuildUsageHash(sandboxID, now, now, 0),
+		TotalFee:  fee,
+		UsageHash: usage.Hash(sandboxID),
+		Usage:     &usage,
+		Labels:    labels,
+	}, fee, nil
+}
+
+// OnCreate handles POST /sandbox success: emit createFee voucher, pre-charge
+// the first compute period (each unless disabled; see SetFeesEnabled), and
+// open the billing session.
+// cpu and memGB are the sandbox's allocated resources used to compute billing rate.
+// labels are the sandbox's user labels; the configured subset is echoed into
+// the session and its receipts, and IntervalLabel sets the session's voucher
+// interval (see SetIntervalBounds). A trusted wallet's sandbox labelled
+// BillingLabel=BillingDisabled is not billed at all (see SetTrustedWallets).
+//
+// Both vouchers are queued together or not at all (see enqueueOpening), with
+// retries while a failure shows nothing was written (see retryCreate). If
+// they still cannot be queued, a billing_init_failed stop is scheduled for
+// the sandbox and ErrBillingInitFailed is returned; the caller's balance
+// reservation is left for the caller to release.
+func (h *EventHandler) OnCreate(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int, labels map[string]string) error {
+	if h.unbilled(sandboxID, ownerAddr, labels) {
+		h.log.Info("sandbox not billed", zap.String("sandbox", sandboxID), zap.String("owner", ownerAddr))
+		h.releaseUnbilled(ctx, ownerAddr, h.createFee, cpu, memGB, labels)
+		return nil
 	}
-	if err := h.signer.Enqueue(ctx, v); err != nil {
-		h.log.Error("OnCreate: enqueue create-fee", zap.String("sandbox", sandboxID), zap.Error(err))
-		return
+	now := h.clock.Now().Unix()
+	echo := h.echoLabels(labels)
+	usage := voucher.UsageBreakdown{
+		PeriodStart: now,
+		PeriodEnd:   now,
+		CreateFee:   new(big.Int).Set(h.createFee),
+		Version:     h.usageHashVersion,
+	}
+	var opening []*voucher.SandboxVoucher
+	if !h.createFeeDisabled {
+		if err := usage.Validate(); err != nil {
+			h.log.Error("OnCreate: create-fee usage", zap.String("sandbox", sandboxID), zap.Error(err))
+			return h.failCreate(ctx, sandboxID, err)
+		}
+		opening = append(opening, &voucher.SandboxVoucher{
+			SandboxID: sandboxID,
+			User:      common.HexToAddress(ownerAddr),
+			Provider:  common.HexToAddress(h.providerAddress),
+			TotalFee:  new(big.Int).Set(h.createFee),
+			UsageHash: usage.Hash(sandboxID),
+			Usage:     &usage,
+			Labels:    echo,
+		})
 	}
 
-	price := h.computePrice(cpu, memGB)
-	nextVoucherAt, err := h.emitPeriodVoucher(ctx, sandboxID, ownerAddr, price, now)
+	sched := h.currentSchedule()
+	price := h.computePrice(sched, cpu, memGB)
+	intervalSec := h.labelInterval(labels)
+	period, nextVoucherAt, periodFee, err := h.periodVoucher(sandboxID, ownerAddr, price, now, now, intervalSec, echo)
 	if err != nil {
-		h.log.Error("OnCreate: emit first period", zap.String("sandbox", sandboxID), zap.Error(err))
-		return
+		h.log.Error("OnCreate: first period", zap.String("sandbox", sandboxID), zap.Error(err))
+		return h.failCreate(ctx, sandboxID, err)
+	}
+	if period != nil {
+		opening = append(opening, period)
+	}
+	if err := h.enqueueOpening(ctx, opening); err != nil {
+		h.log.Error("OnCreate: enqueue opening vouchers", zap.String("sandbox", sandboxID), zap.Error(err))
+		return h.failCreate(ctx, sandboxID, err)
 	}
 
+	totalUpfront := new(big.Int).Add(h.createFee, periodFee)
 	s := Session{
 		SandboxID:     sandboxID,
 		Owner:         ownerAddr,
 		Provider:      h.providerAddress,
 		NextVoucherAt: nextVoucherAt,
 		PricePerSec:   price.String(),
+		RateCPUPerSec: sched.cpuPerSec.String(),
+		RateMemPerSec: sched.memGBPerSec.String(),
+		SignerVersion: sched.signerVersion,
+		StartedAt:     now,
+		LastVoucherAt: now,
+		AccruedFee:    totalUpfront.String(),
+		Labels:        echo,
+		IntervalSec:   intervalSec,
 	}
 	if err := CreateSession(ctx, h.rdb, s); err != nil {
 		h.log.Error("OnCreate: create session", zap.String("sandbox", sandboxID), zap.Error(err))
+	} else {
+		h.touchSession(ctx, sandboxID)
 	}
-	periodFee := new(big.Int).Mul(price, big.NewInt(h.voucherIntervalSec))
-	totalUpfront := new(big.Int).Add(h.createFee, periodFee)
 	Release(ctx, h.rdb, ownerAddr, h.providerAddress, totalUpfront)
 	_ = events.Push(ctx, h.rdb, events.Event{
 		Type:      events.TypeCreated,
@@ -137,24 +361,106 @@ func (h *EventHandler) OnCreate(ctx context.Context, sandboxID, ownerAddr string
 		User:      ownerAddr,
 		Amount:    totalUpfront.String(),
 	})
+	h.audit(ctx, sandboxID, settler.AuditEntry{Event: settler.AuditCreated, At: now, Fee: totalUpfront.String()})
+	return nil
+}
+
+// audit appends e to the sandbox's audit timeline and counts the applied
+// lifecycle event.
+func (h *EventHandler) audit(ctx context.Context, sandboxID string, e settler.AuditEntry) {
+	metrics.LifecycleEvents.WithLabelValues(e.Event, metrics.OutcomeApplied).Inc()
+	settler.AppendAudit(ctx, h.rdb, sandboxID, e)
+}
+
+// releaseUnbilled releases the balance the proxy reserved for an unbilled
+// sandbox's opening charges: createFee plus the first compute period.
+func (h *EventHandler) releaseUnbilled(ctx context.Context, ownerAddr string, createFee *big.Int, cpu, memGB int, labels map[string]string) {
+	now := h.clock.Now().Unix()
+	price := h.computePrice(h.currentSchedule(), cpu, memGB)
+	fee := new(big.Int).Mul(price, big.NewInt(h.periodEnd(now, h.labelInterval(labels))-now))
+	Release(ctx, h.rdb, ownerAddr, h.providerAddress, fee.Add(fee, createFee))
+}
+
+// enqueueOpening queues OnCreate's vouchers, retrying as retryCreate allows.
+// A signer that supports it gets one EnqueueBatch, so the create fee is never
+// charged for a sandbox whose first period could not be queued; others get
+// them one at a time.
+func (h *EventHandler) enqueueOpening(ctx context.Context, vs []*voucher.SandboxVoucher) error {
+	if batcher, ok := h.signer.(BatchEnqueuer); ok {
+		return retryCreate(ctx, func() error { return batcher.EnqueueBatch(ctx, vs) })
+	}
+	for _, v := range vs {
+		if err := retryCreate(ctx, func() error { return h.signer.Enqueue(ctx, v) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryCreate runs fn, retrying after each of createRetryDelays while its
+// error shows nothing was written (see enqueueNotSent): enqueueing is not
+// idempotent, so an error that may follow a successful write (e.g. a timeout
+// waiting for the reply) is not retried lest a voucher be queued twice.
+func retryCreate(ctx context.Context, fn func() error) error {
+	err := fn()
+	for _, d := range createRetryDelays {
+		if err == nil || ctx.Err() != nil || !enqueueNotSent(err) {
+			break
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+		t.Stop()
+		err = fn()
+	}
+	return err
+}
+
+// enqueueNotSent reports whether an enqueue error means the command never
+// reached Redis: the connection could not be established.
+func enqueueNotSent(err error) bool {
+	var op *net.OpError
+	return errors.Is(err, syscall.ECONNREFUSED) || (errors.As(err, &op) && op.Op == "dial")
+}
+
+// failCreate schedules a stop for a sandbox whose billing could not be
+// initialised and returns the error OnCreate reports.
+func (h *EventHandler) failCreate(ctx context.Context, sandboxID string, cause error) error {
+	if h.scheduleStop != nil {
+		h.scheduleStop(ctx, sandboxID, StopReasonBillingInitFailed)
+	} else if err := h.rdb.Set(ctx, settler.StopKey(sandboxID), string(StopReasonBillingInitFailed), 0).Err(); err != nil {
+		h.log.Error("OnCreate: schedule stop", zap.String("sandbox", sandboxID), zap.Error(err))
+	}
+	return fmt.Errorf("%w: %v", ErrBillingInitFailed, cause)
 }
 
 // OnStart handles POST /sandbox/:id/start success: create billing session if
 // none exists (idempotent — OnCreate already opens a session on initial start).
 // Pre-charges the first compute period, same as OnCreate.
-// cpu and memGB are the sandbox's allocated resources used to compute billing rate.
-func (h *EventHandler) OnStart(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int) {
+// cpu, memGB and labels are as for OnCreate.
+func (h *EventHandler) OnStart(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int, labels map[string]string) {
 	existing, err := GetSession(ctx, h.rdb, sandboxID)
 	if err != nil {
 		h.log.Error("OnStart: get session", zap.String("sandbox", sandboxID), zap.Error(err))
 		return
 	}
 	if existing != nil {
-		return // session already open (created by OnCreate or a previous start)
+		// Session already open (created by OnCreate or a previous start).
+		metrics.LifecycleEvents.WithLabelValues(settler.AuditStarted, metrics.OutcomeDuplicate).Inc()
+		return
+	}
+	if h.unbilled(sandboxID, ownerAddr, labels) {
+		h.releaseUnbilled(ctx, ownerAddr, new(big.Int), cpu, memGB, labels)
+		return
 	}
-	price := h.computePrice(cpu, memGB)
-	now := time.Now().Unix()
-	nextVoucherAt, err := h.emitPeriodVoucher(ctx, sandboxID, ownerAddr, price, now)
+	sched := h.currentSchedule()
+	price := h.computePrice(sched, cpu, memGB)
+	intervalSec := h.labelInterval(labels)
+	now := h.clock.Now().Unix()
+	echo := h.echoLabels(labels)
+	nextVoucherAt, periodFee, err := h.emitPeriodVoucher(ctx, sandboxID, ownerAddr, price, now, now, intervalSec, echo)
 	if err != nil {
 		h.log.Error("OnStart: emit first period", zap.String("sandbox", sandboxID), zap.Error(err))
 		return
@@ -165,32 +471,177 @@ func (h *EventHandler) OnStart(ctx context.Context, sandboxID, ownerAddr string,
 		Provider:      h.providerAddress,
 		NextVoucherAt: nextVoucherAt,
 		PricePerSec:   price.String(),
+		RateCPUPerSec: sched.cpuPerSec.String(),
+		RateMemPerSec: sched.memGBPerSec.String(),
+		SignerVersion: sched.signerVersion,
+		StartedAt:     now,
+		LastVoucherAt: now,
+		AccruedFee:    periodFee.String(),
+		Labels:        echo,
+		IntervalSec:   intervalSec,
 	}
 	if err := CreateSession(ctx, h.rdb, s); err != nil {
 		h.log.Error("OnStart: create session", zap.String("sandbox", sandboxID), zap.Error(err))
+	} else {
+		h.touchSession(ctx, sandboxID)
 	}
-	periodFee := new(big.Int).Mul(price, big.NewInt(h.voucherIntervalSec))
 	Release(ctx, h.rdb, ownerAddr, h.providerAddress, periodFee)
+	h.audit(ctx, sandboxID, settler.AuditEntry{Event: settler.AuditStarted, At: now, Fee: periodFee.String()})
 }
 
 // OnStop handles POST /sandbox/:id/stop success: delete billing session.
-// No final voucher is emitted — the current period was already pre-charged.
+// No final voucher is emitted — the current period, including a trailing
+// partial one under wall-clock alignment, was already pre-charged, and no
+// period is charged for time spent paused.
 func (h *EventHandler) OnStop(ctx context.Context, sandboxID string) {
-	if err := DeleteSession(ctx, h.rdb, sandboxID); err != nil {
-		h.log.Warn("OnStop: delete session", zap.String("sandbox", sandboxID), zap.Error(err))
+	h.closeSession(ctx, sandboxID, settler.AuditStopped, "")
+}
+
+// closeSession ends billing for a stopped, deleted or archived sandbox and
+// reports whether it closed the session. how names the audit event to record
+// and lifetimeCost, if set, is recorded with it.
+//
+// Stop, delete and archive may race (e.g. a stop quickly followed by a
+// delete). Only the call that removes the session records the stopped event
+// and the audit entry; the others do nothing and are counted as duplicates.
+func (h *EventHandler) closeSession(ctx context.Context, sandboxID, how, lifetimeCost string) bool {
+	s, err := CloseSession(ctx, h.rdb, sandboxID)
+	if err != nil {
+		h.log.Warn("close session", zap.String("sandbox", sandboxID), zap.String("how", how), zap.Error(err))
+		return false
+	}
+	if s == nil {
+		metrics.LifecycleEvents.WithLabelValues(how, metrics.OutcomeDuplicate).Inc()
+		return false
 	}
+	h.audit(ctx, sandboxID, settler.AuditEntry{Event: how, At: h.clock.Now().Unix(), Fee: s.AccruedFee, LifetimeCost: lifetimeCost})
+	_ = events.Push(ctx, h.rdb, events.Event{
+		Type:      events.TypeStopped,
+		Message:   fmt.Sprintf("Sandbox %s %s, %s neuron charged in session", sandboxID, how, s.AccruedFee),
+		SandboxID: sandboxID,
+		User:      s.Owner,
+		Amount:    s.AccruedFee,
+	})
+	return true
 }
 
-// OnDelete handles DELETE /sandbox/:id success.
+// PauseBilling stops pre-charging compute periods for a running sandbox until
+// ResumeBilling, or until the generator resumes it after SetMaxPause or
+// SetMaxPausedTotal. The sandbox keeps running. The period already
+// pre-charged is not refunded; paused time past its end is never billed.
+// Pausing a paused session is a no-op. Returns ErrNoSession if billing is not
+// open, ErrPauseLimit if the session has used up SetMaxPausedTotal.
+func (h *EventHandler) PauseBilling(ctx context.Context, sandboxID string) error {
+	paused, err := PauseSession(ctx, h.rdb, sandboxID, h.clock.Now().Unix(), h.maxPausedTotalSec)
+	if err != nil {
+		return err
+	}
+	if paused {
+		h.log.Info("billing paused", zap.String("sandbox", sandboxID))
+	}
+	return nil
+}
+
+// ResumeBilling resumes a paused session. If the pre-charged period ran out
+// while paused, a new period starting now is charged at once, so the gap
+// between the end of the paid period and now is not billed, and is added to
+// the session's PausedSec. Resuming an unpaused session is a no-op. Returns
+// ErrNoSession if billing is not open.
+//
+// The resume is claimed first: one transaction clears paused_at and moves the
+// session past the new period, so of two concurrent calls only the one that
+// cleared the pause charges, and the generator never finds the session due in
+// between. If the voucher then cannot be queued the claim is undone.
+func (h *EventHandler) ResumeBilling(ctx context.Context, sandboxID string) error {
+	now := h.clock.Now().Unix()
+	var (
+		prior         *Session // the session as this call found it paused
+		v             *voucher.SandboxVoucher
+		nextVoucherAt int64
+		unbilled      int64
+		buildErr      error
+	)
+	err := updateSession(ctx, h.rdb, sandboxID, func(s *Session) []any {
+		prior, v, unbilled, buildErr = nil, nil, 0, nil
+		if s.PausedAt == 0 {
+			return nil
+		}
+		fields := []any{"paused_at", 0}
+		if now >= s.NextVoucherAt {
+			var next int64
+			var fee *big.Int
+			v, next, fee, buildErr = h.periodVoucher(sandboxID, s.Owner, h.sessionPrice(s), s.StartedAt, now, s.IntervalSec, s.Labels)
+			if buildErr != nil {
+				return nil
+			}
+			unbilled = now - max(s.PausedAt, s.NextVoucherAt)
+			nextVoucherAt = max(s.NextVoucherAt, next)
+			fields = append(fields,
+				"next_voucher_at", nextVoucherAt,
+				"last_voucher_at", max(s.LastVoucherAt, now),
+				"accrued_fee", addFee(s.AccruedFee, fee),
+				"paused_sec", s.PausedSec+unbilled,
+			)
+		}
+		prior = s
+		return fields
+	})
+	if err != nil {
+		return err
+	}
+	if buildErr != nil {
+		return fmt.Errorf("charge resumed period: %w", buildErr)
+	}
+	if prior == nil {
+		return nil // not paused, or resumed by a concurrent call
+	}
+	if v != nil {
+		if err := h.signer.Enqueue(ctx, v); err != nil {
+			h.undoResume(ctx, prior, nextVoucherAt)
+			return fmt.Errorf("charge resumed period: %w", err)
+		}
+	}
+	h.touchSession(ctx, sandboxID)
+	h.log.Info("billing resumed", zap.String("sandbox", sandboxID), zap.Int64("unbilled_sec", unbilled))
+	return nil
+}
+
+// undoResume pauses a session again after ResumeBilling claimed it but could
+// not queue the resumed period's voucher, restoring the fields the claim
+// moved. A session paused again or advanced since is left alone.
+func (h *EventHandler) undoResume(ctx context.Context, prior *Session, nextVoucherAt int64) {
+	err := updateSession(ctx, h.rdb, prior.SandboxID, func(s *Session) []any {
+		if s.PausedAt != 0 || s.NextVoucherAt != nextVoucherAt {
+			return nil
+		}
+		return []any{
+			"paused_at", prior.PausedAt,
+			"next_voucher_at", prior.NextVoucherAt,
+			"last_voucher_at", prior.LastVoucherAt,
+			"accrued_fee", prior.AccruedFee,
+			"paused_sec", prior.PausedSec,
+		}
+	})
+	if err != nil && !errors.Is(err, ErrNoSession) {
+		h.log.Error("undo resume", zap.String("sandbox", prior.SandboxID), zap.Error(err))
+	}
+}
+
+// OnDelete handles DELETE /sandbox/:id success. The sandbox's lifetime cost
+// is snapshotted into the deleted audit entry and then expires with its
+// receipts. A sandbox already stopped or archived has no session left to
+// close, so its first delete still writes a deleted entry, with no fee.
 func (h *EventHandler) OnDelete(ctx context.Context, sandboxID string) {
-	if err := DeleteSession(ctx, h.rdb, sandboxID); err != nil {
-		h.log.Warn("OnDelete: delete session", zap.String("sandbox", sandboxID), zap.Error(err))
+	cost, first := settler.ExpireSandboxCost(ctx, h.rdb, sandboxID)
+	if h.closeSession(ctx, sandboxID, settler.AuditDeleted, cost) || !first {
+		return
 	}
+	settler.AppendAudit(ctx, h.rdb, sandboxID, settler.AuditEntry{Event: settler.AuditDeleted, At: h.clock.Now().Unix(), LifetimeCost: cost})
 }
 
 // OnArchive handles POST /sandbox/:id/archive success.
 func (h *EventHandler) OnArchive(ctx context.Context, sandboxID string) {
-	h.OnDelete(ctx, sandboxID)
+	h.closeSession(ctx, sandboxID, settler.AuditArchived, "")
 }
 
 // EnsureSession is idempotent: if a billing session already exists for this
@@ -206,5 +657,7 @@ func (h *EventHandler) EnsureSession(ctx context.Context, sandboxID, ownerAddr s
 	if existing != nil {
 		return // already billed
 	}
-	h.OnCreate(ctx, sandboxID, ownerAddr, 0, 0) // resources unknown at recovery; uses flat rate
+	// Resources and labels are unknown at recovery; uses flat rate. A failure
+	// is logged and has scheduled a stop.
+	_ = h.OnCreate(ctx, sandboxID, ownerAddr, 0, 0, nil)
 }
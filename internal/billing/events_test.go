@@ -3,13 +3,25 @@ package billing
 import (
 	"context"
 	"errors"
+	"maps"
 	"math/big"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+	"github.com/0gfoundation/0g-sandbox/internal/metrics"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
@@ -87,7 +99,7 @@ func TestOnCreate_EmitsTwoVouchers(t *testing.T) {
 	ctx := context.Background()
 
 	before := time.Now().Unix()
-	h.OnCreate(ctx, testSandbox, testOwner, 1, 1)
+	h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil)
 	after := time.Now().Unix()
 
 	if ms.count() != 2 {
@@ -123,12 +135,303 @@ func TestOnCreate_EmitsTwoVouchers(t *testing.T) {
 	}
 }
 
+// Every voucher carries fee inputs that reproduce its TotalFee, under both
+// usageHash schemas.
+func TestOnCreate_VouchersCarryFeeBreakdown(t *testing.T) {
+	for _, ver := range []int{voucher.UsageHashV1, voucher.UsageHashV2} {
+		ms := &mockSigner{}
+		h, _ := newTestHandler(t, ms)
+		h.SetUsageHashVersion(ver)
+		if err := h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil); err != nil {
+			t.Fatalf("v%d OnCreate: %v", ver, err)
+		}
+		for i, v := range ms.vouchers {
+			if !v.FeeMatches() || !v.UsageHashMatches() {
+				t.Errorf("v%d voucher[%d]: fee %s vs breakdown %+v does not verify", ver, i, v.TotalFee, v.Usage)
+			}
+		}
+		if ver == voucher.UsageHashV2 {
+			v := ms.vouchers[1]
+			if v.UsageHash == voucher.BuildUsageHash(testSandbox, v.Usage.PeriodStart, v.Usage.PeriodEnd, v.Usage.UsageUnits) {
+				t.Error("V2 usageHash must differ from the V1 hash")
+			}
+		}
+	}
+}
+
+// ── Fees disabled independently ──────────────────────────────────────────────
+
+func TestOnCreate_CreateFeeDisabled_OnlyPeriodVoucher(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	h.SetFeesEnabled(false, true)
+
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+
+	if ms.count() != 1 {
+		t.Fatalf("expected only the first-period voucher, got %d", ms.count())
+	}
+	if fee := ms.last().TotalFee.Int64(); fee != testIntervalSec*pricePerSec {
+		t.Errorf("period fee: got %d want %d", fee, testIntervalSec*pricePerSec)
+	}
+	if sess, _ := get(testSandbox); sess == nil || sess.AccruedFee != strconv.FormatInt(testIntervalSec*pricePerSec, 10) {
+		t.Errorf("session: got %+v", sess)
+	}
+}
+
+func TestComputeFeeDisabled_NoComputeVouchers(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	h.SetFeesEnabled(true, false)
+	ctx := context.Background()
+
+	h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+	if ms.count() != 1 || ms.last().TotalFee.Int64() != createFeeVal {
+		t.Fatalf("expected only the create-fee voucher, got %d", ms.count())
+	}
+
+	// Periods still advance, but nothing is charged for them.
+	UpdateNextVoucherAt(ctx, h.rdb, testSandbox, time.Now().Unix()-1) //nolint:errcheck
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	h.OnStart(ctx, "sb-started", testOwner, 1, 1, nil)
+	if ms.count() != 1 {
+		t.Errorf("compute vouchers emitted while disabled: total %d", ms.count())
+	}
+	if sess, _ := get(testSandbox); sess.NextVoucherAt <= time.Now().Unix() {
+		t.Errorf("NextVoucherAt not advanced: %d", sess.NextVoucherAt)
+	}
+}
+
+func TestOnCreate_ZeroCreateFeeEnabled_StillEmitsVoucher(t *testing.T) {
+	ms := &mockSigner{}
+	rdb, _ := newTestRedis(t)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), new(big.Int), new(big.Int), new(big.Int), testIntervalSec, ms, zap.NewNop())
+
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+
+	if ms.count() != 2 || ms.vouchers[0].TotalFee.Sign() != 0 {
+		t.Errorf("expected a zero-value create voucher plus the period voucher, got %d vouchers", ms.count())
+	}
+}
+
+func TestOnCreate_ZeroRate_OnlyCreateFeeVoucher(t *testing.T) {
+	ms := &mockSigner{}
+	rdb, _ := newTestRedis(t)
+	h := NewEventHandler(rdb, testProvider, new(big.Int), big.NewInt(createFeeVal), new(big.Int), new(big.Int), testIntervalSec, ms, zap.NewNop())
+
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+
+	if ms.count() != 1 || ms.last().TotalFee.Int64() != createFeeVal {
+		t.Fatalf("expected only the create-fee voucher, got %d vouchers", ms.count())
+	}
+	sess, _ := GetSession(context.Background(), rdb, testSandbox)
+	if sess == nil || sess.NextVoucherAt <= sess.StartedAt || sess.AccruedFee != strconv.FormatInt(createFeeVal, 10) {
+		t.Errorf("session: got %+v", sess)
+	}
+}
+
 func TestOnCreate_SignEnqueueError_NoSessionCreated(t *testing.T) {
+	fastCreateRetries(t)
 	ms := &mockSigner{enqErr: errors.New("redis down")}
-	h, _ := newTestHandler(t, ms)
+	h, get := newTestHandler(t, ms)
 
 	// Should not panic
-	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1)
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+	if sess, _ := get(testSandbox); sess != nil {
+		t.Errorf("expected no session, got %+v", sess)
+	}
+}
+
+func TestOnCreate_EnqueueError_SchedulesStop(t *testing.T) {
+	fastCreateRetries(t)
+
+	ms := &mockSigner{enqErr: errors.New("redis down")}
+	h, _ := newTestHandler(t, ms)
+	ctx := context.Background()
+
+	err := h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil)
+	if !errors.Is(err, ErrBillingInitFailed) {
+		t.Fatalf("OnCreate error: got %v want ErrBillingInitFailed", err)
+	}
+	// Without a scheduler the stop is recorded for the stop handler.
+	if reason := h.rdb.Get(ctx, "stop:sandbox:"+testSandbox).Val(); reason != string(StopReasonBillingInitFailed) {
+		t.Errorf("stop reason: got %q want %q", reason, StopReasonBillingInitFailed)
+	}
+
+	var stopped []string
+	h.SetStopScheduler(func(_ context.Context, id string, reason settler.StopReason) {
+		stopped = append(stopped, id+":"+string(reason))
+	})
+	h.OnCreate(ctx, "sb-2", testOwner, 1, 1, nil) //nolint:errcheck
+	if len(stopped) != 1 || stopped[0] != "sb-2:"+string(StopReasonBillingInitFailed) {
+		t.Errorf("scheduled stops: got %v", stopped)
+	}
+}
+
+func TestOnCreate_RetriesTransientEnqueueError(t *testing.T) {
+	fastCreateRetries(t)
+
+	ms := &flakySigner{failures: 1, err: errDial}
+	rdb, _ := newTestRedis(t)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(createFeeVal), new(big.Int), new(big.Int), testIntervalSec, ms, zap.NewNop())
+
+	if err := h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	if ms.ok != 2 {
+		t.Errorf("queued vouchers: got %d want 2", ms.ok)
+	}
+}
+
+func TestOnCreate_AmbiguousEnqueueErrorNotRetried(t *testing.T) {
+	fastCreateRetries(t)
+
+	// The write may have gone through before the reply timed out; a retry
+	// could queue the voucher twice.
+	ms := &flakySigner{failures: 1, err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}}
+	rdb, _ := newTestRedis(t)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(createFeeVal), new(big.Int), new(big.Int), testIntervalSec, ms, zap.NewNop())
+
+	if err := h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil); !errors.Is(err, ErrBillingInitFailed) {
+		t.Fatalf("OnCreate: got %v want ErrBillingInitFailed", err)
+	}
+	if ms.calls != 1 {
+		t.Errorf("enqueue attempts: got %d want 1", ms.calls)
+	}
+}
+
+func TestOnCreate_BatchEnqueuer_QueuesOpeningVouchersTogether(t *testing.T) {
+	fastCreateRetries(t)
+	rdb, _ := newTestRedis(t)
+	bs := &batchSigner{batchErr: errors.New("EXECABORT")}
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(createFeeVal), new(big.Int), new(big.Int), testIntervalSec, bs, zap.NewNop())
+	ctx := context.Background()
+
+	// The create fee is not queued without the first period.
+	if err := h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil); !errors.Is(err, ErrBillingInitFailed) {
+		t.Fatalf("OnCreate: got %v want ErrBillingInitFailed", err)
+	}
+	if bs.count() != 0 || bs.single != 0 {
+		t.Fatalf("failed batch queued %d voucher(s), %d singly", bs.count(), bs.single)
+	}
+
+	bs.batchErr = nil
+	if err := h.OnCreate(ctx, "sb-2", testOwner, 1, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(bs.batches) != 1 || bs.batches[0] != 2 || bs.single != 0 {
+		t.Errorf("batches %v, single enqueues %d; want one batch of 2", bs.batches, bs.single)
+	}
+}
+
+// errDial is a connection failure: nothing reached Redis.
+var errDial = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+// fastCreateRetries shortens OnCreate's retry backoff for the test.
+func fastCreateRetries(t *testing.T) {
+	saved := createRetryDelays
+	createRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { createRetryDelays = saved })
+}
+
+// flakySigner fails the first `failures` Enqueue calls with err.
+type flakySigner struct {
+	failures int
+	err      error
+	ok       int
+	calls    int
+}
+
+func (f *flakySigner) Enqueue(context.Context, *voucher.SandboxVoucher) error {
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return f.err
+	}
+	f.ok++
+	return nil
+}
+
+func TestOnCreate_EchoesConfiguredLabels(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	h.SetReceiptLabels([]string{"team", " project ", "owner", "daytona-owner", "absent"})
+
+	long := strings.Repeat("x", maxLabelValueLen+10)
+	// The 3-byte rune straddles the cap, so it is dropped whole.
+	wide := strings.Repeat("x", maxLabelValueLen-1) + "€"
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, map[string]string{
+		"team":          "infra",
+		"project":       long,
+		"owner":         wide,
+		"env":           "prod", // not configured
+		"daytona-owner": testOwner,
+	})
+
+	want := map[string]string{"team": "infra", "project": long[:maxLabelValueLen], "owner": wide[:maxLabelValueLen-1]}
+	sess, _ := get(testSandbox)
+	if sess == nil || !maps.Equal(sess.Labels, want) {
+		t.Fatalf("session labels: got %v want %v", sess, want)
+	}
+	for i, v := range ms.vouchers {
+		if !maps.Equal(v.Labels, want) {
+			t.Errorf("voucher[%d] labels: got %v want %v", i, v.Labels, want)
+		}
+	}
+}
+
+func TestOnCreate_NoReceiptLabelsConfigured(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, map[string]string{"team": "infra"})
+
+	sess, _ := get(testSandbox)
+	if sess == nil || sess.Labels != nil || ms.last().Labels != nil {
+		t.Errorf("no labels configured: nothing must be echoed, got session %+v", sess)
+	}
+}
+
+// A trusted wallet's billing=disabled sandbox opens no session and emits no
+// vouchers, on create or start, and its reservation is released.
+func TestOnCreate_TrustedWalletBillingDisabled(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	h.SetTrustedWallets([]string{" " + strings.ToLower(testOwner)})
+	ctx := context.Background()
+	labels := map[string]string{BillingLabel: BillingDisabled}
+
+	Reserve(ctx, h.rdb, testOwner, testProvider, big.NewInt(createFeeVal+testIntervalSec*pricePerSec), time.Minute)
+	if err := h.OnCreate(ctx, testSandbox, testOwner, 1, 1, labels); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	h.OnStart(ctx, testSandbox, testOwner, 1, 1, labels)
+
+	if ms.count() != 0 {
+		t.Errorf("expected no vouchers, got %d", ms.count())
+	}
+	if sess, _ := get(testSandbox); sess != nil {
+		t.Errorf("expected no session, got %+v", sess)
+	}
+	if r := GetReserved(ctx, h.rdb, testOwner, testProvider); r.Sign() != 0 {
+		t.Errorf("reservation not released: %s", r)
+	}
+}
+
+// The label is ignored on an untrusted wallet's sandbox.
+func TestOnCreate_UntrustedWalletBillingLabelIgnored(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	h.SetTrustedWallets([]string{testProvider})
+
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, map[string]string{BillingLabel: BillingDisabled})
+
+	if ms.count() != 2 {
+		t.Errorf("expected 2 vouchers (createFee + first period), got %d", ms.count())
+	}
+	if sess, _ := get(testSandbox); sess == nil {
+		t.Error("expected a billing session")
+	}
 }
 
 // ── OnStart ───────────────────────────────────────────────────────────────────
@@ -139,7 +442,7 @@ func TestOnStart_CreatesSessionAndEmitsFirstPeriod(t *testing.T) {
 	ctx := context.Background()
 
 	before := time.Now().Unix()
-	h.OnStart(ctx, testSandbox, testOwner, 1, 1)
+	h.OnStart(ctx, testSandbox, testOwner, 1, 1, nil)
 	after := time.Now().Unix()
 
 	sess, err := get(testSandbox)
@@ -178,7 +481,7 @@ func TestOnStart_IdempotentIfSessionExists(t *testing.T) {
 	h, get := newTestHandler(t, ms)
 	ctx := context.Background()
 
-	h.OnStart(ctx, testSandbox, testOwner, 1, 1)
+	h.OnStart(ctx, testSandbox, testOwner, 1, 1, nil)
 	sess1, _ := get(testSandbox)
 	if sess1 == nil {
 		t.Fatal("expected session after first OnStart")
@@ -187,7 +490,7 @@ func TestOnStart_IdempotentIfSessionExists(t *testing.T) {
 	origCount := ms.count()
 
 	time.Sleep(2 * time.Millisecond)
-	h.OnStart(ctx, testSandbox, testOwner, 1, 1)
+	h.OnStart(ctx, testSandbox, testOwner, 1, 1, nil)
 
 	sess2, _ := get(testSandbox)
 	if sess2 == nil {
@@ -319,3 +622,388 @@ func TestOnArchive_DeletesSessionNoVoucher(t *testing.T) {
 		t.Error("session should be deleted after OnArchive")
 	}
 }
+
+// Stop, delete and archive racing for the same sandbox: exactly one of them
+// closes the session and records the stopped event; none emits a voucher.
+func TestConcurrentStopDeleteArchive_ClosesOnce(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	ctx := context.Background()
+
+	for round := 0; round < 20; round++ {
+		id := "sb-race-" + strconv.Itoa(round)
+		if err := h.OnCreate(ctx, id, testOwner, 1, 1, nil); err != nil {
+			t.Fatalf("OnCreate: %v", err)
+		}
+		before := ms.count()
+
+		var wg sync.WaitGroup
+		for _, fn := range []func(context.Context, string){h.OnStop, h.OnDelete, h.OnArchive, h.OnStop, h.OnDelete} {
+			wg.Add(1)
+			go func(fn func(context.Context, string)) {
+				defer wg.Done()
+				fn(ctx, id)
+			}(fn)
+		}
+		wg.Wait()
+
+		if ms.count() != before {
+			t.Fatalf("%s: teardown emitted %d vouchers", id, ms.count()-before)
+		}
+		if sess, _ := get(id); sess != nil {
+			t.Fatalf("%s: session not deleted", id)
+		}
+	}
+
+	evs, err := events.List(ctx, h.rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := map[string]int{}
+	for _, e := range evs {
+		if e.Type == events.TypeStopped {
+			stopped[e.SandboxID]++
+		}
+	}
+	for round := 0; round < 20; round++ {
+		if id := "sb-race-" + strconv.Itoa(round); stopped[id] != 1 {
+			t.Errorf("%s: %d stopped events, want exactly 1", id, stopped[id])
+		}
+	}
+	if running, _ := OwnerSandboxes(ctx, h.rdb, testOwner); len(running) != 0 {
+		t.Errorf("owner running set not emptied: %v", running)
+	}
+}
+
+// ── Audit timeline ────────────────────────────────────────────────────────────
+
+// Each hook that opens or closes a session appends exactly one audit entry;
+// repeated calls that find nothing to do append none.
+func TestLifecycleHooks_WriteOneAuditEntryEach(t *testing.T) {
+	ms := &mockSigner{}
+	h, _ := newTestHandler(t, ms)
+	ctx := context.Background()
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+	h.SetClock(clk)
+
+	auditEvents := func(id string) []string {
+		t.Helper()
+		entries, err := settler.ListAudit(ctx, h.rdb, id)
+		if err != nil {
+			t.Fatalf("ListAudit: %v", err)
+		}
+		out := make([]string, len(entries))
+		for i, e := range entries {
+			out[i] = e.Event
+		}
+		return out
+	}
+
+	dup := func(event string) float64 {
+		return testutil.ToFloat64(metrics.LifecycleEvents.WithLabelValues(event, metrics.OutcomeDuplicate))
+	}
+	startDups, stopDups, deleteDups := dup(settler.AuditStarted), dup(settler.AuditStopped), dup(settler.AuditDeleted)
+
+	if err := h.OnCreate(ctx, "sb-audit-1", testOwner, 1, 1, nil); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	clk.Advance(600 * time.Second)
+	h.OnStop(ctx, "sb-audit-1")
+	h.OnStop(ctx, "sb-audit-1")
+	h.OnStart(ctx, "sb-audit-1", testOwner, 1, 1, nil)
+	h.OnStart(ctx, "sb-audit-1", testOwner, 1, 1, nil)
+	h.OnArchive(ctx, "sb-audit-1")
+	h.OnStart(ctx, "sb-audit-1", testOwner, 1, 1, nil)
+	h.rdb.Set(ctx, "cost:sb-audit-1", "1234", 0) // settled so far
+	h.OnDelete(ctx, "sb-audit-1")
+	h.OnDelete(ctx, "sb-audit-1")
+
+	want := []string{settler.AuditCreated, settler.AuditStopped, settler.AuditStarted,
+		settler.AuditArchived, settler.AuditStarted, settler.AuditDeleted}
+	if got := auditEvents("sb-audit-1"); !slices.Equal(got, want) {
+		t.Fatalf("audit events: got %v want %v", got, want)
+	}
+
+	entries, _ := settler.ListAudit(ctx, h.rdb, "sb-audit-1")
+	wantUpfront := strconv.FormatInt(createFeeVal+testIntervalSec*pricePerSec, 10)
+	if e := entries[0]; e.At != 1_700_000_000 || e.Fee != wantUpfront || e.Nonce != "" {
+		t.Errorf("created entry: got %+v, want at 1700000000, fee %s, no nonce", e, wantUpfront)
+	}
+	if e := entries[1]; e.At != 1_700_000_600 || e.Fee != wantUpfront || e.LifetimeCost != "" {
+		t.Errorf("stopped entry: got %+v, want at 1700000600, fee %s", e, wantUpfront)
+	}
+	if e := entries[5]; e.LifetimeCost != "1234" {
+		t.Errorf("deleted entry: got %+v, want lifetime cost 1234", e)
+	}
+	if ttl := h.rdb.TTL(ctx, "cost:sb-audit-1").Val(); ttl <= 0 {
+		t.Errorf("deleted sandbox's cost should expire, TTL %v", ttl)
+	}
+	if d := dup(settler.AuditStarted) - startDups; d != 1 {
+		t.Errorf("duplicate starts counted: %v, want 1", d)
+	}
+	if d := dup(settler.AuditStopped) - stopDups; d != 1 {
+		t.Errorf("duplicate stops counted: %v, want 1", d)
+	}
+	if d := dup(settler.AuditDeleted) - deleteDups; d != 1 {
+		t.Errorf("duplicate deletes counted: %v, want 1", d)
+	}
+
+	// Unknown sandbox: nothing to close, nothing recorded.
+	h.OnStop(ctx, "sb-audit-none")
+	if got := auditEvents("sb-audit-none"); len(got) != 0 {
+		t.Errorf("audit for sandbox without session: %v", got)
+	}
+}
+
+// A delete after a stop finds no session, but still snapshots the lifetime
+// cost into a deleted entry, once.
+func TestOnDelete_AfterStopSnapshotsLifetimeCost(t *testing.T) {
+	h, _ := newTestHandler(t, &mockSigner{})
+	ctx := context.Background()
+
+	if err := h.OnCreate(ctx, "sb-audit-2", testOwner, 1, 1, nil); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	h.OnStop(ctx, "sb-audit-2")
+	h.rdb.Set(ctx, "cost:sb-audit-2", "5678", 0)
+	h.OnDelete(ctx, "sb-audit-2")
+	h.OnDelete(ctx, "sb-audit-2")
+
+	entries, err := settler.ListAudit(ctx, h.rdb, "sb-audit-2")
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("audit entries: got %+v, want created, stopped, deleted", entries)
+	}
+	if e := entries[2]; e.Event != settler.AuditDeleted || e.LifetimeCost != "5678" || e.Fee != "" {
+		t.Errorf("deleted entry: got %+v, want lifetime cost 5678, no fee", e)
+	}
+	if ttl := h.rdb.TTL(ctx, "cost:sb-audit-2").Val(); ttl <= 0 {
+		t.Errorf("deleted sandbox's cost should expire, TTL %v", ttl)
+	}
+}
+
+// ── Pause / resume ────────────────────────────────────────────────────────────
+
+// Pause → resume → stop: no period is charged while paused, the period after
+// resume starts at the resume instant, and the unbilled gap is recorded.
+func TestPauseResume_PausedSecondsNotBilled(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(t0)
+	h.SetClock(clk)
+	ctx := context.Background()
+
+	if err := h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	// create fee + [t0, t0+60]
+	clk.Advance(10 * time.Second)
+	if err := h.PauseBilling(ctx, testSandbox); err != nil {
+		t.Fatalf("PauseBilling: %v", err)
+	}
+	if err := h.PauseBilling(ctx, testSandbox); err != nil {
+		t.Fatalf("second PauseBilling must be a no-op: %v", err)
+	}
+
+	// Well past the paid period: the generator skips the paused session.
+	clk.Advance(190 * time.Second) // t0+200
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	if ms.count() != 2 {
+		t.Fatalf("paused: expected still 2 vouchers, got %d", ms.count())
+	}
+
+	if err := h.ResumeBilling(ctx, testSandbox); err != nil {
+		t.Fatalf("ResumeBilling: %v", err)
+	}
+	if ms.count() != 3 {
+		t.Fatalf("resume: expected a period voucher, got %d vouchers", ms.count())
+	}
+	v := ms.last()
+	if v.Usage.PeriodStart != t0.Unix()+200 || v.TotalFee.Int64() != testIntervalSec*pricePerSec {
+		t.Errorf("resumed period: start %d fee %s, want start %d fee %d",
+			v.Usage.PeriodStart, v.TotalFee, t0.Unix()+200, testIntervalSec*pricePerSec)
+	}
+	sess, _ := get(testSandbox)
+	if sess.PausedAt != 0 || sess.PausedSec != 140 {
+		t.Errorf("session: paused_at %d paused_sec %d, want 0 and 140 (t0+60 … t0+200)", sess.PausedAt, sess.PausedSec)
+	}
+	if want := createFeeVal + 2*testIntervalSec*pricePerSec; sess.AccruedFee != strconv.FormatInt(want, 10) {
+		t.Errorf("accrued: got %s want %d", sess.AccruedFee, want)
+	}
+
+	// Billing continues from the resumed period; stop emits nothing more.
+	clk.Advance(time.Duration(testIntervalSec) * time.Second)
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	h.OnStop(ctx, testSandbox)
+	if ms.count() != 4 {
+		t.Fatalf("expected 4 vouchers in total, got %d", ms.count())
+	}
+	var billedSec int64
+	for _, v := range ms.vouchers {
+		billedSec += v.Usage.UsageUnits
+	}
+	if billedSec != 3*testIntervalSec {
+		t.Errorf("billed seconds: got %d want %d (140 paused seconds excluded)", billedSec, 3*testIntervalSec)
+	}
+}
+
+// Resuming inside the already-paid period charges nothing extra.
+func TestResumeBilling_WithinPaidPeriod(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	ctx := context.Background()
+
+	h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+	h.PauseBilling(ctx, testSandbox)                   //nolint:errcheck
+	clk.Advance(30 * time.Second)
+	if err := h.ResumeBilling(ctx, testSandbox); err != nil {
+		t.Fatalf("ResumeBilling: %v", err)
+	}
+	if ms.count() != 2 {
+		t.Errorf("expected no extra voucher, got %d vouchers", ms.count())
+	}
+	if sess, _ := get(testSandbox); sess.PausedAt != 0 || sess.PausedSec != 0 {
+		t.Errorf("session: paused_at %d paused_sec %d, want 0 and 0", sess.PausedAt, sess.PausedSec)
+	}
+}
+
+// Concurrent resumes of one paused session charge the resumed period once.
+func TestResumeBilling_ConcurrentCallsChargeOnce(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	ctx := context.Background()
+
+	h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+	h.PauseBilling(ctx, testSandbox)                   //nolint:errcheck
+	clk.Advance(200 * time.Second)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.ResumeBilling(ctx, testSandbox); err != nil {
+				t.Errorf("ResumeBilling: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ms.count() != 3 {
+		t.Errorf("expected one resumed-period voucher, got %d vouchers in total", ms.count())
+	}
+	sess, _ := get(testSandbox)
+	if want := createFeeVal + 2*testIntervalSec*pricePerSec; sess.AccruedFee != strconv.FormatInt(want, 10) {
+		t.Errorf("accrued: got %s want %d (the resumed period once)", sess.AccruedFee, want)
+	}
+}
+
+// A resumed period that cannot be queued leaves the session paused as before.
+func TestResumeBilling_EnqueueFailureStaysPaused(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	ctx := context.Background()
+
+	h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+	h.PauseBilling(ctx, testSandbox)                   //nolint:errcheck
+	before, _ := get(testSandbox)
+	clk.Advance(200 * time.Second)
+
+	ms.enqErr = errors.New("queue down")
+	if err := h.ResumeBilling(ctx, testSandbox); err == nil {
+		t.Fatal("expected the enqueue error")
+	}
+	after, _ := get(testSandbox)
+	if after.PausedAt != before.PausedAt || after.NextVoucherAt != before.NextVoucherAt ||
+		after.AccruedFee != before.AccruedFee || after.PausedSec != 0 {
+		t.Errorf("session changed: before %+v after %+v", before, after)
+	}
+
+	ms.enqErr = nil
+	if err := h.ResumeBilling(ctx, testSandbox); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if ms.count() != 3 {
+		t.Errorf("retry: expected the resumed period charged, got %d vouchers", ms.count())
+	}
+}
+
+// The generator resumes a session paused for longer than SetMaxPause.
+func TestRunGeneration_ResumesExpiredPause(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	h.SetMaxPause(time.Hour)
+	ctx := context.Background()
+
+	h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+	h.PauseBilling(ctx, testSandbox)                   //nolint:errcheck
+
+	clk.Advance(time.Hour - time.Second)
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	if sess, _ := get(testSandbox); sess.PausedAt == 0 || ms.count() != 2 {
+		t.Fatalf("within the limit: paused_at %d, %d vouchers", sess.PausedAt, ms.count())
+	}
+
+	clk.Advance(time.Second)
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	if sess, _ := get(testSandbox); sess.PausedAt != 0 || ms.count() != 3 {
+		t.Errorf("past the limit: paused_at %d, %d vouchers, want resumed and charged", sess.PausedAt, ms.count())
+	}
+}
+
+func TestPauseBilling_PausedTotalIsCapped(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	h.SetMaxPausedTotal(10 * time.Minute)
+	ctx := context.Background()
+
+	h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil) //nolint:errcheck
+	h.PauseBilling(ctx, testSandbox)                   //nolint:errcheck
+
+	// The pre-charged period runs out, then 10 minutes go unbilled.
+	clk.Advance(time.Duration(testIntervalSec)*time.Second + 10*time.Minute - time.Second)
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	if sess, _ := get(testSandbox); sess.PausedAt == 0 {
+		t.Fatal("resumed before the paused total reached the cap")
+	}
+	clk.Advance(time.Second)
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	sess, _ := get(testSandbox)
+	if sess.PausedAt != 0 || sess.PausedSec != 600 || ms.count() != 3 {
+		t.Fatalf("at the cap: paused_at %d, paused_sec %d, %d vouchers; want resumed and charged", sess.PausedAt, sess.PausedSec, ms.count())
+	}
+
+	// Pausing again would add to a total already at the cap.
+	if err := h.PauseBilling(ctx, testSandbox); !errors.Is(err, ErrPauseLimit) {
+		t.Errorf("PauseBilling at the cap: got %v want ErrPauseLimit", err)
+	}
+	if sess, _ := get(testSandbox); sess.PausedAt != 0 {
+		t.Error("a refused pause must leave billing running")
+	}
+}
+
+func TestPauseBilling_NoSession(t *testing.T) {
+	h, _ := newTestHandler(t, &mockSigner{})
+	ctx := context.Background()
+	if err := h.PauseBilling(ctx, "sb-none"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("PauseBilling: got %v want ErrNoSession", err)
+	}
+	if err := h.ResumeBilling(ctx, "sb-none"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("ResumeBilling: got %v want ErrNoSession", err)
+	}
+	if n, _ := h.rdb.Exists(ctx, sessionKey("sb-none")).Result(); n != 0 {
+		t.Error("pausing a missing session must not create one")
+	}
+}
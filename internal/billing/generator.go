@@ -2,17 +2,22 @@ package billing
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
 // RunGenerator periodically scans all billing sessions and pre-charges the next
-// compute period for any session whose NextVoucherAt has elapsed.
+// compute period for any session whose NextVoucherAt has elapsed, every
+// h.TickInterval(). "Now" comes from h's clock (see EventHandler.SetClock);
+// only the tick cadence is real.
 func RunGenerator(ctx context.Context, rdb *redis.Client, h *EventHandler, log *zap.Logger) {
-	interval := time.Duration(h.voucherIntervalSec) * time.Second
+	interval := h.TickInterval()
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -30,6 +35,16 @@ func RunGenerator(ctx context.Context, rdb *redis.Client, h *EventHandler, log *
 	}
 }
 
+// runGeneration charges every due session's next period. With a signer that
+// implements OpenEnqueuer or BatchEnqueuer the sweep's vouchers are queued by
+// one call, in session order, before any session is advanced; if that fails
+// nothing is advanced and the sessions are charged on the next sweep. A
+// voucher that fails Validate is left out and only its session skipped. An
+// OpenEnqueuer drops the voucher of a session closed after it was built;
+// otherwise that session is still charged for the period, as when the close
+// races a single enqueue. Without either, each voucher is queued on its own
+// and a failure only skips that session. Paused sessions are skipped, except
+// that one past SetMaxPause or SetMaxPausedTotal is resumed.
 func runGeneration(ctx context.Context, rdb *redis.Client, h *EventHandler, log *zap.Logger) {
 	sessions, err := ScanAllSessions(ctx, rdb)
 	if err != nil {
@@ -37,30 +52,150 @@ func runGeneration(ctx context.Context, rdb *redis.Client, h *EventHandler, log
 		return
 	}
 
-	now := time.Now().Unix()
+	wallNow := h.clock.Now()
+	now := wallNow.Unix()
+	runways := make(map[string]*runway)
+	// After a forward clock jump the jumped span did not really elapse, so
+	// due periods move forward by it; time that did elapse is still billed.
+	jumpSec := h.detectClockJump(wallNow, log)
+	batcher, _ := h.signer.(BatchEnqueuer)
+	opener, _ := h.signer.(OpenEnqueuer)
+	var charges []periodCharge
 
 	for _, sess := range sessions {
-		s := sess
-		if now < s.NextVoucherAt {
+		if sess.PausedAt != 0 {
+			h.expirePause(ctx, &sess, now, log)
+			continue // billing paused (see PauseBilling)
+		}
+		if now < sess.NextVoucherAt {
 			continue
 		}
-
-		// Use per-sandbox rate stored in session; fall back to global flat rate.
-		price := h.computePricePerSec
-		if s.PricePerSec != "" {
-			if p, ok := new(big.Int).SetString(s.PricePerSec, 10); ok && p.Sign() > 0 {
-				price = p
-			}
+		// The scan is a snapshot: since then the session may have been
+		// closed by a stop or delete, paused, or billed by another replica.
+		cur, err := GetSession(ctx, rdb, sess.SandboxID)
+		if err != nil {
+			log.Error("generator: reload session", zap.String("sandbox", sess.SandboxID), zap.Error(err))
+			continue
+		}
+		if cur == nil || now < cur.NextVoucherAt || cur.PausedAt != 0 {
+			continue
+		}
+		s := *cur
+		if !h.sandboxBillable(ctx, &s, now, log) {
+			continue
 		}
 
-		nextVoucherAt, err := h.emitPeriodVoucher(ctx, s.SandboxID, s.Owner, price, s.NextVoucherAt)
+		periodStart := s.NextVoucherAt
+		if jumpSec > 0 {
+			periodStart = min(periodStart+jumpSec, now)
+		}
+		v, nextVoucherAt, fee, err := h.periodVoucher(s.SandboxID, s.Owner, h.sessionPrice(&s), s.StartedAt, periodStart, s.IntervalSec, s.Labels)
+		if err == nil && v != nil {
+			// Checked here so one bad session cannot fail the whole batch.
+			err = v.Validate()
+		}
 		if err != nil {
 			log.Error("generator: emit period voucher", zap.String("sandbox", s.SandboxID), zap.Error(err))
 			continue
 		}
+		c := periodCharge{session: s, voucher: v, nextVoucherAt: nextVoucherAt, fee: fee}
+		if batcher != nil || opener != nil {
+			charges = append(charges, c)
+			continue
+		}
+		if v != nil {
+			if err := h.signer.Enqueue(ctx, v); err != nil {
+				log.Error("generator: emit period voucher", zap.String("sandbox", s.SandboxID), zap.Error(err))
+				continue
+			}
+		}
+		h.advancePeriod(ctx, rdb, c, now, runways, log)
+	}
+
+	if len(charges) == 0 {
+		return
+	}
+	vs := make([]*voucher.SandboxVoucher, 0, len(charges))
+	for _, c := range charges {
+		if c.voucher != nil {
+			vs = append(vs, c.voucher)
+		}
+	}
+	queued := make(map[*voucher.SandboxVoucher]bool, len(vs))
+	if opener != nil {
+		ok, err := opener.EnqueueOpen(ctx, vs)
+		if err != nil {
+			log.Error("generator: enqueue period vouchers", zap.Int("vouchers", len(vs)), zap.Error(err))
+			return
+		}
+		for i, v := range vs {
+			queued[v] = i < len(ok) && ok[i]
+		}
+	} else {
+		if err := batcher.EnqueueBatch(ctx, vs); err != nil {
+			log.Error("generator: enqueue period vouchers", zap.Int("vouchers", len(vs)), zap.Error(err))
+			return
+		}
+		for _, v := range vs {
+			queued[v] = true
+		}
+	}
+	for _, c := range charges {
+		if c.voucher != nil && !queued[c.voucher] {
+			continue // closed since the voucher was built
+		}
+		h.advancePeriod(ctx, rdb, c, now, runways, log)
+	}
+}
+
+// expirePause resumes a session paused for longer than SetMaxPause allows, or
+// whose unbilled paused time has reached SetMaxPausedTotal. ResumeBilling
+// charges its new period straight away.
+func (h *EventHandler) expirePause(ctx context.Context, s *Session, now int64, log *zap.Logger) {
+	tooLong := h.maxPauseSec > 0 && now-s.PausedAt >= h.maxPauseSec
+	unbilled := s.PausedSec + max(now-max(s.PausedAt, s.NextVoucherAt), 0)
+	usedUp := h.maxPausedTotalSec > 0 && unbilled >= h.maxPausedTotalSec
+	if !tooLong && !usedUp {
+		return
+	}
+	if err := h.ResumeBilling(ctx, s.SandboxID); err != nil {
+		if !errors.Is(err, ErrNoSession) {
+			log.Error("generator: resume expired pause", zap.String("sandbox", s.SandboxID), zap.Error(err))
+		}
+		return
+	}
+	log.Info("generator: pause limit reached, billing resumed", zap.String("sandbox", s.SandboxID))
+}
+
+// periodCharge is a due session's next period: its voucher (nil when there is
+// nothing to charge), the session's next NextVoucherAt and the fee.
+type periodCharge struct {
+	session       Session
+	voucher       *voucher.SandboxVoucher
+	nextVoucherAt int64
+	fee           *big.Int
+}
+
+// advancePeriod records a queued period charge on its session.
+func (h *EventHandler) advancePeriod(ctx context.Context, rdb *redis.Client, c periodCharge, now int64, runways map[string]*runway, log *zap.Logger) {
+	if err := AdvanceSession(ctx, rdb, c.session.SandboxID, c.nextVoucherAt, now, c.fee); err != nil {
+		if errors.Is(err, ErrNoSession) {
+			return // stopped while the voucher was being emitted
+		}
+		log.Error("generator: update next_voucher_at", zap.String("sandbox", c.session.SandboxID), zap.Error(err))
+		return
+	}
+	h.touchSession(ctx, c.session.SandboxID)
+	h.checkRunway(ctx, &c.session, now, runways, log)
+}
 
-		if err := UpdateNextVoucherAt(ctx, rdb, s.SandboxID, nextVoucherAt); err != nil {
-			log.Error("generator: update next_voucher_at", zap.String("sandbox", s.SandboxID), zap.Error(err))
+// sessionPrice returns the per-sandbox rate stored in the session, falling
+// back to the global flat rate.
+func (h *EventHandler) sessionPrice(s *Session) *big.Int {
+	if s.PricePerSec != "" {
+		if p, ok := new(big.Int).SetString(s.PricePerSec, 10); ok && p.Sign() > 0 {
+			return p
 		}
 	}
+	return h.computePricePerSec
 }
@@ -3,15 +3,21 @@ package billing
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
@@ -108,6 +114,132 @@ func TestRunGeneration_SessionDue_EmitsPeriodVoucher(t *testing.T) {
 	}
 }
 
+// batchSigner queues through EnqueueBatch, recording each batch's size.
+type batchSigner struct {
+	mockSigner
+	batches  []int
+	single   int
+	batchErr error
+}
+
+func (s *batchSigner) Enqueue(ctx context.Context, v *voucher.SandboxVoucher) error {
+	s.single++
+	return s.mockSigner.Enqueue(ctx, v)
+}
+
+func (s *batchSigner) EnqueueBatch(ctx context.Context, vs []*voucher.SandboxVoucher) error {
+	if s.batchErr != nil {
+		return s.batchErr
+	}
+	s.batches = append(s.batches, len(vs))
+	for _, v := range vs {
+		s.mockSigner.Enqueue(ctx, v) //nolint:errcheck
+	}
+	return nil
+}
+
+func TestRunGeneration_BatchEnqueuer_OneBatchPerSweep(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	bs := &batchSigner{batchErr: errors.New("redis down")}
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), testIntervalSec, bs, zap.NewNop())
+	ctx := context.Background()
+
+	now := time.Now().Unix()
+	for _, id := range []string{"sb-1", "sb-2", "sb-3"} {
+		CreateSession(ctx, rdb, Session{SandboxID: id, Owner: testOwner, Provider: testProvider, NextVoucherAt: now - 10}) //nolint:errcheck
+	}
+	CreateSession(ctx, rdb, Session{SandboxID: "sb-later", Owner: testOwner, Provider: testProvider, NextVoucherAt: now + 600}) //nolint:errcheck
+
+	// A failed batch queues nothing and advances no session.
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if bs.count() != 0 {
+		t.Fatalf("vouchers after a failed batch: %d", bs.count())
+	}
+	for _, id := range []string{"sb-1", "sb-2", "sb-3"} {
+		if s, _ := GetSession(ctx, rdb, id); s.NextVoucherAt != now-10 {
+			t.Errorf("%s advanced after a failed batch: %d", id, s.NextVoucherAt)
+		}
+	}
+
+	// Next sweep: all due sessions in one batch, then advanced.
+	bs.batchErr = nil
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if len(bs.batches) != 1 || bs.batches[0] != 3 || bs.single != 0 {
+		t.Fatalf("batches %v, single enqueues %d; want one batch of 3", bs.batches, bs.single)
+	}
+	for _, id := range []string{"sb-1", "sb-2", "sb-3"} {
+		if s, _ := GetSession(ctx, rdb, id); s.NextVoucherAt <= now {
+			t.Errorf("%s not advanced: %d", id, s.NextVoucherAt)
+		}
+	}
+
+	// Nothing due: no batch at all.
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if len(bs.batches) != 1 {
+		t.Errorf("batches after an idle sweep: %v", bs.batches)
+	}
+}
+
+// One invalid voucher (a session without an owner) does not hold back the
+// rest of the batch: the others are queued and advanced, it is skipped.
+func TestRunGeneration_BatchEnqueuer_SkipsInvalidVoucher(t *testing.T) {
+	s, rdb, _ := newTestSignerFull(t)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), testIntervalSec, s, zap.NewNop())
+	ctx := context.Background()
+
+	now := time.Now().Unix()
+	for id, owner := range map[string]string{"sb-1": testOwner, "sb-bad": "", "sb-2": testOwner} {
+		CreateSession(ctx, rdb, Session{SandboxID: id, Owner: owner, Provider: testProvider, NextVoucherAt: now - 10}) //nolint:errcheck
+	}
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+	if n := rdb.LLen(ctx, queueKey).Val(); n != 2 {
+		t.Errorf("queued %d vouchers, want 2", n)
+	}
+	for id, advanced := range map[string]bool{"sb-1": true, "sb-2": true, "sb-bad": false} {
+		if sess, _ := GetSession(ctx, rdb, id); (sess.NextVoucherAt > now) != advanced {
+			t.Errorf("%s: next_voucher_at %d, advanced=%v want %v", id, sess.NextVoucherAt, sess.NextVoucherAt > now, advanced)
+		}
+	}
+}
+
+// closingSigner closes a session just before the sweep's vouchers are queued.
+type closingSigner struct {
+	*Signer
+	close string
+}
+
+func (c *closingSigner) EnqueueOpen(ctx context.Context, vs []*voucher.SandboxVoucher) ([]bool, error) {
+	DeleteSession(ctx, c.Signer.rdb, c.close) //nolint:errcheck
+	return c.Signer.EnqueueOpen(ctx, vs)
+}
+
+func TestRunGeneration_SessionClosedDuringSweepIsNotCharged(t *testing.T) {
+	s, rdb, _ := newTestSignerFull(t)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), testIntervalSec, &closingSigner{Signer: s, close: "sb-2"}, zap.NewNop())
+	ctx := context.Background()
+
+	now := time.Now().Unix()
+	for _, id := range []string{"sb-1", "sb-2"} {
+		CreateSession(ctx, rdb, Session{SandboxID: id, Owner: testOwner, Provider: testProvider, NextVoucherAt: now - 10}) //nolint:errcheck
+	}
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+	if n := rdb.LLen(ctx, queueKey).Val(); n != 1 {
+		t.Errorf("queued %d vouchers, want 1", n)
+	}
+	if pending, _ := ListPending(ctx, rdb, "sb-2"); len(pending) != 0 {
+		t.Errorf("closed session charged: %+v", pending)
+	}
+	if sess, _ := GetSession(ctx, rdb, "sb-2"); sess != nil {
+		t.Errorf("closed session recreated: %+v", sess)
+	}
+}
+
 // ── NextVoucherAt is updated after pre-charge ─────────────────────────────────
 
 func TestRunGeneration_UpdatesNextVoucherAt(t *testing.T) {
@@ -164,6 +296,99 @@ func TestRunGeneration_AfterUpdate_NoDoubleVoucher(t *testing.T) {
 	}
 }
 
+// ── Exact period boundary, driven by a fake clock ─────────────────────────────
+
+func TestRunGeneration_FakeClock_ChargesExactlyAtBoundary(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(3600)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	ctx := context.Background()
+
+	boundary := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(boundary.Add(-time.Second))
+	h.SetClock(clk)
+	CreateSession(ctx, rdb, Session{ //nolint:errcheck
+		SandboxID: "sb-edge", Owner: testOwner, Provider: testProvider,
+		NextVoucherAt: boundary.Unix(), PricePerSec: "100",
+	})
+
+	// One second before the boundary: not due.
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if ms.count() != 0 {
+		t.Fatalf("before boundary: expected 0 vouchers, got %d", ms.count())
+	}
+
+	// At the boundary itself: due.
+	clk.Advance(time.Second)
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if ms.count() != 1 {
+		t.Fatalf("at boundary: expected 1 voucher, got %d", ms.count())
+	}
+	sess, _ := GetSession(ctx, rdb, "sb-edge")
+	if sess.NextVoucherAt != boundary.Unix()+intervalSec {
+		t.Errorf("NextVoucherAt: got %d want %d", sess.NextVoucherAt, boundary.Unix()+intervalSec)
+	}
+}
+
+// ── Zero-fee periods ──────────────────────────────────────────────────────────
+
+// A due period that charges nothing — a zero rate, or a period clamped to no
+// time at all — must not enqueue a voucher (it would only burn a nonce and
+// gas), but the session still advances so the time is not billed again.
+func TestRunGeneration_ZeroFeePeriod_NoVoucherButAdvances(t *testing.T) {
+	const intervalSec = int64(60)
+	now := time.Date(2026, 1, 1, 0, 0, 30, 0, time.UTC)
+	cases := []struct {
+		name      string
+		rate      int64  // handler flat rate
+		price     string // session rate
+		startedAt int64
+		wantNext  int64
+	}{
+		// Relative: [now-10, now+50); wallclock: [now-10, now+30).
+		{name: "zero rate", rate: 0, price: "", startedAt: now.Unix() - 100},
+		// The session starts after the period's pre-charge limit: clamped to
+		// zero length at the session start.
+		{name: "clamped to nothing", rate: pricePerSec, price: "100", startedAt: now.Unix() + 3*intervalSec, wantNext: now.Unix() + 3*intervalSec},
+	}
+	for _, mode := range []string{PeriodRelative, PeriodWallclock} {
+		for _, tc := range cases {
+			t.Run(mode+"/"+tc.name, func(t *testing.T) {
+				rdb, _ := newTestRedis(t)
+				ms := &mockSigner{}
+				h := NewEventHandler(rdb, testProvider, big.NewInt(tc.rate), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+				h.SetPeriodAlignment(mode) //nolint:errcheck
+				h.SetClock(clock.NewFake(now))
+				ctx := context.Background()
+				CreateSession(ctx, rdb, Session{ //nolint:errcheck
+					SandboxID: "sb-zero", Owner: testOwner, Provider: testProvider,
+					NextVoucherAt: now.Unix() - 10, PricePerSec: tc.price, StartedAt: tc.startedAt,
+					LastVoucherAt: now.Unix() - 70, AccruedFee: "500",
+				})
+
+				runGeneration(ctx, rdb, h, zap.NewNop())
+
+				if ms.count() != 0 {
+					t.Fatalf("expected no voucher, got %+v", ms.last())
+				}
+				sess, _ := GetSession(ctx, rdb, "sb-zero")
+				if sess == nil {
+					t.Fatal("session missing")
+				}
+				wantNext := tc.wantNext
+				if wantNext == 0 {
+					wantNext = h.periodEnd(now.Unix()-10, 0)
+				}
+				if sess.NextVoucherAt != wantNext || sess.LastVoucherAt != now.Unix() || sess.AccruedFee != "500" {
+					t.Errorf("session: next %d (want %d), last %d (want %d), accrued %s",
+						sess.NextVoucherAt, wantNext, sess.LastVoucherAt, now.Unix(), sess.AccruedFee)
+				}
+			})
+		}
+	}
+}
+
 // ── Multiple sessions ─────────────────────────────────────────────────────────
 
 func TestRunGeneration_MultipleSessions_OneVoucherEach(t *testing.T) {
@@ -269,6 +494,69 @@ func TestRunGeneration_EnqueueError_NextVoucherAtUnchanged(t *testing.T) {
 	}
 }
 
+// ── Corrupted session time: no voucher ────────────────────────────────────────
+
+func TestRunGeneration_CorruptedPeriodStart_NoVoucher(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(3600)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	ctx := context.Background()
+
+	CreateSession(ctx, rdb, Session{ //nolint:errcheck
+		SandboxID: "sb-corrupt", Owner: testOwner, Provider: testProvider,
+		NextVoucherAt: 42, PricePerSec: "100",
+	})
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	if ms.count() != 0 {
+		t.Errorf("expected no voucher for a corrupted session, got %d", ms.count())
+	}
+	if sess, _ := GetSession(ctx, rdb, "sb-corrupt"); sess.NextVoucherAt != 42 {
+		t.Errorf("NextVoucherAt must not advance: got %d", sess.NextVoucherAt)
+	}
+}
+
+// An inflated interval_sec or a period start before the session would bill
+// time the session never ran; the period is clamped to its lifetime.
+func TestRunGeneration_InflatedPeriodClampedToSession(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(60)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+
+	CreateSession(ctx, rdb, Session{ //nolint:errcheck
+		SandboxID: "sb-inflated", Owner: testOwner, Provider: testProvider,
+		StartedAt: now.Unix() - 120, NextVoucherAt: now.Unix(), PricePerSec: "100",
+		IntervalSec: 30 * 86400,
+	})
+	CreateSession(ctx, rdb, Session{ //nolint:errcheck
+		SandboxID: "sb-early", Owner: testOwner, Provider: testProvider,
+		StartedAt: now.Unix() - 30, NextVoucherAt: now.Unix() - 3600, PricePerSec: "100",
+	})
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	byID := map[string]*voucher.SandboxVoucher{}
+	for _, v := range ms.vouchers {
+		byID[v.SandboxID] = v
+	}
+	if v := byID["sb-inflated"]; v == nil || v.Usage.PeriodEnd != now.Unix()+intervalSec || v.TotalFee.Int64() != 100*intervalSec {
+		t.Errorf("inflated interval: %+v, want the period clamped to end %d", v, now.Unix()+intervalSec)
+	}
+	if sess, _ := GetSession(ctx, rdb, "sb-inflated"); sess.NextVoucherAt != now.Unix()+intervalSec {
+		t.Errorf("NextVoucherAt: got %d want the clamped end", sess.NextVoucherAt)
+	}
+	// [now-3600, now-3540) lies before the session: nothing of it is billed.
+	if v := byID["sb-early"]; v != nil && v.Usage.PeriodStart < now.Unix()-30 {
+		t.Errorf("period before the session billed: %+v", v.Usage)
+	}
+}
+
 // ── Voucher fields: User/Provider addresses ───────────────────────────────────
 
 func TestRunGeneration_VoucherHasCorrectAddresses(t *testing.T) {
@@ -327,3 +615,531 @@ func TestRunGeneration_FlatRateFallback(t *testing.T) {
 		t.Errorf("flat rate TotalFee: got %d want %d", v.TotalFee.Int64(), wantFee)
 	}
 }
+
+// ── Period alignment ──────────────────────────────────────────────────────────
+
+func TestPeriodEnd(t *testing.T) {
+	h := &EventHandler{voucherIntervalSec: 60}
+	cases := []struct {
+		mode  string
+		start int64
+		want  int64
+	}{
+		{PeriodRelative, 1000, 1060},
+		{PeriodRelative, 1020, 1080},
+		{PeriodWallclock, 1000, 1020}, // partial: remainder to the next minute
+		{PeriodWallclock, 1019, 1020},
+		{PeriodWallclock, 1020, 1080}, // on a boundary: full period
+	}
+	for _, tc := range cases {
+		if err := h.SetPeriodAlignment(tc.mode); err != nil {
+			t.Fatalf("SetPeriodAlignment(%q): %v", tc.mode, err)
+		}
+		if got := h.periodEnd(tc.start, 0); got != tc.want {
+			t.Errorf("%s periodEnd(%d) = %d, want %d", tc.mode, tc.start, got, tc.want)
+		}
+	}
+	if err := h.SetPeriodAlignment("hourly"); err == nil {
+		t.Error("expected error for unknown alignment")
+	}
+}
+
+func TestOnCreate_Wallclock_PartialFirstPeriod(t *testing.T) {
+	ms := &mockSigner{}
+	h, get := newTestHandler(t, ms)
+	h.SetPeriodAlignment(PeriodWallclock) //nolint:errcheck
+
+	h.OnCreate(context.Background(), testSandbox, testOwner, 1, 1, nil)
+
+	if ms.count() != 2 {
+		t.Fatalf("expected 2 vouchers, got %d", ms.count())
+	}
+	u := ms.vouchers[1].Usage
+	if u.PeriodEnd%testIntervalSec != 0 {
+		t.Errorf("first period must end on a boundary, PeriodEnd=%d", u.PeriodEnd)
+	}
+	if u.UsageUnits != u.PeriodEnd-u.PeriodStart || u.UsageUnits <= 0 || u.UsageUnits > testIntervalSec {
+		t.Errorf("partial first period: got %+v", u)
+	}
+	if got, want := ms.vouchers[1].TotalFee.Int64(), u.UsageUnits*pricePerSec; got != want {
+		t.Errorf("partial period fee: got %d want %d", got, want)
+	}
+	sess, _ := get(testSandbox)
+	if sess == nil || sess.NextVoucherAt != u.PeriodEnd {
+		t.Fatalf("NextVoucherAt must be the first boundary %d, got %+v", u.PeriodEnd, sess)
+	}
+	if want := strconv.FormatInt(createFeeVal+u.UsageUnits*pricePerSec, 10); sess.AccruedFee != want {
+		t.Errorf("AccruedFee: got %s want %s", sess.AccruedFee, want)
+	}
+}
+
+func TestRunGeneration_Wallclock_FullAlignedPeriod(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(60)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	h.SetPeriodAlignment(PeriodWallclock) //nolint:errcheck
+	ctx := context.Background()
+
+	boundary := (time.Now().Unix()/intervalSec - 1) * intervalSec
+	CreateSession(ctx, rdb, Session{ //nolint:errcheck
+		SandboxID: "sb-wall", Owner: testOwner, Provider: testProvider,
+		NextVoucherAt: boundary, PricePerSec: "100",
+	})
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	v := ms.last()
+	if v == nil {
+		t.Fatal("expected voucher, got none")
+	}
+	if v.Usage.PeriodStart != boundary || v.Usage.PeriodEnd != boundary+intervalSec {
+		t.Errorf("aligned period: got [%d, %d] want [%d, %d]",
+			v.Usage.PeriodStart, v.Usage.PeriodEnd, boundary, boundary+intervalSec)
+	}
+	if v.TotalFee.Int64() != intervalSec*pricePerSec {
+		t.Errorf("full period fee: got %d want %d", v.TotalFee.Int64(), intervalSec*pricePerSec)
+	}
+}
+
+func TestRunGeneration_Relative_UnalignedFullPeriod(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(60)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	ctx := context.Background()
+
+	// Deliberately off the period boundary.
+	due := (time.Now().Unix()/intervalSec-1)*intervalSec + 17
+	CreateSession(ctx, rdb, Session{ //nolint:errcheck
+		SandboxID: "sb-rel", Owner: testOwner, Provider: testProvider,
+		NextVoucherAt: due, PricePerSec: "100",
+	})
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	v := ms.last()
+	if v == nil {
+		t.Fatal("expected voucher, got none")
+	}
+	if v.Usage.PeriodStart != due || v.Usage.PeriodEnd != due+intervalSec {
+		t.Errorf("relative period: got [%d, %d] want [%d, %d]",
+			v.Usage.PeriodStart, v.Usage.PeriodEnd, due, due+intervalSec)
+	}
+}
+
+// ── Per-sandbox voucher interval ──────────────────────────────────────────────
+
+func TestIntervalLabel_SessionBilledAtItsOwnInterval(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(3600)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	h.SetIntervalBounds(60, 0)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	ctx := context.Background()
+	now := clk.Now().Unix()
+
+	if err := h.OnCreate(ctx, "sb-gpu", testOwner, 1, 1, map[string]string{IntervalLabel: "300"}); err != nil {
+		t.Fatal(err)
+	}
+	h.OnStart(ctx, "sb-cheap", testOwner, 1, 1, nil)
+
+	gpu, _ := GetSession(ctx, rdb, "sb-gpu")
+	if gpu == nil || gpu.IntervalSec != 300 || gpu.NextVoucherAt != now+300 {
+		t.Fatalf("labelled session: got %+v, want a 300s interval", gpu)
+	}
+	cheap, _ := GetSession(ctx, rdb, "sb-cheap")
+	if cheap == nil || cheap.IntervalSec != 0 || cheap.NextVoucherAt != now+intervalSec {
+		t.Fatalf("unlabelled session: got %+v, want the global interval", cheap)
+	}
+
+	// After 300s only the labelled sandbox is due, for another 300s period.
+	clk.Advance(300 * time.Second)
+	before := ms.count()
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if ms.count() != before+1 {
+		t.Fatalf("vouchers after 300s: got %d want 1", ms.count()-before)
+	}
+	v := ms.last()
+	if v.SandboxID != "sb-gpu" || v.Usage.PeriodStart != now+300 || v.Usage.PeriodEnd != now+600 {
+		t.Errorf("period voucher: %s [%d, %d), want sb-gpu [%d, %d)", v.SandboxID, v.Usage.PeriodStart, v.Usage.PeriodEnd, now+300, now+600)
+	}
+	if got := h.TickInterval(); got != time.Minute {
+		t.Errorf("TickInterval: got %s want the 60s minimum", got)
+	}
+}
+
+func TestLabelInterval(t *testing.T) {
+	h := &EventHandler{voucherIntervalSec: 3600, log: zap.NewNop()}
+	if got := h.labelInterval(map[string]string{IntervalLabel: "300"}); got != 0 {
+		t.Errorf("overrides disabled: got %d want 0", got)
+	}
+	h.SetIntervalBounds(60, 0)
+	for _, tc := range []struct {
+		value string
+		want  int64
+	}{
+		{"300", 300},
+		{"10", 60},      // clamped up to the minimum
+		{"86400", 3600}, // clamped down to the maximum (the global interval)
+		{"0", 0},
+		{"-5", 0},
+		{"5m", 0},
+		{"", 0},
+	} {
+		if got := h.labelInterval(map[string]string{IntervalLabel: tc.value}); got != tc.want {
+			t.Errorf("label %q: got %d want %d", tc.value, got, tc.want)
+		}
+	}
+	if got := h.labelInterval(nil); got != 0 {
+		t.Errorf("no label: got %d want 0", got)
+	}
+	if got := h.TickInterval(); got != time.Minute {
+		t.Errorf("TickInterval: got %s want 1m", got)
+	}
+}
+
+// hookSigner runs onEnqueue before recording each voucher.
+type hookSigner struct {
+	mockSigner
+	onEnqueue func(v *voucher.SandboxVoucher)
+}
+
+func (s *hookSigner) Enqueue(ctx context.Context, v *voucher.SandboxVoucher) error {
+	s.onEnqueue(v)
+	return s.mockSigner.Enqueue(ctx, v)
+}
+
+func TestRunGeneration_SessionDeletedMidSweep(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+	// Whichever session the sweep bills first, the other one is deleted
+	// (its sandbox was stopped) before the sweep reaches it.
+	var deleted string
+	ms := &hookSigner{onEnqueue: func(v *voucher.SandboxVoucher) {
+		if deleted == "" {
+			deleted = map[string]string{"sb-a": "sb-b", "sb-b": "sb-a"}[v.SandboxID]
+			if _, err := CloseSession(ctx, rdb, deleted); err != nil {
+				t.Error(err)
+			}
+		}
+	}}
+	h := NewEventHandler(rdb, testProvider, big.NewInt(10), big.NewInt(0), new(big.Int), new(big.Int), 3600, ms, zap.NewNop())
+
+	due := time.Now().Unix() - 10
+	for _, id := range []string{"sb-a", "sb-b"} {
+		CreateSession(ctx, rdb, Session{SandboxID: id, Owner: testOwner, Provider: testProvider, NextVoucherAt: due}) //nolint:errcheck
+	}
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	if ms.count() != 1 {
+		t.Fatalf("vouchers: got %d want 1", ms.count())
+	}
+	if got := ms.last().SandboxID; got == deleted {
+		t.Errorf("voucher emitted for %s after its session was deleted", got)
+	}
+	if s, _ := GetSession(ctx, rdb, deleted); s != nil {
+		t.Errorf("deleted session %s recreated: %+v", deleted, s)
+	}
+}
+
+// gettingLister also answers single-sandbox lookups: from found, or
+// daytona.ErrNotFound.
+type gettingLister struct {
+	fakeLister
+	found   map[string]string // sandbox ID → state
+	lookups []string
+}
+
+func (g *gettingLister) GetSandbox(_ context.Context, id string) (*daytona.Sandbox, error) {
+	g.lookups = append(g.lookups, id)
+	state, ok := g.found[id]
+	if !ok {
+		return nil, fmt.Errorf("daytona GetSandbox %s: %w", id, daytona.ErrNotFound)
+	}
+	return &daytona.Sandbox{ID: id, State: state}, nil
+}
+
+func TestRunGeneration_SandboxCheck(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	h := NewEventHandler(rdb, testProvider, big.NewInt(10), big.NewInt(0), new(big.Int), new(big.Int), 60, ms, zap.NewNop())
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	h.SetClock(clk)
+	ctx := context.Background()
+	lister := &gettingLister{
+		fakeLister: fakeLister{sandboxes: []daytona.Sandbox{
+			{ID: "sb-running", State: "started"},
+			{ID: "sb-stopped", State: "stopped"},
+			{ID: "sb-archived", State: "archived"},
+			{ID: "sb-stopping", State: "stopping"},
+			{ID: "sb-error", State: "error"},
+		}},
+		// Running, but not yet in the list.
+		found: map[string]string{"sb-lagging": "started", "sb-new": "started"},
+	}
+	h.SetSandboxCheck(lister, time.Minute)
+
+	for id, startedAt := range map[string]int64{
+		"sb-running":  now.Unix() - 600,
+		"sb-stopped":  now.Unix() - 600,
+		"sb-archived": now.Unix() - 600,
+		"sb-stopping": now.Unix() - 600,
+		"sb-error":    now.Unix() - 600,
+		"sb-lagging":  now.Unix() - 600,
+		"sb-gone":     now.Unix() - 600,
+		"sb-new":      now.Unix() - 5, // within the list-lag grace
+	} {
+		CreateSession(ctx, rdb, Session{SandboxID: id, Owner: testOwner, Provider: testProvider, StartedAt: startedAt, NextVoucherAt: now.Unix()}) //nolint:errcheck
+	}
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	var billed []string
+	for _, v := range ms.vouchers {
+		billed = append(billed, v.SandboxID)
+	}
+	sort.Strings(billed)
+	if strings.Join(billed, ",") != "sb-lagging,sb-new,sb-running" {
+		t.Errorf("billed %v, want sb-lagging, sb-new and sb-running", billed)
+	}
+	// Only a terminal state, or absence confirmed by a lookup, closes the
+	// session; a transient state skips this period and keeps it open.
+	for id, open := range map[string]bool{
+		"sb-running": true, "sb-new": true, "sb-lagging": true, "sb-stopping": true, "sb-error": true,
+		"sb-stopped": false, "sb-archived": false, "sb-gone": false,
+	} {
+		if s, _ := GetSession(ctx, rdb, id); (s != nil) != open {
+			t.Errorf("%s: session open=%v, want %v", id, s != nil, open)
+		}
+	}
+	if lister.calls != 1 {
+		t.Errorf("Daytona listed %d times in one sweep, want 1", lister.calls)
+	}
+	sort.Strings(lister.lookups)
+	if strings.Join(lister.lookups, ",") != "sb-gone,sb-lagging" {
+		t.Errorf("looked up %v, want only the unlisted sb-gone and sb-lagging", lister.lookups)
+	}
+
+	// The transient sandbox is billed once it is running again.
+	lister.sandboxes[3].State = "started"
+	clk.Advance(2 * time.Minute)
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if ms.count() != 7 {
+		t.Errorf("vouchers after sb-stopping started: got %d want 7", ms.count())
+	}
+
+	// Daytona unreachable: billing goes on unchecked rather than stalling.
+	lister.err = errors.New("daytona down")
+	clk.Advance(2 * time.Minute)
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if ms.count() != 12 {
+		t.Errorf("vouchers after a failed list: got %d want 12", ms.count())
+	}
+}
+
+// Without single-sandbox lookups, a sandbox missing from the list is skipped
+// rather than closed: the list may lag behind Daytona.
+func TestRunGeneration_SandboxCheck_MissingWithoutLookup(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	h := NewEventHandler(rdb, testProvider, big.NewInt(10), big.NewInt(0), new(big.Int), new(big.Int), 60, ms, zap.NewNop())
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h.SetClock(clock.NewFake(now))
+	ctx := context.Background()
+	h.SetSandboxCheck(&fakeLister{}, time.Minute)
+	CreateSession(ctx, rdb, Session{SandboxID: "sb-unlisted", Owner: testOwner, Provider: testProvider, StartedAt: now.Unix() - 600, NextVoucherAt: now.Unix()}) //nolint:errcheck
+
+	runGeneration(ctx, rdb, h, zap.NewNop())
+
+	if ms.count() != 0 {
+		t.Errorf("vouchers: got %d want 0", ms.count())
+	}
+	if s, _ := GetSession(ctx, rdb, "sb-unlisted"); s == nil {
+		t.Error("session closed on an unconfirmed absence")
+	}
+}
+
+// ── Low-balance warning ───────────────────────────────────────────────────────
+
+// settlingSigner settles every voucher as it is enqueued, debiting the
+// owner's balance, so the balance seen by the generator drops period by period.
+type settlingSigner struct {
+	mockSigner
+	balance *big.Int
+}
+
+func (s *settlingSigner) Enqueue(ctx context.Context, v *voucher.SandboxVoucher) error {
+	s.balance.Sub(s.balance, v.TotalFee)
+	return s.mockSigner.Enqueue(ctx, v)
+}
+
+func (s *settlingSigner) GetBalance(context.Context, common.Address, common.Address) (*big.Int, error) {
+	return new(big.Int).Set(s.balance), nil
+}
+
+// The warning fires on the last period the balance covers, one period before
+// the voucher that would settle as INSUFFICIENT_BALANCE, and only once.
+func TestRunGeneration_LowBalanceWarning(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	period := pricePerSec * testIntervalSec
+	// Create fee, the opening period and three more periods, plus half a
+	// period that never suffices for a fifth.
+	ss := &settlingSigner{balance: big.NewInt(createFeeVal + 4*period + period/2)}
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(createFeeVal),
+		new(big.Int), new(big.Int), testIntervalSec, ss, zap.NewNop())
+	clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+	h.SetClock(clk)
+	h.SetLowBalanceWarning(ss, 1)
+	ctx := context.Background()
+
+	if err := h.OnCreate(ctx, "sb-low", testOwner, 1, 1, nil); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	warnings := func() []events.StreamEvent {
+		evs, err := events.Since(ctx, rdb, testOwner, 0)
+		if err != nil {
+			t.Fatalf("events.Since: %v", err)
+		}
+		var out []events.StreamEvent
+		for _, e := range evs {
+			if e.Type == events.TypeLowBalance {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+
+	for sweep := 1; sweep <= 3; sweep++ {
+		clk.Advance(time.Duration(testIntervalSec) * time.Second)
+		runGeneration(ctx, rdb, h, zap.NewNop())
+		sess, _ := GetSession(ctx, rdb, "sb-low")
+		n := len(warnings())
+		switch {
+		case sweep < 3 && (n != 0 || sess.LowBalanceAt != 0):
+			t.Fatalf("sweep %d: balance %s covers the next period, got %d warnings, flag %d", sweep, ss.balance, n, sess.LowBalanceAt)
+		case sweep == 3 && (n != 1 || sess.LowBalanceAt != clk.Now().Unix()):
+			t.Fatalf("sweep 3: balance %s is below one period, got %d warnings, flag %d", ss.balance, n, sess.LowBalanceAt)
+		}
+	}
+	if ss.balance.Int64() >= period {
+		t.Fatalf("balance %s should no longer cover a period", ss.balance)
+	}
+	w := warnings()[0]
+	if w.SandboxID != "sb-low" || w.Amount != ss.balance.String() {
+		t.Errorf("warning: got %+v", w)
+	}
+
+	// The next sweep charges the period the balance cannot cover (the voucher
+	// that would stop the sandbox) without warning again.
+	clk.Advance(time.Duration(testIntervalSec) * time.Second)
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if ss.balance.Sign() >= 0 {
+		t.Fatalf("fifth period should overdraw the balance, got %s", ss.balance)
+	}
+	if n := len(warnings()); n != 1 {
+		t.Errorf("warning repeated: %d warnings", n)
+	}
+
+	// A top-up clears the flag.
+	ss.balance.Add(ss.balance, big.NewInt(10*period))
+	clk.Advance(time.Duration(testIntervalSec) * time.Second)
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if sess, _ := GetSession(ctx, rdb, "sb-low"); sess.LowBalanceAt != 0 {
+		t.Errorf("flag not cleared after top-up: %d", sess.LowBalanceAt)
+	}
+}
+
+// ── Clock jumps ───────────────────────────────────────────────────────────────
+
+// A forward clock jump between sweeps (the wall clock moving further than
+// the monotonic one) is billed as one nominal period from the new now, not as
+// a catch-up of the skipped span; a backward jump bills nothing until the
+// clock passes the prepaid period again. Both are logged.
+func TestRunGeneration_ClockJump(t *testing.T) {
+	ms := &mockSigner{}
+	h, _ := newTestHandler(t, ms)
+	start := time.Unix(1_700_000_000, 0)
+	clk, mono := clock.NewFake(start), clock.NewFake(start)
+	h.SetClock(clk)
+	h.monotonic = mono.Now
+	h.SetMaxClockSkew(time.Minute)
+	ctx := context.Background()
+	core, logs := observer.New(zap.WarnLevel)
+	log := zap.New(core)
+	interval := time.Duration(testIntervalSec) * time.Second
+	advance := func(d time.Duration) { clk.Advance(d); mono.Advance(d) }
+
+	if err := h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	advance(interval)
+	runGeneration(ctx, h.rdb, h, log)
+	if ms.count() != 3 || logs.FilterMessage("clock_jump").Len() != 0 {
+		t.Fatalf("regular sweep: %d vouchers, %d clock_jump logs", ms.count(), logs.FilterMessage("clock_jump").Len())
+	}
+
+	// NTP steps the clock a day ahead: one period from the new now.
+	clk.Advance(24 * time.Hour)
+	runGeneration(ctx, h.rdb, h, log)
+	if ms.count() != 4 {
+		t.Fatalf("after forward jump: want 1 more voucher, got %d total", ms.count())
+	}
+	u := ms.last().Usage
+	if now := clk.Now().Unix(); u.PeriodStart != now || u.PeriodEnd != now+testIntervalSec {
+		t.Errorf("period after forward jump: [%d, %d), want [%d, %d)", u.PeriodStart, u.PeriodEnd, now, now+testIntervalSec)
+	}
+	if logs.FilterMessage("clock_jump").Len() != 1 {
+		t.Errorf("forward jump not logged")
+	}
+	advance(interval)
+	runGeneration(ctx, h.rdb, h, log)
+	if ms.count() != 5 || ms.last().Usage.PeriodStart != u.PeriodEnd {
+		t.Errorf("sweep after jump should continue from %d, got %d vouchers, last %+v", u.PeriodEnd, ms.count(), ms.last().Usage)
+	}
+
+	// The clock steps back a day: nothing is due, nothing negative is billed.
+	clk.Set(clk.Now().Add(-24 * time.Hour))
+	runGeneration(ctx, h.rdb, h, log)
+	if ms.count() != 5 {
+		t.Errorf("after backward jump: want no voucher, got %d total", ms.count())
+	}
+	if logs.FilterMessage("clock_jump").Len() != 2 {
+		t.Errorf("backward jump not logged")
+	}
+}
+
+// A sweep that runs late (a stalled generator, a Redis outage) is not a
+// clock jump: the sandboxes really ran, so the elapsed periods are billed.
+func TestRunGeneration_LateSweepIsNotAClockJump(t *testing.T) {
+	ms := &mockSigner{}
+	h, _ := newTestHandler(t, ms)
+	start := time.Unix(1_700_000_000, 0)
+	clk, mono := clock.NewFake(start), clock.NewFake(start)
+	h.SetClock(clk)
+	h.monotonic = mono.Now
+	h.SetMaxClockSkew(time.Minute)
+	ctx := context.Background()
+
+	if err := h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil); err != nil {
+		t.Fatalf("OnCreate: %v", err)
+	}
+	runGeneration(ctx, h.rdb, h, zap.NewNop())
+	sess, _ := GetSession(ctx, h.rdb, testSandbox)
+	late := time.Duration(10*testIntervalSec) * time.Second
+	clk.Advance(late)
+	mono.Advance(late)
+
+	core, logs := observer.New(zap.WarnLevel)
+	runGeneration(ctx, h.rdb, h, zap.New(core))
+	if got := ms.last().Usage.PeriodStart; got != sess.NextVoucherAt {
+		t.Errorf("period after a late sweep should continue from %d, got %d", sess.NextVoucherAt, got)
+	}
+	if logs.FilterMessage("clock_jump").Len() != 0 {
+		t.Errorf("late sweep logged as clock_jump")
+	}
+}
@@ -0,0 +1,109 @@
+package billing
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Caps on the user labels echoed into sessions, vouchers and receipts. Labels
+// are stored with every voucher in the queue and every receipt, so the set is
+// kept small regardless of what the user attached to the sandbox.
+const (
+	maxReceiptLabels = 8
+	maxLabelKeyLen   = 64
+	maxLabelValueLen = 128
+)
+
+// internalLabelPrefixes mark labels set by Daytona or the proxy itself
+// (daytona-owner, 0g-sealed, 0g-image, …); they are never echoed.
+var internalLabelPrefixes = []string{"daytona-", "0g-"}
+
+// SetReceiptLabels configures which sandbox label keys are echoed into the
+// billing session and its settlement receipts (RECEIPT_LABELS). Keys beyond
+// maxReceiptLabels are ignored. With no keys configured nothing is echoed.
+func (h *EventHandler) SetReceiptLabels(keys []string) {
+	h.receiptLabels = nil
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if k == "" || len(k) > maxLabelKeyLen || isInternalLabel(k) {
+			continue
+		}
+		h.receiptLabels = append(h.receiptLabels, k)
+		if len(h.receiptLabels) == maxReceiptLabels {
+			break
+		}
+	}
+}
+
+// echoLabels returns the configured subset of a sandbox's user labels, with
+// values truncated to at most maxLabelValueLen bytes on a rune boundary, so a
+// multi-byte character is dropped whole rather than split. Internal labels (daytona-owner,
+// 0g-sealed, …) are never echoed. Returns nil when nothing matches.
+func (h *EventHandler) echoLabels(labels map[string]string) map[string]string {
+	var out map[string]string
+	for _, k := range h.receiptLabels {
+		v, ok := labels[k]
+		if !ok {
+			continue
+		}
+		if len(v) > maxLabelValueLen {
+			n := maxLabelValueLen
+			for n > 0 && !utf8.RuneStart(v[n]) {
+				n--
+			}
+			v = v[:n]
+		}
+		if out == nil {
+			out = make(map[string]string, len(h.receiptLabels))
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// BillingLabel set to BillingDisabled exempts a sandbox from billing when its
+// owner is a trusted wallet (see SetTrustedWallets): no session is opened and
+// no voucher is emitted. Used for the provider's own sandboxes (monitoring,
+// CI).
+const (
+	BillingLabel    = "billing"
+	BillingDisabled = "disabled"
+)
+
+// SetTrustedWallets sets the wallets whose sandboxes may opt out of billing
+// with BillingLabel (BILLING_TRUSTED_WALLETS). The label is ignored on
+// sandboxes of any other wallet, which are billed as usual.
+func (h *EventHandler) SetTrustedWallets(addrs []string) {
+	h.trustedWallets = make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		if a = strings.TrimSpace(a); a != "" {
+			h.trustedWallets[strings.ToLower(a)] = true
+		}
+	}
+}
+
+// unbilled reports whether a sandbox is exempt from billing: it carries
+// BillingLabel=BillingDisabled and its owner is a trusted wallet. The label on
+// an untrusted wallet's sandbox is logged and ignored.
+func (h *EventHandler) unbilled(sandboxID, ownerAddr string, labels map[string]string) bool {
+	if labels[BillingLabel] != BillingDisabled {
+		return false
+	}
+	if !h.trustedWallets[strings.ToLower(ownerAddr)] {
+		h.log.Warn("ignoring "+BillingLabel+"="+BillingDisabled+" label from untrusted wallet",
+			zap.String("sandbox", sandboxID), zap.String("owner", ownerAddr))
+		return false
+	}
+	return true
+}
+
+func isInternalLabel(key string) bool {
+	for _, p := range internalLabelPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// pendingTTL bounds how long a sandbox's pending index outlives its last
+// enqueue, in case a voucher leaves the queue without being cleared.
+const pendingTTL = 7 * 24 * time.Hour
+
+// PendingVoucher is a queued voucher that has not been settled yet: signed
+// charges awaiting submission, or parked during a key rotation.
+type PendingVoucher struct {
+	TotalFee   string `json:"total_fee"`
+	UsageHash  string `json:"usage_hash"`
+	Nonce      string `json:"nonce,omitempty"` // assigned when the settler signs it; empty until then
+	EnqueuedAt int64  `json:"enqueued_at"`
+}
+
+func pendingKey(sandboxID string) string {
+	return fmt.Sprintf(voucher.PendingKeyFmt, sandboxID)
+}
+
+func pendingEntry(v *voucher.SandboxVoucher) ([]byte, error) {
+	p := PendingVoucher{UsageHash: common.Hash(v.UsageHash).Hex(), EnqueuedAt: v.EnqueuedAt}
+	if v.TotalFee != nil {
+		p.TotalFee = v.TotalFee.String()
+	}
+	if v.Nonce != nil {
+		p.Nonce = v.Nonce.String()
+	}
+	return json.Marshal(p)
+}
+
+// updatePendingScript overwrites a pending entry only if it still exists, so
+// a late update cannot resurrect a voucher that has already been cleared.
+//
+// KEYS[1] = pending key
+// ARGV[1] = field, ARGV[2] = entry
+var updatePendingScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+  redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+return 0
+`)
+
+// updatePendingNonce records the nonce Sign assigned to v in its pending entry.
+func (s *Signer) updatePendingNonce(ctx context.Context, v *voucher.SandboxVoucher) {
+	if v.SandboxID == "" {
+		return
+	}
+	entry, err := pendingEntry(v)
+	if err != nil {
+		return
+	}
+	updatePendingScript.Run(ctx, s.rdb, []string{pendingKey(v.SandboxID)}, v.PendingField(), string(entry)) //nolint:errcheck
+}
+
+// backfillPendingScript indexes a queued voucher only while its item is still
+// in the queue, so a voucher the settler pops (and clears) concurrently is
+// not indexed after the fact and left listed until pendingTTL.
+//
+// KEYS[1] = queue, KEYS[2] = pending key
+// ARGV[1] = queue item, ARGV[2] = field, ARGV[3] = entry, ARGV[4] = pendingTTL (seconds)
+// Returns 1 if the entry was added.
+var backfillPendingScript = redis.NewScript(`
+if not redis.call('LPOS', KEYS[1], ARGV[1]) then
+  return 0
+end
+if redis.call('HSETNX', KEYS[2], ARGV[2], ARGV[3]) == 0 then
+  return 0
+end
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+return 1
+`)
+
+// BackfillPending indexes v, read from item in queueKey, under its sandbox
+// unless it already is, for vouchers queued before the pending index existed.
+// An existing entry is left alone: it may carry a nonce the queued copy
+// lacks. The entry is only written while item is still queued, so the
+// backfill can run alongside a settler. It reports whether an entry was (or,
+// with dryRun, would be) added.
+func BackfillPending(ctx context.Context, rdb *redis.Client, queueKey, item string, v *voucher.SandboxVoucher, dryRun bool) (bool, error) {
+	if v.SandboxID == "" {
+		return false, nil
+	}
+	key := pendingKey(v.SandboxID)
+	if dryRun {
+		exists, err := rdb.HExists(ctx, key, v.PendingField()).Result()
+		return !exists, err
+	}
+	entry, err := pendingEntry(v)
+	if err != nil {
+		return false, err
+	}
+	added, err := backfillPendingScript.Run(ctx, rdb, []string{queueKey, key},
+		item, v.PendingField(), string(entry), int64(pendingTTL.Seconds())).Int()
+	if err != nil {
+		return false, err
+	}
+	return added == 1, nil
+}
+
+// ListPending returns sandboxID's vouchers that are queued but not yet
+// settled, oldest first. Vouchers enqueued by older builds are not indexed.
+func ListPending(ctx context.Context, rdb *redis.Client, sandboxID string) ([]PendingVoucher, error) {
+	raw, err := rdb.HGetAll(ctx, pendingKey(sandboxID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]PendingVoucher, 0, len(raw))
+	for _, s := range raw {
+		var p PendingVoucher
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			continue
+		}
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].EnqueuedAt != pending[j].EnqueuedAt {
+			return pending[i].EnqueuedAt < pending[j].EnqueuedAt
+		}
+		return pending[i].UsageHash < pending[j].UsageHash
+	})
+	return pending, nil
+}
@@ -0,0 +1,128 @@
+package billing
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Period alignments (PERIOD_ALIGNMENT) control where compute periods start
+// and end.
+const (
+	// PeriodRelative runs full voucherIntervalSec periods back to back from
+	// the session start.
+	PeriodRelative = "relative"
+	// PeriodWallclock ends every period on a multiple of voucherIntervalSec
+	// since the Unix epoch (e.g. every minute on the minute), so periods line
+	// up across sandboxes. The first period is the partial remainder up to the
+	// next boundary; later ones are full aligned periods.
+	PeriodWallclock = "wallclock"
+)
+
+// SetPeriodAlignment selects PeriodRelative (the default) or PeriodWallclock.
+func (h *EventHandler) SetPeriodAlignment(mode string) error {
+	switch mode {
+	case "", PeriodRelative:
+		h.periodAlignment = PeriodRelative
+	case PeriodWallclock:
+		h.periodAlignment = PeriodWallclock
+	default:
+		return fmt.Errorf("invalid period alignment %q", mode)
+	}
+	return nil
+}
+
+// IntervalLabel is the sandbox label that overrides the voucher interval for
+// that sandbox, in seconds (see SetIntervalBounds).
+const IntervalLabel = "voucher-interval-sec"
+
+// SetIntervalBounds enables per-sandbox voucher intervals: a new session
+// whose sandbox carries IntervalLabel is billed in periods of that many
+// seconds, clamped to [minSec, maxSec], instead of voucherIntervalSec.
+// maxSec 0 = voucherIntervalSec. minSec 0 (the default) ignores the label.
+func (h *EventHandler) SetIntervalBounds(minSec, maxSec int64) {
+	if maxSec <= 0 {
+		maxSec = h.voucherIntervalSec
+	}
+	h.minIntervalSec, h.maxIntervalSec = minSec, max(maxSec, minSec)
+}
+
+// labelInterval returns the voucher interval IntervalLabel asks for, clamped
+// to the bounds, or 0 (the global interval) when the label is absent, not a
+// positive integer, or overrides are disabled.
+func (h *EventHandler) labelInterval(labels map[string]string) int64 {
+	if h.minIntervalSec <= 0 {
+		return 0
+	}
+	raw, ok := labels[IntervalLabel]
+	if !ok {
+		return 0
+	}
+	sec, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || sec <= 0 {
+		h.log.Warn("ignoring invalid "+IntervalLabel+" label", zap.String("value", raw))
+		return 0
+	}
+	return min(max(sec, h.minIntervalSec), h.maxIntervalSec)
+}
+
+// interval returns a session's voucher interval: intervalSec when set,
+// otherwise voucherIntervalSec.
+func (h *EventHandler) interval(intervalSec int64) int64 {
+	if intervalSec > 0 {
+		return intervalSec
+	}
+	return h.voucherIntervalSec
+}
+
+// TickInterval is how often RunGenerator scans sessions: the global voucher
+// interval, or the shortest per-sandbox one when that is shorter.
+func (h *EventHandler) TickInterval() time.Duration {
+	sec := h.voucherIntervalSec
+	if h.minIntervalSec > 0 {
+		sec = min(sec, h.minIntervalSec)
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// periodEnd returns the end of the compute period of intervalSec seconds
+// (0 = voucherIntervalSec) that starts at start.
+func (h *EventHandler) periodEnd(start, intervalSec int64) int64 {
+	interval := h.interval(intervalSec)
+	if h.periodAlignment == PeriodWallclock && interval > 0 {
+		return (start/interval + 1) * interval
+	}
+	return start + interval
+}
+
+// longestInterval is the longest compute period any session may be billed
+// for at once: the global interval or the per-sandbox maximum.
+func (h *EventHandler) longestInterval() int64 {
+	return max(h.voucherIntervalSec, h.maxIntervalSec)
+}
+
+// clampPeriod bounds a compute period [start, end) to the session's
+// lifetime: it cannot start before the session did (sessionStart, 0 =
+// unknown) or be pre-charged further ahead than one longest interval from
+// now. A period needing the clamp comes from a corrupted session (e.g. an
+// inflated interval_sec) or a generator bug, so it is logged; the clamp
+// bounds the overcharge to the real session duration plus one period.
+func (h *EventHandler) clampPeriod(sandboxID string, sessionStart, start, end int64) (int64, int64) {
+	limit := h.clock.Now().Unix() + h.longestInterval()
+	cStart, cEnd := start, min(end, limit)
+	if sessionStart > 0 {
+		cStart = max(start, sessionStart)
+	}
+	cEnd = max(cEnd, cStart)
+	if cStart != start || cEnd != end {
+		h.log.Warn("compute period clamped to the session's lifetime",
+			zap.String("sandbox", sandboxID),
+			zap.Int64("session_start", sessionStart),
+			zap.Int64("period_start", start), zap.Int64("period_end", end),
+			zap.Int64("clamped_start", cStart), zap.Int64("clamped_end", cEnd),
+		)
+	}
+	return cStart, cEnd
+}
@@ -0,0 +1,168 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+)
+
+// reapGraceSec spares sessions opened this recently from the reaper, in case
+// Daytona's list lags behind a create.
+const reapGraceSec = 60
+
+// SandboxLister lists the sandboxes Daytona knows about. *daytona.Client
+// satisfies it.
+type SandboxLister interface {
+	ListSandboxes(ctx context.Context) ([]daytona.Sandbox, error)
+}
+
+// RunSessionReaper closes, every interval, the billing sessions whose sandbox
+// no longer exists in Daytona — sessions left behind when a stop, delete or
+// archive event was missed (hook not called, crash). See reapSessions.
+func RunSessionReaper(ctx context.Context, rdb *redis.Client, h *EventHandler, dtona SandboxLister, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Info("session reaper started", zap.Duration("interval", interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("session reaper stopped")
+			return
+		case <-ticker.C:
+			reapSessions(ctx, rdb, h, dtona, log)
+		}
+	}
+}
+
+// reapSessions closes every session whose sandbox is missing from Daytona or
+// destroyed, and returns how many it closed.
+func reapSessions(ctx context.Context, rdb *redis.Client, h *EventHandler, dtona SandboxLister, log *zap.Logger) int {
+	reaped, err := reap(ctx, rdb, h, dtona, 0, false, log)
+	if err != nil {
+		log.Warn("reaper: sweep", zap.Error(err))
+	}
+	return len(reaped)
+}
+
+// Reap reasons reported in ReapedSession.
+const (
+	ReapMissing = "missing" // sandbox gone from Daytona or destroyed
+	ReapStale   = "stale"   // not billed for longer than the threshold
+)
+
+var reapMessages = map[string]string{
+	ReapMissing: "no longer exists",
+	ReapStale:   "was not billed for too long",
+}
+
+// ReapedSession is a session closed (or, in a dry run, that would be closed)
+// by ReapSessions.
+type ReapedSession struct {
+	SandboxID  string `json:"sandbox_id"`
+	Owner      string `json:"owner"`
+	Reason     string `json:"reason"` // ReapMissing or ReapStale
+	StartedAt  int64  `json:"started_at"`
+	AccruedFee string `json:"accrued_fee"` // neuron charged in the session, final voucher included
+}
+
+// ReapSessions closes the sessions the periodic reaper would (sandbox missing
+// from Daytona or destroyed) and, when staleSec > 0, those not billed for
+// more than staleSec seconds: since the later of their start and their last
+// voucher. Paused sessions are never stale. Each is closed like a stop,
+// charging unbilled time in a final voucher; a stale session's sandbox is
+// left running, unbilled. dryRun reports the sessions without closing them.
+func (h *EventHandler) ReapSessions(ctx context.Context, dtona SandboxLister, staleSec int64, dryRun bool) ([]ReapedSession, error) {
+	return reap(ctx, h.rdb, h, dtona, staleSec, dryRun, h.log)
+}
+
+// reap implements ReapSessions. Sessions are scanned before the sandboxes are
+// listed, so a sandbox created mid-sweep is never mistaken for a missing one.
+func reap(ctx context.Context, rdb *redis.Client, h *EventHandler, dtona SandboxLister, staleSec int64, dryRun bool, log *zap.Logger) ([]ReapedSession, error) {
+	sessions, err := ScanAllSessions(ctx, rdb)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	list, err := dtona.ListSandboxes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list sandboxes: %w", err)
+	}
+	live := make(map[string]bool, len(list))
+	for _, sb := range list {
+		switch sb.State {
+		case "destroyed", "destroying":
+		default:
+			live[sb.ID] = true
+		}
+	}
+
+	now := h.clock.Now().Unix()
+	var reaped []ReapedSession
+	for i := range sessions {
+		s := &sessions[i]
+		var reason string
+		switch {
+		case !live[s.SandboxID] && now-s.StartedAt >= reapGraceSec:
+			reason = ReapMissing
+		case staleSec > 0 && s.PausedAt == 0 && now-max(s.StartedAt, s.LastVoucherAt) > staleSec:
+			reason = ReapStale
+		default:
+			continue
+		}
+		r := ReapedSession{SandboxID: s.SandboxID, Owner: s.Owner, Reason: reason, StartedAt: s.StartedAt, AccruedFee: s.AccruedFee}
+		if !dryRun {
+			accrued, closed, err := h.reapSession(ctx, s.SandboxID, reason, now)
+			if err != nil {
+				log.Error("reaper: close session", zap.String("sandbox", s.SandboxID), zap.Error(err))
+			}
+			if !closed {
+				continue
+			}
+			r.AccruedFee = accrued
+			log.Warn("reaper: closed session", zap.String("sandbox", s.SandboxID), zap.String("owner", s.Owner), zap.String("reason", reason))
+		}
+		reaped = append(reaped, r)
+	}
+	return reaped, nil
+}
+
+// reapSession closes the session of a sandbox that no longer exists, or
+// that was not billed for too long (reason ReapMissing or ReapStale). Time
+// between the end of the pre-charged period and now that the generator has
+// not billed yet is charged in a final voucher; paused time is not. The
+// session is closed first, so a racing stop or delete cannot see it too.
+// Returns the session's accrued fee, final voucher included, and whether this
+// call closed the session.
+func (h *EventHandler) reapSession(ctx context.Context, sandboxID, reason string, now int64) (string, bool, error) {
+	s, err := CloseSession(ctx, h.rdb, sandboxID)
+	if err != nil || s == nil {
+		return "", false, err
+	}
+	accrued := s.AccruedFee
+	if s.PausedAt == 0 && now > s.NextVoucherAt {
+		start, end := h.clampPeriod(sandboxID, s.StartedAt, s.NextVoucherAt, now)
+		fee, err := h.emitUsageVoucher(ctx, sandboxID, s.Owner, h.sessionPrice(s), start, end, s.Labels)
+		if err != nil {
+			return accrued, true, fmt.Errorf("final voucher: %w", err)
+		}
+		accrued = addFee(accrued, fee)
+	}
+	_ = events.Push(ctx, h.rdb, events.Event{
+		Type:      events.TypeStopped,
+		Message:   fmt.Sprintf("Sandbox %s %s, billing session closed, %s neuron charged in session", sandboxID, reapMessages[reason], accrued),
+		SandboxID: sandboxID,
+		User:      s.Owner,
+		Amount:    accrued,
+	})
+	return accrued, true, nil
+}
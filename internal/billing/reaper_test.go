@@ -0,0 +1,214 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+type fakeLister struct {
+	sandboxes []daytona.Sandbox
+	err       error
+	calls     int
+}
+
+func (f *fakeLister) ListSandboxes(context.Context) ([]daytona.Sandbox, error) {
+	f.calls++
+	return f.sandboxes, f.err
+}
+
+func TestReapSessions_ClosesSessionsOfMissingSandboxes(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(3600)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h.SetClock(clock.NewFake(now))
+	started := now.Unix() - 2*intervalSec
+
+	for _, s := range []Session{
+		{SandboxID: "sb-live", NextVoucherAt: now.Unix() + 100},
+		{SandboxID: "sb-gone", NextVoucherAt: now.Unix() - 30, AccruedFee: "1000"}, // 30s unbilled
+		{SandboxID: "sb-destroyed", NextVoucherAt: now.Unix() + 100},
+		{SandboxID: "sb-paused", NextVoucherAt: now.Unix() - 30, PausedAt: now.Unix() - 60},
+		{SandboxID: "sb-new", NextVoucherAt: now.Unix() + 100, StartedAt: now.Unix() - 5}, // within grace
+	} {
+		s.Owner, s.Provider, s.PricePerSec = testOwner, testProvider, "100"
+		if s.StartedAt == 0 {
+			s.StartedAt = started
+		}
+		if err := CreateSession(ctx, rdb, s); err != nil {
+			t.Fatal(err)
+		}
+		if s.PausedAt != 0 {
+			PauseSession(ctx, rdb, s.SandboxID, s.PausedAt, 0) //nolint:errcheck
+		}
+	}
+	lister := &fakeLister{sandboxes: []daytona.Sandbox{
+		{ID: "sb-live", State: "started"},
+		{ID: "sb-destroyed", State: "destroyed"},
+	}}
+
+	if n := reapSessions(ctx, rdb, h, lister, zap.NewNop()); n != 3 {
+		t.Errorf("reaped %d sessions, want 3", n)
+	}
+	for id, want := range map[string]bool{"sb-live": true, "sb-new": true, "sb-gone": false, "sb-destroyed": false, "sb-paused": false} {
+		if s, _ := GetSession(ctx, rdb, id); (s != nil) != want {
+			t.Errorf("%s: session present=%v, want %v", id, s != nil, want)
+		}
+	}
+	running, _ := OwnerSandboxes(ctx, rdb, testOwner)
+	if len(running) != 2 {
+		t.Errorf("owner's running set %v, want sb-live and sb-new", running)
+	}
+
+	// Only sb-gone had unbilled, unpaused time: one final voucher for it.
+	if ms.count() != 1 {
+		t.Fatalf("final vouchers: got %d want 1", ms.count())
+	}
+	v := ms.last()
+	if v.SandboxID != "sb-gone" || v.TotalFee.Int64() != 30*100 {
+		t.Errorf("final voucher: sandbox %s fee %s, want sb-gone 3000", v.SandboxID, v.TotalFee)
+	}
+	if v.Usage.PeriodStart != now.Unix()-30 || v.Usage.PeriodEnd != now.Unix() {
+		t.Errorf("final voucher period [%d, %d), want [%d, %d)", v.Usage.PeriodStart, v.Usage.PeriodEnd, now.Unix()-30, now.Unix())
+	}
+}
+
+func TestReapSessions_ListErrorReapsNothing(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), 3600, &mockSigner{}, zap.NewNop())
+	ctx := context.Background()
+	CreateSession(ctx, rdb, Session{SandboxID: "sb-1", Owner: testOwner, Provider: testProvider}) //nolint:errcheck
+
+	if n := reapSessions(ctx, rdb, h, &fakeLister{err: errors.New("daytona down")}, zap.NewNop()); n != 0 {
+		t.Errorf("reaped %d sessions while Daytona was unreachable", n)
+	}
+	if s, _ := GetSession(ctx, rdb, "sb-1"); s == nil {
+		t.Error("session removed although Daytona could not be listed")
+	}
+}
+
+func TestReapSessions_StaleThresholdAndDryRun(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), 3600, ms, zap.NewNop())
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC).Unix()
+	h.SetClock(clock.NewFake(time.Unix(now, 0)))
+	const day = int64(86400)
+
+	for _, s := range []Session{
+		// Started long ago but billed recently: not stale.
+		{SandboxID: "sb-busy", StartedAt: now - 3*day, LastVoucherAt: now - 100, NextVoucherAt: now + 3500},
+		{SandboxID: "sb-stale", StartedAt: now - 3*day, LastVoucherAt: now - 2*day, NextVoucherAt: now - 2*day + 3600},
+		{SandboxID: "sb-paused", StartedAt: now - 3*day, LastVoucherAt: now - 2*day, NextVoucherAt: now - 2*day + 3600, PausedAt: now - 2*day + 60},
+		{SandboxID: "sb-gone", StartedAt: now - 600, LastVoucherAt: now - 600, NextVoucherAt: now + 3000},
+	} {
+		s.Owner, s.Provider, s.PricePerSec = testOwner, testProvider, "100"
+		if err := CreateSession(ctx, rdb, s); err != nil {
+			t.Fatal(err)
+		}
+		if s.PausedAt != 0 {
+			PauseSession(ctx, rdb, s.SandboxID, s.PausedAt, 0) //nolint:errcheck
+		}
+	}
+	lister := &fakeLister{sandboxes: []daytona.Sandbox{
+		{ID: "sb-busy", State: "started"},
+		{ID: "sb-stale", State: "started"},
+		{ID: "sb-paused", State: "started"},
+	}}
+
+	preview, err := h.ReapSessions(ctx, lister, day, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, r := range preview {
+		got[r.SandboxID] = r.Reason
+	}
+	if len(got) != 2 || got["sb-stale"] != ReapStale || got["sb-gone"] != ReapMissing {
+		t.Fatalf("dry run: %+v, want sb-stale stale and sb-gone missing", preview)
+	}
+	if s, _ := GetSession(ctx, rdb, "sb-stale"); s == nil || ms.count() != 0 {
+		t.Fatal("dry run closed a session or emitted a voucher")
+	}
+
+	reaped, err := h.ReapSessions(ctx, lister, day, false)
+	if err != nil || len(reaped) != 2 {
+		t.Fatalf("reap: %+v, %v", reaped, err)
+	}
+	for id, want := range map[string]bool{"sb-busy": true, "sb-paused": true, "sb-stale": false, "sb-gone": false} {
+		if s, _ := GetSession(ctx, rdb, id); (s != nil) != want {
+			t.Errorf("%s: session present=%v, want %v", id, s != nil, want)
+		}
+	}
+	// The stale session's unbilled time since its pre-charged period ended is
+	// charged in a final voucher.
+	if ms.count() != 1 || ms.last().SandboxID != "sb-stale" {
+		t.Fatalf("final vouchers: %d, want one for sb-stale", ms.count())
+	}
+	if fee := ms.last().TotalFee.Int64(); fee != (2*day-3600)*100 {
+		t.Errorf("final fee %d, want %d", fee, (2*day-3600)*100)
+	}
+}
+
+func TestSessionTTL_RefreshedByVouchersDroppedWhilePaused(t *testing.T) {
+	rdb, mr := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(60)
+	h := NewEventHandler(rdb, testProvider, big.NewInt(pricePerSec), big.NewInt(0), new(big.Int), new(big.Int), intervalSec, ms, zap.NewNop())
+	const ttl = 5 * time.Minute
+	h.SetSessionTTL(ttl)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	ctx := context.Background()
+	key := sessionKey(testSandbox)
+
+	if err := h.OnCreate(ctx, testSandbox, testOwner, 1, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := mr.TTL(key); got != ttl {
+		t.Fatalf("TTL after create: got %s want %s", got, ttl)
+	}
+
+	// Each compute voucher restarts the TTL.
+	mr.FastForward(ttl - time.Second)
+	clk.Advance(time.Duration(intervalSec) * time.Second)
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if got := mr.TTL(key); got != ttl {
+		t.Errorf("TTL after voucher: got %s want %s", got, ttl)
+	}
+
+	// A paused session emits no vouchers, so it must not expire.
+	if err := h.PauseBilling(ctx, testSandbox); err != nil {
+		t.Fatal(err)
+	}
+	if got := mr.TTL(key); got != 0 {
+		t.Errorf("TTL while paused: got %s want none", got)
+	}
+	if err := h.ResumeBilling(ctx, testSandbox); err != nil {
+		t.Fatal(err)
+	}
+	if got := mr.TTL(key); got != ttl {
+		t.Errorf("TTL after resume: got %s want %s", got, ttl)
+	}
+
+	// No voucher for a whole TTL (e.g. a missed stop and a dead generator):
+	// the session expires and leaves the owner's running set.
+	mr.FastForward(ttl)
+	if s, _ := GetSession(ctx, rdb, testSandbox); s != nil {
+		t.Error("session did not expire")
+	}
+	if running, _ := OwnerSandboxes(ctx, rdb, testOwner); len(running) != 0 {
+		t.Errorf("expired session still counted as running: %v", running)
+	}
+}
@@ -0,0 +1,268 @@
+package billing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const (
+	rotationPollInterval = 30 * time.Second
+	// rotationDeferredKeyFmt holds vouchers of users who have not yet
+	// acknowledged the rotated signer; %s = provider address.
+	rotationDeferredKeyFmt = "rotation:deferred:%s"
+)
+
+// RotationSource reads the provider's on-chain signer and users' ack state.
+// Satisfied by *chain.Client; decoupled here so the billing package does not
+// import chain.
+type RotationSource interface {
+	SignerSource
+	IsAcknowledged(ctx context.Context, user common.Address) (bool, error)
+}
+
+// Rotation manages a TEE key rotation window.
+//
+// The Signer holds both the incoming key (from the TEE) and the outgoing one,
+// and signs with whichever matches the contract's current teeSignerAddress,
+// so settlement continues whether or not the provider has updated its
+// service on-chain yet. The contract only accepts the current signer, and a
+// signer change bumps signerVersion, so users who have not re-acknowledged
+// get NOT_ACKNOWLEDGED regardless of the key used. Until the cutoff their
+// vouchers are parked instead of stopping their sandboxes, and re-queued as
+// soon as they re-acknowledge; after the cutoff everything parked is
+// re-queued and settles (or stops the sandbox) as usual. A voucher the
+// contract rejects as INVALID_SIGNATURE because the on-chain signer changed
+// after it was signed is re-queued to be signed with the new signer's key
+// (see Signer.ResignMismatched).
+type Rotation struct {
+	src         RotationSource
+	signer      *Signer
+	rdb         *redis.Client
+	cutoff      time.Time
+	deferredKey string
+	queueKey    string
+	log         *zap.Logger
+
+	mu            sync.Mutex
+	onchainSigner common.Address
+	signerVersion *big.Int
+	checkedAt     time.Time
+	lastErr       string
+}
+
+// RotationStatus is the admin view of a rotation window.
+type RotationStatus struct {
+	Active           bool   `json:"active"` // before the cutoff
+	Cutoff           string `json:"cutoff"`
+	CurrentKey       string `json:"current_key"`  // incoming TEE key
+	PreviousKey      string `json:"previous_key"` // outgoing key
+	SigningKey       string `json:"signing_key"`  // key Sign currently uses
+	OnchainSigner    string `json:"onchain_signer,omitempty"`
+	SignerVersion    string `json:"signer_version,omitempty"`
+	DeferredVouchers int64  `json:"deferred_vouchers"`
+	CheckedAt        int64  `json:"checked_at,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// NewRotation attaches a rotation window to s: prevKey stays usable for
+// signing, and unacknowledged users' vouchers are deferred, until cutoff.
+func NewRotation(src RotationSource, s *Signer, prevKey *ecdsa.PrivateKey, cutoff time.Time, rdb *redis.Client, log *zap.Logger) *Rotation {
+	r := &Rotation{
+		src:         src,
+		signer:      s,
+		rdb:         rdb,
+		cutoff:      cutoff,
+		deferredKey: fmt.Sprintf(rotationDeferredKeyFmt, s.providerAddr.Hex()),
+		queueKey:    fmt.Sprintf(voucher.VoucherQueueKeyFmt, s.providerAddr.Hex()),
+		log:         log,
+	}
+	s.keyMu.Lock()
+	s.prevKey = prevKey
+	s.rotation = r
+	if s.signerSrc == nil {
+		s.signerSrc = src
+	}
+	s.keyMu.Unlock()
+	return r
+}
+
+// Active reports whether the rotation window is still open.
+func (r *Rotation) Active() bool {
+	return r.signer.clock.Now().Before(r.cutoff)
+}
+
+// Run reconciles the signing key with the chain and releases deferred
+// vouchers every rotationPollInterval. Once past the cutoff it releases every
+// deferred voucher, switches signing to the current key for good, and returns.
+func (r *Rotation) Run(ctx context.Context) {
+	r.log.Info("TEE key rotation window open",
+		zap.String("current_key", crypto.PubkeyToAddress(r.signer.privKey.PublicKey).Hex()),
+		zap.String("previous_key", crypto.PubkeyToAddress(r.signer.prevKey.PublicKey).Hex()),
+		zap.Time("cutoff", r.cutoff),
+	)
+	t := time.NewTicker(rotationPollInterval)
+	defer t.Stop()
+	for {
+		r.reconcile(ctx)
+		r.releaseDeferred(ctx, !r.Active())
+		if !r.Active() {
+			// The outgoing key is not used past the cutoff.
+			r.signer.keyMu.Lock()
+			r.signer.usePrev = false
+			r.signer.keyMu.Unlock()
+			r.log.Info("TEE key rotation window closed — signing with the current key only")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// reconcile points the signer at the held key matching the on-chain signer.
+func (r *Rotation) reconcile(ctx context.Context) {
+	addr, version, err := r.src.ServiceSigner(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.lastErr = err.Error()
+		r.log.Warn("rotation: read on-chain signer", zap.Error(err))
+		return
+	}
+	r.onchainSigner, r.signerVersion, r.checkedAt, r.lastErr = addr, version, r.signer.clock.Now(), ""
+	if !r.signer.selectKey(addr) {
+		r.lastErr = "on-chain signer matches neither held key"
+		r.log.Error("rotation: on-chain TEE signer matches neither the current nor the previous key — vouchers will be rejected",
+			zap.String("onchain_signer", addr.Hex()),
+		)
+	}
+}
+
+// releaseDeferred re-queues deferred vouchers whose user has re-acknowledged,
+// or all of them when all is set.
+func (r *Rotation) releaseDeferred(ctx context.Context, all bool) {
+	raw, err := r.rdb.LRange(ctx, r.deferredKey, 0, -1).Result()
+	if err != nil {
+		r.log.Warn("rotation: read deferred vouchers", zap.Error(err))
+		return
+	}
+	acked := make(map[common.Address]bool)
+	for _, item := range raw {
+		var v voucher.SandboxVoucher
+		plain, err := r.signer.codec.Open(item)
+		if err != nil {
+			// Sealed under a key no longer configured: leave it for an operator.
+			r.log.Warn("rotation: decrypt deferred voucher", zap.Error(err))
+			continue
+		}
+		if err := json.Unmarshal(plain, &v); err != nil {
+			r.rdb.LRem(ctx, r.deferredKey, 1, item)
+			continue
+		}
+		if !all {
+			ok, seen := acked[v.User]
+			if !seen {
+				ok, err = r.src.IsAcknowledged(ctx, v.User)
+				if err != nil {
+					continue // retry next tick
+				}
+				acked[v.User] = ok
+			}
+			if !ok {
+				continue
+			}
+		}
+		pipe := r.rdb.TxPipeline()
+		pipe.RPush(ctx, r.queueKey, item)
+		pipe.LRem(ctx, r.deferredKey, 1, item)
+		if _, err := pipe.Exec(ctx); err != nil {
+			r.log.Warn("rotation: re-queue deferred voucher", zap.String("sandbox", v.SandboxID), zap.Error(err))
+			continue
+		}
+		r.log.Info("rotation: deferred voucher re-queued",
+			zap.String("sandbox", v.SandboxID),
+			zap.String("user", v.User.Hex()),
+			zap.Bool("cutoff_reached", all),
+		)
+	}
+}
+
+// deferVoucher parks v if the window is open. Reports whether it was parked.
+func (r *Rotation) deferVoucher(ctx context.Context, v voucher.SandboxVoucher) bool {
+	if !r.Active() {
+		return false
+	}
+	item, err := r.unsigned(v)
+	if err != nil {
+		return false
+	}
+	if err := r.rdb.RPush(ctx, r.deferredKey, item).Err(); err != nil {
+		r.log.Warn("rotation: defer voucher", zap.String("sandbox", v.SandboxID), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// requeue puts v back on the voucher queue to be signed again. Reports
+// whether it was queued.
+func (r *Rotation) requeue(ctx context.Context, v voucher.SandboxVoucher) bool {
+	item, err := r.unsigned(v)
+	if err != nil {
+		return false
+	}
+	if err := r.rdb.RPush(ctx, r.queueKey, item).Err(); err != nil {
+		r.log.Warn("rotation: re-queue voucher", zap.String("sandbox", v.SandboxID), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// unsigned returns v as a queue item without its nonce and signature, which
+// are reassigned when the voucher is signed again.
+func (r *Rotation) unsigned(v voucher.SandboxVoucher) (string, error) {
+	v.Nonce, v.Signature = nil, nil
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return r.signer.codec.Seal(raw)
+}
+
+// Status returns the rotation state for the admin endpoint.
+func (r *Rotation) Status(ctx context.Context) RotationStatus {
+	st := RotationStatus{
+		Active:      r.Active(),
+		Cutoff:      r.cutoff.UTC().Format(time.RFC3339),
+		CurrentKey:  crypto.PubkeyToAddress(r.signer.privKey.PublicKey).Hex(),
+		PreviousKey: crypto.PubkeyToAddress(r.signer.prevKey.PublicKey).Hex(),
+		SigningKey:  r.signer.SigningAddress().Hex(),
+	}
+	st.DeferredVouchers, _ = r.rdb.LLen(ctx, r.deferredKey).Result()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.onchainSigner != (common.Address{}) {
+		st.OnchainSigner = r.onchainSigner.Hex()
+	}
+	if r.signerVersion != nil {
+		st.SignerVersion = r.signerVersion.String()
+	}
+	if !r.checkedAt.IsZero() {
+		st.CheckedAt = r.checkedAt.Unix()
+	}
+	st.Error = r.lastErr
+	return st
+}
@@ -0,0 +1,195 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+type mockRotationSource struct {
+	signer common.Address
+	acked  map[common.Address]bool
+}
+
+func (m *mockRotationSource) ServiceSigner(context.Context) (common.Address, *big.Int, error) {
+	return m.signer, big.NewInt(2), nil
+}
+
+func (m *mockRotationSource) IsAcknowledged(_ context.Context, user common.Address) (bool, error) {
+	return m.acked[user], nil
+}
+
+func signedBy(t *testing.T, s *Signer) common.Address {
+	t.Helper()
+	v := signRot(t, s, "sb-rot")
+	addr, err := voucher.Verify(&v, testChainID, common.HexToAddress(testContractHex))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	return addr
+}
+
+func TestRotation_SignsWithKeyMatchingChain(t *testing.T) {
+	s, rdb, current := newTestSignerFull(t)
+	prevKey, _ := crypto.GenerateKey()
+	prev := crypto.PubkeyToAddress(prevKey.PublicKey)
+	src := &mockRotationSource{signer: prev}
+	r := NewRotation(src, s, prevKey, time.Now().Add(time.Hour), rdb, zap.NewNop())
+
+	// Provider has not updated its service yet: keep signing with the old key.
+	r.reconcile(context.Background())
+	if got := signedBy(t, s); got != prev {
+		t.Errorf("before on-chain update: signed by %s want %s", got.Hex(), prev.Hex())
+	}
+
+	src.signer = current
+	r.reconcile(context.Background())
+	if got := signedBy(t, s); got != current {
+		t.Errorf("after on-chain update: signed by %s want %s", got.Hex(), current.Hex())
+	}
+
+	// An unknown on-chain signer leaves the choice alone and is reported.
+	src.signer = common.HexToAddress("0x9999999999999999999999999999999999999999")
+	r.reconcile(context.Background())
+	if st := r.Status(context.Background()); st.SigningKey != current.Hex() || st.Error == "" {
+		t.Errorf("unknown signer: got %+v", st)
+	}
+}
+
+func TestRotation_DefersUntilAcknowledged(t *testing.T) {
+	s, rdb, _ := newTestSignerFull(t)
+	ctx := context.Background()
+	prevKey, _ := crypto.GenerateKey()
+	alice := common.HexToAddress("0xA11CE00000000000000000000000000000000001")
+	bob := common.HexToAddress("0xB0B0000000000000000000000000000000000002")
+	src := &mockRotationSource{acked: map[common.Address]bool{}}
+	r := NewRotation(src, s, prevKey, time.Now().Add(time.Hour), rdb, zap.NewNop())
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+
+	for _, u := range []common.Address{alice, bob} {
+		v := voucher.SandboxVoucher{SandboxID: "sb-" + u.Hex()[2:6], User: u, Nonce: big.NewInt(5), Signature: []byte{1}}
+		if !s.DeferUnacknowledged(ctx, v) {
+			t.Fatalf("expected voucher for %s to be deferred", u.Hex())
+		}
+	}
+
+	src.acked[alice] = true
+	r.releaseDeferred(ctx, false)
+	if n := rdb.LLen(ctx, queueKey).Val(); n != 1 {
+		t.Fatalf("queue after alice acked: got %d want 1", n)
+	}
+	if st := r.Status(ctx); st.DeferredVouchers != 1 {
+		t.Errorf("deferred: got %d want 1", st.DeferredVouchers)
+	}
+
+	// At the cutoff everything still parked goes back to the queue.
+	r.releaseDeferred(ctx, true)
+	if n := rdb.LLen(ctx, queueKey).Val(); n != 2 {
+		t.Errorf("queue after cutoff: got %d want 2", n)
+	}
+}
+
+func TestRotation_PastCutoffStopsDeferringAndOldKey(t *testing.T) {
+	s, rdb, current := newTestSignerFull(t)
+	prevKey, _ := crypto.GenerateKey()
+	src := &mockRotationSource{signer: crypto.PubkeyToAddress(prevKey.PublicKey)}
+	r := NewRotation(src, s, prevKey, time.Now().Add(-time.Second), rdb, zap.NewNop())
+
+	if s.DeferUnacknowledged(context.Background(), voucher.SandboxVoucher{SandboxID: "sb-late"}) {
+		t.Error("voucher deferred after cutoff")
+	}
+	r.Run(context.Background()) // returns immediately past the cutoff
+	if got := signedBy(t, s); got != current {
+		t.Errorf("after cutoff: signed by %s want current key %s", got.Hex(), current.Hex())
+	}
+}
+
+// signRot signs a fresh voucher for sandboxID with s.
+func signRot(t *testing.T, s *Signer, sandboxID string) voucher.SandboxVoucher {
+	t.Helper()
+	v := voucher.SandboxVoucher{
+		SandboxID: sandboxID,
+		User:      common.HexToAddress(testOwner),
+		Provider:  common.HexToAddress(testProviderHex),
+		TotalFee:  big.NewInt(1),
+		UsageHash: voucher.BuildUsageHash(sandboxID, 0, 60, 1),
+	}
+	if err := s.Sign(context.Background(), &v); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return v
+}
+
+// The provider switches its on-chain signer (bumping signerVersion) while
+// vouchers signed with the old key are still in flight: the contract rejects
+// them, and they are re-queued unsigned to be signed with the new key.
+func TestRotation_ResignsVouchersSignedBeforeSignerBump(t *testing.T) {
+	s, rdb, current := newTestSignerFull(t)
+	ctx := context.Background()
+	prevKey, _ := crypto.GenerateKey()
+	src := &mockRotationSource{signer: crypto.PubkeyToAddress(prevKey.PublicKey)}
+	r := NewRotation(src, s, prevKey, time.Now().Add(time.Hour), rdb, zap.NewNop())
+	r.reconcile(ctx)
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+
+	inFlight := []voucher.SandboxVoucher{signRot(t, s, "sb-a"), signRot(t, s, "sb-b")}
+	src.signer = current // bumped before the next reconcile
+
+	onchain, version, err := s.OnchainSigner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range inFlight {
+		if mismatch, requeued := s.ResignMismatched(ctx, v, onchain, version); !mismatch || !requeued {
+			t.Fatalf("%s: mismatch=%v requeued=%v, want both", v.SandboxID, mismatch, requeued)
+		}
+	}
+	items, _ := rdb.LRange(ctx, queueKey, 0, -1).Result()
+	if len(items) != 2 {
+		t.Fatalf("queue: got %d items want 2", len(items))
+	}
+	for _, item := range items {
+		var v voucher.SandboxVoucher
+		if err := json.Unmarshal([]byte(item), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Nonce != nil || v.Signature != nil {
+			t.Errorf("%s re-queued with nonce %v and a signature; want unsigned", v.SandboxID, v.Nonce)
+		}
+	}
+	if got := signedBy(t, s); got != current {
+		t.Errorf("re-signed by %s want the new on-chain signer %s", got.Hex(), current.Hex())
+	}
+
+	// A voucher the on-chain signer did sign is not a signer mismatch.
+	if mismatch, requeued := s.ResignMismatched(ctx, signRot(t, s, "sb-c"), onchain, version); mismatch || requeued {
+		t.Errorf("current signer: mismatch=%v requeued=%v, want neither", mismatch, requeued)
+	}
+}
+
+func TestRotation_SignerMismatchPastCutoffNotRequeued(t *testing.T) {
+	s, rdb, current := newTestSignerFull(t)
+	ctx := context.Background()
+	prevKey, _ := crypto.GenerateKey()
+	src := &mockRotationSource{signer: current}
+	NewRotation(src, s, prevKey, time.Now().Add(-time.Second), rdb, zap.NewNop())
+
+	v := signRot(t, s, "sb-late")
+	src.signer = crypto.PubkeyToAddress(prevKey.PublicKey)
+	onchain, version, err := s.OnchainSigner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatch, requeued := s.ResignMismatched(ctx, v, onchain, version); !mismatch || requeued {
+		t.Errorf("past cutoff: mismatch=%v requeued=%v, want mismatch only", mismatch, requeued)
+	}
+}
@@ -0,0 +1,122 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+)
+
+// BalanceReader reads a user's on-chain balance with a provider. Satisfied by
+// *chain.Client.
+type BalanceReader interface {
+	GetBalance(ctx context.Context, user, provider common.Address) (*big.Int, error)
+}
+
+// SetLowBalanceWarning makes the generator warn a wallet before its balance
+// runs out, rather than only stopping its sandboxes once a voucher fails to
+// settle. After pre-charging a period, if the wallet's balance minus its
+// unsettled vouchers does not cover the next periods periods of all its
+// running sandboxes, the session is flagged (Session.LowBalanceAt) and a
+// low_balance_warning event is published on the wallet's event stream, once
+// per session until the balance recovers. A nil reader or periods <= 0 turns
+// the warning off.
+func (h *EventHandler) SetLowBalanceWarning(balances BalanceReader, periods int) {
+	if balances == nil || periods <= 0 {
+		h.balances, h.warnPeriods = nil, 0
+		return
+	}
+	h.balances, h.warnPeriods = balances, int64(periods)
+}
+
+// runway is a wallet's balance left after its unsettled vouchers, and what
+// its running sandboxes cost over the next warnPeriods periods.
+type runway struct {
+	available *big.Int
+	needed    *big.Int
+}
+
+func (r *runway) low() bool { return r.available.Cmp(r.needed) < 0 }
+
+// ownerRunway computes owner's runway from the on-chain balance, the pending
+// vouchers of its running sandboxes and their per-period price.
+func (h *EventHandler) ownerRunway(ctx context.Context, owner string) (*runway, error) {
+	balance, err := h.balances.GetBalance(ctx, common.HexToAddress(owner), common.HexToAddress(h.providerAddress))
+	if err != nil {
+		return nil, fmt.Errorf("read balance: %w", err)
+	}
+	ids, err := OwnerSandboxes(ctx, h.rdb, owner)
+	if err != nil {
+		return nil, fmt.Errorf("list running sandboxes: %w", err)
+	}
+	r := &runway{available: new(big.Int).Set(balance), needed: new(big.Int)}
+	for _, id := range ids {
+		pending, err := ListPending(ctx, h.rdb, id)
+		if err != nil {
+			return nil, fmt.Errorf("list pending vouchers: %w", err)
+		}
+		for _, p := range pending {
+			if fee, ok := new(big.Int).SetString(p.TotalFee, 10); ok {
+				r.available.Sub(r.available, fee)
+			}
+		}
+		s, err := GetSession(ctx, h.rdb, id)
+		if err != nil {
+			return nil, fmt.Errorf("get session: %w", err)
+		}
+		if s == nil || s.PausedAt != 0 {
+			continue
+		}
+		period := new(big.Int).Mul(h.sessionPrice(s), big.NewInt(h.interval(s.IntervalSec)))
+		r.needed.Add(r.needed, period.Mul(period, big.NewInt(h.warnPeriods)))
+	}
+	return r, nil
+}
+
+// checkRunway flags s and warns its owner when the owner's runway is below
+// the threshold, and clears the flag once it is not (see
+// SetLowBalanceWarning). runways caches each owner's runway for the rest of a
+// generator sweep, so the balance is read once per wallet per sweep.
+func (h *EventHandler) checkRunway(ctx context.Context, s *Session, now int64, runways map[string]*runway, log *zap.Logger) {
+	if h.balances == nil {
+		return
+	}
+	owner := strings.ToLower(s.Owner)
+	r, seen := runways[owner]
+	if !seen {
+		var err error
+		if r, err = h.ownerRunway(ctx, s.Owner); err != nil {
+			log.Warn("generator: low-balance check", zap.String("owner", s.Owner), zap.Error(err))
+		}
+		runways[owner] = r
+	}
+	if r == nil {
+		return
+	}
+	var at int64
+	if r.low() {
+		at = now
+	}
+	changed, err := SetLowBalance(ctx, h.rdb, s.SandboxID, at)
+	if err != nil || !changed || at == 0 {
+		return
+	}
+	log.Info("low balance warning",
+		zap.String("sandbox", s.SandboxID),
+		zap.String("owner", s.Owner),
+		zap.String("available", r.available.String()),
+		zap.String("needed", r.needed.String()),
+	)
+	_ = events.Publish(ctx, h.rdb, s.Owner, events.StreamEvent{
+		Type:      events.TypeLowBalance,
+		SandboxID: s.SandboxID,
+		Amount:    r.available.String(),
+		Message: fmt.Sprintf("Balance left after pending charges (%s neuron) will not cover the next %d period(s) of your running sandboxes (%s neuron). Deposit funds to avoid an automatic stop.",
+			r.available, h.warnPeriods, r.needed),
+	})
+}
@@ -0,0 +1,148 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+)
+
+// SandboxGetter looks up a single Daytona sandbox, returning an error wrapping
+// daytona.ErrNotFound if there is none. A SandboxLister passed to
+// SetSandboxCheck that also implements it lets the generator confirm that a
+// sandbox missing from the list is really gone.
+type SandboxGetter interface {
+	GetSandbox(ctx context.Context, id string) (*daytona.Sandbox, error)
+}
+
+// errNoLookup means the lister cannot look up a single sandbox.
+var errNoLookup = errors.New("sandbox lookup not supported")
+
+// sandboxStates caches Daytona's sandbox list for the generator (see
+// SetSandboxCheck), so a sweep costs at most one list call per ttl.
+type sandboxStates struct {
+	lister SandboxLister
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	states    map[string]string // sandbox ID → Daytona state
+	fetchedAt time.Time
+}
+
+// state returns the sandbox's Daytona state ("" if Daytona does not list it)
+// as of at most ttl ago.
+func (c *sandboxStates) state(ctx context.Context, sandboxID string, now time.Time) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.states == nil || now.Sub(c.fetchedAt) >= c.ttl {
+		list, err := c.lister.ListSandboxes(ctx)
+		if err != nil {
+			return "", err
+		}
+		c.states = make(map[string]string, len(list))
+		for _, sb := range list {
+			c.states[sb.ID] = sb.State
+		}
+		c.fetchedAt = now
+	}
+	return c.states[sandboxID], nil
+}
+
+// lookup asks Daytona for a single sandbox's state, for one the list omitted:
+// "" if Daytona confirms it does not exist.
+func (c *sandboxStates) lookup(ctx context.Context, sandboxID string) (string, error) {
+	getter, ok := c.lister.(SandboxGetter)
+	if !ok {
+		return "", errNoLookup
+	}
+	sb, err := getter.GetSandbox(ctx, sandboxID)
+	if errors.Is(err, daytona.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return sb.State, nil
+}
+
+// SetSandboxCheck makes the generator confirm, before each periodic voucher,
+// that the sandbox still runs in Daytona, from a sandbox list fetched through
+// lister at most every ttl. A session whose sandbox is stopped, destroyed,
+// archived or gone is closed instead of billed for another period; one in
+// any other state (stopping, resizing, error, ...) is not billed until its
+// state settles. A sandbox missing from the list counts as gone only once a
+// direct lookup (see SandboxGetter) confirms it. A nil lister turns the
+// check off.
+func (h *EventHandler) SetSandboxCheck(lister SandboxLister, ttl time.Duration) {
+	if lister == nil {
+		h.sandboxStates = nil
+		return
+	}
+	h.sandboxStates = &sandboxStates{lister: lister, ttl: ttl}
+}
+
+// sandboxBillable reports whether s may be billed for another period. Without
+// SetSandboxCheck, or when Daytona cannot be listed, it is: a missed voucher
+// is lost revenue, while a stale one is caught by the reaper. Sessions opened
+// within reapGraceSec are spared, in case the list lags behind a create.
+// A session found dead is closed here; one whose sandbox is in a transient or
+// unknown state is left open and skipped for this sweep, so the next sweep
+// checks it again.
+func (h *EventHandler) sandboxBillable(ctx context.Context, s *Session, now int64, log *zap.Logger) bool {
+	if h.sandboxStates == nil || now-s.StartedAt < reapGraceSec {
+		return true
+	}
+	state, err := h.sandboxStates.state(ctx, s.SandboxID, time.Unix(now, 0))
+	if err != nil {
+		log.Warn("generator: list sandboxes, billing without state check", zap.Error(err))
+		return true
+	}
+	if state == "" {
+		// A lagging list may omit a live sandbox.
+		if state, err = h.sandboxStates.lookup(ctx, s.SandboxID); err != nil {
+			log.Warn("generator: sandbox not listed, skipping its voucher until confirmed",
+				zap.String("sandbox", s.SandboxID), zap.Error(err))
+			return false
+		}
+	}
+	switch state {
+	case "started", "starting", "restoring":
+		return true
+	case "", "stopped", "destroyed", "archived":
+	default:
+		log.Debug("generator: sandbox in transient state, skipping its voucher",
+			zap.String("sandbox", s.SandboxID), zap.String("state", state))
+		return false
+	}
+
+	closed, err := CloseSession(ctx, h.rdb, s.SandboxID)
+	if err != nil {
+		log.Error("generator: close session of stopped sandbox", zap.String("sandbox", s.SandboxID), zap.Error(err))
+		return false
+	}
+	if closed == nil {
+		return false // closed meanwhile by its stop or delete event
+	}
+	if state == "" {
+		state = "missing"
+	}
+	log.Warn("generator: sandbox not running, session closed without a further voucher",
+		zap.String("sandbox", s.SandboxID),
+		zap.String("owner", s.Owner),
+		zap.String("state", state),
+	)
+	_ = events.Push(ctx, h.rdb, events.Event{
+		Type:      events.TypeStopped,
+		Message:   fmt.Sprintf("Sandbox %s is %s in Daytona, billing session closed, %s neuron charged in session", s.SandboxID, state, closed.AccruedFee),
+		SandboxID: s.SandboxID,
+		User:      s.Owner,
+		Amount:    closed.AccruedFee,
+	})
+	return false
+}
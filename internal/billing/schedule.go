@@ -0,0 +1,91 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// feeScheduleRefresh is how often RunFeeSchedule re-reads the on-chain rates,
+// and feeScheduleTimeout bounds each read.
+const (
+	feeScheduleRefresh = 30 * time.Second
+	feeScheduleTimeout = 5 * time.Second
+)
+
+// FeeScheduleSource reads the provider's current on-chain compute rates (per
+// second) and signerVersion. Satisfied by *chain.Client.
+type FeeScheduleSource interface {
+	ServiceFeeSchedule(ctx context.Context) (pricePerCPUPerSec, pricePerMemGBPerSec, signerVersion *big.Int, err error)
+}
+
+// feeSchedule is the rate snapshot a session is billed at for its whole life.
+type feeSchedule struct {
+	cpuPerSec     *big.Int
+	memGBPerSec   *big.Int
+	signerVersion string // "" when not read from chain
+}
+
+// SetFeeSchedule makes every new session snapshot the provider's rates and
+// signerVersion from services(provider), as last read by RunFeeSchedule,
+// instead of using the rates read at startup. The session is billed at its
+// snapshot until it closes, so an addOrUpdateService mid-session only applies
+// to sessions opened afterwards. A zero on-chain rate falls back to the
+// startup rate, as do sessions opened before the first successful read.
+func (h *EventHandler) SetFeeSchedule(src FeeScheduleSource) {
+	h.feeSource = src
+}
+
+// RunFeeSchedule reads the on-chain fee schedule now and every
+// feeScheduleRefresh until ctx is cancelled, so opening a session never waits
+// on the chain. A failed read keeps the previous snapshot. Returns at once
+// without SetFeeSchedule or when compute fees are disabled.
+func (h *EventHandler) RunFeeSchedule(ctx context.Context) {
+	if h.feeSource == nil || h.computeFeeDisabled {
+		return
+	}
+	t := time.NewTicker(feeScheduleRefresh)
+	defer t.Stop()
+	for {
+		h.refreshSchedule(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// refreshSchedule reads the fee schedule once and stores it for
+// currentSchedule.
+func (h *EventHandler) refreshSchedule(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, feeScheduleTimeout)
+	defer cancel()
+	cpu, mem, version, err := h.feeSource.ServiceFeeSchedule(ctx)
+	if err != nil {
+		h.log.Warn("read on-chain fee schedule; keeping the previous rates", zap.Error(err))
+		return
+	}
+	sched := feeSchedule{cpuPerSec: h.pricePerCPUPerSec, memGBPerSec: h.pricePerMemGBPerSec}
+	if cpu != nil && cpu.Sign() > 0 {
+		sched.cpuPerSec = cpu
+	}
+	if mem != nil && mem.Sign() > 0 {
+		sched.memGBPerSec = mem
+	}
+	if version != nil {
+		sched.signerVersion = version.String()
+	}
+	h.schedule.Store(&sched)
+}
+
+// currentSchedule returns the rates a session opening now is billed at: the
+// last on-chain snapshot, or the startup rates before the first one.
+func (h *EventHandler) currentSchedule() feeSchedule {
+	if sched := h.schedule.Load(); sched != nil && !h.computeFeeDisabled {
+		return *sched
+	}
+	return feeSchedule{cpuPerSec: h.pricePerCPUPerSec, memGBPerSec: h.pricePerMemGBPerSec}
+}
@@ -0,0 +1,86 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+)
+
+type mockFeeSource struct {
+	cpu, mem, version int64
+	err               error
+}
+
+func (m *mockFeeSource) ServiceFeeSchedule(context.Context) (*big.Int, *big.Int, *big.Int, error) {
+	if m.err != nil {
+		return nil, nil, nil, m.err
+	}
+	return big.NewInt(m.cpu), big.NewInt(m.mem), big.NewInt(m.version), nil
+}
+
+func TestFeeSchedule_RateChangeAppliesToNextSessionOnly(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ms := &mockSigner{}
+	const intervalSec = int64(60)
+	h := NewEventHandler(rdb, testProvider, new(big.Int), big.NewInt(0), big.NewInt(1), big.NewInt(1), intervalSec, ms, zap.NewNop())
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	h.SetClock(clk)
+	src := &mockFeeSource{cpu: 10, mem: 4, version: 3}
+	h.SetFeeSchedule(src)
+	ctx := context.Background()
+	h.refreshSchedule(ctx)
+
+	// 2 CPUs, 1 GB: 2×10 + 1×4 = 24 neuron/sec.
+	if err := h.OnCreate(ctx, "sb-old", testOwner, 2, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := GetSession(ctx, rdb, "sb-old")
+	if sess.PricePerSec != "24" || sess.RateCPUPerSec != "10" || sess.RateMemPerSec != "4" || sess.SignerVersion != "3" {
+		t.Fatalf("snapshot: %+v", sess)
+	}
+
+	// addOrUpdateService raises the CPU rate mid-session.
+	src.cpu, src.version = 100, 4
+	h.refreshSchedule(ctx)
+	clk.Advance(time.Duration(intervalSec) * time.Second)
+	runGeneration(ctx, rdb, h, zap.NewNop())
+	if v := ms.last(); v == nil || v.SandboxID != "sb-old" || v.TotalFee.Int64() != 24*intervalSec {
+		t.Fatalf("period after the update: %+v, want %d at the snapshotted rate", v, 24*intervalSec)
+	}
+	if sess, _ = GetSession(ctx, rdb, "sb-old"); sess.PricePerSec != "24" || sess.RateCPUPerSec != "10" || sess.SignerVersion != "3" {
+		t.Errorf("session rate changed mid-session: %+v", sess)
+	}
+
+	// A session opened after the update bills at the new rate; a failed
+	// read keeps it.
+	src.err = errors.New("rpc down")
+	h.refreshSchedule(ctx)
+	if err := h.OnCreate(ctx, "sb-new", testOwner, 2, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sess, _ = GetSession(ctx, rdb, "sb-new"); sess.PricePerSec != "204" || sess.SignerVersion != "4" {
+		t.Errorf("new session: %+v, want 204 neuron/sec and signer version 4", sess)
+	}
+}
+
+func TestFeeSchedule_ReadFailureUsesStartupRates(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	h := NewEventHandler(rdb, testProvider, new(big.Int), big.NewInt(0), big.NewInt(7), big.NewInt(0), 60, &mockSigner{}, zap.NewNop())
+	h.SetFeeSchedule(&mockFeeSource{err: errors.New("rpc down")})
+	ctx := context.Background()
+	h.refreshSchedule(ctx)
+
+	if err := h.OnCreate(ctx, "sb-1", testOwner, 3, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := GetSession(ctx, rdb, "sb-1")
+	if sess.PricePerSec != "21" || sess.RateCPUPerSec != "7" || sess.SignerVersion != "" {
+		t.Errorf("fallback session: %+v, want the startup 7 neuron/CPU/sec and no signer version", sess)
+	}
+}
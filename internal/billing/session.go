@@ -2,36 +2,94 @@ package billing
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"math/rand/v2"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
-const sessionKeyPrefix = "billing:compute:"
+const (
+	sessionKeyPrefix        = voucher.SessionKeyPrefix
+	ownerSandboxesKeyPrefix = "owner:sandboxes:"
+	ownerSlotsKeyPrefix     = "owner:slots:"
+)
 
 // Session holds the billing state for a running sandbox.
 type Session struct {
 	SandboxID     string
 	Owner         string
 	Provider      string
-	NextVoucherAt int64  // unix timestamp when the next period should be pre-charged
-	PricePerSec   string // neuron/sec as decimal; empty = use flat rate fallback
+	NextVoucherAt int64             // unix timestamp when the next period should be pre-charged
+	PricePerSec   string            // neuron/sec as decimal; empty = use flat rate fallback
+	RateCPUPerSec string            // per-CPU rate snapshotted at session start (see SetFeeSchedule)
+	RateMemPerSec string            // per-GB-memory rate snapshotted at session start
+	SignerVersion string            // on-chain signerVersion at session start; empty = not read
+	StartedAt     int64             // unix timestamp the session was opened
+	LastVoucherAt int64             // unix timestamp the latest voucher was enqueued
+	AccruedFee    string            // neuron charged in this session so far, as decimal
+	Labels        map[string]string // user labels echoed into vouchers and receipts
+	PausedAt      int64             // unix timestamp billing was paused; 0 = not paused
+	PausedSec     int64             // paused seconds left unbilled so far
+	IntervalSec   int64             // voucher interval of this sandbox; 0 = global (see SetIntervalBounds)
+	LowBalanceAt  int64             // unix timestamp the owner was warned of a low balance; 0 = not low (see SetLowBalanceWarning)
 }
 
+// ErrNoSession is returned for a sandbox without an open billing session.
+var ErrNoSession = errors.New("no billing session")
+
+// ErrPauseLimit is returned when pausing a session that has already been
+// paused for as long as SetMaxPausedTotal allows.
+var ErrPauseLimit = errors.New("billing pause limit reached")
+
 func sessionKey(sandboxID string) string {
 	return sessionKeyPrefix + sandboxID
 }
 
+// ownerSandboxesKey is the Redis set of sandbox IDs with an open session for
+// an owner, i.e. the owner's currently running sandboxes.
+func ownerSandboxesKey(owner string) string {
+	return ownerSandboxesKeyPrefix + strings.ToLower(owner)
+}
+
+// CreateSession stores the session and adds the sandbox to its owner's
+// running set in one transaction.
 func CreateSession(ctx context.Context, rdb *redis.Client, s Session) error {
 	key := sessionKey(s.SandboxID)
-	return rdb.HSet(ctx, key,
-		"sandbox_id", s.SandboxID,
-		"owner", s.Owner,
-		"provider", s.Provider,
-		"next_voucher_at", s.NextVoucherAt,
-		"price_per_sec", s.PricePerSec,
-	).Err()
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"sandbox_id", s.SandboxID,
+			"owner", s.Owner,
+			"provider", s.Provider,
+			"next_voucher_at", s.NextVoucherAt,
+			"price_per_sec", s.PricePerSec,
+			"started_at", s.StartedAt,
+			"last_voucher_at", s.LastVoucherAt,
+			"accrued_fee", s.AccruedFee,
+			"rate_cpu_per_sec", s.RateCPUPerSec,
+			"rate_mem_per_sec", s.RateMemPerSec,
+		)
+		if s.SignerVersion != "" {
+			pipe.HSet(ctx, key, "signer_version", s.SignerVersion)
+		}
+		if len(s.Labels) > 0 {
+			b, _ := json.Marshal(s.Labels)
+			pipe.HSet(ctx, key, "labels", string(b))
+		}
+		if s.IntervalSec > 0 {
+			pipe.HSet(ctx, key, "interval_sec", s.IntervalSec)
+		}
+		pipe.SAdd(ctx, ownerSandboxesKey(s.Owner), s.SandboxID)
+		return nil
+	})
+	return err
 }
 
 func GetSession(ctx context.Context, rdb *redis.Client, sandboxID string) (*Session, error) {
@@ -45,12 +103,320 @@ func GetSession(ctx context.Context, rdb *redis.Client, sandboxID string) (*Sess
 	return sessionFromMap(vals)
 }
 
+// sessionTxRetries bounds how often an optimistic session update is retried
+// when another writer changes the session between read and write; retries
+// back off by a random delay of up to sessionTxBackoff per attempt so far.
+const (
+	sessionTxRetries = 32
+	sessionTxBackoff = time.Millisecond
+)
+
+// updateSession applies fn to the current session in a WATCH/MULTI/EXEC
+// transaction, retrying when the hash changes underneath it, so concurrent
+// writers (generator sweep, lifecycle hooks, pause/resume) never overwrite
+// each other's fields with stale values. fn returns the field/value pairs to
+// write; none means nothing to do. Returns ErrNoSession if there is no session,
+// so a racing DeleteSession is not undone by recreating a partial hash.
+func updateSession(ctx context.Context, rdb *redis.Client, sandboxID string, fn func(s *Session) []any) error {
+	key := sessionKey(sandboxID)
+	txf := func(tx *redis.Tx) error {
+		vals, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if len(vals) == 0 {
+			return ErrNoSession
+		}
+		s, err := sessionFromMap(vals)
+		if err != nil {
+			return err
+		}
+		fields := fn(s)
+		if len(fields) == 0 {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, fields...)
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < sessionTxRetries; i++ {
+		err := rdb.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rand.N(time.Duration(i+1) * sessionTxBackoff)):
+		}
+	}
+	return fmt.Errorf("update session %s: %w", sandboxID, redis.TxFailedErr)
+}
+
+// UpdateNextVoucherAt sets next_voucher_at on an existing session.
 func UpdateNextVoucherAt(ctx context.Context, rdb *redis.Client, sandboxID string, t int64) error {
-	return rdb.HSet(ctx, sessionKey(sandboxID), "next_voucher_at", t).Err()
+	return updateSession(ctx, rdb, sandboxID, func(*Session) []any {
+		return []any{"next_voucher_at", t}
+	})
+}
+
+// lastVoucherAtScript advances last_voucher_at to ARGV[1] only if it is
+// greater than the stored value. Returns 1 if advanced, 0 if not, -1 if there
+// is no session.
+var lastVoucherAtScript = redis.NewScript(`
+	if redis.call('EXISTS', KEYS[1]) == 0 then return -1 end
+	local cur = tonumber(redis.call('HGET', KEYS[1], 'last_voucher_at') or '0') or 0
+	if tonumber(ARGV[1]) <= cur then return 0 end
+	redis.call('HSET', KEYS[1], 'last_voucher_at', ARGV[1])
+	return 1
+`)
+
+// UpdateLastVoucherAt is a compare-and-set on last_voucher_at: it only moves
+// forward, so a late writer holding an older timestamp cannot roll it back.
+// Reports whether the value was advanced; returns ErrNoSession if there is no
+// session.
+func UpdateLastVoucherAt(ctx context.Context, rdb *redis.Client, sandboxID string, t int64) (bool, error) {
+	n, err := lastVoucherAtScript.Run(ctx, rdb, []string{sessionKey(sandboxID)}, t).Int()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 {
+		return false, ErrNoSession
+	}
+	return n == 1, nil
+}
+
+// AdvanceSession records a newly enqueued period voucher of fee: adds fee to
+// accrued_fee and moves next_voucher_at and last_voucher_at forward. Neither
+// timestamp ever moves back, so racing writers leave the later value in place.
+// Returns ErrNoSession if the session was deleted meanwhile.
+func AdvanceSession(ctx context.Context, rdb *redis.Client, sandboxID string, nextVoucherAt, lastVoucherAt int64, fee *big.Int) error {
+	return updateSession(ctx, rdb, sandboxID, func(s *Session) []any {
+		return []any{
+			"next_voucher_at", max(s.NextVoucherAt, nextVoucherAt),
+			"last_voucher_at", max(s.LastVoucherAt, lastVoucherAt),
+			"accrued_fee", addFee(s.AccruedFee, fee),
+		}
+	})
+}
+
+// SetLowBalance sets (at > 0) or clears (at = 0) the session's low-balance
+// flag. A flag already set keeps its original time. Reports whether the flag
+// changed; returns ErrNoSession if there is no session.
+func SetLowBalance(ctx context.Context, rdb *redis.Client, sandboxID string, at int64) (bool, error) {
+	var changed bool
+	err := updateSession(ctx, rdb, sandboxID, func(s *Session) []any {
+		changed = (s.LowBalanceAt != 0) != (at != 0)
+		if !changed {
+			return nil
+		}
+		return []any{"low_balance_at", at}
+	})
+	return changed, err
+}
+
+// addFee returns the decimal accrued fee plus fee.
+func addFee(accruedFee string, fee *big.Int) string {
+	accrued, _ := new(big.Int).SetString(accruedFee, 10)
+	if accrued == nil {
+		accrued = new(big.Int)
+	}
+	return accrued.Add(accrued, fee).String()
+}
+
+// TouchSession restarts the session's TTL at ttl. A missing session is left
+// missing.
+func TouchSession(ctx context.Context, rdb *redis.Client, sandboxID string, ttl time.Duration) error {
+	return rdb.Expire(ctx, sessionKey(sandboxID), ttl).Err()
+}
+
+// pauseScript sets paused_at on an existing, unpaused session and drops its
+// TTL, since a paused session emits no vouchers to refresh it. ARGV[1] is the
+// pause time and ARGV[2] the cap on paused_sec (0 = none). Returns 1 if
+// paused, 0 if already paused, -1 if there is no session (so a racing
+// DeleteSession is not undone by recreating a partial hash), -2 if the
+// session's paused_sec has reached the cap.
+var pauseScript = redis.NewScript(`
+	if redis.call('EXISTS', KEYS[1]) == 0 then return -1 end
+	local at = tonumber(redis.call('HGET', KEYS[1], 'paused_at') or '0')
+	if at and at > 0 then return 0 end
+	local cap = tonumber(ARGV[2])
+	if cap > 0 and (tonumber(redis.call('HGET', KEYS[1], 'paused_sec') or '0') or 0) >= cap then
+		return -2
+	end
+	redis.call('HSET', KEYS[1], 'paused_at', ARGV[1])
+	redis.call('PERSIST', KEYS[1])
+	return 1
+`)
+
+// PauseSession marks the session paused at t. Reports false if it already
+// was; returns ErrNoSession if there is no session and ErrPauseLimit if its
+// PausedSec has reached maxPausedSec (0 = no limit).
+func PauseSession(ctx context.Context, rdb *redis.Client, sandboxID string, t, maxPausedSec int64) (bool, error) {
+	n, err := pauseScript.Run(ctx, rdb, []string{sessionKey(sandboxID)}, t, maxPausedSec).Int()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case n == -2:
+		return false, ErrPauseLimit
+	case n < 0:
+		return false, ErrNoSession
+	}
+	return n == 1, nil
 }
 
+// closeSessionScript deletes the session (KEYS[1]) and drops ARGV[2] from its
+// owner's running set (KEYS[2]) in one step, returning the removed hash, or
+// nil when there was no session. KEYS[2] is the set of the owner read before
+// the call (ARGV[1], lowercased); if the session's owner differs it returns 0
+// without deleting anything, and the caller retries with the right set. Of
+// several racing callers exactly one gets the hash. A key that is not a hash
+// is still deleted, with no fields returned.
+var closeSessionScript = redis.NewScript(`
+	local t = redis.call('TYPE', KEYS[1]).ok
+	if t == 'none' then return false end
+	if t ~= 'hash' then
+		redis.call('DEL', KEYS[1])
+		return {}
+	end
+	local owner = string.lower(redis.call('HGET', KEYS[1], 'owner') or '')
+	if owner ~= ARGV[1] then return 0 end
+	local vals = redis.call('HGETALL', KEYS[1])
+	redis.call('DEL', KEYS[1])
+	if owner ~= '' then
+		redis.call('SREM', KEYS[2], ARGV[2])
+	end
+	return vals
+`)
+
+// CloseSession removes the session and drops the sandbox from its owner's
+// running set atomically. It returns the session it removed, or nil if the
+// session was already gone — so when stop, delete and archive race, only one
+// of them sees the session. An unreadable session key is deleted all the same.
+func CloseSession(ctx context.Context, rdb *redis.Client, sandboxID string) (*Session, error) {
+	key := sessionKey(sandboxID)
+	for i := 0; i < sessionTxRetries; i++ {
+		// The owner's set must be passed in KEYS, so it is read first; the
+		// script checks it is still the session's owner. A failed read (no
+		// session, or a key that is not a hash) leaves it empty.
+		owner, _ := rdb.HGet(ctx, key, "owner").Result()
+		owner = strings.ToLower(owner)
+		res, err := closeSessionScript.Run(ctx, rdb, []string{key, ownerSandboxesKey(owner)}, owner, sandboxID).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		vals, ok := res.([]any)
+		if !ok {
+			continue // the owner changed since it was read
+		}
+		m := make(map[string]string, len(vals)/2)
+		for i := 0; i+1 < len(vals); i += 2 {
+			k, _ := vals[i].(string)
+			m[k], _ = vals[i+1].(string)
+		}
+		return sessionFromMap(m)
+	}
+	return nil, fmt.Errorf("close session %s: %w", sandboxID, redis.TxFailedErr)
+}
+
+// DeleteSession removes the session and drops the sandbox from its owner's
+// running set (see CloseSession).
 func DeleteSession(ctx context.Context, rdb *redis.Client, sandboxID string) error {
-	return rdb.Del(ctx, sessionKey(sandboxID)).Err()
+	_, err := CloseSession(ctx, rdb, sandboxID)
+	return err
+}
+
+// ownerSandboxesScript returns the members of the owner's running set
+// (KEYS[1]) whose session (ARGV[1] .. id) still exists, dropping the others:
+// a session that expired (see TouchSession) leaves its ID behind.
+var ownerSandboxesScript = redis.NewScript(`
+	local live = {}
+	for _, id in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+		if redis.call('EXISTS', ARGV[1] .. id) == 1 then
+			live[#live + 1] = id
+		else
+			redis.call('SREM', KEYS[1], id)
+		end
+	end
+	return live
+`)
+
+// OwnerSandboxes returns the IDs of the owner's running sandboxes.
+func OwnerSandboxes(ctx context.Context, rdb *redis.Client, owner string) ([]string, error) {
+	return ownerSandboxesScript.Run(ctx, rdb, []string{ownerSandboxesKey(owner)}, sessionKeyPrefix).StringSlice()
+}
+
+// ownerSlotsKey is the Redis sorted set of an owner's sandbox slots held by
+// creates and starts in flight, scored by the unix time each hold expires.
+func ownerSlotsKey(owner string) string {
+	return ownerSlotsKeyPrefix + strings.ToLower(owner)
+}
+
+// reserveSlotScript holds one of ARGV[1] slots for an owner whose running
+// set is KEYS[1] and in-flight holds KEYS[2]. Holds that expired before
+// ARGV[2] (now) are dropped first; the new hold ARGV[4] expires at ARGV[3],
+// and the set ARGV[5] seconds after the latest hold. Returns {held, slots in
+// use before the hold}.
+var reserveSlotScript = redis.NewScript(`
+	redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[2])
+	local used = redis.call('SCARD', KEYS[1]) + redis.call('ZCARD', KEYS[2])
+	if used >= tonumber(ARGV[1]) then
+		return {0, used}
+	end
+	redis.call('ZADD', KEYS[2], ARGV[3], ARGV[4])
+	redis.call('EXPIRE', KEYS[2], ARGV[5])
+	return {1, used}
+`)
+
+// ReserveSandboxSlot atomically holds one of the owner's limit sandbox slots
+// for a create or start in flight, counting both running sandboxes and other
+// holds, so concurrent requests cannot exceed the limit. The hold lasts until
+// ReleaseSandboxSlot, which the caller invokes once the session is open (and
+// so counted in the running set) or the request failed; ttl bounds it if the
+// process dies first. Returns the hold's token, or "" and the slots in use
+// when all are taken. Call OwnerSandboxes first to prune expired sessions.
+func ReserveSandboxSlot(ctx context.Context, rdb *redis.Client, owner string, limit int, now time.Time, ttl time.Duration) (token string, used int, err error) {
+	token = strconv.FormatUint(rand.Uint64(), 36)
+	res, err := reserveSlotScript.Run(ctx, rdb, []string{ownerSandboxesKey(owner), ownerSlotsKey(owner)},
+		limit, now.Unix(), now.Add(ttl).Unix(), token, int64(ttl.Seconds())).Int64Slice()
+	if err != nil {
+		return "", 0, err
+	}
+	if res[0] == 0 {
+		return "", int(res[1]), nil
+	}
+	return token, int(res[1]), nil
+}
+
+// ReleaseSandboxSlot drops a hold taken by ReserveSandboxSlot. Best-effort: an
+// unreleased hold expires on its own.
+func ReleaseSandboxSlot(ctx context.Context, rdb *redis.Client, owner, token string) {
+	if token == "" {
+		return
+	}
+	rdb.ZRem(ctx, ownerSlotsKey(owner), token) //nolint:errcheck
+}
+
+// BackfillOwnerSandbox adds an open session's sandbox to its owner's running
+// set unless it is already there, for sessions opened before the set existed.
+// It reports whether the sandbox was (or, with dryRun, would be) added.
+func BackfillOwnerSandbox(ctx context.Context, rdb *redis.Client, s Session, dryRun bool) (bool, error) {
+	if s.Owner == "" {
+		return false, nil
+	}
+	key := ownerSandboxesKey(s.Owner)
+	if dryRun {
+		member, err := rdb.SIsMember(ctx, key, s.SandboxID).Result()
+		return !member, err
+	}
+	added, err := rdb.SAdd(ctx, key, s.SandboxID).Result()
+	return added > 0, err
 }
 
 // ScanAllSessions returns all active billing sessions.
@@ -83,11 +449,32 @@ func ScanAllSessions(ctx context.Context, rdb *redis.Client) ([]Session, error)
 
 func sessionFromMap(m map[string]string) (*Session, error) {
 	nextVoucherAt, _ := strconv.ParseInt(m["next_voucher_at"], 10, 64)
+	startedAt, _ := strconv.ParseInt(m["started_at"], 10, 64)
+	lastVoucherAt, _ := strconv.ParseInt(m["last_voucher_at"], 10, 64)
+	pausedAt, _ := strconv.ParseInt(m["paused_at"], 10, 64)
+	pausedSec, _ := strconv.ParseInt(m["paused_sec"], 10, 64)
+	intervalSec, _ := strconv.ParseInt(m["interval_sec"], 10, 64)
+	lowBalanceAt, _ := strconv.ParseInt(m["low_balance_at"], 10, 64)
+	var labels map[string]string
+	if raw := m["labels"]; raw != "" {
+		_ = json.Unmarshal([]byte(raw), &labels)
+	}
 	return &Session{
 		SandboxID:     m["sandbox_id"],
 		Owner:         m["owner"],
 		Provider:      m["provider"],
 		NextVoucherAt: nextVoucherAt,
 		PricePerSec:   m["price_per_sec"],
+		RateCPUPerSec: m["rate_cpu_per_sec"],
+		RateMemPerSec: m["rate_mem_per_sec"],
+		SignerVersion: m["signer_version"],
+		StartedAt:     startedAt,
+		LastVoucherAt: lastVoucherAt,
+		AccruedFee:    m["accrued_fee"],
+		Labels:        labels,
+		PausedAt:      pausedAt,
+		PausedSec:     pausedSec,
+		IntervalSec:   intervalSec,
+		LowBalanceAt:  lowBalanceAt,
 	}, nil
 }
@@ -2,8 +2,12 @@ package billing
 
 import (
 	"context"
+	"errors"
+	"math/big"
 	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
@@ -93,6 +97,187 @@ func TestUpdateNextVoucherAt(t *testing.T) {
 	}
 }
 
+// ── AdvanceSession ────────────────────────────────────────────────────────────
+
+func TestAdvanceSession(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	s := testSession
+	s.StartedAt = 1_700_000_000
+	s.LastVoucherAt = 1_700_000_000
+	s.AccruedFee = "500"
+	CreateSession(ctx, rdb, s) //nolint:errcheck
+
+	if err := AdvanceSession(ctx, rdb, s.SandboxID, 1_700_007_200, 1_700_003_600, big.NewInt(300)); err != nil {
+		t.Fatalf("AdvanceSession: %v", err)
+	}
+
+	got, _ := GetSession(ctx, rdb, s.SandboxID)
+	if got.NextVoucherAt != 1_700_007_200 || got.LastVoucherAt != 1_700_003_600 || got.AccruedFee != "800" {
+		t.Errorf("advanced session: got %+v", got)
+	}
+	if got.StartedAt != s.StartedAt {
+		t.Errorf("StartedAt changed unexpectedly: %d", got.StartedAt)
+	}
+}
+
+func TestAdvanceSession_NoSession(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	err := AdvanceSession(ctx, rdb, "sb-gone", 200, 100, big.NewInt(1))
+	if !errors.Is(err, ErrNoSession) {
+		t.Fatalf("expected ErrNoSession, got %v", err)
+	}
+	if n, _ := rdb.Exists(ctx, sessionKey("sb-gone")).Result(); n != 0 {
+		t.Error("advancing a deleted session must not recreate it")
+	}
+}
+
+// ── Concurrent updates ────────────────────────────────────────────────────────
+
+// Several writers hammer one session: no fee increment is lost and neither
+// timestamp ever moves back, whatever order the writes land in.
+func TestAdvanceSession_Concurrent(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	s := testSession
+	s.NextVoucherAt, s.LastVoucherAt, s.AccruedFee = 1000, 0, "0"
+	CreateSession(ctx, rdb, s) //nolint:errcheck
+
+	const writers, perWriter = 8, 25
+	stop, done := make(chan struct{}), make(chan struct{})
+	var observed []int64
+	var obsErr error
+	go func() { // reader: last_voucher_at must be monotonic
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			got, err := GetSession(ctx, rdb, s.SandboxID)
+			if err != nil {
+				obsErr = err
+				return
+			}
+			observed = append(observed, got.LastVoucherAt)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// Interleave writers so each one regularly holds an older timestamp.
+				ts := int64(i*writers + (writers - w))
+				if err := AdvanceSession(ctx, rdb, s.SandboxID, 1000+ts, ts, big.NewInt(1)); err != nil {
+					t.Errorf("AdvanceSession: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	<-done
+
+	if obsErr != nil {
+		t.Fatalf("reader: %v", obsErr)
+	}
+	got, _ := GetSession(ctx, rdb, s.SandboxID)
+	if got.AccruedFee != "200" {
+		t.Errorf("AccruedFee: got %s want 200 (lost updates)", got.AccruedFee)
+	}
+	if want := int64(writers * perWriter); got.LastVoucherAt != want || got.NextVoucherAt != 1000+want {
+		t.Errorf("timestamps: last %d next %d, want %d and %d", got.LastVoucherAt, got.NextVoucherAt, want, 1000+want)
+	}
+	for i := 1; i < len(observed); i++ {
+		if observed[i] < observed[i-1] {
+			t.Fatalf("last_voucher_at moved back: %d → %d", observed[i-1], observed[i])
+		}
+	}
+}
+
+func TestUpdateLastVoucherAt_CompareAndSet(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	s := testSession
+	s.LastVoucherAt = 100
+	CreateSession(ctx, rdb, s) //nolint:errcheck
+
+	if ok, err := UpdateLastVoucherAt(ctx, rdb, s.SandboxID, 50); err != nil || ok {
+		t.Errorf("older value: got advanced=%v err=%v, want false", ok, err)
+	}
+	if ok, err := UpdateLastVoucherAt(ctx, rdb, s.SandboxID, 100); err != nil || ok {
+		t.Errorf("equal value: got advanced=%v err=%v, want false", ok, err)
+	}
+
+	var wg sync.WaitGroup
+	for ts := int64(101); ts <= 300; ts++ {
+		wg.Add(1)
+		go func(ts int64) {
+			defer wg.Done()
+			if _, err := UpdateLastVoucherAt(ctx, rdb, s.SandboxID, ts); err != nil {
+				t.Errorf("UpdateLastVoucherAt(%d): %v", ts, err)
+			}
+		}(ts)
+	}
+	wg.Wait()
+	if got, _ := GetSession(ctx, rdb, s.SandboxID); got.LastVoucherAt != 300 {
+		t.Errorf("LastVoucherAt: got %d want 300", got.LastVoucherAt)
+	}
+	if _, err := UpdateLastVoucherAt(ctx, rdb, "sb-gone", 1); !errors.Is(err, ErrNoSession) {
+		t.Errorf("missing session: got %v want ErrNoSession", err)
+	}
+}
+
+func TestCloseSession_OnlyOneCallerWins(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	s := testSession
+	s.AccruedFee = "700"
+	CreateSession(ctx, rdb, s) //nolint:errcheck
+
+	var mu sync.Mutex
+	var closed []*Session
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := CloseSession(ctx, rdb, s.SandboxID)
+			if err != nil {
+				t.Errorf("CloseSession: %v", err)
+				return
+			}
+			if got != nil {
+				mu.Lock()
+				closed = append(closed, got)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(closed) != 1 {
+		t.Fatalf("expected exactly one caller to close the session, got %d", len(closed))
+	}
+	if closed[0].Owner != s.Owner || closed[0].AccruedFee != "700" {
+		t.Errorf("closed session: got %+v", closed[0])
+	}
+	if running, _ := OwnerSandboxes(ctx, rdb, s.Owner); len(running) != 0 {
+		t.Errorf("owner running set not emptied: %v", running)
+	}
+}
+
 // ── DeleteSession ─────────────────────────────────────────────────────────────
 
 func TestDeleteSession(t *testing.T) {
@@ -124,6 +309,34 @@ func TestDeleteSession_Idempotent(t *testing.T) {
 	}
 }
 
+// ── ReserveSandboxSlot ───────────────────────────────────────────────────────
+
+func TestReserveSandboxSlot(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	owner := testSession.Owner
+
+	CreateSession(ctx, rdb, testSession) //nolint:errcheck
+	held, used, err := ReserveSandboxSlot(ctx, rdb, owner, 2, now, time.Minute)
+	if err != nil || held == "" || used != 1 {
+		t.Fatalf("first hold: token %q, used %d, err %v", held, used, err)
+	}
+	// The running sandbox and the hold fill both slots.
+	if tok, used, _ := ReserveSandboxSlot(ctx, rdb, owner, 2, now, time.Minute); tok != "" || used != 2 {
+		t.Fatalf("over the limit: token %q, used %d", tok, used)
+	}
+
+	// Released, or expired when its holder died, the slot is free again.
+	ReleaseSandboxSlot(ctx, rdb, owner, held)
+	if tok, _, _ := ReserveSandboxSlot(ctx, rdb, owner, 2, now, time.Minute); tok == "" {
+		t.Fatal("released slot not reusable")
+	}
+	if tok, _, _ := ReserveSandboxSlot(ctx, rdb, owner, 2, now.Add(2*time.Minute), time.Minute); tok == "" {
+		t.Fatal("expired hold still counted")
+	}
+}
+
 // ── ScanAllSessions ───────────────────────────────────────────────────────────
 
 func TestScanAllSessions_Empty(t *testing.T) {
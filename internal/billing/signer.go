@@ -3,15 +3,23 @@ package billing
 import (
 	"context"
 	"crypto/ecdsa"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
@@ -35,6 +43,10 @@ redis.call('SET', KEYS[1], ARGV[1], 'NX')
 return redis.call('INCR', KEYS[1])
 `)
 
+// ErrSigningPaused is returned by Sign while settlement is paused around a
+// contract upgrade. No nonce is consumed; the settler re-queues and retries.
+var ErrSigningPaused = errors.New("voucher signing paused")
+
 // Signer is the concrete VoucherSigner: signs with the TEE key and pushes to Redis.
 type Signer struct {
 	privKey      *ecdsa.PrivateKey
@@ -43,7 +55,26 @@ type Signer struct {
 	providerAddr common.Address
 	rdb          *redis.Client
 	nonceReader  NonceReader
+	codec        *voucher.Codec // nil = queue items stored as plaintext
+	clock        clock.Clock
 	log          *zap.Logger
+
+	domainMu  sync.RWMutex
+	domainSep *[32]byte // nil = derive from chainID + contractAddr
+	paused    atomic.Bool
+
+	// Set during a TEE key rotation (see Rotation).
+	keyMu     sync.RWMutex
+	prevKey   *ecdsa.PrivateKey // outgoing key; nil = no rotation
+	usePrev   bool              // the on-chain signer is still prevKey
+	rotation  *Rotation
+	signerSrc SignerSource // see SetSignerSource
+}
+
+// SignerSource reads the provider's on-chain TEE signer and signerVersion.
+// Satisfied by *chain.Client.
+type SignerSource interface {
+	ServiceSigner(ctx context.Context) (common.Address, *big.Int, error)
 }
 
 func NewSigner(
@@ -62,26 +93,194 @@ func NewSigner(
 		providerAddr: providerAddr,
 		rdb:          rdb,
 		nonceReader:  nonceReader,
+		clock:        clock.Real{},
 		log:          log,
 	}
 }
 
+// SetClock replaces the real clock used to time a key rotation window. A nil
+// clock restores the real one.
+func (s *Signer) SetClock(c clock.Clock) {
+	s.clock = clock.OrReal(c)
+}
+
+// SetCodec encrypts queued vouchers with c (see voucher.Codec); nil keeps
+// them in plaintext. Must be called before the signer is used.
+func (s *Signer) SetCodec(c *voucher.Codec) {
+	s.codec = c
+}
+
 // Enqueue serialises the voucher and pushes it onto the provider's voucher
 // queue in Redis. The voucher is pushed unsigned and without a nonce; the
 // settler assigns the nonce and signs atomically before on-chain submission,
 // ensuring strict ordering even under concurrent OnCreate goroutines.
+// EnqueuedAt is stamped here (unless already set) for the queue-lag metric,
+// as is a QueueID, and the voucher is indexed under its sandbox (see
+// ListPending). A voucher that fails Validate is rejected before anything is
+// written.
 func (s *Signer) Enqueue(ctx context.Context, v *voucher.SandboxVoucher) error {
-	raw, err := json.Marshal(v)
+	return s.EnqueueBatch(ctx, []*voucher.SandboxVoucher{v})
+}
+
+// EnqueueBatch is Enqueue for several vouchers, e.g. a generator sweep, in one
+// Redis round trip: they are pushed by a single RPUSH in slice order, so the
+// settler assigns their nonces in that order, and are all queued or none. If
+// any voucher fails Validate nothing is written. Their voucher_queued stream
+// events are then published together (see events.PublishBatch).
+func (s *Signer) EnqueueBatch(ctx context.Context, vs []*voucher.SandboxVoucher) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	items, entries, err := s.prepareBatch(vs)
 	if err != nil {
-		return fmt.Errorf("marshal voucher: %w", err)
+		return err
 	}
 	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, s.providerAddr.Hex())
-	return s.rdb.RPush(ctx, queueKey, string(raw)).Err()
+	pipe := s.rdb.TxPipeline()
+	pipe.RPush(ctx, queueKey, items...)
+	for i, v := range vs {
+		if v.SandboxID == "" {
+			continue
+		}
+		// Index the voucher under its sandbox for ListPending; the settler
+		// clears the entry once the voucher leaves the queue for good.
+		pipe.HSet(ctx, pendingKey(v.SandboxID), v.PendingField(), entries[i])
+		pipe.Expire(ctx, pendingKey(v.SandboxID), pendingTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	publishQueued(ctx, s.rdb, vs)
+	return nil
+}
+
+// enqueueOpenScript pushes each voucher onto the queue (KEYS[1]) and indexes
+// it as pending only if its session still exists. For voucher i (1-based)
+// KEYS[2i] is its session and KEYS[2i+1] its pending key; ARGV[1] is the
+// pending TTL in seconds and ARGV[3i-1], ARGV[3i], ARGV[3i+1] are its queue
+// item, pending field and pending entry. Returns a 1 (queued) or 0 (session
+// gone) per voucher.
+var enqueueOpenScript = redis.NewScript(`
+	local queued = {}
+	for i = 1, (#KEYS - 1) / 2 do
+		if redis.call('EXISTS', KEYS[2*i]) == 1 then
+			redis.call('RPUSH', KEYS[1], ARGV[3*i-1])
+			redis.call('HSET', KEYS[2*i+1], ARGV[3*i], ARGV[3*i+1])
+			redis.call('EXPIRE', KEYS[2*i+1], ARGV[1])
+			queued[i] = 1
+		else
+			queued[i] = 0
+		end
+	end
+	return queued
+`)
+
+// EnqueueOpen is EnqueueBatch for vouchers that charge an open session, e.g.
+// a generator sweep: in the same atomic step, each voucher is queued only if
+// its sandbox's billing session still exists, so a session closed after its
+// voucher was built is not charged again. queued[i] reports whether vs[i] was
+// queued. Every voucher must name its sandbox.
+func (s *Signer) EnqueueOpen(ctx context.Context, vs []*voucher.SandboxVoucher) (queued []bool, err error) {
+	if len(vs) == 0 {
+		return nil, nil
+	}
+	items, entries, err := s.prepareBatch(vs)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, 1+2*len(vs))
+	keys = append(keys, fmt.Sprintf(voucher.VoucherQueueKeyFmt, s.providerAddr.Hex()))
+	args := make([]any, 0, 1+3*len(vs))
+	args = append(args, int64(pendingTTL.Seconds()))
+	for i, v := range vs {
+		if v.SandboxID == "" {
+			return nil, fmt.Errorf("enqueue open: voucher %d has no sandbox", i)
+		}
+		keys = append(keys, sessionKey(v.SandboxID), pendingKey(v.SandboxID))
+		args = append(args, items[i], v.PendingField(), entries[i])
+	}
+	res, err := enqueueOpenScript.Run(ctx, s.rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	queued = make([]bool, len(vs))
+	var sent []*voucher.SandboxVoucher
+	for i, n := range res {
+		if i < len(queued) && n == 1 {
+			queued[i] = true
+			sent = append(sent, vs[i])
+		}
+	}
+	publishQueued(ctx, s.rdb, sent)
+	return queued, nil
+}
+
+// prepareBatch validates and stamps vs (see Enqueue) and returns each one's
+// sealed queue item and pending-index entry. Nothing is written.
+func (s *Signer) prepareBatch(vs []*voucher.SandboxVoucher) (items []any, entries []string, err error) {
+	now := s.clock.Now().Unix()
+	items = make([]any, len(vs))
+	entries = make([]string, len(vs))
+	for i, v := range vs {
+		if err := v.Validate(); err != nil {
+			return nil, nil, err
+		}
+		if v.EnqueuedAt == 0 {
+			v.EnqueuedAt = now
+		}
+		if v.QueueID == "" {
+			v.QueueID = newQueueID()
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal voucher: %w", err)
+		}
+		if items[i], err = s.codec.Seal(raw); err != nil {
+			return nil, nil, fmt.Errorf("encrypt voucher: %w", err)
+		}
+		entry, err := pendingEntry(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal pending entry: %w", err)
+		}
+		entries[i] = string(entry)
+	}
+	return items, entries, nil
+}
+
+// publishQueued publishes a voucher_queued stream event per queued voucher
+// (see events.PublishBatch).
+func publishQueued(ctx context.Context, rdb *redis.Client, vs []*voucher.SandboxVoucher) {
+	if len(vs) == 0 {
+		return
+	}
+	queued := make([]events.Delivery, len(vs))
+	for i, v := range vs {
+		queued[i] = events.Delivery{Wallet: v.User.Hex(), Event: events.StreamEvent{
+			Type:      events.TypeVoucherQueued,
+			SandboxID: v.SandboxID,
+			Amount:    v.TotalFee.String(),
+		}}
+	}
+	_ = events.PublishBatch(ctx, rdb, queued)
+}
+
+// newQueueID returns a random voucher QueueID.
+func newQueueID() string {
+	b := make([]byte, 8)
+	crand.Read(b) //nolint:errcheck
+	return hex.EncodeToString(b)
 }
 
 // Sign assigns a nonce and signs the voucher with the TEE private key.
-// Called by the settler immediately before on-chain submission.
+// Called by the settler immediately before on-chain submission. A voucher
+// that fails Validate is rejected before a nonce is consumed.
 func (s *Signer) Sign(ctx context.Context, v *voucher.SandboxVoucher) error {
+	if s.paused.Load() {
+		return ErrSigningPaused
+	}
+	if err := v.Validate(); err != nil {
+		return err
+	}
 	owner := v.User.Hex()
 	provider := v.Provider.Hex()
 	nonce, err := s.IncrNonce(ctx, owner, provider)
@@ -89,12 +288,181 @@ func (s *Signer) Sign(ctx context.Context, v *voucher.SandboxVoucher) error {
 		return fmt.Errorf("incr nonce: %w", err)
 	}
 	v.Nonce = nonce
-	if err := voucher.Sign(v, s.privKey, s.chainID, s.contractAddr); err != nil {
+	if err := voucher.SignWithDomain(v, s.signingKey(), s.DomainSeparator()); err != nil {
 		return fmt.Errorf("sign voucher: %w", err)
 	}
+	s.updatePendingNonce(ctx, v)
 	return nil
 }
 
+// signingKey returns the key Sign uses: the TEE key, or the outgoing key
+// while the contract still names it as the signer.
+func (s *Signer) signingKey() *ecdsa.PrivateKey {
+	s.keyMu.RLock()
+	defer s.keyMu.RUnlock()
+	if s.usePrev && s.prevKey != nil {
+		return s.prevKey
+	}
+	return s.privKey
+}
+
+// SigningAddress returns the address of the key Sign currently uses.
+func (s *Signer) SigningAddress() common.Address {
+	return crypto.PubkeyToAddress(s.signingKey().PublicKey)
+}
+
+// selectKey switches Sign to whichever held key is onchain. Reports false,
+// leaving the choice unchanged, if neither is.
+func (s *Signer) selectKey(onchain common.Address) bool {
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+	switch {
+	case onchain == crypto.PubkeyToAddress(s.privKey.PublicKey):
+		s.usePrev = false
+	case s.prevKey != nil && onchain == crypto.PubkeyToAddress(s.prevKey.PublicKey):
+		s.usePrev = true
+	default:
+		return false
+	}
+	return true
+}
+
+// DeferUnacknowledged parks a NOT_ACKNOWLEDGED voucher while a key rotation
+// window is open, instead of stopping the sandbox. Reports whether v was
+// parked. Satisfies settler.AckDeferrer.
+func (s *Signer) DeferUnacknowledged(ctx context.Context, v voucher.SandboxVoucher) bool {
+	s.keyMu.RLock()
+	r := s.rotation
+	s.keyMu.RUnlock()
+	return r != nil && r.deferVoucher(ctx, v)
+}
+
+// SetSignerSource lets ResignMismatched read the on-chain signer. A Rotation
+// without one set uses its own source.
+func (s *Signer) SetSignerSource(src SignerSource) {
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+	s.signerSrc = src
+}
+
+// errNoSignerSource is returned by OnchainSigner before SetSignerSource.
+var errNoSignerSource = errors.New("no on-chain signer source")
+
+// OnchainSigner reads the provider's current on-chain TEE signer and
+// signerVersion, for ResignMismatched. Satisfies
+// settler.SignerMismatchResigner.
+func (s *Signer) OnchainSigner(ctx context.Context) (common.Address, *big.Int, error) {
+	s.keyMu.RLock()
+	src := s.signerSrc
+	s.keyMu.RUnlock()
+	if src == nil {
+		return common.Address{}, nil, errNoSignerSource
+	}
+	return src.ServiceSigner(ctx)
+}
+
+// ResignMismatched examines a voucher the contract rejected as
+// INVALID_SIGNATURE, given the contract's current TEE signer onchain and its
+// signerVersion (see OnchainSigner). mismatch reports that it was signed by
+// a key other than onchain, i.e. the signer changed (and signerVersion was
+// bumped) after it was signed. While a key rotation window is open and the
+// new signer is a held key, Sign switches to that key and v is re-queued to
+// be signed with it; requeued reports that. Satisfies
+// settler.SignerMismatchResigner.
+func (s *Signer) ResignMismatched(ctx context.Context, v voucher.SandboxVoucher, onchain common.Address, version *big.Int) (mismatch, requeued bool) {
+	s.keyMu.RLock()
+	r := s.rotation
+	s.keyMu.RUnlock()
+	signedBy, err := voucher.RecoverWithDomain(&v, s.DomainSeparator())
+	if err != nil {
+		return false, false
+	}
+	if signedBy == onchain {
+		return false, false
+	}
+	fields := []zap.Field{
+		zap.String("sandbox", v.SandboxID),
+		zap.String("signed_by", signedBy.Hex()),
+		zap.String("onchain_signer", onchain.Hex()),
+		zap.Stringer("signer_version", version),
+	}
+	if r == nil || !r.Active() || !s.selectKey(onchain) {
+		s.log.Error("voucher signed by a key the contract no longer accepts, and no open rotation window holds the on-chain signer's key — check TEE_PREVIOUS_PRIVATE_KEY / TEE_ROTATION_CUTOFF", fields...)
+		return true, false
+	}
+	if !r.requeue(ctx, v) {
+		return true, false
+	}
+	s.log.Warn("voucher re-queued to be signed by the on-chain signer", fields...)
+	return true, true
+}
+
+// DomainSeparator returns the EIP-712 domain separator vouchers are signed
+// against: the override set by SetDomainSeparator, or the locally derived one.
+func (s *Signer) DomainSeparator() [32]byte {
+	s.domainMu.RLock()
+	defer s.domainMu.RUnlock()
+	if s.domainSep != nil {
+		return *s.domainSep
+	}
+	return voucher.DomainSeparator(s.chainID, s.contractAddr)
+}
+
+// SetDomainSeparator overrides the domain separator used by Sign. Vouchers
+// sit unsigned in the queue until the settler pops them, so everything still
+// queued is signed against the new domain.
+func (s *Signer) SetDomainSeparator(sep [32]byte) {
+	s.domainMu.Lock()
+	defer s.domainMu.Unlock()
+	s.domainSep = &sep
+}
+
+// PauseSigning makes Sign return ErrSigningPaused until ResumeSigning.
+func (s *Signer) PauseSigning() { s.paused.Store(true) }
+
+// ResumeSigning re-enables Sign after PauseSigning.
+func (s *Signer) ResumeSigning() { s.paused.Store(false) }
+
+// SigningPaused reports whether Sign is currently paused.
+func (s *Signer) SigningPaused() bool { return s.paused.Load() }
+
+// resyncNonceScript raises a Redis nonce counter to the chain's lastNonce if
+// it has fallen behind; it never lowers it.
+//
+// KEYS[1] = nonce key
+// ARGV[1] = chain's lastNonce
+// Returns 1 if the counter was raised, 0 otherwise.
+var resyncNonceScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+if cur < tonumber(ARGV[1]) then
+  redis.call('SET', KEYS[1], ARGV[1])
+  return 1
+end
+return 0
+`)
+
+// ResyncNonce raises the (owner, provider) nonce counter to lastNonce when it
+// is behind the contract, so the next Sign emits lastNonce+1. Reports whether
+// the counter was changed.
+func (s *Signer) ResyncNonce(ctx context.Context, owner, provider common.Address, lastNonce *big.Int) (bool, error) {
+	return RaiseNonce(ctx, s.rdb, owner, provider, lastNonce)
+}
+
+// RaiseNonce is ResyncNonce without a Signer, for operator tools: it raises
+// the (owner, provider) counter to lastNonce if it is behind and never lowers
+// it. Reports whether the counter was changed.
+func RaiseNonce(ctx context.Context, rdb *redis.Client, owner, provider common.Address, lastNonce *big.Int) (bool, error) {
+	key := fmt.Sprintf(voucher.NonceKeyFmt,
+		strings.ToLower(owner.Hex()),
+		strings.ToLower(provider.Hex()),
+	)
+	n, err := resyncNonceScript.Run(ctx, rdb, []string{key}, lastNonce.String()).Int64()
+	if err != nil {
+		return false, fmt.Errorf("resync nonce: %w", err)
+	}
+	return n == 1, nil
+}
+
 // IncrNonce atomically increments and returns the nonce for a (owner, provider) pair.
 //
 // On the first call after a Redis restart the key will be absent. In that case
@@ -8,6 +8,7 @@ import (
 	"math/big"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/ethereum/go-ethereum/common"
@@ -15,6 +16,8 @@ import (
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
@@ -41,12 +44,12 @@ func (m *mockNonceReader) GetLastNonce(_ context.Context, _, _ common.Address) (
 	return new(big.Int).Set(m.nonce), nil
 }
 
-func newTestSignerFull(t *testing.T) (*Signer, *redis.Client, common.Address) {
+func newTestSignerFull(t testing.TB) (*Signer, *redis.Client, common.Address) {
 	t.Helper()
 	return newTestSignerWithChainNonce(t, big.NewInt(0))
 }
 
-func newTestSignerWithChainNonce(t *testing.T, chainNonce *big.Int) (*Signer, *redis.Client, common.Address) {
+func newTestSignerWithChainNonce(t testing.TB, chainNonce *big.Int) (*Signer, *redis.Client, common.Address) {
 	t.Helper()
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
@@ -234,6 +237,42 @@ func TestIncrNonce_ConcurrentSeed(t *testing.T) {
 	}
 }
 
+// ── ResyncNonce ───────────────────────────────────────────────────────────────
+
+func TestResyncNonce_RaisesBehindCounter(t *testing.T) {
+	s, _, _ := newTestSignerFull(t)
+	ctx := context.Background()
+	owner, provider := common.HexToAddress(testOwner), common.HexToAddress(testProvider)
+
+	s.IncrNonce(ctx, testOwner, testProvider) //nolint:errcheck // counter = 1
+
+	changed, err := s.ResyncNonce(ctx, owner, provider, big.NewInt(7))
+	if err != nil || !changed {
+		t.Fatalf("ResyncNonce: changed=%v err=%v", changed, err)
+	}
+	n, _ := s.IncrNonce(ctx, testOwner, testProvider)
+	if n.Int64() != 8 {
+		t.Errorf("nonce after resync: got %d want 8", n.Int64())
+	}
+}
+
+func TestResyncNonce_NeverLowers(t *testing.T) {
+	s, _, _ := newTestSignerWithChainNonce(t, big.NewInt(10))
+	ctx := context.Background()
+	owner, provider := common.HexToAddress(testOwner), common.HexToAddress(testProvider)
+
+	s.IncrNonce(ctx, testOwner, testProvider) //nolint:errcheck // counter = 11
+
+	changed, err := s.ResyncNonce(ctx, owner, provider, big.NewInt(5))
+	if err != nil || changed {
+		t.Fatalf("ResyncNonce must not lower the counter: changed=%v err=%v", changed, err)
+	}
+	n, _ := s.IncrNonce(ctx, testOwner, testProvider)
+	if n.Int64() != 12 {
+		t.Errorf("nonce: got %d want 12", n.Int64())
+	}
+}
+
 // ── Enqueue ───────────────────────────────────────────────────────────────────
 
 func TestEnqueue_PushesToQueue(t *testing.T) {
@@ -287,6 +326,66 @@ func TestEnqueue_QueueItemIsValidJSON(t *testing.T) {
 	}
 }
 
+func TestEnqueue_StampsEnqueuedAtOnce(t *testing.T) {
+	s, rdb, _ := newTestSignerFull(t)
+	ctx := context.Background()
+	s.SetClock(clock.NewFake(time.Unix(1_800_000_000, 0)))
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+
+	user, provider := common.HexToAddress(testOwner), common.HexToAddress(testProviderHex)
+	fresh := &voucher.SandboxVoucher{SandboxID: "sb-new", User: user, Provider: provider, TotalFee: big.NewInt(1)}
+	requeued := &voucher.SandboxVoucher{SandboxID: "sb-old", User: user, Provider: provider, TotalFee: big.NewInt(1), EnqueuedAt: 1_700_000_000}
+	s.Enqueue(ctx, fresh)    //nolint:errcheck
+	s.Enqueue(ctx, requeued) //nolint:errcheck
+
+	for _, want := range []int64{1_800_000_000, 1_700_000_000} {
+		var got voucher.SandboxVoucher
+		json.Unmarshal([]byte(rdb.LPop(ctx, queueKey).Val()), &got) //nolint:errcheck
+		if got.EnqueuedAt != want {
+			t.Errorf("%s EnqueuedAt: got %d want %d", got.SandboxID, got.EnqueuedAt, want)
+		}
+	}
+}
+
+func TestEnqueue_EncryptedQueueItem(t *testing.T) {
+	s, rdb, _ := newTestSignerFull(t)
+	ctx := context.Background()
+	codec, err := voucher.NewCodec("k1:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetCodec(codec)
+
+	v := &voucher.SandboxVoucher{
+		SandboxID: "sb-enc",
+		User:      common.HexToAddress(testOwner),
+		Provider:  common.HexToAddress(testProviderHex),
+		TotalFee:  big.NewInt(200),
+		UsageHash: voucher.BuildUsageHash("sb-enc", 2000, 2060, 1),
+	}
+	if err := s.Enqueue(ctx, v); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+	item, _ := rdb.LPop(ctx, queueKey).Result()
+	if !strings.HasPrefix(item, "enc:k1:") || strings.Contains(item, "sb-enc") {
+		t.Fatalf("queue item %q is not sealed", item)
+	}
+	plain, err := codec.Open(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got voucher.SandboxVoucher
+	if err := json.Unmarshal(plain, &got); err != nil || got.SandboxID != "sb-enc" {
+		t.Errorf("opened item: %+v (%v)", got, err)
+	}
+	// The pending index holds no voucher body and stays readable.
+	if pending, err := ListPending(ctx, rdb, "sb-enc"); err != nil || len(pending) != 1 {
+		t.Errorf("ListPending: %v (%v), want one entry", pending, err)
+	}
+}
+
 // ── Sign + Enqueue ────────────────────────────────────────────────────────────
 
 func TestSign_SignatureVerifiable(t *testing.T) {
@@ -374,3 +473,294 @@ func TestEnqueue_MultipleVouchers_FIFOOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestEnqueueBatch_OneRPushInOrder(t *testing.T) {
+	s, rdb, _ := newTestSignerFull(t)
+	ctx := context.Background()
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+
+	batch := func(n int) []*voucher.SandboxVoucher {
+		vs := make([]*voucher.SandboxVoucher, n)
+		for i := range vs {
+			vs[i] = &voucher.SandboxVoucher{
+				SandboxID: fmt.Sprintf("sb-%d", i+1),
+				User:      common.HexToAddress(testOwner),
+				Provider:  common.HexToAddress(testProviderHex),
+				TotalFee:  big.NewInt(int64(i+1) * 100),
+			}
+		}
+		return vs
+	}
+
+	// An invalid voucher anywhere in the batch: nothing is written.
+	bad := batch(3)
+	bad[1].TotalFee = nil
+	if err := s.EnqueueBatch(ctx, bad); !errors.Is(err, voucher.ErrInvalidVoucher) {
+		t.Fatalf("invalid batch: got %v, want ErrInvalidVoucher", err)
+	}
+	if n, _ := rdb.LLen(ctx, queueKey).Result(); n != 0 {
+		t.Fatalf("invalid batch queued %d vouchers", n)
+	}
+	if pending, _ := ListPending(ctx, rdb, "sb-1"); len(pending) != 0 {
+		t.Fatalf("invalid batch indexed %+v", pending)
+	}
+
+	if err := s.EnqueueBatch(ctx, batch(3)); err != nil {
+		t.Fatalf("EnqueueBatch: %v", err)
+	}
+	// The settler pops and signs in queue order, so nonces follow the batch.
+	for i := 1; i <= 3; i++ {
+		raw, err := rdb.LPop(ctx, queueKey).Result()
+		if err != nil {
+			t.Fatalf("LPop [%d]: %v", i, err)
+		}
+		var v voucher.SandboxVoucher
+		json.Unmarshal([]byte(raw), &v) //nolint:errcheck
+		if v.SandboxID != fmt.Sprintf("sb-%d", i) || v.EnqueuedAt == 0 {
+			t.Fatalf("queue[%d]: got %s, enqueued at %d", i, v.SandboxID, v.EnqueuedAt)
+		}
+		if pending, _ := ListPending(ctx, rdb, v.SandboxID); len(pending) != 1 {
+			t.Errorf("%s pending: got %+v", v.SandboxID, pending)
+		}
+		if err := s.Sign(ctx, &v); err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		if v.Nonce.Int64() != int64(i) {
+			t.Errorf("%s nonce: got %s want %d", v.SandboxID, v.Nonce, i)
+		}
+	}
+
+	// One voucher_queued event per voucher, with consecutive sequence numbers.
+	evs, _ := events.Since(ctx, rdb, common.HexToAddress(testOwner).Hex(), 0)
+	if len(evs) != 3 || evs[0].Seq != 1 || evs[2].Seq != 3 || evs[2].SandboxID != "sb-3" || evs[0].Type != events.TypeVoucherQueued {
+		t.Errorf("stream events: got %+v", evs)
+	}
+
+	if err := s.EnqueueBatch(ctx, nil); err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+}
+
+func TestEnqueueOpen_SkipsClosedSessions(t *testing.T) {
+	s, rdb, _ := newTestSignerFull(t)
+	ctx := context.Background()
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+
+	// sb-2's session was closed after its voucher was built.
+	for _, id := range []string{"sb-1", "sb-3"} {
+		CreateSession(ctx, rdb, Session{SandboxID: id, Owner: testOwner, Provider: testProvider}) //nolint:errcheck
+	}
+	var vs []*voucher.SandboxVoucher
+	for i := 1; i <= 3; i++ {
+		vs = append(vs, &voucher.SandboxVoucher{
+			SandboxID: fmt.Sprintf("sb-%d", i),
+			User:      common.HexToAddress(testOwner),
+			Provider:  common.HexToAddress(testProviderHex),
+			TotalFee:  big.NewInt(int64(i) * 100),
+		})
+	}
+
+	queued, err := s.EnqueueOpen(ctx, vs)
+	if err != nil {
+		t.Fatalf("EnqueueOpen: %v", err)
+	}
+	if fmt.Sprint(queued) != "[true false true]" {
+		t.Errorf("queued: got %v want [true false true]", queued)
+	}
+	var got []string
+	for _, raw := range rdb.LRange(ctx, queueKey, 0, -1).Val() {
+		var v voucher.SandboxVoucher
+		json.Unmarshal([]byte(raw), &v) //nolint:errcheck
+		got = append(got, v.SandboxID)
+	}
+	if fmt.Sprint(got) != "[sb-1 sb-3]" {
+		t.Errorf("queue: got %v want [sb-1 sb-3]", got)
+	}
+	if pending, _ := ListPending(ctx, rdb, "sb-2"); len(pending) != 0 {
+		t.Errorf("closed session indexed %+v", pending)
+	}
+	if pending, _ := ListPending(ctx, rdb, "sb-3"); len(pending) != 1 {
+		t.Errorf("sb-3 pending: got %+v", pending)
+	}
+	evs, _ := events.Since(ctx, rdb, common.HexToAddress(testOwner).Hex(), 0)
+	if len(evs) != 2 {
+		t.Errorf("stream events: got %d want 2", len(evs))
+	}
+}
+
+func TestEnqueue_IndexesPendingUntilSigned(t *testing.T) {
+	s, _, _ := newTestSignerFull(t)
+	ctx := context.Background()
+
+	v := &voucher.SandboxVoucher{
+		SandboxID: "sb-pending",
+		User:      common.HexToAddress(testOwner),
+		Provider:  common.HexToAddress(testProviderHex),
+		TotalFee:  big.NewInt(500),
+		UsageHash: voucher.BuildUsageHash("sb-pending", 1000, 1060, 60),
+	}
+	if err := s.Enqueue(ctx, v); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	pending, err := ListPending(ctx, s.rdb, "sb-pending")
+	if err != nil {
+		t.Fatalf("ListPending: %v", err)
+	}
+	if len(pending) != 1 || pending[0].TotalFee != "500" || pending[0].UsageHash != common.Hash(v.UsageHash).Hex() || pending[0].Nonce != "" {
+		t.Fatalf("after enqueue: got %+v", pending)
+	}
+
+	if err := s.Sign(ctx, v); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	pending, _ = ListPending(ctx, s.rdb, "sb-pending")
+	if len(pending) != 1 || pending[0].Nonce != "1" {
+		t.Errorf("after sign: got %+v, want nonce 1", pending)
+	}
+
+	// Signing a voucher whose entry has been cleared must not re-add it.
+	s.rdb.Del(ctx, fmt.Sprintf(voucher.PendingKeyFmt, "sb-pending"))
+	if err := s.Sign(ctx, v); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if pending, _ = ListPending(ctx, s.rdb, "sb-pending"); len(pending) != 0 {
+		t.Errorf("cleared entry resurrected: %+v", pending)
+	}
+}
+
+// Two vouchers with the same usage hash (v1 create fees for one sandbox in
+// the same second) get separate pending entries.
+func TestEnqueue_PendingKeepsVouchersWithEqualUsageHash(t *testing.T) {
+	s, _, _ := newTestSignerFull(t)
+	ctx := context.Background()
+
+	hash := voucher.BuildUsageHash("sb-twice", 1000, 1000, 0)
+	var vs []*voucher.SandboxVoucher
+	for _, fee := range []int64{100, 200} {
+		v := &voucher.SandboxVoucher{
+			SandboxID: "sb-twice",
+			User:      common.HexToAddress(testOwner),
+			Provider:  common.HexToAddress(testProviderHex),
+			TotalFee:  big.NewInt(fee),
+			UsageHash: hash,
+		}
+		if err := s.Enqueue(ctx, v); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+		vs = append(vs, v)
+	}
+	if vs[0].PendingField() == vs[1].PendingField() {
+		t.Fatalf("both vouchers use pending field %s", vs[0].PendingField())
+	}
+	pending, _ := ListPending(ctx, s.rdb, "sb-twice")
+	if len(pending) != 2 {
+		t.Fatalf("pending: got %+v, want both vouchers", pending)
+	}
+
+	// Clearing one (as the settler does) leaves the other.
+	s.rdb.HDel(ctx, fmt.Sprintf(voucher.PendingKeyFmt, "sb-twice"), vs[0].PendingField())
+	if pending, _ = ListPending(ctx, s.rdb, "sb-twice"); len(pending) != 1 || pending[0].TotalFee != "200" {
+		t.Errorf("after clearing one: got %+v", pending)
+	}
+}
+
+func TestEnqueueAndSign_RejectInvalidVoucher(t *testing.T) {
+	valid := func() *voucher.SandboxVoucher {
+		return &voucher.SandboxVoucher{
+			SandboxID: "sb-invalid",
+			User:      common.HexToAddress(testOwner),
+			Provider:  common.HexToAddress(testProviderHex),
+			TotalFee:  big.NewInt(500),
+		}
+	}
+	cases := map[string]func(v *voucher.SandboxVoucher){
+		"zero user":     func(v *voucher.SandboxVoucher) { v.User = common.Address{} },
+		"zero provider": func(v *voucher.SandboxVoucher) { v.Provider = common.Address{} },
+		"nil fee":       func(v *voucher.SandboxVoucher) { v.TotalFee = nil },
+		"negative fee":  func(v *voucher.SandboxVoucher) { v.TotalFee = big.NewInt(-1) },
+	}
+	for name, corrupt := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, rdb, _ := newTestSignerFull(t)
+			ctx := context.Background()
+			v := valid()
+			corrupt(v)
+
+			if err := s.Enqueue(ctx, v); !errors.Is(err, voucher.ErrInvalidVoucher) {
+				t.Errorf("Enqueue: got %v, want ErrInvalidVoucher", err)
+			}
+			queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProviderHex).Hex())
+			if n := rdb.LLen(ctx, queueKey).Val(); n != 0 {
+				t.Errorf("invalid voucher queued: queue length %d", n)
+			}
+
+			if err := s.Sign(ctx, v); !errors.Is(err, voucher.ErrInvalidVoucher) {
+				t.Errorf("Sign: got %v, want ErrInvalidVoucher", err)
+			}
+			if v.Nonce != nil || v.Signature != nil {
+				t.Error("invalid voucher must not be assigned a nonce or signed")
+			}
+			if n := rdb.Keys(ctx, "billing:nonce:*").Val(); len(n) != 0 {
+				t.Errorf("nonce consumed for invalid voucher: %v", n)
+			}
+		})
+	}
+}
+
+// ── Benchmarks ────────────────────────────────────────────────────────────────
+
+// benchVouchers is one generator sweep's worth of period vouchers.
+func benchVouchers(n int) []*voucher.SandboxVoucher {
+	vs := make([]*voucher.SandboxVoucher, n)
+	for i := range vs {
+		id := fmt.Sprintf("sb-%d", i)
+		usage := voucher.UsageBreakdown{PeriodStart: 1_700_000_000, PeriodEnd: 1_700_003_600, UsageUnits: 3600, Rate: big.NewInt(pricePerSec)}
+		vs[i] = &voucher.SandboxVoucher{
+			SandboxID: id,
+			User:      common.HexToAddress(testOwner),
+			Provider:  common.HexToAddress(testProviderHex),
+			TotalFee:  big.NewInt(3600 * pricePerSec),
+			UsageHash: usage.Hash(id),
+			Usage:     &usage,
+		}
+	}
+	return vs
+}
+
+// BenchmarkEnqueue_PerItem queues a 100-voucher sweep one Enqueue at a time.
+func BenchmarkEnqueue_PerItem(b *testing.B) {
+	s, rdb, _ := newTestSignerFull(b)
+	ctx := context.Background()
+	vs := benchVouchers(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, v := range vs {
+			v.EnqueuedAt = 0
+			if err := s.Enqueue(ctx, v); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		rdb.FlushAll(ctx)
+		b.StartTimer()
+	}
+}
+
+// BenchmarkEnqueueBatch queues the same sweep with one EnqueueBatch.
+func BenchmarkEnqueueBatch(b *testing.B) {
+	s, rdb, _ := newTestSignerFull(b)
+	ctx := context.Background()
+	vs := benchVouchers(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, v := range vs {
+			v.EnqueuedAt = 0
+		}
+		if err := s.EnqueueBatch(ctx, vs); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		rdb.FlushAll(ctx)
+		b.StartTimer()
+	}
+}
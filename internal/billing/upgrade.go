@@ -0,0 +1,125 @@
+package billing
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// Upgrade modes (UPGRADE_MODE) control how the service reacts when the
+// settlement contract's EIP-712 domain separator changes under it.
+const (
+	// UpgradeModeResign adopts the new domain separator; every voucher still
+	// in the queue is signed against it when the settler pops it.
+	UpgradeModeResign = "resign"
+	// UpgradeModePause halts settlement until an operator intervenes.
+	UpgradeModePause = "pause"
+	// UpgradeModeOff disables the watcher entirely.
+	UpgradeModeOff = "off"
+)
+
+const upgradePollInterval = 30 * time.Second
+
+// UpgradeSource reads beacon upgrades and the on-chain domain separator.
+// Satisfied by *chain.Client; decoupled here so the billing package does not
+// import chain.
+type UpgradeSource interface {
+	BeaconAddress(ctx context.Context) (common.Address, error)
+	LatestBlock(ctx context.Context) (uint64, error)
+	GetUpgradedEvents(ctx context.Context, beacon common.Address, fromBlock uint64) ([]common.Address, uint64, error)
+	DomainSeparator(ctx context.Context) ([32]byte, error)
+}
+
+// RunUpgradeWatcher polls the beacon for Upgraded events while the service is
+// running. On upgrade it pauses signing, re-reads the contract's
+// domainSeparator and — depending on mode — either adopts the new domain and
+// resumes, or stays paused. The domain is also reconciled once at startup.
+// Blocks until ctx is cancelled.
+func RunUpgradeWatcher(ctx context.Context, src UpgradeSource, s *Signer, mode string, log *zap.Logger) {
+	if mode == UpgradeModeOff {
+		log.Info("upgrade watcher disabled")
+		return
+	}
+	beacon, err := src.BeaconAddress(ctx)
+	if err != nil {
+		log.Warn("upgrade watcher: cannot read beacon address; upgrades will not be detected", zap.Error(err))
+		return
+	}
+	lastBlock, err := src.LatestBlock(ctx)
+	if err != nil {
+		log.Warn("upgrade watcher: cannot read latest block; upgrades will not be detected", zap.Error(err))
+		return
+	}
+	log.Info("upgrade watcher started", zap.String("beacon", beacon.Hex()), zap.String("mode", mode))
+
+	// pending is set while an upgrade has been seen but the new domain could
+	// not be read yet; signing stays paused and reconcile is retried.
+	pending := !reconcileDomain(ctx, src, s, mode, log)
+
+	t := time.NewTicker(upgradePollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("upgrade watcher stopped")
+			return
+		case <-t.C:
+		}
+
+		impls, latest, err := src.GetUpgradedEvents(ctx, beacon, lastBlock+1)
+		if err != nil {
+			log.Warn("upgrade watcher: poll Upgraded", zap.Error(err))
+		} else {
+			lastBlock = latest
+			for _, impl := range impls {
+				log.Warn("SETTLEMENT CONTRACT UPGRADED — pausing voucher signing to re-check EIP-712 domain",
+					zap.String("implementation", impl.Hex()),
+				)
+			}
+			if len(impls) > 0 {
+				s.PauseSigning()
+				pending = true
+			}
+		}
+		if pending {
+			pending = !reconcileDomain(ctx, src, s, mode, log)
+		}
+	}
+}
+
+// reconcileDomain compares the contract's domainSeparator with the one the
+// signer uses and applies mode on mismatch. Returns false if the on-chain
+// value could not be read (the caller retries on the next tick).
+func reconcileDomain(ctx context.Context, src UpgradeSource, s *Signer, mode string, log *zap.Logger) bool {
+	onchain, err := src.DomainSeparator(ctx)
+	if err != nil {
+		log.Error("upgrade watcher: read domainSeparator", zap.Error(err))
+		return false
+	}
+	current := s.DomainSeparator()
+	if onchain == current {
+		if s.SigningPaused() {
+			log.Info("EIP-712 domain unchanged — resuming voucher signing")
+		}
+		s.ResumeSigning()
+		return true
+	}
+
+	fields := []zap.Field{
+		zap.String("old_domain", "0x"+hex.EncodeToString(current[:])),
+		zap.String("new_domain", "0x"+hex.EncodeToString(onchain[:])),
+	}
+	switch mode {
+	case UpgradeModePause:
+		s.PauseSigning()
+		log.Error("EIP-712 DOMAIN SEPARATOR CHANGED — settlement PAUSED (UPGRADE_MODE=pause); restart with the new domain or switch to resign", fields...)
+	default:
+		s.SetDomainSeparator(onchain)
+		s.ResumeSigning()
+		log.Warn("EIP-712 DOMAIN SEPARATOR CHANGED — queued vouchers will be signed with the new domain", fields...)
+	}
+	return true
+}
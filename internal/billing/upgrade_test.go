@@ -0,0 +1,100 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+type mockUpgradeSource struct {
+	sep [32]byte
+	err error
+}
+
+func (m *mockUpgradeSource) BeaconAddress(context.Context) (common.Address, error) {
+	return common.Address{}, nil
+}
+func (m *mockUpgradeSource) LatestBlock(context.Context) (uint64, error) { return 0, nil }
+func (m *mockUpgradeSource) GetUpgradedEvents(context.Context, common.Address, uint64) ([]common.Address, uint64, error) {
+	return nil, 0, nil
+}
+func (m *mockUpgradeSource) DomainSeparator(context.Context) ([32]byte, error) { return m.sep, m.err }
+
+func TestReconcileDomain_Unchanged_Resumes(t *testing.T) {
+	s, _, _ := newTestSignerFull(t)
+	s.PauseSigning()
+	src := &mockUpgradeSource{sep: s.DomainSeparator()}
+
+	if !reconcileDomain(context.Background(), src, s, UpgradeModeResign, zap.NewNop()) {
+		t.Fatal("reconcile should succeed")
+	}
+	if s.SigningPaused() {
+		t.Error("signing should resume when the domain is unchanged")
+	}
+}
+
+func TestReconcileDomain_Changed_Resign(t *testing.T) {
+	s, _, signerAddr := newTestSignerFull(t)
+	newSep := [32]byte{0x42}
+	src := &mockUpgradeSource{sep: newSep}
+
+	reconcileDomain(context.Background(), src, s, UpgradeModeResign, zap.NewNop())
+
+	if s.SigningPaused() {
+		t.Error("resign mode must not leave signing paused")
+	}
+	if s.DomainSeparator() != newSep {
+		t.Fatal("signer should adopt the on-chain domain separator")
+	}
+
+	// A voucher signed now must verify against the new domain only.
+	v := &voucher.SandboxVoucher{
+		User:     common.HexToAddress(testProviderHex),
+		Provider: common.HexToAddress(testProviderHex),
+		TotalFee: big.NewInt(1),
+	}
+	if err := s.Sign(context.Background(), v); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	got, err := voucher.Verify(v, testChainID, common.HexToAddress(testContractHex))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got == signerAddr {
+		t.Error("voucher signed after resign should not verify against the old domain")
+	}
+}
+
+func TestReconcileDomain_Changed_Pause(t *testing.T) {
+	s, _, _ := newTestSignerFull(t)
+	src := &mockUpgradeSource{sep: [32]byte{0x42}}
+
+	reconcileDomain(context.Background(), src, s, UpgradeModePause, zap.NewNop())
+
+	if !s.SigningPaused() {
+		t.Fatal("pause mode should pause signing on domain change")
+	}
+	v := &voucher.SandboxVoucher{User: common.HexToAddress(testProviderHex), Provider: common.HexToAddress(testProviderHex)}
+	if err := s.Sign(context.Background(), v); !errors.Is(err, ErrSigningPaused) {
+		t.Errorf("Sign while paused: got %v want ErrSigningPaused", err)
+	}
+}
+
+func TestReconcileDomain_ReadError_Retries(t *testing.T) {
+	s, _, _ := newTestSignerFull(t)
+	s.PauseSigning()
+	src := &mockUpgradeSource{err: errors.New("rpc down")}
+
+	if reconcileDomain(context.Background(), src, s, UpgradeModeResign, zap.NewNop()) {
+		t.Error("reconcile should report failure so the watcher retries")
+	}
+	if !s.SigningPaused() {
+		t.Error("signing must stay paused while the new domain is unknown")
+	}
+}
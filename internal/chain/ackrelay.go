@@ -0,0 +1,81 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrInvalidAckTx wraps the reasons RelayAcknowledgement refuses to send a
+// transaction.
+var ErrInvalidAckTx = errors.New("invalid acknowledgement tx")
+
+// ackCalldata is the input of acknowledgeTEESigner(provider, true).
+func ackCalldata(provider common.Address) ([]byte, error) {
+	parsed, err := SandboxServingMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Pack("acknowledgeTEESigner", provider, true)
+}
+
+// checkAckTx decodes a signed raw transaction and checks that user signed it
+// for chainID and that it calls acknowledgeTEESigner(provider, true) on
+// contract, without value. Failures wrap ErrInvalidAckTx.
+func checkAckTx(raw []byte, user common.Address, chainID *big.Int, contract, provider common.Address) (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("%w: decode: %v", ErrInvalidAckTx, err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recover sender: %v", ErrInvalidAckTx, err)
+	}
+	if from != user {
+		return nil, fmt.Errorf("%w: signed by %s, not %s", ErrInvalidAckTx, from.Hex(), user.Hex())
+	}
+	if tx.To() == nil || *tx.To() != contract {
+		return nil, fmt.Errorf("%w: not addressed to the settlement contract", ErrInvalidAckTx)
+	}
+	want, err := ackCalldata(provider)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tx.Data(), want) || tx.Value().Sign() != 0 {
+		return nil, fmt.Errorf("%w: not a call to acknowledgeTEESigner(%s, true) without value", ErrInvalidAckTx, provider.Hex())
+	}
+	return tx, nil
+}
+
+// RelayAcknowledgement broadcasts a raw transaction user signed with their
+// own wallet that calls acknowledgeTEESigner(provider, true), and waits for it
+// to be mined. acknowledgeTEESigner acknowledges for msg.sender, so the
+// provider cannot send it on the user's behalf; the user's account pays its
+// gas. Relaying a transaction that is already pending or mined waits on it
+// rather than failing, so a retry is harmless.
+func (c *Client) RelayAcknowledgement(ctx context.Context, user common.Address, raw []byte) (common.Hash, error) {
+	tx, err := checkAckTx(raw, user, c.chainID, c.contractAddr, c.providerAddr)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if _, err := c.eth.TransactionReceipt(ctx, tx.Hash()); err != nil {
+		if err := c.eth.SendTransaction(ctx, tx); err != nil && !strings.Contains(strings.ToLower(err.Error()), "already known") {
+			return common.Hash{}, fmt.Errorf("send acknowledgement: %w", err)
+		}
+	}
+	receipt, err := bind.WaitMined(ctx, c.eth, tx)
+	if err != nil {
+		return tx.Hash(), fmt.Errorf("wait mined: %w", err)
+	}
+	if receipt.Status == 0 {
+		return tx.Hash(), fmt.Errorf("tx reverted: %s", tx.Hash().Hex())
+	}
+	return tx.Hash(), nil
+}
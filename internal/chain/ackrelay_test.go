@@ -0,0 +1,49 @@
+package chain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestCheckAckTx(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	user := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(16602)
+	contract := common.HexToAddress("0x24cD979DDA16A1a4f8C8f2d6cA2a4D5aB1c1E4f0")
+	provider := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	data, err := ackCalldata(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(to common.Address, value int64, data []byte) []byte {
+		tx := types.MustSignNewTx(key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+			ChainID: chainID, Nonce: 3, Gas: 100000, GasFeeCap: big.NewInt(1), To: &to, Value: big.NewInt(value), Data: data,
+		})
+		raw, _ := tx.MarshalBinary()
+		return raw
+	}
+
+	if _, err := checkAckTx(sign(contract, 0, data), user, chainID, contract, provider); err != nil {
+		t.Fatalf("valid tx rejected: %v", err)
+	}
+	other, _ := ackCalldata(common.Address{9})
+	for name, tc := range map[string]struct {
+		raw  []byte
+		user common.Address
+	}{
+		"garbage":        {[]byte{1, 2, 3}, user},
+		"other signer":   {sign(contract, 0, data), common.Address{1}},
+		"other contract": {sign(common.Address{2}, 0, data), user},
+		"other provider": {sign(contract, 0, other), user},
+		"with value":     {sign(contract, 1, data), user},
+	} {
+		if _, err := checkAckTx(tc.raw, tc.user, chainID, contract, provider); !errors.Is(err, ErrInvalidAckTx) {
+			t.Errorf("%s: err %v, want ErrInvalidAckTx", name, err)
+		}
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"math/big"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 
@@ -55,8 +58,11 @@ type Client struct {
 	contract     *SandboxServing
 	contractAddr common.Address
 	chainID      *big.Int
-	teeKey       *ecdsa.PrivateKey // signs vouchers (EIP-712, off-chain) and settlement txs
+	teeKey       *ecdsa.PrivateKey // signs vouchers (EIP-712, off-chain)
+	txKey        *ecdsa.PrivateKey // sends transactions and pays gas; teeKey unless GAS_PAYER_KEY is set
 	providerAddr common.Address    // registered provider address (from PROVIDER_ADDRESS)
+	sender       *txSender         // account nonce and replacement of the txKey account
+	fees         txFees            // envelope and fees of sent transactions (TX_TYPE)
 
 	blockTimeMu  sync.Mutex
 	blockTimeSec float64    // cached avg block time in seconds
@@ -74,6 +80,16 @@ func NewClient(cfg *config.Config) (*Client, error) {
 		return nil, fmt.Errorf("parse tee private key: %w", err)
 	}
 
+	// The contract accepts settlement batches from any sender — vouchers are
+	// authenticated by the TEE signature and attributed to voucher.provider —
+	// so gas can be paid by a separate, separately funded key.
+	txKey := teeKey
+	if cfg.Chain.GasPayerKey != "" {
+		if txKey, err = crypto.HexToECDSA(strings.TrimPrefix(cfg.Chain.GasPayerKey, "0x")); err != nil {
+			return nil, fmt.Errorf("parse GAS_PAYER_KEY: %w", err)
+		}
+	}
+
 	// Provider address must be explicitly configured. It identifies which
 	// on-chain provider this billing service represents — the value goes into
 	// voucher.provider (EIP-712), the settler queue key, and on-chain pricing
@@ -87,6 +103,11 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	}
 	providerAddr := common.HexToAddress(cfg.Chain.ProviderAddress)
 
+	fees, err := newTxFees(cfg.Chain.TxType, cfg.Chain.TxTipCap, cfg.Chain.TxFeeCap)
+	if err != nil {
+		return nil, err
+	}
+
 	addr := common.HexToAddress(cfg.Chain.ContractAddress)
 	contract, err := NewSandboxServing(addr, eth)
 	if err != nil {
@@ -99,27 +120,39 @@ func NewClient(cfg *config.Config) (*Client, error) {
 		contractAddr: addr,
 		chainID:      big.NewInt(cfg.Chain.ChainID),
 		teeKey:       teeKey,
+		txKey:        txKey,
 		providerAddr: providerAddr,
+		sender:       newTxSender(eth, crypto.PubkeyToAddress(txKey.PublicKey)),
+		fees:         fees,
 	}, nil
 }
 
 // PrivateKey returns the TEE private key (for voucher signing).
 func (c *Client) PrivateKey() *ecdsa.PrivateKey { return c.teeKey }
 
+// SenderAddress returns the address that sends transactions and pays their
+// gas: the GAS_PAYER_KEY address if set, otherwise the TEE address.
+func (c *Client) SenderAddress() common.Address { return crypto.PubkeyToAddress(c.txKey.PublicKey) }
+
 // ChainID returns the configured chain ID.
 func (c *Client) ChainID() *big.Int { return c.chainID }
 
 // ContractAddress returns the settlement contract address.
 func (c *Client) ContractAddress() common.Address { return c.contractAddr }
 
-// transactOpts builds a *bind.TransactOpts signed by the TEE key.
+// transactOpts builds a *bind.TransactOpts signed by the gas-payer key, with
+// the fees of the configured transaction type (see txFees).
 // The settlement contract no longer requires msg.sender == provider.
+// The account nonce is filled in by c.sender when the tx is sent.
 func (c *Client) transactOpts(ctx context.Context) (*bind.TransactOpts, error) {
-	auth, err := bind.NewKeyedTransactorWithChainID(c.teeKey, c.chainID)
+	auth, err := bind.NewKeyedTransactorWithChainID(c.txKey, c.chainID)
 	if err != nil {
 		return nil, err
 	}
 	auth.Context = ctx
+	if err := c.fees.apply(ctx, auth, c.eth); err != nil {
+		return nil, err
+	}
 	return auth, nil
 }
 
@@ -143,38 +176,93 @@ func toContractVouchers(vs []voucher.SandboxVoucher) []SandboxServingSandboxVouc
 // Used to identify VoucherSettled logs in a tx receipt.
 var voucherSettledTopic = crypto.Keccak256Hash([]byte("VoucherSettled(address,address,uint256,bytes32,uint256,uint8)"))
 
+// settleAttempts bounds how often SettleFeesWithTEE submits a batch whose tx
+// reverted.
+const settleAttempts = 2
+
 // SettleFeesWithTEE submits a batch of signed vouchers to the contract and
 // returns per-voucher settlement statuses.
 //
-// Statuses are recovered in two steps:
-//  1. Parse VoucherSettled events from the receipt — the contract emits these
-//     for SUCCESS and INSUFFICIENT_BALANCE (after the nonce is committed).
-//  2. For vouchers that emitted no event (PROVIDER_MISMATCH, NOT_ACKNOWLEDGED,
-//     INVALID_NONCE, INVALID_SIGNATURE — all return before the nonce commit),
-//     call PreviewSettlementResults with the original vouchers.  Because the
-//     nonce was never committed, the view function still evaluates correctly.
+// The batch is previewed (PreviewSettlementResults) right before it is
+// submitted, so every voucher has an accurate status however the tx result is
+// decoded — as the simulated-chain client in the integration tests does:
+//  1. A batch in which no voucher previews as settleable (SUCCESS or
+//     INSUFFICIENT_BALANCE) is not submitted: the contract rejects such
+//     vouchers before any state change, so the preview is final and no gas
+//     is spent.
+//  2. VoucherSettled events in the receipt override the preview for the
+//     vouchers they cover — they record what the tx actually did.
+//  3. A voucher that previewed as settleable but emitted no event was
+//     rejected because state changed between preview and submit (e.g. its
+//     nonce was settled by a concurrent batch); it is previewed again.  Its
+//     nonce was never committed, so the view function still evaluates it
+//     correctly.
+//
+// A reverted tx changes nothing; the batch is re-previewed and submitted once
+// more before giving up. Account nonces are assigned locally (see txSender),
+// so back-to-back batches do not collide, and a tx left unmined is replaced
+// at the same nonce with higher fees. An empty batch is a no-op: nothing is
+// previewed or sent.
 func (c *Client) SettleFeesWithTEE(ctx context.Context, vouchers []voucher.SandboxVoucher) ([]SettlementStatus, error) {
-	opts, err := c.transactOpts(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("build tx opts: %w", err)
+	if len(vouchers) == 0 {
+		return nil, nil
 	}
+	var reverted error
+	for attempt := 0; attempt < settleAttempts; attempt++ {
+		preview, err := c.PreviewSettlementResults(ctx, vouchers)
+		if err != nil {
+			return nil, fmt.Errorf("preview batch: %w", err)
+		}
+		if !anySettleable(preview) {
+			return preview, nil
+		}
 
-	tx, err := c.contract.SettleFeesWithTEE(opts, toContractVouchers(vouchers))
-	if err != nil {
-		return nil, fmt.Errorf("SettleFeesWithTEE tx: %w", err)
-	}
+		opts, err := c.transactOpts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("build tx opts: %w", err)
+		}
+		cvs := toContractVouchers(vouchers)
+		submit := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return c.contract.SettleFeesWithTEE(opts, cvs)
+		}
+		tx, err := c.sender.send(ctx, opts, submit)
+		if err != nil {
+			return nil, fmt.Errorf("SettleFeesWithTEE tx: %w", err)
+		}
+		receipt, err := c.sender.waitMined(ctx, tx, opts, submit)
+		if err != nil {
+			return nil, fmt.Errorf("wait mined: %w", err)
+		}
+		if receipt.Status == 0 {
+			reverted = fmt.Errorf("tx reverted: %s", tx.Hash().Hex())
+			continue
+		}
 
-	receipt, err := bind.WaitMined(ctx, c.eth, tx)
-	if err != nil {
-		return nil, fmt.Errorf("wait mined: %w", err)
-	}
-	if receipt.Status == 0 {
-		return nil, fmt.Errorf("tx reverted: %s", tx.Hash().Hex())
+		statuses, recheck := mergeSettlementStatuses(vouchers, preview, c.settledEvents(receipt))
+		if len(recheck) > 0 {
+			again := make([]voucher.SandboxVoucher, len(recheck))
+			for j, i := range recheck {
+				again[j] = vouchers[i]
+			}
+			fallback, err := c.PreviewSettlementResults(ctx, again)
+			if err != nil {
+				return nil, fmt.Errorf("preview no-event vouchers: %w", err)
+			}
+			for j, i := range recheck {
+				statuses[i] = fallback[j]
+			}
+		}
+		return statuses, nil
 	}
+	return nil, reverted
+}
+
+// settledKey identifies a voucher in VoucherSettled events.
+type settledKey struct{ user, nonce string }
 
-	// Step 1: parse VoucherSettled events → (user, nonce) → status.
-	type voucherKey struct{ user, nonce string }
-	fromEvent := make(map[voucherKey]SettlementStatus)
+// settledEvents parses the contract's VoucherSettled events in receipt.
+func (c *Client) settledEvents(receipt *types.Receipt) map[settledKey]SettlementStatus {
+	fromEvent := make(map[settledKey]SettlementStatus)
 	for _, log := range receipt.Logs {
 		if log.Address != c.contractAddr {
 			continue
@@ -186,41 +274,81 @@ func (c *Client) SettleFeesWithTEE(ctx context.Context, vouchers []voucher.Sandb
 		if err != nil {
 			continue
 		}
-		fromEvent[voucherKey{ev.User.Hex(), ev.Nonce.String()}] = SettlementStatus(ev.Status)
+		fromEvent[settledKey{ev.User.Hex(), ev.Nonce.String()}] = SettlementStatus(ev.Status)
 	}
+	return fromEvent
+}
 
-	// Step 2: assign statuses; collect vouchers that emitted no event.
-	statuses := make([]SettlementStatus, len(vouchers))
-	var missingIdx []int
-	var missingVouchers []voucher.SandboxVoucher
-	for i, v := range vouchers {
-		key := voucherKey{v.User.Hex(), v.Nonce.String()}
-		if s, ok := fromEvent[key]; ok {
-			statuses[i] = s
-		} else {
-			missingIdx = append(missingIdx, i)
-			missingVouchers = append(missingVouchers, v)
+// settleable reports whether the contract commits the voucher's nonce (and
+// emits VoucherSettled) when it returns s.
+func settleable(s SettlementStatus) bool {
+	return s == StatusSuccess || s == StatusInsufficientBalance
+}
+
+func anySettleable(statuses []SettlementStatus) bool {
+	for _, s := range statuses {
+		if settleable(s) {
+			return true
 		}
 	}
+	return false
+}
 
-	// Step 3: preview the no-event vouchers to get the specific failure reason.
-	if len(missingVouchers) > 0 {
-		fallback, err := c.PreviewSettlementResults(ctx, missingVouchers)
-		if err != nil {
-			return nil, fmt.Errorf("preview no-event vouchers: %w", err)
+// mergeSettlementStatuses combines the pre-submit preview with the receipt's
+// events: events win; a voucher without one keeps its preview status unless
+// the preview expected an event, in which case its index is returned in
+// recheck to be previewed again.
+func mergeSettlementStatuses(vouchers []voucher.SandboxVoucher, preview []SettlementStatus, fromEvent map[settledKey]SettlementStatus) (statuses []SettlementStatus, recheck []int) {
+	statuses = make([]SettlementStatus, len(vouchers))
+	for i, v := range vouchers {
+		if s, ok := fromEvent[settledKey{v.User.Hex(), v.Nonce.String()}]; ok {
+			statuses[i] = s
+			continue
 		}
-		for j, i := range missingIdx {
-			statuses[i] = fallback[j]
+		statuses[i] = preview[i]
+		if settleable(preview[i]) {
+			recheck = append(recheck, i)
 		}
 	}
+	return statuses, recheck
+}
 
-	return statuses, nil
+// ResyncAccountNonce makes the next transaction re-read the sending account's
+// pending nonce from the node. Satisfies settler.AccountNonceResyncer.
+func (c *Client) ResyncAccountNonce() { c.sender.resync() }
+
+// RelayDeposit deposits amount into recipient's balance with the configured
+// provider, paying both the value and the gas from the sending key (see
+// SenderAddress). Used by the experimental deposit relay; waits for the tx to
+// be mined.
+func (c *Client) RelayDeposit(ctx context.Context, recipient common.Address, amount *big.Int) (common.Hash, error) {
+	opts, err := c.transactOpts(ctx)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("build tx opts: %w", err)
+	}
+	opts.Value = amount
+	submit := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.contract.Deposit(opts, recipient, c.providerAddr)
+	}
+	tx, err := c.sender.send(ctx, opts, submit)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("deposit tx: %w", err)
+	}
+	receipt, err := c.sender.waitMined(ctx, tx, opts, submit)
+	if err != nil {
+		return tx.Hash(), fmt.Errorf("wait mined: %w", err)
+	}
+	if receipt.Status == 0 {
+		return tx.Hash(), fmt.Errorf("tx reverted: %s", tx.Hash().Hex())
+	}
+	return tx.Hash(), nil
 }
 
 // PreviewSettlementResults calls the view function to check expected statuses
-// without submitting a transaction.
+// without submitting a transaction. The call is made from the provider
+// address, as the settler's own view of its batch.
 func (c *Client) PreviewSettlementResults(ctx context.Context, vouchers []voucher.SandboxVoucher) ([]SettlementStatus, error) {
-	opts := &bind.CallOpts{Context: ctx}
+	opts := &bind.CallOpts{Context: ctx, From: c.providerAddr}
 	raw, err := c.contract.PreviewSettlementResults(opts, toContractVouchers(vouchers))
 	if err != nil {
 		return nil, fmt.Errorf("PreviewSettlementResults: %w", err)
@@ -496,6 +624,62 @@ func (c *Client) GetServiceInfo(ctx context.Context, provider common.Address) (*
 	}, nil
 }
 
+// ServiceSigner returns this provider's on-chain TEE signer address and
+// signerVersion. Satisfies billing.RotationSource.
+func (c *Client) ServiceSigner(ctx context.Context) (common.Address, *big.Int, error) {
+	svc, err := c.GetServiceInfo(ctx, c.providerAddr)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if svc == nil {
+		return common.Address{}, nil, fmt.Errorf("service not registered for %s", c.providerAddr.Hex())
+	}
+	return svc.TEESignerAddress, svc.SignerVersion, nil
+}
+
+// ServiceFeeSchedule returns this provider's current on-chain compute rates,
+// converted to per second as by GetServicePricing, and its signerVersion.
+// Satisfies billing.FeeScheduleSource.
+func (c *Client) ServiceFeeSchedule(ctx context.Context) (pricePerCPUPerSec, pricePerMemGBPerSec, signerVersion *big.Int, err error) {
+	svc, err := c.GetServiceInfo(ctx, c.providerAddr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if svc == nil {
+		return nil, nil, nil, fmt.Errorf("service not registered for %s", c.providerAddr.Hex())
+	}
+	cpuPerSec := new(big.Int).Div(svc.PricePerCPUPerMin, big.NewInt(60))
+	memPerSec := new(big.Int).Div(svc.PricePerMemGBPerMin, big.NewInt(60))
+	return cpuPerSec, memPerSec, svc.SignerVersion, nil
+}
+
+// VerifyService checks that PROVIDER_ADDRESS has a service registered on the
+// contract whose teeSignerAddress is this server's TEE key, or one of extra
+// (the outgoing key during a key rotation). Otherwise every voucher fails
+// settlement, so the billing server refuses to start.
+func (c *Client) VerifyService(ctx context.Context, extra ...common.Address) error {
+	svc, err := c.GetServiceInfo(ctx, c.providerAddr)
+	if err != nil {
+		return err
+	}
+	held := append([]common.Address{crypto.PubkeyToAddress(c.teeKey.PublicKey)}, extra...)
+	return checkService(svc, c.providerAddr, held)
+}
+
+// checkService is VerifyService's check of a GetServiceInfo result; held[0]
+// is the TEE key address.
+func checkService(svc *ServiceInfo, provider common.Address, held []common.Address) error {
+	if svc == nil {
+		return fmt.Errorf("no service registered for PROVIDER_ADDRESS %s: register it with `cmd/provider register --tee-signer %s`",
+			provider.Hex(), held[0].Hex())
+	}
+	if slices.Contains(held, svc.TEESignerAddress) {
+		return nil
+	}
+	return fmt.Errorf("service of PROVIDER_ADDRESS %s names TEE signer %s, but this server's TEE key is %s: check PROVIDER_ADDRESS, or update the service with `cmd/provider register --tee-signer %s`",
+		provider.Hex(), svc.TEESignerAddress.Hex(), held[0].Hex(), held[0].Hex())
+}
+
 // ProviderEvent holds a decoded ServiceUpdated event from the contract.
 type ProviderEvent struct {
 	Provider         common.Address
@@ -567,3 +751,95 @@ func (c *Client) GetProviderBalance(ctx context.Context, user, provider common.A
 	}
 	return result.Balance, result.PendingRefund, result.RefundUnlockAt, nil
 }
+
+// beaconSlot is the ERC-1967 beacon storage slot used by BeaconProxy:
+// keccak256("eip1967.proxy.beacon") - 1.
+var beaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+
+// BeaconAddress reads the UpgradeableBeacon address from the proxy's ERC-1967
+// beacon slot.
+func (c *Client) BeaconAddress(ctx context.Context) (common.Address, error) {
+	raw, err := c.eth.StorageAt(ctx, c.contractAddr, beaconSlot, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("read beacon slot: %w", err)
+	}
+	return common.BytesToAddress(raw), nil
+}
+
+// BeaconImplementation returns the implementation address the beacon
+// currently points at.
+func (c *Client) BeaconImplementation(ctx context.Context, beacon common.Address) (common.Address, error) {
+	b, err := NewUpgradeableBeaconCaller(beacon, c.eth)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("bind beacon: %w", err)
+	}
+	impl, err := b.Implementation(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return common.Address{}, fmt.Errorf("implementation: %w", err)
+	}
+	return impl, nil
+}
+
+// LockTime returns the contract's LOCK_TIME: the delay in seconds between a
+// refund request and when the funds can be withdrawn.
+func (c *Client) LockTime(ctx context.Context) (*big.Int, error) {
+	t, err := c.contract.LOCKTIME(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("LOCK_TIME: %w", err)
+	}
+	return t, nil
+}
+
+// ProviderStake returns the stake a provider must lock to register a service.
+func (c *Client) ProviderStake(ctx context.Context) (*big.Int, error) {
+	stake, err := c.contract.ProviderStake(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("providerStake: %w", err)
+	}
+	return stake, nil
+}
+
+// DomainSeparator returns the EIP-712 domain separator stored in the contract.
+func (c *Client) DomainSeparator(ctx context.Context) ([32]byte, error) {
+	opts := &bind.CallOpts{Context: ctx}
+	sep, err := c.contract.DomainSeparator(opts)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("domainSeparator: %w", err)
+	}
+	return sep, nil
+}
+
+// LatestBlock returns the current block number.
+func (c *Client) LatestBlock(ctx context.Context) (uint64, error) {
+	return c.eth.BlockNumber(ctx)
+}
+
+// GetUpgradedEvents returns the implementation addresses from beacon Upgraded
+// logs in [fromBlock, latest]. Returns the events, the latest block, and any error.
+func (c *Client) GetUpgradedEvents(ctx context.Context, beacon common.Address, fromBlock uint64) ([]common.Address, uint64, error) {
+	latest, err := c.eth.BlockNumber(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get block number: %w", err)
+	}
+	if fromBlock > latest {
+		return nil, latest, nil
+	}
+	filterer, err := NewUpgradeableBeaconFilterer(beacon, c.eth)
+	if err != nil {
+		return nil, latest, fmt.Errorf("bind beacon: %w", err)
+	}
+	iter, err := filterer.FilterUpgraded(&bind.FilterOpts{Start: fromBlock, End: &latest, Context: ctx}, nil)
+	if err != nil {
+		return nil, latest, fmt.Errorf("FilterUpgraded: %w", err)
+	}
+	defer iter.Close()
+
+	var impls []common.Address
+	for iter.Next() {
+		impls = append(impls, iter.Event.Implementation)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, latest, fmt.Errorf("iterate Upgraded: %w", err)
+	}
+	return impls, latest, nil
+}
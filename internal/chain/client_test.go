@@ -0,0 +1,68 @@
+package chain_test
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+)
+
+func TestNewClient_GasPayerKey(t *testing.T) {
+	teeKey, _ := crypto.GenerateKey()
+	payerKey, _ := crypto.GenerateKey()
+	cfg := &config.Config{Chain: config.ChainConfig{
+		RPCURL:          "http://127.0.0.1:1", // not dialled until a call is made
+		ContractAddress: "0x0000000000000000000000000000000000000001",
+		ProviderAddress: "0x0000000000000000000000000000000000000002",
+		ChainID:         16602,
+		TEEPrivateKey:   hex.EncodeToString(crypto.FromECDSA(teeKey)),
+	}}
+
+	c, err := chain.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if got, want := c.SenderAddress(), crypto.PubkeyToAddress(teeKey.PublicKey); got != want {
+		t.Errorf("default sender: got %s want TEE address %s", got.Hex(), want.Hex())
+	}
+
+	cfg.Chain.GasPayerKey = "0x" + hex.EncodeToString(crypto.FromECDSA(payerKey))
+	if c, err = chain.NewClient(cfg); err != nil {
+		t.Fatalf("NewClient with GAS_PAYER_KEY: %v", err)
+	}
+	if got, want := c.SenderAddress(), crypto.PubkeyToAddress(payerKey.PublicKey); got != want {
+		t.Errorf("sender: got %s want gas payer %s", got.Hex(), want.Hex())
+	}
+	if got := crypto.PubkeyToAddress(c.PrivateKey().PublicKey); got != crypto.PubkeyToAddress(teeKey.PublicKey) {
+		t.Errorf("voucher signing key must stay the TEE key, got %s", got.Hex())
+	}
+
+	cfg.Chain.GasPayerKey = "not-a-key"
+	if _, err := chain.NewClient(cfg); err == nil {
+		t.Error("expected an error for a malformed GAS_PAYER_KEY")
+	}
+}
+
+// TestSettleFeesWithTEE_EmptyBatchIsNoop checks an empty batch makes no RPC
+// call: the endpoint refuses connections, so any call would fail.
+func TestSettleFeesWithTEE_EmptyBatchIsNoop(t *testing.T) {
+	teeKey, _ := crypto.GenerateKey()
+	c, err := chain.NewClient(&config.Config{Chain: config.ChainConfig{
+		RPCURL:          "http://127.0.0.1:1",
+		ContractAddress: "0x0000000000000000000000000000000000000001",
+		ProviderAddress: "0x0000000000000000000000000000000000000002",
+		ChainID:         16602,
+		TEEPrivateKey:   hex.EncodeToString(crypto.FromECDSA(teeKey)),
+	}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	statuses, err := c.SettleFeesWithTEE(context.Background(), nil)
+	if err != nil || len(statuses) != 0 {
+		t.Errorf("empty batch: got %v, %v; want no statuses and no error", statuses, err)
+	}
+}
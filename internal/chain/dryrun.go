@@ -0,0 +1,123 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// ErrDryRun is returned by DryRunClient reads that only the chain can answer.
+var ErrDryRun = errors.New("dry run: no chain configured")
+
+// DryRunClient stands in for Client under DRY_RUN (config.Config.DryRun), for
+// local development and demos without an RPC endpoint or contract. It never
+// dials anything: settlement batches are logged and reported as settled, so
+// the Redis nonces advance as if they had been, and nonces start from 0.
+// Every line it logs starts with "DRY RUN"; the dry_run=true field comes
+// from the logger it is given (cmd/billing labels every line of a dry run).
+type DryRunClient struct {
+	teeKey       *ecdsa.PrivateKey
+	chainID      *big.Int
+	providerAddr common.Address
+	log          *zap.Logger
+}
+
+// NewDryRunClient returns a DryRunClient signing with the TEE key in cfg.
+// Vouchers name the zero address as contract; SETTLEMENT_CONTRACT must be
+// unset (see config.Config.DryRun).
+func NewDryRunClient(cfg *config.Config, log *zap.Logger) (*DryRunClient, error) {
+	teeKey, err := crypto.HexToECDSA(cfg.Chain.TEEPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse tee private key: %w", err)
+	}
+	if cfg.Chain.ProviderAddress == "" {
+		return nil, fmt.Errorf("PROVIDER_ADDRESS is required")
+	}
+	return &DryRunClient{
+		teeKey:       teeKey,
+		chainID:      big.NewInt(cfg.Chain.ChainID),
+		providerAddr: common.HexToAddress(cfg.Chain.ProviderAddress),
+		log:          log,
+	}, nil
+}
+
+// PrivateKey returns the TEE private key (for voucher signing).
+func (c *DryRunClient) PrivateKey() *ecdsa.PrivateKey { return c.teeKey }
+
+// SenderAddress returns the TEE address; nothing is ever sent from it.
+func (c *DryRunClient) SenderAddress() common.Address {
+	return crypto.PubkeyToAddress(c.teeKey.PublicKey)
+}
+
+// ChainID returns the configured chain ID, used only in the EIP-712 domain.
+func (c *DryRunClient) ChainID() *big.Int { return c.chainID }
+
+// ContractAddress returns the zero address.
+func (c *DryRunClient) ContractAddress() common.Address { return common.Address{} }
+
+// VerifyService skips the provider service check.
+func (c *DryRunClient) VerifyService(context.Context, ...common.Address) error {
+	c.log.Warn("DRY RUN: provider service check skipped", zap.String("provider", c.providerAddr.Hex()))
+	return nil
+}
+
+// GetServicePricing reports no on-chain prices, so the env prices apply.
+func (c *DryRunClient) GetServicePricing(context.Context, common.Address) (*big.Int, *big.Int, *big.Int, error) {
+	return new(big.Int), new(big.Int), new(big.Int), nil
+}
+
+// GetServiceInfo reports the provider as not registered.
+func (c *DryRunClient) GetServiceInfo(context.Context, common.Address) (*ServiceInfo, error) {
+	return nil, nil
+}
+
+// GetLastNonce reports nothing settled yet: the signer's Redis nonce counter
+// starts from 0 and is the only record thereafter.
+func (c *DryRunClient) GetLastNonce(context.Context, common.Address, common.Address) (*big.Int, error) {
+	return new(big.Int), nil
+}
+
+// SettleFeesWithTEE logs the batch it would submit and reports every voucher
+// as settled.
+func (c *DryRunClient) SettleFeesWithTEE(_ context.Context, vouchers []voucher.SandboxVoucher) ([]SettlementStatus, error) {
+	total := new(big.Int)
+	for _, v := range vouchers {
+		total.Add(total, v.TotalFee)
+		c.log.Info("DRY RUN: would settle voucher",
+			zap.String("sandbox", v.SandboxID),
+			zap.String("user", v.User.Hex()),
+			zap.String("nonce", v.Nonce.String()),
+			zap.String("total_fee", v.TotalFee.String()),
+		)
+	}
+	c.log.Info("DRY RUN: would submit settleFeesWithTEE, reporting SUCCESS",
+		zap.Int("vouchers", len(vouchers)),
+		zap.String("total_fee", total.String()),
+	)
+	return make([]SettlementStatus, len(vouchers)), nil // all StatusSuccess
+}
+
+// BeaconAddress returns ErrDryRun.
+func (c *DryRunClient) BeaconAddress(context.Context) (common.Address, error) {
+	return common.Address{}, ErrDryRun
+}
+
+// BeaconImplementation returns ErrDryRun.
+func (c *DryRunClient) BeaconImplementation(context.Context, common.Address) (common.Address, error) {
+	return common.Address{}, ErrDryRun
+}
+
+// LockTime returns ErrDryRun.
+func (c *DryRunClient) LockTime(context.Context) (*big.Int, error) { return nil, ErrDryRun }
+
+// ProviderStake returns ErrDryRun.
+func (c *DryRunClient) ProviderStake(context.Context) (*big.Int, error) { return nil, ErrDryRun }
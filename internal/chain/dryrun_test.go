@@ -0,0 +1,70 @@
+package chain_test
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+func TestDryRunClient(t *testing.T) {
+	teeKey, _ := crypto.GenerateKey()
+	cfg := &config.Config{DryRun: true, Chain: config.ChainConfig{
+		ProviderAddress: "0x0000000000000000000000000000000000000002",
+		ChainID:         16602,
+		TEEPrivateKey:   hex.EncodeToString(crypto.FromECDSA(teeKey)),
+	}}
+	core, logs := observer.New(zap.InfoLevel)
+	c, err := chain.NewDryRunClient(cfg, zap.New(core).With(zap.Bool("dry_run", true)))
+	if err != nil {
+		t.Fatalf("NewDryRunClient: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := c.VerifyService(ctx); err != nil {
+		t.Errorf("VerifyService: %v", err)
+	}
+	if n, err := c.GetLastNonce(ctx, common.Address{1}, common.Address{2}); err != nil || n.Sign() != 0 {
+		t.Errorf("GetLastNonce: %v, %v; want 0", n, err)
+	}
+	vs := []voucher.SandboxVoucher{
+		{SandboxID: "sb-1", TotalFee: big.NewInt(10), Nonce: big.NewInt(1)},
+		{SandboxID: "sb-2", TotalFee: big.NewInt(5), Nonce: big.NewInt(2)},
+	}
+	statuses, err := c.SettleFeesWithTEE(ctx, vs)
+	if err != nil || len(statuses) != 2 || statuses[0] != chain.StatusSuccess || statuses[1] != chain.StatusSuccess {
+		t.Errorf("SettleFeesWithTEE: %v, %v; want two SUCCESS", statuses, err)
+	}
+	if _, err := c.LockTime(ctx); err != chain.ErrDryRun {
+		t.Errorf("LockTime: %v, want ErrDryRun", err)
+	}
+
+	if logs.Len() != 4 {
+		t.Errorf("logged %d lines, want 4 (service check, two vouchers, batch)", logs.Len())
+	}
+	for _, e := range logs.All() {
+		if !strings.HasPrefix(e.Message, "DRY RUN: ") {
+			t.Errorf("unlabelled log line %q", e.Message)
+		}
+		// The caller's dry_run field is not repeated.
+		n := 0
+		for _, f := range e.Context {
+			if f.Key == "dry_run" {
+				n++
+			}
+		}
+		if n > 1 {
+			t.Errorf("log line %q carries dry_run %d times", e.Message, n)
+		}
+	}
+}
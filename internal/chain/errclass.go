@@ -0,0 +1,147 @@
+package chain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorClass says what a caller should do about a failed chain call.
+type ErrorClass int
+
+const (
+	// Transient errors (RPC unreachable, rate limited, timed out) go away on
+	// their own: retry after a backoff. Unrecognised errors are transient.
+	Transient ErrorClass = iota
+	// Permanent errors (the call reverts, the contract rejects the input)
+	// recur however often the same call is retried.
+	Permanent
+	// NonceIssue errors mean the sending account's nonce is out of step with
+	// the node: resync it, then retry.
+	NonceIssue
+)
+
+// Error class names, as used in CHAIN_ERROR_RULES.
+var errorClassNames = map[ErrorClass]string{
+	Transient:  "transient",
+	Permanent:  "permanent",
+	NonceIssue: "nonce",
+}
+
+func (c ErrorClass) String() string {
+	if s, ok := errorClassNames[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("ErrorClass(%d)", int(c))
+}
+
+// ErrorRule classifies errors whose message contains Match, compared case
+// insensitively.
+type ErrorRule struct {
+	Match string
+	Class ErrorClass
+}
+
+// DefaultErrorRules are go-ethereum's and common RPC providers' error
+// messages. The first matching rule wins.
+var DefaultErrorRules = []ErrorRule{
+	// Account nonce: reported by the node's tx pool.
+	{"nonce too low", NonceIssue},
+	{"nonce too high", NonceIssue},
+	{"replacement transaction underpriced", NonceIssue},
+
+	// The call itself is rejected.
+	{"execution reverted", Permanent},
+	{"tx reverted", Permanent}, // SettleFeesWithTEE, after its retry
+	{"no contract code at given address", Permanent},
+	{"exceeds block gas limit", Permanent},
+	{"intrinsic gas too low", Permanent},
+	{"invalid sender", Permanent},
+	{"abi: ", Permanent},
+
+	// The node or the network.
+	{"connection reset", Transient},
+	{"connection refused", Transient},
+	{"broken pipe", Transient},
+	{"i/o timeout", Transient},
+	{"no such host", Transient},
+	{": eof", Transient},
+	{"unexpected eof", Transient},
+	{"too many requests", Transient},
+	{"rate limit", Transient},
+	{"header not found", Transient},
+	{"insufficient funds", Transient}, // until the gas payer is topped up
+	{"already known", Transient},
+}
+
+// ErrorClassifier maps errors to an ErrorClass by matching their message
+// against rules, in order.
+type ErrorClassifier struct {
+	rules []ErrorRule
+}
+
+// NewErrorClassifier returns a classifier that tries overrides before
+// DefaultErrorRules, for chain- or provider-specific messages.
+func NewErrorClassifier(overrides []ErrorRule) *ErrorClassifier {
+	rules := make([]ErrorRule, 0, len(overrides)+len(DefaultErrorRules))
+	for _, set := range [][]ErrorRule{overrides, DefaultErrorRules} {
+		for _, r := range set {
+			rules = append(rules, ErrorRule{Match: strings.ToLower(r.Match), Class: r.Class})
+		}
+	}
+	return &ErrorClassifier{rules: rules}
+}
+
+var defaultClassifier = NewErrorClassifier(nil)
+
+// ClassifyError classifies err with DefaultErrorRules.
+func ClassifyError(err error) ErrorClass {
+	return defaultClassifier.Classify(err)
+}
+
+// Classify returns err's class. Anything no rule matches, including a
+// cancelled or timed-out context, is Transient, so an unknown failure is
+// retried rather than dropped.
+func (c *ErrorClassifier) Classify(err error) ErrorClass {
+	if err == nil {
+		return Transient
+	}
+	msg := strings.ToLower(err.Error())
+	for _, r := range c.rules {
+		if strings.Contains(msg, r.Match) {
+			return r.Class
+		}
+	}
+	return Transient
+}
+
+// ParseErrorRules parses CHAIN_ERROR_RULES: comma-separated
+// "<message substring>=<transient|permanent|nonce>" entries.
+func ParseErrorRules(spec string) ([]ErrorRule, error) {
+	var rules []ErrorRule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid error rule %q (want <message>=<class>)", entry)
+		}
+		match, name := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		class, ok := parseErrorClass(name)
+		if match == "" || !ok {
+			return nil, fmt.Errorf("invalid error rule %q (want <message>=transient, permanent or nonce)", entry)
+		}
+		rules = append(rules, ErrorRule{Match: match, Class: class})
+	}
+	return rules, nil
+}
+
+func parseErrorClass(name string) (ErrorClass, bool) {
+	for c, n := range errorClassNames {
+		if strings.EqualFold(n, name) {
+			return c, true
+		}
+	}
+	return 0, false
+}
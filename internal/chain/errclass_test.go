@@ -0,0 +1,59 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want ErrorClass
+	}{
+		{errors.New(`Post "https://evmrpc-testnet.0g.ai": read tcp 10.0.0.2:5432->1.2.3.4:443: read: connection reset by peer`), Transient},
+		{errors.New(`Post "https://evmrpc-testnet.0g.ai": dial tcp: lookup evmrpc-testnet.0g.ai: no such host`), Transient},
+		{errors.New(`Post "https://evmrpc-testnet.0g.ai": EOF`), Transient},
+		{errors.New("429 Too Many Requests: {\"jsonrpc\":\"2.0\",\"error\":{\"code\":-32005,\"message\":\"rate limit exceeded\"}}"), Transient},
+		{fmt.Errorf("preview batch: %w", context.DeadlineExceeded), Transient},
+		{errors.New("insufficient funds for gas * price + value: balance 0, tx cost 21000"), Transient},
+		{errors.New("something nobody has seen before"), Transient},
+		{errors.New("execution reverted: only provider"), Permanent},
+		{fmt.Errorf("wait mined: %w", errors.New("tx reverted: 0xdeadbeef")), Permanent},
+		{errors.New("no contract code at given address"), Permanent},
+		{errors.New("exceeds block gas limit"), Permanent},
+		{errors.New("SettleFeesWithTEE tx: nonce too low: next nonce 12, tx nonce 11"), NonceIssue},
+		{errors.New("Nonce Too High"), NonceIssue},
+		{errors.New("replacement transaction underpriced"), NonceIssue},
+	} {
+		if got := ClassifyError(tc.err); got != tc.want {
+			t.Errorf("ClassifyError(%q) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestErrorClassifier_OverridesComeFirst(t *testing.T) {
+	rules, err := ParseErrorRules("execution reverted: busy=transient, Gas Price Too Low=nonce ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewErrorClassifier(rules)
+	if got := c.Classify(errors.New("execution reverted: busy")); got != Transient {
+		t.Errorf("overridden revert: %s, want transient", got)
+	}
+	if got := c.Classify(errors.New("execution reverted: only provider")); got != Permanent {
+		t.Errorf("other revert: %s, want the default permanent", got)
+	}
+	if got := c.Classify(errors.New("gas price too low")); got != NonceIssue {
+		t.Errorf("case-insensitive override: %s, want nonce", got)
+	}
+}
+
+func TestParseErrorRules_Invalid(t *testing.T) {
+	for _, spec := range []string{"reverted", "=permanent", "reverted=fatal"} {
+		if _, err := ParseErrorRules(spec); err == nil {
+			t.Errorf("ParseErrorRules(%q): no error", spec)
+		}
+	}
+}
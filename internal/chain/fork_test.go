@@ -0,0 +1,295 @@
+//go:build fork
+
+package chain_test
+
+// Fork tests run the settlement path against the *deployed* SandboxServing
+// contract instead of a freshly deployed copy. Anvil forks the live chain state
+// at a block into memory; the test registers a throwaway provider on the fork,
+// funds a user, and checks that our voucher encoding and EIP-712 signatures are
+// accepted by the real on-chain logic via PreviewSettlementResults and
+// SettleFeesWithTEE. Nothing is sent to the live network and no gas is spent.
+//
+// Prerequisites:
+//
+//	anvil                  (Foundry) on PATH
+//	FORK_RPC_URL           archive RPC of the chain to fork (test skips when unset)
+//	FORK_CONTRACT          (optional; default: Galileo SandboxServing proxy)
+//	FORK_BLOCK             (optional; default: latest)
+//
+// Run with:
+//
+//	FORK_RPC_URL=https://<archive-rpc> go test -v -tags fork ./internal/chain/ -run TestFork
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const defaultForkContract = "0x24cD979DBd0Ae924a3f0c832a724CF4C58E5C210"
+
+// forkEnv holds a running Anvil fork and the accounts prepared on it.
+type forkEnv struct {
+	rpcURL       string
+	eth          *ethclient.Client
+	contract     *chain.SandboxServing
+	contractAddr common.Address
+	chainID      *big.Int
+	providerAddr common.Address
+	userAddr     common.Address
+}
+
+// startFork launches Anvil forking FORK_RPC_URL and returns once its RPC
+// answers. The process is killed on test cleanup.
+func startFork(t *testing.T) *forkEnv {
+	t.Helper()
+	upstream := os.Getenv("FORK_RPC_URL")
+	if upstream == "" {
+		t.Skip("FORK_RPC_URL not set")
+	}
+	anvil, err := exec.LookPath("anvil")
+	if err != nil {
+		t.Skip("anvil not found on PATH")
+	}
+	contractHex := os.Getenv("FORK_CONTRACT")
+	if contractHex == "" {
+		contractHex = defaultForkContract
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("pick port: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	args := []string{"--fork-url", upstream, "--port", fmt.Sprint(port), "--silent"}
+	if block := os.Getenv("FORK_BLOCK"); block != "" {
+		args = append(args, "--fork-block-number", block)
+	}
+	cmd := exec.Command(anvil, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start anvil: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+	})
+
+	rpcURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	var eth *ethclient.Client
+	var chainID *big.Int
+	for {
+		if eth, err = ethclient.Dial(rpcURL); err == nil {
+			if chainID, err = eth.ChainID(ctx); err == nil {
+				break
+			}
+			eth.Close()
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("anvil fork did not come up: %v", err)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	t.Cleanup(eth.Close)
+
+	contractAddr := common.HexToAddress(contractHex)
+	contract, err := chain.NewSandboxServing(contractAddr, eth)
+	if err != nil {
+		t.Fatalf("bind contract: %v", err)
+	}
+	providerKey, _ := crypto.HexToECDSA(providerKeyHex)
+	userKey, _ := crypto.HexToECDSA(userKeyHex)
+	return &forkEnv{
+		rpcURL:       rpcURL,
+		eth:          eth,
+		contract:     contract,
+		contractAddr: contractAddr,
+		chainID:      chainID,
+		providerAddr: crypto.PubkeyToAddress(providerKey.PublicKey),
+		userAddr:     crypto.PubkeyToAddress(userKey.PublicKey),
+	}
+}
+
+// transactor returns a keyed transactor for one of the Anvil default accounts,
+// which Anvil funds on the fork.
+func (f *forkEnv) transactor(t *testing.T, keyHex string) *bind.TransactOpts {
+	t.Helper()
+	key, _ := crypto.HexToECDSA(keyHex)
+	auth, err := bind.NewKeyedTransactorWithChainID(key, f.chainID)
+	if err != nil {
+		t.Fatalf("transactor: %v", err)
+	}
+	return auth
+}
+
+// mustMine waits for tx and fails the test if it reverted.
+func (f *forkEnv) mustMine(t *testing.T, what string, send func() (interface{ Hash() common.Hash }, error)) {
+	t.Helper()
+	tx, err := send()
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for {
+		receipt, err := f.eth.TransactionReceipt(ctx, tx.Hash())
+		if err == nil {
+			if receipt.Status != 1 {
+				t.Fatalf("%s: tx reverted", what)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%s: not mined: %v", what, err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// setupParties registers the provider (TEE signer == provider) on the forked
+// contract, deposits for the user and acknowledges the TEE signer.
+func (f *forkEnv) setupParties(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	callOpts := &bind.CallOpts{Context: ctx}
+
+	providerAuth := f.transactor(t, providerKeyHex)
+	exists, err := f.contract.ServiceExists(callOpts, f.providerAddr)
+	if err != nil {
+		t.Fatalf("ServiceExists: %v", err)
+	}
+	if !exists {
+		stake, err := f.contract.ProviderStake(callOpts)
+		if err != nil {
+			t.Fatalf("ProviderStake: %v", err)
+		}
+		providerAuth.Value = stake
+	}
+	f.mustMine(t, "addOrUpdateService", func() (interface{ Hash() common.Hash }, error) {
+		return f.contract.AddOrUpdateService(providerAuth, "https://fork.test", f.providerAddr,
+			big.NewInt(100), big.NewInt(0), big.NewInt(0))
+	})
+
+	userAuth := f.transactor(t, userKeyHex)
+	userAuth.Value = big.NewInt(1e18)
+	f.mustMine(t, "deposit", func() (interface{ Hash() common.Hash }, error) {
+		return f.contract.Deposit(userAuth, f.userAddr, f.providerAddr)
+	})
+	userAuth.Value = nil
+	f.mustMine(t, "acknowledgeTEESigner", func() (interface{ Hash() common.Hash }, error) {
+		return f.contract.AcknowledgeTEESigner(userAuth, f.providerAddr, true)
+	})
+}
+
+// nextVoucher builds and signs the voucher that follows the chain's lastNonce.
+func (f *forkEnv) nextVoucher(t *testing.T, sandboxID string) voucher.SandboxVoucher {
+	t.Helper()
+	last, err := f.contract.GetLastNonce(&bind.CallOpts{}, f.userAddr, f.providerAddr)
+	if err != nil {
+		t.Fatalf("GetLastNonce: %v", err)
+	}
+	usage := voucher.UsageBreakdown{PeriodStart: 1000, PeriodEnd: 1060, UsageUnits: 60}
+	v := voucher.SandboxVoucher{
+		SandboxID: sandboxID,
+		User:      f.userAddr,
+		Provider:  f.providerAddr,
+		TotalFee:  big.NewInt(6000),
+		UsageHash: usage.Hash(sandboxID),
+		Usage:     &usage,
+		Nonce:     new(big.Int).Add(last, big.NewInt(1)),
+	}
+	providerKey, _ := crypto.HexToECDSA(providerKeyHex)
+	if err := voucher.Sign(&v, providerKey, f.chainID, f.contractAddr); err != nil {
+		t.Fatalf("sign voucher: %v", err)
+	}
+	return v
+}
+
+// client returns a chain.Client pointed at the fork, acting as the provider.
+func (f *forkEnv) client(t *testing.T) *chain.Client {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Chain.RPCURL = f.rpcURL
+	cfg.Chain.ContractAddress = f.contractAddr.Hex()
+	cfg.Chain.TEEPrivateKey = providerKeyHex
+	cfg.Chain.ProviderAddress = f.providerAddr.Hex()
+	cfg.Chain.ChainID = f.chainID.Int64()
+	c, err := chain.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("chain.NewClient: %v", err)
+	}
+	return c
+}
+
+// ── tests ─────────────────────────────────────────────────────────────────────
+
+// TestFork_PreviewAndSettle checks that a voucher produced by our encoder is
+// previewed as SUCCESS and then settles, advancing lastNonce on the fork.
+func TestFork_PreviewAndSettle(t *testing.T) {
+	f := startFork(t)
+	f.setupParties(t)
+	c := f.client(t)
+	ctx := context.Background()
+
+	v := f.nextVoucher(t, "sb-fork-1")
+	preview, err := c.PreviewSettlementResults(ctx, []voucher.SandboxVoucher{v})
+	if err != nil {
+		t.Fatalf("PreviewSettlementResults: %v", err)
+	}
+	if len(preview) != 1 || preview[0] != chain.StatusSuccess {
+		t.Fatalf("preview: got %v want [SUCCESS]", preview)
+	}
+
+	statuses, err := c.SettleFeesWithTEE(ctx, []voucher.SandboxVoucher{v})
+	if err != nil {
+		t.Fatalf("SettleFeesWithTEE: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0] != chain.StatusSuccess {
+		t.Fatalf("settle: got %v want [SUCCESS]", statuses)
+	}
+	last, err := c.GetLastNonce(ctx, f.userAddr, f.providerAddr)
+	if err != nil {
+		t.Fatalf("GetLastNonce: %v", err)
+	}
+	if last.Cmp(v.Nonce) != 0 {
+		t.Errorf("lastNonce after settle: got %s want %s", last, v.Nonce)
+	}
+}
+
+// TestFork_TamperedVoucherRejected checks that the deployed contract rejects a
+// voucher whose fee was changed after signing, i.e. that the fee is covered by
+// our EIP-712 encoding.
+func TestFork_TamperedVoucherRejected(t *testing.T) {
+	f := startFork(t)
+	f.setupParties(t)
+	c := f.client(t)
+
+	v := f.nextVoucher(t, "sb-fork-2")
+	v.TotalFee = new(big.Int).Add(v.TotalFee, big.NewInt(1))
+	preview, err := c.PreviewSettlementResults(context.Background(), []voucher.SandboxVoucher{v})
+	if err != nil {
+		t.Fatalf("PreviewSettlementResults: %v", err)
+	}
+	if len(preview) != 1 || preview[0] != chain.StatusInvalidSignature {
+		t.Errorf("preview: got %v want [INVALID_SIGNATURE]", preview)
+	}
+}
@@ -0,0 +1,37 @@
+package chain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCheckService(t *testing.T) {
+	provider := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tee := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	prev := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+
+	for _, tc := range []struct {
+		name    string
+		svc     *ServiceInfo
+		held    []common.Address
+		wantErr string
+	}{
+		{"registered with TEE key", &ServiceInfo{TEESignerAddress: tee}, []common.Address{tee}, ""},
+		{"rotation: still the outgoing key", &ServiceInfo{TEESignerAddress: prev}, []common.Address{tee, prev}, ""},
+		{"not registered", nil, []common.Address{tee}, "no service registered"},
+		{"other signer", &ServiceInfo{TEESignerAddress: other}, []common.Address{tee, prev}, "names TEE signer " + other.Hex()},
+	} {
+		err := checkService(tc.svc, provider, tc.held)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		case err != nil && !strings.Contains(err.Error(), "--tee-signer "+tee.Hex()):
+			t.Errorf("%s: error %q does not suggest the TEE key", tc.name, err)
+		}
+	}
+}
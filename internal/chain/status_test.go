@@ -0,0 +1,47 @@
+package chain
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+func TestMergeSettlementStatuses(t *testing.T) {
+	user := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	vs := make([]voucher.SandboxVoucher, 4)
+	for i := range vs {
+		vs[i] = voucher.SandboxVoucher{User: user, Nonce: big.NewInt(int64(i + 1))}
+	}
+	preview := []SettlementStatus{
+		StatusSuccess,         // settled as previewed
+		StatusSuccess,         // balance drained between preview and submit
+		StatusNotAcknowledged, // rejected; no event expected
+		StatusSuccess,         // no event: state changed, must be re-previewed
+	}
+	events := map[settledKey]SettlementStatus{
+		{user.Hex(), "1"}: StatusSuccess,
+		{user.Hex(), "2"}: StatusInsufficientBalance,
+	}
+
+	got, recheck := mergeSettlementStatuses(vs, preview, events)
+	want := []SettlementStatus{StatusSuccess, StatusInsufficientBalance, StatusNotAcknowledged, StatusSuccess}
+	if !slices.Equal(got, want) {
+		t.Errorf("statuses: got %v want %v", got, want)
+	}
+	if !slices.Equal(recheck, []int{3}) {
+		t.Errorf("recheck: got %v want [3]", recheck)
+	}
+}
+
+func TestAnySettleable(t *testing.T) {
+	if anySettleable([]SettlementStatus{StatusInvalidNonce, StatusNotAcknowledged, StatusInvalidSignature, StatusProviderMismatch}) {
+		t.Error("a batch of rejected vouchers must not be submitted")
+	}
+	if !anySettleable([]SettlementStatus{StatusInvalidNonce, StatusInsufficientBalance}) {
+		t.Error("INSUFFICIENT_BALANCE still settles (and drains) on-chain")
+	}
+}
@@ -0,0 +1,110 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/0gfoundation/0g-sandbox/internal/units"
+)
+
+// Transaction envelopes selectable with TX_TYPE (config.ChainConfig.TxType).
+const (
+	// TxTypeLegacy sends EIP-155 legacy transactions priced with
+	// eth_gasPrice. The default: it is what the 0G Galileo testnet accepts
+	// (the e2e tests fund accounts with legacy transfers).
+	TxTypeLegacy = "legacy"
+	// TxTypeDynamic sends EIP-1559 dynamic-fee transactions.
+	TxTypeDynamic = "dynamic"
+)
+
+// feeSource is the part of the RPC client that txFees reads. Satisfied by
+// *ethclient.Client and the simulated backend's client.
+type feeSource interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+}
+
+// txFees fixes the envelope and fee fields of the transactions Client sends,
+// rather than leaving bind to pick one from the latest header.
+type txFees struct {
+	txType string
+	tipCap *big.Int // dynamic only; nil = eth_maxPriorityFeePerGas
+	feeCap *big.Int // dynamic only; nil = tipCap + 2 * base fee
+}
+
+// newTxFees parses the TX_TYPE, TX_TIP_CAP and TX_FEE_CAP settings; caps are
+// per gas, in neuron or "<decimal> 0G".
+func newTxFees(txType, tipCap, feeCap string) (txFees, error) {
+	f := txFees{txType: txType}
+	switch txType {
+	case "", TxTypeLegacy:
+		f.txType = TxTypeLegacy
+		if tipCap != "" || feeCap != "" {
+			return txFees{}, errors.New("TX_TIP_CAP and TX_FEE_CAP apply to TX_TYPE=dynamic only")
+		}
+		return f, nil
+	case TxTypeDynamic:
+	default:
+		return txFees{}, fmt.Errorf("invalid TX_TYPE %q (want %s or %s)", txType, TxTypeLegacy, TxTypeDynamic)
+	}
+	var err error
+	if tipCap != "" {
+		if f.tipCap, err = units.ParseAmount(tipCap); err != nil {
+			return txFees{}, fmt.Errorf("TX_TIP_CAP: %w", err)
+		}
+	}
+	if feeCap != "" {
+		if f.feeCap, err = units.ParseAmount(feeCap); err != nil {
+			return txFees{}, fmt.Errorf("TX_FEE_CAP: %w", err)
+		}
+	}
+	if f.tipCap != nil && f.feeCap != nil && f.feeCap.Cmp(f.tipCap) < 0 {
+		return txFees{}, fmt.Errorf("TX_FEE_CAP %s is below TX_TIP_CAP %s", f.feeCap, f.tipCap)
+	}
+	return f, nil
+}
+
+// apply sets opts' fee fields so bind builds the configured envelope: a
+// gas price for legacy, both caps for dynamic.
+func (f txFees) apply(ctx context.Context, opts *bind.TransactOpts, src feeSource) error {
+	opts.GasPrice, opts.GasTipCap, opts.GasFeeCap = nil, nil, nil
+	if f.txType != TxTypeDynamic {
+		price, err := src.SuggestGasPrice(ctx)
+		if err != nil {
+			return fmt.Errorf("suggest gas price: %w", err)
+		}
+		opts.GasPrice = price
+		return nil
+	}
+
+	tip := f.tipCap
+	if tip == nil {
+		var err error
+		if tip, err = src.SuggestGasTipCap(ctx); err != nil {
+			return fmt.Errorf("suggest gas tip: %w", err)
+		}
+	}
+	feeCap := f.feeCap
+	if feeCap == nil {
+		head, err := src.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("latest header: %w", err)
+		}
+		if head.BaseFee == nil {
+			return errors.New("chain reports no base fee: dynamic-fee transactions need TX_TYPE=legacy or TX_FEE_CAP")
+		}
+		feeCap = new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+	}
+	if feeCap.Cmp(tip) < 0 {
+		// A configured fee cap below the suggested tip: pay at most the cap.
+		tip = feeCap
+	}
+	opts.GasTipCap, opts.GasFeeCap = tip, feeCap
+	return nil
+}
@@ -0,0 +1,125 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// The go-ethereum simulated backend always uses chainID 1337.
+var simChainID = big.NewInt(1337)
+
+func TestTxFees_SimulatedBackend(t *testing.T) {
+	gwei := big.NewInt(1_000_000_000)
+	for _, tc := range []struct {
+		name     string
+		fees     txFees
+		wantType uint8
+		wantTip  *big.Int // nil = not checked
+	}{
+		{"legacy", txFees{txType: TxTypeLegacy}, types.LegacyTxType, nil},
+		{"dynamic", txFees{txType: TxTypeDynamic}, types.DynamicFeeTxType, nil},
+		{"dynamic with caps", txFees{txType: TxTypeDynamic, tipCap: new(big.Int).Mul(gwei, big.NewInt(2)), feeCap: new(big.Int).Mul(gwei, big.NewInt(50))}, types.DynamicFeeTxType, new(big.Int).Mul(gwei, big.NewInt(2))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, _ := crypto.GenerateKey()
+			from := crypto.PubkeyToAddress(key.PublicKey)
+			backend := simulated.NewBackend(types.GenesisAlloc{from: {Balance: new(big.Int).Mul(gwei, big.NewInt(1e9))}})
+			t.Cleanup(func() { backend.Close() })
+			client := backend.Client()
+			ctx := context.Background()
+
+			opts, _ := bind.NewKeyedTransactorWithChainID(key, simChainID)
+			opts.Value, opts.GasLimit = big.NewInt(1), 21_000 // a plain transfer; nothing to estimate
+			if err := tc.fees.apply(ctx, opts, client); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			to := common.Address{0x42}
+			tx, err := bind.NewBoundContract(to, abi.ABI{}, client, client, client).Transfer(opts)
+			if err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			backend.Commit()
+
+			receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+			if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+				t.Fatalf("receipt %+v, err %v: want a successful tx", receipt, err)
+			}
+			if tx.Type() != tc.wantType {
+				t.Errorf("tx type %d, want %d", tx.Type(), tc.wantType)
+			}
+			if !tx.Protected() || tx.ChainId().Cmp(simChainID) != 0 {
+				t.Errorf("tx not replay-protected for chain %s (chain ID %s)", simChainID, tx.ChainId())
+			}
+			if tc.wantTip != nil && tx.GasTipCap().Cmp(tc.wantTip) != 0 {
+				t.Errorf("tip %s, want %s", tx.GasTipCap(), tc.wantTip)
+			}
+
+			// A replacement keeps the envelope (see bumpedOpts).
+			bumped := bumpedOpts(opts, tx, 20)
+			if (bumped.GasPrice != nil) != (tc.wantType == types.LegacyTxType) {
+				t.Errorf("bumped opts %+v do not match tx type %d", bumped, tc.wantType)
+			}
+		})
+	}
+}
+
+// noBaseFee is a pre-London feeSource.
+type noBaseFee struct{}
+
+func (noBaseFee) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	return &types.Header{}, nil
+}
+func (noBaseFee) SuggestGasPrice(context.Context) (*big.Int, error)  { return big.NewInt(7), nil }
+func (noBaseFee) SuggestGasTipCap(context.Context) (*big.Int, error) { return big.NewInt(1), nil }
+
+func TestTxFees_Apply(t *testing.T) {
+	ctx := context.Background()
+
+	opts := &bind.TransactOpts{GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)}
+	if err := (txFees{txType: TxTypeLegacy}).apply(ctx, opts, noBaseFee{}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.GasPrice.Int64() != 7 || opts.GasTipCap != nil || opts.GasFeeCap != nil {
+		t.Errorf("legacy opts: price %v tip %v cap %v, want 7, nil, nil", opts.GasPrice, opts.GasTipCap, opts.GasFeeCap)
+	}
+
+	// Without a base fee the fee cap cannot be derived, only configured.
+	if err := (txFees{txType: TxTypeDynamic}).apply(ctx, &bind.TransactOpts{}, noBaseFee{}); err == nil {
+		t.Error("dynamic fees on a chain without base fee: want an error")
+	}
+	opts = &bind.TransactOpts{}
+	if err := (txFees{txType: TxTypeDynamic, feeCap: big.NewInt(5)}).apply(ctx, opts, noBaseFee{}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.GasTipCap.Int64() != 1 || opts.GasFeeCap.Int64() != 5 || opts.GasPrice != nil {
+		t.Errorf("dynamic opts: tip %v cap %v price %v, want 1, 5, nil", opts.GasTipCap, opts.GasFeeCap, opts.GasPrice)
+	}
+}
+
+func TestNewTxFees(t *testing.T) {
+	if f, err := newTxFees("", "", ""); err != nil || f.txType != TxTypeLegacy {
+		t.Errorf("default: %+v, %v; want legacy", f, err)
+	}
+	f, err := newTxFees(TxTypeDynamic, "2000000000", "0.0000001 0G")
+	if err != nil || f.tipCap.Int64() != 2_000_000_000 || f.feeCap.Int64() != 100_000_000_000 {
+		t.Errorf("dynamic caps: %+v, %v", f, err)
+	}
+	for _, tc := range [][3]string{
+		{"eip4844", "", ""},
+		{TxTypeLegacy, "1", ""},    // caps are dynamic-only
+		{TxTypeDynamic, "x", ""},   // unparsable
+		{TxTypeDynamic, "10", "5"}, // fee cap below tip
+	} {
+		if _, err := newTxFees(tc[0], tc[1], tc[2]); err == nil {
+			t.Errorf("newTxFees%q: want an error", tc)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Defaults for replacing a transaction that is not mined in time.
+const (
+	defaultBumpAfter   = 60 * time.Second
+	defaultBumpPercent = 20 // nodes require at least +10% to replace a pending tx
+	defaultMaxBumps    = 3
+)
+
+// txBackend is the part of *ethclient.Client the sender needs.
+type txBackend interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// txSender manages the account nonce of the sending key. The pending nonce is
+// fetched once and then incremented locally for every tx the node accepts, so
+// consecutive transactions do not race on PendingNonceAt and collide. It is
+// fetched again after a send fails.
+type txSender struct {
+	backend txBackend
+	from    common.Address
+
+	bumpAfter   time.Duration // resubmit with higher fees after this long unmined; 0 disables
+	bumpPercent int64
+	maxBumps    int
+	poll        time.Duration // receipt polling interval
+
+	mu     sync.Mutex
+	next   uint64
+	synced bool
+}
+
+func newTxSender(backend txBackend, from common.Address) *txSender {
+	return &txSender{
+		backend:     backend,
+		from:        from,
+		bumpAfter:   defaultBumpAfter,
+		bumpPercent: defaultBumpPercent,
+		maxBumps:    defaultMaxBumps,
+		poll:        time.Second,
+	}
+}
+
+// send calls submit with opts carrying the next account nonce. Senders are
+// serialised until the node has accepted or rejected the tx. A nonce the node
+// reports as used or out of order is resynced from the chain and submit is
+// retried once; after any other error the nonce is resynced on the next send,
+// since the tx may or may not have reached the node.
+func (s *txSender) send(ctx context.Context, opts *bind.TransactOpts, submit func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if !s.synced {
+			n, err := s.backend.PendingNonceAt(ctx, s.from)
+			if err != nil {
+				return nil, fmt.Errorf("fetch account nonce: %w", err)
+			}
+			s.next, s.synced = n, true
+		}
+		opts.Nonce = new(big.Int).SetUint64(s.next)
+		tx, err := submit(opts)
+		if err == nil {
+			s.next++
+			return tx, nil
+		}
+		s.synced = false
+		if attempt > 0 || !isNonceError(err) {
+			return nil, err
+		}
+	}
+}
+
+// resync makes the next send fetch the account nonce from the node again.
+func (s *txSender) resync() {
+	s.mu.Lock()
+	s.synced = false
+	s.mu.Unlock()
+}
+
+// isNonceError reports whether the node rejected a tx because its nonce is
+// already used, or leaves a gap, for the sending account.
+func isNonceError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "nonce too low") ||
+		strings.Contains(msg, "nonce too high") ||
+		strings.Contains(msg, "replacement transaction underpriced")
+}
+
+// waitMined waits until tx, or a replacement of it, is mined and returns its
+// receipt. When nothing is mined within bumpAfter, the tx is resubmitted
+// through submit at the same account nonce and gas limit with its fees raised
+// by bumpPercent, at most maxBumps times; the receipt of whichever version
+// lands is returned.
+func (s *txSender) waitMined(ctx context.Context, tx *types.Transaction, opts *bind.TransactOpts, submit func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Receipt, error) {
+	sent := []*types.Transaction{tx}
+	bumpAt := time.Now().Add(s.bumpAfter)
+	t := time.NewTicker(s.poll)
+	defer t.Stop()
+	for {
+		for _, tx := range sent {
+			// Like bind.WaitMined, errors other than NotFound are retried.
+			if receipt, err := s.backend.TransactionReceipt(ctx, tx.Hash()); err == nil {
+				return receipt, nil
+			}
+		}
+		if s.bumpAfter > 0 && len(sent) <= s.maxBumps && !time.Now().Before(bumpAt) {
+			// A failed replacement (e.g. "nonce too low" because an earlier
+			// version was just mined) is not fatal: keep polling what was sent.
+			if replaced, err := submit(bumpedOpts(opts, sent[len(sent)-1], s.bumpPercent)); err == nil {
+				sent = append(sent, replaced)
+			}
+			bumpAt = time.Now().Add(s.bumpAfter)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// bumpedOpts returns a copy of opts that replaces tx: same nonce and gas
+// limit, fees raised by pct percent (and by at least 1 wei).
+func bumpedOpts(opts *bind.TransactOpts, tx *types.Transaction, pct int64) *bind.TransactOpts {
+	o := *opts
+	o.Nonce = new(big.Int).SetUint64(tx.Nonce())
+	o.GasLimit = tx.Gas()
+	if tx.Type() == types.LegacyTxType {
+		o.GasPrice = bumpFee(tx.GasPrice(), pct)
+		o.GasFeeCap, o.GasTipCap = nil, nil
+	} else {
+		o.GasPrice = nil
+		o.GasFeeCap = bumpFee(tx.GasFeeCap(), pct)
+		o.GasTipCap = bumpFee(tx.GasTipCap(), pct)
+	}
+	return &o
+}
+
+func bumpFee(fee *big.Int, pct int64) *big.Int {
+	out := new(big.Int).Mul(fee, big.NewInt(100+pct))
+	out.Div(out, big.NewInt(100))
+	if floor := new(big.Int).Add(fee, common.Big1); out.Cmp(floor) < 0 {
+		out = floor
+	}
+	return out
+}
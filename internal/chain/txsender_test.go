@@ -0,0 +1,208 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeNode is a txBackend whose mempool accepts one tx per nonce (or a
+// replacement paying more) and mines whatever is in mined.
+type fakeNode struct {
+	mu          sync.Mutex
+	pending     uint64 // what PendingNonceAt reports
+	nonceCalls  int
+	pool        map[uint64]*types.Transaction
+	mined       map[common.Hash]bool
+	mineOnSend  bool
+	submissions []uint64
+}
+
+func newFakeNode(pending uint64) *fakeNode {
+	return &fakeNode{pending: pending, pool: map[uint64]*types.Transaction{}, mined: map[common.Hash]bool{}, mineOnSend: true}
+}
+
+func (n *fakeNode) PendingNonceAt(context.Context, common.Address) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nonceCalls++
+	return n.pending, nil
+}
+
+func (n *fakeNode) TransactionReceipt(_ context.Context, h common.Hash) (*types.Receipt, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.mined[h] {
+		return nil, ethereum.NotFound
+	}
+	return &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: h}, nil
+}
+
+// submit plays the node's side of eth_sendRawTransaction for a settlement tx.
+func (n *fakeNode) submit(opts *bind.TransactOpts) (*types.Transaction, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	nonce := opts.Nonce.Uint64()
+	tip := big.NewInt(1)
+	if opts.GasTipCap != nil {
+		tip = opts.GasTipCap
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{Nonce: nonce, Gas: 100_000, GasTipCap: tip, GasFeeCap: new(big.Int).Mul(tip, big.NewInt(2))})
+	switch old, ok := n.pool[nonce]; {
+	case nonce < n.pending && !ok:
+		return nil, errors.New("nonce too low")
+	case ok && tx.GasTipCap().Cmp(old.GasTipCap()) <= 0:
+		return nil, errors.New("replacement transaction underpriced")
+	}
+	n.pool[nonce] = tx
+	if nonce >= n.pending {
+		n.pending = nonce + 1
+	}
+	if n.mineOnSend {
+		n.mined[tx.Hash()] = true
+	}
+	n.submissions = append(n.submissions, nonce)
+	return tx, nil
+}
+
+func TestTxSender_BackToBackSettlements(t *testing.T) {
+	node := newFakeNode(7)
+	s := newTxSender(node, common.Address{1})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		opts := &bind.TransactOpts{}
+		tx, err := s.send(ctx, opts, node.submit)
+		if err != nil {
+			t.Fatalf("settlement %d: %v", i, err)
+		}
+		if got, want := tx.Nonce(), uint64(7+i); got != want {
+			t.Errorf("settlement %d: nonce %d want %d", i, got, want)
+		}
+		if _, err := s.waitMined(ctx, tx, opts, node.submit); err != nil {
+			t.Fatalf("settlement %d: wait mined: %v", i, err)
+		}
+	}
+	if node.nonceCalls != 1 {
+		t.Errorf("PendingNonceAt called %d times, want 1", node.nonceCalls)
+	}
+}
+
+func TestTxSender_ConcurrentSendsGetDistinctNonces(t *testing.T) {
+	node := newFakeNode(0)
+	s := newTxSender(node, common.Address{1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.send(context.Background(), &bind.TransactOpts{}, node.submit); err != nil {
+				t.Errorf("send: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(node.pool) != 10 {
+		t.Errorf("%d distinct nonces used by 10 sends", len(node.pool))
+	}
+}
+
+func TestTxSender_ResyncsAfterNonceError(t *testing.T) {
+	node := newFakeNode(3)
+	s := newTxSender(node, common.Address{1})
+	ctx := context.Background()
+	if _, err := s.send(ctx, &bind.TransactOpts{}, node.submit); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process spends nonces 4 and 5 from the same account.
+	node.mu.Lock()
+	node.pending = 6
+	node.mu.Unlock()
+
+	tx, err := s.send(ctx, &bind.TransactOpts{}, node.submit)
+	if err != nil {
+		t.Fatalf("send after external txs: %v", err)
+	}
+	if tx.Nonce() != 6 {
+		t.Errorf("nonce %d after resync, want 6", tx.Nonce())
+	}
+	if node.nonceCalls != 2 {
+		t.Errorf("PendingNonceAt called %d times, want 2", node.nonceCalls)
+	}
+
+	// Other errors are returned as-is and force a resync on the next send.
+	boom := errors.New("execution reverted")
+	if _, err := s.send(ctx, &bind.TransactOpts{}, func(*bind.TransactOpts) (*types.Transaction, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Fatalf("got %v want %v", err, boom)
+	}
+	if tx, err = s.send(ctx, &bind.TransactOpts{}, node.submit); err != nil || tx.Nonce() != 7 {
+		t.Fatalf("send after failed send: nonce %v err %v, want 7", tx, err)
+	}
+	if node.nonceCalls != 3 {
+		t.Errorf("PendingNonceAt called %d times, want 3", node.nonceCalls)
+	}
+}
+
+func TestTxSender_BumpReusesNonce(t *testing.T) {
+	node := newFakeNode(9)
+	node.mineOnSend = false
+	s := newTxSender(node, common.Address{1})
+	s.bumpAfter, s.poll = 20*time.Millisecond, 5*time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	opts := &bind.TransactOpts{}
+	first, err := s.send(ctx, opts, node.submit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mine the first replacement as soon as it is submitted.
+	submit := func(o *bind.TransactOpts) (*types.Transaction, error) {
+		tx, err := node.submit(o)
+		if err == nil {
+			node.mu.Lock()
+			node.mined[tx.Hash()] = true
+			node.mu.Unlock()
+		}
+		return tx, err
+	}
+	receipt, err := s.waitMined(ctx, first, opts, submit)
+	if err != nil {
+		t.Fatalf("wait mined: %v", err)
+	}
+	replaced := node.pool[9]
+	if receipt.TxHash != replaced.Hash() || replaced.Hash() == first.Hash() {
+		t.Fatalf("receipt %s, want the replacement %s", receipt.TxHash, replaced.Hash())
+	}
+	if replaced.GasTipCap().Cmp(first.GasTipCap()) <= 0 {
+		t.Errorf("replacement tip %s not above original %s", replaced.GasTipCap(), first.GasTipCap())
+	}
+	if got := node.submissions; len(got) != 2 || got[0] != 9 || got[1] != 9 {
+		t.Errorf("submitted nonces %v, want [9 9]", got)
+	}
+
+	// The replacement did not consume another nonce.
+	node.mineOnSend = true
+	next, err := s.send(ctx, &bind.TransactOpts{}, node.submit)
+	if err != nil || next.Nonce() != 10 {
+		t.Fatalf("next send: nonce %v err %v, want 10", next, err)
+	}
+}
+
+func TestBumpFee(t *testing.T) {
+	for _, tc := range []struct{ fee, want int64 }{{100, 120}, {1, 2}, {0, 1}} {
+		if got := bumpFee(big.NewInt(tc.fee), 20); got.Int64() != tc.want {
+			t.Errorf("bumpFee(%d): got %s want %d", tc.fee, got, tc.want)
+		}
+	}
+}
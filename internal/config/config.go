@@ -1,10 +1,17 @@
 package config
 
 import (
+	"crypto/ecdsa"
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/viper"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
 type Config struct {
@@ -14,6 +21,48 @@ type Config struct {
 	Chain   ChainConfig
 	Server  ServerConfig
 	Broker  BrokerConfig
+	Archive ArchiveConfig
+	Auth    AuthConfig
+
+	// DryRun runs the billing service without a chain, for local development
+	// and demos: settlement is logged and treated as successful (see
+	// chain.DryRunClient) and the balance and acknowledgement pre-checks are
+	// skipped. It refuses to start while RPC_URL or SETTLEMENT_CONTRACT is
+	// set, so a production deployment cannot end up billing without settling.
+	DryRun bool `mapstructure:"dry_run"`
+}
+
+// AuthConfig bounds the lifetime of wallet signatures (see
+// auth.MiddlewareWithOptions).
+type AuthConfig struct {
+	// MaxValiditySec is the furthest a signature's expires_at may lie ahead
+	// of now.
+	MaxValiditySec int64 `mapstructure:"max_validity_sec"`
+	// ClockSkewSec is the tolerated client clock difference: signatures are
+	// accepted this long past expires_at, and expires_at may exceed
+	// MaxValiditySec by as much.
+	ClockSkewSec int64 `mapstructure:"clock_skew_sec"`
+}
+
+// ArchiveConfig controls long-term retention of settled vouchers (see
+// internal/archive). Archiving is off unless Enabled.
+type ArchiveConfig struct {
+	// Backend is the storage.Store the archive is written to: "fs" (files
+	// under Dir; the default) or "redis" (the billing Redis, under
+	// ArchiveRedisPrefix).
+	Backend          string `mapstructure:"backend"`
+	Dir              string `mapstructure:"dir"`
+	BatchSize        int    `mapstructure:"batch_size"`
+	FlushIntervalSec int64  `mapstructure:"flush_interval_sec"`
+}
+
+// ArchiveRedisPrefix is the Redis key prefix of the "redis" archive backend.
+const ArchiveRedisPrefix = "archive:store:"
+
+// Enabled reports whether settled vouchers are archived: always with the
+// "redis" backend, with "fs" once Dir is set.
+func (c ArchiveConfig) Enabled() bool {
+	return c.Backend == "redis" || c.Dir != ""
 }
 
 type BrokerConfig struct {
@@ -29,11 +78,27 @@ type DaytonaConfig struct {
 	APIURL      string `mapstructure:"api_url"`
 	AdminKey    string `mapstructure:"admin_key"`
 	RegistryURL string `mapstructure:"registry_url"`
+	APIPrefix   string `mapstructure:"api_prefix"` // Daytona REST path prefix; also the proxy's inbound prefix
+	// CreateIDPaths is a comma-separated list of dot-separated JSON paths
+	// tried for the sandbox ID in create responses. Empty = built-in list.
+	CreateIDPaths string `mapstructure:"create_id_paths"`
+	// PublicBaseURL, if set, replaces the APIURL base in URLs returned to
+	// clients (preview and toolbox URLs). Empty = responses are unchanged.
+	PublicBaseURL string `mapstructure:"public_base_url"`
+	// Connection pool to Daytona (see daytona.TransportOptions).
+	MaxIdleConnsPerHost int  `mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeoutSec  int  `mapstructure:"idle_conn_timeout_sec"`
+	HTTP2               bool `mapstructure:"http2"`
 }
 
 type RedisConfig struct {
 	Addr     string `mapstructure:"addr"`
 	Password string `mapstructure:"password"`
+	// EncryptionKey encrypts vouchers at rest in Redis (queue, DLQ, archive
+	// queue): "<keyID>:<hex 32-byte key>", optionally followed by
+	// ",<keyID>:<hex>" entries for retired keys that may still decrypt older
+	// items. Empty = plaintext. See voucher.NewCodec.
+	EncryptionKey string `mapstructure:"encryption_key"`
 }
 
 type BillingConfig struct {
@@ -42,6 +107,110 @@ type BillingConfig struct {
 	PricePerCPUPerSec   string `mapstructure:"price_per_cpu_per_sec"`  // per CPU core/sec
 	PricePerMemGBPerSec string `mapstructure:"price_per_mem_gb_per_sec"` // per GB memory/sec
 	CreateFee           string `mapstructure:"create_fee"`
+	// CreateFeeEnabled and ComputeFeeEnabled switch each fee off entirely:
+	// no voucher is emitted, as opposed to a fee that is active but zero.
+	CreateFeeEnabled  bool `mapstructure:"create_fee_enabled"`
+	ComputeFeeEnabled bool `mapstructure:"compute_fee_enabled"`
+	// UpgradeMode controls the reaction to a contract upgrade that changes the
+	// EIP-712 domain separator: "resign" (default), "pause", or "off".
+	UpgradeMode string `mapstructure:"upgrade_mode"`
+	// MaxSandboxesPerOwner caps how many sandboxes one wallet may have
+	// running at once. 0 = unlimited.
+	MaxSandboxesPerOwner int `mapstructure:"max_sandboxes_per_owner"`
+	// CreateQuota caps how many sandboxes one wallet may create per
+	// CreateQuotaWindowSec (fixed windows aligned to the Unix epoch, so the
+	// default daily window resets at 00:00 UTC). 0 = unlimited.
+	CreateQuota          int   `mapstructure:"create_quota"`
+	CreateQuotaWindowSec int64 `mapstructure:"create_quota_window_sec"`
+	// ReceiptLabels is a comma-separated list of sandbox label keys echoed
+	// into billing sessions and settlement receipts. Empty = none.
+	ReceiptLabels string `mapstructure:"receipt_labels"`
+	// TrustedWallets is a comma-separated list of wallets whose sandboxes are
+	// not billed when labelled billing=disabled (see
+	// billing.EventHandler.SetTrustedWallets). Empty = the label is ignored.
+	TrustedWallets string `mapstructure:"trusted_wallets"`
+	// PeriodAlignment selects how compute periods are laid out: "relative"
+	// (default; each period starts where the previous one ended, counted from
+	// session start) or "wallclock" (periods end on multiples of the voucher
+	// interval since the Unix epoch, so all sandboxes share boundaries).
+	PeriodAlignment string `mapstructure:"period_alignment"`
+	// PreflightFailureMode decides what create and start do when the
+	// balance or acknowledgement RPC fails: "fail_closed" (default; reject
+	// with 502) or "fail_open" (admit unchecked and leave an actual shortfall
+	// to the settler, which stops the sandbox on an insufficient balance).
+	PreflightFailureMode string `mapstructure:"preflight_failure_mode"`
+	// RelayDepositEnabled turns on the EXPERIMENTAL deposit relay, which
+	// deposits into user accounts from the provider's own funds on the
+	// strength of a signed authorization. Off by default.
+	RelayDepositEnabled bool `mapstructure:"relay_deposit_enabled"`
+	// RelayDepositMax caps a single relayed deposit (neuron, or "<n> 0G").
+	RelayDepositMax string `mapstructure:"relay_deposit_max"`
+	// RelayDepositsPerDay caps relayed deposits per wallet per 24h.
+	RelayDepositsPerDay int `mapstructure:"relay_deposits_per_day"`
+	// RelayDepositDailyBudget caps the total relayed per 24h across all
+	// wallets (neuron, or "<n> 0G"); "0" = unlimited.
+	RelayDepositDailyBudget string `mapstructure:"relay_deposit_daily_budget"`
+	// MaxPerUserPerBatch caps how many of one user's vouchers go into a
+	// single settlement batch; the rest of the batch is filled round-robin
+	// from other users. 0 = no cap (plain queue order).
+	MaxPerUserPerBatch int `mapstructure:"max_per_user_per_batch"`
+	// SettleLockLeaseSec is the lease on the per-provider settle lock that
+	// keeps replicas sharing a voucher queue from settling concurrently; the
+	// holder renews it while a settlement is in flight.
+	SettleLockLeaseSec int `mapstructure:"settle_lock_lease_sec"`
+	// SettleMaxBatchSize caps how many vouchers one settlement transaction
+	// carries.
+	SettleMaxBatchSize int `mapstructure:"settle_max_batch_size"`
+	// SettleFlushIntervalSec lets vouchers accumulate before they settle: a
+	// batch is submitted once SettleMaxBatchSize vouchers are queued or the
+	// oldest has waited this long, whichever comes first, so generation can
+	// run more often than settlement without paying gas per voucher.
+	// 0 = settle as soon as a voucher is queued.
+	SettleFlushIntervalSec int `mapstructure:"settle_flush_interval_sec"`
+	// SettleReportIntervalSec is how often the settlement throughput report
+	// (settler.Report) is logged and refreshed for GET /api/admin/settle-report.
+	// 0 = no report.
+	SettleReportIntervalSec int `mapstructure:"settle_report_interval_sec"`
+	// SessionTTLSec is the sliding TTL on billing sessions, refreshed with
+	// every compute voucher, so a session whose stop/delete event was missed
+	// expires instead of being billed forever. 0 = no TTL.
+	SessionTTLSec int64 `mapstructure:"session_ttl_sec"`
+	// SessionReapIntervalSec is how often sessions are checked against
+	// Daytona; sessions whose sandbox no longer exists are closed. 0 = off.
+	SessionReapIntervalSec int64 `mapstructure:"session_reap_interval_sec"`
+	// StopWorkers is how many automatic stops (e.g. on insufficient balance)
+	// are processed in parallel; a sandbox is never stopped by two at once.
+	StopWorkers int `mapstructure:"stop_workers"`
+	// SandboxCheckSec makes the generator confirm a sandbox is still running
+	// in Daytona before each periodic voucher, from a sandbox list cached for
+	// this many seconds (see billing.EventHandler.SetSandboxCheck). 0 = off.
+	SandboxCheckSec int64 `mapstructure:"sandbox_check_sec"`
+	// VoucherIntervalMinSec and VoucherIntervalMaxSec bound the per-sandbox
+	// voucher interval a sandbox may ask for with the voucher-interval-sec
+	// label. Min 0 (default) ignores the label; max 0 = VoucherIntervalSec.
+	VoucherIntervalMinSec int64 `mapstructure:"voucher_interval_min_sec"`
+	VoucherIntervalMaxSec int64 `mapstructure:"voucher_interval_max_sec"`
+	// UsageHashVersion selects the usageHash schema of new vouchers: 1
+	// (default) or 2, which also commits to the voucher's totalFee.
+	UsageHashVersion int `mapstructure:"usage_hash_version"`
+	// MaxPauseSec is how long billing may stay paused before the generator
+	// resumes it, so a paused sandbox cannot run for free indefinitely.
+	// 0 = no limit.
+	MaxPauseSec int64 `mapstructure:"max_pause_sec"`
+	// MaxPausedTotalSec caps the paused time a session may leave unbilled
+	// across all its pauses, so pausing again after each automatic resume
+	// cannot add up to free compute. 0 = no limit.
+	MaxPausedTotalSec int64 `mapstructure:"max_paused_total_sec"`
+	// LowBalanceWarnPeriods makes the generator warn a wallet whose balance,
+	// after its unsettled vouchers, no longer covers this many periods of its
+	// running sandboxes (see billing.EventHandler.SetLowBalanceWarning).
+	// 0 = no warning.
+	LowBalanceWarnPeriods int `mapstructure:"low_balance_warn_periods"`
+	// ClockMaxSkewSec is how far the wall clock may drift from the monotonic
+	// clock between generator sweeps before the generator treats it as a
+	// clock jump and skips the jumped span instead of billing it (see
+	// billing.EventHandler.SetMaxClockSkew). 0 = no detection.
+	ClockMaxSkewSec int64 `mapstructure:"clock_max_skew_sec"`
 }
 
 type ChainConfig struct {
@@ -58,6 +227,56 @@ type ChainConfig struct {
 	// holding the provider's settlement key.
 	AdminAddresses string `mapstructure:"admin_addresses"`
 	ChainID        int64  `mapstructure:"chain_id"`
+	// TEEPreviousPrivateKey is the outgoing TEE key during a key rotation
+	// (see billing.Rotation). Requires TEERotationCutoff.
+	TEEPreviousPrivateKey string `mapstructure:"tee_previous_private_key"`
+	// TEERotationCutoff (RFC 3339) ends the rotation window: the previous key
+	// is no longer used and unacknowledged users are no longer deferred.
+	TEERotationCutoff string `mapstructure:"tee_rotation_cutoff"`
+	// GasPayerKey is the hex private key that sends settlement (and relay
+	// deposit) transactions and pays their gas. Vouchers are still signed by
+	// the TEE key. Empty = the TEE key sends transactions too.
+	GasPayerKey string `mapstructure:"gas_payer_key"`
+	// TxType is the envelope of sent transactions: "legacy" (EIP-155, priced
+	// with eth_gasPrice) or "dynamic" (EIP-1559). See chain.TxTypeLegacy.
+	TxType string `mapstructure:"tx_type"`
+	// TxTipCap and TxFeeCap fix the per-gas priority fee and fee cap of
+	// dynamic-fee transactions (neuron or "<decimal> 0G"). Empty = the node's
+	// suggested tip / tip plus twice the base fee.
+	TxTipCap string `mapstructure:"tx_tip_cap"`
+	TxFeeCap string `mapstructure:"tx_fee_cap"`
+	// ErrorRules adds chain-specific error messages to the settler's retry
+	// classification: comma-separated "<message substring>=<class>", class
+	// transient, permanent or nonce, tried before the built-in rules (see
+	// chain.DefaultErrorRules).
+	ErrorRules string `mapstructure:"error_rules"`
+	// EIP712DomainName and EIP712DomainVersion are the EIP-712 domain the
+	// settlement contract was initialized with; vouchers are signed for it.
+	// Change them only for a contract deployed with a different domain.
+	EIP712DomainName    string `mapstructure:"eip712_domain_name"`
+	EIP712DomainVersion string `mapstructure:"eip712_domain_version"`
+	// StartBlock is the first block the broker's provider indexer scans when
+	// it has no cursor yet, normally the contract's deployment block:
+	// scanning from genesis is infeasible. 0 = block 1.
+	StartBlock uint64 `mapstructure:"start_block"`
+}
+
+// RotationCutoff parses TEERotationCutoff.
+func (c *ChainConfig) RotationCutoff() (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, c.TEERotationCutoff)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid TEE_ROTATION_CUTOFF %q (want RFC 3339): %w", c.TEERotationCutoff, err)
+	}
+	return t, nil
+}
+
+// PreviousTEEKey parses TEEPreviousPrivateKey (hex, optional 0x prefix).
+func (c *ChainConfig) PreviousTEEKey() (*ecdsa.PrivateKey, error) {
+	k, err := crypto.HexToECDSA(strings.TrimPrefix(c.TEEPreviousPrivateKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TEE_PREVIOUS_PRIVATE_KEY: %w", err)
+	}
+	return k, nil
 }
 
 // AdminList returns the parsed admin wallet addresses (lowercased hex).
@@ -100,6 +319,39 @@ type ServerConfig struct {
 	Port           int    `mapstructure:"port"`
 	SSHGatewayHost string `mapstructure:"ssh_gateway_host"`
 	BrokerURL      string `mapstructure:"broker_url"`
+	// ForwardAllow / ForwardDeny are comma-separated "METHOD /path" rules for
+	// the proxy's transparent forwarding (see proxy.ForwardPolicy). Empty
+	// ForwardAllow keeps the built-in allowlist; ForwardDeny adds to the
+	// built-in autostop/autoarchive denials.
+	ForwardAllow string `mapstructure:"forward_allow"`
+	ForwardDeny  string `mapstructure:"forward_deny"`
+	// MaxBodyBytes caps JSON request bodies the proxy buffers and rewrites
+	// (create, snapshot create, labels); larger bodies get 413.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+	// DeleteWaitTimeoutSec bounds how long DELETE /api/sandbox/:id?wait=true
+	// waits for the sandbox's last vouchers to settle.
+	DeleteWaitTimeoutSec int64 `mapstructure:"delete_wait_timeout_sec"`
+	// AmountDecimals is how many fractional digits the 0G amounts shown next
+	// to neuron amounts in responses (the *_0g fields) are rounded to, 0-18.
+	// The neuron amounts stay exact.
+	AmountDecimals int `mapstructure:"amount_decimals"`
+	// LogLevel is the initial zap level: debug, info, warn or error. It can
+	// be changed at runtime via PUT /api/admin/loglevel.
+	LogLevel string `mapstructure:"log_level"`
+	// LogFormat selects the encoder: "json" (default) or "console" for
+	// human-readable development output.
+	LogFormat string `mapstructure:"log_format"`
+	// LogSampling is "initial,thereafter": per second, log the first
+	// <initial> entries with the same level and message, then every
+	// <thereafter>-th. "off" disables sampling.
+	LogSampling string `mapstructure:"log_sampling"`
+	// EnablePprof mounts the net/http/pprof handlers at /debug/pprof,
+	// reachable by admin wallets only. Off by default.
+	EnablePprof bool `mapstructure:"enable_pprof"`
+	// EnableGzip compresses the proxy's JSON read responses (sandbox list and
+	// get, account, sessions, revenue, audit log) for clients that accept
+	// gzip. Forwarded and streaming responses are never compressed.
+	EnableGzip bool `mapstructure:"enable_gzip"`
 }
 
 func Load() (*Config, error) {
@@ -107,13 +359,53 @@ func Load() (*Config, error) {
 
 	// Defaults
 	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.max_body_bytes", 1<<20)
+	v.SetDefault("server.delete_wait_timeout_sec", 60)
+	v.SetDefault("server.amount_decimals", 18)
+	v.SetDefault("server.log_level", "info")
+	v.SetDefault("server.log_format", "json")
+	v.SetDefault("server.log_sampling", "100,100")
 	v.SetDefault("billing.voucher_interval_sec", 3600)
 	v.SetDefault("billing.compute_price_per_sec", "16667")
 	v.SetDefault("billing.price_per_cpu_per_sec", "0")
 	v.SetDefault("billing.price_per_mem_gb_per_sec", "0")
 	v.SetDefault("billing.create_fee", "5000000")
+	v.SetDefault("billing.create_fee_enabled", true)
+	v.SetDefault("billing.compute_fee_enabled", true)
+	v.SetDefault("billing.upgrade_mode", "resign")
+	v.SetDefault("chain.tx_type", "legacy")
+	v.SetDefault("chain.eip712_domain_name", voucher.DefaultDomainName)
+	v.SetDefault("chain.eip712_domain_version", voucher.DefaultDomainVersion)
+	v.SetDefault("billing.period_alignment", "relative")
+	v.SetDefault("billing.preflight_failure_mode", "fail_closed")
+	v.SetDefault("billing.relay_deposit_max", "0.01 0G")
+	v.SetDefault("billing.relay_deposits_per_day", 1)
+	v.SetDefault("billing.relay_deposit_daily_budget", "1 0G")
+	v.SetDefault("billing.usage_hash_version", 1)
+	v.SetDefault("billing.max_per_user_per_batch", 10)
+	v.SetDefault("billing.settle_lock_lease_sec", 30)
+	v.SetDefault("billing.settle_max_batch_size", 50)
+	v.SetDefault("billing.settle_flush_interval_sec", 0)
+	v.SetDefault("billing.settle_report_interval_sec", 300)
+	v.SetDefault("billing.session_ttl_sec", 21600)
+	v.SetDefault("billing.session_reap_interval_sec", 600)
+	v.SetDefault("billing.max_pause_sec", 86400)
+	v.SetDefault("billing.max_paused_total_sec", 259200)
+	v.SetDefault("billing.stop_workers", 4)
+	v.SetDefault("billing.create_quota_window_sec", 86400)
+	v.SetDefault("billing.low_balance_warn_periods", 1)
+	v.SetDefault("billing.clock_max_skew_sec", 0)
+	v.SetDefault("auth.max_validity_sec", 300)
+	v.SetDefault("auth.clock_skew_sec", 5)
+	v.SetDefault("archive.backend", "fs")
+	v.SetDefault("archive.batch_size", 500)
+	v.SetDefault("archive.flush_interval_sec", 60)
 	v.SetDefault("redis.addr", "redis:6379")
 	v.SetDefault("daytona.registry_url", "http://registry:6000")
+	v.SetDefault("daytona.api_prefix", "/api")
+	v.SetDefault("daytona.max_idle_conns_per_host", 32)
+	v.SetDefault("daytona.idle_conn_timeout_sec", 90)
+	v.SetDefault("daytona.http2", true)
 
 	// Config file (optional)
 	v.SetConfigName("config")
@@ -130,21 +422,84 @@ func Load() (*Config, error) {
 		"daytona.api_url":              "DAYTONA_API_URL",
 		"daytona.admin_key":            "DAYTONA_ADMIN_KEY",
 		"daytona.registry_url":         "REGISTRY_URL",
+		"daytona.api_prefix":           "DAYTONA_API_PREFIX",
+		"daytona.create_id_paths":      "DAYTONA_CREATE_ID_PATHS",
+		"daytona.public_base_url":      "DAYTONA_PUBLIC_BASE_URL",
+		"daytona.max_idle_conns_per_host": "DAYTONA_MAX_IDLE_CONNS_PER_HOST",
+		"daytona.idle_conn_timeout_sec":   "DAYTONA_IDLE_CONN_TIMEOUT_SEC",
+		"daytona.http2":                   "DAYTONA_HTTP2",
 		"redis.addr":                   "REDIS_ADDR",
 		"redis.password":               "REDIS_PASSWORD",
+		"redis.encryption_key":         "REDIS_ENCRYPTION_KEY",
 		"billing.voucher_interval_sec": "VOUCHER_INTERVAL_SEC",
 		"billing.compute_price_per_sec":   "COMPUTE_PRICE_PER_SEC",
 		"billing.price_per_cpu_per_sec":   "PRICE_PER_CPU_PER_SEC",
 		"billing.price_per_mem_gb_per_sec": "PRICE_PER_MEM_GB_PER_SEC",
 		"billing.create_fee":               "CREATE_FEE",
+		"billing.create_fee_enabled":       "CREATE_FEE_ENABLED",
+		"billing.compute_fee_enabled":      "COMPUTE_FEE_ENABLED",
+		"billing.upgrade_mode":             "UPGRADE_MODE",
+		"billing.max_sandboxes_per_owner":  "MAX_SANDBOXES_PER_OWNER",
+		"billing.create_quota":             "CREATE_QUOTA",
+		"billing.create_quota_window_sec":  "CREATE_QUOTA_WINDOW_SEC",
+		"billing.receipt_labels":           "RECEIPT_LABELS",
+		"billing.trusted_wallets":          "BILLING_TRUSTED_WALLETS",
+		"billing.period_alignment":         "PERIOD_ALIGNMENT",
+		"billing.preflight_failure_mode":   "PREFLIGHT_FAILURE_MODE",
+		"billing.relay_deposit_enabled":    "RELAY_DEPOSIT_ENABLED",
+		"billing.relay_deposit_max":        "RELAY_DEPOSIT_MAX",
+		"billing.relay_deposits_per_day":   "RELAY_DEPOSITS_PER_DAY",
+		"billing.relay_deposit_daily_budget": "RELAY_DEPOSIT_DAILY_BUDGET",
+		"billing.max_per_user_per_batch":   "MAX_PER_USER_PER_BATCH",
+		"billing.settle_lock_lease_sec":    "SETTLE_LOCK_LEASE_SEC",
+		"billing.settle_max_batch_size":    "SETTLE_MAX_BATCH_SIZE",
+		"billing.settle_flush_interval_sec": "SETTLE_FLUSH_INTERVAL_SEC",
+		"billing.settle_report_interval_sec": "SETTLE_REPORT_INTERVAL_SEC",
+		"billing.session_ttl_sec":          "SESSION_TTL_SEC",
+		"billing.session_reap_interval_sec": "SESSION_REAP_INTERVAL_SEC",
+		"billing.stop_workers":              "STOP_WORKERS",
+		"billing.sandbox_check_sec":         "GENERATOR_SANDBOX_CHECK_SEC",
+		"billing.voucher_interval_min_sec":  "VOUCHER_INTERVAL_MIN_SEC",
+		"billing.voucher_interval_max_sec":  "VOUCHER_INTERVAL_MAX_SEC",
+		"billing.usage_hash_version":       "USAGE_HASH_VERSION",
+		"billing.max_pause_sec":             "BILLING_MAX_PAUSE_SEC",
+		"billing.max_paused_total_sec":      "BILLING_MAX_PAUSED_TOTAL_SEC",
+		"billing.low_balance_warn_periods": "LOW_BALANCE_WARN_PERIODS",
+		"billing.clock_max_skew_sec":       "CLOCK_MAX_SKEW_SEC",
 		"chain.rpc_url":                "RPC_URL",
 		"chain.contract_address":       "SETTLEMENT_CONTRACT",
 		"chain.provider_address":       "PROVIDER_ADDRESS",
 		"chain.admin_addresses":        "ADMIN_ADDRESSES",
 		"chain.chain_id":               "CHAIN_ID",
+		"chain.tee_previous_private_key": "TEE_PREVIOUS_PRIVATE_KEY",
+		"chain.tee_rotation_cutoff":      "TEE_ROTATION_CUTOFF",
+		"chain.gas_payer_key":            "GAS_PAYER_KEY",
+		"chain.tx_type":                  "TX_TYPE",
+		"chain.tx_tip_cap":               "TX_TIP_CAP",
+		"chain.tx_fee_cap":               "TX_FEE_CAP",
+		"chain.error_rules":              "CHAIN_ERROR_RULES",
+		"chain.eip712_domain_name":       "EIP712_DOMAIN_NAME",
+		"chain.eip712_domain_version":    "EIP712_DOMAIN_VERSION",
+		"auth.max_validity_sec":        "AUTH_MAX_VALIDITY_SEC",
+		"auth.clock_skew_sec":          "AUTH_CLOCK_SKEW_SEC",
 		"server.port":                  "PORT",
 		"server.ssh_gateway_host":       "SSH_GATEWAY_HOST",
 		"server.broker_url":             "BROKER_URL",
+		"server.forward_allow":          "PROXY_FORWARD_ALLOW",
+		"server.forward_deny":           "PROXY_FORWARD_DENY",
+		"server.max_body_bytes":         "MAX_BODY_BYTES",
+		"server.delete_wait_timeout_sec": "DELETE_WAIT_TIMEOUT_SEC",
+		"server.amount_decimals":        "AMOUNT_DISPLAY_DECIMALS",
+		"server.log_level":              "LOG_LEVEL",
+		"server.log_format":             "LOG_FORMAT",
+		"server.log_sampling":           "LOG_SAMPLING",
+		"server.enable_pprof":           "ENABLE_PPROF",
+		"server.enable_gzip":            "ENABLE_GZIP",
+		"archive.backend":               "ARCHIVE_BACKEND",
+		"archive.dir":                   "ARCHIVE_DIR",
+		"archive.batch_size":            "ARCHIVE_BATCH_SIZE",
+		"archive.flush_interval_sec":    "ARCHIVE_FLUSH_INTERVAL_SEC",
+		"dry_run":                       "DRY_RUN",
 	}
 	for key, env := range bindings {
 		if err := v.BindEnv(key, env); err != nil {
@@ -166,6 +521,9 @@ func LoadBroker() (*Config, error) {
 	v := viper.New()
 
 	v.SetDefault("server.port", 8081)
+	v.SetDefault("server.log_level", "info")
+	v.SetDefault("server.log_format", "json")
+	v.SetDefault("server.log_sampling", "100,100")
 	v.SetDefault("redis.addr", "redis:6379")
 
 	v.SetConfigName("config")
@@ -190,7 +548,11 @@ func LoadBroker() (*Config, error) {
 		"chain.contract_address":        "SETTLEMENT_CONTRACT",
 		"chain.provider_address":        "PROVIDER_ADDRESS",
 		"chain.chain_id":                "CHAIN_ID",
+		"chain.start_block":             "CHAIN_START_BLOCK",
 		"server.port":                   "BROKER_PORT",
+		"server.log_level":              "LOG_LEVEL",
+		"server.log_format":             "LOG_FORMAT",
+		"server.log_sampling":           "LOG_SAMPLING",
 		"broker.monitor_interval_sec":   "BROKER_MONITOR_INTERVAL_SEC",
 		"broker.topup_intervals":        "BROKER_TOPUP_INTERVALS",
 		"broker.threshold_intervals":    "BROKER_THRESHOLD_INTERVALS",
@@ -229,13 +591,20 @@ func (c *Config) validate() error {
 	// TEEPrivateKey is populated at startup by tee.Get() (gRPC call to the
 	// tapp-daemon in a real TDX environment, or MOCK_APP_PRIVATE_KEY in mock
 	// mode), so it isn't checked here.
-	for _, r := range []req{
+	required := []req{
 		{c.Daytona.APIURL, "DAYTONA_API_URL"},
 		{c.Daytona.AdminKey, "DAYTONA_ADMIN_KEY"},
 		{c.Chain.RPCURL, "RPC_URL"},
 		{c.Chain.ContractAddress, "SETTLEMENT_CONTRACT"},
 		{c.Chain.ProviderAddress, "PROVIDER_ADDRESS"},
-	} {
+	}
+	if c.DryRun {
+		if err := c.validateDryRun(); err != nil {
+			return err
+		}
+		required = append(required[:2], required[4:]...) // no chain endpoints
+	}
+	for _, r := range required {
 		if r.val == "" {
 			return fmt.Errorf("required config missing: %s", r.name)
 		}
@@ -243,5 +612,147 @@ func (c *Config) validate() error {
 	if c.Chain.ChainID == 0 {
 		return fmt.Errorf("required config missing: CHAIN_ID")
 	}
+	if c.Daytona.MaxIdleConnsPerHost <= 0 || c.Daytona.IdleConnTimeoutSec <= 0 {
+		return fmt.Errorf("invalid DAYTONA_MAX_IDLE_CONNS_PER_HOST %d / DAYTONA_IDLE_CONN_TIMEOUT_SEC %d (both must be positive)", c.Daytona.MaxIdleConnsPerHost, c.Daytona.IdleConnTimeoutSec)
+	}
+	if u := c.Daytona.PublicBaseURL; u != "" {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("invalid DAYTONA_PUBLIC_BASE_URL %q (want an absolute URL, e.g. https://sandbox.example.com)", u)
+		}
+	}
+	switch c.Billing.UpgradeMode {
+	case "resign", "pause", "off":
+	default:
+		return fmt.Errorf("invalid UPGRADE_MODE %q (want resign, pause or off)", c.Billing.UpgradeMode)
+	}
+	switch c.Chain.TxType {
+	case "legacy", "dynamic":
+	default:
+		return fmt.Errorf("invalid TX_TYPE %q (want legacy or dynamic)", c.Chain.TxType)
+	}
+	if c.Chain.EIP712DomainName == "" || c.Chain.EIP712DomainVersion == "" {
+		return fmt.Errorf("EIP712_DOMAIN_NAME and EIP712_DOMAIN_VERSION must not be empty")
+	}
+	switch c.Billing.PeriodAlignment {
+	case "relative", "wallclock":
+	default:
+		return fmt.Errorf("invalid PERIOD_ALIGNMENT %q (want relative or wallclock)", c.Billing.PeriodAlignment)
+	}
+	switch c.Billing.PreflightFailureMode {
+	case "fail_closed", "fail_open":
+	default:
+		return fmt.Errorf("invalid PREFLIGHT_FAILURE_MODE %q (want fail_closed or fail_open)", c.Billing.PreflightFailureMode)
+	}
+	if _, err := voucher.NewCodec(c.Redis.EncryptionKey); err != nil {
+		return fmt.Errorf("invalid REDIS_ENCRYPTION_KEY: %w", err)
+	}
+	if c.Billing.MaxPerUserPerBatch < 0 {
+		return fmt.Errorf("invalid MAX_PER_USER_PER_BATCH %d (must be >= 0)", c.Billing.MaxPerUserPerBatch)
+	}
+	if c.Billing.SettleLockLeaseSec <= 0 {
+		return fmt.Errorf("invalid SETTLE_LOCK_LEASE_SEC %d (must be positive)", c.Billing.SettleLockLeaseSec)
+	}
+	if c.Billing.SettleMaxBatchSize <= 0 {
+		return fmt.Errorf("invalid SETTLE_MAX_BATCH_SIZE %d (must be positive)", c.Billing.SettleMaxBatchSize)
+	}
+	if c.Billing.SettleFlushIntervalSec < 0 {
+		return fmt.Errorf("invalid SETTLE_FLUSH_INTERVAL_SEC %d (must be >= 0)", c.Billing.SettleFlushIntervalSec)
+	}
+	if c.Billing.SettleReportIntervalSec < 0 {
+		return fmt.Errorf("invalid SETTLE_REPORT_INTERVAL_SEC %d (must be >= 0)", c.Billing.SettleReportIntervalSec)
+	}
+	if c.Billing.VoucherIntervalMinSec < 0 || c.Billing.VoucherIntervalMaxSec < 0 ||
+		(c.Billing.VoucherIntervalMaxSec > 0 && c.Billing.VoucherIntervalMaxSec < c.Billing.VoucherIntervalMinSec) {
+		return fmt.Errorf("invalid VOUCHER_INTERVAL_MIN_SEC %d / VOUCHER_INTERVAL_MAX_SEC %d (must be >= 0, max 0 or >= min)", c.Billing.VoucherIntervalMinSec, c.Billing.VoucherIntervalMaxSec)
+	}
+	// A session must outlive its longest voucher interval.
+	longestInterval := max(c.Billing.VoucherIntervalSec, c.Billing.VoucherIntervalMaxSec)
+	if c.Billing.VoucherIntervalMinSec > 0 {
+		longestInterval = max(longestInterval, c.Billing.VoucherIntervalMinSec)
+	}
+	if c.Billing.SessionTTLSec < 0 || (c.Billing.SessionTTLSec > 0 && c.Billing.SessionTTLSec <= longestInterval) {
+		return fmt.Errorf("invalid SESSION_TTL_SEC %d (0 to disable, or more than the longest voucher interval, %d)", c.Billing.SessionTTLSec, longestInterval)
+	}
+	if c.Billing.SessionReapIntervalSec < 0 {
+		return fmt.Errorf("invalid SESSION_REAP_INTERVAL_SEC %d (must be >= 0)", c.Billing.SessionReapIntervalSec)
+	}
+	if c.Billing.StopWorkers < 1 {
+		return fmt.Errorf("invalid STOP_WORKERS %d (must be >= 1)", c.Billing.StopWorkers)
+	}
+	if c.Billing.SandboxCheckSec < 0 {
+		return fmt.Errorf("invalid GENERATOR_SANDBOX_CHECK_SEC %d (must be >= 0)", c.Billing.SandboxCheckSec)
+	}
+	if c.Billing.CreateQuota < 0 || c.Billing.CreateQuotaWindowSec <= 0 {
+		return fmt.Errorf("invalid CREATE_QUOTA %d / CREATE_QUOTA_WINDOW_SEC %d (quota must be >= 0, window positive)", c.Billing.CreateQuota, c.Billing.CreateQuotaWindowSec)
+	}
+	for _, w := range strings.Split(c.Billing.TrustedWallets, ",") {
+		if w = strings.TrimSpace(w); w != "" && !common.IsHexAddress(w) {
+			return fmt.Errorf("invalid BILLING_TRUSTED_WALLETS entry %q (want a 0x wallet address)", w)
+		}
+	}
+	if c.Billing.UsageHashVersion != 1 && c.Billing.UsageHashVersion != 2 {
+		return fmt.Errorf("invalid USAGE_HASH_VERSION %d (want 1 or 2)", c.Billing.UsageHashVersion)
+	}
+	if c.Billing.MaxPauseSec < 0 {
+		return fmt.Errorf("invalid BILLING_MAX_PAUSE_SEC %d (must be >= 0)", c.Billing.MaxPauseSec)
+	}
+	if c.Billing.MaxPausedTotalSec < 0 {
+		return fmt.Errorf("invalid BILLING_MAX_PAUSED_TOTAL_SEC %d (must be >= 0)", c.Billing.MaxPausedTotalSec)
+	}
+	if c.Billing.LowBalanceWarnPeriods < 0 {
+		return fmt.Errorf("invalid LOW_BALANCE_WARN_PERIODS %d (must be >= 0)", c.Billing.LowBalanceWarnPeriods)
+	}
+	if c.Billing.ClockMaxSkewSec < 0 {
+		return fmt.Errorf("invalid CLOCK_MAX_SKEW_SEC %d (must be >= 0)", c.Billing.ClockMaxSkewSec)
+	}
+	if c.Auth.MaxValiditySec <= 0 {
+		return fmt.Errorf("invalid AUTH_MAX_VALIDITY_SEC %d (must be positive)", c.Auth.MaxValiditySec)
+	}
+	if c.Auth.ClockSkewSec < 0 || c.Auth.ClockSkewSec >= c.Auth.MaxValiditySec {
+		return fmt.Errorf("invalid AUTH_CLOCK_SKEW_SEC %d (must be >= 0 and below AUTH_MAX_VALIDITY_SEC)", c.Auth.ClockSkewSec)
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		return fmt.Errorf("invalid MAX_BODY_BYTES %d (must be positive)", c.Server.MaxBodyBytes)
+	}
+	if c.Server.DeleteWaitTimeoutSec <= 0 {
+		return fmt.Errorf("invalid DELETE_WAIT_TIMEOUT_SEC %d (must be positive)", c.Server.DeleteWaitTimeoutSec)
+	}
+	if c.Server.AmountDecimals < 0 || c.Server.AmountDecimals > 18 {
+		return fmt.Errorf("invalid AMOUNT_DISPLAY_DECIMALS %d (must be 0-18)", c.Server.AmountDecimals)
+	}
+	if c.Chain.TEEPreviousPrivateKey != "" {
+		if _, err := c.Chain.PreviousTEEKey(); err != nil {
+			return err
+		}
+		if _, err := c.Chain.RotationCutoff(); err != nil {
+			return err
+		}
+	}
+	if c.Archive.Backend != "" && c.Archive.Backend != "fs" && c.Archive.Backend != "redis" {
+		return fmt.Errorf("invalid ARCHIVE_BACKEND %q (must be fs or redis)", c.Archive.Backend)
+	}
+	if c.Archive.Enabled() && (c.Archive.BatchSize <= 0 || c.Archive.FlushIntervalSec <= 0) {
+		return fmt.Errorf("ARCHIVE_BATCH_SIZE and ARCHIVE_FLUSH_INTERVAL_SEC must be positive")
+	}
+	return nil
+}
+
+// validateDryRun refuses DRY_RUN alongside any setting that points at a real
+// chain or needs one.
+func (c *Config) validateDryRun() error {
+	for _, r := range []struct {
+		set  bool
+		name string
+	}{
+		{c.Chain.RPCURL != "", "RPC_URL"},
+		{c.Chain.ContractAddress != "", "SETTLEMENT_CONTRACT"},
+		{c.Chain.GasPayerKey != "", "GAS_PAYER_KEY"},
+		{c.Chain.TEEPreviousPrivateKey != "", "TEE_PREVIOUS_PRIVATE_KEY"},
+		{c.Billing.RelayDepositEnabled, "RELAY_DEPOSIT_ENABLED"},
+	} {
+		if r.set {
+			return fmt.Errorf("DRY_RUN refuses to start with %s set: dry-run mode must not be pointed at a real chain", r.name)
+		}
+	}
 	return nil
 }
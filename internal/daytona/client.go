@@ -3,10 +3,14 @@ package daytona
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,19 +36,88 @@ type Snapshot struct {
 	Disk      int    `json:"disk"`
 }
 
+// ErrNotFound is returned (wrapped) by GetSandbox when Daytona has no such
+// sandbox.
+var ErrNotFound = errors.New("sandbox not found")
+
+// DefaultAPIPrefix is the path prefix of the Daytona REST API.
+const DefaultAPIPrefix = "/api"
+
 // Client is an authenticated Daytona REST client.
 type Client struct {
-	baseURL  string
-	adminKey string
-	http     *http.Client
+	baseURL   string
+	adminKey  atomic.Pointer[string] // see SetAdminKey
+	apiPrefix string                 // e.g. "/api"; every request path is built from it
+	transport *http.Transport        // shared by http and the proxy's reverse proxy
+	http      *http.Client
+}
+
+// TransportOptions tunes the connection pool to Daytona.
+type TransportOptions struct {
+	// MaxIdleConnsPerHost is how many idle keep-alive connections are kept
+	// open to Daytona; <= 0 selects DefaultTransportOptions'.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes idle connections after this long; <= 0 selects
+	// DefaultTransportOptions'.
+	IdleConnTimeout time.Duration
+	// HTTP2 negotiates HTTP/2 with an https Daytona endpoint (via ALPN). Plain
+	// http endpoints always use HTTP/1.1 keep-alive.
+	HTTP2 bool
+}
+
+// DefaultTransportOptions returns the pool settings used by NewClient.
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{MaxIdleConnsPerHost: 32, IdleConnTimeout: 90 * time.Second, HTTP2: true}
 }
 
+// NewClient returns a client for the Daytona API at DefaultAPIPrefix.
 func NewClient(baseURL, adminKey string) *Client {
-	return &Client{
-		baseURL:  baseURL,
-		adminKey: adminKey,
-		http:     &http.Client{Timeout: 30 * time.Second},
+	return NewClientWithPrefix(baseURL, adminKey, DefaultAPIPrefix)
+}
+
+// NewClientWithPrefix returns a client whose request paths are rooted at
+// apiPrefix (e.g. "/api/v2"). An empty prefix selects DefaultAPIPrefix.
+func NewClientWithPrefix(baseURL, adminKey, apiPrefix string) *Client {
+	return NewClientWithOptions(baseURL, adminKey, apiPrefix, DefaultTransportOptions())
+}
+
+// NewClientWithOptions is NewClientWithPrefix with a tuned transport. All
+// requests from the client, including those forwarded through Transport,
+// share its connection pool; each still ends when its context is cancelled.
+func NewClientWithOptions(baseURL, adminKey, apiPrefix string, opts TransportOptions) *Client {
+	def := DefaultTransportOptions()
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = def.MaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = def.IdleConnTimeout
 	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	t.IdleConnTimeout = opts.IdleConnTimeout
+	t.ForceAttemptHTTP2 = opts.HTTP2
+	if !opts.HTTP2 {
+		// A non-nil empty map disables the transport's automatic HTTP/2.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	c := &Client{
+		baseURL:   baseURL,
+		apiPrefix: NormalizePrefix(apiPrefix),
+		transport: t,
+		http:      &http.Client{Timeout: 30 * time.Second, Transport: t},
+	}
+	c.SetAdminKey(adminKey)
+	return c
+}
+
+// NormalizePrefix returns p with exactly one leading slash and no trailing
+// slash; an empty p yields DefaultAPIPrefix.
+func NormalizePrefix(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return DefaultAPIPrefix
+	}
+	return "/" + p
 }
 
 func (c *Client) do(ctx context.Context, method, path string, body any) (*http.Response, error) {
@@ -61,7 +134,7 @@ func (c *Client) do(ctx context.Context, method, path string, body any) (*http.R
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.adminKey)
+	req.Header.Set("Authorization", "Bearer "+c.AdminKey())
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -69,11 +142,14 @@ func (c *Client) do(ctx context.Context, method, path string, body any) (*http.R
 }
 
 func (c *Client) GetSandbox(ctx context.Context, id string) (*Sandbox, error) {
-	resp, err := c.do(ctx, http.MethodGet, "/api/sandbox/"+id, nil)
+	resp, err := c.do(ctx, http.MethodGet, c.apiPrefix+"/sandbox/"+id, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("daytona GetSandbox %s: %w", id, ErrNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("daytona GetSandbox %s: status %d", id, resp.StatusCode)
 	}
@@ -82,7 +158,18 @@ func (c *Client) GetSandbox(ctx context.Context, id string) (*Sandbox, error) {
 }
 
 func (c *Client) ListSandboxes(ctx context.Context) ([]Sandbox, error) {
-	resp, err := c.do(ctx, http.MethodGet, "/api/sandbox", nil)
+	return c.ListSandboxesQuery(ctx, "")
+}
+
+// ListSandboxesQuery is ListSandboxes with rawQuery, an encoded query string
+// without the leading "?", passed to Daytona as is (e.g. a caller's label
+// filter).
+func (c *Client) ListSandboxesQuery(ctx context.Context, rawQuery string) ([]Sandbox, error) {
+	path := c.apiPrefix + "/sandbox"
+	if rawQuery != "" {
+		path += "?" + rawQuery
+	}
+	resp, err := c.do(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +182,7 @@ func (c *Client) ListSandboxes(ctx context.Context) ([]Sandbox, error) {
 }
 
 func (c *Client) StopSandbox(ctx context.Context, id string) error {
-	resp, err := c.do(ctx, http.MethodPost, "/api/sandbox/"+id+"/stop", nil)
+	resp, err := c.do(ctx, http.MethodPost, c.apiPrefix+"/sandbox/"+id+"/stop", nil)
 	if err != nil {
 		return err
 	}
@@ -110,7 +197,7 @@ func (c *Client) StopSandbox(ctx context.Context, id string) error {
 // Archived sandboxes can be restarted later via Daytona's start endpoint,
 // unlike stopped sandboxes where the container is removed without a backup.
 func (c *Client) ArchiveSandbox(ctx context.Context, id string) error {
-	resp, err := c.do(ctx, http.MethodPost, "/api/sandbox/"+id+"/archive", nil)
+	resp, err := c.do(ctx, http.MethodPost, c.apiPrefix+"/sandbox/"+id+"/archive", nil)
 	if err != nil {
 		return err
 	}
@@ -130,7 +217,7 @@ type SSHAccess struct {
 
 // CreateSSHAccess creates a temporary SSH access token for a sandbox.
 func (c *Client) CreateSSHAccess(ctx context.Context, id string) (*SSHAccess, error) {
-	resp, err := c.do(ctx, http.MethodPost, "/api/sandbox/"+id+"/ssh-access", nil)
+	resp, err := c.do(ctx, http.MethodPost, c.apiPrefix+"/sandbox/"+id+"/ssh-access", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -165,7 +252,7 @@ func (c *Client) WaitStopped(ctx context.Context, id string) error {
 
 // GetSnapshot returns a single snapshot by ID (UUID). Returns nil, nil when not found.
 func (c *Client) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
-	resp, err := c.do(ctx, http.MethodGet, "/api/snapshots/"+id, nil)
+	resp, err := c.do(ctx, http.MethodGet, c.apiPrefix+"/snapshots/"+id, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -182,7 +269,7 @@ func (c *Client) GetSnapshot(ctx context.Context, id string) (*Snapshot, error)
 
 // ListSnapshots returns all Daytona snapshots.
 func (c *Client) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
-	resp, err := c.do(ctx, http.MethodGet, "/api/snapshots", nil)
+	resp, err := c.do(ctx, http.MethodGet, c.apiPrefix+"/snapshots", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -203,5 +290,65 @@ func (c *Client) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
 // BaseURL returns the configured base URL (used by reverse proxy).
 func (c *Client) BaseURL() string { return c.baseURL }
 
-// AdminKey returns the admin key (used by reverse proxy to inject auth).
-func (c *Client) AdminKey() string { return c.adminKey }
+// Transport returns the client's shared transport, so the reverse proxy
+// reuses the same pooled connections to Daytona.
+func (c *Client) Transport() http.RoundTripper { return c.transport }
+
+// AdminKey returns the current admin key (used by reverse proxy to inject
+// auth).
+func (c *Client) AdminKey() string { return *c.adminKey.Load() }
+
+// SetAdminKey replaces the admin key. Requests started after it returns,
+// including forwarded ones, carry the new key; requests in flight finish
+// with the old one.
+func (c *Client) SetAdminKey(key string) { c.adminKey.Store(&key) }
+
+// CheckAdminKey reports whether Daytona accepts key, by listing sandboxes
+// with it, so a key can be checked before SetAdminKey switches to it.
+func (c *Client) CheckAdminKey(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+c.apiPrefix+"/sandbox", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("daytona rejected the key: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// APIPrefix returns the normalized API path prefix, e.g. "/api".
+func (c *Client) APIPrefix() string { return c.apiPrefix }
+
+// Version probes Daytona for its version, trying <prefix>/version and then
+// <prefix>/health. Returns the "version" field of the first 200 response, or
+// "" if the endpoint answered without one. Errors only if neither endpoint
+// responds with 200.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var lastErr error
+	for _, path := range []string{c.apiPrefix + "/version", c.apiPrefix + "/health"} {
+		resp, err := c.do(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("GET %s: status %d", path, resp.StatusCode)
+			continue
+		}
+		var v struct {
+			Version string `json:"version"`
+		}
+		json.Unmarshal(body, &v) //nolint:errcheck
+		return v.Version, nil
+	}
+	return "", lastErr
+}
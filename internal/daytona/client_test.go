@@ -3,10 +3,13 @@ package daytona
 import (
 	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // ── Unit tests (httptest, no external deps) ───────────────────────────────────
@@ -202,6 +205,161 @@ func TestAdminKey(t *testing.T) {
 	}
 }
 
+// ── API prefix ────────────────────────────────────────────────────────────────
+
+func TestNormalizePrefix(t *testing.T) {
+	cases := map[string]string{
+		"":        "/api",
+		"/":       "/api",
+		"/api":    "/api",
+		"api/v2/": "/api/v2",
+		" /v1 ":   "/v1",
+	}
+	for in, want := range cases {
+		if got := NormalizePrefix(in); got != want {
+			t.Errorf("NormalizePrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestClientWithPrefix_URLPaths(t *testing.T) {
+	var paths []string
+	srv := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+
+	c := NewClientWithPrefix(srv.URL, "key", "/api/v2/")
+	c.ListSandboxes(context.Background())    //nolint:errcheck
+	c.StopSandbox(context.Background(), "x") //nolint:errcheck
+	c.ListSnapshots(context.Background())    //nolint:errcheck
+
+	want := []string{"/api/v2/sandbox", "/api/v2/sandbox/x/stop", "/api/v2/snapshots"}
+	if len(paths) != len(want) {
+		t.Fatalf("paths: got %v want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("path[%d]: got %q want %q", i, paths[i], want[i])
+		}
+	}
+}
+
+// ── Transport ─────────────────────────────────────────────────────────────────
+
+func TestClient_ReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, st http.ConnState) {
+		if st == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	c := NewClientWithOptions(srv.URL, "k", "", TransportOptions{MaxIdleConnsPerHost: 4, IdleConnTimeout: time.Minute})
+	for i := 0; i < 5; i++ {
+		if _, err := c.ListSandboxes(context.Background()); err != nil {
+			t.Fatalf("ListSandboxes: %v", err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("connections opened: got %d want 1", n)
+	}
+	if tr := c.Transport().(*http.Transport); tr.MaxIdleConnsPerHost != 4 || tr.IdleConnTimeout != time.Minute {
+		t.Errorf("transport: MaxIdleConnsPerHost %d IdleConnTimeout %s", tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+}
+
+func TestClient_HTTP2(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		var proto atomic.Int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proto.Store(int32(r.ProtoMajor))
+			w.Write([]byte(`[]`))
+		}))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+
+		c := NewClientWithOptions(srv.URL, "k", "", TransportOptions{HTTP2: enabled})
+		c.transport.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+		if _, err := c.ListSandboxes(context.Background()); err != nil {
+			t.Fatalf("HTTP2=%v: ListSandboxes: %v", enabled, err)
+		}
+		want := int32(1)
+		if enabled {
+			want = 2
+		}
+		if got := proto.Load(); got != want {
+			t.Errorf("HTTP2=%v: request used HTTP/%d, want HTTP/%d", enabled, got, want)
+		}
+	}
+}
+
+func TestClient_CancelClosesInFlight(t *testing.T) {
+	srv := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	c := NewClient(srv.URL, "k")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.ListSandboxes(ctx); err == nil {
+		t.Fatal("expected an error from a cancelled request")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("cancelled request took %s to return", d)
+	}
+}
+
+// ── Version ───────────────────────────────────────────────────────────────────
+
+func TestVersion_FromVersionEndpoint(t *testing.T) {
+	srv := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/version" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"version":"0.21.3"}`))
+	})
+
+	got, err := NewClient(srv.URL, "key").Version(context.Background())
+	if err != nil || got != "0.21.3" {
+		t.Errorf("Version: got %q err=%v want 0.21.3", got, err)
+	}
+}
+
+func TestVersion_FallsBackToHealth(t *testing.T) {
+	srv := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+
+	got, err := NewClient(srv.URL, "key").Version(context.Background())
+	if err != nil || got != "" {
+		t.Errorf("Version: got %q err=%v want empty, nil", got, err)
+	}
+}
+
+func TestVersion_Unreachable(t *testing.T) {
+	srv := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	if _, err := NewClient(srv.URL, "key").Version(context.Background()); err == nil {
+		t.Error("expected error when neither /version nor /health answers 200")
+	}
+}
+
 // ── Integration tests (real Daytona at localhost:3000) ────────────────────────
 //
 // These run only when Daytona is reachable. They never mutate state (no create/delete).
@@ -260,3 +418,44 @@ func TestIntegration_WrongKey_Unauthorized(t *testing.T) {
 	}
 	t.Logf("got expected auth error: %v", err)
 }
+
+func TestSetAdminKey_LaterRequestsCarryNewKey(t *testing.T) {
+	var gotAuth []string
+	srv := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode([]Sandbox{})
+	})
+
+	c := NewClient(srv.URL, "old-key")
+	c.ListSandboxes(context.Background()) //nolint:errcheck
+	c.SetAdminKey("new-key")
+	c.ListSandboxes(context.Background()) //nolint:errcheck
+
+	if len(gotAuth) != 2 || gotAuth[0] != "Bearer old-key" || gotAuth[1] != "Bearer new-key" {
+		t.Errorf("Authorization headers: got %q", gotAuth)
+	}
+	if c.AdminKey() != "new-key" {
+		t.Errorf("AdminKey: got %q", c.AdminKey())
+	}
+}
+
+func TestCheckAdminKey(t *testing.T) {
+	srv := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]Sandbox{})
+	})
+
+	c := NewClient(srv.URL, "current")
+	if err := c.CheckAdminKey(context.Background(), "good"); err != nil {
+		t.Errorf("accepted key: %v", err)
+	}
+	if err := c.CheckAdminKey(context.Background(), "bad"); err == nil {
+		t.Error("rejected key: expected error")
+	}
+	if c.AdminKey() != "current" {
+		t.Errorf("CheckAdminKey must not switch keys, got %q", c.AdminKey())
+	}
+}
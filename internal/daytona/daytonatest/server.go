@@ -0,0 +1,262 @@
+// Package daytonatest provides a stateful in-memory Daytona API server for
+// tests: sandboxes are created with their labels and resources, listed,
+// fetched, started, stopped, archived and deleted, and every lifecycle call is
+// recorded. Latency and error responses can be injected to exercise slow or
+// failing upstreams.
+package daytonatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+// Sandbox states the server reports. WaitStopped returns once a sandbox is
+// StateStopped or StateArchived.
+const (
+	StateStarted  = "started"
+	StateStopped  = "stopped"
+	StateArchived = "archived"
+)
+
+// Server is a mock Daytona API server. The zero value is not usable; create
+// one with NewServer.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	idPrefix  string
+	nextID    int
+	sandboxes map[string]daytona.Sandbox
+	order     []string // sandbox IDs in creation order, for listing
+	latency   time.Duration
+	failAll   int
+	fail      map[string]int // sandbox ID → status every request for it gets
+
+	created, started, stopped, archived, deleted []string
+
+	// inflight counts requests in progress per sandbox ID; overlaps counts
+	// requests that arrived while another for the same sandbox was running.
+	inflight map[string]int
+	overlaps int
+}
+
+// NewServer starts a Server that is closed when the test ends. Created
+// sandboxes get IDs "<idPrefix>-1", "<idPrefix>-2", …
+func NewServer(t testing.TB, idPrefix string) *Server {
+	t.Helper()
+	s := &Server{
+		idPrefix:  idPrefix,
+		sandboxes: map[string]daytona.Sandbox{},
+		fail:      map[string]int{},
+		inflight:  map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a daytona.Client for the server.
+func (s *Server) Client() *daytona.Client {
+	return daytona.NewClient(s.URL, "test-key")
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Fail makes every request naming sandbox id answer status, e.g. 500 for a
+// Daytona error. 0 restores normal handling.
+func (s *Server) Fail(id string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.fail, id)
+		return
+	}
+	s.fail[id] = status
+}
+
+// FailAll makes every request answer status, e.g. 503 for an outage. 0
+// restores normal handling.
+func (s *Server) FailAll(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failAll = status
+}
+
+// Add seeds a sandbox as if it had been created. A sandbox without a state is
+// StateStarted.
+func (s *Server) Add(sb daytona.Sandbox) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sb.State == "" {
+		sb.State = StateStarted
+	}
+	if _, ok := s.sandboxes[sb.ID]; !ok {
+		s.order = append(s.order, sb.ID)
+	}
+	s.sandboxes[sb.ID] = sb
+}
+
+// Sandbox returns the current state of sandbox id.
+func (s *Server) Sandbox(id string) (daytona.Sandbox, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sb, ok := s.sandboxes[id]
+	return sb, ok
+}
+
+// Created, Started, Stopped, Archived and Deleted return the sandbox IDs of
+// the successful calls of each kind, in arrival order.
+func (s *Server) Created() []string  { return s.calls(&s.created) }
+func (s *Server) Started() []string  { return s.calls(&s.started) }
+func (s *Server) Stopped() []string  { return s.calls(&s.stopped) }
+func (s *Server) Archived() []string { return s.calls(&s.archived) }
+func (s *Server) Deleted() []string  { return s.calls(&s.deleted) }
+
+// Overlaps returns how many requests arrived while another request for the
+// same sandbox was still being served.
+func (s *Server) Overlaps() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overlaps
+}
+
+func (s *Server) calls(list *[]string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(*list)
+}
+
+// serve routes /api/sandbox[/<id>[/<action>]]. Lifecycle actions on a sandbox
+// the server does not know succeed and are recorded, so tests of stop and
+// start paths need not seed every sandbox; GET of an unknown sandbox is 404.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" || parts[1] != "sandbox" {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	id, action := "", ""
+	if len(parts) > 2 {
+		id = parts[2]
+	}
+	if len(parts) > 3 {
+		action = parts[3]
+	}
+
+	s.mu.Lock()
+	latency, status := s.latency, s.failAll
+	if id != "" {
+		if st, ok := s.fail[id]; ok && status == 0 {
+			status = st
+		}
+		if s.inflight[id]++; s.inflight[id] > 1 {
+			s.overlaps++
+		}
+	}
+	s.mu.Unlock()
+	if id != "" {
+		defer func() {
+			s.mu.Lock()
+			s.inflight[id]--
+			s.mu.Unlock()
+		}()
+	}
+	time.Sleep(latency)
+	if status != 0 {
+		http.Error(w, fmt.Sprintf(`{"error":"injected %d"}`, status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		s.create(w, r)
+	case r.Method == http.MethodGet && id == "":
+		s.mu.Lock()
+		list := make([]daytona.Sandbox, 0, len(s.order))
+		for _, sid := range s.order {
+			list = append(list, s.sandboxes[sid])
+		}
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(list) //nolint:errcheck
+	case r.Method == http.MethodGet && action == "":
+		sb, ok := s.Sandbox(id)
+		if !ok {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(sb) //nolint:errcheck
+	case r.Method == http.MethodDelete && action == "":
+		s.mu.Lock()
+		delete(s.sandboxes, id)
+		s.order = slices.DeleteFunc(s.order, func(sid string) bool { return sid == id })
+		s.deleted = append(s.deleted, id)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && action == "start":
+		s.transition(w, id, StateStarted, &s.started)
+	case r.Method == http.MethodPost && action == "stop":
+		s.transition(w, id, StateStopped, &s.stopped)
+	case r.Method == http.MethodPost && action == "archive":
+		s.transition(w, id, StateArchived, &s.archived)
+	default:
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	}
+}
+
+// create stores a sandbox with the body's labels and resources (1 CPU and
+// 1 GB by default) and answers 201 with it.
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Labels   map[string]string `json:"labels"`
+		CPU      int               `json:"cpu"`
+		Memory   int               `json:"memory"`
+		Snapshot string            `json:"snapshot"`
+	}
+	json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
+	sb := daytona.Sandbox{
+		State:    StateStarted,
+		Labels:   body.Labels,
+		CPU:      max(body.CPU, 1),
+		Memory:   max(body.Memory, 1),
+		Snapshot: body.Snapshot,
+	}
+	if sb.Labels == nil {
+		sb.Labels = map[string]string{}
+	}
+	s.mu.Lock()
+	s.nextID++
+	sb.ID = fmt.Sprintf("%s-%d", s.idPrefix, s.nextID)
+	s.sandboxes[sb.ID] = sb
+	s.order = append(s.order, sb.ID)
+	s.created = append(s.created, sb.ID)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sb) //nolint:errcheck
+}
+
+// transition records a lifecycle call and moves a known sandbox to state.
+func (s *Server) transition(w http.ResponseWriter, id, state string, list *[]string) {
+	s.mu.Lock()
+	if sb, ok := s.sandboxes[id]; ok {
+		sb.State = state
+		s.sandboxes[id] = sb
+	}
+	*list = append(*list, id)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,83 @@
+package daytonatest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+func TestServer_Lifecycle(t *testing.T) {
+	s := NewServer(t, "sb")
+	c := s.Client()
+	ctx := context.Background()
+
+	resp, err := http.Post(s.URL+"/api/sandbox", "application/json",
+		strings.NewReader(`{"labels":{"daytona-owner":"0xabc"},"cpu":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status %d", resp.StatusCode)
+	}
+	sb, err := c.GetSandbox(ctx, "sb-1")
+	if err != nil || sb == nil || sb.Labels["daytona-owner"] != "0xabc" || sb.CPU != 2 || sb.Memory != 1 || sb.State != StateStarted {
+		t.Fatalf("get: %+v, %v", sb, err)
+	}
+
+	if err := c.StopSandbox(ctx, "sb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitStopped(ctx, "sb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ArchiveSandbox(ctx, "sb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Sandbox("sb-1"); got.State != StateArchived {
+		t.Errorf("state after archive: %q", got.State)
+	}
+	if st, ar := s.Stopped(), s.Archived(); len(st) != 1 || len(ar) != 1 || s.Created()[0] != "sb-1" {
+		t.Errorf("calls: stopped %v archived %v", st, ar)
+	}
+}
+
+func TestServer_InjectedFailuresAndLatency(t *testing.T) {
+	s := NewServer(t, "sb")
+	s.Add(daytona.Sandbox{ID: "sb-a"})
+	s.Add(daytona.Sandbox{ID: "sb-b"})
+	c := s.Client()
+	ctx := context.Background()
+
+	s.Fail("sb-a", http.StatusInternalServerError)
+	if err := c.StopSandbox(ctx, "sb-a"); err == nil {
+		t.Error("stop of a failing sandbox: expected an error")
+	}
+	if err := c.StopSandbox(ctx, "sb-b"); err != nil {
+		t.Errorf("stop of another sandbox: %v", err)
+	}
+	s.Fail("sb-a", 0)
+	if err := c.StopSandbox(ctx, "sb-a"); err != nil {
+		t.Errorf("stop after clearing the failure: %v", err)
+	}
+
+	s.FailAll(http.StatusServiceUnavailable)
+	if _, err := c.ListSandboxes(ctx); err == nil {
+		t.Error("list during an outage: expected an error")
+	}
+	s.FailAll(0)
+
+	s.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	list, err := c.ListSandboxes(ctx)
+	if err != nil || len(list) != 2 || list[0].ID != "sb-a" {
+		t.Errorf("list: %+v, %v", list, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("latency not applied: %v", d)
+	}
+}
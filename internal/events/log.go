@@ -20,6 +20,7 @@ const (
 	TypeStopped    = "stopped"
 	TypeAutoStopped = "auto_stopped"
 	TypeSettled    = "settled"
+	TypeNonceGap   = "nonce_gap"
 )
 
 // Event is a single operator-visible billing event stored in Redis.
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Per-wallet stream event types, in addition to TypeAutoStopped.
+const (
+	TypeVoucherQueued  = "voucher_queued"      // a create-fee or compute voucher was enqueued
+	TypeVoucherSettled = "voucher_settled"     // settlement result; see StreamEvent.Status
+	TypeLowBalance     = "low_balance_warning" // balance will not cover the next period(s); top up to avoid a stop
+)
+
+const (
+	userChannelPrefix = "events:user:"
+	userSeqPrefix     = "events:seq:"
+	userLogPrefix     = "events:log:"
+	// maxUserLog caps the per-wallet replay log used for client resync.
+	maxUserLog = 100
+	userLogTTL = 24 * time.Hour
+)
+
+// StreamEvent is a billing event scoped to one wallet, delivered over the
+// live event stream. Seq increases by one per wallet so a reconnecting client
+// can ask for everything after the last Seq it saw.
+type StreamEvent struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	SandboxID string    `json:"sandbox_id,omitempty"`
+	Amount    string    `json:"amount,omitempty"`
+	Nonce     string    `json:"nonce,omitempty"`
+	Status    string    `json:"status,omitempty"` // voucher_settled: lowercased settlement status
+	Message   string    `json:"message,omitempty"`
+}
+
+// UserChannel returns the Redis pub/sub channel carrying wallet's events.
+func UserChannel(wallet string) string {
+	return userChannelPrefix + strings.ToLower(wallet)
+}
+
+func userSeqKey(wallet string) string { return userSeqPrefix + strings.ToLower(wallet) }
+func userLogKey(wallet string) string { return userLogPrefix + strings.ToLower(wallet) }
+
+// Publish assigns the next sequence number for wallet, appends the event to
+// the wallet's replay log and publishes it on UserChannel.
+func Publish(ctx context.Context, rdb *redis.Client, wallet string, e StreamEvent) error {
+	if wallet == "" {
+		return nil
+	}
+	seq, err := rdb.Incr(ctx, userSeqKey(wallet)).Result()
+	if err != nil {
+		return err
+	}
+	e.Seq = seq
+	e.Time = time.Now().UTC()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	logKey := userLogKey(wallet)
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, logKey, string(data))
+	pipe.LTrim(ctx, logKey, 0, maxUserLog-1)
+	pipe.Expire(ctx, logKey, userLogTTL)
+	pipe.Publish(ctx, UserChannel(wallet), string(data))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Delivery is one wallet's event, for PublishBatch.
+type Delivery struct {
+	Wallet string
+	Event  StreamEvent
+}
+
+// PublishBatch is Publish for several events in two round trips: one reserves
+// the sequence numbers of every wallet involved, the other appends and
+// publishes all the events. A wallet's events get consecutive Seq values in
+// slice order.
+func PublishBatch(ctx context.Context, rdb *redis.Client, ds []Delivery) error {
+	counts := make(map[string]int64)
+	for _, d := range ds {
+		if d.Wallet != "" {
+			counts[strings.ToLower(d.Wallet)]++
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	pipe := rdb.Pipeline()
+	incrs := make(map[string]*redis.IntCmd, len(counts))
+	for w, n := range counts {
+		incrs[w] = pipe.IncrBy(ctx, userSeqKey(w), n)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	seq := make(map[string]int64, len(counts))
+	for w, cmd := range incrs {
+		seq[w] = cmd.Val() - counts[w]
+	}
+
+	now := time.Now().UTC()
+	pipe = rdb.TxPipeline()
+	for _, d := range ds {
+		if d.Wallet == "" {
+			continue
+		}
+		w := strings.ToLower(d.Wallet)
+		seq[w]++
+		e := d.Event
+		e.Seq, e.Time = seq[w], now
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		pipe.LPush(ctx, userLogKey(w), string(data))
+		pipe.Publish(ctx, UserChannel(w), string(data))
+	}
+	for w := range counts {
+		pipe.LTrim(ctx, userLogKey(w), 0, maxUserLog-1)
+		pipe.Expire(ctx, userLogKey(w), userLogTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Since returns wallet's retained events with Seq > after, oldest first.
+func Since(ctx context.Context, rdb *redis.Client, wallet string, after int64) ([]StreamEvent, error) {
+	vals, err := rdb.LRange(ctx, userLogKey(wallet), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	var out []StreamEvent
+	for _, v := range vals {
+		var e StreamEvent
+		if json.Unmarshal([]byte(v), &e) == nil && e.Seq > after {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out, nil
+}
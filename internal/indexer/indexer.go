@@ -46,9 +46,10 @@ type chainClient interface {
 // Indexer maintains a live in-memory index of all providers registered on-chain,
 // backed by Redis for persistence across restarts.
 type Indexer struct {
-	chain chainClient
-	rdb   *redis.Client
-	log   *zap.Logger
+	chain      chainClient
+	rdb        *redis.Client
+	log        *zap.Logger
+	startBlock uint64 // first block scanned when there is no cursor yet
 
 	mu    sync.RWMutex
 	store map[string]ProviderRecord // keyed by lowercase hex address
@@ -64,6 +65,12 @@ func New(c chainClient, rdb *redis.Client, log *zap.Logger) *Indexer {
 	}
 }
 
+// SetStartBlock sets the first block to scan (e.g. the contract's deployment
+// block) instead of block 1. A persisted cursor past it takes precedence.
+func (idx *Indexer) SetStartBlock(block uint64) {
+	idx.startBlock = block
+}
+
 // Run starts the polling loop. It syncs immediately, then every pollInterval.
 // Blocks until ctx is cancelled.
 func (idx *Indexer) Run(ctx context.Context) {
@@ -134,7 +141,7 @@ func (idx *Indexer) Get(addr string) (ProviderRecord, bool) {
 // sync fetches new ServiceUpdated events since the last indexed block and
 // refreshes the provider records for any provider that emitted a new event.
 func (idx *Indexer) sync(ctx context.Context) {
-	fromBlock := idx.lastBlock(ctx) + 1
+	fromBlock := max(idx.lastBlock(ctx)+1, idx.startBlock)
 
 	events, latestBlock, err := idx.chain.GetServiceUpdatedEvents(ctx, fromBlock)
 	if err != nil {
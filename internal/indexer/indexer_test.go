@@ -212,6 +212,27 @@ func TestSync_resumesFromLastBlock(t *testing.T) {
 	}
 }
 
+func TestSync_startBlock(t *testing.T) {
+	rdb := newRedis(t)
+	ctx := context.Background()
+
+	var capturedFrom uint64
+	mc := &mockChainCapture{captured: &capturedFrom, latestBlock: 9_000_100}
+	idx := New(mc, rdb, zap.NewNop())
+	idx.SetStartBlock(9_000_000)
+
+	// No cursor yet: start at the configured block, not at 1.
+	idx.sync(ctx)
+	if capturedFrom != 9_000_000 {
+		t.Errorf("first sync fromBlock = %d, want 9000000", capturedFrom)
+	}
+	// The persisted cursor takes over once it passes the start block.
+	idx.sync(ctx)
+	if capturedFrom != 9_000_101 {
+		t.Errorf("second sync fromBlock = %d, want 9000101", capturedFrom)
+	}
+}
+
 // mockChainCapture records the fromBlock passed to GetServiceUpdatedEvents.
 type mockChainCapture struct {
 	captured    *uint64
@@ -0,0 +1,113 @@
+// Package logging builds the service logger from config.ServerConfig.
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+)
+
+// New returns a logger configured by LOG_LEVEL, LOG_FORMAT and LOG_SAMPLING,
+// along with the AtomicLevel that controls it at runtime.
+func New(cfg config.ServerConfig) (*zap.Logger, zap.AtomicLevel, error) {
+	level, err := ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+	sampling, err := parseSampling(cfg.LogSampling)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+
+	var zc zap.Config
+	switch cfg.LogFormat {
+	case "", "json":
+		zc = zap.NewProductionConfig()
+	case "console":
+		zc = zap.NewDevelopmentConfig()
+		zc.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		// Development mode panics on DPanic; keep production semantics.
+		zc.Development = false
+	default:
+		return nil, zap.AtomicLevel{}, fmt.Errorf("invalid LOG_FORMAT %q (want json or console)", cfg.LogFormat)
+	}
+	atom := zap.NewAtomicLevelAt(level)
+	zc.Level = atom
+	zc.Sampling = sampling
+
+	log, err := zc.Build()
+	if err != nil {
+		return nil, zap.AtomicLevel{}, fmt.Errorf("build logger: %w", err)
+	}
+	return log, atom, nil
+}
+
+// ParseLevel accepts debug, info, warn or error (case-insensitive).
+func ParseLevel(s string) (zapcore.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "", "info":
+		return zapcore.InfoLevel, nil
+	case "warn":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+	return 0, fmt.Errorf("invalid LOG_LEVEL %q (want debug, info, warn or error)", s)
+}
+
+// parseSampling parses "initial,thereafter"; "off" disables sampling.
+func parseSampling(s string) (*zap.SamplingConfig, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" {
+		return nil, nil
+	}
+	first, rest, ok := strings.Cut(s, ",")
+	initial, err1 := strconv.Atoi(strings.TrimSpace(first))
+	thereafter, err2 := strconv.Atoi(strings.TrimSpace(rest))
+	if !ok || err1 != nil || err2 != nil || initial <= 0 || thereafter <= 0 {
+		return nil, fmt.Errorf("invalid LOG_SAMPLING %q (want \"initial,thereafter\" or off)", s)
+	}
+	return &zap.SamplingConfig{Initial: initial, Thereafter: thereafter}, nil
+}
+
+// LevelHandler serves GET/PUT for the runtime log level. Callers are
+// responsible for restricting it to admins.
+//
+//	PUT {"level":"debug"} → 200 {"level":"debug"}
+func LevelHandler(atom zap.AtomicLevel, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodPut {
+			var req struct {
+				Level string `json:"level"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				return
+			}
+			level, err := ParseLevel(req.Level)
+			if err != nil || req.Level == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "level must be debug, info, warn or error"})
+				return
+			}
+			if prev := atom.Level(); prev != level {
+				atom.SetLevel(level)
+				// Logged at warn so the change is visible at any level.
+				log.Warn("log level changed",
+					zap.String("from", prev.String()),
+					zap.String("to", level.String()),
+					zap.String("by", c.GetString("wallet_address")),
+				)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"level": atom.Level().String()})
+	}
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+)
+
+func TestNew_AppliesLevelAndFormat(t *testing.T) {
+	for _, format := range []string{"json", "console"} {
+		log, atom, err := New(config.ServerConfig{LogLevel: "warn", LogFormat: format, LogSampling: "100,100"})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if atom.Level() != zapcore.WarnLevel || log.Core().Enabled(zapcore.InfoLevel) {
+			t.Errorf("%s: expected warn level, got %s", format, atom.Level())
+		}
+		atom.SetLevel(zapcore.DebugLevel)
+		if !log.Core().Enabled(zapcore.DebugLevel) {
+			t.Errorf("%s: runtime level change not applied", format)
+		}
+	}
+}
+
+func TestNew_RejectsInvalidConfig(t *testing.T) {
+	for _, cfg := range []config.ServerConfig{
+		{LogLevel: "verbose"},
+		{LogFormat: "xml"},
+		{LogSampling: "100"},
+		{LogSampling: "0,100"},
+		{LogSampling: "a,b"},
+	} {
+		if _, _, err := New(cfg); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
+
+func TestParseSampling(t *testing.T) {
+	if s, err := parseSampling("off"); err != nil || s != nil {
+		t.Errorf("off: got %+v, %v", s, err)
+	}
+	s, err := parseSampling(" 10, 50 ")
+	if err != nil || s.Initial != 10 || s.Thereafter != 50 {
+		t.Errorf("10,50: got %+v, %v", s, err)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	atom := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	r := gin.New()
+	h := LevelHandler(atom, zap.NewNop())
+	r.GET("/admin/loglevel", h)
+	r.PUT("/admin/loglevel", h)
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/admin/loglevel", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPut, `{"level":"DEBUG"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"debug"`) {
+		t.Fatalf("put debug: %d %s", w.Code, w.Body.String())
+	}
+	if atom.Level() != zapcore.DebugLevel {
+		t.Errorf("level: got %s want debug", atom.Level())
+	}
+	for _, body := range []string{`{"level":"trace"}`, `{}`, `nope`} {
+		if w := do(http.MethodPut, body); w.Code != http.StatusBadRequest {
+			t.Errorf("put %s: expected 400, got %d", body, w.Code)
+		}
+	}
+	if w := do(http.MethodGet, ""); !strings.Contains(w.Body.String(), `"debug"`) {
+		t.Errorf("get: %s", w.Body.String())
+	}
+}
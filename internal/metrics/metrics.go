@@ -0,0 +1,57 @@
+// Package metrics exposes Prometheus metrics for settlement monitoring.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// QueueDepth is the number of vouchers waiting in a provider's
+	// settlement queue.
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "voucher_queue_depth",
+		Help: "Vouchers waiting in the settlement queue.",
+	}, []string{"provider"})
+
+	// OldestVoucherAge is the age of the voucher at the head of a provider's
+	// settlement queue, i.e. the current settlement lag.
+	OldestVoucherAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oldest_voucher_age_seconds",
+		Help: "Seconds since the voucher at the head of the settlement queue was enqueued; 0 when the queue is empty.",
+	}, []string{"provider"})
+
+	// LifecycleEvents counts billing lifecycle hook calls by event (created,
+	// started, stopped, deleted, archived) and outcome: "applied" when the call
+	// opened or closed a session, "duplicate" when it found the session
+	// already in that state and did nothing.
+	LifecycleEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "billing_lifecycle_events_total",
+		Help: "Billing lifecycle hook calls by event and outcome (applied or duplicate).",
+	}, []string{"event", "outcome"})
+
+	// PreflightFailOpen counts creates and starts admitted unchecked because
+	// a pre-flight RPC failed under PREFLIGHT_FAILURE_MODE=fail_open, by
+	// check ("acknowledgement check" or "balance check").
+	PreflightFailOpen = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "preflight_fail_open_total",
+		Help: "Creates and starts admitted without a pre-flight check because its RPC failed (fail_open).",
+	}, []string{"check"})
+)
+
+// Outcomes of LifecycleEvents.
+const (
+	OutcomeApplied   = "applied"
+	OutcomeDuplicate = "duplicate"
+)
+
+func init() {
+	prometheus.MustRegister(QueueDepth, OldestVoucherAge, LifecycleEvents, PreflightFailOpen)
+}
+
+// Handler serves the registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// QueueSampler periodically reads a provider's voucher queue and updates
+// QueueDepth and OldestVoucherAge. It only uses LLEN and LINDEX, so it never
+// pops or reorders items.
+type QueueSampler struct {
+	rdb      *redis.Client
+	provider string
+	queueKey string
+	interval time.Duration
+	codec    *voucher.Codec
+	clock    clock.Clock
+	log      *zap.Logger
+}
+
+// NewQueueSampler returns a sampler for provider's queue that samples every
+// interval once Run is called.
+func NewQueueSampler(rdb *redis.Client, provider string, interval time.Duration, log *zap.Logger) *QueueSampler {
+	return &QueueSampler{
+		rdb:      rdb,
+		provider: provider,
+		queueKey: fmt.Sprintf(voucher.VoucherQueueKeyFmt, provider),
+		interval: interval,
+		clock:    clock.Real{},
+		log:      log,
+	}
+}
+
+// SetClock replaces the real clock used to compute voucher age. A nil clock
+// restores the real one.
+func (q *QueueSampler) SetClock(c clock.Clock) {
+	q.clock = clock.OrReal(c)
+}
+
+// SetCodec sets the codec queued vouchers are encrypted with (see
+// billing.Signer.SetCodec); nil = plaintext.
+func (q *QueueSampler) SetCodec(c *voucher.Codec) {
+	q.codec = c
+}
+
+// Run samples immediately and then every interval until ctx is cancelled.
+func (q *QueueSampler) Run(ctx context.Context) {
+	t := time.NewTicker(q.interval)
+	defer t.Stop()
+	for {
+		if err := q.Sample(ctx); err != nil && ctx.Err() == nil {
+			q.log.Warn("metrics: sample voucher queue", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sample reads the queue depth and the head voucher's enqueue time once.
+// An empty queue reports an age of 0, as does a head voucher queued before
+// EnqueuedAt was recorded.
+func (q *QueueSampler) Sample(ctx context.Context) error {
+	st, err := ReadQueue(ctx, q.rdb, q.queueKey, q.codec, q.clock.Now())
+	if err != nil {
+		return err
+	}
+	QueueDepth.WithLabelValues(q.provider).Set(float64(st.Depth))
+	OldestVoucherAge.WithLabelValues(q.provider).Set(st.OldestAgeSec)
+	return nil
+}
+
+// QueueState is a voucher queue's depth and the age of its head voucher.
+type QueueState struct {
+	Depth        int64   `json:"depth"`
+	OldestAgeSec float64 `json:"oldest_age_sec"`
+}
+
+// ReadQueue reads the depth of queueKey and the age at now of its head
+// voucher, opened with codec (nil = plaintext). Like Sample, it never pops or
+// reorders items.
+func ReadQueue(ctx context.Context, rdb *redis.Client, queueKey string, codec *voucher.Codec, now time.Time) (QueueState, error) {
+	pipe := rdb.Pipeline()
+	depth := pipe.LLen(ctx, queueKey)
+	head := pipe.LIndex(ctx, queueKey, 0)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return QueueState{}, err
+	}
+	st := QueueState{Depth: depth.Val()}
+	if raw, err := head.Result(); err == nil {
+		var v voucher.SandboxVoucher
+		if plain, err := codec.Open(raw); err == nil && json.Unmarshal(plain, &v) == nil && v.EnqueuedAt > 0 {
+			st.OldestAgeSec = max(0, float64(now.Unix()-v.EnqueuedAt))
+		}
+	}
+	return st, nil
+}
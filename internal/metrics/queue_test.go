@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const testProvider = "0x1111111111111111111111111111111111111111"
+
+func TestQueueSampler_DepthAndOldestAge(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q := NewQueueSampler(rdb, testProvider, time.Minute, zap.NewNop())
+	q.SetClock(clock.NewFake(now))
+
+	// Empty queue: both gauges are 0, not an error.
+	if err := q.Sample(ctx); err != nil {
+		t.Fatalf("empty queue: %v", err)
+	}
+	if d, a := testutil.ToFloat64(QueueDepth.WithLabelValues(testProvider)), testutil.ToFloat64(OldestVoucherAge.WithLabelValues(testProvider)); d != 0 || a != 0 {
+		t.Errorf("empty queue: depth=%v age=%v want 0, 0", d, a)
+	}
+
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, testProvider)
+	for i, ago := range []time.Duration{90 * time.Second, 30 * time.Second, 0} {
+		raw, _ := json.Marshal(voucher.SandboxVoucher{SandboxID: fmt.Sprintf("sb-%d", i), EnqueuedAt: now.Add(-ago).Unix()})
+		rdb.RPush(ctx, queueKey, raw) //nolint:errcheck
+	}
+	before := rdb.LRange(ctx, queueKey, 0, -1).Val()
+
+	if err := q.Sample(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := testutil.ToFloat64(QueueDepth.WithLabelValues(testProvider)); d != 3 {
+		t.Errorf("depth: got %v want 3", d)
+	}
+	if a := testutil.ToFloat64(OldestVoucherAge.WithLabelValues(testProvider)); a != 90 {
+		t.Errorf("oldest age: got %v want 90", a)
+	}
+	// Sampling must leave the queue untouched.
+	if after := rdb.LRange(ctx, queueKey, 0, -1).Val(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Errorf("queue changed by sampling:\nbefore %v\nafter  %v", before, after)
+	}
+}
@@ -0,0 +1,138 @@
+// Package migrate applies versioned changes to the Redis key schema.
+//
+// Migration N moves the schema from version N-1 to N. Run reads the applied
+// version from Redis (SchemaVersionKey), applies the later migrations
+// strictly in order and records each version as soon as its migration
+// completes, so an interrupted run resumes where it stopped. Every migration
+// is idempotent: re-running one over keys it already migrated changes
+// nothing. See cmd/migrate.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const (
+	// SchemaVersionKey holds the version of the last applied migration; a
+	// missing key is version 0.
+	SchemaVersionKey = "schema:version"
+	// lockKey keeps two runs from migrating at once. The TTL frees it if a
+	// run dies without releasing it.
+	lockKey = "schema:migrate:lock"
+	lockTTL = 30 * time.Minute
+)
+
+// ErrLocked is returned by Run while another run holds the migration lock.
+var ErrLocked = errors.New("another migration is running")
+
+// Env is what a migration operates on.
+type Env struct {
+	RDB   *redis.Client
+	Codec *voucher.Codec // opens queued vouchers; nil = plaintext
+}
+
+// Stats counts what a migration changed, or with a dry run would change.
+// Skipped counts items it could not read and left alone.
+type Stats struct {
+	Changed int
+	Skipped int
+}
+
+// Migration is one versioned schema change. Apply must be idempotent and,
+// with dryRun, must not write anything.
+type Migration struct {
+	Version     int
+	Name        string
+	Description string
+	Apply       func(ctx context.Context, env Env, dryRun bool) (Stats, error)
+}
+
+// Result reports one migration of a run.
+type Result struct {
+	Migration
+	Stats
+}
+
+// CurrentVersion returns the applied schema version.
+func CurrentVersion(ctx context.Context, rdb *redis.Client) (int, error) {
+	raw, err := rdb.Get(ctx, SchemaVersionKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid %s %q", SchemaVersionKey, raw)
+	}
+	return v, nil
+}
+
+// Run applies the migrations after the applied version up to target (0 =
+// all of them) and returns what each did. migrations must be numbered 1, 2,
+// 3, ... in order. Run refuses a schema newer than the last migration it
+// knows and a target below the applied version: migrations only go forward.
+//
+// With dryRun nothing is written, the version included. Each migration then
+// reports against the current keys, without the effects of the migrations
+// before it.
+func Run(ctx context.Context, env Env, migrations []Migration, target int, dryRun bool) ([]Result, error) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %q has version %d, want %d: migrations must be numbered in order", m.Name, m.Version, i+1)
+		}
+	}
+	latest := len(migrations)
+	if target == 0 {
+		target = latest
+	}
+	if target < 0 || target > latest {
+		return nil, fmt.Errorf("target version %d out of range (latest is %d)", target, latest)
+	}
+	current, err := CurrentVersion(ctx, env.RDB)
+	if err != nil {
+		return nil, err
+	}
+	if current > latest {
+		return nil, fmt.Errorf("schema version %d is newer than this tool (latest %d); use a newer build", current, latest)
+	}
+	if target < current {
+		return nil, fmt.Errorf("schema is at version %d; cannot migrate back to %d", current, target)
+	}
+
+	if !dryRun {
+		ok, err := env.RDB.SetNX(ctx, lockKey, 1, lockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrLocked
+		}
+		defer env.RDB.Del(context.WithoutCancel(ctx), lockKey) //nolint:errcheck
+	}
+
+	var results []Result
+	for _, m := range migrations[current:target] {
+		stats, err := m.Apply(ctx, env, dryRun)
+		results = append(results, Result{Migration: m, Stats: stats})
+		if err != nil {
+			return results, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if dryRun {
+			continue
+		}
+		if err := env.RDB.Set(ctx, SchemaVersionKey, m.Version, 0).Err(); err != nil {
+			return results, fmt.Errorf("record version %d: %w", m.Version, err)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,216 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const testProvider = "0x1111111111111111111111111111111111111111"
+
+var alice = common.HexToAddress("0xAAAA000000000000000000000000000000000001")
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// seedOldSchema writes what a build without the pending index and the
+// owner running set left behind: two queued vouchers for sb-1, an unreadable
+// queue item and an open session for sb-1 missing from its owner's set.
+func seedOldSchema(t *testing.T, ctx context.Context, rdb *redis.Client) {
+	t.Helper()
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProvider).Hex())
+	for i := range 2 {
+		v := voucher.SandboxVoucher{
+			SandboxID:  "sb-1",
+			User:       alice,
+			Provider:   common.HexToAddress(testProvider),
+			TotalFee:   big.NewInt(int64(100 + i)),
+			UsageHash:  [32]byte{byte(i + 1)},
+			EnqueuedAt: int64(1000 + i),
+		}
+		raw, _ := json.Marshal(v)
+		rdb.RPush(ctx, queueKey, raw)
+	}
+	rdb.RPush(ctx, queueKey, "enc:lost-key:AAAA")
+
+	if err := billing.CreateSession(ctx, rdb, billing.Session{SandboxID: "sb-1", Owner: alice.Hex(), Provider: testProvider}); err != nil {
+		t.Fatal(err)
+	}
+	rdb.Del(ctx, "owner:sandboxes:0xaaaa000000000000000000000000000000000001")
+}
+
+func TestRun_DryRunThenApply(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	seedOldSchema(t, ctx, rdb)
+	env := Env{RDB: rdb}
+
+	results, err := Run(ctx, env, Migrations, 0, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(results) != 2 || results[0].Changed != 2 || results[0].Skipped != 1 || results[1].Changed != 1 {
+		t.Fatalf("dry run results: %+v", results)
+	}
+	if v, _ := CurrentVersion(ctx, rdb); v != 0 {
+		t.Errorf("dry run recorded version %d", v)
+	}
+	if p, _ := billing.ListPending(ctx, rdb, "sb-1"); len(p) != 0 {
+		t.Errorf("dry run wrote %d pending entries", len(p))
+	}
+
+	if _, err := Run(ctx, env, Migrations, 0, false); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if v, _ := CurrentVersion(ctx, rdb); v != 2 {
+		t.Errorf("version: got %d, want 2", v)
+	}
+	if p, _ := billing.ListPending(ctx, rdb, "sb-1"); len(p) != 2 || p[0].TotalFee != "100" {
+		t.Errorf("pending: got %+v", p)
+	}
+	if ids, _ := billing.OwnerSandboxes(ctx, rdb, alice.Hex()); len(ids) != 1 || ids[0] != "sb-1" {
+		t.Errorf("owner sandboxes: got %v", ids)
+	}
+
+	// An up-to-date schema is a no-op.
+	results, err = Run(ctx, env, Migrations, 0, false)
+	if err != nil || len(results) != 0 {
+		t.Errorf("re-run: got %+v, %v", results, err)
+	}
+}
+
+func TestMigrations_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	seedOldSchema(t, ctx, rdb)
+	env := Env{RDB: rdb}
+
+	// A nonce the settler recorded in the index must survive a re-run.
+	pendingKey := fmt.Sprintf(voucher.PendingKeyFmt, "sb-1")
+	field := common.Hash([32]byte{1}).Hex()
+	rdb.HSet(ctx, pendingKey, field, `{"total_fee":"100","usage_hash":"`+field+`","nonce":"7","enqueued_at":1000}`)
+
+	for _, m := range Migrations {
+		if _, err := m.Apply(ctx, env, false); err != nil {
+			t.Fatalf("%s: %v", m.Name, err)
+		}
+		stats, err := m.Apply(ctx, env, false)
+		if err != nil || stats.Changed != 0 {
+			t.Errorf("%s re-run: got %+v, %v; want no changes", m.Name, stats, err)
+		}
+	}
+	p, _ := billing.ListPending(ctx, rdb, "sb-1")
+	if len(p) != 2 || p[0].Nonce != "7" {
+		t.Errorf("pending after re-run: got %+v", p)
+	}
+}
+
+// A voucher the settler pops between the backfill's read and its write is
+// not indexed: the settler has already cleared it.
+func TestBackfillPending_SkipsPoppedVoucher(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	seedOldSchema(t, ctx, rdb)
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, common.HexToAddress(testProvider).Hex())
+	item := rdb.LIndex(ctx, queueKey, 0).Val()
+	var v voucher.SandboxVoucher
+	if err := json.Unmarshal([]byte(item), &v); err != nil {
+		t.Fatal(err)
+	}
+	rdb.LPop(ctx, queueKey)
+
+	added, err := billing.BackfillPending(ctx, rdb, queueKey, item, &v, false)
+	if err != nil || added {
+		t.Errorf("popped voucher: added %v, %v", added, err)
+	}
+	if p, _ := billing.ListPending(ctx, rdb, "sb-1"); len(p) != 0 {
+		t.Errorf("popped voucher indexed: %+v", p)
+	}
+}
+
+func TestRun_RefusesOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	env := Env{RDB: rdb}
+	noop := func(context.Context, Env, bool) (Stats, error) { return Stats{}, nil }
+
+	misnumbered := []Migration{{Version: 1, Name: "a", Apply: noop}, {Version: 3, Name: "c", Apply: noop}}
+	if _, err := Run(ctx, env, misnumbered, 0, false); err == nil {
+		t.Error("misnumbered migrations: expected an error")
+	}
+
+	rdb.Set(ctx, SchemaVersionKey, 5, 0)
+	if _, err := Run(ctx, env, Migrations, 0, false); err == nil {
+		t.Error("schema newer than the tool: expected an error")
+	}
+
+	rdb.Set(ctx, SchemaVersionKey, 2, 0)
+	if _, err := Run(ctx, env, Migrations, 1, false); err == nil {
+		t.Error("target below the applied version: expected an error")
+	}
+}
+
+func TestRun_StopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	env := Env{RDB: rdb}
+	var ran []int
+	step := func(version int, fail bool) Migration {
+		return Migration{Version: version, Name: fmt.Sprint(version), Apply: func(context.Context, Env, bool) (Stats, error) {
+			ran = append(ran, version)
+			if fail {
+				return Stats{}, errors.New("boom")
+			}
+			return Stats{Changed: 1}, nil
+		}}
+	}
+	migrations := []Migration{step(1, false), step(2, true), step(3, false)}
+
+	if _, err := Run(ctx, env, migrations, 0, false); err == nil {
+		t.Fatal("expected the failing migration's error")
+	}
+	if v, _ := CurrentVersion(ctx, rdb); v != 1 {
+		t.Errorf("version after failure: got %d, want 1", v)
+	}
+	if len(ran) != 2 {
+		t.Errorf("ran %v; migration 3 must not run after 2 failed", ran)
+	}
+
+	// The next run resumes at the failed migration.
+	migrations[1] = step(2, false)
+	ran = nil
+	if _, err := Run(ctx, env, migrations, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || ran[0] != 2 {
+		t.Errorf("resumed run ran %v, want [2 3]", ran)
+	}
+}
+
+func TestRun_Locked(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	rdb.Set(ctx, lockKey, 1, 0)
+	if _, err := Run(ctx, Env{RDB: rdb}, Migrations, 0, false); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, want ErrLocked", err)
+	}
+	// A dry run only reads, so it does not need the lock.
+	if _, err := Run(ctx, Env{RDB: rdb}, Migrations, 0, true); err != nil {
+		t.Errorf("dry run under lock: %v", err)
+	}
+}
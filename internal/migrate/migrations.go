@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// queuePage is how many queued vouchers are read per LRANGE.
+const queuePage = 500
+
+// Migrations is the schema history, oldest first. Append new migrations with
+// the next version; never renumber or edit one that has shipped.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Name:        "pending-index",
+		Description: "index queued vouchers under pending:{sandboxID}",
+		Apply:       backfillPending,
+	},
+	{
+		Version:     2,
+		Name:        "owner-sandboxes",
+		Description: "add open sessions to owner:sandboxes:{owner}",
+		Apply:       backfillOwnerSandboxes,
+	},
+}
+
+// backfillPending indexes every voucher in the providers' settlement queues
+// that was enqueued before the pending index existed. Items the codec cannot
+// open are skipped.
+func backfillPending(ctx context.Context, env Env, dryRun bool) (Stats, error) {
+	var stats Stats
+	iter := env.RDB.Scan(ctx, 0, fmt.Sprintf(voucher.VoucherQueueKeyFmt, "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		queueKey := iter.Val()
+		// The settler pops from the head while we read; a voucher that moves
+		// past a page boundary may be missed, but it is leaving the queue and
+		// needs no index anyway. BackfillPending skips a voucher popped
+		// between the read and the write.
+		for start := int64(0); ; start += queuePage {
+			items, err := env.RDB.LRange(ctx, queueKey, start, start+queuePage-1).Result()
+			if err != nil {
+				return stats, fmt.Errorf("read %s: %w", queueKey, err)
+			}
+			for _, item := range items {
+				raw, err := env.Codec.Open(item)
+				if err != nil {
+					stats.Skipped++
+					continue
+				}
+				var v voucher.SandboxVoucher
+				if err := json.Unmarshal(raw, &v); err != nil {
+					stats.Skipped++
+					continue
+				}
+				added, err := billing.BackfillPending(ctx, env.RDB, queueKey, item, &v, dryRun)
+				if err != nil {
+					return stats, err
+				}
+				if added {
+					stats.Changed++
+				}
+			}
+			if len(items) < queuePage {
+				break
+			}
+		}
+	}
+	return stats, iter.Err()
+}
+
+// backfillOwnerSandboxes adds each open session to its owner's running set,
+// which the running-sandbox limit and the low-balance warning read.
+func backfillOwnerSandboxes(ctx context.Context, env Env, dryRun bool) (Stats, error) {
+	var stats Stats
+	sessions, err := billing.ScanAllSessions(ctx, env.RDB)
+	if err != nil {
+		return stats, err
+	}
+	for _, s := range sessions {
+		if s.Owner == "" {
+			stats.Skipped++
+			continue
+		}
+		added, err := billing.BackfillOwnerSandbox(ctx, env.RDB, s, dryRun)
+		if err != nil {
+			return stats, err
+		}
+		if added {
+			stats.Changed++
+		}
+	}
+	return stats, nil
+}
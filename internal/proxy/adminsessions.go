@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+)
+
+// SessionReaper closes billing sessions whose sandbox is gone or that have
+// not been billed for too long. Satisfied by *billing.EventHandler.
+type SessionReaper interface {
+	ReapSessions(ctx context.Context, dtona billing.SandboxLister, staleSec int64, dryRun bool) ([]billing.ReapedSession, error)
+}
+
+// SetSessionReaper enables POST /admin/sessions/reap. Without one it answers
+// 501.
+func (h *Handler) SetSessionReaper(r SessionReaper) {
+	h.reaper = r
+}
+
+// handleAdminSessions serves GET /admin/sessions: every open billing session,
+// oldest first, with its age and billing progress. ?page (0-indexed) and
+// ?page_size (default 50, 0 = all) paginate. Admin only.
+func (h *Handler) handleAdminSessions(c *gin.Context) {
+	if !h.isAdmin(c.GetString("wallet_address")) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "billing state unavailable"})
+		return
+	}
+	page := 0
+	if s := c.Query("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			return
+		}
+		page = n
+	}
+	pageSize := 50
+	if s := c.Query("page_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page_size"})
+			return
+		}
+		pageSize = n
+	}
+
+	sessions, err := billing.ScanAllSessions(c.Request.Context(), h.rdb)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].StartedAt != sessions[j].StartedAt {
+			return sessions[i].StartedAt < sessions[j].StartedAt
+		}
+		return sessions[i].SandboxID < sessions[j].SandboxID
+	})
+	total := len(sessions)
+	if pageSize > 0 {
+		// page and page_size are caller-chosen: keep page*pageSize and
+		// start+pageSize from overflowing.
+		start := total
+		if page <= total/pageSize {
+			start = page * pageSize
+		}
+		sessions = sessions[start : start+min(pageSize, total-start)]
+	}
+
+	type row struct {
+		SandboxID     string `json:"sandbox_id"`
+		Owner         string `json:"owner"`
+		StartedAt     int64  `json:"started_at"`
+		AgeSec        int64  `json:"age_sec"`
+		LastVoucherAt int64  `json:"last_voucher_at"`
+		NextVoucherAt int64  `json:"next_voucher_at"`
+		AccruedFee    string `json:"accrued_fee"`
+		AccruedFeeOG  string `json:"accrued_fee_0g,omitempty"`
+		PausedAt      int64  `json:"paused_at,omitempty"`
+	}
+	now := clock.OrReal(h.clock).Now().Unix()
+	rows := make([]row, len(sessions))
+	for i, s := range sessions {
+		rows[i] = row{
+			SandboxID:     s.SandboxID,
+			Owner:         s.Owner,
+			StartedAt:     s.StartedAt,
+			AgeSec:        now - s.StartedAt,
+			LastVoucherAt: s.LastVoucherAt,
+			NextVoucherAt: s.NextVoucherAt,
+			AccruedFee:    s.AccruedFee,
+			AccruedFeeOG:  h.og(s.AccruedFee),
+			PausedAt:      s.PausedAt,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"sessions":  rows,
+	})
+}
+
+// handleReapSessions serves POST /admin/sessions/reap: close the sessions
+// whose sandbox no longer exists in Daytona and, with ?older_than_sec=N,
+// those not billed for more than N seconds, charging unbilled time in final
+// vouchers (see billing.EventHandler.ReapSessions). ?dry_run=true only lists
+// them. Admin only.
+func (h *Handler) handleReapSessions(c *gin.Context) {
+	wallet := c.GetString("wallet_address")
+	if !h.isAdmin(wallet) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+	if h.reaper == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "session reaping unavailable"})
+		return
+	}
+	var olderThan int64
+	if s := c.Query("older_than_sec"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid older_than_sec"})
+			return
+		}
+		olderThan = n
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	reaped, err := h.reaper.ReapSessions(c.Request.Context(), h.dtona, olderThan, dryRun)
+	if err != nil {
+		h.log.Error("admin reap sessions", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if reaped == nil {
+		reaped = []billing.ReapedSession{}
+	}
+	h.log.Info("admin reap sessions", zap.String("admin", wallet), zap.Int64("older_than_sec", olderThan),
+		zap.Bool("dry_run", dryRun), zap.Int("reaped", len(reaped)))
+	c.JSON(http.StatusOK, gin.H{
+		"older_than_sec": olderThan,
+		"dry_run":        dryRun,
+		"reaped":         reaped,
+	})
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+const testAdmin = "0xadmin000000000000000000000000000000000a"
+
+type mockReaper struct {
+	staleSec int64
+	dryRun   bool
+	calls    int
+}
+
+func (m *mockReaper) ReapSessions(_ context.Context, _ billing.SandboxLister, staleSec int64, dryRun bool) ([]billing.ReapedSession, error) {
+	m.calls++
+	m.staleSec, m.dryRun = staleSec, dryRun
+	return []billing.ReapedSession{{SandboxID: "sb-old", Reason: billing.ReapStale}}, nil
+}
+
+func newAdminSessionsEngine(t *testing.T, wallet string, rp SessionReaper) (*gin.Engine, *redis.Client, time.Time) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", wallet)
+		c.Next()
+	})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := NewHandler(daytona.NewClient("http://daytona.invalid", "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", []string{testAdmin}, "", rdb, zap.NewNop(), "", nil, 0, 0, nil)
+	h.SetClock(clock.NewFake(now))
+	if rp != nil {
+		h.SetSessionReaper(rp)
+	}
+	h.Register(api)
+	return r, rdb, now
+}
+
+func TestAdminSessions_ListsOldestFirstPaginated(t *testing.T) {
+	r, rdb, now := newAdminSessionsEngine(t, testAdmin, nil)
+	ctx := context.Background()
+	for i, id := range []string{"sb-c", "sb-a", "sb-b"} {
+		billing.CreateSession(ctx, rdb, billing.Session{ //nolint:errcheck
+			SandboxID: id, Owner: "0xowner", StartedAt: now.Unix() - int64(1000*(3-i)), LastVoucherAt: now.Unix() - 10,
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/sessions?page=1&page_size=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Total    int `json:"total"`
+		Sessions []struct {
+			SandboxID     string `json:"sandbox_id"`
+			AgeSec        int64  `json:"age_sec"`
+			LastVoucherAt int64  `json:"last_voucher_at"`
+		} `json:"sessions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Total != 3 || len(resp.Sessions) != 1 || resp.Sessions[0].SandboxID != "sb-b" || resp.Sessions[0].AgeSec != 1000 {
+		t.Errorf("page 1: %+v", resp)
+	}
+
+	// Huge page and page_size must not overflow into a bogus slice.
+	for _, q := range []string{"page=4611686018427387904&page_size=2", "page=1&page_size=9223372036854775807", "page=9223372036854775807&page_size=9223372036854775807"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/sessions?"+q, nil))
+		resp.Sessions = nil
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || len(resp.Sessions) != 0 {
+			t.Errorf("%s: status %d, %+v", q, w.Code, resp)
+		}
+	}
+}
+
+func TestAdminSessions_Reap(t *testing.T) {
+	rp := &mockReaper{}
+	r, _, _ := newAdminSessionsEngine(t, testAdmin, rp)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/admin/sessions/reap?older_than_sec=86400&dry_run=true", nil))
+	if w.Code != http.StatusOK || rp.staleSec != 86400 || !rp.dryRun {
+		t.Fatalf("status %d, reaper got %+v: %s", w.Code, rp, w.Body.String())
+	}
+	var resp struct {
+		Reaped []billing.ReapedSession `json:"reaped"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Reaped) != 1 || resp.Reaped[0].SandboxID != "sb-old" {
+		t.Errorf("reaped: %+v", resp.Reaped)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/admin/sessions/reap?older_than_sec=-1", nil))
+	if w.Code != http.StatusBadRequest || rp.calls != 1 {
+		t.Errorf("negative threshold: status %d, reaper calls %d", w.Code, rp.calls)
+	}
+}
+
+func TestAdminSessions_AdminOnly(t *testing.T) {
+	rp := &mockReaper{}
+	r, _, _ := newAdminSessionsEngine(t, "0xsomeoneelse", rp)
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/admin/sessions", nil),
+		httptest.NewRequest(http.MethodPost, "/api/admin/sessions/reap", nil),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want 403", req.Method, req.URL.Path, w.Code)
+		}
+	}
+	if rp.calls != 0 {
+		t.Error("non-admin reached the reaper")
+	}
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"math/big"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+	"github.com/0gfoundation/0g-sandbox/internal/units"
+)
+
+// DefaultAmountPlaces renders *_0g amounts exactly.
+const DefaultAmountPlaces = units.Decimals
+
+// SetAmountPlaces sets how many fractional digits the human-readable *_0g
+// amounts next to neuron amounts are rounded to. Out-of-range values keep
+// DefaultAmountPlaces. The neuron amounts are always exact.
+func (h *Handler) SetAmountPlaces(places int) {
+	if places >= 0 && places <= units.Decimals {
+		h.amountPlaces = places
+	}
+}
+
+// og renders a decimal neuron string in 0G at the configured precision, or ""
+// if it is not a neuron amount (e.g. an unset fee).
+func (h *Handler) og(neuron string) string {
+	n, ok := new(big.Int).SetString(neuron, 10)
+	if !ok {
+		return ""
+	}
+	return units.FormatOGPlaces(n, h.amountPlaces)
+}
+
+// receiptView is a settlement receipt as served, with its fee in 0G.
+type receiptView struct {
+	settler.Receipt
+	TotalFeeOG string `json:"total_fee_0g,omitempty"`
+}
+
+func (h *Handler) receiptViews(rs []settler.Receipt) []receiptView {
+	out := make([]receiptView, len(rs))
+	for i, r := range rs {
+		out[i] = receiptView{Receipt: r, TotalFeeOG: h.og(r.TotalFee)}
+	}
+	return out
+}
+
+// pendingView is a queued voucher as served, with its fee in 0G.
+type pendingView struct {
+	billing.PendingVoucher
+	TotalFeeOG string `json:"total_fee_0g,omitempty"`
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// DefaultCreateIDPaths are the JSON paths tried, in order, for the sandbox ID
+// in Daytona's create response. Daytona versions differ in where they put it.
+var DefaultCreateIDPaths = []string{"id", "sandboxId", "sandbox_id", "data.id", "data.sandboxId", "sandbox.id"}
+
+// maxLoggedBody caps how much of an unexpected upstream body is logged.
+const maxLoggedBody = 512
+
+// SetCreateIDPaths overrides DefaultCreateIDPaths. Each path is a
+// dot-separated list of object keys, e.g. "data.sandbox.id"; blank entries
+// are ignored, and a list with none left keeps the defaults.
+func (h *Handler) SetCreateIDPaths(paths []string) {
+	var kept []string
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) > 0 {
+		h.createIDPaths = kept
+	}
+}
+
+// extractID returns the first non-empty string found at one of paths in a
+// JSON response body, or "" if none matches.
+func extractID(body []byte, paths []string) string {
+	id, _ := extractCreated(body, paths)
+	return id
+}
+
+// extractCreated is extractID that also returns the JSON object holding the
+// ID, i.e. the created sandbox, so its resources and labels are read from the
+// same place whether Daytona returns it at the top level or wrapped (e.g.
+// under "data" or "sandbox"). sandbox is nil when no path matches.
+func extractCreated(body []byte, paths []string) (id string, sandbox []byte) {
+	var doc any
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&doc); err != nil {
+		return "", nil
+	}
+	for _, p := range paths {
+		v, parent := doc, doc
+		for _, key := range strings.Split(p, ".") {
+			m, ok := v.(map[string]any)
+			if !ok {
+				v = nil
+				break
+			}
+			parent, v = m, m[key]
+		}
+		if id, ok := v.(string); ok && id != "" {
+			sandbox, _ = json.Marshal(parent)
+			return id, sandbox
+		}
+	}
+	return "", nil
+}
+
+// truncateForLog returns body as a string of at most n bytes.
+func truncateForLog(body []byte, n int) string {
+	if len(body) <= n {
+		return string(body)
+	}
+	return string(body[:n]) + "…(truncated)"
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// handleRotateDaytonaKey serves PUT /admin/daytona-key: replaces the Daytona
+// admin key without a restart. The body is {"key": "<new key>"}. The key is
+// first checked against Daytona; once accepted, every new request, including
+// forwarded ones, uses it. The key is never logged or echoed. Admin only.
+func (h *Handler) handleRotateDaytonaKey(c *gin.Context) {
+	wallet := c.GetString("wallet_address")
+	if !h.isAdmin(wallet) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Key) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be {\"key\": \"<daytona admin key>\"}"})
+		return
+	}
+	key := strings.TrimSpace(req.Key)
+	if err := h.dtona.CheckAdminKey(c.Request.Context(), key); err != nil {
+		h.log.Warn("daytona admin key rotation rejected", zap.String("admin", wallet), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "new key not accepted by daytona: " + err.Error()})
+		return
+	}
+	h.dtona.SetAdminKey(key)
+	h.log.Info("daytona admin key rotated", zap.String("admin", wallet))
+	c.JSON(http.StatusOK, gin.H{"rotated": true})
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+func TestRotateDaytonaKey(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		lastAuth string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth != "Bearer old-key" && auth != "Bearer new-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		lastAuth = auth
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	wallet := testAdmin
+	core, logs := observer.New(zap.DebugLevel)
+	dtona := daytona.NewClient(srv.URL, "old-key")
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", wallet)
+		c.Next()
+	})
+	h := NewHandler(dtona, &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", []string{testAdmin}, "", nil, zap.New(core), "", nil, 0, 0, nil)
+	h.Register(api)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/admin/daytona-key", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	wallet = "0xnotadmin"
+	if w := put(`{"key":"new-key"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: want 403, got %d", w.Code)
+	}
+	wallet = testAdmin
+	if w := put(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing key: want 400, got %d", w.Code)
+	}
+	if w := put(`{"key":"wrong-key"}`); w.Code != http.StatusBadGateway || dtona.AdminKey() != "old-key" {
+		t.Errorf("rejected key: got %d, key switched to %q", w.Code, dtona.AdminKey())
+	}
+	if w := put(`{"key":"new-key"}`); w.Code != http.StatusOK {
+		t.Fatalf("rotate: want 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Both direct and forwarded requests now carry the new key.
+	mu.Lock()
+	lastAuth = ""
+	mu.Unlock()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox", nil))
+	mu.Lock()
+	got := lastAuth
+	mu.Unlock()
+	if got != "Bearer new-key" {
+		t.Errorf("after rotation: Daytona saw %q, want the new key", got)
+	}
+	h.rp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-1", nil))
+	mu.Lock()
+	got = lastAuth
+	mu.Unlock()
+	if got != "Bearer new-key" {
+		t.Errorf("forwarded after rotation: Daytona saw %q, want the new key", got)
+	}
+
+	for _, e := range logs.All() {
+		for _, v := range e.ContextMap() {
+			if s, ok := v.(string); ok && (strings.Contains(s, "new-key") || strings.Contains(s, "wrong-key")) {
+				t.Errorf("key logged: %q %v", e.Message, e.ContextMap())
+			}
+		}
+	}
+}
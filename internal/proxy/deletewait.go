@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+)
+
+// DefaultDeleteWaitTimeout bounds how long DELETE /sandbox/:id?wait=true
+// waits for the sandbox's vouchers to settle when no explicit timeout is
+// configured.
+const DefaultDeleteWaitTimeout = 60 * time.Second
+
+// deleteWaitPoll is how often the pending-voucher index is checked while
+// waiting; a variable so tests can shorten it.
+var deleteWaitPoll = 250 * time.Millisecond
+
+// SetDeleteWaitTimeout overrides DefaultDeleteWaitTimeout. d <= 0 keeps the
+// default.
+func (h *Handler) SetDeleteWaitTimeout(d time.Duration) {
+	if d > 0 {
+		h.deleteWaitTimeout = d
+	}
+}
+
+// deleteSettlement reports the final settlement of a deleted sandbox.
+// Status is the final voucher's receipt status once nothing is pending,
+// "dead_lettered" if it was dead-lettered without a receipt, "none" if there
+// is no record of it, or "timeout" if vouchers were still queued when the wait
+// ended.
+type deleteSettlement struct {
+	Settled   bool          `json:"settled"`
+	Status    string        `json:"status"`
+	Receipt   *receiptView  `json:"receipt,omitempty"`
+	DLQReason string        `json:"dlq_reason,omitempty"`
+	Pending   []pendingView `json:"pending,omitempty"`
+}
+
+// handleDeleteWait serves DELETE /sandbox/:id?wait=true. After Daytona
+// deletes the sandbox, the billing session is closed synchronously and the
+// request waits, up to the configured timeout, until none of the sandbox's
+// vouchers is queued (each has settled, been rejected or been dead-lettered),
+// then reports the outcome of the final voucher. Compute periods are charged
+// in advance, so the final voucher is already queued when the session closes.
+// A failed Daytona delete is passed through unchanged.
+func (h *Handler) handleDeleteWait(c *gin.Context, id string) {
+	// Daytona does not know the wait parameter.
+	q := c.Request.URL.Query()
+	q.Del("wait")
+	c.Request.URL.RawQuery = q.Encode()
+
+	rec := httptest.NewRecorder()
+	h.rp.ServeHTTP(rec, c.Request)
+	if rec.Code < 200 || rec.Code >= 300 {
+		copyRecorder(c, rec)
+		return
+	}
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.billing.OnDelete(ctx, id)
+	h.deregisterDeleted(ctx, id)
+	final := h.finalVoucher(ctx, id)
+
+	waitCtx, cancel := context.WithTimeout(c.Request.Context(), h.deleteWaitTimeout)
+	defer cancel()
+	s := h.awaitSettlement(waitCtx, id, final)
+	code := http.StatusOK
+	if !s.Settled {
+		code = http.StatusAccepted
+	}
+	c.JSON(code, gin.H{"id": id, "deleted": true, "settlement": s})
+}
+
+// finalVoucher returns the usage hash of sandboxID's newest queued voucher,
+// or "" if none is queued or the index cannot be read.
+func (h *Handler) finalVoucher(ctx context.Context, sandboxID string) string {
+	pending, err := billing.ListPending(ctx, h.rdb, sandboxID)
+	if err != nil {
+		h.log.Warn("delete wait: list pending", zap.String("id", sandboxID), zap.Error(err))
+		return ""
+	}
+	if len(pending) == 0 {
+		return ""
+	}
+	return pending[len(pending)-1].UsageHash
+}
+
+// awaitSettlement polls sandboxID's pending-voucher index until it is empty
+// or ctx ends, then reports the outcome of the voucher with usage hash final:
+// its receipt, or its DLQ reason if it was dead-lettered before settling. With
+// final empty, nothing was queued at the delete and the latest receipt is
+// reported. A Redis error is retried at the next poll.
+func (h *Handler) awaitSettlement(ctx context.Context, sandboxID, final string) deleteSettlement {
+	ticker := time.NewTicker(deleteWaitPoll)
+	defer ticker.Stop()
+	var pending []billing.PendingVoucher
+	for {
+		var err error
+		pending, err = billing.ListPending(ctx, h.rdb, sandboxID)
+		if err == nil && len(pending) == 0 {
+			break
+		}
+		if err != nil && ctx.Err() == nil {
+			h.log.Warn("delete wait: list pending", zap.String("id", sandboxID), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			views := make([]pendingView, len(pending))
+			for i, p := range pending {
+				views[i] = pendingView{PendingVoucher: p, TotalFeeOG: h.og(p.TotalFee)}
+			}
+			return deleteSettlement{Status: "timeout", Pending: views}
+		case <-ticker.C:
+		}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	s := deleteSettlement{Settled: true, Status: "none"}
+	receipt, err := h.finalReceipt(ctx, sandboxID, final)
+	if err != nil {
+		h.log.Warn("delete wait: get receipt", zap.String("id", sandboxID), zap.Error(err))
+	}
+	if receipt != nil {
+		s.Status = receipt.Status
+		s.Receipt = &receiptView{Receipt: *receipt, TotalFeeOG: h.og(receipt.TotalFee)}
+		return s
+	}
+	if final == "" {
+		return s
+	}
+	reason, err := settler.DeadLetterReason(ctx, h.rdb, sandboxID, final)
+	if err != nil {
+		h.log.Warn("delete wait: get dlq reason", zap.String("id", sandboxID), zap.Error(err))
+	}
+	if reason != "" {
+		s.Status, s.DLQReason = "dead_lettered", reason
+	}
+	return s
+}
+
+// finalReceipt returns the receipt of sandboxID's voucher with usage hash
+// final, or its latest receipt if final is empty. nil if there is none.
+func (h *Handler) finalReceipt(ctx context.Context, sandboxID, final string) (*settler.Receipt, error) {
+	if final == "" {
+		return settler.GetReceipt(ctx, h.rdb, sandboxID)
+	}
+	receipts, err := settler.ListReceipts(ctx, h.rdb, sandboxID, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range receipts {
+		if receipts[i].UsageHash == final {
+			return &receipts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// parseWait reads the optional ?wait= flag of DELETE /sandbox/:id.
+func parseWait(c *gin.Context) (bool, error) {
+	raw := c.Query("wait")
+	if raw == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(raw)
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+func TestHandleDelete_Wait(t *testing.T) {
+	defer func(d time.Duration) { deleteWaitPoll = d }(deleteWaitPoll)
+	deleteWaitPoll = 10 * time.Millisecond
+
+	sb := daytona.Sandbox{ID: "sb-d", Labels: map[string]string{ownerLabel: "0xOWNER"}}
+	srv, _ := mockDaytona(t, []daytona.Sandbox{sb})
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	bh := &mockBilling{}
+	h := NewHandler(daytona.NewClient(srv.URL, "key"), bh, nil, nil, nil, nil, nil, nil, nil, "", nil, "", rdb, zap.NewNop(), "", nil, 0, 0, nil)
+	h.SetDeleteWaitTimeout(300 * time.Millisecond)
+	r := gin.New()
+	h.Register(r.Group("/api", func(c *gin.Context) { c.Set("wallet_address", "0xOWNER"); c.Next() }))
+	ctx := context.Background()
+
+	del := func(query string) (int, deleteSettlement) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/sandbox/sb-d"+query, nil))
+		var resp struct {
+			Settlement deleteSettlement `json:"settlement"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Settlement
+	}
+
+	// The last voucher settles while the request waits.
+	rdb.HSet(ctx, "pending:sb-d", "0x01", `{"total_fee":"100","usage_hash":"0x01","nonce":"4","enqueued_at":10}`)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rdb.LPush(ctx, "settle:receipts:sb-d", `{"status":"success","nonce":"4","usage_hash":"0x01","total_fee":"100","settled_at":11}`)
+		rdb.HDel(ctx, "pending:sb-d", "0x01")
+	}()
+	code, s := del("?wait=true")
+	if code != http.StatusOK || !s.Settled || s.Status != "success" || s.Receipt == nil || s.Receipt.Nonce != "4" {
+		t.Errorf("settled: %d %+v", code, s)
+	}
+	bh.mu.Lock()
+	deletes := len(bh.deletes)
+	bh.mu.Unlock()
+	if deletes != 1 {
+		t.Errorf("OnDelete must have run before the response, got %d calls", deletes)
+	}
+
+	// Nothing settles in time: 202 with what is still queued.
+	rdb.HSet(ctx, "pending:sb-d", "0x02", `{"total_fee":"200","usage_hash":"0x02","enqueued_at":20}`)
+	code, s = del("?wait=true")
+	if code != http.StatusAccepted || s.Settled || s.Status != "timeout" || len(s.Pending) != 1 || s.Pending[0].TotalFee != "200" {
+		t.Errorf("timeout: %d %+v", code, s)
+	}
+
+	// The final voucher is dead-lettered before it is signed: no receipt, so
+	// the earlier success must not be reported as its outcome.
+	rdb.Del(ctx, "pending:sb-d")
+	rdb.HSet(ctx, "pending:sb-d", "0x03", `{"total_fee":"300","usage_hash":"0x03","enqueued_at":30}`)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rdb.HSet(ctx, "settle:dlq:sb-d", "0x03", "fee_mismatch")
+		rdb.HDel(ctx, "pending:sb-d", "0x03")
+	}()
+	code, s = del("?wait=true")
+	if code != http.StatusOK || !s.Settled || s.Status != "dead_lettered" || s.DLQReason != "fee_mismatch" || s.Receipt != nil {
+		t.Errorf("dead-lettered: %d %+v", code, s)
+	}
+
+	if code, _ := del("?wait=soon"); code != http.StatusBadRequest {
+		t.Errorf("invalid wait: status %d", code)
+	}
+}
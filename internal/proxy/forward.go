@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ForwardRule matches upstream requests by method and path. Path is relative
+// to the Daytona API prefix, e.g. "/sandbox/:id/ports/*". A ":name" segment
+// matches any single segment; a trailing "*" matches zero or more segments.
+// Method "*" matches any method.
+type ForwardRule struct {
+	Method string
+	Path   string
+}
+
+// ForwardPolicy decides which requests the proxy forwards transparently to
+// Daytona. Deny rules win and are answered with 403; anything not matched by
+// an Allow rule is answered with 404. Routes with their own handler (create,
+// list, start/stop/archive, labels, ssh-access, …) are not subject to it.
+type ForwardPolicy struct {
+	Allow []ForwardRule
+	Deny  []ForwardRule
+}
+
+type forwardDecision int
+
+const (
+	forwardAllowed forwardDecision = iota
+	forwardDenied
+	forwardUnlisted
+)
+
+// DefaultForwardPolicy returns the built-in policy: sandbox reads, port
+// previews, build logs and the toolbox API are forwarded; autostop and
+// autoarchive are denied because the billing proxy manages those lifecycles.
+func DefaultForwardPolicy() ForwardPolicy {
+	return ForwardPolicy{
+		Allow: []ForwardRule{
+			{http.MethodGet, "/sandbox/:id"},
+			{http.MethodGet, "/sandbox/:id/ports/*"},
+			{http.MethodGet, "/sandbox/:id/build-logs"},
+			{"*", "/toolbox/:id/*"},
+		},
+		Deny: defaultDenyRules(),
+	}
+}
+
+// defaultDenyRules are always denied, even when the deny list is configured.
+func defaultDenyRules() []ForwardRule {
+	return []ForwardRule{
+		{"*", "/sandbox/:id/autostop/*"},
+		{"*", "/sandbox/:id/autoarchive/*"},
+	}
+}
+
+// NewForwardPolicy builds a policy from comma-separated "METHOD /path" lists
+// (as in PROXY_FORWARD_ALLOW / PROXY_FORWARD_DENY). An empty allow list keeps
+// the default allow rules. Deny rules are added to the built-in ones.
+func NewForwardPolicy(allow, deny string) (ForwardPolicy, error) {
+	p := DefaultForwardPolicy()
+	if strings.TrimSpace(allow) != "" {
+		rules, err := ParseForwardRules(allow)
+		if err != nil {
+			return ForwardPolicy{}, fmt.Errorf("forward allow list: %w", err)
+		}
+		p.Allow = rules
+	}
+	rules, err := ParseForwardRules(deny)
+	if err != nil {
+		return ForwardPolicy{}, fmt.Errorf("forward deny list: %w", err)
+	}
+	p.Deny = append(p.Deny, rules...)
+	return p, nil
+}
+
+// ParseForwardRules parses a comma-separated list of "METHOD /path" entries.
+func ParseForwardRules(s string) ([]ForwardRule, error) {
+	var rules []ForwardRule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Fields(entry)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "/") {
+			return nil, fmt.Errorf("invalid rule %q: want \"METHOD /path\"", entry)
+		}
+		rules = append(rules, ForwardRule{Method: strings.ToUpper(fields[0]), Path: fields[1]})
+	}
+	return rules, nil
+}
+
+func (p ForwardPolicy) decide(method, path string) forwardDecision {
+	for _, r := range p.Deny {
+		if r.matches(method, path) {
+			return forwardDenied
+		}
+	}
+	for _, r := range p.Allow {
+		if r.matches(method, path) {
+			return forwardAllowed
+		}
+	}
+	return forwardUnlisted
+}
+
+func (r ForwardRule) matches(method, path string) bool {
+	if r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	pat := strings.Split(strings.Trim(r.Path, "/"), "/")
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range pat {
+		if p == "*" && i == len(pat)-1 {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			if segs[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segs[i] {
+			return false
+		}
+	}
+	return len(segs) == len(pat)
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestForwardRule_Matches(t *testing.T) {
+	cases := []struct {
+		rule         ForwardRule
+		method, path string
+		want         bool
+	}{
+		{ForwardRule{"GET", "/sandbox/:id"}, "GET", "/sandbox/sb-1", true},
+		{ForwardRule{"GET", "/sandbox/:id"}, "POST", "/sandbox/sb-1", false},
+		{ForwardRule{"GET", "/sandbox/:id"}, "GET", "/sandbox/sb-1/stop", false},
+		{ForwardRule{"GET", "/sandbox/:id"}, "GET", "/sandbox/", false},
+		{ForwardRule{"*", "/toolbox/:id/*"}, "PUT", "/toolbox/sb-1/toolbox/files", true},
+		{ForwardRule{"*", "/sandbox/:id/autostop/*"}, "POST", "/sandbox/sb-1/autostop", true},
+		{ForwardRule{"*", "/sandbox/:id/autostop/*"}, "POST", "/sandbox/sb-1/autostop/60", true},
+		{ForwardRule{"*", "/sandbox/:id/autostop/*"}, "POST", "/sandbox/sb-1/autostopx", false},
+	}
+	for _, tc := range cases {
+		if got := tc.rule.matches(tc.method, tc.path); got != tc.want {
+			t.Errorf("%v.matches(%s %s) = %v, want %v", tc.rule, tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestNewForwardPolicy_ConfiguredLists(t *testing.T) {
+	p, err := NewForwardPolicy("GET /sandbox/:id, post /sandbox/:id/backup", "GET /sandbox/:id/build-logs")
+	if err != nil {
+		t.Fatalf("NewForwardPolicy: %v", err)
+	}
+	if p.decide(http.MethodPost, "/sandbox/sb-1/backup") != forwardAllowed {
+		t.Error("configured allow rule should be honoured (method is case-insensitive)")
+	}
+	if p.decide(http.MethodGet, "/toolbox/sb-1/toolbox/files") != forwardUnlisted {
+		t.Error("configured allow list replaces the default allow list")
+	}
+	if p.decide(http.MethodGet, "/sandbox/sb-1/build-logs") != forwardDenied {
+		t.Error("configured deny rule should apply")
+	}
+	if p.decide(http.MethodPost, "/sandbox/sb-1/autostop/0") != forwardDenied {
+		t.Error("built-in autostop denial must survive a configured deny list")
+	}
+}
+
+func TestParseForwardRules_Invalid(t *testing.T) {
+	for _, s := range []string{"GET", "GET sandbox/:id", "GET /a /b"} {
+		if _, err := ParseForwardRules(s); err == nil {
+			t.Errorf("ParseForwardRules(%q): expected error", s)
+		}
+	}
+}
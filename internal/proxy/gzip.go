@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetGzip enables gzip compression of the JSON read endpoints (sandbox list
+// and get, account, sessions, revenue, audit log) for clients that send
+// Accept-Encoding: gzip. Passthrough routes (toolbox, WebSocket and other
+// forwarded requests) are never compressed. Off by default.
+func (h *Handler) SetGzip(enabled bool) {
+	h.gzipEnabled = enabled
+}
+
+// gzipped wraps a JSON read handler with compression when it is enabled and
+// the client accepts gzip. The compressor starts at the first body write, so
+// a response without a body (304, HEAD, an aborted request) is left as is.
+func (h *Handler) gzipped(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.gzipEnabled || c.Request.Method == http.MethodHead ||
+			c.GetHeader("Upgrade") != "" || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			next(c)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: c.Writer}
+		c.Writer = gw
+		defer func() {
+			c.Writer = gw.ResponseWriter
+			if gw.zw != nil {
+				gw.zw.Close() //nolint:errcheck
+			}
+		}()
+		c.Header("Vary", "Accept-Encoding")
+		next(c)
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip: listed
+// without q=0.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// gzipWriter compresses the body written through it, starting the gzip
+// stream on the first non-empty write.
+type gzipWriter struct {
+	gin.ResponseWriter
+	zw *gzip.Writer
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.zw == nil {
+		if len(b) == 0 {
+			return w.ResponseWriter.Write(b)
+		}
+		if s := w.ResponseWriter.Status(); s == http.StatusNoContent || s == http.StatusNotModified {
+			return w.ResponseWriter.Write(b)
+		}
+		hdr := w.ResponseWriter.Header()
+		hdr.Set("Content-Encoding", "gzip")
+		hdr.Del("Content-Length")
+		w.zw = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.zw.Write(b)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush pushes the compressed bytes so far to the client.
+func (w *gzipWriter) Flush() {
+	if w.zw != nil {
+		w.zw.Flush() //nolint:errcheck
+	}
+	w.ResponseWriter.Flush()
+}
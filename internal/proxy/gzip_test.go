@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+func TestGzip_OwnerFilteredList(t *testing.T) {
+	var sandboxes []daytona.Sandbox
+	for i, owner := range []string{"0xOWNER", "0xOTHER", "0xOWNER"} {
+		sandboxes = append(sandboxes, daytona.Sandbox{
+			ID:     string(rune('a'+i)) + "-sb",
+			Labels: map[string]string{ownerLabel: owner, "team": "infra"},
+		})
+	}
+	srv, _ := mockDaytona(t, sandboxes)
+	h := NewHandler(daytona.NewClient(srv.URL, "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0, 0, nil)
+	r := gin.New()
+	h.Register(r.Group("/api", func(c *gin.Context) { c.Set("wallet_address", "0xOWNER"); c.Next() }))
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Disabled: never compressed.
+	if w := get("/api/sandbox", "gzip"); w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("compressed while disabled: %q", w.Header().Get("Content-Encoding"))
+	}
+
+	h.SetGzip(true)
+	plain := get("/api/sandbox", "")
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Errorf("compressed without Accept-Encoding: %q", plain.Header().Get("Content-Encoding"))
+	}
+	w := get("/api/sandbox", "br, gzip;q=0.8")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("gzip list: status %d headers %v", w.Code, w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if string(body) != plain.Body.String() {
+		t.Errorf("decompressed body differs:\n got %s\nwant %s", body, plain.Body.String())
+	}
+	var list []daytona.Sandbox
+	json.Unmarshal(body, &list)
+	if len(list) != 2 || list[0].ID != "a-sb" || list[1].ID != "c-sb" || list[0].Labels[ownerLabel] != "" {
+		t.Errorf("filtered list: %+v", list)
+	}
+
+	// The single-sandbox read composes with the owner-label strip too.
+	w = get("/api/sandbox/a-sb", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("gzip get: headers %v", w.Header())
+	}
+	zr, _ = gzip.NewReader(w.Body)
+	var sb daytona.Sandbox
+	if err := json.NewDecoder(zr).Decode(&sb); err != nil || sb.ID != "a-sb" || sb.Labels[ownerLabel] != "" {
+		t.Errorf("gzip get: %+v, %v", sb, err)
+	}
+
+	// The owner check still runs before anything is compressed.
+	if w := get("/api/sandbox/b-sb", "gzip"); w.Code != http.StatusForbidden {
+		t.Errorf("other owner's sandbox: status %d", w.Code)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"GZIP":               true,
+		"deflate, gzip":      true,
+		"br;q=1, gzip;q=0.5": true,
+		"gzip;q=0":           false,
+		"gzip; q=0.000":      false,
+		"identity":           false,
+		"x-gzip":             false,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -18,25 +19,31 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/auth"
 	"github.com/0gfoundation/0g-sandbox/internal/billing"
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
 	"github.com/0gfoundation/0g-sandbox/internal/daytona"
 	"github.com/0gfoundation/0g-sandbox/internal/events"
 	"github.com/0gfoundation/0g-sandbox/internal/registry"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
 )
 
 // BillingHooks is satisfied by billing.EventHandler.
 // Decoupled here so proxy tests can use a mock.
 type BillingHooks interface {
-	OnCreate(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int)
-	OnStart(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int)
+	OnCreate(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int, labels map[string]string) error
+	OnStart(ctx context.Context, sandboxID, ownerAddr string, cpu, memGB int, labels map[string]string)
 	OnStop(ctx context.Context, sandboxID string)
 	OnDelete(ctx context.Context, sandboxID string)
 	OnArchive(ctx context.Context, sandboxID string)
 	EnsureSession(ctx context.Context, sandboxID, ownerAddr string)
+	PauseBilling(ctx context.Context, sandboxID string) error
+	ResumeBilling(ctx context.Context, sandboxID string) error
 }
 
 // BalanceChecker looks up the on-chain balance for a user with a specific provider.
@@ -78,12 +85,33 @@ type Handler struct {
 	rdb                 *redis.Client
 	teeKey              *ecdsa.PrivateKey // TEE signing key; nil = sealed containers disabled
 	broker              *brokerClient     // nil = broker integration disabled
+	sandboxLimit        int               // max running sandboxes per wallet; 0 = unlimited
+	createQuota         int               // sandbox creations per wallet per createQuotaWindow; 0 = unlimited
+	createQuotaWindow   time.Duration     // see SetCreateQuota
+	clock               clock.Clock       // nil = real clock; see SetClock
+	fwdPolicy           ForwardPolicy     // which upstream paths are transparently forwarded
+	maxBodyBytes        int64             // cap on JSON bodies buffered by jsonBody
+	createIDPaths       []string          // JSON paths tried for the created sandbox's ID
+	transforms          map[string][]ResponseTransform // per-route response rewrites; see SetResponseTransform
+	relayer             DepositRelayer    // nil = deposit relay disabled (experimental)
+	relayMax            *big.Int          // max neuron per relayed deposit
+	relayPerDay         int               // relayed deposits per wallet per day; 0 = unlimited
+	relayBudget         *big.Int          // neuron relayed per day in total; nil = unlimited
+	ackRelayer          AckRelayer        // nil = provision cannot acknowledge; see SetAckRelay
+	reaper              SessionReaper     // nil = POST /admin/sessions/reap disabled
+	depositContract     string            // named in 402 responses; see SetDepositContract
+	amountPlaces        int               // fractional digits of *_0g amounts; see SetAmountPlaces
+	scheduleStop        func(ctx context.Context, sandboxID string, reason settler.StopReason) // see SetStopScheduler
+	preflightFailOpen   bool              // admit creates/starts when a pre-flight RPC fails; see SetPreflightFailureMode
+	deleteWaitTimeout   time.Duration     // bound on DELETE ?wait=true; see SetDeleteWaitTimeout
+	gzipEnabled         bool              // compress JSON read responses; see SetGzip
 	log                 *zap.Logger
 }
 
-func NewHandler(dtona *daytona.Client, bh BillingHooks, balCheck BalanceChecker, ackCheck AckChecker, eventFetcher EventFetcher, createFee, pricePerCPUPerSec, pricePerMemGBPerSec, computePricePerSec *big.Int, providerAddress string, adminAddresses []string, sshGatewayHost string, rdb *redis.Client, log *zap.Logger, brokerURL string, teeKey *ecdsa.PrivateKey, voucherIntervalSec int64) *Handler {
+func NewHandler(dtona *daytona.Client, bh BillingHooks, balCheck BalanceChecker, ackCheck AckChecker, eventFetcher EventFetcher, createFee, pricePerCPUPerSec, pricePerMemGBPerSec, computePricePerSec *big.Int, providerAddress string, adminAddresses []string, sshGatewayHost string, rdb *redis.Client, log *zap.Logger, brokerURL string, teeKey *ecdsa.PrivateKey, voucherIntervalSec int64, maxSandboxesPerOwner int, fwdPolicy *ForwardPolicy) *Handler {
 	target, _ := url.Parse(dtona.BaseURL())
 	rp := httputil.NewSingleHostReverseProxy(target)
+	rp.Transport = dtona.Transport() // share Daytona's connection pool
 
 	// Inject admin key on every forwarded request
 	orig := rp.Director
@@ -116,7 +144,11 @@ func NewHandler(dtona *daytona.Client, bh BillingHooks, balCheck BalanceChecker,
 			admins = append(admins, strings.ToLower(a))
 		}
 	}
-	return &Handler{dtona: dtona, billing: bh, rp: rp, balCheck: balCheck, ackCheck: ackCheck, eventFetcher: eventFetcher, createFee: createFee, pricePerCPUPerSec: pricePerCPUPerSec, pricePerMemGBPerSec: pricePerMemGBPerSec, voucherIntervalSec: voucherIntervalSec, computePricePerSec: computePricePerSec, providerAddress: providerAddress, adminAddresses: admins, sshGatewayHost: sshGatewayHost, rdb: rdb, teeKey: teeKey, broker: broker, log: log}
+	policy := DefaultForwardPolicy()
+	if fwdPolicy != nil {
+		policy = *fwdPolicy
+	}
+	return &Handler{dtona: dtona, billing: bh, rp: rp, balCheck: balCheck, ackCheck: ackCheck, eventFetcher: eventFetcher, createFee: createFee, pricePerCPUPerSec: pricePerCPUPerSec, pricePerMemGBPerSec: pricePerMemGBPerSec, voucherIntervalSec: voucherIntervalSec, computePricePerSec: computePricePerSec, providerAddress: providerAddress, adminAddresses: admins, sshGatewayHost: sshGatewayHost, rdb: rdb, teeKey: teeKey, broker: broker, sandboxLimit: maxSandboxesPerOwner, fwdPolicy: policy, maxBodyBytes: DefaultMaxBodyBytes, amountPlaces: DefaultAmountPlaces, createIDPaths: DefaultCreateIDPaths, deleteWaitTimeout: DefaultDeleteWaitTimeout, log: log}
 }
 
 // isAdmin reports whether wallet is configured as an admin (case-insensitive).
@@ -151,13 +183,16 @@ func (h *Handler) BrokerDeregister(ctx context.Context, sandboxID string) {
 //     Gin's restriction on mixing static segments and wildcard catch-alls.
 func (h *Handler) Register(rg *gin.RouterGroup) {
 	// ── Create sandbox ─────────────────────────────────────────────────────
-	rg.POST("/sandbox", h.handleCreate)
+	// Body-bearing routes opt in to auth.RequireBodyHash so a signed body_hash
+	// binds the request body to the wallet signature. Routes that rewrite a
+	// JSON body are bounded by jsonBody first.
+	rg.POST("/sandbox", h.recoverSandbox(), h.jsonBody(), auth.RequireBodyHash(), h.handleCreate)
 
 	// ── List / paginated (filter by owner) ────────────────────────────────
-	rg.GET("/sandbox", h.handleList)
-	rg.GET("/sandbox/paginated", h.handleList)
+	rg.GET("/sandbox", h.gzipped(h.handleList))
+	rg.GET("/sandbox/paginated", h.gzipped(h.handleList))
 	rg.GET("/volumes", h.handleListGeneric("daytona-owner"))
-	rg.POST("/snapshots", h.handleSnapshotCreate)
+	rg.POST("/snapshots", h.jsonBody(), auth.RequireBodyHash(), h.handleSnapshotCreate)
 	rg.DELETE("/snapshots/:id", h.handleSnapshotDelete)
 
 
@@ -165,27 +200,49 @@ func (h *Handler) Register(rg *gin.RouterGroup) {
 	rg.DELETE("/sandbox/:id", h.withOwner(h.handleDelete))
 
 	// ── Catch-all for /sandbox/:id/<action> ────────────────────────────────
-	// Blocked (autostop/autoarchive), lifecycle hooks, label protection, and
-	// transparent forwarding are all dispatched here to keep Gin happy.
-	rg.Any("/sandbox/:id/*action", h.handleCatchAll)
+	// Lifecycle hooks, label protection, and policy-checked transparent
+	// forwarding are all dispatched here to keep Gin happy.
+	rg.Any("/sandbox/:id/*action", h.recoverSandbox(), h.labelsJSONBody(), auth.RequireBodyHash(), h.handleCatchAll)
 
 	// ── GET /sandbox/:id (no wildcard suffix) ─────────────────────────────
-	rg.GET("/sandbox/:id", h.withOwner(h.forward))
+	rg.GET("/sandbox/:id", h.policed(h.withOwner(h.gzipped(h.forwardStripOwner))))
 
 	// ── Toolbox API (/api/toolbox/:id/*) — owner check + sealed check + transparent forward
-	rg.Any("/toolbox/:id/*action", h.withOwnerNotSealed(h.forward))
+	rg.Any("/toolbox/:id/*action", h.policed(h.withOwnerNotSealed(h.forward)))
 
 	// ── Admin-only: archive all running sandboxes (pre-deploy) ─────────────
 	rg.POST("/archive-all", h.handleArchiveAll)
 
 	// ── Admin-only: list all billing sessions ──────────────────────────────
-	rg.GET("/sessions", h.handleSessions)
+	rg.GET("/sessions", h.gzipped(h.handleSessions))
+
+	// ── Admin-only: billing sessions with age; close stale ones ─────────────
+	rg.GET("/admin/sessions", h.gzipped(h.handleAdminSessions))
+	rg.POST("/admin/sessions/reap", h.handleReapSessions)
+
+	// ── Admin-only: total settled revenue and top-spending users ───────────
+	rg.GET("/admin/revenue", h.gzipped(h.handleAdminRevenue))
+
+	// ── Admin-only: rotate the Daytona admin key without a restart ──────────
+	rg.PUT("/admin/daytona-key", h.jsonBody(), auth.RequireBodyHash(), h.handleRotateDaytonaKey)
 
 	// ── Admin-only: local Redis billing audit log (created/stopped/auto_stopped/settled) ──
-	rg.GET("/audit-log", h.handleAuditLog)
+	rg.GET("/audit-log", h.gzipped(h.handleAuditLog))
 
 	// ── On-chain voucher events (public chain data, wallet auth only) ───────
+	// A WebSocket upgrade on the same path streams the caller's live billing
+	// events instead; browsers authenticate it with a token from /auth/token.
 	rg.GET("/events", h.handleEvents)
+	rg.POST("/auth/token", h.handleIssueToken)
+
+	// ── Caller's account limits ────────────────────────────────────────────
+	rg.GET("/account", h.gzipped(h.handleAccount))
+
+	// ── Experimental: provider-paid deposit relay (off unless configured) ──
+	rg.POST("/account/deposit/relay", h.jsonBody(), auth.RequireBodyHash(), h.handleRelayDeposit)
+
+	// ── Deposit → acknowledge → create in one resumable call ───────────────
+	rg.POST("/sandbox/provision", h.recoverSandbox(), h.jsonBody(), auth.RequireBodyHash(), h.handleProvision)
 }
 
 // ── Create ─────────────────────────────────────────────────────────────────
@@ -200,6 +257,14 @@ func (h *Handler) handleCreate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "read body"})
 		return
 	}
+	slot, ok := h.reserveSandboxSlot(c, wallet, "")
+	if !ok {
+		return
+	}
+	// startCreateBilling opens the session before this returns, so the
+	// sandbox is counted in the running set by the time the slot is freed.
+	defer h.releaseSandboxSlot(context.WithoutCancel(c.Request.Context()), wallet, slot)
+
 	reqCPU, reqMemGB := extractResources(body)
 	// For snapshot creates the request body has no cpu/memory fields.
 	// Look up the snapshot spec so the broker pre-create call uses the real resource cost.
@@ -214,12 +279,10 @@ func (h *Handler) handleCreate(c *gin.Context) {
 	// Pre-check: reject if user has not acknowledged the TEE signer.
 	if h.ackCheck != nil {
 		acked, err := h.ackCheck.IsAcknowledged(c.Request.Context(), common.HexToAddress(wallet))
-		if err != nil {
-			h.log.Error("ack check", zap.String("wallet", wallet), zap.Error(err))
-			c.JSON(http.StatusBadGateway, gin.H{"error": "acknowledgement check failed"})
+		if err != nil && h.preflightFailed(c, "acknowledgement check", wallet, err) {
 			return
 		}
-		if !acked {
+		if err == nil && !acked {
 			c.JSON(http.StatusPaymentRequired, gin.H{"error": "TEE signer not acknowledged"})
 			return
 		}
@@ -231,15 +294,18 @@ func (h *Handler) handleCreate(c *gin.Context) {
 	var createRequired *big.Int
 	createReserved := false
 	if h.balCheck != nil {
-		createRequired = new(big.Int).Add(h.createFee, h.intervalCost(reqCPU, reqMemGB))
+		computeCost := h.intervalCost(reqCPU, reqMemGB)
+		createRequired = new(big.Int).Add(h.createFee, computeCost)
 		balance, err := h.balCheck.GetBalance(c.Request.Context(), common.HexToAddress(wallet), common.HexToAddress(h.providerAddress))
-		if err != nil {
-			h.log.Error("balance check", zap.String("wallet", wallet), zap.Error(err))
-			c.JSON(http.StatusBadGateway, gin.H{"error": "balance check failed"})
+		if err != nil && h.preflightFailed(c, "balance check", wallet, err) {
 			return
 		}
-		available := availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
-		if available.Cmp(createRequired) < 0 && h.broker != nil {
+		checked := err == nil
+		var available *big.Int
+		if checked {
+			available = availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
+		}
+		if checked && available.Cmp(createRequired) < 0 && h.broker != nil {
 			// Ask the broker to top up the user's balance (funding-only call:
 			// sandbox_id="" means no monitoring session is registered yet).
 			if berr := h.broker.registerSession(c.Request.Context(), "", wallet, int64(reqCPU), int64(reqMemGB)); berr != nil {
@@ -247,20 +313,16 @@ func (h *Handler) handleCreate(c *gin.Context) {
 			} else {
 				// Re-read balance after top-up.
 				balance, err = h.balCheck.GetBalance(c.Request.Context(), common.HexToAddress(wallet), common.HexToAddress(h.providerAddress))
-				if err != nil {
-					h.log.Error("balance re-check", zap.String("wallet", wallet), zap.Error(err))
-					c.JSON(http.StatusBadGateway, gin.H{"error": "balance check failed"})
+				if err != nil && h.preflightFailed(c, "balance check", wallet, err) {
 					return
 				}
-				available = availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
+				if checked = err == nil; checked {
+					available = availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
+				}
 			}
 		}
-		if available.Cmp(createRequired) < 0 {
-			c.JSON(http.StatusPaymentRequired, gin.H{
-				"error":     "insufficient balance",
-				"available": available.String(),
-				"required":  createRequired.String(),
-			})
+		if checked && available.Cmp(createRequired) < 0 {
+			h.rejectInsufficientBalance(c, balance, available, h.createFee, computeCost)
 			return
 		}
 		// Reserve the cost to prevent concurrent requests from double-spending.
@@ -317,6 +379,16 @@ func (h *Handler) handleCreate(c *gin.Context) {
 		}
 	}
 
+	// Count the creation against the wallet's quota last, so requests rejected
+	// by the checks above do not use it up.
+	quotaKey, ok := h.takeCreateQuota(c, wallet)
+	if !ok {
+		if createReserved {
+			billing.Release(c.Request.Context(), h.rdb, wallet, h.providerAddress, createRequired)
+		}
+		return
+	}
+
 	c.Request.Body = io.NopCloser(bytes.NewReader(modified))
 	c.Request.ContentLength = int64(len(modified))
 
@@ -344,6 +416,19 @@ func (h *Handler) handleCreate(c *gin.Context) {
 			respBytes = stripped
 		}
 	}
+	if result.StatusCode >= 200 && result.StatusCode < 300 {
+		if !h.startCreateBilling(c, upstream.Body.Bytes(), respBytes, wallet, createReserved, createRequired) {
+			return
+		}
+		respBytes = h.transformResponse(RouteCreate, respBytes)
+	} else {
+		// Daytona returned an error — release reservation and quota immediately.
+		if createReserved {
+			billing.Release(c.Request.Context(), h.rdb, wallet, h.providerAddress, createRequired)
+		}
+		h.refundCreateQuota(c.Request.Context(), quotaKey)
+	}
+
 	for k, vs := range result.Header {
 		if strings.EqualFold(k, "Content-Length") {
 			continue // recomputed below from actual body length
@@ -355,30 +440,60 @@ func (h *Handler) handleCreate(c *gin.Context) {
 	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(respBytes)))
 	c.Writer.WriteHeader(result.StatusCode)
 	c.Writer.Write(respBytes) //nolint:errcheck
+}
 
-	if result.StatusCode >= 200 && result.StatusCode < 300 {
-		if id := extractID(upstream.Body.Bytes()); id != "" {
-			cpu, memGB := extractResources(upstream.Body.Bytes())
-			go func() {
-				ctx := context.WithoutCancel(c.Request.Context())
-				// Register the real sandbox ID with the broker for ongoing
-				// balance monitoring.
-				if h.broker != nil {
-					if berr := h.broker.registerSession(ctx, id, wallet, int64(cpu), int64(memGB)); berr != nil {
-						h.log.Warn("broker post-create register", zap.String("id", id), zap.Error(berr))
-					}
-				}
-				h.billing.OnCreate(ctx, id, wallet, cpu, memGB)
-				// OnCreate enqueues vouchers; reservation released there.
-			}()
-		} else if createReserved {
+// startCreateBilling opens billing for a sandbox Daytona has just created.
+// It runs before the client is answered so that a failure to queue the
+// opening vouchers is reported (503 BILLING_INIT_FAILED; the sandbox is being
+// stopped) rather than leaving the sandbox running unbilled. Reports whether
+// the upstream response should still be written.
+func (h *Handler) startCreateBilling(c *gin.Context, body, respBytes []byte, wallet string, reserved bool, reservedAmount *big.Int) bool {
+	id, sandbox := extractCreated(body, h.createIDPaths)
+	if id == "" {
+		h.log.Warn("create: no sandbox ID in Daytona response — billing not started",
+			zap.String("wallet", wallet),
+			zap.Strings("id_paths", h.createIDPaths),
+			zap.String("body", truncateForLog(respBytes, maxLoggedBody)),
+		)
+		if reserved {
 			// 2xx but no sandbox ID extracted — release reservation immediately.
-			billing.Release(c.Request.Context(), h.rdb, wallet, h.providerAddress, createRequired)
+			billing.Release(c.Request.Context(), h.rdb, wallet, h.providerAddress, reservedAmount)
 		}
-	} else if createReserved {
-		// Daytona returned an error — release reservation immediately.
-		billing.Release(c.Request.Context(), h.rdb, wallet, h.providerAddress, createRequired)
+		return true
+	}
+
+	// The sandbox now exists upstream; a panic from here on stops it.
+	c.Set(runningSandboxKey, id)
+	cpu, memGB := extractResources(sandbox)
+	labels := extractLabels(sandbox)
+	ctx := context.WithoutCancel(c.Request.Context())
+	if err := h.billing.OnCreate(ctx, id, wallet, cpu, memGB, labels); err != nil {
+		// OnCreate has scheduled a stop; nothing will be charged against
+		// the reservation.
+		if reserved {
+			billing.Release(ctx, h.rdb, wallet, h.providerAddress, reservedAmount)
+		}
+		h.log.Error("create: billing could not start — sandbox is being stopped",
+			zap.String("id", id), zap.String("wallet", wallet), zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":      "sandbox created but billing could not start; it is being stopped",
+			"code":       "BILLING_INIT_FAILED",
+			"sandbox_id": id,
+		})
+		return false
 	}
+	// OnCreate enqueues vouchers; reservation released there.
+
+	// Register the real sandbox ID with the broker for ongoing balance
+	// monitoring.
+	if h.broker != nil {
+		go func() {
+			if berr := h.broker.registerSession(ctx, id, wallet, int64(cpu), int64(memGB)); berr != nil {
+				h.log.Warn("broker post-create register", zap.String("id", id), zap.Error(berr))
+			}
+		}()
+	}
+	return true
 }
 
 // ── Lifecycle ───────────────────────────────────────────────────────────────
@@ -389,15 +504,25 @@ func (h *Handler) handleStart(c *gin.Context) {
 	id := c.Param("id")
 	wallet := c.GetString("wallet_address")
 
+	slot, ok := h.reserveSandboxSlot(c, wallet, id)
+	if !ok {
+		return
+	}
+	// Held until OnStart has opened the session, or the start fails.
+	releaseSlot := true
+	defer func() {
+		if releaseSlot {
+			h.releaseSandboxSlot(context.WithoutCancel(c.Request.Context()), wallet, slot)
+		}
+	}()
+
 	// Pre-check: reject if user has not acknowledged the TEE signer.
 	if h.ackCheck != nil {
 		acked, err := h.ackCheck.IsAcknowledged(c.Request.Context(), common.HexToAddress(wallet))
-		if err != nil {
-			h.log.Error("ack check", zap.String("wallet", wallet), zap.Error(err))
-			c.JSON(http.StatusBadGateway, gin.H{"error": "acknowledgement check failed"})
+		if err != nil && h.preflightFailed(c, "acknowledgement check", wallet, err) {
 			return
 		}
-		if !acked {
+		if err == nil && !acked {
 			c.JSON(http.StatusPaymentRequired, gin.H{"error": "TEE signer not acknowledged"})
 			return
 		}
@@ -417,35 +542,33 @@ func (h *Handler) handleStart(c *gin.Context) {
 	if h.balCheck != nil {
 		startRequired = h.intervalCost(cpu, memGB)
 		balance, err := h.balCheck.GetBalance(c.Request.Context(), common.HexToAddress(wallet), common.HexToAddress(h.providerAddress))
-		if err != nil {
-			h.log.Error("balance check (start)", zap.String("wallet", wallet), zap.Error(err))
-			c.JSON(http.StatusBadGateway, gin.H{"error": "balance check failed"})
+		if err != nil && h.preflightFailed(c, "balance check", wallet, err) {
 			return
 		}
-		available := availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
-		if available.Cmp(startRequired) < 0 && h.broker != nil {
+		checked := err == nil
+		var available *big.Int
+		if checked {
+			available = availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
+		}
+		if checked && available.Cmp(startRequired) < 0 && h.broker != nil {
 			if berr := h.broker.registerSession(c.Request.Context(), id, wallet, int64(cpu), int64(memGB)); berr != nil {
 				h.log.Warn("broker pre-start fund", zap.String("id", id), zap.Error(berr))
 			} else {
 				// Re-check balance after broker waited for deposit.
 				balance, err = h.balCheck.GetBalance(c.Request.Context(), common.HexToAddress(wallet), common.HexToAddress(h.providerAddress))
-				if err != nil {
-					h.log.Error("balance re-check (start)", zap.String("wallet", wallet), zap.Error(err))
-					c.JSON(http.StatusBadGateway, gin.H{"error": "balance check failed"})
+				if err != nil && h.preflightFailed(c, "balance check", wallet, err) {
 					return
 				}
-				available = availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
+				if checked = err == nil; checked {
+					available = availableBalance(balance, billing.GetReserved(c.Request.Context(), h.rdb, wallet, h.providerAddress))
+				}
 			}
 		} else if h.broker != nil {
-			// Balance sufficient: register for monitoring only (non-blocking).
+			// Balance sufficient or unknown: register for monitoring only (non-blocking).
 			go h.broker.registerSession(context.WithoutCancel(c.Request.Context()), id, wallet, int64(cpu), int64(memGB))
 		}
-		if available.Cmp(startRequired) < 0 {
-			c.JSON(http.StatusPaymentRequired, gin.H{
-				"error":     "insufficient balance",
-				"available": available.String(),
-				"required":  startRequired.String(),
-			})
+		if checked && available.Cmp(startRequired) < 0 {
+			h.rejectInsufficientBalance(c, balance, available, new(big.Int), startRequired)
 			return
 		}
 		ttl := time.Duration(h.voucherIntervalSec*2) * time.Second
@@ -458,15 +581,18 @@ func (h *Handler) handleStart(c *gin.Context) {
 
 	h.rp.ServeHTTP(safeWriter{c.Writer}, c.Request)
 	if c.Writer.Status() >= 200 && c.Writer.Status() < 300 {
-		go func() {
-			ctx := context.WithoutCancel(c.Request.Context())
+		releaseSlot = false
+		ctx := context.WithoutCancel(c.Request.Context())
+		h.goStopOnPanic(ctx, id, func() {
+			defer h.releaseSandboxSlot(ctx, wallet, slot)
 			cpu, memGB := 0, 0
+			var labels map[string]string
 			if sb, err := h.dtona.GetSandbox(ctx, id); err == nil {
-				cpu, memGB = sb.CPU, sb.Memory
+				cpu, memGB, labels = sb.CPU, sb.Memory, sb.Labels
 			}
-			h.billing.OnStart(ctx, id, wallet, cpu, memGB)
+			h.billing.OnStart(ctx, id, wallet, cpu, memGB, labels)
 			// OnStart enqueues voucher; reservation released there.
-		}()
+		})
 	} else if startReserved {
 		billing.Release(c.Request.Context(), h.rdb, wallet, h.providerAddress, startRequired)
 	}
@@ -488,20 +614,39 @@ func (h *Handler) handleStop(c *gin.Context) {
 	}
 }
 
+// handleDelete forwards DELETE /sandbox/:id and closes billing in the
+// background. With ?wait=true it instead waits for the final settlement (see
+// handleDeleteWait).
 func (h *Handler) handleDelete(c *gin.Context) {
 	id := c.Param("id")
+	wait, err := parseWait(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wait (want true or false)"})
+		return
+	}
+	if wait {
+		h.handleDeleteWait(c, id)
+		return
+	}
 	h.rp.ServeHTTP(safeWriter{c.Writer}, c.Request)
 	if c.Writer.Status() >= 200 && c.Writer.Status() < 300 {
 		ctx := context.WithoutCancel(c.Request.Context())
 		go h.billing.OnDelete(ctx, id)
-		if h.broker != nil {
-			go func() {
-				if berr := h.broker.deregisterSession(ctx, id); berr != nil {
-					h.log.Warn("broker deregister (delete)", zap.String("id", id), zap.Error(berr))
-				}
-			}()
-		}
+		h.deregisterDeleted(ctx, id)
+	}
+}
+
+// deregisterDeleted removes a deleted sandbox from broker monitoring in the
+// background. No-op if broker is disabled.
+func (h *Handler) deregisterDeleted(ctx context.Context, id string) {
+	if h.broker == nil {
+		return
 	}
+	go func() {
+		if berr := h.broker.deregisterSession(ctx, id); berr != nil {
+			h.log.Warn("broker deregister (delete)", zap.String("id", id), zap.Error(berr))
+		}
+	}()
 }
 
 func (h *Handler) handleArchive(c *gin.Context) {
@@ -523,6 +668,33 @@ func (h *Handler) handleEnsureBilling(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
+// handleBillingPause returns the handler for POST /sandbox/:id/billing/pause
+// (pause=true) or /resume. The sandbox keeps running either way; while
+// paused no compute periods are charged.
+func (h *Handler) handleBillingPause(pause bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		fn := h.billing.ResumeBilling
+		if pause {
+			fn = h.billing.PauseBilling
+		}
+		if err := fn(c.Request.Context(), id); err != nil {
+			if errors.Is(err, billing.ErrNoSession) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no billing session for sandbox", "code": "NO_BILLING_SESSION"})
+				return
+			}
+			if errors.Is(err, billing.ErrPauseLimit) {
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "billing pause limit reached for this sandbox", "code": "PAUSE_LIMIT"})
+				return
+			}
+			h.log.Error("billing pause/resume", zap.String("id", id), zap.Bool("pause", pause), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sandbox_id": id, "billing_paused": pause})
+	}
+}
+
 // handleSSHAccess creates a temporary SSH access token for a sandbox and
 // returns the sshCommand with the gateway host rewritten if configured.
 // Sealed sandboxes are rejected — SSH is an external access channel.
@@ -614,9 +786,9 @@ func (h *Handler) handleForceDelete(c *gin.Context) {
 		return
 	}
 	id := c.Param("id")
-	// Rewrite to DELETE /api/sandbox/:id and forward
+	// Rewrite to DELETE <prefix>/sandbox/:id and forward
 	c.Request.Method = http.MethodDelete
-	c.Request.URL.Path = "/api/sandbox/" + id
+	c.Request.URL.Path = h.dtona.APIPrefix() + "/sandbox/" + id
 	h.rp.ServeHTTP(safeWriter{c.Writer}, c.Request)
 	if c.Writer.Status() >= 200 && c.Writer.Status() < 300 {
 		go h.billing.OnDelete(context.WithoutCancel(c.Request.Context()), id)
@@ -690,6 +862,10 @@ func (h *Handler) handleAuditLog(c *gin.Context) {
 // Accepts optional ?from_block=<n> query param; defaults to last ~50k blocks.
 // Chain data is public so no provider restriction is applied.
 func (h *Handler) handleEvents(c *gin.Context) {
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		h.handleEventStream(c)
+		return
+	}
 	if h.eventFetcher == nil {
 		c.JSON(http.StatusNotImplemented, gin.H{"error": "events not configured"})
 		return
@@ -811,6 +987,216 @@ func (h *Handler) handleSessions(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// sandboxSlotTTL bounds a slot held for a create or start in flight if the
+// process dies before releasing it; creation can take 30-90 s on first pull.
+const sandboxSlotTTL = 10 * time.Minute
+
+// reserveSandboxSlot enforces the per-wallet running-sandbox limit. The running set is
+// maintained by the billing session lifecycle (create/start add, stop/delete/
+// archive remove). sandboxID, when already running, is exempt so a repeated
+// start is not rejected. Otherwise a slot is held atomically until the caller
+// passes the returned token to releaseSandboxSlot, once billing has opened the
+// session or the request failed, so concurrent requests cannot overshoot the
+// limit. Writes 429 and returns ok=false when over the limit. The token is
+// empty when nothing was held (limit disabled, exempt, or Redis unavailable —
+// the request is then allowed).
+func (h *Handler) reserveSandboxSlot(c *gin.Context, wallet, sandboxID string) (token string, ok bool) {
+	if h.sandboxLimit <= 0 || h.rdb == nil {
+		return "", true
+	}
+	running, err := billing.OwnerSandboxes(c.Request.Context(), h.rdb, wallet)
+	if err != nil {
+		h.log.Warn("sandbox limit: read running set (allowing)", zap.String("wallet", wallet), zap.Error(err))
+		return "", true
+	}
+	for _, id := range running {
+		if sandboxID != "" && id == sandboxID {
+			return "", true
+		}
+	}
+	token, used, err := billing.ReserveSandboxSlot(c.Request.Context(), h.rdb, wallet, h.sandboxLimit,
+		clock.OrReal(h.clock).Now(), sandboxSlotTTL)
+	if err != nil {
+		h.log.Warn("sandbox limit: hold slot (allowing)", zap.String("wallet", wallet), zap.Error(err))
+		return "", true
+	}
+	if token == "" {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "sandbox limit reached",
+			"code":    "SANDBOX_LIMIT",
+			"running": used,
+			"limit":   h.sandboxLimit,
+		})
+		return "", false
+	}
+	return token, true
+}
+
+// releaseSandboxSlot frees a slot held by reserveSandboxSlot.
+func (h *Handler) releaseSandboxSlot(ctx context.Context, wallet, token string) {
+	if token != "" {
+		billing.ReleaseSandboxSlot(ctx, h.rdb, wallet, token)
+	}
+}
+
+// handleSandboxBilling returns the sandbox's billing session, its latest
+// settlement result, whether a stop (e.g. insufficient balance) is pending and,
+// for a sandbox that is not billing, why it was last stopped automatically,
+// along with its settled lifetime cost and its audit timeline of lifecycle
+// events and settlements. 404 when there is no session, settlement receipt,
+// stop record or audit entry.
+func (h *Handler) handleSandboxBilling(c *gin.Context) {
+	id := c.Param("id")
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "billing state unavailable"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	sess, err := billing.GetSession(ctx, h.rdb, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	receipt, err := settler.GetReceipt(ctx, h.rdb, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var stopped *settler.StopRecord
+	if sess == nil {
+		if stopped, err = settler.GetStopRecord(ctx, h.rdb, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	audit, err := settler.ListAudit(ctx, h.rdb, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sess == nil && receipt == nil && stopped == nil && len(audit) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no billing record for sandbox"})
+		return
+	}
+	stopReason, err := h.rdb.Get(ctx, settler.StopKey(id)).Result()
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cost, err := settler.SandboxCost(ctx, h.rdb, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var lastSettlement *receiptView
+	if receipt != nil {
+		lastSettlement = &receiptView{Receipt: *receipt, TotalFeeOG: h.og(receipt.TotalFee)}
+	}
+	resp := gin.H{
+		"sandbox_id":       id,
+		"billing_active":   sess != nil && stopReason == "",
+		"stop_pending":     stopReason != "",
+		"last_settlement":  lastSettlement,
+		"lifetime_cost":    cost,
+		"lifetime_cost_0g": h.og(cost),
+		"audit":            audit,
+	}
+	if stopReason != "" {
+		resp["stop_reason"] = stopReason
+		resp["stop_message"] = settler.StopReason(stopReason).UserMessage()
+	}
+	if stopped != nil {
+		resp["last_stop"] = stopped
+	}
+	if sess != nil {
+		resp["session"] = gin.H{
+			"started_at":       sess.StartedAt,
+			"last_voucher_at":  sess.LastVoucherAt,
+			"next_voucher_at":  sess.NextVoucherAt,
+			"accrued_fee":      sess.AccruedFee,
+			"accrued_fee_0g":   h.og(sess.AccruedFee),
+			"price_per_sec":    sess.PricePerSec,
+			"price_per_sec_0g": h.og(sess.PricePerSec),
+			"rate_cpu_per_sec": sess.RateCPUPerSec,
+			"rate_mem_per_sec": sess.RateMemPerSec,
+			"signer_version":   sess.SignerVersion,
+			"labels":           sess.Labels,
+			"paused_at":        sess.PausedAt,
+			"paused_sec":       sess.PausedSec,
+			"low_balance_at":   sess.LowBalanceAt,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleSandboxSettlements returns the sandbox's retained settlement receipts,
+// newest first, each annotated with the user labels echoed at billing time.
+// Optional query param ?limit=N caps the number returned.
+func (h *Handler) handleSandboxSettlements(c *gin.Context) {
+	id := c.Param("id")
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "billing state unavailable"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	receipts, err := settler.ListReceipts(c.Request.Context(), h.rdb, id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sandbox_id": id, "settlements": h.receiptViews(receipts)})
+}
+
+// handleSandboxPending returns the sandbox's vouchers that are queued but not
+// yet settled, oldest first, with the total still to be charged.
+func (h *Handler) handleSandboxPending(c *gin.Context) {
+	id := c.Param("id")
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "billing state unavailable"})
+		return
+	}
+	pending, err := billing.ListPending(c.Request.Context(), h.rdb, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total := new(big.Int)
+	views := make([]pendingView, len(pending))
+	for i, p := range pending {
+		if fee, ok := new(big.Int).SetString(p.TotalFee, 10); ok {
+			total.Add(total, fee)
+		}
+		views[i] = pendingView{PendingVoucher: p, TotalFeeOG: h.og(p.TotalFee)}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sandbox_id":   id,
+		"pending":      views,
+		"total_fee":    total.String(),
+		"total_fee_0g": h.og(total.String()),
+	})
+}
+
+// handleAccount returns the caller's running-sandbox count and limit.
+func (h *Handler) handleAccount(c *gin.Context) {
+	wallet := c.GetString("wallet_address")
+	running := 0
+	if h.rdb != nil {
+		ids, err := billing.OwnerSandboxes(c.Request.Context(), h.rdb, wallet)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		running = len(ids)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"wallet":            wallet,
+		"running_sandboxes": running,
+		"max_sandboxes":     h.sandboxLimit, // 0 = unlimited
+	})
+}
+
 // ── Labels ──────────────────────────────────────────────────────────────────
 
 func (h *Handler) handleLabels(c *gin.Context) {
@@ -827,9 +1213,12 @@ func (h *Handler) handleLabels(c *gin.Context) {
 
 // ── List ────────────────────────────────────────────────────────────────────
 
+// handleList lists the caller's sandboxes. The query string (Daytona's own
+// filters, e.g. labels) is passed upstream unchanged; the owner filter is
+// applied to whatever Daytona returns.
 func (h *Handler) handleList(c *gin.Context) {
 	wallet := c.GetString("wallet_address")
-	sandboxes, err := h.dtona.ListSandboxes(c.Request.Context())
+	sandboxes, err := h.dtona.ListSandboxesQuery(c.Request.Context(), c.Request.URL.RawQuery)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "upstream error"})
 		return
@@ -837,10 +1226,20 @@ func (h *Handler) handleList(c *gin.Context) {
 	var filtered []daytona.Sandbox
 	for _, s := range sandboxes {
 		if strings.EqualFold(s.Labels[ownerLabel], wallet) {
+			delete(s.Labels, ownerLabel) // internal ownership record
 			filtered = append(filtered, s)
 		}
 	}
-	c.JSON(http.StatusOK, filtered)
+	if !h.hasTransforms(RouteList) {
+		c.JSON(http.StatusOK, filtered)
+		return
+	}
+	body, err := json.Marshal(filtered)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "encode response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.transformResponse(RouteList, body))
 }
 
 func (h *Handler) handleListGeneric(_ string) gin.HandlerFunc {
@@ -1009,12 +1408,6 @@ func (h *Handler) handleCatchAll(c *gin.Context) {
 	action := c.Param("action") // e.g. "/start", "/stop", "/autostop", "/labels"
 	method := c.Request.Method
 
-	// ── Blocked actions ────────────────────────────────────────────────────
-	if action == "/autostop" || action == "/autoarchive" {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "managed by billing proxy"})
-		return
-	}
-
 	// ── Lifecycle with billing hooks ───────────────────────────────────────
 	switch {
 	case method == http.MethodPost && action == "/start":
@@ -1025,6 +1418,16 @@ func (h *Handler) handleCatchAll(c *gin.Context) {
 		h.withOwner(h.handleArchive)(c)
 	case method == http.MethodPost && action == "/ensure-billing":
 		h.withOwner(h.handleEnsureBilling)(c)
+	case method == http.MethodGet && action == "/billing":
+		h.withOwner(h.handleSandboxBilling)(c)
+	case method == http.MethodPost && action == "/billing/pause":
+		h.withOwner(h.handleBillingPause(true))(c)
+	case method == http.MethodPost && action == "/billing/resume":
+		h.withOwner(h.handleBillingPause(false))(c)
+	case method == http.MethodGet && action == "/settlements":
+		h.withOwner(h.handleSandboxSettlements)(c)
+	case method == http.MethodGet && action == "/pending":
+		h.withOwner(h.handleSandboxPending)(c)
 	case method == http.MethodPost && action == "/ssh-access":
 		h.withOwner(h.handleSSHAccess)(c)
 	case method == http.MethodDelete && action == "/force":
@@ -1036,9 +1439,27 @@ func (h *Handler) handleCatchAll(c *gin.Context) {
 	case method == http.MethodPut && action == "/labels":
 		h.withOwner(h.handleLabels)(c)
 
-	// ── Transparent proxy (owner check) ───────────────────────────────────
+	// ── Transparent proxy (forward policy + owner check) ──────────────────
+	case method == http.MethodGet && strings.HasPrefix(action, "/ports/") && h.hasTransforms(RoutePorts):
+		h.policed(h.withOwner(h.forwardTransformed(RoutePorts)))(c)
 	default:
-		h.withOwner(h.forward)(c)
+		h.policed(h.withOwner(h.forward))(c)
+	}
+}
+
+// policed wraps a forwarding handler with the forward policy: denied paths
+// (e.g. autostop/autoarchive) get 403, paths not on the allowlist get 404.
+func (h *Handler) policed(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := strings.TrimPrefix(c.Request.URL.Path, h.dtona.APIPrefix())
+		switch h.fwdPolicy.decide(c.Request.Method, path) {
+		case forwardDenied:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "managed by billing proxy"})
+		case forwardUnlisted:
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+		default:
+			next(c)
+		}
 	}
 }
 
@@ -1061,7 +1482,7 @@ func (h *Handler) withOwnerNotSealed(next gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		wallet := c.GetString("wallet_address")
-		sb, err := h.dtona.GetSandbox(c.Request.Context(), id)
+		sb, err := fetchSandbox(c.Request.Context(), h.dtona, id)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
@@ -1084,6 +1505,43 @@ func (h *Handler) forward(c *gin.Context) {
 	h.rp.ServeHTTP(safeWriter{c.Writer}, c.Request)
 }
 
+// forwardStripOwner forwards a single-sandbox GET and removes the
+// daytona-owner label from a successful response. The upstream body is
+// otherwise returned as-is; one that cannot be parsed is passed through.
+func (h *Handler) forwardStripOwner(c *gin.Context) {
+	// Ask for an identity-encoded body so it can be rewritten.
+	req := c.Request.Clone(c.Request.Context())
+	req.Header.Del("Accept-Encoding")
+	rec := httptest.NewRecorder()
+	h.rp.ServeHTTP(rec, req)
+	if rec.Code >= 200 && rec.Code < 300 {
+		body := rec.Body.Bytes()
+		if stripped, err := stripOwnerFromResponse(body); err == nil {
+			body = stripped
+		}
+		body = h.transformResponse(RouteGet, body)
+		rec.Body = bytes.NewBuffer(body)
+		rec.Header().Del("Content-Length")
+	}
+	copyRecorder(c, rec)
+}
+
+// forwardTransformed forwards like forward but buffers the response so that
+// route's transforms can rewrite a 2xx body.
+func (h *Handler) forwardTransformed(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := c.Request.Clone(c.Request.Context())
+		req.Header.Del("Accept-Encoding")
+		rec := httptest.NewRecorder()
+		h.rp.ServeHTTP(rec, req)
+		if rec.Code >= 200 && rec.Code < 300 {
+			rec.Body = bytes.NewBuffer(h.transformResponse(route, rec.Body.Bytes()))
+			rec.Header().Del("Content-Length")
+		}
+		copyRecorder(c, rec)
+	}
+}
+
 // safeWriter wraps gin.ResponseWriter and overrides CloseNotify so that the
 // reverse proxy never triggers a type-assertion on the underlying writer.
 // gin.ResponseWriter implements the deprecated http.CloseNotifier, but the
@@ -1110,26 +1568,34 @@ func (h *Handler) intervalCost(cpu, memGB int) *big.Int {
 	return new(big.Int).Mul(h.computePricePerSec, interval)
 }
 
-// extractID tries to parse {"id": "..."} from a JSON response body.
-func extractID(body []byte) string {
+// extractResources parses cpu and memory from a Daytona sandbox JSON object:
+// a create request or the created sandbox. They are read from the top level
+// or, failing that, from a nested "resources" object as the Daytona SDKs send
+// them. Returns (0, 0) if parsing fails; callers fall back to flat-rate billing.
+func extractResources(body []byte) (cpu, memGB int) {
+	type resources struct {
+		CPU    int `json:"cpu"`
+		Memory int `json:"memory"`
+	}
 	var m struct {
-		ID string `json:"id"`
+		resources
+		Resources resources `json:"resources"`
 	}
-	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&m); err == nil {
-		return m.ID
+	json.NewDecoder(bytes.NewReader(body)).Decode(&m) //nolint:errcheck
+	if m.CPU == 0 && m.Memory == 0 {
+		return m.Resources.CPU, m.Resources.Memory
 	}
-	return ""
+	return m.CPU, m.Memory
 }
 
-// extractResources parses cpu and memory from a Daytona sandbox JSON response.
-// Returns (0, 0) if parsing fails; callers fall back to flat-rate billing.
-func extractResources(body []byte) (cpu, memGB int) {
+// extractLabels parses the labels map from a Daytona sandbox JSON object.
+// It includes internal labels; billing filters them out.
+func extractLabels(body []byte) map[string]string {
 	var m struct {
-		CPU    int `json:"cpu"`
-		Memory int `json:"memory"`
+		Labels map[string]string `json:"labels"`
 	}
 	json.NewDecoder(bytes.NewReader(body)).Decode(&m) //nolint:errcheck
-	return m.CPU, m.Memory
+	return m.Labels
 }
 
 // availableBalance returns chainBalance - reserved, floored at zero.
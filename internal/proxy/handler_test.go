@@ -4,16 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
 	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
 )
 
 func init() { gin.SetMode(gin.TestMode) }
@@ -21,21 +29,32 @@ func init() { gin.SetMode(gin.TestMode) }
 // ── Mock billing hooks ────────────────────────────────────────────────────────
 
 type mockBilling struct {
-	mu       sync.Mutex
-	creates  []string
-	starts   []string
-	stops    []string
-	deletes  []string
-	archives []string
+	mu        sync.Mutex
+	creates   []string
+	starts    []string
+	stops     []string
+	deletes   []string
+	archives  []string
+	createErr error
+	panicOn   string // OnCreate and OnStart panic for this sandbox ID
+	paused    map[string]bool
+	pauseErr  error // PauseBilling's error for a sandbox with a session
 }
 
-func (m *mockBilling) OnCreate(_ context.Context, sandboxID, _ string, _, _ int) {
+func (m *mockBilling) OnCreate(_ context.Context, sandboxID, _ string, _, _ int, _ map[string]string) error {
 	m.mu.Lock(); defer m.mu.Unlock()
 	m.creates = append(m.creates, sandboxID)
+	if sandboxID == m.panicOn {
+		panic("billing exploded")
+	}
+	return m.createErr
 }
-func (m *mockBilling) OnStart(_ context.Context, sandboxID, _ string, _, _ int) {
+func (m *mockBilling) OnStart(_ context.Context, sandboxID, _ string, _, _ int, _ map[string]string) {
 	m.mu.Lock(); defer m.mu.Unlock()
 	m.starts = append(m.starts, sandboxID)
+	if sandboxID == m.panicOn {
+		panic("billing exploded")
+	}
 }
 func (m *mockBilling) OnStop(_ context.Context, sandboxID string) {
 	m.mu.Lock(); defer m.mu.Unlock()
@@ -50,6 +69,23 @@ func (m *mockBilling) OnArchive(_ context.Context, sandboxID string) {
 	m.archives = append(m.archives, sandboxID)
 }
 func (m *mockBilling) EnsureSession(_ context.Context, _, _ string) {}
+func (m *mockBilling) PauseBilling(_ context.Context, sandboxID string) error {
+	if _, ok := m.paused[sandboxID]; ok && m.pauseErr != nil {
+		return m.pauseErr
+	}
+	return m.setPaused(sandboxID, true)
+}
+func (m *mockBilling) ResumeBilling(_ context.Context, sandboxID string) error {
+	return m.setPaused(sandboxID, false)
+}
+func (m *mockBilling) setPaused(sandboxID string, paused bool) error {
+	m.mu.Lock(); defer m.mu.Unlock()
+	if _, ok := m.paused[sandboxID]; !ok {
+		return billing.ErrNoSession
+	}
+	m.paused[sandboxID] = paused
+	return nil
+}
 
 // ── Mock Daytona server helpers ───────────────────────────────────────────────
 
@@ -117,7 +153,7 @@ func newTestEngine(dtona *daytona.Client, bh BillingHooks, wallet string) *gin.E
 		c.Set("wallet_address", wallet)
 		c.Next()
 	})
-	NewHandler(dtona, bh, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0).Register(api)
+	NewHandler(dtona, bh, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0, 0, nil).Register(api)
 	return r
 }
 
@@ -130,7 +166,9 @@ func TestBlockedEndpoints(t *testing.T) {
 
 	for _, path := range []string{
 		"/api/sandbox/sb-1/autostop",
+		"/api/sandbox/sb-1/autostop/60",
 		"/api/sandbox/sb-1/autoarchive",
+		"/api/sandbox/sb-1/autoarchive/1440",
 	} {
 		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
 			req := httptest.NewRequest(method, path, nil)
@@ -143,6 +181,52 @@ func TestBlockedEndpoints(t *testing.T) {
 	}
 }
 
+// ── Forward policy ────────────────────────────────────────────────────────────
+
+func TestForwardPolicy_UnlistedPathRejected(t *testing.T) {
+	sb := daytona.Sandbox{ID: "sb-1", Labels: map[string]string{ownerLabel: "0xWALLET"}}
+	srv, captured := mockDaytona(t, []daytona.Sandbox{sb})
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), &mockBilling{}, "0xWALLET")
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPost, "/api/sandbox/sb-1/resize"},
+		{http.MethodPut, "/api/sandbox/sb-1/public/true"},
+		{http.MethodPost, "/api/sandbox/sb-1/ports/3000"}, // only GET is allowed
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", tc.method, tc.path, w.Code)
+		}
+	}
+	if len(*captured) != 0 {
+		t.Errorf("unlisted requests must not reach Daytona, got %d", len(*captured))
+	}
+}
+
+func TestForwardPolicy_AllowedPathForwarded(t *testing.T) {
+	var forwarded []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/sandbox/sb-1" { // owner check
+			json.NewEncoder(w).Encode(daytona.Sandbox{ID: "sb-1", Labels: map[string]string{ownerLabel: "0xWALLET"}})
+			return
+		}
+		forwarded = append(forwarded, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), &mockBilling{}, "0xWALLET")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-1/ports/3000/preview-url", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	if len(forwarded) != 1 || forwarded[0] != "GET /api/sandbox/sb-1/ports/3000/preview-url" {
+		t.Errorf("forwarded: got %v", forwarded)
+	}
+}
+
 // ── Create: owner injection ───────────────────────────────────────────────────
 
 func TestHandleCreate_InjectsOwnerLabel(t *testing.T) {
@@ -173,6 +257,27 @@ func TestHandleCreate_InjectsOwnerLabel(t *testing.T) {
 	}
 }
 
+func TestHandleCreate_BillingInitFailed_Returns503(t *testing.T) {
+	srv, _ := mockDaytona(t, nil)
+	dtona := daytona.NewClient(srv.URL, "test-key")
+	mb := &mockBilling{createErr: errors.New("billing initialisation failed: redis down")}
+	r := newTestEngine(dtona, mb, "0xMYWALLET")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["code"] != "BILLING_INIT_FAILED" || resp["sandbox_id"] != "sb-new" {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+}
+
 func TestHandleCreate_ForcesAutostopZero(t *testing.T) {
 	srv, captured := mockDaytona(t, nil)
 	dtona := daytona.NewClient(srv.URL, "test-key")
@@ -249,6 +354,118 @@ func TestHandleList_FiltersByOwner(t *testing.T) {
 	}
 }
 
+// The caller's query reaches Daytona unchanged, and the owner filter is
+// applied to what Daytona's own label filter returns.
+func TestHandleList_ForwardsQueryAndFiltersByOwner(t *testing.T) {
+	var gotQuery string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sandbox", func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		// Daytona applied labels=env=prod: only prod sandboxes, any owner.
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]daytona.Sandbox{
+			{ID: "sb-mine-prod", Labels: map[string]string{ownerLabel: "0xMYWALLET", "env": "prod"}},
+			{ID: "sb-other-prod", Labels: map[string]string{ownerLabel: "0xOTHER", "env": "prod"}},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), &mockBilling{}, "0xMYWALLET")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox?labels=env%3Dprod", nil))
+
+	if gotQuery != "labels=env%3Dprod" {
+		t.Errorf("upstream query: got %q want %q", gotQuery, "labels=env%3Dprod")
+	}
+	var result []daytona.Sandbox
+	json.Unmarshal(w.Body.Bytes(), &result) //nolint:errcheck
+	if len(result) != 1 || result[0].ID != "sb-mine-prod" {
+		t.Errorf("expected only sb-mine-prod, got %s", w.Body.String())
+	}
+}
+
+// Transparently forwarded reads keep their query string.
+func TestHandleGet_ForwardsQuery(t *testing.T) {
+	var gotQuery string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sandbox/", func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"sb-1","labels":{"daytona-owner":"0xMYWALLET"}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), &mockBilling{}, "0xMYWALLET")
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-1?verbose=true&x=a%2Fb", nil))
+
+	if gotQuery != "verbose=true&x=a%2Fb" {
+		t.Errorf("upstream query: got %q want %q", gotQuery, "verbose=true&x=a%2Fb")
+	}
+}
+
+// ── Reads: strip daytona-owner from responses ────────────────────────────────
+
+func TestHandleGet_StripsOwnerLabel(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sandbox/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"sb-1","state":"started","runnerDomain":"r1.example","labels":{"daytona-owner":"0xMYWALLET","team":"infra"}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), &mockBilling{}, "0xMYWALLET")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got struct {
+		RunnerDomain string            `json:"runnerDomain"`
+		Labels       map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v (%s)", err, w.Body.String())
+	}
+	if _, has := got.Labels[ownerLabel]; has {
+		t.Errorf("daytona-owner must not be returned: %v", got.Labels)
+	}
+	if got.Labels["team"] != "infra" {
+		t.Errorf("other labels must be kept: %v", got.Labels)
+	}
+	if got.RunnerDomain != "r1.example" {
+		t.Errorf("unknown upstream fields must pass through: %s", w.Body.String())
+	}
+}
+
+func TestHandleList_StripsOwnerLabel(t *testing.T) {
+	srv, _ := mockDaytona(t, []daytona.Sandbox{
+		{ID: "sb-1", Labels: map[string]string{ownerLabel: "0xMYWALLET", "team": "infra"}},
+	})
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), &mockBilling{}, "0xMYWALLET")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sandbox", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var result []daytona.Sandbox
+	json.Unmarshal(w.Body.Bytes(), &result) //nolint:errcheck
+	if len(result) != 1 {
+		t.Fatalf("expected 1 sandbox, got %d: %s", len(result), w.Body.String())
+	}
+	if _, has := result[0].Labels[ownerLabel]; has {
+		t.Errorf("daytona-owner must not be returned: %v", result[0].Labels)
+	}
+	if result[0].Labels["team"] != "infra" {
+		t.Errorf("other labels must be kept: %v", result[0].Labels)
+	}
+}
+
 // ── Owner check: 403 on mismatch ──────────────────────────────────────────────
 
 func TestHandleStop_OwnerCheck_Pass(t *testing.T) {
@@ -342,6 +559,130 @@ func TestHandleLabels_StripsOwnerLabel(t *testing.T) {
 	}
 }
 
+// ── Body limits ───────────────────────────────────────────────────────────────
+
+// newLimitedEngine is newTestEngine with a small JSON body limit.
+func newLimitedEngine(dtona *daytona.Client, wallet string, maxBody int64) *gin.Engine {
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", wallet)
+		c.Next()
+	})
+	h := NewHandler(dtona, &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0, 0, nil)
+	h.SetMaxBodyBytes(maxBody)
+	h.Register(api)
+	return r
+}
+
+func TestHandleCreate_BodyTooLarge(t *testing.T) {
+	srv, captured := mockDaytona(t, nil)
+	r := newLimitedEngine(daytona.NewClient(srv.URL, "key"), "0xWALLET", 64)
+
+	body := []byte(`{"name":"` + strings.Repeat("x", 100) + `"}`)
+	for _, chunked := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1 // no declared length; caught while reading
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("chunked=%v: expected 413, got %d: %s", chunked, w.Code, w.Body.String())
+		}
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp["code"] != "PAYLOAD_TOO_LARGE" {
+			t.Errorf("chunked=%v: code = %v, want PAYLOAD_TOO_LARGE", chunked, resp["code"])
+		}
+	}
+	if len(*captured) != 0 {
+		t.Errorf("oversized create must not reach Daytona, got %d requests", len(*captured))
+	}
+
+	// At the limit is still accepted.
+	req := httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{"name":"small"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("small create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleCreate_RejectsNonJSONContentType(t *testing.T) {
+	srv, captured := mockDaytona(t, nil)
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), &mockBilling{}, "0xWALLET")
+
+	for _, ct := range []string{"text/plain", "application/x-www-form-urlencoded", "multipart/form-data; boundary=x"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{}`)))
+		req.Header.Set("Content-Type", ct)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("%s: expected 415, got %d", ct, w.Code)
+		}
+	}
+	if len(*captured) != 0 {
+		t.Errorf("rejected creates must not reach Daytona, got %d requests", len(*captured))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("json with charset: expected 201, got %d", w.Code)
+	}
+}
+
+func TestHandleLabels_BodyTooLarge(t *testing.T) {
+	sb := daytona.Sandbox{ID: "sb-mine", Labels: map[string]string{ownerLabel: "0xOWNER"}}
+	srv, captured := mockDaytona(t, []daytona.Sandbox{sb})
+	r := newLimitedEngine(daytona.NewClient(srv.URL, "key"), "0xOWNER", 32)
+
+	payload := []byte(`{"env":"` + strings.Repeat("y", 64) + `"}`)
+	req := httptest.NewRequest(http.MethodPut, "/api/sandbox/sb-mine/labels", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(*captured) != 0 {
+		t.Errorf("oversized labels update must not reach Daytona, got %d requests", len(*captured))
+	}
+}
+
+// TestToolbox_BodyNotBounded checks that passthrough routes stream bodies of
+// any size and content type; the JSON limit applies only to rewritten bodies.
+func TestToolbox_BodyNotBounded(t *testing.T) {
+	var got int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/sandbox/sb-1" { // owner check
+			json.NewEncoder(w).Encode(daytona.Sandbox{ID: "sb-1", Labels: map[string]string{ownerLabel: "0xWALLET"}})
+			return
+		}
+		n, _ := io.Copy(io.Discard, r.Body)
+		got = int(n)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	r := newLimitedEngine(daytona.NewClient(srv.URL, "key"), "0xWALLET", 16)
+
+	upload := bytes.Repeat([]byte("z"), 4096)
+	req := httptest.NewRequest(http.MethodPost, "/api/toolbox/sb-1/files/upload", bytes.NewReader(upload))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got != len(upload) {
+		t.Errorf("upstream received %d bytes, want %d", got, len(upload))
+	}
+}
+
 // ── Sealed container ──────────────────────────────────────────────────────────
 
 // mockDaytonaWithSSH extends mockDaytona to also handle the ssh-access endpoint.
@@ -408,6 +749,330 @@ func TestUnsealedSandbox_SSHAllowed(t *testing.T) {
 	}
 }
 
+// ── Per-owner sandbox limit ───────────────────────────────────────────────────
+
+// newRedisEngine is newTestEngine backed by a miniredis instance, with the
+// given per-owner sandbox limit.
+func newRedisEngine(t *testing.T, dtona *daytona.Client, wallet string, limit int) (*gin.Engine, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", wallet)
+		c.Next()
+	})
+	NewHandler(dtona, &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", rdb, zap.NewNop(), "", nil, 0, limit, nil).Register(api)
+	return r, rdb
+}
+
+// sessionBilling opens a real billing session on create, so the owner's
+// running set fills up through the handler as it does in production.
+type sessionBilling struct {
+	mockBilling
+	rdb *redis.Client
+}
+
+func (m *sessionBilling) OnCreate(ctx context.Context, sandboxID, owner string, _, _ int, _ map[string]string) error {
+	return billing.CreateSession(ctx, m.rdb, billing.Session{SandboxID: sandboxID, Owner: owner})
+}
+
+func TestHandleCreate_SandboxLimitReached(t *testing.T) {
+	// Daytona holds every create until release is closed and hands out
+	// sequential IDs, so all concurrent requests are in flight together.
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	var mu sync.Mutex
+	var forwarded int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		forwarded++
+		id := forwarded
+		mu.Unlock()
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":"sb-%d"}`, id)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(unblock) // runs first, so srv.Close does not wait on held creates
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", "0xOWNER")
+		c.Next()
+	})
+	NewHandler(daytona.NewClient(srv.URL, "key"), &sessionBilling{rdb: rdb}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", rdb, zap.NewNop(), "", nil, 0, 2, nil).Register(api)
+	create := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{}`))))
+		return w
+	}
+
+	// Five concurrent creates against a limit of two: three are rejected
+	// while the other two are still being created.
+	codes := make(chan int, 5)
+	for range 5 {
+		go func() { codes <- create().Code }()
+	}
+	for range 3 {
+		select {
+		case code := <-codes:
+			if code != http.StatusTooManyRequests {
+				t.Fatalf("expected 429 while both slots are held, got %d", code)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("more creates than the limit were forwarded to Daytona")
+		}
+	}
+	unblock()
+	for range 2 {
+		if code := <-codes; code != http.StatusCreated {
+			t.Errorf("expected 201, got %d", code)
+		}
+	}
+	mu.Lock()
+	if forwarded != 2 {
+		t.Errorf("forwarded %d creates to Daytona, want 2", forwarded)
+	}
+	mu.Unlock()
+
+	// The two sandboxes now fill the running set.
+	w := create()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["code"] != "SANDBOX_LIMIT" || resp["running"] != float64(2) {
+		t.Errorf("unexpected body: %v", resp)
+	}
+
+	// Stopping one sandbox frees a slot.
+	if err := billing.DeleteSession(context.Background(), rdb, "sb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if w := create(); w.Code != http.StatusCreated {
+		t.Errorf("expected 201 after freeing a slot, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleAccount_ReportsLimit(t *testing.T) {
+	srv, _ := mockDaytona(t, nil)
+	r, rdb := newRedisEngine(t, daytona.NewClient(srv.URL, "key"), "0xOWNER", 3)
+	billing.CreateSession(context.Background(), rdb, billing.Session{SandboxID: "sb-1", Owner: "0xOWNER"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/account", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["running_sandboxes"] != float64(1) || resp["max_sandboxes"] != float64(3) {
+		t.Errorf("unexpected account response: %v", resp)
+	}
+}
+
+// ── Sandbox billing status ────────────────────────────────────────────────────
+
+func TestHandleSandboxBilling(t *testing.T) {
+	sb := daytona.Sandbox{ID: "sb-b", Labels: map[string]string{ownerLabel: "0xOWNER"}}
+	srv, _ := mockDaytona(t, []daytona.Sandbox{sb})
+	r, rdb := newRedisEngine(t, daytona.NewClient(srv.URL, "key"), "0xOWNER", 0)
+	ctx := context.Background()
+
+	get := func() (*httptest.ResponseRecorder, map[string]any) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-b/billing", nil))
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	if w, _ := get(); w.Code != http.StatusNotFound {
+		t.Fatalf("no session/receipt: expected 404, got %d", w.Code)
+	}
+
+	billing.CreateSession(ctx, rdb, billing.Session{SandboxID: "sb-b", Owner: "0xOWNER", StartedAt: 100, LastVoucherAt: 100, AccruedFee: "5000"})
+	w, resp := get()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if resp["billing_active"] != true || resp["stop_pending"] != false {
+		t.Errorf("active session: got %v", resp)
+	}
+	sess, _ := resp["session"].(map[string]any)
+	if sess["accrued_fee"] != "5000" || sess["started_at"] != float64(100) {
+		t.Errorf("session fields: got %v", sess)
+	}
+	if resp["lifetime_cost"] != "0" {
+		t.Errorf("lifetime_cost before any settlement: got %v", resp["lifetime_cost"])
+	}
+	rdb.Set(ctx, "cost:sb-b", "7000", 0)
+	if _, resp = get(); resp["lifetime_cost"] != "7000" {
+		t.Errorf("lifetime_cost: got %v", resp["lifetime_cost"])
+	}
+
+	rdb.Set(ctx, "stop:sandbox:sb-b", "insufficient_balance", 0)
+	_, resp = get()
+	if resp["billing_active"] != false || resp["stop_pending"] != true || resp["stop_reason"] != "insufficient_balance" {
+		t.Errorf("pending stop: got %v", resp)
+	}
+	if msg, _ := resp["stop_message"].(string); !strings.Contains(msg, "insufficient balance") {
+		t.Errorf("stop_message: got %q", msg)
+	}
+
+	// The stop is carried out: the session and pending stop are gone, the
+	// reason is still reported.
+	billing.DeleteSession(ctx, rdb, "sb-b")
+	rdb.Del(ctx, "stop:sandbox:sb-b")
+	settler.RecordStop(ctx, rdb, "sb-b", settler.StopInsufficientBalance, time.Unix(200, 0))
+	w, resp = get()
+	if w.Code != http.StatusOK {
+		t.Fatalf("stopped sandbox: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	last, _ := resp["last_stop"].(map[string]any)
+	if resp["billing_active"] != false || last["reason"] != "insufficient_balance" || last["stopped_at"] != float64(200) ||
+		!strings.Contains(last["message"].(string), "insufficient balance") {
+		t.Errorf("stopped sandbox: got %v", resp)
+	}
+
+	// The audit timeline is reported oldest first.
+	settler.AppendAudit(ctx, rdb, "sb-b", settler.AuditEntry{Event: settler.AuditCreated, At: 100, Fee: "5000"})
+	settler.AppendAudit(ctx, rdb, "sb-b", settler.AuditEntry{Event: settler.AuditStopped, At: 200, Fee: "5000"})
+	_, resp = get()
+	if audit, _ := resp["audit"].([]any); len(audit) != 2 || audit[0].(map[string]any)["event"] != "created" ||
+		audit[1].(map[string]any)["at"] != float64(200) {
+		t.Errorf("audit: got %v", resp["audit"])
+	}
+
+	// Restarted: billing again, the old stop is no longer reported.
+	billing.CreateSession(ctx, rdb, billing.Session{SandboxID: "sb-b", Owner: "0xOWNER"})
+	if _, resp = get(); resp["last_stop"] != nil || resp["billing_active"] != true {
+		t.Errorf("restarted sandbox: got %v", resp)
+	}
+}
+
+func TestHandleSandboxBilling_NotOwner(t *testing.T) {
+	sb := daytona.Sandbox{ID: "sb-b", Labels: map[string]string{ownerLabel: "0xOTHER"}}
+	srv, _ := mockDaytona(t, []daytona.Sandbox{sb})
+	r, _ := newRedisEngine(t, daytona.NewClient(srv.URL, "key"), "0xOWNER", 0)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-b/billing", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestHandleSandboxSettlements(t *testing.T) {
+	sb := daytona.Sandbox{ID: "sb-s", Labels: map[string]string{ownerLabel: "0xOWNER"}}
+	srv, _ := mockDaytona(t, []daytona.Sandbox{sb})
+	r, rdb := newRedisEngine(t, daytona.NewClient(srv.URL, "key"), "0xOWNER", 0)
+	ctx := context.Background()
+
+	rdb.LPush(ctx, "settle:receipts:sb-s",
+		`{"status":"success","nonce":"1","total_fee":"100","settled_at":1,"labels":{"team":"infra"}}`,
+		`{"status":"success","nonce":"2","total_fee":"100","settled_at":2,"labels":{"team":"infra"}}`)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-s/settlements?limit=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Settlements []settler.Receipt `json:"settlements"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Settlements) != 1 || resp.Settlements[0].Nonce != "2" || resp.Settlements[0].Labels["team"] != "infra" {
+		t.Errorf("settlements: got %+v", resp.Settlements)
+	}
+}
+
+func TestHandleSandboxPending(t *testing.T) {
+	sb := daytona.Sandbox{ID: "sb-p", Labels: map[string]string{ownerLabel: "0xOWNER"}}
+	srv, _ := mockDaytona(t, []daytona.Sandbox{sb})
+	r, rdb := newRedisEngine(t, daytona.NewClient(srv.URL, "key"), "0xOWNER", 0)
+	ctx := context.Background()
+
+	rdb.HSet(ctx, "pending:sb-p",
+		"0x02", `{"total_fee":"200","usage_hash":"0x02","nonce":"7","enqueued_at":20}`,
+		"0x01", `{"total_fee":"100","usage_hash":"0x01","enqueued_at":10}`)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-p/pending", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Pending    []pendingView `json:"pending"`
+		TotalFee   string        `json:"total_fee"`
+		TotalFeeOG string        `json:"total_fee_0g"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Pending) != 2 || resp.Pending[0].UsageHash != "0x01" || resp.Pending[1].Nonce != "7" || resp.TotalFee != "300" {
+		t.Errorf("pending: got %+v total %s", resp.Pending, resp.TotalFee)
+	}
+	if resp.TotalFeeOG != "0.0000000000000003" || resp.Pending[0].TotalFeeOG != "0.0000000000000001" {
+		t.Errorf("0G amounts: total %q, first %q", resp.TotalFeeOG, resp.Pending[0].TotalFeeOG)
+	}
+}
+
+func TestExtractLabels(t *testing.T) {
+	got := extractLabels([]byte(`{"id":"sb","labels":{"team":"infra","daytona-owner":"0xA"}}`))
+	if got["team"] != "infra" || len(got) != 2 {
+		t.Errorf("extractLabels: got %v", got)
+	}
+	if extractLabels([]byte(`not json`)) != nil {
+		t.Error("extractLabels: expected nil for invalid JSON")
+	}
+}
+
+func TestExtractResources_Shapes(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		cpu, memGB int
+	}{
+		{"top level", `{"cpu":2,"memory":4}`, 2, 4},
+		{"nested resources", `{"snapshot":"s","resources":{"cpu":4,"memory":8,"disk":10}}`, 4, 8},
+		{"top level wins", `{"cpu":1,"memory":2,"resources":{"cpu":4,"memory":8}}`, 1, 2},
+		{"none", `{"snapshot":"s"}`, 0, 0},
+		{"invalid", `not json`, 0, 0},
+	}
+	for _, tc := range cases {
+		if cpu, mem := extractResources([]byte(tc.body)); cpu != tc.cpu || mem != tc.memGB {
+			t.Errorf("%s: got cpu %d mem %d, want %d %d", tc.name, cpu, mem, tc.cpu, tc.memGB)
+		}
+	}
+}
+
+func TestExtractCreated_WrappedSandbox(t *testing.T) {
+	// Billing reads resources and labels from the object that holds the ID,
+	// not the top level of a wrapped response.
+	for _, body := range []string{
+		`{"data":{"id":"sb-1","cpu":2,"memory":4,"labels":{"team":"infra"}}}`,
+		`{"sandbox":{"id":"sb-1","resources":{"cpu":2,"memory":4},"labels":{"team":"infra"}}}`,
+		`{"id":"sb-1","cpu":2,"memory":4,"labels":{"team":"infra"}}`,
+	} {
+		id, sb := extractCreated([]byte(body), DefaultCreateIDPaths)
+		cpu, mem := extractResources(sb)
+		if id != "sb-1" || cpu != 2 || mem != 4 || extractLabels(sb)["team"] != "infra" {
+			t.Errorf("%s: id %q cpu %d mem %d labels %v", body, id, cpu, mem, extractLabels(sb))
+		}
+	}
+	if id, sb := extractCreated([]byte(`{"name":"box"}`), DefaultCreateIDPaths); id != "" || sb != nil {
+		t.Errorf("no id: got %q %s", id, sb)
+	}
+}
+
 // ── extractID ─────────────────────────────────────────────────────────────────
 
 func TestExtractID(t *testing.T) {
@@ -422,9 +1087,97 @@ func TestExtractID(t *testing.T) {
 		{nil, ""},
 	}
 	for _, tc := range cases {
-		got := extractID(tc.body)
+		got := extractID(tc.body, DefaultCreateIDPaths)
 		if got != tc.want {
 			t.Errorf("extractID(%q) = %q, want %q", tc.body, got, tc.want)
 		}
 	}
 }
+
+func TestExtractID_AlternativeShapes(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		paths []string
+		want  string
+	}{
+		{"camelCase", `{"sandboxId":"sb-1"}`, DefaultCreateIDPaths, "sb-1"},
+		{"snake_case", `{"sandbox_id":"sb-2"}`, DefaultCreateIDPaths, "sb-2"},
+		{"nested under data", `{"data":{"id":"sb-3","state":"started"}}`, DefaultCreateIDPaths, "sb-3"},
+		{"nested sandbox object", `{"sandbox":{"id":"sb-4"}}`, DefaultCreateIDPaths, "sb-4"},
+		{"first path wins", `{"id":"sb-top","data":{"id":"sb-nested"}}`, DefaultCreateIDPaths, "sb-top"},
+		{"empty id falls through", `{"id":"","data":{"id":"sb-5"}}`, DefaultCreateIDPaths, "sb-5"},
+		{"custom path", `{"result":{"sandbox":{"uuid":"sb-6"}}}`, []string{"result.sandbox.uuid"}, "sb-6"},
+		{"non-string id", `{"id":42}`, DefaultCreateIDPaths, ""},
+		{"path through non-object", `{"data":"sb-7"}`, []string{"data.id"}, ""},
+		{"array body", `[{"id":"sb-8"}]`, DefaultCreateIDPaths, ""},
+		{"no id found", `{"name":"box","state":"started"}`, DefaultCreateIDPaths, ""},
+	}
+	for _, tc := range cases {
+		if got := extractID([]byte(tc.body), tc.paths); got != tc.want {
+			t.Errorf("%s: extractID(%s) = %q, want %q", tc.name, tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestSetCreateIDPaths_IgnoresBlank(t *testing.T) {
+	h := &Handler{createIDPaths: DefaultCreateIDPaths}
+	h.SetCreateIDPaths([]string{""})
+	if len(h.createIDPaths) != len(DefaultCreateIDPaths) {
+		t.Errorf("blank list: got %v, want defaults", h.createIDPaths)
+	}
+	h.SetCreateIDPaths([]string{" data.uuid ", ""})
+	if len(h.createIDPaths) != 1 || h.createIDPaths[0] != "data.uuid" {
+		t.Errorf("got %v, want [data.uuid]", h.createIDPaths)
+	}
+}
+
+// ── Billing pause / resume ────────────────────────────────────────────────────
+
+func TestBillingPauseResume(t *testing.T) {
+	srv, _ := mockDaytona(t, []daytona.Sandbox{
+		{ID: "sb-1", Labels: map[string]string{ownerLabel: "0xWALLET"}},
+		{ID: "sb-2", Labels: map[string]string{ownerLabel: "0xWALLET"}},
+		{ID: "sb-other", Labels: map[string]string{ownerLabel: "0xOTHER"}},
+	})
+	bh := &mockBilling{paused: map[string]bool{"sb-1": false, "sb-other": false}}
+	r := newTestEngine(daytona.NewClient(srv.URL, "key"), bh, "0xWALLET")
+
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w
+	}
+
+	w := post("/api/sandbox/sb-1/billing/pause")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"billing_paused":true`) {
+		t.Fatalf("pause: got %d %s", w.Code, w.Body.String())
+	}
+	if !bh.paused["sb-1"] {
+		t.Error("pause: billing hook not called")
+	}
+	w = post("/api/sandbox/sb-1/billing/resume")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"billing_paused":false`) {
+		t.Fatalf("resume: got %d %s", w.Code, w.Body.String())
+	}
+	if bh.paused["sb-1"] {
+		t.Error("resume: billing hook not called")
+	}
+
+	if w = post("/api/sandbox/sb-2/billing/pause"); w.Code != http.StatusNotFound ||
+		!strings.Contains(w.Body.String(), "NO_BILLING_SESSION") {
+		t.Errorf("no session: got %d %s", w.Code, w.Body.String())
+	}
+	if w = post("/api/sandbox/sb-other/billing/pause"); w.Code != http.StatusForbidden {
+		t.Errorf("other owner: expected 403, got %d", w.Code)
+	}
+	if bh.paused["sb-other"] {
+		t.Error("other owner's billing must not be paused")
+	}
+
+	bh.pauseErr = billing.ErrPauseLimit
+	if w = post("/api/sandbox/sb-1/billing/pause"); w.Code != http.StatusTooManyRequests ||
+		!strings.Contains(w.Body.String(), "PAUSE_LIMIT") {
+		t.Errorf("pause limit: got %d %s", w.Code, w.Body.String())
+	}
+}
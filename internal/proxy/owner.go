@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"strings"
 
+	"golang.org/x/sync/singleflight"
+
 	"github.com/0gfoundation/0g-sandbox/internal/daytona"
 )
 
@@ -15,9 +17,35 @@ const (
 	imageLabel  = "0g-image"  // records image ref for TEE attestation
 )
 
-// CheckOwner fetches sandbox metadata and verifies the owner label matches walletAddr.
+// sandboxFetches coalesces concurrent ownership lookups of one sandbox, so a
+// burst of requests against it (a UI firing several at once) costs Daytona
+// one GetSandbox.
+var sandboxFetches singleflight.Group
+
+// fetchSandbox is dtona.GetSandbox, shared with every concurrent caller asking
+// for the same sandbox. The fetch outlives a caller that gives up (it is
+// bounded by the Daytona client's timeout) so one cancelled request does not
+// fail the rest of the burst. The returned Sandbox is shared: read only.
+func fetchSandbox(ctx context.Context, dtona *daytona.Client, sandboxID string) (*daytona.Sandbox, error) {
+	key := fmt.Sprintf("%p/%s", dtona, sandboxID)
+	ch := sandboxFetches.DoChan(key, func() (any, error) {
+		return dtona.GetSandbox(context.WithoutCancel(ctx), sandboxID)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*daytona.Sandbox), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// CheckOwner fetches sandbox metadata and verifies the owner label matches
+// walletAddr. Concurrent checks of the same sandbox share one fetch.
 func CheckOwner(ctx context.Context, dtona *daytona.Client, sandboxID, walletAddr string) error {
-	sb, err := dtona.GetSandbox(ctx, sandboxID)
+	sb, err := fetchSandbox(ctx, dtona, sandboxID)
 	if err != nil {
 		return fmt.Errorf("get sandbox: %w", err)
 	}
@@ -100,3 +128,32 @@ func StripOwnerLabel(body []byte) ([]byte, error) {
 	delete(m, sealedLabel) // sealed is immutable once set
 	return json.Marshal(m)
 }
+
+// stripOwnerFromResponse removes the daytona-owner label from a sandbox JSON
+// response before it is returned to the caller. The label is the proxy's
+// internal ownership record; every other field and label passes through
+// unchanged.
+func stripOwnerFromResponse(body []byte) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	raw, ok := m["labels"]
+	if !ok {
+		return body, nil
+	}
+	var labels map[string]any
+	if err := json.Unmarshal(raw, &labels); err != nil {
+		return nil, err
+	}
+	if _, ok := labels[ownerLabel]; !ok {
+		return body, nil
+	}
+	delete(labels, ownerLabel)
+	stripped, err := json.Marshal(labels)
+	if err != nil {
+		return nil, err
+	}
+	m["labels"] = stripped
+	return json.Marshal(m)
+}
@@ -1,8 +1,16 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
 )
 
 // ── InjectOwner ───────────────────────────────────────────────────────────────
@@ -271,3 +279,84 @@ func TestStripOwnerLabel_AlsoStripsSealed(t *testing.T) {
 	}
 }
 
+// ── CheckOwner ────────────────────────────────────────────────────────────────
+
+func TestCheckOwner_CoalescesConcurrentFetches(t *testing.T) {
+	var fetches atomic.Int32
+	arrived, release := make(chan struct{}, 1), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+		<-release
+		json.NewEncoder(w).Encode(daytona.Sandbox{ID: "sb-1", Labels: map[string]string{ownerLabel: "0xOWNER"}})
+	}))
+	defer srv.Close()
+	dtona := daytona.NewClient(srv.URL, "key")
+
+	const n = 20
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wallet := "0xowner"
+		if i == n-1 {
+			wallet = "0xSTRANGER"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = CheckOwner(context.Background(), dtona, "sb-1", wallet)
+		}()
+	}
+	// Hold the first fetch until the rest of the burst has joined it.
+	<-arrived
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Daytona fetches: %d, want 1 for %d concurrent checks", got, n)
+	}
+	for i, err := range errs[:n-1] {
+		if err != nil {
+			t.Errorf("check %d: %v", i, err)
+		}
+	}
+	if errs[n-1] == nil {
+		t.Error("non-owner passed the shared check")
+	}
+
+	// The burst is over: the next check fetches afresh.
+	if err := CheckOwner(context.Background(), dtona, "sb-1", "0xOWNER"); err != nil || fetches.Load() != 2 {
+		t.Errorf("later check: err %v, fetches %d, want a second fetch", err, fetches.Load())
+	}
+}
+
+func TestCheckOwner_CancelledCallerLeavesFetchToOthers(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(daytona.Sandbox{ID: "sb-1", Labels: map[string]string{ownerLabel: "0xOWNER"}})
+	}))
+	defer srv.Close()
+	dtona := daytona.NewClient(srv.URL, "key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- CheckOwner(ctx, dtona, "sb-1", "0xOWNER") }()
+	second := make(chan error, 1)
+	time.Sleep(50 * time.Millisecond)
+	go func() { second <- CheckOwner(context.Background(), dtona, "sb-1", "0xOWNER") }()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-first; err == nil {
+		t.Error("cancelled check succeeded")
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("check sharing the cancelled caller's fetch: %v", err)
+	}
+}
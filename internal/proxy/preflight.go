@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/metrics"
+)
+
+// Pre-flight failure modes (PREFLIGHT_FAILURE_MODE) decide what create and
+// start do when the acknowledgement or balance RPC fails, as opposed to
+// answering "no".
+const (
+	// PreflightFailClosed rejects the request with 502.
+	PreflightFailClosed = "fail_closed"
+	// PreflightFailOpen lets the request through unchecked (the cost is still
+	// reserved against concurrent requests). A user who really cannot pay is
+	// caught by the settler on the first voucher, whose insufficient-balance
+	// status stops the sandbox, so the cost is at most a briefly free-running
+	// sandbox.
+	PreflightFailOpen = "fail_open"
+)
+
+// SetPreflightFailureMode selects PreflightFailClosed (the default) or
+// PreflightFailOpen.
+func (h *Handler) SetPreflightFailureMode(mode string) error {
+	switch mode {
+	case "", PreflightFailClosed:
+		h.preflightFailOpen = false
+	case PreflightFailOpen:
+		h.preflightFailOpen = true
+	default:
+		return fmt.Errorf("invalid pre-flight failure mode %q", mode)
+	}
+	return nil
+}
+
+// preflightFailed handles a failed pre-flight RPC. Under fail_closed it
+// writes a 502 naming check and returns true: the caller must abort. Under
+// fail_open it logs, counts the admission and returns false: the caller
+// must skip the check.
+func (h *Handler) preflightFailed(c *gin.Context, check, wallet string, err error) bool {
+	if !h.preflightFailOpen {
+		h.log.Error(check, zap.String("wallet", wallet), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": check + " failed"})
+		return true
+	}
+	h.log.Warn(check+" failed, admitting unchecked (fail_open)", zap.String("wallet", wallet), zap.Error(err))
+	metrics.PreflightFailOpen.WithLabelValues(check).Inc()
+	return false
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+// unreachableChain is a BalanceChecker and AckChecker whose RPC always fails.
+type unreachableChain struct{}
+
+func (unreachableChain) GetBalance(context.Context, common.Address, common.Address) (*big.Int, error) {
+	return nil, errors.New("dial tcp: connection refused")
+}
+
+func (unreachableChain) IsAcknowledged(context.Context, common.Address) (bool, error) {
+	return false, errors.New("dial tcp: connection refused")
+}
+
+func TestPreflightFailureMode(t *testing.T) {
+	const wallet = "0xMYWALLET"
+	sb := daytona.Sandbox{ID: "sb-1", State: "stopped", Labels: map[string]string{ownerLabel: wallet}}
+
+	for _, tc := range []struct {
+		mode     string
+		admitted bool
+	}{
+		{PreflightFailClosed, false},
+		{PreflightFailOpen, true},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			srv, captured := mockDaytona(t, []daytona.Sandbox{sb})
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { rdb.Close() })
+
+			r := gin.New()
+			api := r.Group("/api", func(c *gin.Context) {
+				c.Set("wallet_address", wallet)
+				c.Next()
+			})
+			chain := unreachableChain{}
+			h := NewHandler(daytona.NewClient(srv.URL, "key"), &mockBilling{}, chain, chain, nil, big.NewInt(10), nil, nil, big.NewInt(1), "0xPROVIDER", nil, "", rdb, zap.NewNop(), "", nil, 60, 0, nil)
+			if err := h.SetPreflightFailureMode(tc.mode); err != nil {
+				t.Fatal(err)
+			}
+			h.Register(api)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/sandbox", strings.NewReader(`{"cpu":1,"memory":1}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+			if admitted := w.Code < 300; admitted != tc.admitted || !admitted && w.Code != http.StatusBadGateway {
+				t.Errorf("create: got %d (%s), want admitted=%v", w.Code, w.Body.String(), tc.admitted)
+			}
+
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sandbox/sb-1/start", nil))
+			if admitted := w.Code < 300; admitted != tc.admitted || !admitted && w.Code != http.StatusBadGateway {
+				t.Errorf("start: got %d (%s), want admitted=%v", w.Code, w.Body.String(), tc.admitted)
+			}
+
+			// Daytona sees the create and the start only when they were admitted.
+			wantForwarded := 0
+			if tc.admitted {
+				wantForwarded = 2
+			}
+			if len(*captured) != wantForwarded {
+				t.Errorf("forwarded to Daytona: got %d requests, want %d", len(*captured), wantForwarded)
+			}
+		})
+	}
+}
+
+func TestSetPreflightFailureMode_RejectsUnknown(t *testing.T) {
+	h := NewHandler(daytona.NewClient("http://daytona.invalid", "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0, 0, nil)
+	if err := h.SetPreflightFailureMode("fail_sideways"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
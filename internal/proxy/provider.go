@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+// ServiceInfoReader reads a provider's on-chain service registration.
+// Satisfied by *chain.Client.
+type ServiceInfoReader interface {
+	GetServiceInfo(ctx context.Context, provider common.Address) (*chain.ServiceInfo, error)
+}
+
+// ProviderInfo is the JSON view of a provider's on-chain service registration.
+type ProviderInfo struct {
+	Address             string `json:"address"`
+	URL                 string `json:"url"`
+	TEESigner           string `json:"tee_signer"`
+	PricePerCPUPerMin   string `json:"price_per_cpu_per_min"`
+	PricePerCPUPerSec   string `json:"price_per_cpu_per_sec"`
+	PricePerMemGBPerMin string `json:"price_per_mem_gb_per_min"`
+	PricePerMemGBPerSec string `json:"price_per_mem_gb_per_sec"`
+	CreateFee           string `json:"create_fee"`
+	SignerVersion       string `json:"signer_version"`
+}
+
+// NewProviderInfo converts a service registration to its JSON view. The
+// contract stores prices per minute; per-second values are derived.
+func NewProviderInfo(addr string, svc *chain.ServiceInfo) ProviderInfo {
+	cpuPerSec := new(big.Int).Div(svc.PricePerCPUPerMin, big.NewInt(60))
+	memPerSec := new(big.Int).Div(svc.PricePerMemGBPerMin, big.NewInt(60))
+	return ProviderInfo{
+		Address:             addr,
+		URL:                 svc.URL,
+		TEESigner:           svc.TEESignerAddress.Hex(),
+		PricePerCPUPerMin:   svc.PricePerCPUPerMin.String(),
+		PricePerCPUPerSec:   cpuPerSec.String(),
+		PricePerMemGBPerMin: svc.PricePerMemGBPerMin.String(),
+		PricePerMemGBPerSec: memPerSec.String(),
+		CreateFee:           svc.CreateFee.String(),
+		SignerVersion:       svc.SignerVersion.String(),
+	}
+}
+
+// RegisterProviderService mounts the public service-discovery routes:
+//
+//	GET /provider/service          — the configured provider's own service
+//	GET /provider/service/:address — any provider's service
+//
+// Both return 404 when the provider has no registered service, and both
+// answer HEAD and If-None-Match against an ETag of the registration.
+func RegisterProviderService(rg gin.IRoutes, src ServiceInfoReader, providerAddress string) {
+	self := func(c *gin.Context) {
+		writeProviderService(c, src, providerAddress)
+	}
+	byAddress := func(c *gin.Context) {
+		writeProviderService(c, src, c.Param("address"))
+	}
+	rg.GET("/provider/service", self)
+	rg.HEAD("/provider/service", self)
+	rg.GET("/provider/service/:address", byAddress)
+	rg.HEAD("/provider/service/:address", byAddress)
+}
+
+func writeProviderService(c *gin.Context, src ServiceInfoReader, addr string) {
+	if !common.IsHexAddress(addr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid provider address"})
+		return
+	}
+	provider := common.HexToAddress(addr)
+	svc, err := src.GetServiceInfo(c.Request.Context(), provider)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "chain read failed"})
+		return
+	}
+	if svc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "service not registered"})
+		return
+	}
+	info := NewProviderInfo(provider.Hex(), svc)
+	etag, err := etagOf(info)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	writeCacheable(c, etag, info)
+}
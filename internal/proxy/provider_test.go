@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+type mockServiceReader struct {
+	services map[common.Address]*chain.ServiceInfo
+	err      error
+}
+
+func (m *mockServiceReader) GetServiceInfo(_ context.Context, provider common.Address) (*chain.ServiceInfo, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.services[provider], nil
+}
+
+var (
+	selfProvider  = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	otherProvider = common.HexToAddress("0x2222222222222222222222222222222222222222")
+)
+
+func newProviderEngine(src ServiceInfoReader) *gin.Engine {
+	r := gin.New()
+	RegisterProviderService(r.Group("/api"), src, selfProvider.Hex())
+	return r
+}
+
+func TestProviderService_Self(t *testing.T) {
+	src := &mockServiceReader{services: map[common.Address]*chain.ServiceInfo{
+		selfProvider: {
+			URL:                 "https://p1.example",
+			TEESignerAddress:    common.HexToAddress("0xABCDEF0000000000000000000000000000000001"),
+			PricePerCPUPerMin:   big.NewInt(600),
+			PricePerMemGBPerMin: big.NewInt(120),
+			CreateFee:           big.NewInt(5000000),
+			SignerVersion:       big.NewInt(2),
+		},
+	}}
+	r := newProviderEngine(src)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/provider/service", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got ProviderInfo
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.URL != "https://p1.example" || got.PricePerCPUPerSec != "10" || got.PricePerMemGBPerSec != "2" ||
+		got.CreateFee != "5000000" || got.SignerVersion != "2" || got.Address != selfProvider.Hex() {
+		t.Errorf("unexpected provider info: %+v", got)
+	}
+}
+
+func TestProviderService_ByAddress_NotRegistered(t *testing.T) {
+	r := newProviderEngine(&mockServiceReader{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/provider/service/"+otherProvider.Hex(), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestProviderService_InvalidAddress(t *testing.T) {
+	r := newProviderEngine(&mockServiceReader{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/provider/service/not-an-address", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestProviderService_ChainError(t *testing.T) {
+	r := newProviderEngine(&mockServiceReader{err: errors.New("rpc down")})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/provider/service", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", w.Code)
+	}
+}
+
+func TestProviderService_ETagTracksPrice(t *testing.T) {
+	svc := &chain.ServiceInfo{
+		URL:                 "https://p1.example",
+		PricePerCPUPerMin:   big.NewInt(600),
+		PricePerMemGBPerMin: big.NewInt(120),
+		CreateFee:           big.NewInt(5000000),
+		SignerVersion:       big.NewInt(1),
+	}
+	r := newProviderEngine(&mockServiceReader{services: map[common.Address]*chain.ServiceInfo{selfProvider: svc}})
+	conditional := func(method, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/provider/service", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	etag := conditional(http.MethodGet, "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if w := conditional(http.MethodGet, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("unchanged: status %d, body %q; want 304", w.Code, w.Body.String())
+	}
+	if w := conditional(http.MethodHead, ""); w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Errorf("HEAD: status %d, body %q, ETag %q", w.Code, w.Body.String(), w.Header().Get("ETag"))
+	}
+
+	svc.PricePerCPUPerMin = big.NewInt(1200)
+	if w := conditional(http.MethodGet, etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("after a price change: status %d, ETag %q; want 200 and a new tag", w.Code, w.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+// AckRelayer broadcasts acknowledgeTEESigner transactions users signed with
+// their own wallet. Satisfied by *chain.Client.
+type AckRelayer interface {
+	RelayAcknowledgement(ctx context.Context, user common.Address, rawTx []byte) (common.Hash, error)
+}
+
+// SetAckRelay lets POST /sandbox/provision acknowledge the TEE signer with a
+// transaction the caller signed. Without one, provisioning stops at the
+// acknowledge step for wallets that have not acknowledged.
+func (h *Handler) SetAckRelay(r AckRelayer) {
+	h.ackRelayer = r
+}
+
+const (
+	// provisionTTL bounds how long a provision's progress is kept for a
+	// retry to resume from.
+	provisionTTL    = 24 * time.Hour
+	provisionPrefix = "provision:"
+	// provisionCreating marks a create in flight in the sandbox_id field.
+	provisionCreating = "pending"
+)
+
+// Provision step states.
+const (
+	stepDone    = "done"    // carried out by this call or, with resumed, an earlier one
+	stepSkipped = "skipped" // nothing to do
+	stepFailed  = "failed"
+	stepPending = "pending" // not reached
+)
+
+var provisionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type provisionRequest struct {
+	// ProvisionID is chosen by the client; a retry with the same ID resumes
+	// after the steps already done.
+	ProvisionID string `json:"provision_id"`
+	// Deposit is a signed deposit authorization, as for POST
+	// /account/deposit/relay. Omit it to skip the deposit.
+	Deposit *relayDepositRequest `json:"deposit,omitempty"`
+	// AckTx is a raw signed transaction (hex) from the caller's wallet
+	// calling acknowledgeTEESigner(provider, true). Only needed when the
+	// wallet has not acknowledged the TEE signer.
+	AckTx string `json:"ack_tx,omitempty"`
+	// Sandbox is the POST /sandbox create payload.
+	Sandbox json.RawMessage `json:"sandbox"`
+}
+
+type provisionStep struct {
+	Status    string          `json:"status"`
+	TxHash    string          `json:"tx_hash,omitempty"`
+	SandboxID string          `json:"sandbox_id,omitempty"`
+	Resumed   bool            `json:"resumed,omitempty"` // done by an earlier call with the same provision_id
+	Error     string          `json:"error,omitempty"`
+	Detail    json.RawMessage `json:"detail,omitempty"` // the failed sub-step's own response
+}
+
+type provisionResponse struct {
+	ProvisionID string          `json:"provision_id"`
+	Deposit     provisionStep   `json:"deposit"`
+	Acknowledge provisionStep   `json:"acknowledge"`
+	Create      provisionStep   `json:"create"`
+	Sandbox     json.RawMessage `json:"sandbox,omitempty"` // the create response, when created by this call
+}
+
+func provisionKey(wallet, id string) string {
+	return provisionPrefix + strings.ToLower(wallet) + ":" + id
+}
+
+// handleProvision serves POST /sandbox/provision: relay a deposit, relay an
+// acknowledgement of the TEE signer if the wallet needs one, then create the
+// sandbox through the normal create path, in one call. Each step's outcome is
+// kept in provision:{wallet}:{provision_id} for provisionTTL, so a retry after
+// a failure skips what is already done; the deposit relay and the chain's
+// acknowledgement are idempotent on their own as well. A failure answers
+// with that step's status code and every step's state.
+func (h *Handler) handleProvision(c *gin.Context) {
+	wallet := c.GetString("wallet_address")
+	var req provisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+		return
+	}
+	if !provisionIDPattern.MatchString(req.ProvisionID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provision_id must be 1-64 letters, digits, '-' or '_'"})
+		return
+	}
+	if len(req.Sandbox) == 0 || req.Sandbox[0] != '{' {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sandbox must be the create payload object"})
+		return
+	}
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "provision store unavailable"})
+		return
+	}
+	ctx := c.Request.Context()
+	key := provisionKey(wallet, req.ProvisionID)
+	progress, err := h.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	resp := provisionResponse{
+		ProvisionID: req.ProvisionID,
+		Deposit:     provisionStep{Status: stepPending},
+		Acknowledge: provisionStep{Status: stepPending},
+		Create:      provisionStep{Status: stepPending},
+	}
+	fail := func(step *provisionStep, status int, msg string, detail any) {
+		*step = provisionStep{Status: stepFailed, Error: msg}
+		if detail != nil {
+			step.Detail, _ = json.Marshal(detail)
+		}
+		h.log.Warn("provision step failed", zap.String("wallet", wallet), zap.String("provision_id", req.ProvisionID),
+			zap.Int("status", status), zap.String("error", msg))
+		c.JSON(status, resp)
+	}
+
+	// ── 1. Deposit ────────────────────────────────────────────────────────
+	switch {
+	case progress["deposit_tx"] != "":
+		resp.Deposit = provisionStep{Status: stepDone, TxHash: progress["deposit_tx"], Resumed: true}
+	case req.Deposit == nil:
+		resp.Deposit.Status = stepSkipped
+	default:
+		status, body := h.relayDeposit(ctx, wallet, *req.Deposit)
+		txHash, _ := body["tx_hash"].(string)
+		if status != http.StatusOK {
+			fail(&resp.Deposit, status, "deposit relay failed", body)
+			return
+		}
+		h.saveProvision(ctx, key, "deposit_tx", txHash)
+		resp.Deposit = provisionStep{Status: stepDone, TxHash: txHash}
+	}
+
+	// ── 2. Acknowledge ────────────────────────────────────────────────────
+	switch {
+	case progress["ack_tx"] != "":
+		resp.Acknowledge = provisionStep{Status: stepDone, TxHash: progress["ack_tx"], Resumed: true}
+	case h.ackCheck == nil:
+		resp.Acknowledge.Status = stepSkipped
+	default:
+		acked, err := h.ackCheck.IsAcknowledged(ctx, common.HexToAddress(wallet))
+		if err != nil {
+			h.log.Error("provision: ack check", zap.String("wallet", wallet), zap.Error(err))
+			fail(&resp.Acknowledge, http.StatusBadGateway, "acknowledgement check failed", nil)
+			return
+		}
+		if acked {
+			resp.Acknowledge.Status = stepSkipped
+			break
+		}
+		if req.AckTx == "" {
+			fail(&resp.Acknowledge, http.StatusPaymentRequired,
+				"TEE signer not acknowledged: sign acknowledgeTEESigner(provider, true) with your wallet and pass the raw transaction as ack_tx", nil)
+			return
+		}
+		if h.ackRelayer == nil {
+			fail(&resp.Acknowledge, http.StatusNotImplemented, "acknowledgement relay unavailable", nil)
+			return
+		}
+		raw, err := hex.DecodeString(strings.TrimPrefix(req.AckTx, "0x"))
+		if err != nil {
+			fail(&resp.Acknowledge, http.StatusBadRequest, "invalid ack_tx hex", nil)
+			return
+		}
+		txHash, err := h.ackRelayer.RelayAcknowledgement(ctx, common.HexToAddress(wallet), raw)
+		if err != nil {
+			if errors.Is(err, chain.ErrInvalidAckTx) {
+				fail(&resp.Acknowledge, http.StatusBadRequest, err.Error(), nil)
+				return
+			}
+			h.log.Error("provision: relay acknowledgement", zap.String("wallet", wallet), zap.Error(err))
+			fail(&resp.Acknowledge, http.StatusBadGateway, "acknowledgement relay failed", gin.H{"tx_hash": hashOrEmpty(txHash)})
+			return
+		}
+		h.saveProvision(ctx, key, "ack_tx", txHash.Hex())
+		resp.Acknowledge = provisionStep{Status: stepDone, TxHash: txHash.Hex()}
+	}
+
+	// ── 3. Create ─────────────────────────────────────────────────────────
+	// sandbox_id is claimed before the create so that concurrent retries
+	// cannot create twice.
+	claimed, err := h.rdb.HSetNX(ctx, key, "sandbox_id", provisionCreating).Result()
+	if err != nil {
+		fail(&resp.Create, http.StatusInternalServerError, "internal error", nil)
+		return
+	}
+	h.rdb.Expire(ctx, key, provisionTTL)
+	if !claimed {
+		id, _ := h.rdb.HGet(ctx, key, "sandbox_id").Result()
+		if id == provisionCreating {
+			fail(&resp.Create, http.StatusConflict, "sandbox is being created by another call with this provision_id", nil)
+			return
+		}
+		resp.Create = provisionStep{Status: stepDone, SandboxID: id, Resumed: true}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	created := false
+	defer func() { // also on a panic, so a retry is not locked out
+		if !created {
+			h.rdb.HDel(context.WithoutCancel(ctx), key, "sandbox_id")
+		}
+	}()
+	rec := h.runCreate(c, req.Sandbox)
+	if rec.Code < 200 || rec.Code >= 300 {
+		fail(&resp.Create, rec.Code, "create failed", json.RawMessage(rec.Body.Bytes()))
+		return
+	}
+	id := extractID(rec.Body.Bytes(), h.createIDPaths)
+	h.saveProvision(ctx, key, "sandbox_id", id)
+	created = true
+	resp.Create = provisionStep{Status: stepDone, SandboxID: id}
+	if json.Valid(rec.Body.Bytes()) {
+		resp.Sandbox = rec.Body.Bytes()
+	}
+	c.JSON(rec.Code, resp)
+}
+
+// saveProvision records a completed step. It outlives the request: the step
+// happened even if the caller has gone.
+func (h *Handler) saveProvision(ctx context.Context, key, field, value string) {
+	ctx = context.WithoutCancel(ctx)
+	pipe := h.rdb.TxPipeline()
+	pipe.HSet(ctx, key, field, value)
+	pipe.Expire(ctx, key, provisionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		h.log.Error("provision: save progress", zap.String("key", key), zap.String("field", field), zap.Error(err))
+	}
+}
+
+// runCreate runs body through the normal create path (handleCreate) as a
+// POST /sandbox from the same wallet, and returns the recorded response.
+func (h *Handler) runCreate(c *gin.Context, body []byte) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	sub, _ := gin.CreateTestContext(rec)
+	req := c.Request.Clone(c.Request.Context())
+	req.URL.Path = strings.TrimSuffix(req.URL.Path, "/provision")
+	req.URL.RawPath = ""
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	sub.Request = req
+	for k, v := range c.Keys {
+		sub.Set(k, v)
+	}
+	// On a panic, recoverSandbox on the provision route must still find the
+	// sandbox to stop.
+	defer func() {
+		if id := sub.GetString(runningSandboxKey); id != "" {
+			c.Set(runningSandboxKey, id)
+		}
+	}()
+	h.handleCreate(sub)
+	return rec
+}
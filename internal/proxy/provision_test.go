@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+// mockAckChain is both the AckChecker and the AckRelayer: relaying marks the
+// wallet acknowledged.
+type mockAckChain struct {
+	acked  bool
+	relays []common.Address
+}
+
+func (m *mockAckChain) IsAcknowledged(context.Context, common.Address) (bool, error) {
+	return m.acked, nil
+}
+
+func (m *mockAckChain) RelayAcknowledgement(_ context.Context, user common.Address, _ []byte) (common.Hash, error) {
+	m.relays = append(m.relays, user)
+	m.acked = true
+	return common.HexToHash("0xac"), nil
+}
+
+func newProvisionEngine(t *testing.T, mb *mockBilling, rel *mockRelayer, ack *mockAckChain, wallet string) (*gin.Engine, *[][]byte) {
+	t.Helper()
+	srv, captured := mockDaytona(t, nil)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", wallet)
+		c.Next()
+	})
+	h := NewHandler(daytona.NewClient(srv.URL, "key"), mb, nil, ack, nil, new(big.Int), nil, nil, nil, relayProvider, nil, "", rdb, zap.NewNop(), "", nil, 0, 0, nil)
+	h.SetDepositRelay(rel, big.NewInt(1000), 5, nil)
+	h.SetAckRelay(ack)
+	h.Register(api)
+	return r, captured
+}
+
+func postProvision(t *testing.T, r *gin.Engine, req provisionRequest) (int, provisionResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	hr := httptest.NewRequest(http.MethodPost, "/api/sandbox/provision", bytes.NewReader(body))
+	hr.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, hr)
+	var resp provisionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func TestProvision_ResumesAfterFailedCreate(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	wallet := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	rel, ack := &mockRelayer{}, &mockAckChain{}
+	mb := &mockBilling{createErr: errors.New("redis down")}
+	r, captured := newProvisionEngine(t, mb, rel, ack, wallet)
+
+	var deposit relayDepositRequest
+	json.Unmarshal(signedRelayBody(t, key, rel, 500, 1, time.Now().Add(10*time.Minute)), &deposit)
+	req := provisionRequest{
+		ProvisionID: "first-run",
+		Deposit:     &deposit,
+		AckTx:       "0x01",
+		Sandbox:     json.RawMessage(`{"name":"demo"}`),
+	}
+
+	// Deposit and acknowledgement go through; billing cannot start.
+	code, resp := postProvision(t, r, req)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("first call: status %d, want the create path's 503", code)
+	}
+	if resp.Deposit.Status != stepDone || resp.Acknowledge.Status != stepDone || resp.Create.Status != stepFailed {
+		t.Errorf("first call steps: %+v", resp)
+	}
+	if len(resp.Create.Detail) == 0 {
+		t.Error("failed create carries no detail")
+	}
+
+	// The retry resumes at create.
+	mb.createErr = nil
+	code, resp = postProvision(t, r, req)
+	if code != http.StatusCreated {
+		t.Fatalf("retry: status %d, want 201", code)
+	}
+	if !resp.Deposit.Resumed || !resp.Acknowledge.Resumed || resp.Create.Status != stepDone || resp.Create.SandboxID != "sb-new" {
+		t.Errorf("retry steps: %+v", resp)
+	}
+	if len(rel.calls) != 1 || len(ack.relays) != 1 || ack.relays[0].Hex() != wallet {
+		t.Errorf("deposits %d, acknowledgements %v: want one each, for the caller", len(rel.calls), ack.relays)
+	}
+
+	// Once done, a retry creates nothing more.
+	code, resp = postProvision(t, r, req)
+	if code != http.StatusOK || !resp.Create.Resumed || resp.Create.SandboxID != "sb-new" {
+		t.Errorf("replay: status %d, %+v", code, resp.Create)
+	}
+	if len(*captured) != 2 {
+		t.Errorf("Daytona creates: %d, want 2 (the failed billing start and the retry)", len(*captured))
+	}
+}
+
+func TestProvision_AcknowledgementRequired(t *testing.T) {
+	ack := &mockAckChain{}
+	mb := &mockBilling{}
+	r, captured := newProvisionEngine(t, mb, &mockRelayer{}, ack, "0xWALLET")
+
+	code, resp := postProvision(t, r, provisionRequest{ProvisionID: "p1", Sandbox: json.RawMessage(`{}`)})
+	if code != http.StatusPaymentRequired {
+		t.Fatalf("status %d, want 402", code)
+	}
+	if resp.Deposit.Status != stepSkipped || resp.Acknowledge.Status != stepFailed || resp.Create.Status != stepPending {
+		t.Errorf("steps: %+v", resp)
+	}
+	if len(*captured) != 0 {
+		t.Error("sandbox created without an acknowledgement")
+	}
+
+	// Already acknowledged: nothing to relay.
+	ack.acked = true
+	code, resp = postProvision(t, r, provisionRequest{ProvisionID: "p1", Sandbox: json.RawMessage(`{}`)})
+	if code != http.StatusCreated || resp.Acknowledge.Status != stepSkipped || len(ack.relays) != 0 {
+		t.Errorf("acknowledged wallet: status %d, %+v, relays %d", code, resp.Acknowledge, len(ack.relays))
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+)
+
+const createQuotaKeyPrefix = "quota:create:"
+
+// SetCreateQuota limits sandbox creations per wallet to limit per window.
+// Windows are fixed and aligned to the Unix epoch, so a 24h window resets at
+// 00:00 UTC. Unlike the running-sandbox limit this counts creations, whether
+// or not the sandbox is still running. limit <= 0 disables the quota.
+func (h *Handler) SetCreateQuota(limit int, window time.Duration) {
+	h.createQuota = limit
+	h.createQuotaWindow = window
+}
+
+// SetClock replaces the real clock used for quota windows. A nil clock
+// restores the real one.
+func (h *Handler) SetClock(c clock.Clock) {
+	h.clock = clock.OrReal(c)
+}
+
+// createQuotaKey is the Redis counter of wallet's creations in the window
+// starting at windowStart (unix seconds).
+func createQuotaKey(wallet string, windowStart int64) string {
+	return createQuotaKeyPrefix + strings.ToLower(wallet) + ":" + strconv.FormatInt(windowStart, 10)
+}
+
+// quotaTakeScript counts one creation against KEYS[1], expiring the counter
+// ARGV[2] seconds later at the window end. Over the limit (ARGV[1]) the count
+// is undone and -1 is returned; otherwise the new count.
+var quotaTakeScript = redis.NewScript(`
+	local n = redis.call('INCR', KEYS[1])
+	if n == 1 then redis.call('EXPIRE', KEYS[1], ARGV[2]) end
+	if n > tonumber(ARGV[1]) then
+		redis.call('DECR', KEYS[1])
+		return -1
+	end
+	return n
+`)
+
+// quotaRefundScript returns one creation to a counter that still exists.
+var quotaRefundScript = redis.NewScript(`
+	if redis.call('EXISTS', KEYS[1]) == 1 and tonumber(redis.call('GET', KEYS[1])) > 0 then
+		return redis.call('DECR', KEYS[1])
+	end
+	return 0
+`)
+
+// takeCreateQuota counts a creation against wallet's quota and sets the
+// X-Quota-Limit, X-Quota-Remaining and X-Quota-Reset (unix seconds) headers.
+// Writes 429 QUOTA_EXCEEDED and returns ok=false when the quota is used up.
+// The returned key is passed to refundCreateQuota if the creation fails; it
+// is empty when nothing was counted (quota disabled, or Redis unavailable —
+// creation is then allowed, as with reserveSandboxSlot).
+func (h *Handler) takeCreateQuota(c *gin.Context, wallet string) (key string, ok bool) {
+	if h.createQuota <= 0 || h.createQuotaWindow < time.Second || h.rdb == nil {
+		return "", true
+	}
+	window := int64(h.createQuotaWindow / time.Second)
+	now := clock.OrReal(h.clock).Now().Unix()
+	start := now - now%window
+	reset := start + window
+	key = createQuotaKey(wallet, start)
+
+	n, err := quotaTakeScript.Run(c.Request.Context(), h.rdb, []string{key}, h.createQuota, reset-now).Int()
+	if err != nil {
+		h.log.Warn("create quota: count creation (allowing)", zap.String("wallet", wallet), zap.Error(err))
+		return "", true
+	}
+	c.Header("X-Quota-Limit", strconv.Itoa(h.createQuota))
+	c.Header("X-Quota-Reset", strconv.FormatInt(reset, 10))
+	if n < 0 {
+		c.Header("X-Quota-Remaining", "0")
+		c.Header("Retry-After", strconv.FormatInt(reset-now, 10))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":    fmt.Sprintf("create quota exceeded (%d per %s)", h.createQuota, h.createQuotaWindow),
+			"code":     "QUOTA_EXCEEDED",
+			"limit":    h.createQuota,
+			"reset_at": reset,
+		})
+		return "", false
+	}
+	c.Header("X-Quota-Remaining", strconv.Itoa(h.createQuota-n))
+	return key, true
+}
+
+// refundCreateQuota gives back a creation counted by takeCreateQuota when
+// Daytona did not create the sandbox.
+func (h *Handler) refundCreateQuota(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := quotaRefundScript.Run(ctx, h.rdb, []string{key}).Err(); err != nil {
+		h.log.Warn("create quota: refund", zap.String("key", key), zap.Error(err))
+	}
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+func newQuotaEngine(t *testing.T, upstream string, limit int, window time.Duration, clk clock.Clock) *gin.Engine {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	h := NewHandler(daytona.NewClient(upstream, "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", rdb, zap.NewNop(), "", nil, 0, 0, nil)
+	h.SetCreateQuota(limit, window)
+	h.SetClock(clk)
+	r := gin.New()
+	h.Register(r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", "0xOWNER")
+		c.Next()
+	}))
+	return r
+}
+
+func postCreate(r *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{}`))))
+	return w
+}
+
+func TestCreateQuota_WindowRollover(t *testing.T) {
+	srv, captured := mockDaytona(t, nil)
+	// 10 minutes before the end of a UTC day.
+	clk := clock.NewFake(time.Date(2026, 3, 1, 23, 50, 0, 0, time.UTC))
+	r := newQuotaEngine(t, srv.URL, 2, 24*time.Hour, clk)
+	reset := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC).Unix()
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := postCreate(r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %d: expected 201, got %d: %s", i, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Quota-Remaining"); got != wantRemaining {
+			t.Errorf("create %d: X-Quota-Remaining %q want %q", i, got, wantRemaining)
+		}
+		if got := w.Header().Get("X-Quota-Limit"); got != "2" {
+			t.Errorf("create %d: X-Quota-Limit %q want 2", i, got)
+		}
+	}
+
+	w := postCreate(r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over quota: expected 429, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Code    string `json:"code"`
+		Limit   int    `json:"limit"`
+		ResetAt int64  `json:"reset_at"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp) //nolint:errcheck
+	if resp.Code != "QUOTA_EXCEEDED" || resp.Limit != 2 || resp.ResetAt != reset {
+		t.Errorf("429 body: got %+v, want QUOTA_EXCEEDED limit 2 reset_at %d", resp, reset)
+	}
+	if got := w.Header().Get("X-Quota-Reset"); got != strconv.FormatInt(reset, 10) {
+		t.Errorf("X-Quota-Reset %q want %d", got, reset)
+	}
+	if got := w.Header().Get("Retry-After"); got != "600" {
+		t.Errorf("Retry-After %q want 600", got)
+	}
+	if len(*captured) != 2 {
+		t.Errorf("over-quota create must not reach Daytona: %d forwarded", len(*captured))
+	}
+
+	// One second before the reset the quota is still used up; at the reset a
+	// fresh window starts.
+	clk.Set(time.Unix(reset-1, 0))
+	if w := postCreate(r); w.Code != http.StatusTooManyRequests {
+		t.Errorf("before reset: expected 429, got %d", w.Code)
+	}
+	clk.Set(time.Unix(reset, 0))
+	if w := postCreate(r); w.Code != http.StatusCreated || w.Header().Get("X-Quota-Remaining") != "1" {
+		t.Errorf("new window: got %d remaining %q, want 201 and 1", w.Code, w.Header().Get("X-Quota-Remaining"))
+	}
+}
+
+func TestCreateQuota_UpstreamFailureRefunded(t *testing.T) {
+	fail := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/sandbox", func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"sb-new"}`)) //nolint:errcheck
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	r := newQuotaEngine(t, srv.URL, 1, time.Hour, clock.NewFake(time.Unix(1_700_000_000, 0)))
+
+	for i := 0; i < 3; i++ {
+		if w := postCreate(r); w.Code != http.StatusInternalServerError {
+			t.Fatalf("failing create %d: expected upstream 500, got %d", i, w.Code)
+		}
+	}
+	fail = false
+	if w := postCreate(r); w.Code != http.StatusCreated {
+		t.Fatalf("failed creates must not use the quota: got %d %s", w.Code, w.Body.String())
+	}
+	if w := postCreate(r); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after the one successful create, got %d", w.Code)
+	}
+}
+
+func TestCreateQuota_Disabled(t *testing.T) {
+	srv, _ := mockDaytona(t, nil)
+	r := newQuotaEngine(t, srv.URL, 0, 24*time.Hour, nil)
+	for i := 0; i < 3; i++ {
+		w := postCreate(r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %d: expected 201, got %d", i, w.Code)
+		}
+		if w.Header().Get("X-Quota-Limit") != "" {
+			t.Error("no quota headers expected when the quota is disabled")
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+)
+
+// runningSandboxKey is the gin context key a handler sets once the sandbox it
+// acts on is running upstream, so a later panic stops it (see recoverSandbox).
+const runningSandboxKey = "running_sandbox_id"
+
+// StopReasonHandlerPanic is the stop reason recorded for a sandbox whose
+// create or start handler panicked.
+const StopReasonHandlerPanic = settler.StopHandlerPanic
+
+// SetStopScheduler sets how recoverSandbox stops a sandbox. Without one it
+// only records stop:sandbox:{id}, which the stop handler picks up on its next
+// start.
+func (h *Handler) SetStopScheduler(fn func(ctx context.Context, sandboxID string, reason settler.StopReason)) {
+	h.scheduleStop = fn
+}
+
+// recoverSandbox recovers a panic in a create or lifecycle handler. When the
+// handler had already marked a running sandbox (runningSandboxKey), a stop is
+// scheduled for it so it is not left running and billed behind a broken
+// session. It answers 500 with the request ID; gin.Recovery still handles
+// panics anywhere else.
+func (h *Handler) recoverSandbox() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec) // client went away; let net/http handle it
+			}
+			reqID := c.GetHeader("X-Request-Id")
+			if reqID == "" {
+				reqID = uuid.NewString()
+			}
+			sandboxID := c.GetString(runningSandboxKey)
+			h.log.Error("proxy: handler panic",
+				zap.Any("panic", rec),
+				zap.String("request_id", reqID),
+				zap.String("sandbox", sandboxID),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Stack("stack"),
+			)
+			if sandboxID != "" {
+				h.stopAfterPanic(context.WithoutCancel(c.Request.Context()), sandboxID)
+			}
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.Header("X-Request-Id", reqID)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "internal error",
+				"request_id": reqID,
+			})
+		}()
+		c.Next()
+	}
+}
+
+// goStopOnPanic runs fn in a goroutine for a sandbox running upstream. The
+// request's recoverSandbox cannot see a panic there, and an unrecovered one
+// would crash the process, so it is recovered here and the sandbox stopped as
+// recoverSandbox would.
+func (h *Handler) goStopOnPanic(ctx context.Context, sandboxID string, fn func()) {
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				h.log.Error("proxy: background billing panic",
+					zap.Any("panic", rec),
+					zap.String("sandbox", sandboxID),
+					zap.Stack("stack"),
+				)
+				h.stopAfterPanic(ctx, sandboxID)
+			}
+		}()
+		fn()
+	}()
+}
+
+func (h *Handler) stopAfterPanic(ctx context.Context, sandboxID string) {
+	if h.scheduleStop != nil {
+		h.scheduleStop(ctx, sandboxID, StopReasonHandlerPanic)
+		return
+	}
+	if h.rdb == nil {
+		h.log.Error("proxy: cannot schedule stop after panic — no Redis", zap.String("sandbox", sandboxID))
+		return
+	}
+	if err := h.rdb.Set(ctx, settler.StopKey(sandboxID), string(StopReasonHandlerPanic), 0).Err(); err != nil {
+		h.log.Error("proxy: schedule stop after panic", zap.String("sandbox", sandboxID), zap.Error(err))
+	}
+}
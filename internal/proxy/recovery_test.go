@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+)
+
+func TestRecoverSandbox_PanicAfterCreateSchedulesStop(t *testing.T) {
+	srv, _ := mockDaytona(t, nil)
+	h := NewHandler(daytona.NewClient(srv.URL, "test-key"), &mockBilling{panicOn: "sb-new"}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0, 0, nil)
+	var stopped []string
+	h.SetStopScheduler(func(_ context.Context, id string, reason settler.StopReason) {
+		stopped = append(stopped, id+":"+string(reason))
+	})
+	r := gin.New()
+	h.Register(r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", "0xMYWALLET")
+		c.Next()
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", "req-42")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp) //nolint:errcheck
+	if resp["request_id"] != "req-42" {
+		t.Errorf("request_id: got %q want req-42", resp["request_id"])
+	}
+	if len(stopped) != 1 || stopped[0] != "sb-new:"+string(StopReasonHandlerPanic) {
+		t.Errorf("scheduled stops: got %v want [sb-new:%s]", stopped, StopReasonHandlerPanic)
+	}
+}
+
+func TestGoStopOnPanic_StartBillingPanicStopsSandbox(t *testing.T) {
+	sb := daytona.Sandbox{ID: "sb-start", Labels: map[string]string{ownerLabel: "0xMYWALLET"}}
+	srv, _ := mockDaytona(t, []daytona.Sandbox{sb})
+	h := NewHandler(daytona.NewClient(srv.URL, "test-key"), &mockBilling{panicOn: "sb-start"}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0, 0, nil)
+	stopped := make(chan string, 1)
+	h.SetStopScheduler(func(_ context.Context, id string, reason settler.StopReason) {
+		stopped <- id + ":" + string(reason)
+	})
+	r := gin.New()
+	h.Register(r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", "0xMYWALLET")
+		c.Next()
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sandbox/sb-start/start", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// OnStart runs after the response; its panic must not crash the process.
+	select {
+	case got := <-stopped:
+		if got != "sb-start:"+string(StopReasonHandlerPanic) {
+			t.Errorf("scheduled stop: got %s", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no stop scheduled after the OnStart panic")
+	}
+}
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/auth"
+)
+
+// DepositRelayer submits deposits paid for by the provider.
+// Satisfied by *chain.Client.
+type DepositRelayer interface {
+	RelayDeposit(ctx context.Context, recipient common.Address, amount *big.Int) (common.Hash, error)
+	ChainID() *big.Int
+	ContractAddress() common.Address
+}
+
+const (
+	// relayMaxDeadline bounds how far in the future an authorization may
+	// expire, which in turn bounds how long its nonce must be remembered.
+	relayMaxDeadline = time.Hour
+	relayRateWindow  = 24 * time.Hour
+	relayAuthPrefix  = "relay:auth:"
+	relayRatePrefix  = "relay:rate:"
+	relayBudgetKey   = "relay:budget"
+	relayPending     = "pending"
+)
+
+// SetDepositRelay enables the experimental deposit relay: POST
+// /account/deposit/relay deposits up to maxAmount neuron per request into the
+// caller's own account, at most perDay times per wallet and dailyBudget neuron
+// in total per 24h (nil = unlimited; it must fit an int64), from the
+// provider's own funds. A nil relayer keeps the endpoint disabled.
+func (h *Handler) SetDepositRelay(r DepositRelayer, maxAmount *big.Int, perDay int, dailyBudget *big.Int) {
+	h.relayer = r
+	h.relayMax = maxAmount
+	h.relayPerDay = perDay
+	h.relayBudget = dailyBudget
+}
+
+type relayDepositRequest struct {
+	Recipient string `json:"recipient"`
+	Amount    string `json:"amount"` // neuron
+	Nonce     string `json:"nonce"`
+	Deadline  int64  `json:"deadline"` // unix seconds
+	Signature string `json:"signature"`
+}
+
+// handleRelayDeposit serves POST /account/deposit/relay (experimental); see
+// relayDeposit.
+func (h *Handler) handleRelayDeposit(c *gin.Context) {
+	var req relayDepositRequest
+	if h.relayer != nil { // a disabled relay answers 404 whatever the body
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+			return
+		}
+	}
+	c.JSON(h.relayDeposit(c.Request.Context(), c.GetString("wallet_address"), req))
+}
+
+// relayDeposit relays one deposit for wallet and returns the response status
+// and body.
+//
+// The caller submits an EIP-712 auth.DepositAuthorization signed by their own
+// wallet, naming that wallet as the recipient; the provider sends
+// deposit(recipient, provider) paying value and gas. Each (signer, nonce) is
+// claimed once in Redis: a retry of an authorization that already went out
+// returns the original tx hash instead of depositing again. A relay that sent
+// nothing gives back its place in the wallet's rate limit and the daily
+// budget.
+func (h *Handler) relayDeposit(ctx context.Context, wallet string, req relayDepositRequest) (int, gin.H) {
+	if h.relayer == nil {
+		return http.StatusNotFound, gin.H{"error": "deposit relay disabled"}
+	}
+	if h.rdb == nil {
+		return http.StatusServiceUnavailable, gin.H{"error": "relay store unavailable"}
+	}
+	if !common.IsHexAddress(req.Recipient) {
+		return http.StatusBadRequest, gin.H{"error": "invalid recipient"}
+	}
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok || amount.Sign() <= 0 {
+		return http.StatusBadRequest, gin.H{"error": "amount must be a positive neuron integer"}
+	}
+	if h.relayMax != nil && amount.Cmp(h.relayMax) > 0 {
+		return http.StatusBadRequest, gin.H{"error": "amount exceeds relay limit", "max_amount": h.relayMax.String()}
+	}
+	nonce, ok := new(big.Int).SetString(req.Nonce, 10)
+	if !ok {
+		return http.StatusBadRequest, gin.H{"error": "invalid nonce"}
+	}
+	now := time.Now()
+	if req.Deadline <= now.Unix() {
+		return http.StatusBadRequest, gin.H{"error": "authorization expired"}
+	}
+	if req.Deadline > now.Add(relayMaxDeadline).Unix() {
+		return http.StatusBadRequest, gin.H{"error": "deadline too far in future"}
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(req.Signature, "0x"))
+	if err != nil {
+		return http.StatusBadRequest, gin.H{"error": "invalid signature hex"}
+	}
+
+	authz := auth.DepositAuthorization{
+		Recipient: common.HexToAddress(req.Recipient),
+		Provider:  common.HexToAddress(h.providerAddress),
+		Amount:    amount,
+		Nonce:     nonce,
+		Deadline:  req.Deadline,
+	}
+	signer, err := authz.Signer(sig, h.relayer.ChainID(), h.relayer.ContractAddress())
+	if err != nil || !strings.EqualFold(signer.Hex(), wallet) {
+		return http.StatusUnauthorized, gin.H{"error": "authorization not signed by caller"}
+	}
+	// Funding other accounts would let many throwaway wallets pool the
+	// provider's deposits into one.
+	if authz.Recipient != signer {
+		return http.StatusBadRequest, gin.H{"error": "recipient must be the signing wallet"}
+	}
+
+	claimKey := relayAuthPrefix + strings.ToLower(signer.Hex()) + ":" + nonce.String()
+	claimTTL := time.Until(time.Unix(req.Deadline, 0)) + relayRateWindow
+	claimed, err := h.rdb.SetNX(ctx, claimKey, relayPending, claimTTL).Result()
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "internal error"}
+	}
+	if !claimed {
+		prev, _ := h.rdb.Get(ctx, claimKey).Result()
+		if prev == relayPending || prev == "" {
+			return http.StatusConflict, gin.H{"error": "authorization is being relayed"}
+		}
+		return http.StatusOK, gin.H{"tx_hash": prev, "recipient": authz.Recipient.Hex(), "amount": amount.String(), "amount_0g": h.og(amount.String()), "replayed": true}
+	}
+
+	rateKey := relayRatePrefix + strings.ToLower(wallet)
+	count, err := h.rdb.Incr(ctx, rateKey).Result()
+	if err != nil {
+		h.rdb.Del(ctx, claimKey)
+		return http.StatusInternalServerError, gin.H{"error": "internal error"}
+	}
+	// NX also restarts a window whose key a refund recreated without a TTL.
+	h.rdb.ExpireNX(ctx, rateKey, relayRateWindow)
+	if h.relayPerDay > 0 && count > int64(h.relayPerDay) {
+		h.rdb.Del(ctx, claimKey)
+		return http.StatusTooManyRequests, gin.H{
+			"error": fmt.Sprintf("relay limit reached (%d per day)", h.relayPerDay),
+			"code":  "RELAY_RATE_LIMIT",
+		}
+	}
+	if status, body := h.reserveRelayBudget(ctx, amount); status != 0 {
+		h.rdb.Decr(ctx, rateKey)
+		h.rdb.Del(ctx, claimKey)
+		return status, body
+	}
+
+	txHash, err := h.relayer.RelayDeposit(ctx, authz.Recipient, amount)
+	// The tx may be out even if the caller disconnected; record it regardless.
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		h.log.Error("relay deposit", zap.String("wallet", wallet), zap.String("recipient", authz.Recipient.Hex()), zap.Error(err))
+		if txHash == (common.Hash{}) {
+			// Nothing was sent; let the caller retry the same authorization
+			// without it counting twice.
+			h.rdb.Del(ctx, claimKey)
+			h.rdb.Decr(ctx, rateKey)
+			if h.relayBudget != nil {
+				h.rdb.DecrBy(ctx, relayBudgetKey, amount.Int64())
+			}
+		} else {
+			h.rdb.Set(ctx, claimKey, txHash.Hex(), redis.KeepTTL)
+		}
+		return http.StatusBadGateway, gin.H{"error": "relay failed", "tx_hash": hashOrEmpty(txHash)}
+	}
+	h.rdb.Set(ctx, claimKey, txHash.Hex(), redis.KeepTTL)
+	h.log.Info("deposit relayed",
+		zap.String("wallet", wallet),
+		zap.String("recipient", authz.Recipient.Hex()),
+		zap.String("amount", amount.String()),
+		zap.String("tx", txHash.Hex()),
+	)
+	return http.StatusOK, gin.H{"tx_hash": txHash.Hex(), "recipient": authz.Recipient.Hex(), "amount": amount.String(), "amount_0g": h.og(amount.String())}
+}
+
+// reserveRelayBudget counts amount against the relay's daily budget and
+// returns 0 when it fits, or the response status and body refusing it.
+func (h *Handler) reserveRelayBudget(ctx context.Context, amount *big.Int) (int, gin.H) {
+	if h.relayBudget == nil {
+		return 0, nil
+	}
+	spent, err := h.rdb.IncrBy(ctx, relayBudgetKey, amount.Int64()).Result()
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "internal error"}
+	}
+	h.rdb.ExpireNX(ctx, relayBudgetKey, relayRateWindow)
+	if big.NewInt(spent).Cmp(h.relayBudget) > 0 {
+		h.rdb.DecrBy(ctx, relayBudgetKey, amount.Int64())
+		return http.StatusTooManyRequests, gin.H{
+			"error": "provider's daily relay budget is spent",
+			"code":  "RELAY_BUDGET_EXHAUSTED",
+		}
+	}
+	return 0, nil
+}
+
+func hashOrEmpty(h common.Hash) string {
+	if h == (common.Hash{}) {
+		return ""
+	}
+	return h.Hex()
+}
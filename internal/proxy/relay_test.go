@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/auth"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+type mockRelayer struct {
+	calls []*big.Int
+	err   error
+}
+
+func (m *mockRelayer) RelayDeposit(_ context.Context, _ common.Address, amount *big.Int) (common.Hash, error) {
+	if m.err != nil {
+		return common.Hash{}, m.err
+	}
+	m.calls = append(m.calls, amount)
+	return common.BigToHash(big.NewInt(int64(len(m.calls)))), nil
+}
+func (m *mockRelayer) ChainID() *big.Int { return big.NewInt(16602) }
+func (m *mockRelayer) ContractAddress() common.Address {
+	return common.HexToAddress("0x24cD979DBd0Ae924a3f0c832a724CF4C58E5C210")
+}
+
+const relayProvider = "0x1111111111111111111111111111111111111111"
+
+func newRelayEngine(t *testing.T, rel DepositRelayer, wallet string, perDay int, budget *big.Int) *gin.Engine {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", wallet)
+		c.Next()
+	})
+	h := NewHandler(daytona.NewClient("http://daytona.invalid", "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, relayProvider, nil, "", rdb, zap.NewNop(), "", nil, 0, 0, nil)
+	if rel != nil {
+		h.SetDepositRelay(rel, big.NewInt(1000), perDay, budget)
+	}
+	h.Register(api)
+	return r
+}
+
+// signedRelayBody builds a relay request body for an authorization signed by
+// key, depositing into key's own account.
+func signedRelayBody(t *testing.T, key *ecdsa.PrivateKey, rel *mockRelayer, amount, nonce int64, deadline time.Time) []byte {
+	t.Helper()
+	return signedRelayBodyTo(t, key, rel, crypto.PubkeyToAddress(key.PublicKey), amount, nonce, deadline)
+}
+
+// signedRelayBodyTo is signedRelayBody depositing into recipient.
+func signedRelayBodyTo(t *testing.T, key *ecdsa.PrivateKey, rel *mockRelayer, recipient common.Address, amount, nonce int64, deadline time.Time) []byte {
+	t.Helper()
+	a := auth.DepositAuthorization{
+		Recipient: recipient,
+		Provider:  common.HexToAddress(relayProvider),
+		Amount:    big.NewInt(amount),
+		Nonce:     big.NewInt(nonce),
+		Deadline:  deadline.Unix(),
+	}
+	sig, err := a.Sign(key, rel.ChainID(), rel.ContractAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(relayDepositRequest{
+		Recipient: a.Recipient.Hex(),
+		Amount:    fmt.Sprint(amount),
+		Nonce:     fmt.Sprint(nonce),
+		Deadline:  a.Deadline,
+		Signature: "0x" + hex.EncodeToString(sig),
+	})
+	return body
+}
+
+func postRelay(r *gin.Engine, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/account/deposit/relay", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRelayDeposit_Disabled(t *testing.T) {
+	r := newRelayEngine(t, nil, "0xWALLET", 1, nil)
+	if w := postRelay(r, []byte(`{}`)); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestRelayDeposit_ReplayReturnsOriginalTx(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	wallet := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	rel := &mockRelayer{}
+	r := newRelayEngine(t, rel, wallet, 5, nil)
+
+	body := signedRelayBody(t, key, rel, 500, 7, time.Now().Add(10*time.Minute))
+	w := postRelay(r, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var first map[string]any
+	json.Unmarshal(w.Body.Bytes(), &first)
+
+	w = postRelay(r, body)
+	var again map[string]any
+	json.Unmarshal(w.Body.Bytes(), &again)
+	if w.Code != http.StatusOK || again["tx_hash"] != first["tx_hash"] || again["replayed"] != true {
+		t.Errorf("replay: got %d %v, want original tx %v", w.Code, again, first["tx_hash"])
+	}
+	if len(rel.calls) != 1 {
+		t.Errorf("deposits sent: got %d want 1", len(rel.calls))
+	}
+}
+
+func TestRelayDeposit_Rejections(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	wallet := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	rel := &mockRelayer{}
+	r := newRelayEngine(t, rel, wallet, 5, nil)
+
+	cases := []struct {
+		name string
+		body []byte
+		want int
+	}{
+		{"expired", signedRelayBody(t, key, rel, 100, 1, time.Now().Add(-time.Second)), http.StatusBadRequest},
+		{"far deadline", signedRelayBody(t, key, rel, 100, 2, time.Now().Add(2*time.Hour)), http.StatusBadRequest},
+		{"over max", signedRelayBody(t, key, rel, 1001, 3, time.Now().Add(time.Minute)), http.StatusBadRequest},
+		{"other signer", signedRelayBody(t, other, rel, 100, 4, time.Now().Add(time.Minute)), http.StatusUnauthorized},
+		{"other recipient", signedRelayBodyTo(t, key, rel, crypto.PubkeyToAddress(other.PublicKey), 100, 5, time.Now().Add(time.Minute)), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if w := postRelay(r, tc.body); w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+	if len(rel.calls) != 0 {
+		t.Errorf("rejected authorizations must not deposit, got %d", len(rel.calls))
+	}
+}
+
+func TestRelayDeposit_RateLimited(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	wallet := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	rel := &mockRelayer{}
+	r := newRelayEngine(t, rel, wallet, 1, nil)
+
+	if w := postRelay(r, signedRelayBody(t, key, rel, 100, 1, time.Now().Add(time.Minute))); w.Code != http.StatusOK {
+		t.Fatalf("first: expected 200, got %d", w.Code)
+	}
+	w := postRelay(r, signedRelayBody(t, key, rel, 100, 2, time.Now().Add(time.Minute)))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second: expected 429, got %d", w.Code)
+	}
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["code"] != "RELAY_RATE_LIMIT" {
+		t.Errorf("code: got %v", resp["code"])
+	}
+	if len(rel.calls) != 1 {
+		t.Errorf("deposits sent: got %d want 1", len(rel.calls))
+	}
+}
+
+func TestRelayDeposit_UnsentTxCanBeRetried(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	wallet := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	rel := &mockRelayer{err: errors.New("rpc down")}
+	// The failed attempt must not use up the wallet's one relay a day, nor
+	// the budget for one deposit.
+	r := newRelayEngine(t, rel, wallet, 1, big.NewInt(100))
+
+	body := signedRelayBody(t, key, rel, 100, 9, time.Now().Add(time.Minute))
+	if w := postRelay(r, body); w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", w.Code)
+	}
+	rel.err = nil
+	if w := postRelay(r, body); w.Code != http.StatusOK {
+		t.Errorf("retry: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRelayDeposit_DailyBudget(t *testing.T) {
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	rel := &mockRelayer{}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	h := NewHandler(daytona.NewClient("http://daytona.invalid", "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, relayProvider, nil, "", rdb, zap.NewNop(), "", nil, 0, 0, nil)
+	h.SetDepositRelay(rel, big.NewInt(1000), 5, big.NewInt(1500))
+
+	// One engine per calling wallet, sharing the handler and its budget.
+	engineFor := func(key *ecdsa.PrivateKey) *gin.Engine {
+		r := gin.New()
+		h.Register(r.Group("/api", func(c *gin.Context) {
+			c.Set("wallet_address", crypto.PubkeyToAddress(key.PublicKey).Hex())
+			c.Next()
+		}))
+		return r
+	}
+	r1, r2 := engineFor(key1), engineFor(key2)
+
+	if w := postRelay(r1, signedRelayBody(t, key1, rel, 1000, 1, time.Now().Add(time.Minute))); w.Code != http.StatusOK {
+		t.Fatalf("first: got %d %s", w.Code, w.Body.String())
+	}
+	// The budget is shared by all wallets.
+	w := postRelay(r2, signedRelayBody(t, key2, rel, 600, 1, time.Now().Add(time.Minute)))
+	if w.Code != http.StatusTooManyRequests || !bytes.Contains(w.Body.Bytes(), []byte("RELAY_BUDGET_EXHAUSTED")) {
+		t.Fatalf("over budget: got %d %s", w.Code, w.Body.String())
+	}
+	if w := postRelay(r2, signedRelayBody(t, key2, rel, 500, 2, time.Now().Add(time.Minute))); w.Code != http.StatusOK {
+		t.Errorf("within what is left: got %d %s", w.Code, w.Body.String())
+	}
+	if len(rel.calls) != 2 {
+		t.Errorf("deposits sent: got %d want 2", len(rel.calls))
+	}
+}
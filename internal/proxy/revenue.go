@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+)
+
+// spendView is a user's spend as served, with the total also in 0G.
+type spendView struct {
+	settler.UserSpend
+	TotalFeeOG string `json:"total_fee_0g,omitempty"`
+}
+
+// handleAdminRevenue serves GET /admin/revenue: the provider's total settled
+// fees and its users ranked by spend. ?limit=N (default 10, 0 = all) caps the
+// users returned; ?order=asc lists the lowest spenders first. Admin only.
+func (h *Handler) handleAdminRevenue(c *gin.Context) {
+	if !h.isAdmin(c.GetString("wallet_address")) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "billing state unavailable"})
+		return
+	}
+	limit := 10
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order (want asc or desc)"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	provider := common.HexToAddress(h.providerAddress)
+	total, err := settler.ProviderRevenue(ctx, h.rdb, provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	spenders, err := settler.TopSpenders(ctx, h.rdb, provider, limit, order == "asc")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	users := make([]spendView, len(spenders))
+	for i, s := range spenders {
+		users[i] = spendView{UserSpend: s, TotalFeeOG: h.og(s.TotalFee)}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"provider":     provider.Hex(),
+		"total_fee":    total,
+		"total_fee_0g": h.og(total),
+		"order":        order,
+		"users":        users,
+	})
+}
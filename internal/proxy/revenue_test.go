@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/settler"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+func TestAdminRevenue(t *testing.T) {
+	r, rdb, _ := newAdminSessionsEngine(t, testAdmin, nil)
+	var vs []voucher.SandboxVoucher
+	for i, u := range []string{"0xAAAA000000000000000000000000000000000001", "0xAAAA000000000000000000000000000000000002"} {
+		vs = append(vs, voucher.SandboxVoucher{
+			SandboxID: "sb-1",
+			User:      common.HexToAddress(u),
+			Provider:  common.Address{}, // the handler's provider address is ""
+			TotalFee:  big.NewInt(int64(1e17 * (i + 1))),
+			Nonce:     big.NewInt(1),
+		})
+	}
+	settler.HandleStatuses(context.Background(), rdb, make(chan settler.StopSignal, 2), "voucher:queue:test", "item0", vs,
+		[]chain.SettlementStatus{chain.StatusSuccess, chain.StatusSuccess}, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/revenue?limit=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		TotalFee   string `json:"total_fee"`
+		TotalFeeOG string `json:"total_fee_0g"`
+		Users      []struct {
+			User     string `json:"user"`
+			TotalFee string `json:"total_fee"`
+		} `json:"users"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.TotalFee != "300000000000000000" || resp.TotalFeeOG == "" {
+		t.Errorf("total: %+v", resp)
+	}
+	if len(resp.Users) != 1 || resp.Users[0].User != vs[1].User.Hex() || resp.Users[0].TotalFee != "200000000000000000" {
+		t.Errorf("users: %+v", resp.Users)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/revenue?order=sideways", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad order: status %d", w.Code)
+	}
+
+	r, _, _ = newAdminSessionsEngine(t, "0xnotadmin", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/revenue", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status %d", w.Code)
+	}
+}
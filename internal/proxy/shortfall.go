@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/0gfoundation/0g-sandbox/internal/units"
+)
+
+// SetDepositContract sets the settlement contract named in 402 insufficient
+// balance responses as where to deposit. Empty omits it.
+func (h *Handler) SetDepositContract(addr string) {
+	h.depositContract = addr
+}
+
+// rejectInsufficientBalance replies 402 with the numbers behind the
+// rejection: the on-chain balance, what is reserved by in-flight requests,
+// what the request needs (createFee, computeCost) and the shortfall, each in
+// neuron and in 0G, plus where to deposit it.
+func (h *Handler) rejectInsufficientBalance(c *gin.Context, balance, available, createFee, computeCost *big.Int) {
+	required := new(big.Int).Add(createFee, computeCost)
+	shortfall := new(big.Int).Sub(required, available)
+	deposit := gin.H{
+		"provider":  h.providerAddress,
+		"amount":    shortfall.String(),
+		"amount_0g": units.FormatOG(shortfall),
+	}
+	if h.depositContract != "" {
+		deposit["contract"] = h.depositContract
+	}
+	c.JSON(http.StatusPaymentRequired, gin.H{
+		"error":        "insufficient balance",
+		"balance":      balance.String(),
+		"reserved":     new(big.Int).Sub(balance, available).String(),
+		"available":    available.String(),
+		"required":     required.String(),
+		"create_fee":   createFee.String(),
+		"compute_cost": computeCost.String(),
+		"shortfall":    shortfall.String(),
+		"balance_0g":   units.FormatOG(balance),
+		"available_0g": units.FormatOG(available),
+		"required_0g":  units.FormatOG(required),
+		"shortfall_0g": units.FormatOG(shortfall),
+		"deposit":      deposit,
+	})
+}
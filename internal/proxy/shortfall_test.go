@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/billing"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+type fixedBalance struct{ balance *big.Int }
+
+func (f fixedBalance) GetBalance(context.Context, common.Address, common.Address) (*big.Int, error) {
+	return f.balance, nil
+}
+
+func TestHandleCreate_InsufficientBalanceBody(t *testing.T) {
+	const (
+		wallet   = "0x00000000000000000000000000000000000000aa"
+		provider = "0x00000000000000000000000000000000000000bb"
+		contract = "0x00000000000000000000000000000000000000cc"
+	)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	// 0.3 0G on-chain, 0.1 0G of it reserved by an in-flight request.
+	balance, _ := new(big.Int).SetString("300000000000000000", 10)
+	reserved, _ := new(big.Int).SetString("100000000000000000", 10)
+	if err := billing.Reserve(context.Background(), rdb, wallet, provider, reserved, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	createFee, _ := new(big.Int).SetString("500000000000000000", 10) // 0.5 0G
+	perSec := big.NewInt(1_000_000_000_000)                          // per CPU and per GB
+	h := NewHandler(daytona.NewClient("http://daytona.invalid", "key"), &mockBilling{}, fixedBalance{balance}, nil, nil,
+		createFee, perSec, perSec, nil, provider, nil, "", rdb, zap.NewNop(), "", nil, 3600, 0, nil)
+	h.SetDepositContract(contract)
+	r := gin.New()
+	h.Register(r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", wallet)
+		c.Next()
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sandbox", bytes.NewReader([]byte(`{"cpu":2,"memory":4}`))))
+	if w.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected 402, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Error       string            `json:"error"`
+		Balance     string            `json:"balance"`
+		Reserved    string            `json:"reserved"`
+		Available   string            `json:"available"`
+		Required    string            `json:"required"`
+		CreateFee   string            `json:"create_fee"`
+		ComputeCost string            `json:"compute_cost"`
+		Shortfall   string            `json:"shortfall"`
+		BalanceOG   string            `json:"balance_0g"`
+		AvailableOG string            `json:"available_0g"`
+		RequiredOG  string            `json:"required_0g"`
+		ShortfallOG string            `json:"shortfall_0g"`
+		Deposit     map[string]string `json:"deposit"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// compute = (2 CPU + 4 GB) × 1e12 × 3600 s = 0.0216 0G; required = 0.5216 0G.
+	for _, f := range []struct{ name, got, want string }{
+		{"error", resp.Error, "insufficient balance"},
+		{"balance", resp.Balance, "300000000000000000"},
+		{"reserved", resp.Reserved, "100000000000000000"},
+		{"available", resp.Available, "200000000000000000"},
+		{"create_fee", resp.CreateFee, "500000000000000000"},
+		{"compute_cost", resp.ComputeCost, "21600000000000000"},
+		{"required", resp.Required, "521600000000000000"},
+		{"shortfall", resp.Shortfall, "321600000000000000"},
+		{"balance_0g", resp.BalanceOG, "0.3"},
+		{"available_0g", resp.AvailableOG, "0.2"},
+		{"required_0g", resp.RequiredOG, "0.5216"},
+		{"shortfall_0g", resp.ShortfallOG, "0.3216"},
+		{"deposit.provider", resp.Deposit["provider"], provider},
+		{"deposit.contract", resp.Deposit["contract"], contract},
+		{"deposit.amount", resp.Deposit["amount"], "321600000000000000"},
+		{"deposit.amount_0g", resp.Deposit["amount_0g"], "0.3216"},
+	} {
+		if f.got != f.want {
+			t.Errorf("%s: got %q want %q", f.name, f.got, f.want)
+		}
+	}
+}
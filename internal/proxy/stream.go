@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/auth"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+)
+
+const (
+	streamPingInterval = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+	// closeTokenExpired is sent when the authenticating token expires; the
+	// client should fetch a new token and reconnect with ?after_seq.
+	closeTokenExpired = 4001
+)
+
+// Tokens authenticate the socket, not cookies, so cross-origin upgrades are
+// safe to accept.
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// handleIssueToken returns a short-lived token for the signed-in wallet, used
+// to open the event stream from clients that cannot sign WebSocket headers.
+func (h *Handler) handleIssueToken(c *gin.Context) {
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "token store unavailable"})
+		return
+	}
+	token, expiresAt, err := auth.IssueToken(c.Request.Context(), h.rdb, c.GetString("wallet_address"), auth.TokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": expiresAt})
+}
+
+// handleEventStream serves GET /events as a WebSocket of the caller's billing
+// events (events.StreamEvent as JSON text frames). ?after_seq=N first replays
+// retained events with a higher sequence number so a reconnecting client does
+// not miss anything. The socket is closed with code 4001 when the token it was
+// opened with expires.
+func (h *Handler) handleEventStream(c *gin.Context) {
+	if h.rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "event stream unavailable"})
+		return
+	}
+	wallet := c.GetString("wallet_address")
+	var afterSeq int64
+	if s := c.Query("after_seq"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after_seq"})
+			return
+		}
+		afterSeq = n
+	}
+	expiresAt, ok := auth.TokenExpiresAt(c)
+	if !ok {
+		expiresAt = time.Now().Add(auth.TokenTTL).Unix()
+	}
+
+	conn, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade already answered the request
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(c.Request.Context()), time.Unix(expiresAt, 0))
+	defer cancel()
+
+	// Drain client frames so control messages are processed; a read error
+	// means the client went away.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Subscribe before replaying so nothing published in between is lost;
+	// duplicates are dropped by sequence number.
+	sub := h.rdb.Subscribe(ctx, events.UserChannel(wallet))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return
+	}
+	msgs := sub.Channel()
+
+	lastSeq := afterSeq
+	send := func(e events.StreamEvent) bool {
+		if e.Seq <= lastSeq {
+			return true
+		}
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout)) //nolint:errcheck
+		if err := conn.WriteJSON(e); err != nil {
+			return false
+		}
+		lastSeq = e.Seq
+		return true
+	}
+
+	backlog, err := events.Since(ctx, h.rdb, wallet, afterSeq)
+	if err != nil {
+		h.log.Warn("event stream: replay", zap.String("wallet", wallet), zap.Error(err))
+	}
+	for _, e := range backlog {
+		if !send(e) {
+			return
+		}
+	}
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				msg := websocket.FormatCloseMessage(closeTokenExpired, "token expired")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(streamWriteTimeout)) //nolint:errcheck
+			}
+			return
+		case m, ok := <-msgs:
+			if !ok {
+				return
+			}
+			var e events.StreamEvent
+			if json.Unmarshal([]byte(m.Payload), &e) != nil {
+				continue
+			}
+			if !send(e) {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
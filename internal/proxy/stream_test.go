@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/auth"
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+)
+
+// newStreamServer serves the handler behind the real auth middleware so the
+// stream is authenticated by token, as in production.
+func newStreamServer(t *testing.T) (*httptest.Server, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	r := gin.New()
+	NewHandler(daytona.NewClient("http://daytona.invalid", "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", rdb, zap.NewNop(), "", nil, 0, 0, nil).
+		Register(r.Group("/api", auth.MiddlewareWithOptions(rdb, auth.Options{TokenRoutes: []string{"/api/events"}})))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, rdb
+}
+
+func dialStream(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/events?" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		code := 0
+		if resp != nil {
+			code = resp.StatusCode
+		}
+		t.Fatalf("dial: %v (HTTP %d)", err, code)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) events.StreamEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second)) //nolint:errcheck
+	var e events.StreamEvent
+	if err := conn.ReadJSON(&e); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	return e
+}
+
+func TestEventStream_ReplayThenLive(t *testing.T) {
+	srv, rdb := newStreamServer(t)
+	ctx := context.Background()
+	const wallet = "0xAbC0000000000000000000000000000000000001"
+
+	events.Publish(ctx, rdb, wallet, events.StreamEvent{Type: events.TypeVoucherQueued, SandboxID: "sb-1"})  //nolint:errcheck
+	events.Publish(ctx, rdb, wallet, events.StreamEvent{Type: events.TypeVoucherSettled, SandboxID: "sb-1"}) //nolint:errcheck
+	events.Publish(ctx, rdb, "0xother", events.StreamEvent{Type: events.TypeVoucherQueued})                  //nolint:errcheck
+
+	token, _, err := auth.IssueToken(ctx, rdb, wallet, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialStream(t, srv, "token="+token+"&after_seq=1")
+
+	if e := readEvent(t, conn); e.Seq != 2 || e.Type != events.TypeVoucherSettled {
+		t.Fatalf("replay: got %+v, want seq 2 voucher_settled", e)
+	}
+
+	// Wallet casing must not matter for the channel.
+	events.Publish(ctx, rdb, strings.ToLower(wallet), events.StreamEvent{Type: events.TypeAutoStopped, SandboxID: "sb-1"}) //nolint:errcheck
+	if e := readEvent(t, conn); e.Seq != 3 || e.Type != events.TypeAutoStopped {
+		t.Fatalf("live: got %+v, want seq 3 auto_stopped", e)
+	}
+}
+
+func TestEventStream_ClosedOnTokenExpiry(t *testing.T) {
+	srv, rdb := newStreamServer(t)
+	token, _, err := auth.IssueToken(context.Background(), rdb, "0xWALLET", 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialStream(t, srv, "token="+token)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, closeTokenExpired) {
+		t.Fatalf("expected close %d on token expiry, got %v", closeTokenExpired, err)
+	}
+}
+
+func TestEventStream_RejectsMissingToken(t *testing.T) {
+	srv, _ := newStreamServer(t)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/events"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != 401 {
+		t.Fatalf("expected 401 without token, got err=%v resp=%v", err, resp)
+	}
+}
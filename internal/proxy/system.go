@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// systemCacheTTL bounds how stale GET /system may be. Short enough that an
+// operator checking an upgrade sees the new implementation almost at once.
+const systemCacheTTL = 15 * time.Second
+
+// SystemReader reads the deployment's static and semi-static parameters.
+// Satisfied by *chain.Client.
+type SystemReader interface {
+	ServiceInfoReader
+	ChainID() *big.Int
+	ContractAddress() common.Address
+	BeaconAddress(ctx context.Context) (common.Address, error)
+	BeaconImplementation(ctx context.Context, beacon common.Address) (common.Address, error)
+	LockTime(ctx context.Context) (*big.Int, error)
+	ProviderStake(ctx context.Context) (*big.Int, error)
+}
+
+// SystemInfo is the JSON view of the deployed system. Service is nil when the
+// configured provider has not registered a service.
+type SystemInfo struct {
+	ChainID        string        `json:"chain_id"`
+	Contract       string        `json:"contract_address"` // BeaconProxy
+	Beacon         string        `json:"beacon_address"`
+	Implementation string        `json:"implementation_address"`
+	LockTime       string        `json:"lock_time"` // seconds
+	ProviderStake  string        `json:"provider_stake"`
+	Service        *ProviderInfo `json:"service"`
+	FetchedAt      int64         `json:"fetched_at"`
+}
+
+// systemCache memoises the last successful SystemInfo read.
+type systemCache struct {
+	src      SystemReader
+	provider string
+	log      *zap.Logger
+
+	mu      sync.Mutex
+	info    *SystemInfo
+	etag    string // over info without FetchedAt: changes only with the chain
+	expires time.Time
+}
+
+// RegisterSystem mounts GET /system, which aggregates the chain ID, contract,
+// beacon and implementation addresses, LOCK_TIME, providerStake and the
+// configured provider's service registration. Results are cached for
+// systemCacheTTL; chain read failures answer 502 and are not cached. HEAD
+// and If-None-Match are honoured: the ETag hashes the on-chain values, so it
+// survives cache refreshes that find nothing changed.
+func RegisterSystem(rg gin.IRoutes, src SystemReader, providerAddress string, log *zap.Logger) {
+	sc := &systemCache{src: src, provider: providerAddress, log: log}
+	serve := func(c *gin.Context) {
+		info, etag, err := sc.get(c.Request.Context())
+		if err != nil {
+			sc.log.Warn("system info", zap.Error(err))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "chain read failed"})
+			return
+		}
+		writeCacheable(c, etag, info)
+	}
+	rg.GET("/system", serve)
+	rg.HEAD("/system", serve)
+}
+
+func (sc *systemCache) get(ctx context.Context) (*SystemInfo, string, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.info != nil && time.Now().Before(sc.expires) {
+		return sc.info, sc.etag, nil
+	}
+	info, err := sc.fetch(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	unstamped := *info
+	unstamped.FetchedAt = 0
+	etag, err := etagOf(unstamped)
+	if err != nil {
+		return nil, "", err
+	}
+	sc.info, sc.etag, sc.expires = info, etag, time.Now().Add(systemCacheTTL)
+	return info, etag, nil
+}
+
+func (sc *systemCache) fetch(ctx context.Context) (*SystemInfo, error) {
+	beacon, err := sc.src.BeaconAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	impl, err := sc.src.BeaconImplementation(ctx, beacon)
+	if err != nil {
+		return nil, err
+	}
+	lockTime, err := sc.src.LockTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stake, err := sc.src.ProviderStake(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info := &SystemInfo{
+		ChainID:        sc.src.ChainID().String(),
+		Contract:       sc.src.ContractAddress().Hex(),
+		Beacon:         beacon.Hex(),
+		Implementation: impl.Hex(),
+		LockTime:       lockTime.String(),
+		ProviderStake:  stake.String(),
+		FetchedAt:      time.Now().Unix(),
+	}
+	if common.IsHexAddress(sc.provider) {
+		provider := common.HexToAddress(sc.provider)
+		svc, err := sc.src.GetServiceInfo(ctx, provider)
+		if err != nil {
+			return nil, err
+		}
+		if svc != nil {
+			pi := NewProviderInfo(provider.Hex(), svc)
+			info.Service = &pi
+		}
+	}
+	return info, nil
+}
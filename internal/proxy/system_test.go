@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+)
+
+type mockSystemReader struct {
+	mockServiceReader
+	impl     common.Address
+	lockErr  error
+	implRead int
+}
+
+func (m *mockSystemReader) ChainID() *big.Int { return big.NewInt(16602) }
+func (m *mockSystemReader) ContractAddress() common.Address {
+	return common.HexToAddress("0x24cD979DBd0Ae924a3f0c832a724CF4C58E5C210")
+}
+func (m *mockSystemReader) BeaconAddress(context.Context) (common.Address, error) {
+	return testBeacon, nil
+}
+func (m *mockSystemReader) BeaconImplementation(context.Context, common.Address) (common.Address, error) {
+	m.implRead++
+	return m.impl, nil
+}
+func (m *mockSystemReader) LockTime(context.Context) (*big.Int, error) {
+	if m.lockErr != nil {
+		return nil, m.lockErr
+	}
+	return big.NewInt(7200), nil
+}
+func (m *mockSystemReader) ProviderStake(context.Context) (*big.Int, error) {
+	return big.NewInt(100000000000000000), nil
+}
+
+var testBeacon = common.HexToAddress("0xBEAC000000000000000000000000000000000001")
+
+func newSystemEngine(src SystemReader) *gin.Engine {
+	r := gin.New()
+	RegisterSystem(r.Group("/api"), src, selfProvider.Hex(), zap.NewNop())
+	return r
+}
+
+func getSystem(t *testing.T, r *gin.Engine) (int, SystemInfo) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/system", nil))
+	var got SystemInfo
+	json.Unmarshal(w.Body.Bytes(), &got)
+	return w.Code, got
+}
+
+func TestSystem_AggregatesAndCaches(t *testing.T) {
+	src := &mockSystemReader{
+		mockServiceReader: mockServiceReader{services: map[common.Address]*chain.ServiceInfo{
+			selfProvider: {
+				URL:                 "https://p1.example",
+				TEESignerAddress:    selfProvider,
+				PricePerCPUPerMin:   big.NewInt(600),
+				PricePerMemGBPerMin: big.NewInt(120),
+				CreateFee:           big.NewInt(5000000),
+				SignerVersion:       big.NewInt(1),
+			},
+		}},
+		impl: common.HexToAddress("0x1A1A000000000000000000000000000000000001"),
+	}
+	r := newSystemEngine(src)
+
+	code, got := getSystem(t, r)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if got.ChainID != "16602" || got.Beacon != testBeacon.Hex() ||
+		got.Implementation != src.impl.Hex() || got.LockTime != "7200" ||
+		got.ProviderStake != "100000000000000000" || got.Contract != src.ContractAddress().Hex() {
+		t.Errorf("unexpected system info: %+v", got)
+	}
+	if got.Service == nil || got.Service.URL != "https://p1.example" || got.Service.CreateFee != "5000000" {
+		t.Errorf("service: got %+v", got.Service)
+	}
+
+	// A second read within the TTL is served from cache.
+	src.impl = common.HexToAddress("0x2B2B000000000000000000000000000000000002")
+	if _, again := getSystem(t, r); again.Implementation != got.Implementation || src.implRead != 1 {
+		t.Errorf("expected cached response, got impl %s after %d reads", again.Implementation, src.implRead)
+	}
+}
+
+func TestSystem_ServiceNotRegistered(t *testing.T) {
+	r := newSystemEngine(&mockSystemReader{})
+
+	code, got := getSystem(t, r)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if got.Service != nil {
+		t.Errorf("service: got %+v want null", got.Service)
+	}
+}
+
+func TestSystem_ChainErrorNotCached(t *testing.T) {
+	src := &mockSystemReader{lockErr: errors.New("rpc down")}
+	r := newSystemEngine(src)
+
+	if code, _ := getSystem(t, r); code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", code)
+	}
+	src.lockErr = nil
+	if code, _ := getSystem(t, r); code != http.StatusOK {
+		t.Errorf("after recovery: expected 200, got %d", code)
+	}
+}
+
+func TestSystem_ETagFollowsChainValues(t *testing.T) {
+	src := &mockSystemReader{impl: common.HexToAddress("0x1A1A000000000000000000000000000000000001")}
+	sc := &systemCache{src: src, log: zap.NewNop()}
+	ctx := context.Background()
+
+	_, first, err := sc.get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A refresh that finds nothing changed keeps the tag, despite fetched_at.
+	sc.expires = time.Time{}
+	sc.info.FetchedAt--
+	if _, again, _ := sc.get(ctx); again != first {
+		t.Errorf("ETag changed across an unchanged refresh: %s -> %s", first, again)
+	}
+	sc.expires = time.Time{}
+	src.impl = common.HexToAddress("0x2B2B000000000000000000000000000000000002")
+	if _, upgraded, _ := sc.get(ctx); upgraded == first {
+		t.Error("ETag unchanged after a beacon upgrade")
+	}
+}
+
+func TestSystem_ConditionalAndHead(t *testing.T) {
+	r := newSystemEngine(&mockSystemReader{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/system", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET: status %d, ETag %q", w.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/system", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match: status %d, body %q; want 304 and none", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/api/system", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("ETag") != etag || w.Header().Get("Content-Length") == "" {
+		t.Errorf("HEAD: status %d, body %q, headers %v", w.Code, w.Body.String(), w.Header())
+	}
+}
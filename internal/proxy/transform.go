@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Route keys for SetResponseTransform. Paths are relative to the Daytona API
+// prefix, as in ForwardRule.
+const (
+	RouteCreate = "POST /sandbox"
+	RouteList   = "GET /sandbox"
+	RouteGet    = "GET /sandbox/:id"
+	RoutePorts  = "GET /sandbox/:id/ports/*" // port previews, e.g. preview-url
+)
+
+// ResponseTransform rewrites a successful (2xx) JSON response body before it
+// is written to the client. It runs after the owner label and seal key have
+// been stripped. On error the untransformed body is sent.
+type ResponseTransform func(body []byte) ([]byte, error)
+
+// SetResponseTransform appends t to the transforms applied to route's
+// responses; transforms run in the order they were added. No transforms are
+// installed by default.
+func (h *Handler) SetResponseTransform(route string, t ResponseTransform) {
+	if t == nil {
+		return
+	}
+	if h.transforms == nil {
+		h.transforms = make(map[string][]ResponseTransform)
+	}
+	h.transforms[route] = append(h.transforms[route], t)
+}
+
+// SetPublicBaseURL rewrites URLs under the Daytona base URL to base in
+// sandbox responses (create, list, get and port previews), so clients are
+// handed preview and toolbox URLs they can reach. Empty base is a no-op.
+func (h *Handler) SetPublicBaseURL(base string) {
+	if base == "" {
+		return
+	}
+	t := RewriteBaseURL(h.dtona.BaseURL(), base)
+	for _, route := range []string{RouteCreate, RouteList, RouteGet, RoutePorts} {
+		h.SetResponseTransform(route, t)
+	}
+}
+
+// hasTransforms reports whether any transform is installed for route.
+func (h *Handler) hasTransforms(route string) bool {
+	return len(h.transforms[route]) > 0
+}
+
+// transformResponse applies route's transforms to body in order. A failing
+// transform is logged and skipped.
+func (h *Handler) transformResponse(route string, body []byte) []byte {
+	for i, t := range h.transforms[route] {
+		out, err := t(body)
+		if err != nil {
+			h.log.Warn("response transform failed", zap.String("route", route), zap.Int("index", i), zap.Error(err))
+			continue
+		}
+		body = out
+	}
+	return body
+}
+
+// RewriteBaseURL returns a transform that replaces the from prefix with to in
+// every JSON string value that is from itself or starts with from followed by
+// "/", "?" or "#". Trailing slashes on either base are ignored.
+func RewriteBaseURL(from, to string) ResponseTransform {
+	from = strings.TrimRight(from, "/")
+	to = strings.TrimRight(to, "/")
+	return func(body []byte) ([]byte, error) {
+		if from == "" || from == to || !bytes.Contains(body, []byte(from)) {
+			return body, nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber() // keep large integers intact
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("decode body: %w", err)
+		}
+		doc = rewriteStrings(doc, func(s string) string {
+			if rest, ok := strings.CutPrefix(s, from); ok && (rest == "" || strings.ContainsRune("/?#", rune(rest[0]))) {
+				return to + rest
+			}
+			return s
+		})
+		// Leave "&" in query strings unescaped.
+		var out bytes.Buffer
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("encode body: %w", err)
+		}
+		return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+	}
+}
+
+// rewriteStrings applies fn to every string value in a decoded JSON document.
+// Object keys are left unchanged.
+func rewriteStrings(v any, fn func(string) string) any {
+	switch v := v.(type) {
+	case string:
+		return fn(v)
+	case map[string]any:
+		for k, e := range v {
+			v[k] = rewriteStrings(e, fn)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = rewriteStrings(e, fn)
+		}
+	}
+	return v
+}
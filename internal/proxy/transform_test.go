@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/daytona"
+)
+
+// newTransformEngine serves sb-1 (owned by 0xOWNER) from a mock Daytona whose
+// responses carry URLs under its own base URL. Returns the engine and that base.
+func newTransformEngine(t *testing.T, publicBase string) (*gin.Engine, string) {
+	t.Helper()
+	var base string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sandbox", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":"sb-1","labels":{"daytona-owner":"0xOWNER"}}]`)
+	})
+	mux.HandleFunc("GET /api/sandbox/sb-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"sb-1","labels":{"daytona-owner":"0xOWNER"},"toolboxProxyUrl":%q,"cpu":2}`, base+"/toolbox")
+	})
+	mux.HandleFunc("GET /api/sandbox/sb-1/ports/8080/preview-url", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"url":%q,"token":"tok"}`, base+"/preview/8080?a=1&b=2")
+	})
+	mux.HandleFunc("POST /api/sandbox", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":"sb-new","toolboxProxyUrl":%q}`, base+"/toolbox")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	base = srv.URL
+
+	h := NewHandler(daytona.NewClient(srv.URL, "key"), &mockBilling{}, nil, nil, nil, nil, nil, nil, nil, "", nil, "", nil, zap.NewNop(), "", nil, 0, 0, nil)
+	h.SetPublicBaseURL(publicBase)
+	r := gin.New()
+	h.Register(r.Group("/api", func(c *gin.Context) {
+		c.Set("wallet_address", "0xOWNER")
+		c.Next()
+	}))
+	return r, base
+}
+
+func TestPublicBaseURL_RewritesSandboxResponses(t *testing.T) {
+	const public = "https://sandbox.example.com"
+	r, base := newTransformEngine(t, public+"/")
+
+	for _, tc := range []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodGet, "/api/sandbox/sb-1", `"toolboxProxyUrl":"` + public + `/toolbox"`},
+		{http.MethodGet, "/api/sandbox/sb-1/ports/8080/preview-url", `"url":"` + public + `/preview/8080?a=1&b=2"`},
+		{http.MethodPost, "/api/sandbox", `"toolboxProxyUrl":"` + public + `/toolbox"`},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, bytes.NewReader([]byte(`{}`))))
+		if w.Code < 200 || w.Code >= 300 {
+			t.Fatalf("%s %s: got %d: %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, tc.want) {
+			t.Errorf("%s %s: body %s does not contain %s", tc.method, tc.path, body, tc.want)
+		}
+		if strings.Contains(body, base) {
+			t.Errorf("%s %s: internal Daytona base leaked: %s", tc.method, tc.path, body)
+		}
+		if strings.Contains(body, ownerLabel) {
+			t.Errorf("%s %s: owner label must still be stripped: %s", tc.method, tc.path, body)
+		}
+	}
+}
+
+func TestPublicBaseURL_UnsetIsNoOp(t *testing.T) {
+	r, base := newTransformEngine(t, "")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sandbox/sb-1/ports/8080/preview-url", nil))
+	want := fmt.Sprintf(`{"url":%q,"token":"tok"}`, base+"/preview/8080?a=1&b=2")
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("got %d %s, want 200 %s", w.Code, w.Body.String(), want)
+	}
+}
+
+func TestRewriteBaseURL(t *testing.T) {
+	rewrite := RewriteBaseURL("http://daytona:3000/", "https://pub.example")
+	for _, tc := range []struct{ in, want string }{
+		{`{"u":"http://daytona:3000"}`, `{"u":"https://pub.example"}`},
+		{`{"u":"http://daytona:3000/x?y=1"}`, `{"u":"https://pub.example/x?y=1"}`},
+		{`{"u":"http://daytona:30001/x"}`, `{"u":"http://daytona:30001/x"}`}, // different port
+		{`[{"n":12345678901234567890,"u":["http://daytona:3000#f"]}]`, `[{"n":12345678901234567890,"u":["https://pub.example#f"]}]`},
+		{`{"http://daytona:3000":1}`, `{"http://daytona:3000":1}`}, // keys untouched
+	} {
+		got, err := rewrite([]byte(tc.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.in, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got %s want %s", tc.in, got, tc.want)
+		}
+	}
+	if _, err := rewrite([]byte(`not json http://daytona:3000`)); err == nil {
+		t.Error("expected an error for a non-JSON body")
+	}
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// maxVerifyBodyBytes bounds a POST /verify-voucher body: one voucher with its
+// usage breakdown and labels.
+const maxVerifyBodyBytes = 64 << 10
+
+// maxTEESignerEntries bounds the teeSignerCache: callers choose the provider
+// address, so an entry is evicted for each new one past this many.
+const maxTEESignerEntries = 1024
+
+// verifyVoucherRate and verifyVoucherBurst bound POST /verify-voucher across
+// all callers: it is unauthenticated, and each provider it has not seen
+// costs a chain read.
+const (
+	verifyVoucherRate  = 20 // requests per second
+	verifyVoucherBurst = 40
+)
+
+// VoucherVerifySource reads what POST /verify-voucher checks a voucher
+// against. Satisfied by *chain.Client.
+type VoucherVerifySource interface {
+	ServiceInfoReader
+	ChainID() *big.Int
+	ContractAddress() common.Address
+}
+
+// verifyVoucherRequest is the POST /verify-voucher body. ChainID and
+// ContractAddress default to the configured deployment.
+type verifyVoucherRequest struct {
+	Voucher         *voucher.SandboxVoucher `json:"voucher"`
+	ChainID         int64                   `json:"chain_id,omitempty"`
+	ContractAddress string                  `json:"contract_address,omitempty"`
+}
+
+// VoucherVerification is the POST /verify-voucher response. TEESigner and
+// MatchesTEESigner are set only for the configured deployment, whose
+// contract this server can read; TEESigner is empty when the voucher's
+// provider has no registered service.
+type VoucherVerification struct {
+	Signer           string `json:"signer"`
+	Digest           string `json:"digest"`
+	DomainSeparator  string `json:"domain_separator"`
+	ChainID          string `json:"chain_id"`
+	ContractAddress  string `json:"contract_address"`
+	Provider         string `json:"provider"`
+	TEESigner        string `json:"tee_signer,omitempty"`
+	MatchesTEESigner *bool  `json:"matches_tee_signer,omitempty"`
+}
+
+// teeSignerCache memoises each provider's on-chain teeSignerAddress for
+// systemCacheTTL, so the unauthenticated endpoint cannot drive one chain read
+// per request. Concurrent misses for one provider share a single read, made
+// without holding mu.
+type teeSignerCache struct {
+	src     ServiceInfoReader
+	fetches singleflight.Group
+
+	mu      sync.Mutex
+	entries map[common.Address]teeSignerEntry
+}
+
+type teeSignerEntry struct {
+	signer  common.Address // zero = provider not registered
+	expires time.Time
+}
+
+func (tc *teeSignerCache) get(ctx context.Context, provider common.Address) (common.Address, error) {
+	tc.mu.Lock()
+	e, ok := tc.entries[provider]
+	tc.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.signer, nil
+	}
+	// The read outlives a caller that gives up, like fetchSandbox, so one
+	// cancelled request does not fail the others waiting on it.
+	ch := tc.fetches.DoChan(provider.Hex(), func() (any, error) {
+		svc, err := tc.src.GetServiceInfo(context.WithoutCancel(ctx), provider)
+		if err != nil {
+			return nil, err
+		}
+		var signer common.Address
+		if svc != nil {
+			signer = svc.TEESignerAddress
+		}
+		tc.put(provider, signer)
+		return signer, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return common.Address{}, res.Err
+		}
+		return res.Val.(common.Address), nil
+	case <-ctx.Done():
+		return common.Address{}, ctx.Err()
+	}
+}
+
+// put caches provider's signer. At maxTEESignerEntries it first evicts one
+// entry, an expired one if any.
+func (tc *teeSignerCache) put(provider, signer common.Address) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if _, ok := tc.entries[provider]; !ok && len(tc.entries) >= maxTEESignerEntries {
+		now := time.Now()
+		var victim common.Address
+		for addr, e := range tc.entries {
+			victim = addr
+			if !now.Before(e.expires) {
+				break
+			}
+		}
+		delete(tc.entries, victim)
+	}
+	tc.entries[provider] = teeSignerEntry{signer: signer, expires: time.Now().Add(systemCacheTTL)}
+}
+
+// RegisterVerifyVoucher mounts POST /verify-voucher, which recovers the signer
+// of a voucher and returns its EIP-712 digest, so integrators and auditors
+// can check a voucher without a node. Read-only and unauthenticated, so it is
+// rate-limited (verifyVoucherRate) across all callers.
+//
+// domain returns the separator of the configured deployment as the signer
+// uses it (it follows beacon upgrades); vouchers for another chain or
+// contract are checked against domainName and domainVersion.
+func RegisterVerifyVoucher(rg gin.IRoutes, src VoucherVerifySource, domain func() [32]byte, domainName, domainVersion string, log *zap.Logger) {
+	signers := &teeSignerCache{src: src, entries: map[common.Address]teeSignerEntry{}}
+	limiter := rate.NewLimiter(verifyVoucherRate, verifyVoucherBurst)
+	rg.POST("/verify-voucher", func(c *gin.Context) {
+		if !limiter.Allow() {
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many verify requests", "code": "RATE_LIMITED"})
+			return
+		}
+		var req verifyVoucherRequest
+		dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxVerifyBodyBytes))
+		if err := dec.Decode(&req); err != nil || req.Voucher == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body (want {\"voucher\": {...}})"})
+			return
+		}
+		v := req.Voucher
+		switch {
+		case v.TotalFee == nil || v.TotalFee.Sign() < 0 || v.TotalFee.BitLen() > 256:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "total_fee must be a uint256"})
+			return
+		case v.Nonce == nil || v.Nonce.Sign() < 0 || v.Nonce.BitLen() > 256:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nonce must be a uint256"})
+			return
+		case len(v.Signature) != 65:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "signature must be 65 bytes"})
+			return
+		case req.ChainID < 0:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chain_id"})
+			return
+		}
+
+		chainID, contract := src.ChainID(), src.ContractAddress()
+		configured := true
+		if req.ChainID != 0 && req.ChainID != chainID.Int64() {
+			chainID, configured = big.NewInt(req.ChainID), false
+		}
+		if req.ContractAddress != "" {
+			if !common.IsHexAddress(req.ContractAddress) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid contract_address"})
+				return
+			}
+			if addr := common.HexToAddress(req.ContractAddress); addr != contract {
+				contract, configured = addr, false
+			}
+		}
+		var sep [32]byte
+		if configured {
+			sep = domain()
+		} else {
+			sep = voucher.DomainSeparatorFor(domainName, domainVersion, chainID, contract)
+		}
+
+		signer, err := voucher.RecoverWithDomain(v, sep)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recover signer: " + err.Error()})
+			return
+		}
+		resp := VoucherVerification{
+			Signer:          signer.Hex(),
+			Digest:          common.Hash(v.DigestWithDomain(sep)).Hex(),
+			DomainSeparator: common.Hash(sep).Hex(),
+			ChainID:         chainID.String(),
+			ContractAddress: contract.Hex(),
+			Provider:        v.Provider.Hex(),
+		}
+		if configured {
+			tee, err := signers.get(c.Request.Context(), v.Provider)
+			if err != nil {
+				log.Warn("verify-voucher: read teeSignerAddress", zap.String("provider", v.Provider.Hex()), zap.Error(err))
+				c.JSON(http.StatusBadGateway, gin.H{"error": "chain read failed"})
+				return
+			}
+			matches := tee != (common.Address{}) && tee == signer
+			resp.MatchesTEESigner = &matches
+			if tee != (common.Address{}) {
+				resp.TEESigner = tee.Hex()
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+func postVerifyVoucher(t *testing.T, r *gin.Engine, body any) (int, VoucherVerification) {
+	t.Helper()
+	raw, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/verify-voucher", bytes.NewReader(raw)))
+	var got VoucherVerification
+	json.Unmarshal(w.Body.Bytes(), &got)
+	return w.Code, got
+}
+
+func TestVerifyVoucher(t *testing.T) {
+	teeKey, _ := crypto.GenerateKey()
+	tee := crypto.PubkeyToAddress(teeKey.PublicKey)
+	src := &mockSystemReader{mockServiceReader: mockServiceReader{services: map[common.Address]*chain.ServiceInfo{
+		selfProvider: {TEESignerAddress: tee},
+	}}}
+	sep := voucher.DomainSeparatorFor(voucher.DefaultDomainName, voucher.DefaultDomainVersion, src.ChainID(), src.ContractAddress())
+	r := gin.New()
+	RegisterVerifyVoucher(r.Group("/api"), src, func() [32]byte { return sep }, voucher.DefaultDomainName, voucher.DefaultDomainVersion, zap.NewNop())
+
+	v := voucher.SandboxVoucher{
+		SandboxID: "sb-1",
+		User:      common.HexToAddress("0xAAAA000000000000000000000000000000000001"),
+		Provider:  selfProvider,
+		TotalFee:  big.NewInt(5_000_000),
+		UsageHash: voucher.BuildUsageHash("sb-1", 1_700_000_000, 1_700_000_060, 60),
+		Nonce:     big.NewInt(3),
+	}
+	if err := voucher.SignWithDomain(&v, teeKey, sep); err != nil {
+		t.Fatal(err)
+	}
+
+	code, got := postVerifyVoucher(t, r, gin.H{"voucher": v})
+	if code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if got.Signer != tee.Hex() || got.TEESigner != tee.Hex() || got.MatchesTEESigner == nil || !*got.MatchesTEESigner {
+		t.Errorf("configured deployment: %+v", got)
+	}
+	if want := common.Hash(v.DigestWithDomain(sep)).Hex(); got.Digest != want {
+		t.Errorf("digest: got %s want %s", got.Digest, want)
+	}
+
+	// Signed by another key: recovered, but not the provider's TEE signer.
+	otherKey, _ := crypto.GenerateKey()
+	forged := v
+	voucher.SignWithDomain(&forged, otherKey, sep) //nolint:errcheck
+	if _, got := postVerifyVoucher(t, r, gin.H{"voucher": forged}); got.MatchesTEESigner == nil || *got.MatchesTEESigner {
+		t.Errorf("forged voucher: %+v", got)
+	}
+
+	// Another deployment: the domain changes, and the TEE signer is not read.
+	other := common.HexToAddress("0x00000000000000000000000000000000000000c2")
+	code, got = postVerifyVoucher(t, r, gin.H{"voucher": v, "chain_id": 1, "contract_address": other.Hex()})
+	if code != http.StatusOK || got.ChainID != "1" || got.ContractAddress != other.Hex() ||
+		got.Signer == tee.Hex() || got.MatchesTEESigner != nil || got.TEESigner != "" {
+		t.Errorf("other deployment: %d %+v", code, got)
+	}
+
+	unsigned := v
+	unsigned.Signature = nil
+	if code, _ := postVerifyVoucher(t, r, gin.H{"voucher": unsigned}); code != http.StatusBadRequest {
+		t.Errorf("unsigned voucher: status %d", code)
+	}
+	if code, _ := postVerifyVoucher(t, r, gin.H{}); code != http.StatusBadRequest {
+		t.Errorf("missing voucher: status %d", code)
+	}
+}
+
+// A full cache evicts a single entry, preferring an expired one, rather than
+// dropping everything.
+func TestTEESignerCache_EvictsOne(t *testing.T) {
+	tc := &teeSignerCache{entries: map[common.Address]teeSignerEntry{}}
+	for i := 0; i < maxTEESignerEntries; i++ {
+		tc.put(common.BigToAddress(big.NewInt(int64(i+1))), common.Address{})
+	}
+	stale := common.BigToAddress(big.NewInt(7))
+	tc.entries[stale] = teeSignerEntry{expires: time.Now().Add(-time.Second)}
+
+	tc.put(selfProvider, common.Address{})
+	if len(tc.entries) != maxTEESignerEntries {
+		t.Errorf("entries: got %d want %d", len(tc.entries), maxTEESignerEntries)
+	}
+	if _, ok := tc.entries[stale]; ok {
+		t.Error("expired entry should have been evicted")
+	}
+	if _, ok := tc.entries[selfProvider]; !ok {
+		t.Error("new entry missing")
+	}
+}
+
+func TestVerifyVoucher_RateLimited(t *testing.T) {
+	r := gin.New()
+	RegisterVerifyVoucher(r.Group("/api"), &mockSystemReader{}, func() [32]byte { return [32]byte{} }, voucher.DefaultDomainName, voucher.DefaultDomainVersion, zap.NewNop())
+	limited := 0
+	for i := 0; i < 2*verifyVoucherBurst; i++ {
+		if code, _ := postVerifyVoucher(t, r, gin.H{}); code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited == 0 {
+		t.Errorf("%d requests in a burst: none rate-limited", 2*verifyVoucherBurst)
+	}
+}
@@ -0,0 +1,80 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Audit events. The lifecycle events are written by the billing hooks, the
+// settled event by the settler once one of the sandbox's vouchers settles.
+const (
+	AuditCreated  = "created"
+	AuditStarted  = "started"
+	AuditStopped  = "stopped"
+	AuditDeleted  = "deleted"
+	AuditArchived = "archived"
+	AuditSettled  = "settled"
+)
+
+const (
+	auditKeyPrefix = "audit:"
+	// maxAuditEntries caps the per-sandbox timeline; older entries are
+	// trimmed. The list shares receiptTTL so the timeline outlives the
+	// session as long as its receipts do.
+	maxAuditEntries = 100
+)
+
+// AuditEntry is one event in a sandbox's billing timeline. Nonces are only
+// assigned when a voucher is signed for settlement, so lifecycle entries
+// carry none; the settled entries that follow them do.
+type AuditEntry struct {
+	Event  string `json:"event"`
+	At     int64  `json:"at"`
+	Fee    string `json:"fee,omitempty"`    // neuron charged by the event, or settled
+	Nonce  string `json:"nonce,omitempty"`  // settled voucher's nonce
+	Status string `json:"status,omitempty"` // settlement status, lowercased
+	// LifetimeCost snapshots the sandbox's settled lifetime cost (neuron) on
+	// the deleted entry; vouchers still queued at the delete are not in it.
+	LifetimeCost string `json:"lifetime_cost,omitempty"`
+}
+
+func auditKey(sandboxID string) string {
+	return auditKeyPrefix + sandboxID
+}
+
+// AppendAudit appends e to the sandbox's audit timeline, oldest first. Errors
+// are ignored: the timeline is a debugging aid and must never fail billing.
+func AppendAudit(ctx context.Context, rdb *redis.Client, sandboxID string, e AuditEntry) {
+	if sandboxID == "" {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	key := auditKey(sandboxID)
+	pipe := rdb.TxPipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -maxAuditEntries, -1)
+	pipe.Expire(ctx, key, receiptTTL)
+	pipe.Exec(ctx) //nolint:errcheck
+}
+
+// ListAudit returns the sandbox's retained audit timeline, oldest first.
+func ListAudit(ctx context.Context, rdb *redis.Client, sandboxID string) ([]AuditEntry, error) {
+	raw, err := rdb.LRange(ctx, auditKey(sandboxID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(raw))
+	for _, s := range raw {
+		var e AuditEntry
+		if err := json.Unmarshal([]byte(s), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
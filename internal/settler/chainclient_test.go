@@ -0,0 +1,353 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// settleStep is one scripted SettleFeesWithTEE result.
+type settleStep struct {
+	statuses []chain.SettlementStatus // returned as-is; nil = StatusSuccess for every voucher
+	err      error                    // e.g. a reverted tx
+}
+
+// fakeChainClient is a ChainClient that answers each SettleFeesWithTEE call
+// with the next step of its script (the last step repeats) and records every
+// submitted batch on calls.
+type fakeChainClient struct {
+	mu     sync.Mutex
+	script []settleStep
+	calls  chan []voucher.SandboxVoucher
+}
+
+func newFakeChainClient(script ...settleStep) *fakeChainClient {
+	return &fakeChainClient{script: script, calls: make(chan []voucher.SandboxVoucher, 16)}
+}
+
+func (f *fakeChainClient) SettleFeesWithTEE(_ context.Context, vs []voucher.SandboxVoucher) ([]chain.SettlementStatus, error) {
+	f.mu.Lock()
+	step := settleStep{}
+	if len(f.script) > 0 {
+		step = f.script[0]
+		if len(f.script) > 1 {
+			f.script = f.script[1:]
+		}
+	}
+	f.mu.Unlock()
+	f.calls <- append([]voucher.SandboxVoucher(nil), vs...)
+	if step.err != nil {
+		return nil, step.err
+	}
+	if step.statuses == nil {
+		return make([]chain.SettlementStatus, len(vs)), nil
+	}
+	return step.statuses, nil
+}
+
+// next returns the next submitted batch.
+func (f *fakeChainClient) next(t *testing.T) []voucher.SandboxVoucher {
+	t.Helper()
+	select {
+	case vs := <-f.calls:
+		return vs
+	case <-time.After(3 * time.Second):
+		t.Fatal("no batch submitted")
+		return nil
+	}
+}
+
+// startSettler queues vs and runs the settler against onchain until the test
+// ends. Retries back off by 10ms instead of retryBackoff or nonceRetryBackoff.
+func startSettler(t *testing.T, onchain ChainClient, stopCh chan StopSignal, vs ...voucher.SandboxVoucher) (*redis.Client, string) {
+	t.Helper()
+	return startEncryptedSettler(t, "", onchain, stopCh, vs...)
+}
+
+// startEncryptedSettler is startSettler with REDIS_ENCRYPTION_KEY set to
+// encryptionKey; vs are queued sealed with its first key.
+func startEncryptedSettler(t *testing.T, encryptionKey string, onchain ChainClient, stopCh chan StopSignal, vs ...voucher.SandboxVoucher) (*redis.Client, string) {
+	t.Helper()
+	return startSettlerWith(t, func(cfg *config.Config, _ *redis.Client) { cfg.Redis.EncryptionKey = encryptionKey }, onchain, stopCh, vs...)
+}
+
+// startSettlerWith is startSettler with setup run on the config and Redis
+// before the settler starts.
+func startSettlerWith(t *testing.T, setup func(*config.Config, *redis.Client), onchain ChainClient, stopCh chan StopSignal, vs ...voucher.SandboxVoucher) (*redis.Client, string) {
+	t.Helper()
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	setup(cfg, rdb)
+	encryptionKey := cfg.Redis.EncryptionKey
+	codec, err := voucher.NewCodec(encryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
+	for _, v := range vs {
+		raw, _ := json.Marshal(v)
+		item, _ := codec.Seal(raw)
+		rdb.RPush(context.Background(), queueKey, item) //nolint:errcheck
+	}
+
+	saved, savedNonce := retryBackoff, nonceRetryBackoff
+	retryBackoff, nonceRetryBackoff = 10*time.Millisecond, 10*time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, cfg, rdb, onchain, nopSigner{}, stopCh, zap.NewNop())
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		retryBackoff, nonceRetryBackoff = saved, savedNonce
+	})
+	return rdb, queueKey
+}
+
+// waitDrained waits until the settler has popped the whole queue.
+func waitDrained(t *testing.T, rdb *redis.Client, queueKey string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for queueLen(t, rdb, queueKey) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue not drained: %d items left", queueLen(t, rdb, queueKey))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRun_TransientFailureRetriedUntilSettled(t *testing.T) {
+	fc := newFakeChainClient(
+		settleStep{err: errors.New(`Post "https://evmrpc-testnet.0g.ai": read: connection reset by peer`)},
+		settleStep{err: errors.New("wait mined: 429 Too Many Requests")},
+		settleStep{},
+	)
+	vs := []voucher.SandboxVoucher{nonceVoucher(testUser, 1), nonceVoucher(testUser, 2), nonceVoucher(testUser, 3)}
+	rdb, queueKey := startSettler(t, fc, make(chan StopSignal, 1), vs...)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if got := batchNonces(fc.next(t)); got != "A1,A2,A3" {
+			t.Fatalf("attempt %d: submitted %s, want the whole batch A1,A2,A3", attempt, got)
+		}
+	}
+	waitDrained(t, rdb, queueKey)
+	select {
+	case vs := <-fc.calls:
+		t.Errorf("settled batch submitted again: %s", batchNonces(vs))
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRun_PermanentFailureIsolatesVoucher(t *testing.T) {
+	reverted := settleStep{err: errors.New("tx reverted: 0xabc")}
+	fc := newFakeChainClient(reverted, settleStep{}, reverted, settleStep{})
+	vs := []voucher.SandboxVoucher{nonceVoucher(testUser, 1), nonceVoucher(testUser, 2), nonceVoucher(testUser, 3)}
+	rdb, queueKey := startSettler(t, fc, make(chan StopSignal, 1), vs...)
+
+	// The batch is not retried as is: its vouchers go one at a time, and the
+	// one the chain still rejects on its own is dead-lettered.
+	var got []string
+	for range 4 {
+		got = append(got, batchNonces(fc.next(t)))
+	}
+	if s := strings.Join(got, " "); s != "A1,A2,A3 A1 A2 A3" {
+		t.Fatalf("batches %q, want the batch, then A1, A2 and A3 alone", s)
+	}
+	waitDrained(t, rdb, queueKey)
+
+	ctx := context.Background()
+	dlq := rdb.LRange(ctx, dlqKey(testProvider), 0, -1).Val()
+	if len(dlq) != 1 {
+		t.Fatalf("DLQ has %d entries, want 1", len(dlq))
+	}
+	var entry dlqEntry
+	json.Unmarshal([]byte(dlq[0]), &entry) //nolint:errcheck
+	if entry.SandboxID != vs[1].SandboxID || entry.Reason != "chain_rejected" {
+		t.Errorf("DLQ entry %s/%s, want %s/chain_rejected", entry.SandboxID, entry.Reason, vs[1].SandboxID)
+	}
+	if n := rdb.HGet(ctx, MetricsKey, "settle_error_permanent").Val(); n != "2" {
+		t.Errorf("settle_error_permanent = %q, want 2", n)
+	}
+}
+
+// resyncingChain is a fakeChainClient that counts account nonce resyncs.
+type resyncingChain struct {
+	*fakeChainClient
+	resyncs atomic.Int32
+}
+
+func (r *resyncingChain) ResyncAccountNonce() { r.resyncs.Add(1) }
+
+func TestRun_NonceIssueResyncsAccount(t *testing.T) {
+	fc := &resyncingChain{fakeChainClient: newFakeChainClient(
+		settleStep{err: errors.New("SettleFeesWithTEE tx: nonce too low: next nonce 12, tx nonce 11")},
+		settleStep{},
+	)}
+	rdb, queueKey := startSettler(t, fc, make(chan StopSignal, 1), nonceVoucher(testUser, 1), nonceVoucher(testUser, 2))
+
+	first, retried := fc.next(t), fc.next(t)
+	if batchNonces(first) != "A1,A2" || batchNonces(retried) != "A1,A2" {
+		t.Fatalf("batches %s then %s, want A1,A2 twice", batchNonces(first), batchNonces(retried))
+	}
+	waitDrained(t, rdb, queueKey)
+	if n := fc.resyncs.Load(); n != 1 {
+		t.Errorf("account nonce resynced %d times, want 1", n)
+	}
+}
+
+func TestRun_PerVoucherStatuses(t *testing.T) {
+	fc := newFakeChainClient(settleStep{statuses: []chain.SettlementStatus{
+		chain.StatusSuccess,
+		chain.StatusInsufficientBalance,
+		chain.StatusProviderMismatch,
+		chain.StatusInvalidNonce,
+		chain.StatusNotAcknowledged,
+	}})
+	vs := make([]voucher.SandboxVoucher, 5)
+	for i := range vs {
+		vs[i] = nonceVoucher(testUser, int64(i+1))
+	}
+	stopCh := make(chan StopSignal, len(vs))
+	rdb, queueKey := startSettler(t, fc, stopCh, vs...)
+
+	if n := len(fc.next(t)); n != len(vs) {
+		t.Fatalf("batch of %d, want %d", n, len(vs))
+	}
+	waitDrained(t, rdb, queueKey)
+	ctx := context.Background()
+
+	want := map[string]StopReason{vs[1].SandboxID: StopInsufficientBalance, vs[4].SandboxID: StopNotAcknowledged}
+	for range want {
+		select {
+		case sig := <-stopCh:
+			if want[sig.SandboxID] != sig.Reason {
+				t.Errorf("stop signal %+v, want one of %v", sig, want)
+			}
+			if got := rdb.Get(ctx, StopKey(sig.SandboxID)).Val(); got != string(sig.Reason) {
+				t.Errorf("%s: stop key %q want %q", sig.SandboxID, got, sig.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("missing stop signal")
+		}
+	}
+	select {
+	case sig := <-stopCh:
+		t.Errorf("unexpected stop signal %+v", sig)
+	default:
+	}
+
+	dlq := rdb.LRange(ctx, dlqKey(testProvider), 0, -1).Val()
+	if len(dlq) != 1 {
+		t.Fatalf("DLQ has %d entries, want 1 (the provider mismatch)", len(dlq))
+	}
+	var entry dlqEntry
+	if err := json.Unmarshal([]byte(dlq[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.SandboxID != vs[2].SandboxID || entry.Reason != "provider_mismatch" {
+		t.Errorf("DLQ entry %s/%s, want %s/provider_mismatch", entry.SandboxID, entry.Reason, vs[2].SandboxID)
+	}
+}
+
+func TestRun_WrongStatusCountRequeuesBatch(t *testing.T) {
+	fc := newFakeChainClient(
+		settleStep{statuses: []chain.SettlementStatus{chain.StatusSuccess}}, // one status for two vouchers
+		settleStep{},
+	)
+	stopCh := make(chan StopSignal, 2)
+	rdb, queueKey := startSettler(t, fc, stopCh, nonceVoucher(testUser, 1), nonceVoucher(testUser, 2))
+
+	first, retried := fc.next(t), fc.next(t)
+	if batchNonces(first) != "A1,A2" || batchNonces(retried) != "A1,A2" {
+		t.Fatalf("batches %s then %s, want A1,A2 twice", batchNonces(first), batchNonces(retried))
+	}
+	waitDrained(t, rdb, queueKey)
+	if n := rdb.LLen(context.Background(), dlqKey(testProvider)).Val(); n != 0 {
+		t.Errorf("DLQ has %d entries, want none", n)
+	}
+	if len(stopCh) != 0 {
+		t.Errorf("%d stop signals, want none", len(stopCh))
+	}
+}
+
+func TestRun_EncryptedQueue(t *testing.T) {
+	const (
+		oldKey = "k1:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+		newKey = "k2:1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+	)
+	fc := newFakeChainClient(settleStep{statuses: []chain.SettlementStatus{
+		chain.StatusSuccess,
+		chain.StatusProviderMismatch,
+		chain.StatusSuccess,
+	}})
+	rdb, queueKey := startEncryptedSettler(t, newKey+","+oldKey, fc, make(chan StopSignal, 1), nonceVoucher(testUser, 1))
+
+	// Behind the item sealed with the current key: one sealed with the
+	// retired key, and one queued before encryption was enabled.
+	ctx := context.Background()
+	old, _ := voucher.NewCodec(oldKey)
+	raw, _ := json.Marshal(nonceVoucher(testUser, 2))
+	item, _ := old.Seal(raw)
+	raw, _ = json.Marshal(nonceVoucher(testUser, 3))
+	rdb.RPush(ctx, queueKey, item, string(raw)) //nolint:errcheck
+
+	if got := batchNonces(fc.next(t)); got != "A1,A2,A3" {
+		t.Fatalf("submitted %s, want A1,A2,A3", got)
+	}
+	waitDrained(t, rdb, queueKey)
+
+	dlq := rdb.LRange(ctx, dlqKey(testProvider), 0, -1).Val()
+	if len(dlq) != 1 || !strings.HasPrefix(dlq[0], "enc:k2:") {
+		t.Fatalf("DLQ %q, want one entry sealed with k2", dlq)
+	}
+	current, _ := voucher.NewCodec(newKey)
+	plain, err := current.Open(dlq[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry dlqEntry
+	if err := json.Unmarshal(plain, &entry); err != nil || entry.Nonce.Int64() != 2 {
+		t.Errorf("DLQ entry %+v (%v), want nonce 2", entry, err)
+	}
+}
+
+// TestRun_EmptyDrainSubmitsNothing wakes the settler on an empty queue, with
+// the flush timer running, and on a queue whose only items cannot be decoded:
+// neither may reach the chain.
+func TestRun_EmptyDrainSubmitsNothing(t *testing.T) {
+	old := flushPoll
+	flushPoll = 20 * time.Millisecond
+	t.Cleanup(func() { flushPoll = old })
+
+	fc := newFakeChainClient()
+	rdb, queueKey := startSettlerWith(t, func(cfg *config.Config, _ *redis.Client) {
+		cfg.Billing.SettleFlushIntervalSec = 1
+	}, fc, make(chan StopSignal, 1))
+
+	time.Sleep(300 * time.Millisecond)
+	rdb.RPush(context.Background(), queueKey, "not-json", "enc:lost-key:AAAA") //nolint:errcheck
+	waitDrained(t, rdb, queueKey)
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case vs := <-fc.calls:
+		t.Fatalf("submitted a batch of %d vouchers; want no chain interaction", len(vs))
+	default:
+	}
+}
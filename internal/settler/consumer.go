@@ -4,104 +4,433 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/0gfoundation/0g-sandbox/internal/archive"
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
 	"github.com/0gfoundation/0g-sandbox/internal/config"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
 )
 
-const maxBatchSize = 50
+// defaultMaxBatchSize caps a settlement batch when SETTLE_MAX_BATCH_SIZE is
+// unset.
+const defaultMaxBatchSize = 50
 
-// Run is the main settler loop: BLPOP → sign → settle → handle statuses.
+// retryBackoff is the (jittered) pause after a batch fails to sign or submit,
+// so replicas sharing a queue do not retry in lockstep. A var for tests.
+var retryBackoff = 5 * time.Second
+
+// nonceRetryBackoff is the pause after a batch fails on the sending account's
+// nonce, which is resynced before the retry. A var for tests.
+var nonceRetryBackoff = time.Second
+
+// flushPoll is how often a settler with a flush cadence re-reads the queue
+// while it waits for a batch to fill (see awaitFlush). A var for tests.
+var flushPoll = 250 * time.Millisecond
+
+// blpopTimeout bounds each BLPOP so ctx cancellation is observed within this
+// window even when the queue is idle.
+const blpopTimeout = time.Second
+
+// Run is the main settler loop: lock → BLPOP → sign → settle → handle statuses.
 // nonceSigner assigns nonces and signs vouchers sequentially, guaranteeing
 // strict nonce ordering regardless of how many goroutines enqueued the vouchers.
+// The settle lock (see settleLock) extends that to several replicas sharing
+// the provider queue. With SETTLE_FLUSH_INTERVAL_SEC set, each batch first
+// waits to fill (see awaitFlush). Returns within blpopTimeout of ctx being
+// cancelled.
 func Run(ctx context.Context, cfg *config.Config, rdb *redis.Client, onchain ChainClient, nonceSigner NonceSigner, stopCh chan<- StopSignal, log *zap.Logger) {
 	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
-	// lockTime/2 as BLPOP timeout (half the lock window for responsiveness)
-	blpopTimeout := time.Duration(cfg.Billing.VoucherIntervalSec) * time.Second / 2
+
+	// Optional capabilities for nonce-gap detection (see checkInvalidNonces).
+	nonceReader, _ := onchain.(NonceReader)
+	resyncer, _ := nonceSigner.(NonceResyncer)
+	deferrer, _ := nonceSigner.(AckDeferrer)
+	resigner, _ := nonceSigner.(SignerMismatchResigner)
+	accountResyncer, _ := onchain.(AccountNonceResyncer)
+
+	// Validated by config.Load; queue items must be sealed with the same key
+	// as billing.Signer uses.
+	codec, err := voucher.NewCodec(cfg.Redis.EncryptionKey)
+	if err != nil {
+		log.Error("settler: REDIS_ENCRYPTION_KEY", zap.Error(err))
+		return
+	}
+	// Validated at startup by cmd/billing.
+	rules, err := chain.ParseErrorRules(cfg.Chain.ErrorRules)
+	if err != nil {
+		log.Error("settler: CHAIN_ERROR_RULES", zap.Error(err))
+		return
+	}
+
+	maxBatch := cfg.Billing.SettleMaxBatchSize
+	if maxBatch <= 0 {
+		maxBatch = defaultMaxBatchSize
+	}
+	flushEvery := time.Duration(cfg.Billing.SettleFlushIntervalSec) * time.Second
+
+	b := &batch{
+		cfg: cfg, rdb: rdb, queueKey: queueKey, onchain: onchain, nonceSigner: nonceSigner, stopCh: stopCh,
+		nonceReader: nonceReader, resyncer: resyncer, deferrer: deferrer, resigner: resigner, accountResyncer: accountResyncer,
+		classifier: chain.NewErrorClassifier(rules), codec: codec, maxBatch: maxBatch, log: log,
+	}
+	lock := newSettleLock(rdb, cfg.Chain.ProviderAddress, time.Duration(cfg.Billing.SettleLockLeaseSec)*time.Second, log)
 
 	log.Info("settler started", zap.String("queue", queueKey))
+	defer log.Info("settler stopped")
 
 	for {
 		if ctx.Err() != nil {
-			log.Info("settler stopped")
 			return
 		}
-
-		// BLPOP blocks until an item appears or timeout
-		results, err := rdb.BLPop(ctx, blpopTimeout, queueKey).Result()
-		if err != nil {
-			if err == redis.Nil {
-				// Timeout: no items, loop back
-				continue
-			}
-			if ctx.Err() != nil {
-				return
-			}
-			log.Error("settler: BLPOP error", zap.Error(err))
-			time.Sleep(time.Second)
+		if flushEvery > 0 {
+			awaitFlush(ctx, rdb, codec, queueKey, flushEvery, maxBatch)
+		}
+		// Only one replica pops and settles for the provider at a time. The
+		// lock must cover the pop too: the batch is peeked with LRANGE and
+		// popped only after settlement, so a concurrent BLPOP would shift
+		// the items the holder pops.
+		if err := lock.acquire(ctx); err != nil {
 			continue
 		}
+		release := lock.hold()
+		var backoff time.Duration
+		if firstItem, ok := popNext(ctx, rdb, queueKey, log); ok {
+			backoff = b.settle(ctx, firstItem)
+		}
+		release()
+		if backoff > 0 {
+			sleepCtx(ctx, jitter(backoff))
+		}
+	}
+}
 
-		// results[0] = key, results[1] = value (already popped by BLPOP)
-		firstItem := results[1]
+// batch holds what Run needs to settle one batch.
+type batch struct {
+	cfg             *config.Config
+	rdb             *redis.Client
+	queueKey        string
+	onchain         ChainClient
+	nonceSigner     NonceSigner
+	stopCh          chan<- StopSignal
+	nonceReader     NonceReader
+	resyncer        NonceResyncer
+	deferrer        AckDeferrer
+	resigner        SignerMismatchResigner
+	accountResyncer AccountNonceResyncer
+	classifier      *chain.ErrorClassifier
+	codec           *voucher.Codec // nil = plaintext queue items
+	maxBatch        int            // vouchers per batch, at most
+	log             *zap.Logger
 
-		// Peek remaining items (don't pop yet; pop happens in handler after settlement)
-		remaining, err := rdb.LRange(ctx, queueKey, 0, int64(maxBatchSize-2)).Result()
+	// solo is how many more vouchers to settle one per batch, after a batch
+	// failed permanently, to find the voucher at fault.
+	solo int
+}
+
+// settle collects a batch headed by the already-popped firstItem, signs it,
+// submits it and handles the results. It returns how long Run should back off
+// before the next batch (0 = none); the wait happens after the settle lock is
+// released so another replica can try meanwhile.
+func (b *batch) settle(ctx context.Context, firstItem string) time.Duration {
+	// Peek remaining items (don't pop yet; pop happens in handler after
+	// settlement). With a per-user cap, look further ahead so other
+	// users' vouchers can share the batch.
+	perUser := b.cfg.Billing.MaxPerUserPerBatch
+	peek := b.maxBatch
+	if perUser > 0 {
+		peek = fairWindow * b.maxBatch
+	}
+	var remaining []string
+	if b.solo == 0 {
+		var err error
+		remaining, err = b.rdb.LRange(ctx, b.queueKey, 0, int64(peek-2)).Result()
 		if err != nil {
-			log.Error("settler: LRANGE", zap.Error(err))
+			b.log.Error("settler: LRANGE", zap.Error(err))
 			remaining = nil
 		}
+	}
 
-		// Deserialize batch
-		rawItems := append([]string{firstItem}, remaining...)
-		vouchers := make([]voucher.SandboxVoucher, 0, len(rawItems))
-		for _, raw := range rawItems {
-			var v voucher.SandboxVoucher
-			if err := json.Unmarshal([]byte(raw), &v); err != nil {
-				log.Error("settler: unmarshal voucher", zap.String("raw", raw), zap.Error(err))
-				continue
+	// Deserialize batch
+	rawItems := append([]string{firstItem}, remaining...)
+	if perUser > 0 && len(rawItems) > 1 {
+		rawItems = fairBatch(ctx, b.rdb, b.queueKey, rawItems, perUser, b.maxBatch, b.codec, b.log)
+	}
+	// An undecodable item cuts the batch so the LPOPs in HandleStatuses stay
+	// aligned with the queue; once it is the (already-popped) head it is
+	// dead-lettered verbatim.
+	vouchers := make([]voucher.SandboxVoucher, 0, len(rawItems))
+	for i, raw := range rawItems {
+		var v voucher.SandboxVoucher
+		plain, err := b.codec.Open(raw)
+		if err == nil {
+			err = json.Unmarshal(plain, &v)
+		}
+		if err != nil {
+			if i > 0 {
+				break
 			}
-			vouchers = append(vouchers, v)
+			deadLetterRaw(ctx, b.rdb, b.codec, common.HexToAddress(b.cfg.Chain.ProviderAddress), raw)
+			b.log.Error("settler: decode voucher — dead-lettered", zap.String("raw", raw), zap.Error(err))
+			return 0
 		}
+		vouchers = append(vouchers, v)
+	}
 
-		if len(vouchers) == 0 {
-			continue
+	// Re-derive each usageHash and totalFee from its cleartext breakdown,
+	// and check its period against the session's lifetime, before anything
+	// is signed. The batch is cut at the first rejected voucher so the LPOPs
+	// in HandleStatuses stay aligned with the queue; the offending voucher
+	// becomes the queue head and is dead-lettered on the next iteration.
+	n := firstUsageMismatch(vouchers)
+	longest := max(b.cfg.Billing.VoucherIntervalSec, b.cfg.Billing.VoucherIntervalMaxSec)
+	outside, outsideErr := firstOutsideSession(ctx, b.rdb, longest, vouchers[:cutAt(n, len(vouchers))])
+	if outside >= 0 {
+		n = outside
+	}
+	if n == 0 {
+		reason, msg := "usagehash_mismatch", "voucher rejected — usageHash does not match breakdown"
+		if err := vouchers[0].Validate(); err != nil {
+			reason, msg = "invalid_voucher", "voucher rejected — "+err.Error()
+		} else if !vouchers[0].FeeMatches() {
+			reason, msg = "fee_mismatch", "voucher rejected — totalFee does not match breakdown"
+		} else if outsideErr != nil {
+			reason, msg = "period_out_of_session", "voucher rejected — "+outsideErr.Error()
 		}
+		deadLetter(ctx, b.rdb, b.codec, vouchers[0], reason)
+		clearPending(ctx, b.rdb, vouchers[0])
+		b.log.Error(msg,
+			zap.String("sandbox", vouchers[0].SandboxID),
+			zap.String("user", vouchers[0].User.Hex()),
+			zap.Stringer("total_fee", vouchers[0].TotalFee),
+		)
+		return 0
+	} else if n > 0 {
+		vouchers = vouchers[:n]
+	}
 
-		// Assign nonces and sign in order. The settler is the sole consumer,
-		// so sequential Sign calls guarantee strictly-increasing nonces.
-		signingOK := true
-		for i := range vouchers {
-			if err := nonceSigner.Sign(ctx, &vouchers[i]); err != nil {
-				log.Error("settler: sign voucher",
-					zap.String("sandbox", vouchers[i].SandboxID),
-					zap.Error(err),
-				)
-				signingOK = false
-				break
-			}
+	// Assign nonces and sign in order. The lock holder is the sole consumer,
+	// so sequential Sign calls guarantee strictly-increasing nonces.
+	signingOK := true
+	for i := range vouchers {
+		if err := b.nonceSigner.Sign(ctx, &vouchers[i]); err != nil {
+			b.log.Error("settler: sign voucher",
+				zap.String("sandbox", vouchers[i].SandboxID),
+				zap.Error(err),
+			)
+			signingOK = false
+			break
 		}
-		if !signingOK {
-			_ = rdb.LPush(ctx, queueKey, firstItem)
-			time.Sleep(5 * time.Second)
+	}
+	if !signingOK {
+		requeue(b.rdb, b.queueKey, firstItem, b.log)
+		return retryBackoff
+	}
+
+	// Submit each user's vouchers in nonce order. A voucher that would
+	// leave a nonce hole in the batch cuts it; it and everything after
+	// it stay queued for the next iteration.
+	ordered := orderBatch(vouchers)
+	if len(ordered) < len(vouchers) {
+		b.log.Warn("settler: batch cut to keep per-user nonces contiguous",
+			zap.Int("kept", len(ordered)),
+			zap.Int("collected", len(vouchers)),
+			zap.String("next_sandbox", vouchers[len(ordered)].SandboxID),
+		)
+	}
+	vouchers = ordered
+
+	// Submit to chain
+	submitted := time.Now()
+	statuses, err := b.onchain.SettleFeesWithTEE(ctx, vouchers)
+	latency := time.Since(submitted)
+	if err != nil {
+		recordBatch(ctx, b.rdb, nil, latency)
+		return b.submitFailed(ctx, err, firstItem, vouchers)
+	}
+	if len(statuses) != len(vouchers) {
+		recordBatch(ctx, b.rdb, nil, latency)
+		b.log.Error("settler: SettleFeesWithTEE returned wrong number of statuses",
+			zap.Int("statuses", len(statuses)),
+			zap.Int("vouchers", len(vouchers)),
+		)
+		requeue(b.rdb, b.queueKey, firstItem, b.log)
+		return retryBackoff
+	}
+	recordBatch(ctx, b.rdb, statuses, latency)
+	if b.solo > 0 {
+		b.solo--
+	}
+
+	// Queue successful settlements for long-term archival before the
+	// batch leaves the queue, so a crash cannot drop them in between.
+	if b.cfg.Archive.Enabled() {
+		archiveSettled(ctx, b.rdb, b.codec, b.cfg.Chain.ProviderAddress, vouchers, statuses, b.log)
+	}
+
+	// Handle results (first item already popped; handler pops the rest)
+	handleStatuses(ctx, b.rdb, b.stopCh, b.queueKey, vouchers, statuses, b.deferrer, b.resigner, b.codec, b.log)
+	if b.nonceReader != nil {
+		checkInvalidNonces(ctx, b.rdb, b.nonceReader, b.resyncer, vouchers, statuses, b.log)
+	}
+	return 0
+}
+
+// submitFailed handles a batch SettleFeesWithTEE failed to settle, by the
+// error's class, and returns Run's backoff. firstItem has been popped; the
+// rest of the batch is still queued.
+func (b *batch) submitFailed(ctx context.Context, err error, firstItem string, vouchers []voucher.SandboxVoucher) time.Duration {
+	class := b.classifier.Classify(err)
+	b.rdb.HIncrBy(ctx, MetricsKey, metricSettleError+class.String(), 1)
+	b.log.Error("settler: SettleFeesWithTEE", zap.Stringer("class", class), zap.Int("vouchers", len(vouchers)), zap.Error(err))
+	switch {
+	case class == chain.NonceIssue:
+		if b.accountResyncer != nil {
+			b.accountResyncer.ResyncAccountNonce()
+		}
+		requeue(b.rdb, b.queueKey, firstItem, b.log)
+		return nonceRetryBackoff
+	case class == chain.Permanent && len(vouchers) > 1:
+		// Retrying the batch as is would fail forever: settle its
+		// vouchers one at a time to find the one at fault.
+		b.solo = len(vouchers)
+		requeue(b.rdb, b.queueKey, firstItem, b.log)
+		return 0
+	case class == chain.Permanent:
+		deadLetter(ctx, b.rdb, b.codec, vouchers[0], "chain_rejected")
+		clearPending(ctx, b.rdb, vouchers[0])
+		b.log.Error("voucher rejected by the chain — dead-lettered",
+			zap.String("sandbox", vouchers[0].SandboxID),
+			zap.String("user", vouchers[0].User.Hex()),
+			zap.Stringer("total_fee", vouchers[0].TotalFee),
+			zap.Error(err),
+		)
+		if b.solo > 0 {
+			b.solo--
+		}
+		return 0
+	default:
+		// Re-push first item back (it was already BLPOP'd)
+		requeue(b.rdb, b.queueKey, firstItem, b.log)
+		return retryBackoff
+	}
+}
+
+// archiveSettled enqueues every successfully settled voucher for the archiver.
+func archiveSettled(ctx context.Context, rdb *redis.Client, codec *voucher.Codec, provider string, vouchers []voucher.SandboxVoucher, statuses []chain.SettlementStatus, log *zap.Logger) {
+	now := time.Now()
+	for i, status := range statuses {
+		if status != chain.StatusSuccess {
 			continue
 		}
+		if err := archive.Enqueue(ctx, rdb, codec, provider, vouchers[i], strings.ToLower(status.String()), now); err != nil {
+			log.Error("settler: archive enqueue failed",
+				zap.String("user", vouchers[i].User.Hex()),
+				zap.String("nonce", vouchers[i].Nonce.String()),
+				zap.Error(err),
+			)
+		}
+	}
+}
 
-		// Submit to chain
-		statuses, err := onchain.SettleFeesWithTEE(ctx, vouchers)
-		if err != nil {
-			log.Error("settler: SettleFeesWithTEE", zap.Error(err))
-			// Re-push first item back (it was already BLPOP'd)
-			_ = rdb.LPush(ctx, queueKey, firstItem)
-			time.Sleep(5 * time.Second)
+// awaitFlush holds back the next batch until the queue is due under a flush
+// cadence of every: it holds maxBatch vouchers, or its head voucher was
+// enqueued every ago, whichever comes first. Vouchers generated within one
+// window therefore settle in one transaction. A head without EnqueuedAt
+// (older builds) or that cannot be read is due at once, as is any queue Redis
+// fails to report on; popNext then handles it as usual.
+func awaitFlush(ctx context.Context, rdb *redis.Client, codec *voucher.Codec, queueKey string, every time.Duration, maxBatch int) {
+	for ctx.Err() == nil {
+		n, err := rdb.LLen(ctx, queueKey).Result()
+		if err != nil || n >= int64(maxBatch) {
+			return
+		}
+		if n == 0 {
+			// Popping the first arrival at once would settle it alone.
+			sleepCtx(ctx, flushPoll)
 			continue
 		}
+		head, err := rdb.LIndex(ctx, queueKey, 0).Result()
+		if err != nil {
+			return
+		}
+		var v struct {
+			EnqueuedAt int64 `json:"enqueued_at"`
+		}
+		plain, err := codec.Open(head)
+		if err != nil || json.Unmarshal(plain, &v) != nil {
+			return
+		}
+		wait := time.Until(time.Unix(v.EnqueuedAt, 0).Add(every))
+		if wait <= 0 {
+			return
+		}
+		sleepCtx(ctx, min(wait, flushPoll))
+	}
+}
+
+// popNext BLPOPs the next queue item, blocking at most blpopTimeout. The BLPOP
+// itself is not bound to ctx: aborting it client-side could lose an item the
+// server has already popped. Instead ctx is checked once BLPOP returns, and
+// an item popped after cancellation is pushed back to the queue head.
+func popNext(ctx context.Context, rdb *redis.Client, queueKey string, log *zap.Logger) (string, bool) {
+	results, err := rdb.BLPop(context.WithoutCancel(ctx), blpopTimeout, queueKey).Result()
+	if err != nil {
+		if err != redis.Nil { // redis.Nil = timeout, queue empty
+			log.Error("settler: BLPOP error", zap.Error(err))
+			sleepCtx(ctx, time.Second)
+		}
+		return "", false
+	}
+	// results[0] = key, results[1] = value (already popped by BLPOP)
+	if ctx.Err() != nil {
+		requeue(rdb, queueKey, results[1], log)
+		return "", false
+	}
+	return results[1], true
+}
 
-		// Handle results (first item already popped; handler pops the rest)
-		HandleStatuses(ctx, rdb, stopCh, queueKey, firstItem, vouchers, statuses, log)
+// requeue pushes an already-popped item back to the queue head. It does not
+// use the settler's ctx, which may already be cancelled on shutdown.
+func requeue(rdb *redis.Client, queueKey, item string, log *zap.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.LPush(ctx, queueKey, item).Err(); err != nil {
+		log.Error("settler: re-push voucher failed — item lost", zap.String("raw", item), zap.Error(err))
+	}
+}
+
+// sleepCtx sleeps for d or until ctx is cancelled.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// cutAt is the length of a batch cut at index n (-1 = not cut).
+func cutAt(n, length int) int {
+	if n < 0 {
+		return length
+	}
+	return n
+}
+
+// firstUsageMismatch returns the index of the first voucher that fails
+// Validate or whose usageHash or totalFee does not match its persisted
+// breakdown, or -1 if all pass.
+func firstUsageMismatch(vouchers []voucher.SandboxVoucher) int {
+	for i := range vouchers {
+		if vouchers[i].Validate() != nil || !vouchers[i].UsageHashMatches() || !vouchers[i].FeeMatches() {
+			return i
+		}
 	}
+	return -1
 }
@@ -0,0 +1,656 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/0gfoundation/0g-sandbox/internal/archive"
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+	"github.com/0gfoundation/0g-sandbox/internal/storage"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+type nopChain struct{}
+
+func (nopChain) SettleFeesWithTEE(_ context.Context, vs []voucher.SandboxVoucher) ([]chain.SettlementStatus, error) {
+	return make([]chain.SettlementStatus, len(vs)), nil
+}
+
+type nopSigner struct{}
+
+func (nopSigner) Sign(context.Context, *voucher.SandboxVoucher) error { return nil }
+
+// ── Run: cancellation ─────────────────────────────────────────────────────────
+
+func TestRun_ReturnsPromptlyOnCancel_EmptyQueue(t *testing.T) {
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, cfg, rdb, nopChain{}, nopSigner{}, make(chan StopSignal, 1), zap.NewNop())
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond) // let Run enter BLPOP
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(blpopTimeout + 500*time.Millisecond):
+		t.Fatal("Run did not return within the BLPOP timeout after cancel")
+	}
+}
+
+func TestPopNext_CancelledAfterPop_RequeuesItem(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	rdb.RPush(ctx, testQueueKey, "item0", "item1") //nolint:errcheck
+
+	// ctx is cancelled while BLPOP is (conceptually) in flight: the item it
+	// returns must go back to the head of the queue, not be dropped.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, ok := popNext(cancelled, rdb, testQueueKey, zap.NewNop()); ok {
+		t.Fatal("popNext must not hand out an item once ctx is cancelled")
+	}
+	got := rdb.LRange(ctx, testQueueKey, 0, -1).Val()
+	if len(got) != 2 || got[0] != "item0" || got[1] != "item1" {
+		t.Fatalf("queue after cancelled pop: got %v want [item0 item1]", got)
+	}
+
+	item, ok := popNext(ctx, rdb, testQueueKey, zap.NewNop())
+	if !ok || item != "item0" {
+		t.Errorf("popNext: got %q ok=%v want item0", item, ok)
+	}
+}
+
+// ── Batch nonce ordering ──────────────────────────────────────────────────────
+
+var testUser2 = common.HexToAddress("0xBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB")
+
+func nonceVoucher(user common.Address, nonce int64) voucher.SandboxVoucher {
+	v := makeVoucher(fmt.Sprintf("sb-%s-%d", user.Hex()[2:6], nonce))
+	v.User = user
+	v.Nonce = big.NewInt(nonce)
+	return v
+}
+
+// assertNonceOrdered fails unless every (user, provider) pair's vouchers
+// appear in strictly contiguous ascending nonce order.
+func assertNonceOrdered(t *testing.T, batch []voucher.SandboxVoucher) {
+	t.Helper()
+	last := map[common.Address]*big.Int{}
+	for _, v := range batch {
+		if prev := last[v.User]; prev != nil && new(big.Int).Sub(v.Nonce, prev).Cmp(big.NewInt(1)) != 0 {
+			t.Fatalf("user %s: nonce %s follows %s", v.User.Hex(), v.Nonce, prev)
+		}
+		last[v.User] = v.Nonce
+	}
+}
+
+func batchNonces(batch []voucher.SandboxVoucher) string {
+	var out []string
+	for _, v := range batch {
+		out = append(out, strings.ToUpper(v.User.Hex()[2:3])+v.Nonce.String())
+	}
+	return strings.Join(out, ",")
+}
+
+func TestOrderBatch_SortsShuffledNonces(t *testing.T) {
+	in := []voucher.SandboxVoucher{
+		nonceVoucher(testUser2, 8), nonceVoucher(testUser, 3), nonceVoucher(testUser, 1),
+		nonceVoucher(testUser2, 7), nonceVoucher(testUser, 2),
+	}
+	got := orderBatch(in)
+	if s := batchNonces(got); s != "A1,A2,A3,B7,B8" {
+		t.Errorf("order: got %s want A1,A2,A3,B7,B8", s)
+	}
+	assertNonceOrdered(t, got)
+}
+
+func TestOrderBatch_CutsAtNonceHole(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []voucher.SandboxVoucher
+		want string
+	}{
+		// A4 would leave A3 missing; it and everything after stay queued.
+		{"gap", []voucher.SandboxVoucher{
+			nonceVoucher(testUser, 2), nonceVoucher(testUser, 1), nonceVoucher(testUser2, 5),
+			nonceVoucher(testUser, 4), nonceVoucher(testUser2, 6),
+		}, "A1,A2,B5"},
+		// The hole is filled later in the batch, so nothing is cut.
+		{"filled", []voucher.SandboxVoucher{
+			nonceVoucher(testUser, 1), nonceVoucher(testUser, 3), nonceVoucher(testUser, 2),
+		}, "A1,A2,A3"},
+		{"duplicate", []voucher.SandboxVoucher{
+			nonceVoucher(testUser, 1), nonceVoucher(testUser, 2), nonceVoucher(testUser, 2),
+		}, "A1,A2"},
+	}
+	for _, tc := range cases {
+		got := orderBatch(tc.in)
+		if s := batchNonces(got); s != tc.want {
+			t.Errorf("%s: got %s want %s", tc.name, s, tc.want)
+		}
+		assertNonceOrdered(t, got)
+	}
+}
+
+// recordingChain records each submitted batch and signals after the first.
+type recordingChain struct {
+	batches chan []voucher.SandboxVoucher
+}
+
+func (r *recordingChain) SettleFeesWithTEE(_ context.Context, vs []voucher.SandboxVoucher) ([]chain.SettlementStatus, error) {
+	r.batches <- append([]voucher.SandboxVoucher(nil), vs...)
+	return make([]chain.SettlementStatus, len(vs)), nil
+}
+
+func TestRun_SubmitsShuffledVouchersInNonceOrder(t *testing.T) {
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
+
+	// Enqueued out of order (as after a requeue), nonces already assigned;
+	// nopSigner leaves them untouched.
+	shuffled := []voucher.SandboxVoucher{
+		nonceVoucher(testUser, 12), nonceVoucher(testUser2, 4), nonceVoucher(testUser, 10),
+		nonceVoucher(testUser2, 3), nonceVoucher(testUser, 11),
+	}
+	for _, v := range shuffled {
+		raw, _ := json.Marshal(v)
+		rdb.RPush(context.Background(), queueKey, string(raw)) //nolint:errcheck
+	}
+
+	rc := &recordingChain{batches: make(chan []voucher.SandboxVoucher, 4)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, cfg, rdb, rc, nopSigner{}, make(chan StopSignal, len(shuffled)), zap.NewNop())
+		close(done)
+	}()
+
+	var batch []voucher.SandboxVoucher
+	select {
+	case batch = <-rc.batches:
+	case <-time.After(3 * time.Second):
+		t.Fatal("no batch submitted")
+	}
+	// HandleStatuses pops the rest of the batch after submission returns.
+	deadline := time.Now().Add(2 * time.Second)
+	for rdb.LLen(context.Background(), queueKey).Val() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if s := batchNonces(batch); s != "A10,A11,A12,B3,B4" {
+		t.Errorf("submitted order: got %s want A10,A11,A12,B3,B4", s)
+	}
+	assertNonceOrdered(t, batch)
+	if n := rdb.LLen(context.Background(), queueKey).Val(); n != 0 {
+		t.Errorf("queue length after settle: got %d want 0", n)
+	}
+}
+
+// counterSigner assigns nonces from per-user counters, as the billing Signer
+// does; skip makes a counter jump once past a nonce, as when another writer
+// took it meanwhile.
+type counterSigner struct {
+	next map[common.Address]int64
+	skip map[common.Address]int64
+}
+
+func (c *counterSigner) Sign(_ context.Context, v *voucher.SandboxVoucher) error {
+	c.next[v.User]++
+	if c.next[v.User] == c.skip[v.User] {
+		c.next[v.User]++
+	}
+	v.Nonce = big.NewInt(c.next[v.User])
+	return nil
+}
+
+func TestRun_CutsBatchAtNonceGapFromSigning(t *testing.T) {
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
+
+	// Unsigned and interleaved; user A's third voucher is signed with nonce
+	// 4, nonce 3 having been taken elsewhere.
+	for i, user := range []common.Address{testUser, testUser2, testUser, testUser, testUser2} {
+		v := makeVoucher(fmt.Sprintf("sb-%d", i+1))
+		v.User = user
+		raw, _ := json.Marshal(v)
+		rdb.RPush(context.Background(), queueKey, string(raw)) //nolint:errcheck
+	}
+	signer := &counterSigner{next: map[common.Address]int64{}, skip: map[common.Address]int64{testUser: 3}}
+
+	rc := &recordingChain{batches: make(chan []voucher.SandboxVoucher, 4)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, cfg, rdb, rc, signer, make(chan StopSignal, 8), zap.NewNop())
+		close(done)
+	}()
+	var batches [][]voucher.SandboxVoucher
+	for len(batches) < 2 {
+		select {
+		case b := <-rc.batches:
+			batches = append(batches, b)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("got %d batches, want 2", len(batches))
+		}
+	}
+	cancel()
+	<-done
+
+	// The gap cuts the batch before sb-4; it and sb-5 are re-signed next.
+	if s := batchNonces(batches[0]); s != "A1,A2,B1" {
+		t.Errorf("first batch: got %s want A1,A2,B1", s)
+	}
+	assertNonceOrdered(t, batches[0])
+	var rest []string
+	for _, v := range batches[1] {
+		rest = append(rest, v.SandboxID)
+	}
+	if strings.Join(rest, ",") != "sb-4,sb-5" {
+		t.Errorf("second batch: got %v want sb-4 and sb-5", rest)
+	}
+	assertNonceOrdered(t, batches[1])
+}
+
+func TestRun_UndecodableItemCutsBatchAndIsDeadLettered(t *testing.T) {
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
+
+	first, _ := json.Marshal(nonceVoucher(testUser, 1))
+	last, _ := json.Marshal(nonceVoucher(testUser, 2))
+	rdb.RPush(context.Background(), queueKey, string(first), "not-json", string(last)) //nolint:errcheck
+
+	rc := &recordingChain{batches: make(chan []voucher.SandboxVoucher, 4)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, cfg, rdb, rc, nopSigner{}, make(chan StopSignal, 4), zap.NewNop())
+		close(done)
+	}()
+	var batches []string
+	for len(batches) < 2 {
+		select {
+		case b := <-rc.batches:
+			batches = append(batches, batchNonces(b))
+		case <-time.After(3 * time.Second):
+			t.Fatalf("got batches %v, want 2", batches)
+		}
+	}
+	waitDrained(t, rdb, queueKey)
+	cancel()
+	<-done
+
+	// The bad item cuts the first batch instead of being skipped inside it.
+	if strings.Join(batches, " ") != "A1 A2" {
+		t.Errorf("batches: got %v want [A1 A2]", batches)
+	}
+	dlq := rdb.LRange(context.Background(), dlqKey(testProvider), 0, -1).Val()
+	if len(dlq) != 1 {
+		t.Fatalf("DLQ length: got %d want 1", len(dlq))
+	}
+	var entry dlqEntry
+	if err := json.Unmarshal([]byte(dlq[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Raw != "not-json" || entry.Reason != "undecodable" {
+		t.Errorf("DLQ entry: got raw %q reason %q", entry.Raw, entry.Reason)
+	}
+}
+
+// ── Flush cadence ─────────────────────────────────────────────────────────────
+
+func TestRun_FlushIntervalSettlesWindowTogether(t *testing.T) {
+	old := flushPoll
+	flushPoll = 20 * time.Millisecond
+	t.Cleanup(func() { flushPoll = old })
+
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	cfg.Billing.SettleFlushIntervalSec = 2
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
+	ctx := context.Background()
+	push := func(n int64) {
+		v := nonceVoucher(testUser, n)
+		v.EnqueuedAt = time.Now().Unix()
+		raw, _ := json.Marshal(v)
+		rdb.RPush(ctx, queueKey, string(raw)) //nolint:errcheck
+	}
+
+	rc := &recordingChain{batches: make(chan []voucher.SandboxVoucher, 16)}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		Run(runCtx, cfg, rdb, rc, nopSigner{}, make(chan StopSignal, 1), zap.NewNop())
+		close(done)
+	}()
+	defer func() { cancel(); <-done }()
+
+	// The second voucher arrives while the first waits for the flush (at
+	// least a second away, as EnqueuedAt has whole-second resolution).
+	push(1)
+	time.Sleep(200 * time.Millisecond)
+	push(2)
+
+	select {
+	case batch := <-rc.batches:
+		if s := batchNonces(batch); s != "A1,A2" {
+			t.Errorf("flushed batch: got %s want A1,A2", s)
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("no batch flushed on the timer")
+	}
+	// HandleStatuses pops the rest of the batch after submission returns.
+	deadline := time.Now().Add(2 * time.Second)
+	for rdb.LLen(ctx, queueKey).Val() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := rdb.LLen(ctx, queueKey).Val(); n != 0 {
+		t.Errorf("queue length after flush: got %d want 0", n)
+	}
+}
+
+func TestRun_FullBatchFlushesBeforeInterval(t *testing.T) {
+	old := flushPoll
+	flushPoll = 20 * time.Millisecond
+	t.Cleanup(func() { flushPoll = old })
+
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	cfg.Billing.SettleFlushIntervalSec = 60
+	cfg.Billing.SettleMaxBatchSize = 2
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
+	ctx := context.Background()
+	for n := int64(1); n <= 3; n++ {
+		v := nonceVoucher(testUser, n)
+		v.EnqueuedAt = time.Now().Unix()
+		raw, _ := json.Marshal(v)
+		rdb.RPush(ctx, queueKey, string(raw)) //nolint:errcheck
+	}
+
+	rc := &recordingChain{batches: make(chan []voucher.SandboxVoucher, 16)}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		Run(runCtx, cfg, rdb, rc, nopSigner{}, make(chan StopSignal, 1), zap.NewNop())
+		close(done)
+	}()
+	defer func() { cancel(); <-done }()
+
+	select {
+	case batch := <-rc.batches:
+		if s := batchNonces(batch); s != "A1,A2" {
+			t.Errorf("full batch: got %s want A1,A2", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a full batch must not wait for the flush interval")
+	}
+	// The remainder is short of a batch and waits for its interval.
+	select {
+	case batch := <-rc.batches:
+		t.Errorf("remainder flushed early: %s", batchNonces(batch))
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// ── Per-user fairness ─────────────────────────────────────────────────────────
+
+func TestSelectFair_RoundRobinKeepsPerUserOrder(t *testing.T) {
+	a, b, c := testUser, testUser2, common.HexToAddress("0xCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC")
+	users := []*common.Address{&a, &a, &a, &a, nil, &b, &a, &c, &b}
+	got := fmt.Sprint(selectFair(users, 2, defaultMaxBatchSize))
+	// a's first two, b's first two, c's one; the undecodable item is skipped.
+	if got != "[0 5 7 1 8]" {
+		t.Errorf("selection: got %s want [0 5 7 1 8]", got)
+	}
+}
+
+func TestRun_DominantUserDoesNotStarveOthers(t *testing.T) {
+	rdb := newTestRedis(t)
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	cfg.Billing.MaxPerUserPerBatch = 10
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, cfg.Chain.ProviderAddress)
+	ctx := context.Background()
+
+	// 200 vouchers from one wallet, then one each from three others.
+	others := []common.Address{
+		testUser2,
+		common.HexToAddress("0xCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC"),
+		common.HexToAddress("0xDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDD"),
+	}
+	const dominant = 200
+	for n := int64(1); n <= dominant; n++ {
+		raw, _ := json.Marshal(nonceVoucher(testUser, n))
+		rdb.RPush(ctx, queueKey, string(raw)) //nolint:errcheck
+	}
+	for _, u := range others {
+		raw, _ := json.Marshal(nonceVoucher(u, 1))
+		rdb.RPush(ctx, queueKey, string(raw)) //nolint:errcheck
+	}
+
+	rc := &recordingChain{batches: make(chan []voucher.SandboxVoucher, 64)}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		Run(runCtx, cfg, rdb, rc, nopSigner{}, make(chan StopSignal, 1), zap.NewNop())
+		close(done)
+	}()
+	defer func() { cancel(); <-done }()
+
+	// Without the cap the others would wait four full batches behind the
+	// dominant wallet; with it they must all settle in the first.
+	pending := map[common.Address]bool{others[0]: true, others[1]: true, others[2]: true}
+	var settled []voucher.SandboxVoucher
+	for batches := 0; batches < (dominant+len(others))/10+1; batches++ {
+		var batch []voucher.SandboxVoucher
+		select {
+		case batch = <-rc.batches:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("batch %d not submitted", batches+1)
+		}
+		perUser := map[common.Address]int{}
+		for _, v := range batch {
+			perUser[v.User]++
+			delete(pending, v.User)
+		}
+		if perUser[testUser] > cfg.Billing.MaxPerUserPerBatch {
+			t.Fatalf("batch %d: %d vouchers from the dominant user", batches+1, perUser[testUser])
+		}
+		if batches == 0 && len(pending) != 0 {
+			t.Fatalf("first batch left %d other users waiting: %s", len(pending), batchNonces(batch))
+		}
+		settled = append(settled, batch...)
+		if len(settled) == dominant+len(others) {
+			break
+		}
+	}
+
+	// Every voucher settles exactly once and the dominant user's stay in order.
+	if len(settled) != dominant+len(others) {
+		t.Fatalf("settled %d vouchers want %d", len(settled), dominant+len(others))
+	}
+	var ownNonces []voucher.SandboxVoucher
+	for _, v := range settled {
+		if v.User == testUser {
+			ownNonces = append(ownNonces, v)
+		}
+	}
+	assertNonceOrdered(t, ownNonces)
+	if ownNonces[0].Nonce.Int64() != 1 {
+		t.Errorf("first dominant nonce: got %s want 1", ownNonces[0].Nonce)
+	}
+}
+
+func TestArchiveSettled_QueuesOnlySuccesses(t *testing.T) {
+	rdb := newTestRedis(t)
+	store, _ := storage.NewFSStore(t.TempDir())
+	provider := testProvider.Hex()
+
+	vs := []voucher.SandboxVoucher{nonceVoucher(testUser, 1), nonceVoucher(testUser, 2)}
+	sts := []chain.SettlementStatus{chain.StatusSuccess, chain.StatusInsufficientBalance}
+	archiveSettled(context.Background(), rdb, nil, provider, vs, sts, zap.NewNop())
+
+	a := archive.NewArchiver(rdb, store, provider, 10, time.Minute, zap.NewNop())
+	if n, err := a.Flush(context.Background()); err != nil || n != 1 {
+		t.Fatalf("flush: n=%d err=%v, want 1 record", n, err)
+	}
+	now := time.Now()
+	got, _ := archive.Query(context.Background(), store, provider, testUser, now.Add(-time.Hour), now.Add(time.Hour))
+	if len(got) != 1 || got[0].Voucher.Nonce.Int64() != 1 || got[0].Status != "success" {
+		t.Errorf("archived: got %+v", got)
+	}
+}
+
+// ── Nonce gap / drift detection ───────────────────────────────────────────────
+
+type fixedNonceReader struct{ last *big.Int }
+
+func (f fixedNonceReader) GetLastNonce(context.Context, common.Address, common.Address) (*big.Int, error) {
+	return f.last, nil
+}
+
+type recordingResyncer struct {
+	calls  []*big.Int
+	inStep bool // the counter is already at or past lastNonce: nothing to raise
+}
+
+func (r *recordingResyncer) ResyncNonce(_ context.Context, _, _ common.Address, last *big.Int) (bool, error) {
+	r.calls = append(r.calls, last)
+	return !r.inStep, nil
+}
+
+func TestCheckInvalidNonces_BehindChain_Resyncs(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	res := &recordingResyncer{}
+
+	v1, v2 := makeVoucher("sb-1"), makeVoucher("sb-2")
+	v1.Nonce, v2.Nonce = big.NewInt(3), big.NewInt(4)
+	checkInvalidNonces(ctx, rdb, fixedNonceReader{big.NewInt(9)}, res,
+		[]voucher.SandboxVoucher{v1, v2},
+		[]chain.SettlementStatus{chain.StatusInvalidNonce, chain.StatusInvalidNonce}, zap.NewNop())
+
+	if len(res.calls) != 1 || res.calls[0].Int64() != 9 {
+		t.Errorf("expected one resync to 9 per (user, provider), got %v", res.calls)
+	}
+	if got := rdb.HGet(ctx, MetricsKey, metricNonceResync).Val(); got != "1" {
+		t.Errorf("%s counter: got %q want 1", metricNonceResync, got)
+	}
+}
+
+func TestCheckInvalidNonces_GapDetected(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	res := &recordingResyncer{}
+
+	v := makeVoucher("sb-gap")
+	v.Nonce = big.NewInt(5) // chain lastNonce 2 → nonces 3 and 4 never settled
+	checkInvalidNonces(ctx, rdb, fixedNonceReader{big.NewInt(2)}, res,
+		[]voucher.SandboxVoucher{v}, []chain.SettlementStatus{chain.StatusInvalidNonce}, zap.NewNop())
+
+	if got := rdb.HGet(ctx, MetricsKey, metricNonceGap).Val(); got != "1" {
+		t.Errorf("%s counter: got %q want 1", metricNonceGap, got)
+	}
+	if len(res.calls) != 0 {
+		t.Errorf("a gap must not trigger a resync, got %v", res.calls)
+	}
+	evs, _ := events.List(ctx, rdb)
+	if len(evs) != 1 || evs[0].Type != events.TypeNonceGap {
+		t.Errorf("expected one nonce_gap event, got %+v", evs)
+	}
+}
+
+func TestCheckInvalidNonces_AlreadySettledIsInfo(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	res := &recordingResyncer{inStep: true}
+	core, logs := observer.New(zap.InfoLevel)
+
+	// The indexer settled our nonce-3 copy; the chain is at 9 and so is
+	// our counter.
+	v := makeVoucher("sb-indexed")
+	v.Nonce = big.NewInt(3)
+	checkInvalidNonces(ctx, rdb, fixedNonceReader{big.NewInt(9)}, res,
+		[]voucher.SandboxVoucher{v}, []chain.SettlementStatus{chain.StatusInvalidNonce}, zap.New(core))
+
+	if got := logs.FilterMessageSnippet("already_settled").All(); len(got) != 1 || got[0].Level != zapcore.InfoLevel {
+		t.Errorf("already_settled logs: %+v, want one at info", got)
+	}
+	if got := logs.Filter(func(e observer.LoggedEntry) bool { return e.Level >= zapcore.WarnLevel }).Len(); got != 0 {
+		t.Errorf("%d warn-or-worse logs for an already-settled voucher", got)
+	}
+	if len(res.calls) != 1 || res.calls[0].Int64() != 9 {
+		t.Errorf("counter not aligned to chain lastNonce 9: resync calls %v", res.calls)
+	}
+	m := rdb.HGetAll(ctx, MetricsKey).Val()
+	if m[metricAlreadySettled] != "1" || m[metricNonceResync] != "" || m[metricNonceGap] != "" {
+		t.Errorf("metrics: %v, want only %s", m, metricAlreadySettled)
+	}
+	if evs, _ := events.List(ctx, rdb); len(evs) != 0 {
+		t.Errorf("events for an already-settled voucher: %+v", evs)
+	}
+}
+
+func TestCheckInvalidNonces_GapIsWarn(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	res := &recordingResyncer{inStep: true}
+	core, logs := observer.New(zap.InfoLevel)
+
+	// Same pair, one batch: nonce 4 is already settled, nonce 10 (lastNonce+1)
+	// should have been accepted.
+	settled, gap := makeVoucher("sb-a"), makeVoucher("sb-b")
+	settled.Nonce, gap.Nonce = big.NewInt(4), big.NewInt(10)
+	checkInvalidNonces(ctx, rdb, fixedNonceReader{big.NewInt(9)}, res,
+		[]voucher.SandboxVoucher{settled, gap},
+		[]chain.SettlementStatus{chain.StatusInvalidNonce, chain.StatusInvalidNonce}, zap.New(core))
+
+	if got := logs.FilterMessageSnippet("nonce_gap").All(); len(got) != 1 || got[0].Level != zapcore.WarnLevel || got[0].ContextMap()["sandbox"] != "sb-b" {
+		t.Errorf("nonce_gap logs: %+v, want one at warn for sb-b", got)
+	}
+	if got := logs.FilterMessageSnippet("already_settled").Len(); got != 1 {
+		t.Errorf("already_settled logs: %d, want 1 for sb-a", got)
+	}
+	m := rdb.HGetAll(ctx, MetricsKey).Val()
+	if m[metricAlreadySettled] != "1" || m[metricNonceGap] != "1" {
+		t.Errorf("metrics: %v, want one of each", m)
+	}
+}
+
+func TestCheckInvalidNonces_IgnoresOtherStatuses(t *testing.T) {
+	rdb := newTestRedis(t)
+	res := &recordingResyncer{}
+	checkInvalidNonces(context.Background(), rdb, fixedNonceReader{big.NewInt(9)}, res,
+		[]voucher.SandboxVoucher{makeVoucher("sb-ok")}, []chain.SettlementStatus{chain.StatusSuccess}, zap.NewNop())
+	if len(res.calls) != 0 {
+		t.Errorf("no resync expected for StatusSuccess, got %v", res.calls)
+	}
+}
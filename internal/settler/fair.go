@@ -0,0 +1,127 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// fairWindow is how many batches' worth of queued vouchers are inspected
+// per batch when a per-user cap is set, so users queued behind a dominant one
+// are reached without waiting for it to drain.
+const fairWindow = 10
+
+// selectFair picks the queue indices of the next batch: up to maxBatch
+// items, at most perUser per user, taken round-robin across users in order of
+// first appearance. Each user's items keep their queue order, so nonces are
+// still assigned in enqueue order. users[i] is nil for an item that could not
+// be decoded; such items are skipped unless they are the head. Index 0 (the
+// already-popped head) is always selected first.
+func selectFair(users []*common.Address, perUser, maxBatch int) []int {
+	if len(users) == 0 {
+		return nil
+	}
+	var order []common.Address
+	byUser := map[common.Address][]int{}
+	for i, u := range users {
+		if u == nil {
+			continue
+		}
+		if _, seen := byUser[*u]; !seen {
+			order = append(order, *u)
+		}
+		byUser[*u] = append(byUser[*u], i)
+	}
+
+	sel := []int{0}
+	for round := 0; round < perUser && len(sel) < maxBatch; round++ {
+		progressed := false
+		for _, u := range order {
+			idx := byUser[u]
+			if round >= len(idx) {
+				continue
+			}
+			progressed = true
+			if idx[round] == 0 {
+				continue // the head, already selected
+			}
+			sel = append(sel, idx[round])
+			if len(sel) == maxBatch {
+				break
+			}
+		}
+		if !progressed {
+			break
+		}
+	}
+	return sel
+}
+
+// fairBatch applies the per-user cap to a peeked batch. items[0] has already
+// been popped; items[1:] are still the queue head. When the fair selection is
+// not simply a queue prefix, the head is rewritten atomically so the selected
+// items come first (followed by the rest in their original order), keeping
+// the LPOPs in handleStatuses aligned with the batch. Only the settle lock
+// holder touches the queue head, so the peeked items are still there.
+func fairBatch(ctx context.Context, rdb *redis.Client, queueKey string, items []string, perUser, maxBatch int, codec *voucher.Codec, log *zap.Logger) []string {
+	users := make([]*common.Address, len(items))
+	for i, raw := range items {
+		var v struct {
+			User common.Address `json:"user"`
+		}
+		if plain, err := codec.Open(raw); err == nil && json.Unmarshal(plain, &v) == nil {
+			users[i] = &v.User
+		}
+	}
+	sel := selectFair(users, perUser, maxBatch)
+
+	prefix := true
+	for i, idx := range sel {
+		if idx != i {
+			prefix = false
+			break
+		}
+	}
+	if prefix {
+		return items[:len(sel)]
+	}
+
+	picked := make([]string, 0, len(sel))
+	chosen := make(map[int]bool, len(sel))
+	for _, idx := range sel {
+		picked = append(picked, items[idx])
+		chosen[idx] = true
+	}
+	head := append([]string(nil), picked[1:]...)
+	for i := 1; i < len(items); i++ {
+		if !chosen[i] {
+			head = append(head, items[i])
+		}
+	}
+	// LPUSH prepends one value at a time, so push the new head reversed.
+	slices.Reverse(head)
+	pipe := rdb.TxPipeline()
+	pipe.LTrim(ctx, queueKey, int64(len(items)-1), -1)
+	pipe.LPush(ctx, queueKey, toAny(head)...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Error("settler: reorder queue head for fair batch", zap.Error(err))
+		// Whether or not the rewrite landed, the already-popped head is
+		// the only item whose queue position is certain.
+		return items[:1]
+	}
+	return picked
+}
+
+func toAny(ss []string) []any {
+	out := make([]any, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
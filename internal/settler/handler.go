@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
@@ -25,6 +28,37 @@ func HandleStatuses(
 	statuses []chain.SettlementStatus,
 	log *zap.Logger,
 ) {
+	handleStatuses(ctx, rdb, stopCh, queueKey, vouchers, statuses, nil, nil, nil, log)
+}
+
+// DLQReasonSignerMismatch is the dead-letter reason of an INVALID_SIGNATURE
+// voucher that was signed by a key the contract no longer names as the TEE
+// signer and could not be re-signed (see SignerMismatchResigner).
+const DLQReasonSignerMismatch = "signer_mismatch"
+
+// handleStatuses is HandleStatuses with an optional AckDeferrer and
+// SignerMismatchResigner, and the codec dead-lettered vouchers are sealed
+// with (nil = plaintext).
+func handleStatuses(
+	ctx context.Context,
+	rdb *redis.Client,
+	stopCh chan<- StopSignal,
+	queueKey string,
+	vouchers []voucher.SandboxVoucher,
+	statuses []chain.SettlementStatus,
+	deferrer AckDeferrer,
+	resigner SignerMismatchResigner,
+	codec *voucher.Codec,
+	log *zap.Logger,
+) {
+	// The on-chain signer is read once per batch, at the first
+	// INVALID_SIGNATURE, however many vouchers were rejected.
+	var (
+		signerRead    bool
+		onchainSigner common.Address
+		signerVersion *big.Int
+		signerReadErr error
+	)
 	for i, status := range statuses {
 		v := vouchers[i]
 
@@ -34,6 +68,14 @@ func HandleStatuses(
 		}
 
 		sandboxID := extractSandboxID(v)
+		recordReceipt(ctx, rdb, v, status)
+		_ = events.Publish(ctx, rdb, v.User.Hex(), events.StreamEvent{
+			Type:      events.TypeVoucherSettled,
+			SandboxID: sandboxID,
+			Amount:    v.TotalFee.String(),
+			Nonce:     v.Nonce.String(),
+			Status:    strings.ToLower(status.String()),
+		})
 
 		switch status {
 		case chain.StatusSuccess:
@@ -50,35 +92,70 @@ func HandleStatuses(
 			})
 
 		case chain.StatusInsufficientBalance:
-			persistStop(ctx, rdb, stopCh, sandboxID, "insufficient_balance", log)
+			persistStop(ctx, rdb, stopCh, sandboxID, StopInsufficientBalance, log)
 
 		case chain.StatusNotAcknowledged:
-			persistStop(ctx, rdb, stopCh, sandboxID, "not_acknowledged", log)
+			if deferrer != nil && deferrer.DeferUnacknowledged(ctx, v) {
+				log.Info("voucher deferred: user has not re-acknowledged the rotated TEE signer",
+					zap.String("user", v.User.Hex()),
+					zap.String("sandbox", sandboxID),
+				)
+				continue
+			}
+			persistStop(ctx, rdb, stopCh, sandboxID, StopNotAcknowledged, log)
 
 		case chain.StatusProviderMismatch, chain.StatusInvalidSignature:
-			raw, _ := json.Marshal(v)
-			dlqKey := fmt.Sprintf(voucher.VoucherDLQKeyFmt, v.Provider.Hex())
-			rdb.RPush(ctx, dlqKey, string(raw))
+			reason := strings.ToLower(status.String())
+			if status == chain.StatusInvalidSignature && resigner != nil && !signerRead {
+				signerRead = true
+				onchainSigner, signerVersion, signerReadErr = resigner.OnchainSigner(ctx)
+				if signerReadErr != nil {
+					log.Warn("read on-chain signer for rejected vouchers", zap.Error(signerReadErr))
+				}
+			}
+			if status == chain.StatusInvalidSignature && resigner != nil && signerReadErr == nil {
+				mismatch, requeued := resigner.ResignMismatched(ctx, v, onchainSigner, signerVersion)
+				if requeued {
+					// Still pending under its sandbox, with a new nonce
+					// once it is signed again.
+					continue
+				}
+				if mismatch {
+					reason = DLQReasonSignerMismatch
+				}
+			}
+			deadLetter(ctx, rdb, codec, v, reason)
 			log.Error("voucher rejected — system config issue",
 				zap.String("status", status.String()),
+				zap.String("reason", reason),
 				zap.String("user", v.User.Hex()),
 				zap.String("provider", v.Provider.Hex()),
 				zap.String("nonce", v.Nonce.String()),
 			)
 
 		case chain.StatusInvalidNonce:
-			log.Warn("voucher discarded: invalid nonce",
+			// checkInvalidNonces tells already-settled from a real gap and
+			// logs it at the matching level.
+			log.Info("voucher discarded: invalid nonce",
 				zap.String("user", v.User.Hex()),
 				zap.String("nonce", v.Nonce.String()),
 			)
 		}
+		// Settled, dead-lettered or discarded: no longer pending. Deferred
+		// and re-queued vouchers skip this and stay listed.
+		clearPending(ctx, rdb, v)
 	}
 }
 
-func persistStop(ctx context.Context, rdb *redis.Client, stopCh chan<- StopSignal, sandboxID, reason string, log *zap.Logger) {
+// ScheduleStop records a stop for sandboxID and notifies the stop handler,
+// exactly as the settler does for a failed settlement.
+func ScheduleStop(ctx context.Context, rdb *redis.Client, stopCh chan<- StopSignal, sandboxID string, reason StopReason, log *zap.Logger) {
+	persistStop(ctx, rdb, stopCh, sandboxID, reason, log)
+}
+
+func persistStop(ctx context.Context, rdb *redis.Client, stopCh chan<- StopSignal, sandboxID string, reason StopReason, log *zap.Logger) {
 	// 1. Persist first (crash-safe)
-	stopKey := "stop:sandbox:" + sandboxID
-	rdb.Set(ctx, stopKey, reason, 0)
+	rdb.Set(ctx, StopKey(sandboxID), string(reason), 0)
 
 	// 2. Notify stop handler via channel
 	select {
@@ -90,6 +167,50 @@ func persistStop(ctx context.Context, rdb *redis.Client, stopCh chan<- StopSigna
 	}
 }
 
+// dlqEntry is a dead-lettered voucher annotated with the rejection reason.
+// The voucher fields are embedded so entries still decode as a SandboxVoucher.
+type dlqEntry struct {
+	voucher.SandboxVoucher
+	Reason string `json:"dlq_reason"`
+	Raw    string `json:"raw,omitempty"` // the queue item, when it could not be decoded
+}
+
+// deadLetter appends v to the provider's DLQ with the given reason, sealed
+// with codec like the queue it came from, and records the reason under its
+// sandbox (see DeadLetterReason).
+func deadLetter(ctx context.Context, rdb *redis.Client, codec *voucher.Codec, v voucher.SandboxVoucher, reason string) {
+	raw, _ := json.Marshal(dlqEntry{SandboxVoucher: v, Reason: reason})
+	item, err := codec.Seal(raw)
+	if err != nil {
+		return
+	}
+	dlqKey := fmt.Sprintf(voucher.VoucherDLQKeyFmt, v.Provider.Hex())
+	rdb.RPush(ctx, dlqKey, item)
+	recordDeadLettered(ctx, rdb, v, reason)
+}
+
+// deadLetterRaw appends a queue item that could not be decoded to the
+// provider's DLQ, keeping the item verbatim so it can be inspected or
+// replayed once the cause (e.g. a retired codec key) is fixed.
+func deadLetterRaw(ctx context.Context, rdb *redis.Client, codec *voucher.Codec, provider common.Address, item string) {
+	raw, _ := json.Marshal(dlqEntry{Reason: "undecodable", Raw: item})
+	sealed, err := codec.Seal(raw)
+	if err != nil {
+		return
+	}
+	dlqKey := fmt.Sprintf(voucher.VoucherDLQKeyFmt, provider.Hex())
+	rdb.RPush(ctx, dlqKey, sealed)
+}
+
+// clearPending removes v from its sandbox's pending-voucher index (see
+// billing.ListPending).
+func clearPending(ctx context.Context, rdb *redis.Client, v voucher.SandboxVoucher) {
+	if v.SandboxID == "" {
+		return
+	}
+	rdb.HDel(ctx, fmt.Sprintf(voucher.PendingKeyFmt, v.SandboxID), v.PendingField())
+}
+
 func extractSandboxID(v voucher.SandboxVoucher) string {
 	return v.SandboxID
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"strconv"
 	"testing"
 
 	"github.com/alicebob/miniredis/v2"
@@ -153,6 +154,32 @@ func TestHandleStatuses_NotAcknowledged_PersistsAndSignals(t *testing.T) {
 	}
 }
 
+type deferAll struct{ deferred []string }
+
+func (d *deferAll) DeferUnacknowledged(_ context.Context, v voucher.SandboxVoucher) bool {
+	d.deferred = append(d.deferred, v.SandboxID)
+	return true
+}
+
+func TestHandleStatuses_NotAcknowledged_DeferredDuringRotation(t *testing.T) {
+	rdb := newTestRedis(t)
+	stopCh := make(chan StopSignal, 4)
+	ctx := context.Background()
+	d := &deferAll{}
+
+	vs := []voucher.SandboxVoucher{makeVoucher("sb-rot")}
+	sts := []chain.SettlementStatus{chain.StatusNotAcknowledged}
+
+	handleStatuses(ctx, rdb, stopCh, testQueueKey, vs, sts, d, nil, nil, zap.NewNop())
+
+	if len(d.deferred) != 1 || d.deferred[0] != "sb-rot" {
+		t.Errorf("deferred: got %v", d.deferred)
+	}
+	if exists, _ := rdb.Exists(ctx, stopKey("sb-rot")).Result(); exists != 0 || len(stopCh) != 0 {
+		t.Error("deferred voucher must not stop the sandbox")
+	}
+}
+
 // ── StatusProviderMismatch → DLQ ─────────────────────────────────────────────
 
 func TestHandleStatuses_ProviderMismatch_WritesToDLQ(t *testing.T) {
@@ -171,6 +198,13 @@ func TestHandleStatuses_ProviderMismatch_WritesToDLQ(t *testing.T) {
 	if n != 1 {
 		t.Errorf("DLQ length: got %d want 1", n)
 	}
+	hash := common.Hash(vs[0].UsageHash).Hex()
+	if reason, err := DeadLetterReason(ctx, rdb, "sb-mismatch", hash); err != nil || reason != "provider_mismatch" {
+		t.Errorf("DeadLetterReason: got %q, %v", reason, err)
+	}
+	if r, _ := GetReceipt(ctx, rdb, "sb-mismatch"); r == nil || r.UsageHash != hash {
+		t.Errorf("receipt should carry the usage hash, got %+v", r)
+	}
 	// No stop signal
 	if len(stopCh) != 0 {
 		t.Errorf("unexpected stop signal for PROVIDER_MISMATCH")
@@ -202,6 +236,74 @@ func TestHandleStatuses_InvalidSignature_WritesToDLQ(t *testing.T) {
 	}
 }
 
+// resignStub answers ResignMismatched with fixed results and counts
+// OnchainSigner lookups in reads, when set.
+type resignStub struct {
+	mismatch, requeued bool
+	reads              *int
+}
+
+func (r resignStub) OnchainSigner(context.Context) (common.Address, *big.Int, error) {
+	if r.reads != nil {
+		*r.reads++
+	}
+	return common.Address{}, big.NewInt(1), nil
+}
+
+func (r resignStub) ResignMismatched(context.Context, voucher.SandboxVoucher, common.Address, *big.Int) (bool, bool) {
+	return r.mismatch, r.requeued
+}
+
+// A voucher signed before a signer bump is re-queued by the signer during a
+// rotation window: it is neither dead-lettered nor cleared from pending.
+func TestHandleStatuses_InvalidSignature_SignerMismatchRequeued(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	v := makeVoucher("sb-bumped")
+	rdb.HSet(ctx, fmt.Sprintf(voucher.PendingKeyFmt, "sb-bumped"), v.PendingField(), "{}")
+
+	handleStatuses(ctx, rdb, make(chan StopSignal, 1), testQueueKey, []voucher.SandboxVoucher{v},
+		[]chain.SettlementStatus{chain.StatusInvalidSignature}, nil, resignStub{mismatch: true, requeued: true}, nil, zap.NewNop())
+
+	if n := rdb.LLen(ctx, dlqKey(testProvider)).Val(); n != 0 {
+		t.Errorf("DLQ length: got %d want 0", n)
+	}
+	if n := rdb.HLen(ctx, fmt.Sprintf(voucher.PendingKeyFmt, "sb-bumped")).Val(); n != 1 {
+		t.Error("re-queued voucher must stay pending")
+	}
+}
+
+// Without an open rotation window the mismatch is dead-lettered under its own
+// reason.
+func TestHandleStatuses_InvalidSignature_SignerMismatchDeadLettered(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	handleStatuses(ctx, rdb, make(chan StopSignal, 1), testQueueKey, []voucher.SandboxVoucher{makeVoucher("sb-bumped")},
+		[]chain.SettlementStatus{chain.StatusInvalidSignature}, nil, resignStub{mismatch: true}, nil, zap.NewNop())
+
+	var got dlqEntry
+	raw, _ := rdb.RPop(ctx, dlqKey(testProvider)).Result()
+	if err := json.Unmarshal([]byte(raw), &got); err != nil || got.Reason != DLQReasonSignerMismatch {
+		t.Errorf("DLQ reason: got %q (%v) want %q", got.Reason, err, DLQReasonSignerMismatch)
+	}
+}
+
+// The on-chain signer is read once for a batch, not once per rejected voucher.
+func TestHandleStatuses_InvalidSignature_SignerReadOncePerBatch(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	var reads int
+	handleStatuses(ctx, rdb, make(chan StopSignal, 2), testQueueKey,
+		[]voucher.SandboxVoucher{makeVoucher("sb-1"), makeVoucher("sb-2")},
+		[]chain.SettlementStatus{chain.StatusInvalidSignature, chain.StatusInvalidSignature},
+		nil, resignStub{mismatch: true, reads: &reads}, nil, zap.NewNop())
+
+	if reads != 1 {
+		t.Errorf("on-chain signer reads: got %d want 1", reads)
+	}
+}
+
 // ── StatusInvalidNonce → discard ─────────────────────────────────────────────
 
 func TestHandleStatuses_InvalidNonce_Discarded(t *testing.T) {
@@ -385,3 +487,192 @@ func TestHandleStatuses_DLQEntry_IsValidVoucher(t *testing.T) {
 		t.Errorf("DLQ Nonce: got %d want 42", got.Nonce.Int64())
 	}
 }
+
+// ── DLQ entry carries the rejection reason ───────────────────────────────────
+
+func TestHandleStatuses_DLQEntry_HasReason(t *testing.T) {
+	rdb := newTestRedis(t)
+	stopCh := make(chan StopSignal, 4)
+	ctx := context.Background()
+
+	vs := []voucher.SandboxVoucher{makeVoucher("sb-reason")}
+	sts := []chain.SettlementStatus{chain.StatusInvalidSignature}
+
+	HandleStatuses(ctx, rdb, stopCh, testQueueKey, "item0", vs, sts, zap.NewNop())
+
+	raw, err := rdb.RPop(ctx, dlqKey(testProvider)).Result()
+	if err != nil {
+		t.Fatalf("DLQ pop: %v", err)
+	}
+	var got dlqEntry
+	if err := json.Unmarshal([]byte(raw), &got); err != nil {
+		t.Fatalf("DLQ entry is not valid JSON: %v", err)
+	}
+	if got.Reason != "invalid_signature" {
+		t.Errorf("DLQ reason: got %q want %q", got.Reason, "invalid_signature")
+	}
+}
+
+// ── usageHash pre-submission check ────────────────────────────────────────────
+
+func TestFirstUsageMismatch(t *testing.T) {
+	good := func(id string) voucher.SandboxVoucher {
+		v := makeVoucher(id)
+		u := voucher.UsageBreakdown{PeriodStart: 100, PeriodEnd: 160, UsageUnits: 60}
+		v.Usage, v.UsageHash = &u, u.Hash(id)
+		return v
+	}
+	bad := good("sb-bad")
+	bad.Usage.PeriodEnd = 220
+
+	if n := firstUsageMismatch([]voucher.SandboxVoucher{good("a"), good("b")}); n != -1 {
+		t.Errorf("all valid: got %d want -1", n)
+	}
+	if n := firstUsageMismatch([]voucher.SandboxVoucher{good("a"), bad, good("c")}); n != 1 {
+		t.Errorf("mismatch at 1: got %d want 1", n)
+	}
+	// Legacy vouchers without a breakdown are not rejected.
+	if n := firstUsageMismatch([]voucher.SandboxVoucher{makeVoucher("legacy")}); n != -1 {
+		t.Errorf("legacy voucher: got %d want -1", n)
+	}
+}
+
+func TestFirstUsageMismatch_Fee(t *testing.T) {
+	priced := func(id string, fee int64) voucher.SandboxVoucher {
+		v := makeVoucher(id)
+		u := voucher.UsageBreakdown{PeriodStart: 100, PeriodEnd: 160, UsageUnits: 60, Rate: big.NewInt(1000)}
+		v.TotalFee, v.Usage, v.UsageHash = big.NewInt(fee), &u, u.Hash(id)
+		return v
+	}
+	if n := firstUsageMismatch([]voucher.SandboxVoucher{priced("a", 60000), priced("b", 60000)}); n != -1 {
+		t.Errorf("all valid: got %d want -1", n)
+	}
+	// The usageHash still matches, but the fee is not 60 s × 1000.
+	if n := firstUsageMismatch([]voucher.SandboxVoucher{priced("a", 60000), priced("b", 61000)}); n != 1 {
+		t.Errorf("fee mismatch at 1: got %d want 1", n)
+	}
+}
+
+// ── Receipts ──────────────────────────────────────────────────────────────────
+
+func TestHandleStatuses_RecordsLatestReceipt(t *testing.T) {
+	rdb := newTestRedis(t)
+	stopCh := make(chan StopSignal, 4)
+	ctx := context.Background()
+
+	first := makeVoucher("sb-r")
+	second := makeVoucher("sb-r")
+	second.Nonce = big.NewInt(2)
+	vs := []voucher.SandboxVoucher{first, second}
+	pushRemaining(t, rdb, testQueueKey, vs)
+
+	HandleStatuses(ctx, rdb, stopCh, testQueueKey, "item0", vs,
+		[]chain.SettlementStatus{chain.StatusSuccess, chain.StatusInsufficientBalance}, zap.NewNop())
+
+	r, err := GetReceipt(ctx, rdb, "sb-r")
+	if err != nil || r == nil {
+		t.Fatalf("GetReceipt: r=%v err=%v", r, err)
+	}
+	if r.Status != "insufficient_balance" || r.Nonce != "2" || r.TotalFee != "100" {
+		t.Errorf("receipt: got %+v", r)
+	}
+	if ttl := rdb.TTL(ctx, receiptKey("sb-r")).Val(); ttl <= 0 {
+		t.Errorf("receipt must expire, ttl=%v", ttl)
+	}
+
+	if r, _ := GetReceipt(ctx, rdb, "sb-none"); r != nil {
+		t.Errorf("expected nil receipt for unknown sandbox, got %+v", r)
+	}
+}
+
+func TestListReceipts_HistoryWithLabels(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	for i := 1; i <= maxReceipts+5; i++ {
+		v := makeVoucher("sb-l")
+		v.Nonce = big.NewInt(int64(i))
+		v.Labels = map[string]string{"team": "infra"}
+		recordReceipt(ctx, rdb, v, chain.StatusSuccess)
+	}
+
+	all, err := ListReceipts(ctx, rdb, "sb-l", 0)
+	if err != nil {
+		t.Fatalf("ListReceipts: %v", err)
+	}
+	if len(all) != maxReceipts {
+		t.Fatalf("history must be capped at %d, got %d", maxReceipts, len(all))
+	}
+	if all[0].Nonce != strconv.Itoa(maxReceipts+5) || all[0].Labels["team"] != "infra" {
+		t.Errorf("newest receipt: got %+v", all[0])
+	}
+
+	two, _ := ListReceipts(ctx, rdb, "sb-l", 2)
+	if len(two) != 2 || two[1].Nonce != strconv.Itoa(maxReceipts+4) {
+		t.Errorf("limit=2: got %+v", two)
+	}
+}
+
+// Every settlement result is also appended to the sandbox's audit timeline,
+// oldest first and capped like the receipts.
+func TestRecordReceipt_AppendsSettledAuditEntry(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	AppendAudit(ctx, rdb, "sb-a", AuditEntry{Event: AuditCreated, At: 1, Fee: "100"})
+	for i := 1; i <= maxAuditEntries; i++ {
+		v := makeVoucher("sb-a")
+		v.Nonce = big.NewInt(int64(i))
+		recordReceipt(ctx, rdb, v, chain.StatusSuccess)
+	}
+
+	audit, err := ListAudit(ctx, rdb, "sb-a")
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	if len(audit) != maxAuditEntries {
+		t.Fatalf("timeline must be capped at %d, got %d", maxAuditEntries, len(audit))
+	}
+	if audit[0].Event != AuditSettled || audit[0].Nonce != "1" {
+		t.Errorf("oldest retained entry: got %+v", audit[0])
+	}
+	last := audit[len(audit)-1]
+	if last.Event != AuditSettled || last.Nonce != strconv.Itoa(maxAuditEntries) || last.Status != "success" || last.Fee != "100" {
+		t.Errorf("newest entry: got %+v", last)
+	}
+	if ttl := rdb.TTL(ctx, auditKey("sb-a")).Val(); ttl <= 0 {
+		t.Errorf("audit timeline must expire, ttl=%v", ttl)
+	}
+}
+
+func TestHandleStatuses_ClearsPendingIndex(t *testing.T) {
+	rdb := newTestRedis(t)
+	stopCh := make(chan StopSignal, 4)
+	ctx := context.Background()
+
+	vs := []voucher.SandboxVoucher{makeVoucher("sb-p"), makeVoucher("sb-p"), makeVoucher("sb-p"), makeVoucher("sb-p")}
+	for i := range vs {
+		vs[i].UsageHash = voucher.BuildUsageHash("sb-p", int64(i), int64(i+1), 1)
+		rdb.HSet(ctx, fmt.Sprintf(voucher.PendingKeyFmt, "sb-p"), vs[i].PendingField(), "{}")
+	}
+	pushRemaining(t, rdb, testQueueKey, vs)
+	sts := []chain.SettlementStatus{chain.StatusSuccess, chain.StatusInvalidSignature, chain.StatusInvalidNonce, chain.StatusNotAcknowledged}
+
+	handleStatuses(ctx, rdb, stopCh, testQueueKey, vs, sts, &deferAll{}, nil, nil, zap.NewNop())
+
+	left, err := rdb.HKeys(ctx, fmt.Sprintf(voucher.PendingKeyFmt, "sb-p")).Result()
+	if err != nil {
+		t.Fatalf("HKEYS: %v", err)
+	}
+	if len(left) != 1 || left[0] != vs[3].PendingField() {
+		t.Errorf("pending after settlement: got %v, want only the deferred voucher", left)
+	}
+}
+
+func TestFirstUsageMismatch_InvalidVoucher(t *testing.T) {
+	zeroUser := makeVoucher("sb-zero")
+	zeroUser.User = common.Address{}
+	if n := firstUsageMismatch([]voucher.SandboxVoucher{makeVoucher("a"), zeroUser}); n != 1 {
+		t.Errorf("zero user at 1: got %d want 1", n)
+	}
+}
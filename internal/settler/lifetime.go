@@ -0,0 +1,64 @@
+package settler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// firstOutsideSession returns the index of the first voucher whose compute
+// period cannot have been billed within its session's lifetime, and why, or
+// -1. longestSec is the longest voucher interval (see config's
+// VOUCHER_INTERVAL_MAX_SEC); 0 skips the length checks.
+//
+// The billing side already clamps periods (see billing's clampPeriod); this
+// is the settler's independent check, from the cleartext breakdown and the
+// persisted session, that bounds what a generator bug can charge:
+//
+//   - a period is at most one longest interval long;
+//   - it ends at most one longest interval after the voucher was enqueued
+//     (one period is pre-charged, never more);
+//   - it does not start before its session did. A session that has since
+//     closed, or was reopened after the voucher was enqueued, is not
+//     checked against.
+//
+// A Redis error skips the session check rather than reject a voucher.
+func firstOutsideSession(ctx context.Context, rdb *redis.Client, longestSec int64, vouchers []voucher.SandboxVoucher) (int, error) {
+	starts := make([]*redis.StringCmd, len(vouchers))
+	pipe := rdb.Pipeline()
+	for i, v := range vouchers {
+		if v.Usage != nil && v.SandboxID != "" {
+			starts[i] = pipe.HGet(ctx, voucher.SessionKeyPrefix+v.SandboxID, "started_at")
+		}
+	}
+	pipe.Exec(ctx) //nolint:errcheck // per-command errors are read below
+
+	for i, v := range vouchers {
+		u := v.Usage
+		if u == nil {
+			continue
+		}
+		if longestSec > 0 {
+			if length := u.PeriodEnd - u.PeriodStart; length > longestSec {
+				return i, fmt.Errorf("period of %ds exceeds the longest voucher interval %ds", length, longestSec)
+			}
+			if v.EnqueuedAt > 0 && u.PeriodEnd > v.EnqueuedAt+longestSec {
+				return i, fmt.Errorf("period ends %ds after the voucher was enqueued", u.PeriodEnd-v.EnqueuedAt)
+			}
+		}
+		if starts[i] == nil {
+			continue
+		}
+		started, err := starts[i].Int64()
+		if err != nil || started <= 0 || v.EnqueuedAt < started {
+			continue
+		}
+		if u.PeriodStart < started {
+			return i, fmt.Errorf("period starts at %d, before its session started at %d", u.PeriodStart, started)
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,98 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// periodVoucher is a compute voucher for [start, end) at 1 neuron/sec, with
+// a breakdown that passes the usageHash and fee checks.
+func periodVoucher(sandboxID string, nonce, start, end, enqueuedAt int64) voucher.SandboxVoucher {
+	v := nonceVoucher(testUser, nonce)
+	v.SandboxID = sandboxID
+	u := voucher.UsageBreakdown{PeriodStart: start, PeriodEnd: end, UsageUnits: end - start, Rate: big.NewInt(1)}
+	v.Usage = &u
+	v.UsageHash = u.Hash(sandboxID)
+	v.TotalFee = u.Fee()
+	v.EnqueuedAt = enqueuedAt
+	return v
+}
+
+func TestFirstOutsideSession(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	now := time.Now().Unix()
+	rdb.HSet(ctx, voucher.SessionKeyPrefix+"sb-open", "started_at", now-600)
+
+	cases := []struct {
+		name string
+		v    voucher.SandboxVoucher
+		want string // "" = accepted
+	}{
+		{"pre-charged period", periodVoucher("sb-open", 1, now, now+60, now), ""},
+		{"caught-up past period", periodVoucher("sb-open", 1, now-300, now-240, now), ""},
+		{"inflated period", periodVoucher("sb-open", 1, now-60, now+86400, now), "exceeds the longest voucher interval"},
+		{"charged too far ahead", periodVoucher("sb-open", 1, now+3600, now+3660, now), "after the voucher was enqueued"},
+		{"before the session", periodVoucher("sb-open", 1, now-660, now-600, now), "before its session started"},
+		{"from an earlier session", periodVoucher("sb-open", 1, now-900, now-840, now-840), ""},
+		{"closed session", periodVoucher("sb-closed", 1, now-900, now-840, now), ""},
+		{"no breakdown", makeVoucher("sb-open"), ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			i, err := firstOutsideSession(ctx, rdb, 120, []voucher.SandboxVoucher{tc.v})
+			if tc.want == "" {
+				if i != -1 {
+					t.Errorf("rejected: %v", err)
+				}
+				return
+			}
+			if i != 0 || err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %d, %v; want rejection %q", i, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRun_PeriodOutsideSessionDeadLettered(t *testing.T) {
+	now := time.Now().Unix()
+	inflated := periodVoucher("sb-2", 2, now-30, now+7*86400, now)
+	vs := []voucher.SandboxVoucher{
+		periodVoucher("sb-1", 1, now, now+60, now),
+		inflated,
+		periodVoucher("sb-3", 3, now, now+60, now),
+	}
+	fc := newFakeChainClient()
+	rdb, queueKey := startSettlerWith(t, func(cfg *config.Config, _ *redis.Client) {
+		cfg.Billing.VoucherIntervalSec = 60
+	}, fc, make(chan StopSignal, 1), vs...)
+
+	// The batch is cut before the inflated voucher, which is dead-lettered
+	// without reaching the chain.
+	if got := fc.next(t); len(got) != 1 || got[0].SandboxID != "sb-1" {
+		t.Fatalf("first batch: %d vouchers, want sb-1 alone", len(got))
+	}
+	if got := fc.next(t); len(got) != 1 || got[0].SandboxID != "sb-3" {
+		t.Fatalf("second batch: %d vouchers, want sb-3 alone", len(got))
+	}
+	waitDrained(t, rdb, queueKey)
+
+	dlq := rdb.LRange(context.Background(), dlqKey(testProvider), 0, -1).Val()
+	if len(dlq) != 1 {
+		t.Fatalf("DLQ has %d entries, want 1", len(dlq))
+	}
+	var entry dlqEntry
+	json.Unmarshal([]byte(dlq[0]), &entry) //nolint:errcheck
+	if entry.SandboxID != "sb-2" || entry.Reason != "period_out_of_session" {
+		t.Errorf("DLQ entry %s/%s, want sb-2/period_out_of_session", entry.SandboxID, entry.Reason)
+	}
+}
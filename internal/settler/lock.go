@@ -0,0 +1,120 @@
+package settler
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const settleLockKeyPrefix = "settle:lock:"
+
+// DefaultLockLease is the settle lock lease used when none is configured.
+const DefaultLockLease = 30 * time.Second
+
+// settleLock serialises settlement across replicas sharing a provider queue,
+// so only one of them pops, signs and submits transactions from the provider
+// account at a time. The lock is a Redis key holding a per-process token with
+// a lease; the holder renews it while a settlement is in flight, and a
+// crashed holder's lease simply expires.
+type settleLock struct {
+	rdb   *redis.Client
+	key   string
+	token string
+	lease time.Duration
+	log   *zap.Logger
+}
+
+func newSettleLock(rdb *redis.Client, provider string, lease time.Duration, log *zap.Logger) *settleLock {
+	if lease <= 0 {
+		lease = DefaultLockLease
+	}
+	b := make([]byte, 16)
+	crand.Read(b) //nolint:errcheck
+	return &settleLock{rdb: rdb, key: settleLockKeyPrefix + provider, token: hex.EncodeToString(b), lease: lease, log: log}
+}
+
+// renewLockScript extends the lease only if the caller still holds the lock.
+//
+// KEYS[1] = lock key
+// ARGV[1] = token, ARGV[2] = lease (ms)
+var renewLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes the lock only if the caller still holds it, so a
+// holder whose lease expired cannot release a lock another replica now owns.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// acquire blocks until the lock is held or ctx is done. Retries are jittered
+// so contending replicas do not poll in lockstep.
+func (l *settleLock) acquire(ctx context.Context) error {
+	for {
+		ok, err := l.rdb.SetNX(ctx, l.key, l.token, l.lease).Result()
+		if err == nil && ok {
+			return nil
+		}
+		if err != nil && ctx.Err() == nil {
+			l.log.Warn("settler: acquire settle lock", zap.String("key", l.key), zap.Error(err))
+		}
+		sleepCtx(ctx, jitter(l.lease/20))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// hold renews the lease every third of it until the returned release is
+// called; release stops renewing and deletes the lock. Neither uses ctx, so
+// the lock is released even when shutdown cancels ctx mid-settlement.
+func (l *settleLock) hold() (release func()) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(l.lease / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				n, err := renewLockScript.Run(context.Background(), l.rdb, []string{l.key}, l.token, l.lease.Milliseconds()).Int()
+				if err != nil {
+					l.log.Warn("settler: renew settle lock", zap.String("key", l.key), zap.Error(err))
+				} else if n == 0 {
+					l.log.Error("settler: settle lock lost mid-settlement — another replica may submit concurrently", zap.String("key", l.key))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := releaseLockScript.Run(ctx, l.rdb, []string{l.key}, l.token).Err(); err != nil {
+			l.log.Warn("settler: release settle lock", zap.String("key", l.key), zap.Error(err))
+		}
+	}
+}
+
+// jitter returns a random duration in [d/2, 3d/2).
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d)
+}
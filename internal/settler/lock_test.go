@@ -0,0 +1,139 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/config"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// slowChain records how many submissions overlap and which sandboxes it saw.
+type slowChain struct {
+	inFlight, maxInFlight atomic.Int32
+	mu                    sync.Mutex
+	seen                  map[string]int
+}
+
+func (c *slowChain) SettleFeesWithTEE(_ context.Context, vs []voucher.SandboxVoucher) ([]chain.SettlementStatus, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		m := c.maxInFlight.Load()
+		if n <= m || c.maxInFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	for _, v := range vs {
+		c.seen[v.SandboxID]++
+	}
+	c.mu.Unlock()
+	return make([]chain.SettlementStatus, len(vs)), nil
+}
+
+func (c *slowChain) settled() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+func TestRun_TwoSettlersContend_OneSubmitsAtATime(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.Chain.ProviderAddress = testProvider.Hex()
+	cfg.Billing.MaxPerUserPerBatch = 1 // small batches so both replicas get turns
+	queueKey := "voucher:queue:" + testProvider.Hex()
+
+	const n = 8
+	for i := 0; i < n; i++ {
+		raw, _ := json.Marshal(makeVoucher("sb-" + string(rune('a'+i))))
+		rdb.RPush(ctx, queueKey, string(raw)) //nolint:errcheck
+	}
+
+	c := &slowChain{seen: map[string]int{}}
+	runCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Run(runCtx, cfg, rdb, c, nopSigner{}, make(chan StopSignal, n), zap.NewNop())
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.settled() < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	if got := c.settled(); got != n {
+		t.Fatalf("settled %d of %d vouchers", got, n)
+	}
+	for id, times := range c.seen {
+		if times != 1 {
+			t.Errorf("%s submitted %d times", id, times)
+		}
+	}
+	if m := c.maxInFlight.Load(); m != 1 {
+		t.Errorf("concurrent submissions: got %d want 1", m)
+	}
+	if l := queueLen(t, rdb, queueKey); l != 0 {
+		t.Errorf("queue not drained: %d left", l)
+	}
+}
+
+func TestSettleLock_RenewsAndExpires(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+	const lease = 300 * time.Millisecond
+	a := newSettleLock(rdb, "prov", lease, zap.NewNop())
+	b := newSettleLock(rdb, "prov", lease, zap.NewNop())
+
+	if err := a.acquire(ctx); err != nil {
+		t.Fatalf("a acquire: %v", err)
+	}
+	release := a.hold()
+
+	// A long settlement: the holder keeps renewing the lease.
+	mr.SetTTL(a.key, 10*time.Millisecond)
+	time.Sleep(lease/3 + 50*time.Millisecond)
+	if ttl := mr.TTL(a.key); ttl != lease {
+		t.Errorf("lease not renewed: TTL %s want %s", ttl, lease)
+	}
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := b.acquire(short); err == nil {
+		t.Fatal("b acquired a lock a still holds")
+	}
+
+	release()
+	if err := b.acquire(ctx); err != nil {
+		t.Fatalf("b acquire after release: %v", err)
+	}
+
+	// b crashes without renewing: its lease runs out and a takes over.
+	mr.FastForward(lease)
+	if err := a.acquire(ctx); err != nil {
+		t.Fatalf("a acquire after b's lease expired: %v", err)
+	}
+	// b's late release must not drop the lock a now holds.
+	b.hold()()
+	if got, _ := rdb.Get(ctx, a.key).Result(); got != a.token {
+		t.Errorf("lock holder after stale release: got %q want a's token", got)
+	}
+}
@@ -0,0 +1,129 @@
+package settler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/events"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// MetricsKey is a Redis hash of settler counters for operator dashboards.
+const MetricsKey = "settler:metrics"
+
+// Counter fields in MetricsKey.
+const (
+	metricNonceGap       = "nonce_gap_detected"
+	metricNonceResync    = "nonce_resynced"
+	metricAlreadySettled = "nonce_already_settled"
+	// metricSettleError is suffixed with the chain.ErrorClass of a failed
+	// submission: settle_error_transient, _permanent or _nonce.
+	metricSettleError = "settle_error_"
+)
+
+// NonceReader reads the contract's last settled nonce for a (user, provider)
+// pair. Satisfied by *chain.Client; Run uses it when the ChainClient also
+// implements it.
+type NonceReader interface {
+	GetLastNonce(ctx context.Context, user, provider common.Address) (*big.Int, error)
+}
+
+// NonceResyncer raises the local nonce counter to the contract's lastNonce.
+// Satisfied by *billing.Signer; Run uses it when the NonceSigner also
+// implements it.
+type NonceResyncer interface {
+	ResyncNonce(ctx context.Context, user, provider common.Address, lastNonce *big.Int) (bool, error)
+}
+
+// checkInvalidNonces inspects every StatusInvalidNonce in a settled batch.
+// The contract rejects a nonce only when it is <= lastNonce, so each rejected
+// voucher is one of:
+//
+//   - nonce <= lastNonce (already_settled): the chain is already past it,
+//     typically because the indexer or another party settled our copy of
+//     the voucher. Dropping it is correct, so it is logged at info. The
+//     local Redis counter is raised to lastNonce in case it is behind too
+//     (e.g. seeded from 0 while the RPC was down); only an actual raise is
+//     worth an event, since every later voucher would have been rejected.
+//   - nonce > lastNonce (nonce_gap): the contract should have accepted it
+//     (gaps of allocated-but-never-settled nonces are fine), so the
+//     rejection is unexpected and is surfaced at warn for investigation.
+//
+// lastNonce is read, and the counter resynced, once per (user, provider).
+// Both cases are counted in MetricsKey.
+func checkInvalidNonces(ctx context.Context, rdb *redis.Client, reader NonceReader, resyncer NonceResyncer, vouchers []voucher.SandboxVoucher, statuses []chain.SettlementStatus, log *zap.Logger) {
+	type pair struct{ user, provider common.Address }
+	lastNonces := map[pair]*big.Int{}
+	resyncedPairs := map[pair]bool{}
+
+	for i, status := range statuses {
+		if status != chain.StatusInvalidNonce || i >= len(vouchers) || vouchers[i].Nonce == nil {
+			continue
+		}
+		v := vouchers[i]
+		k := pair{v.User, v.Provider}
+		last, ok := lastNonces[k]
+		if !ok {
+			var err error
+			if last, err = reader.GetLastNonce(ctx, v.User, v.Provider); err != nil {
+				log.Warn("nonce check: read lastNonce", zap.String("user", v.User.Hex()), zap.Error(err))
+				continue
+			}
+			lastNonces[k] = last
+		}
+		fields := []zap.Field{
+			zap.String("user", v.User.Hex()),
+			zap.String("provider", v.Provider.Hex()),
+			zap.String("sandbox", v.SandboxID),
+			zap.String("voucher_nonce", v.Nonce.String()),
+			zap.String("chain_last_nonce", last.String()),
+		}
+
+		if v.Nonce.Cmp(last) <= 0 {
+			rdb.HIncrBy(ctx, MetricsKey, metricAlreadySettled, 1)
+			log.Info("already_settled — chain lastNonce is past the voucher (settled elsewhere, e.g. by the indexer); voucher dropped",
+				fields...)
+			if resyncer == nil || resyncedPairs[k] {
+				continue
+			}
+			resyncedPairs[k] = true
+			resynced, err := resyncer.ResyncNonce(ctx, v.User, v.Provider, last)
+			if err != nil {
+				log.Error("nonce resync failed", append(fields, zap.Error(err))...)
+				continue
+			}
+			if resynced {
+				rdb.HIncrBy(ctx, MetricsKey, metricNonceResync, 1)
+				log.Warn("nonce_behind_chain — local nonce counter was behind the contract and has been raised to chain lastNonce; "+
+					"runbook: if this repeats, check RPC health at startup (nonce seeding falls back to 0)",
+					fields...)
+				pushNonceEvent(ctx, rdb, v, fmt.Sprintf("Nonce %s behind chain lastNonce %s for %s — counter resynced",
+					v.Nonce, last, v.User.Hex()))
+			}
+			continue
+		}
+
+		rdb.HIncrBy(ctx, MetricsKey, metricNonceGap, 1)
+		log.Warn("nonce_gap — voucher nonce is past chain lastNonce yet was rejected; "+
+			"runbook: gaps are accepted by the contract, so this rejection points at a contract/ABI mismatch — "+
+			"compare billing:nonce:<user>:<provider> with getLastNonce and check the deployed implementation",
+			append(fields, zap.String("gap", new(big.Int).Sub(v.Nonce, new(big.Int).Add(last, big.NewInt(1))).String()))...)
+		pushNonceEvent(ctx, rdb, v, fmt.Sprintf("Nonce gap for %s: voucher nonce %s, chain lastNonce %s",
+			v.User.Hex(), v.Nonce, last))
+	}
+}
+
+func pushNonceEvent(ctx context.Context, rdb *redis.Client, v voucher.SandboxVoucher, msg string) {
+	_ = events.Push(ctx, rdb, events.Event{
+		Type:      events.TypeNonceGap,
+		Message:   msg,
+		SandboxID: v.SandboxID,
+		User:      v.User.Hex(),
+	})
+}
@@ -0,0 +1,83 @@
+package settler
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// orderBatch prepares a signed batch for submission so that each
+// (user, provider) pair's vouchers reach the contract in nonce order.
+//
+// It keeps the longest queue-order prefix in which every pair's nonces form a
+// contiguous run without duplicates, and returns that prefix sorted by
+// (user, provider, nonce). Vouchers after the cut stay in the queue and are
+// picked up by a later batch; cutting a prefix rather than filtering keeps the
+// LPOPs in HandleStatuses aligned with the queue. The first voucher is always
+// kept, so the result is never empty for a non-empty batch.
+func orderBatch(vouchers []voucher.SandboxVoucher) []voucher.SandboxVoucher {
+	type pair struct{ user, provider common.Address }
+	type run struct {
+		min, max *big.Int
+		seen     map[string]bool
+	}
+	runs := map[pair]*run{}
+	broken := 0 // pairs whose nonces in the prefix are not contiguous
+	contiguous := func(r *run) bool {
+		span := new(big.Int).Sub(r.max, r.min)
+		return span.IsInt64() && span.Int64()+1 == int64(len(r.seen))
+	}
+
+	keep := 0
+	for i, v := range vouchers {
+		if v.Nonce == nil {
+			break
+		}
+		k := pair{v.User, v.Provider}
+		r := runs[k]
+		if r == nil {
+			r = &run{min: v.Nonce, max: v.Nonce, seen: map[string]bool{}}
+			runs[k] = r
+		} else if !contiguous(r) {
+			broken--
+		}
+		if r.seen[v.Nonce.String()] {
+			break // duplicate nonce: the contract would reject one of them
+		}
+		r.seen[v.Nonce.String()] = true
+		if v.Nonce.Cmp(r.min) < 0 {
+			r.min = v.Nonce
+		}
+		if v.Nonce.Cmp(r.max) > 0 {
+			r.max = v.Nonce
+		}
+		if !contiguous(r) {
+			broken++
+		}
+		if broken == 0 {
+			keep = i + 1
+		}
+	}
+	if keep == 0 && len(vouchers) > 0 {
+		keep = 1
+	}
+
+	out := append([]voucher.SandboxVoucher(nil), vouchers[:keep]...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if c := bytes.Compare(out[i].User[:], out[j].User[:]); c != 0 {
+			return c < 0
+		}
+		if c := bytes.Compare(out[i].Provider[:], out[j].Provider[:]); c != 0 {
+			return c < 0
+		}
+		if out[i].Nonce == nil || out[j].Nonce == nil {
+			return false
+		}
+		return out[i].Nonce.Cmp(out[j].Nonce) < 0
+	})
+	return out
+}
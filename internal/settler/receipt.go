@@ -0,0 +1,140 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const (
+	receiptKeyPrefix = "settle:receipts:"
+	// deadLetteredKeyPrefix maps a sandbox's dead-lettered vouchers, by usage
+	// hash, to the DLQ reason. Vouchers dead-lettered before they are signed
+	// get no receipt, so this is their only per-sandbox trace.
+	deadLetteredKeyPrefix = "settle:dlq:"
+	// receiptTTL keeps settlement results around after the session closes so
+	// clients can still see what they were charged and why a sandbox stopped.
+	receiptTTL = 7 * 24 * time.Hour
+	// maxReceipts caps the per-sandbox history; older receipts are trimmed.
+	maxReceipts = 100
+)
+
+// Receipt is the settlement result for one of a sandbox's vouchers.
+type Receipt struct {
+	Status    string            `json:"status"` // lowercased chain.SettlementStatus, e.g. "success"
+	Nonce     string            `json:"nonce"`
+	UsageHash string            `json:"usage_hash,omitempty"`
+	TotalFee  string            `json:"total_fee"`
+	SettledAt int64             `json:"settled_at"`
+	Labels    map[string]string `json:"labels,omitempty"` // user labels echoed from the voucher
+}
+
+func receiptKey(sandboxID string) string {
+	return receiptKeyPrefix + sandboxID
+}
+
+// recordReceipt prepends the voucher's settlement result to the sandbox's
+// receipt history, newest first, and appends it to the sandbox's audit
+// timeline. A successful settlement also counts toward the revenue and spend
+// aggregates (see RecordRevenue).
+func recordReceipt(ctx context.Context, rdb *redis.Client, v voucher.SandboxVoucher, status chain.SettlementStatus) {
+	if status == chain.StatusSuccess {
+		RecordRevenue(ctx, rdb, v)
+	}
+	if v.SandboxID == "" {
+		return
+	}
+	r := Receipt{
+		Status:    strings.ToLower(status.String()),
+		UsageHash: common.Hash(v.UsageHash).Hex(),
+		SettledAt: time.Now().Unix(),
+		Labels:    v.Labels,
+	}
+	if v.Nonce != nil {
+		r.Nonce = v.Nonce.String()
+	}
+	if v.TotalFee != nil {
+		r.TotalFee = v.TotalFee.String()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	key := receiptKey(v.SandboxID)
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, key, data)
+	pipe.LTrim(ctx, key, 0, maxReceipts-1)
+	pipe.Expire(ctx, key, receiptTTL)
+	pipe.Exec(ctx) //nolint:errcheck
+
+	AppendAudit(ctx, rdb, v.SandboxID, AuditEntry{
+		Event:  AuditSettled,
+		At:     r.SettledAt,
+		Fee:    r.TotalFee,
+		Nonce:  r.Nonce,
+		Status: r.Status,
+	})
+}
+
+// GetReceipt returns the latest settlement result for sandboxID, or nil if
+// none of its vouchers has been settled (or the receipts have expired).
+func GetReceipt(ctx context.Context, rdb *redis.Client, sandboxID string) (*Receipt, error) {
+	receipts, err := ListReceipts(ctx, rdb, sandboxID, 1)
+	if err != nil || len(receipts) == 0 {
+		return nil, err
+	}
+	return &receipts[0], nil
+}
+
+// ListReceipts returns up to limit settlement results for sandboxID, newest
+// first. limit <= 0 returns the whole retained history.
+func ListReceipts(ctx context.Context, rdb *redis.Client, sandboxID string, limit int) ([]Receipt, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	raw, err := rdb.LRange(ctx, receiptKey(sandboxID), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	receipts := make([]Receipt, 0, len(raw))
+	for _, s := range raw {
+		var r Receipt
+		if err := json.Unmarshal([]byte(s), &r); err != nil {
+			continue
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, nil
+}
+
+// recordDeadLettered notes that v was dead-lettered with reason, for
+// DeadLetterReason.
+func recordDeadLettered(ctx context.Context, rdb *redis.Client, v voucher.SandboxVoucher, reason string) {
+	if v.SandboxID == "" {
+		return
+	}
+	key := deadLetteredKeyPrefix + v.SandboxID
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, common.Hash(v.UsageHash).Hex(), reason)
+	pipe.Expire(ctx, key, receiptTTL)
+	pipe.Exec(ctx) //nolint:errcheck
+}
+
+// DeadLetterReason returns the DLQ reason of the sandbox's voucher with the
+// given usage hash, or "" if it was not dead-lettered (or the record has
+// expired).
+func DeadLetterReason(ctx context.Context, rdb *redis.Client, sandboxID, usageHash string) (string, error) {
+	reason, err := rdb.HGet(ctx, deadLetteredKeyPrefix+sandboxID, usageHash).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return reason, err
+}
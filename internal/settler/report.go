@@ -0,0 +1,280 @@
+package settler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/metrics"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+// Throughput counter fields in MetricsKey, written once per submitted batch.
+const (
+	metricBatchesSettled   = "batches_settled"   // batches the chain accepted
+	metricBatchesFailed    = "batches_failed"    // submissions that errored or returned bad statuses
+	metricVouchersSettled  = "vouchers_settled"  // vouchers with StatusSuccess
+	metricVouchersRejected = "vouchers_rejected" // vouchers in accepted batches with any other status
+	metricTxLatencyMs      = "tx_latency_ms"     // summed latency of accepted submissions
+)
+
+// recordBatch counts one SettleFeesWithTEE call that took latency. statuses
+// is nil when the call failed.
+func recordBatch(ctx context.Context, rdb *redis.Client, statuses []chain.SettlementStatus, latency time.Duration) {
+	pipe := rdb.Pipeline()
+	if statuses == nil {
+		pipe.HIncrBy(ctx, MetricsKey, metricBatchesFailed, 1)
+	} else {
+		settled := 0
+		for _, s := range statuses {
+			if s == chain.StatusSuccess {
+				settled++
+			}
+		}
+		pipe.HIncrBy(ctx, MetricsKey, metricBatchesSettled, 1)
+		pipe.HIncrBy(ctx, MetricsKey, metricVouchersSettled, int64(settled))
+		pipe.HIncrBy(ctx, MetricsKey, metricVouchersRejected, int64(len(statuses)-settled))
+		pipe.HIncrBy(ctx, MetricsKey, metricTxLatencyMs, latency.Milliseconds())
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+// Report summarises settlement throughput over one reporting window.
+// Suggestions are advisory only; nothing acts on them.
+type Report struct {
+	WindowStart int64 `json:"window_start"`
+	WindowEnd   int64 `json:"window_end"`
+
+	VouchersSettled  int64   `json:"vouchers_settled"`
+	VouchersRejected int64   `json:"vouchers_rejected"`
+	BatchesSettled   int64   `json:"batches_settled"`
+	BatchesFailed    int64   `json:"batches_failed"`
+	SettledPerMin    float64 `json:"settled_per_min"`
+	AvgBatchSize     float64 `json:"avg_batch_size"`
+	MaxBatchSize     int     `json:"max_batch_size"`
+	AvgTxLatencySec  float64 `json:"avg_tx_latency_sec"`
+
+	QueueDepth      int64   `json:"queue_depth"`
+	QueueGrowth     int64   `json:"queue_growth"` // depth change over the window
+	OldestAgeSec    float64 `json:"oldest_voucher_age_sec"`
+	VoucherInterval int64   `json:"voucher_interval_sec"`
+
+	Suggestions []string `json:"suggestions"`
+}
+
+// counters is a snapshot of the throughput fields of MetricsKey.
+type counters struct {
+	batchesSettled, batchesFailed, vouchersSettled, vouchersRejected, txLatencyMs int64
+}
+
+func readCounters(ctx context.Context, rdb *redis.Client) (counters, error) {
+	m, err := rdb.HGetAll(ctx, MetricsKey).Result()
+	if err != nil {
+		return counters{}, err
+	}
+	n := func(field string) int64 {
+		v, _ := strconv.ParseInt(m[field], 10, 64)
+		return v
+	}
+	return counters{
+		batchesSettled:   n(metricBatchesSettled),
+		batchesFailed:    n(metricBatchesFailed),
+		vouchersSettled:  n(metricVouchersSettled),
+		vouchersRejected: n(metricVouchersRejected),
+		txLatencyMs:      n(metricTxLatencyMs),
+	}, nil
+}
+
+// Reporter periodically turns the settler counters and the queue state into
+// a Report, logs it and keeps the latest for the admin endpoint. It only
+// reads; the counters themselves are written by Run.
+type Reporter struct {
+	rdb                *redis.Client
+	queueKey           string
+	codec              *voucher.Codec
+	interval           time.Duration
+	voucherIntervalSec int64
+	maxBatch           int
+	clock              clock.Clock
+	log                *zap.Logger
+
+	// Window baseline, owned by Run.
+	prev      counters
+	prevDepth int64
+	prevAt    time.Time
+
+	mu     sync.Mutex
+	latest *Report
+}
+
+// NewReporter returns a Reporter for provider's queue (items opened with
+// codec, nil = plaintext) that reports every interval once Run is called.
+// voucherIntervalSec is the generation interval lag is judged against.
+func NewReporter(rdb *redis.Client, provider string, codec *voucher.Codec, interval time.Duration, voucherIntervalSec int64, log *zap.Logger) *Reporter {
+	return &Reporter{
+		rdb:                rdb,
+		queueKey:           fmt.Sprintf(voucher.VoucherQueueKeyFmt, provider),
+		codec:              codec,
+		interval:           interval,
+		voucherIntervalSec: voucherIntervalSec,
+		maxBatch:           defaultMaxBatchSize,
+		clock:              clock.Real{},
+		log:                log,
+	}
+}
+
+// SetClock replaces the real clock used to time windows and queue lag. A nil
+// clock restores the real one.
+func (r *Reporter) SetClock(c clock.Clock) {
+	r.clock = clock.OrReal(c)
+}
+
+// SetMaxBatchSize sets the settler's batch cap (SETTLE_MAX_BATCH_SIZE) that
+// reports judge batch fill against. n <= 0 keeps the default.
+func (r *Reporter) SetMaxBatchSize(n int) {
+	if n > 0 {
+		r.maxBatch = n
+	}
+}
+
+// Run takes a baseline immediately, then reports every interval until ctx is
+// cancelled.
+func (r *Reporter) Run(ctx context.Context) {
+	if err := r.baseline(ctx); err != nil {
+		r.log.Warn("settle report: baseline", zap.Error(err))
+	}
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rep, err := r.Tick(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.log.Warn("settle report", zap.Error(err))
+				}
+				continue
+			}
+			r.log.Info("settle report",
+				zap.Int64("vouchers_settled", rep.VouchersSettled),
+				zap.Float64("settled_per_min", rep.SettledPerMin),
+				zap.Float64("avg_batch_size", rep.AvgBatchSize),
+				zap.Float64("avg_tx_latency_sec", rep.AvgTxLatencySec),
+				zap.Int64("batches_failed", rep.BatchesFailed),
+				zap.Int64("queue_depth", rep.QueueDepth),
+				zap.Float64("oldest_voucher_age_sec", rep.OldestAgeSec),
+				zap.Strings("suggestions", rep.Suggestions),
+			)
+		}
+	}
+}
+
+func (r *Reporter) baseline(ctx context.Context) error {
+	r.prevAt = r.clock.Now()
+	c, err := readCounters(ctx, r.rdb)
+	if err != nil {
+		return err
+	}
+	q, err := metrics.ReadQueue(ctx, r.rdb, r.queueKey, r.codec, r.prevAt)
+	if err != nil {
+		return err
+	}
+	r.prev, r.prevDepth = c, q.Depth
+	return nil
+}
+
+// Tick builds the report for the window since the previous tick (or the
+// baseline), stores it as the latest and starts the next window.
+func (r *Reporter) Tick(ctx context.Context) (*Report, error) {
+	now := r.clock.Now()
+	c, err := readCounters(ctx, r.rdb)
+	if err != nil {
+		return nil, err
+	}
+	q, err := metrics.ReadQueue(ctx, r.rdb, r.queueKey, r.codec, now)
+	if err != nil {
+		return nil, err
+	}
+	rep := buildReport(r.prev, c, r.prevAt, now, r.prevDepth, q, r.voucherIntervalSec, r.maxBatch)
+	r.prev, r.prevDepth, r.prevAt = c, q.Depth, now
+
+	r.mu.Lock()
+	r.latest = rep
+	r.mu.Unlock()
+	return rep, nil
+}
+
+// Latest returns the most recent report, or nil before the first one.
+func (r *Reporter) Latest() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latest
+}
+
+// buildReport derives the window's throughput from two counter snapshots.
+// A counter that went backwards (MetricsKey reset) counts from zero.
+func buildReport(prev, cur counters, start, end time.Time, prevDepth int64, q metrics.QueueState, voucherIntervalSec int64, maxBatch int) *Report {
+	delta := func(a, b int64) int64 {
+		if b < a {
+			return b
+		}
+		return b - a
+	}
+	rep := &Report{
+		WindowStart:      start.Unix(),
+		WindowEnd:        end.Unix(),
+		VouchersSettled:  delta(prev.vouchersSettled, cur.vouchersSettled),
+		VouchersRejected: delta(prev.vouchersRejected, cur.vouchersRejected),
+		BatchesSettled:   delta(prev.batchesSettled, cur.batchesSettled),
+		BatchesFailed:    delta(prev.batchesFailed, cur.batchesFailed),
+		MaxBatchSize:     maxBatch,
+		QueueDepth:       q.Depth,
+		QueueGrowth:      q.Depth - prevDepth,
+		OldestAgeSec:     q.OldestAgeSec,
+		VoucherInterval:  voucherIntervalSec,
+	}
+	if mins := end.Sub(start).Minutes(); mins > 0 {
+		rep.SettledPerMin = float64(rep.VouchersSettled) / mins
+	}
+	if rep.BatchesSettled > 0 {
+		rep.AvgBatchSize = float64(rep.VouchersSettled+rep.VouchersRejected) / float64(rep.BatchesSettled)
+		rep.AvgTxLatencySec = float64(delta(prev.txLatencyMs, cur.txLatencyMs)) / 1000 / float64(rep.BatchesSettled)
+	}
+	rep.Suggestions = suggest(rep)
+	return rep
+}
+
+// suggest applies rough heuristics to a report. Settlement is lagging when
+// the head voucher has waited more than two voucher intervals, i.e. the
+// settler falls behind generation.
+func suggest(rep *Report) []string {
+	var out []string
+	submitted := rep.BatchesSettled + rep.BatchesFailed
+	if submitted > 0 && rep.BatchesFailed*5 > submitted {
+		out = append(out, fmt.Sprintf("%d of %d batch submissions failed: check the RPC endpoint and the settler logs", rep.BatchesFailed, submitted))
+	}
+	lagging := rep.VoucherInterval > 0 && rep.OldestAgeSec > float64(2*rep.VoucherInterval)
+	switch {
+	case lagging && rep.AvgBatchSize >= 0.9*float64(rep.MaxBatchSize):
+		out = append(out, fmt.Sprintf("settlement lagging (%.0fs) with full batches: increase the batch size or the voucher interval", rep.OldestAgeSec))
+	case lagging && rep.AvgTxLatencySec > float64(rep.VoucherInterval)/2:
+		out = append(out, fmt.Sprintf("settlement lagging (%.0fs) on slow transactions (%.1fs each): raise the gas tip or check the RPC endpoint", rep.OldestAgeSec, rep.AvgTxLatencySec))
+	case lagging:
+		out = append(out, fmt.Sprintf("settlement lagging (%.0fs behind)", rep.OldestAgeSec))
+	case rep.QueueGrowth > int64(rep.MaxBatchSize):
+		out = append(out, fmt.Sprintf("queue grew by %d vouchers this window: settlement may be falling behind", rep.QueueGrowth))
+	}
+	if len(out) == 0 {
+		out = append(out, "settlement keeping up")
+	}
+	return out
+}
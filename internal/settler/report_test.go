@@ -0,0 +1,92 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/clock"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+func TestReporter_Tick(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	r := NewReporter(rdb, testProvider.Hex(), nil, 5*time.Minute, 60, zap.NewNop())
+	r.SetClock(clk)
+
+	// Counters from before the baseline are not part of the first window.
+	recordBatch(ctx, rdb, []chain.SettlementStatus{chain.StatusSuccess}, time.Second)
+	if err := r.baseline(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r.Latest() != nil {
+		t.Fatal("report before the first tick")
+	}
+
+	ok := make([]chain.SettlementStatus, 10)
+	recordBatch(ctx, rdb, ok, 2*time.Second)
+	recordBatch(ctx, rdb, append(ok[:9:9], chain.StatusInsufficientBalance), 4*time.Second)
+	recordBatch(ctx, rdb, nil, time.Second)
+
+	queueKey := fmt.Sprintf(voucher.VoucherQueueKeyFmt, testProvider.Hex())
+	clk.Advance(5 * time.Minute)
+	raw, _ := json.Marshal(voucher.SandboxVoucher{SandboxID: "sb-1", EnqueuedAt: clk.Now().Add(-30 * time.Second).Unix()})
+	rdb.RPush(ctx, queueKey, raw) //nolint:errcheck
+
+	rep, err := r.Tick(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.VouchersSettled != 19 || rep.VouchersRejected != 1 || rep.BatchesSettled != 2 || rep.BatchesFailed != 1 {
+		t.Errorf("counts: %+v", rep)
+	}
+	if rep.SettledPerMin != 3.8 || rep.AvgBatchSize != 10 || rep.AvgTxLatencySec != 3 {
+		t.Errorf("rates: per min %v, batch %v, latency %v; want 3.8, 10, 3", rep.SettledPerMin, rep.AvgBatchSize, rep.AvgTxLatencySec)
+	}
+	if rep.QueueDepth != 1 || rep.QueueGrowth != 1 || rep.OldestAgeSec != 30 {
+		t.Errorf("queue: depth %d growth %d age %v, want 1, 1, 30", rep.QueueDepth, rep.QueueGrowth, rep.OldestAgeSec)
+	}
+	if r.Latest() != rep {
+		t.Error("Latest does not return the last report")
+	}
+
+	// The next window starts where this one ended.
+	rdb.LPop(ctx, queueKey)
+	clk.Advance(5 * time.Minute)
+	rep, _ = r.Tick(ctx)
+	if rep.VouchersSettled != 0 || rep.BatchesSettled != 0 || rep.QueueGrowth != -1 {
+		t.Errorf("idle window: %+v", rep)
+	}
+	if len(rep.Suggestions) != 1 || rep.Suggestions[0] != "settlement keeping up" {
+		t.Errorf("idle window suggestions %q", rep.Suggestions)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		rep  Report
+		want string
+	}{
+		{"keeping up", Report{BatchesSettled: 10, AvgBatchSize: 5, OldestAgeSec: 30}, "keeping up"},
+		{"failures", Report{BatchesSettled: 3, BatchesFailed: 2}, "2 of 5 batch submissions failed"},
+		{"full batches", Report{AvgBatchSize: 50, OldestAgeSec: 600}, "increase the batch size"},
+		{"slow txs", Report{AvgBatchSize: 5, AvgTxLatencySec: 45, OldestAgeSec: 600}, "raise the gas tip"},
+		{"lagging", Report{AvgBatchSize: 5, AvgTxLatencySec: 2, OldestAgeSec: 600}, "settlement lagging (600s behind)"},
+		{"growing", Report{QueueGrowth: 200, OldestAgeSec: 30}, "queue grew by 200"},
+	} {
+		tc.rep.MaxBatchSize, tc.rep.VoucherInterval = defaultMaxBatchSize, 60
+		got := strings.Join(suggest(&tc.rep), "; ")
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("%s: suggestions %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
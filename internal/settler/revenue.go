@@ -0,0 +1,196 @@
+package settler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+const (
+	// revenueKeyFmt is the provider's total settled fees (decimal neuron).
+	revenueKeyFmt = "revenue:total:%s"
+	// spendKeyFmt is a user's total settled fees with a provider (decimal
+	// neuron), keyed user then provider.
+	spendKeyFmt = "spend:total:%s:%s"
+	// spendRankKeyFmt ranks the provider's users by spend. Scores are float64
+	// approximations for ordering only; spendKeyFmt holds the exact totals.
+	spendRankKeyFmt = "spend:rank:%s"
+	// revenueCountedKeyFmt marks a (provider, user, nonce) voucher as counted,
+	// so a voucher settled again (e.g. resubmitted after a reorg dropped its
+	// first settlement) is not counted twice.
+	revenueCountedKeyFmt = "revenue:counted:%s:%s:%s"
+	// revenueCountedTTL outlives any resubmission of the same voucher.
+	revenueCountedTTL = 30 * 24 * time.Hour
+	// costKeyFmt is a sandbox's lifetime settled fees (decimal neuron):
+	// create fee plus every compute period. It has no TTL while the sandbox
+	// exists; ExpireSandboxCost gives it receiptTTL once it is deleted.
+	costKeyFmt = "cost:%s"
+)
+
+// addRevenueScript adds ARGV[1] (a non-negative decimal integer) to the
+// provider's revenue, the user's spend and, when KEYS[5] is given, the
+// sandbox's lifetime cost, unless the voucher's marker KEYS[1] is already
+// set. Totals can exceed 2^63 neuron, so they are stored as decimal strings
+// and added digit by digit.
+//
+// KEYS[1] = revenue:counted:{provider}:{user}:{nonce}
+// KEYS[2] = revenue:total:{provider}
+// KEYS[3] = spend:total:{user}:{provider}
+// KEYS[4] = spend:rank:{provider}
+// KEYS[5] = cost:{sandboxID} (optional)
+// ARGV[1] = fee, ARGV[2] = user, ARGV[3] = marker TTL (seconds)
+// Returns 1 if counted, 0 if the voucher was already counted.
+var addRevenueScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], '1', 'NX', 'EX', ARGV[3]) then
+  return 0
+end
+local function add(a, b)
+  local out, carry = {}, 0
+  local i, j = #a, #b
+  while i > 0 or j > 0 or carry > 0 do
+    local d = carry
+    if i > 0 then d = d + tonumber(string.sub(a, i, i)); i = i - 1 end
+    if j > 0 then d = d + tonumber(string.sub(b, j, j)); j = j - 1 end
+    out[#out + 1] = d % 10
+    carry = math.floor(d / 10)
+  end
+  return string.reverse(table.concat(out))
+end
+redis.call('SET', KEYS[2], add(redis.call('GET', KEYS[2]) or '0', ARGV[1]))
+local spend = add(redis.call('GET', KEYS[3]) or '0', ARGV[1])
+redis.call('SET', KEYS[3], spend)
+redis.call('ZADD', KEYS[4], tonumber(spend), ARGV[2])
+if KEYS[5] then
+  redis.call('SET', KEYS[5], add(redis.call('GET', KEYS[5]) or '0', ARGV[1]), 'KEEPTTL')
+end
+return 1
+`)
+
+// RecordRevenue adds a successfully settled voucher's fee to the provider's
+// revenue, the user's spend and the sandbox's lifetime cost, at most once
+// per voucher. Best effort: a Redis error leaves the aggregates short rather
+// than failing settlement. cmd/reindex also replays chain events through it;
+// those carry no sandbox ID, so only the provider and user totals are
+// rebuilt.
+func RecordRevenue(ctx context.Context, rdb *redis.Client, v voucher.SandboxVoucher) {
+	if v.TotalFee == nil || v.TotalFee.Sign() <= 0 || v.Nonce == nil {
+		return
+	}
+	provider, user := v.Provider.Hex(), v.User.Hex()
+	keys := []string{
+		fmt.Sprintf(revenueCountedKeyFmt, provider, user, v.Nonce.String()),
+		fmt.Sprintf(revenueKeyFmt, provider),
+		fmt.Sprintf(spendKeyFmt, user, provider),
+		fmt.Sprintf(spendRankKeyFmt, provider),
+	}
+	if v.SandboxID != "" {
+		keys = append(keys, fmt.Sprintf(costKeyFmt, v.SandboxID))
+	}
+	addRevenueScript.Run(ctx, rdb, keys, v.TotalFee.String(), user, int64(revenueCountedTTL/time.Second)) //nolint:errcheck
+}
+
+// UserSpend is a user's total settled fees with a provider.
+type UserSpend struct {
+	User     string `json:"user"`
+	TotalFee string `json:"total_fee"` // decimal neuron
+}
+
+// ProviderRevenue returns the provider's total settled fees in neuron ("0"
+// before the first settlement).
+func ProviderRevenue(ctx context.Context, rdb *redis.Client, provider common.Address) (string, error) {
+	total, err := rdb.Get(ctx, fmt.Sprintf(revenueKeyFmt, provider.Hex())).Result()
+	if err == redis.Nil {
+		return "0", nil
+	}
+	return total, err
+}
+
+// SandboxCost returns the sandbox's lifetime settled fees in neuron ("0"
+// before its first settlement). Vouchers still queued are not included.
+func SandboxCost(ctx context.Context, rdb *redis.Client, sandboxID string) (string, error) {
+	total, err := rdb.Get(ctx, fmt.Sprintf(costKeyFmt, sandboxID)).Result()
+	if err == redis.Nil {
+		return "0", nil
+	}
+	return total, err
+}
+
+// expireCostScript gives a sandbox's lifetime cost KEYS[1] the TTL ARGV[1]
+// (seconds) unless it already has one, creating it as "0" when the sandbox
+// never settled.
+// Returns {cost, 1} on the first call, {cost, 0} once the TTL is set.
+var expireCostScript = redis.NewScript(`
+local ttl = redis.call('TTL', KEYS[1])
+if ttl == -2 then
+  redis.call('SET', KEYS[1], '0', 'EX', ARGV[1])
+  return {'0', 1}
+end
+local cost = redis.call('GET', KEYS[1])
+if ttl == -1 then
+  redis.call('EXPIRE', KEYS[1], ARGV[1])
+  return {cost, 1}
+end
+return {cost, 0}
+`)
+
+// ExpireSandboxCost gives a deleted sandbox's lifetime cost receiptTTL, so it
+// outlives the sandbox as long as its receipts do, and returns the cost at
+// the delete. Vouchers that settle after the delete still count, without
+// extending the TTL. A sandbox deleted before its first settlement gets a
+// zero cost with that TTL, since the script's KEEPTTL write would otherwise
+// create the key without one. first is false if the cost already had its
+// TTL, i.e. the sandbox was already deleted, or on a Redis error.
+func ExpireSandboxCost(ctx context.Context, rdb *redis.Client, sandboxID string) (cost string, first bool) {
+	key := fmt.Sprintf(costKeyFmt, sandboxID)
+	res, err := expireCostScript.Run(ctx, rdb, []string{key}, int64(receiptTTL/time.Second)).Slice()
+	if err != nil || len(res) != 2 {
+		return "", false
+	}
+	cost, _ = res[0].(string)
+	n, _ := res[1].(int64)
+	return cost, n == 1
+}
+
+// TopSpenders returns up to limit of the provider's users by total spend,
+// highest first, or lowest first when ascending. limit <= 0 returns all.
+func TopSpenders(ctx context.Context, rdb *redis.Client, provider common.Address, limit int, ascending bool) ([]UserSpend, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	rank := fmt.Sprintf(spendRankKeyFmt, provider.Hex())
+	var (
+		users []string
+		err   error
+	)
+	if ascending {
+		users, err = rdb.ZRange(ctx, rank, 0, stop).Result()
+	} else {
+		users, err = rdb.ZRevRange(ctx, rank, 0, stop).Result()
+	}
+	if err != nil || len(users) == 0 {
+		return []UserSpend{}, err
+	}
+	keys := make([]string, len(users))
+	for i, u := range users {
+		keys[i] = fmt.Sprintf(spendKeyFmt, u, provider.Hex())
+	}
+	totals, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]UserSpend, 0, len(users))
+	for i, u := range users {
+		total, _ := totals[i].(string)
+		if total == "" {
+			total = "0"
+		}
+		out = append(out, UserSpend{User: u, TotalFee: total})
+	}
+	return out, nil
+}
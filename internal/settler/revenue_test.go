@@ -0,0 +1,140 @@
+package settler
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+
+	"github.com/0gfoundation/0g-sandbox/internal/chain"
+	"github.com/0gfoundation/0g-sandbox/internal/voucher"
+)
+
+func TestRevenue_CountsSuccessOnce(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	other := common.HexToAddress("0xBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB")
+
+	// Fees above 2^63 must add exactly.
+	big1, _ := new(big.Int).SetString("9000000000000000000", 10)
+	v1 := makeVoucher("sb-1")
+	v1.TotalFee = big1
+	v2 := makeVoucher("sb-1")
+	v2.TotalFee, v2.Nonce = big1, big.NewInt(2)
+	v3 := makeVoucher("sb-2")
+	v3.User = other
+	v4 := makeVoucher("sb-2")
+	v4.User, v4.Nonce = other, big.NewInt(2)
+
+	vs := []voucher.SandboxVoucher{v1, v2, v3, v4}
+	sts := []chain.SettlementStatus{chain.StatusSuccess, chain.StatusSuccess, chain.StatusSuccess, chain.StatusInsufficientBalance}
+	HandleStatuses(ctx, rdb, make(chan StopSignal, 4), testQueueKey, "item0", vs, sts, zap.NewNop())
+
+	// The same vouchers settled again, e.g. resubmitted after a reorg.
+	HandleStatuses(ctx, rdb, make(chan StopSignal, 4), testQueueKey, "item0", vs[:3], sts[:3], zap.NewNop())
+
+	total, err := ProviderRevenue(ctx, rdb, testProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != "18000000000000000100" {
+		t.Errorf("revenue: got %s, want 18000000000000000100", total)
+	}
+
+	top, err := TopSpenders(ctx, rdb, testProvider, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].User != testUser.Hex() || top[0].TotalFee != "18000000000000000000" ||
+		top[1].User != other.Hex() || top[1].TotalFee != "100" {
+		t.Errorf("top spenders: got %+v", top)
+	}
+
+	low, _ := TopSpenders(ctx, rdb, testProvider, 1, true)
+	if len(low) != 1 || low[0].User != other.Hex() {
+		t.Errorf("lowest spender: got %+v", low)
+	}
+}
+
+func TestSandboxCost_SumsSettledVouchers(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	// The create-fee voucher and two compute periods settle; a fourth does not.
+	var vs []voucher.SandboxVoucher
+	for i, fee := range []int64{500, 300, 200, 999} {
+		v := makeVoucher("sb-c")
+		v.TotalFee, v.Nonce = big.NewInt(fee), big.NewInt(int64(i+1))
+		v.Usage = &voucher.UsageBreakdown{UsageUnits: 1, Rate: big.NewInt(fee)}
+		if i == 0 {
+			v.Usage = &voucher.UsageBreakdown{CreateFee: big.NewInt(fee)}
+		}
+		vs = append(vs, v)
+	}
+	other := makeVoucher("sb-d")
+	other.Nonce = big.NewInt(5)
+	vs = append(vs, other)
+	sts := []chain.SettlementStatus{chain.StatusSuccess, chain.StatusSuccess, chain.StatusSuccess, chain.StatusInsufficientBalance, chain.StatusSuccess}
+	HandleStatuses(ctx, rdb, make(chan StopSignal, 5), testQueueKey, "item0", vs, sts, zap.NewNop())
+	// Settled again after a reorg: not counted twice.
+	HandleStatuses(ctx, rdb, make(chan StopSignal, 5), testQueueKey, "item0", vs, sts, zap.NewNop())
+
+	if cost, err := SandboxCost(ctx, rdb, "sb-c"); err != nil || cost != "1000" {
+		t.Errorf("sb-c cost: got %q, %v, want 1000", cost, err)
+	}
+	if cost, _ := SandboxCost(ctx, rdb, "sb-d"); cost != "100" {
+		t.Errorf("sb-d cost: got %q, want 100", cost)
+	}
+	if cost, err := SandboxCost(ctx, rdb, "sb-none"); err != nil || cost != "0" {
+		t.Errorf("unsettled sandbox: got %q, %v", cost, err)
+	}
+
+	// Once deleted the counter expires with the receipts; a late settlement
+	// still counts and keeps the TTL.
+	if cost, first := ExpireSandboxCost(ctx, rdb, "sb-c"); cost != "1000" || !first {
+		t.Errorf("delete: got cost %q, first %v, want 1000, true", cost, first)
+	}
+	if _, first := ExpireSandboxCost(ctx, rdb, "sb-c"); first {
+		t.Error("second delete reported as first")
+	}
+	late := makeVoucher("sb-c")
+	late.Nonce = big.NewInt(6)
+	HandleStatuses(ctx, rdb, make(chan StopSignal, 1), testQueueKey, "item0", []voucher.SandboxVoucher{late}, []chain.SettlementStatus{chain.StatusSuccess}, zap.NewNop())
+	if cost, _ := SandboxCost(ctx, rdb, "sb-c"); cost != "1100" {
+		t.Errorf("cost after late settlement: got %q, want 1100", cost)
+	}
+	if ttl := rdb.TTL(ctx, "cost:sb-c").Val(); ttl <= 0 || ttl > receiptTTL {
+		t.Errorf("deleted sandbox's cost TTL: got %v", ttl)
+	}
+	if ttl := rdb.TTL(ctx, "cost:sb-d").Val(); ttl != -1 {
+		t.Errorf("live sandbox's cost TTL: got %v, want none", ttl)
+	}
+
+	// Deleted before its first settlement: the settlement that follows must
+	// not leave a cost without a TTL.
+	if cost, first := ExpireSandboxCost(ctx, rdb, "sb-e"); cost != "0" || !first {
+		t.Errorf("delete before settlement: got cost %q, first %v, want 0, true", cost, first)
+	}
+	first := makeVoucher("sb-e")
+	first.Nonce = big.NewInt(7)
+	HandleStatuses(ctx, rdb, make(chan StopSignal, 1), testQueueKey, "item0", []voucher.SandboxVoucher{first}, []chain.SettlementStatus{chain.StatusSuccess}, zap.NewNop())
+	if cost, _ := SandboxCost(ctx, rdb, "sb-e"); cost != "100" {
+		t.Errorf("cost settled after delete: got %q, want 100", cost)
+	}
+	if ttl := rdb.TTL(ctx, "cost:sb-e").Val(); ttl <= 0 || ttl > receiptTTL {
+		t.Errorf("cost settled after delete: TTL %v", ttl)
+	}
+}
+
+func TestRevenue_Empty(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	if total, err := ProviderRevenue(ctx, rdb, testProvider); err != nil || total != "0" {
+		t.Errorf("revenue: got %q, %v", total, err)
+	}
+	if top, err := TopSpenders(ctx, rdb, testProvider, 10, false); err != nil || len(top) != 0 {
+		t.Errorf("top spenders: got %+v, %v", top, err)
+	}
+}
@@ -0,0 +1,94 @@
+package settler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StopReason is why a sandbox was stopped automatically. Its value is what is
+// stored in stop:sandbox:{id} and stopreason:{id}, and appears in logs and
+// audit events, so existing values must not change.
+type StopReason string
+
+const (
+	// StopInsufficientBalance: a voucher settled as INSUFFICIENT_BALANCE.
+	StopInsufficientBalance StopReason = "insufficient_balance"
+	// StopNotAcknowledged: the user has not acknowledged the TEE signer.
+	StopNotAcknowledged StopReason = "not_acknowledged"
+	// StopBillingInitFailed: a new sandbox's opening vouchers could not be
+	// queued (see billing.EventHandler.OnCreate).
+	StopBillingInitFailed StopReason = "billing_init_failed"
+	// StopHandlerPanic: the proxy panicked after Daytona created the sandbox.
+	StopHandlerPanic StopReason = "handler_panic"
+)
+
+// UserMessage explains the stop to the sandbox owner.
+func (r StopReason) UserMessage() string {
+	switch r {
+	case StopInsufficientBalance:
+		return "Stopped: insufficient balance. Deposit funds with this provider, then start the sandbox again."
+	case StopNotAcknowledged:
+		return "Stopped: the provider's TEE signer is not acknowledged for your account. Acknowledge it, then start the sandbox again."
+	case StopBillingInitFailed:
+		return "Stopped: billing could not be started for this sandbox. Please try again later."
+	case StopHandlerPanic:
+		return "Stopped: an internal error occurred while the sandbox was being set up. Please try again later."
+	case "":
+		return "Stopped."
+	default:
+		return "Stopped: " + strings.ReplaceAll(string(r), "_", " ") + "."
+	}
+}
+
+const (
+	stopKeyPrefix       = "stop:sandbox:"
+	stopReasonKeyPrefix = "stopreason:"
+	// stopReasonTTL is how long the reason of a carried-out stop is kept.
+	stopReasonTTL = 30 * 24 * time.Hour
+)
+
+// StopKey is the Redis key of a sandbox's pending stop; its value is the
+// StopReason.
+func StopKey(sandboxID string) string { return stopKeyPrefix + sandboxID }
+
+// StopRecord is the last automatic stop of a sandbox, kept at
+// stopreason:{id} after the stop has been carried out. Message is filled in
+// from Reason when the record is read.
+type StopRecord struct {
+	Reason    StopReason `json:"reason"`
+	Message   string     `json:"message,omitempty"`
+	StoppedAt int64      `json:"stopped_at"`
+}
+
+// RecordStop stores reason as the sandbox's last automatic stop, replacing
+// any earlier one. Called once the stop has been carried out.
+func RecordStop(ctx context.Context, rdb *redis.Client, sandboxID string, reason StopReason, at time.Time) error {
+	b, err := json.Marshal(StopRecord{Reason: reason, StoppedAt: at.Unix()})
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, stopReasonKeyPrefix+sandboxID, b, stopReasonTTL).Err()
+}
+
+// GetStopRecord returns the sandbox's last automatic stop, or nil if none is
+// recorded.
+func GetStopRecord(ctx context.Context, rdb *redis.Client, sandboxID string) (*StopRecord, error) {
+	raw, err := rdb.Get(ctx, stopReasonKeyPrefix+sandboxID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec StopRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, err
+	}
+	rec.Message = rec.Reason.UserMessage()
+	return &rec, nil
+}
@@ -0,0 +1,50 @@
+package settler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStopReason_ValuesAndMessages(t *testing.T) {
+	// The values are stored in Redis by earlier releases; they must not change.
+	for r, want := range map[StopReason]string{
+		StopInsufficientBalance: "insufficient_balance",
+		StopNotAcknowledged:     "not_acknowledged",
+		StopBillingInitFailed:   "billing_init_failed",
+		StopHandlerPanic:        "handler_panic",
+	} {
+		if string(r) != want {
+			t.Errorf("%s: value changed to %q", want, r)
+		}
+		if msg := r.UserMessage(); !strings.HasPrefix(msg, "Stopped: ") || strings.Contains(msg, "_") {
+			t.Errorf("%s: user message %q", r, msg)
+		}
+	}
+	if got := StopReason("disk_full").UserMessage(); got != "Stopped: disk full." {
+		t.Errorf("unknown reason: got %q", got)
+	}
+}
+
+func TestRecordStop_GetStopRecord(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if rec, err := GetStopRecord(ctx, rdb, "sb-1"); err != nil || rec != nil {
+		t.Fatalf("no record: got %v, %v", rec, err)
+	}
+	if err := RecordStop(ctx, rdb, "sb-1", StopNotAcknowledged, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := GetStopRecord(ctx, rdb, "sb-1")
+	if err != nil || rec == nil {
+		t.Fatalf("GetStopRecord: %v, %v", rec, err)
+	}
+	if rec.Reason != StopNotAcknowledged || rec.StoppedAt != 1700000000 || rec.Message != StopNotAcknowledged.UserMessage() {
+		t.Errorf("record: got %+v", rec)
+	}
+	if ttl := rdb.TTL(ctx, "stopreason:sb-1").Val(); ttl <= 0 || ttl > stopReasonTTL {
+		t.Errorf("TTL: got %s", ttl)
+	}
+}
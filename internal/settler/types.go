@@ -2,6 +2,9 @@ package settler
 
 import (
 	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/0gfoundation/0g-sandbox/internal/chain"
 	"github.com/0gfoundation/0g-sandbox/internal/voucher"
@@ -10,12 +13,24 @@ import (
 // StopSignal carries the reason a sandbox should be stopped.
 type StopSignal struct {
 	SandboxID string
-	Reason    string // "insufficient_balance" | "not_acknowledged"
+	Reason    StopReason
 }
 
 // ChainClient submits signed vouchers to the settlement contract.
 // Satisfied by *chain.Client; decoupled here so the settler can be tested
-// without a live RPC connection.
+// without a live RPC connection (see fakeChainClient in the package tests).
+//
+// SettleFeesWithTEE settles one batch, in the order given. On success it
+// returns exactly one status per voucher, index for index; Run handles each
+// (stop signal, dead letter, discard, …) and pops the batch from the queue.
+// An error means the batch did not settle; Run classifies it (see
+// chain.ErrorClassifier): a transient error leaves the batch queued for a
+// retry after retryBackoff, a nonce issue resyncs the sending account's nonce
+// first, and a permanent one (e.g. the tx reverted) isolates the voucher at
+// fault by settling the batch one voucher at a time, dead-lettering any
+// voucher that still fails permanently on its own. A status slice of the
+// wrong length is treated as transient. A client may also implement
+// NonceReader for nonce-gap detection and AccountNonceResyncer.
 type ChainClient interface {
 	SettleFeesWithTEE(ctx context.Context, vouchers []voucher.SandboxVoucher) ([]chain.SettlementStatus, error)
 }
@@ -27,3 +42,29 @@ type ChainClient interface {
 type NonceSigner interface {
 	Sign(ctx context.Context, v *voucher.SandboxVoucher) error
 }
+
+// AckDeferrer is an optional NonceSigner capability: during a TEE key
+// rotation window it parks NOT_ACKNOWLEDGED vouchers instead of letting the
+// settler stop the sandbox. Satisfied by *billing.Signer.
+type AckDeferrer interface {
+	DeferUnacknowledged(ctx context.Context, v voucher.SandboxVoucher) bool
+}
+
+// SignerMismatchResigner is an optional NonceSigner capability for
+// INVALID_SIGNATURE vouchers. OnchainSigner reads the contract's current TEE
+// signer and signerVersion, once per batch. ResignMismatched reports whether
+// v was signed by a key other than that signer (the signer was rotated and
+// signerVersion bumped after v was signed), and whether v was put back on the
+// queue to be signed again with the current signer's key, which happens only
+// within a key rotation window. Satisfied by *billing.Signer.
+type SignerMismatchResigner interface {
+	OnchainSigner(ctx context.Context) (common.Address, *big.Int, error)
+	ResignMismatched(ctx context.Context, v voucher.SandboxVoucher, onchain common.Address, version *big.Int) (mismatch, requeued bool)
+}
+
+// AccountNonceResyncer is an optional ChainClient capability: it makes the
+// next transaction re-read the sending account's nonce from the node.
+// Satisfied by *chain.Client.
+type AccountNonceResyncer interface {
+	ResyncAccountNonce()
+}
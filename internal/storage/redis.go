@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps each value in a string key under prefix and indexes the
+// keys in a sorted set (all scored 0, so ZRANGEBYLEX answers List).
+//
+// Redis key layout, for prefix p:
+//
+//	p + "obj:" + key   value
+//	p + "idx"          sorted set of keys
+type RedisStore struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedisStore returns a Store keeping its data under the Redis key prefix.
+func NewRedisStore(rdb *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{rdb: rdb, prefix: prefix}
+}
+
+func (s *RedisStore) objKey(key string) string { return s.prefix + "obj:" + key }
+func (s *RedisStore) idxKey() string           { return s.prefix + "idx" }
+
+func (s *RedisStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, s.objKey(key), data, 0)
+	pipe.ZAdd(ctx, s.idxKey(), redis.Z{Member: key})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Append uses APPEND, so concurrent appends to one key do not lose data.
+func (s *RedisStore) Append(ctx context.Context, key string, data []byte) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Append(ctx, s.objKey(key), string(data))
+	pipe.ZAdd(ctx, s.idxKey(), redis.Z{Member: key})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.rdb.Get(ctx, s.objKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return data, err
+}
+
+func (s *RedisStore) List(ctx context.Context, prefix string, opts ListOptions) ([]string, error) {
+	lo, hi := "-", "+"
+	if start := max(prefix, opts.Start); start != "" {
+		lo = "[" + start
+	}
+	// Every UTF-8 key with prefix sorts before prefix+"\xff".
+	end := opts.End
+	if prefix != "" && (end == "" || prefix+"\xff" < end) {
+		end = prefix + "\xff"
+	}
+	if end != "" {
+		hi = "(" + end
+	}
+	rng := &redis.ZRangeBy{Min: lo, Max: hi}
+	if opts.Limit > 0 {
+		rng.Count = int64(opts.Limit)
+	}
+	keys, err := s.rdb.ZRangeByLex(ctx, s.idxKey(), rng).Result()
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, s.objKey(key))
+	pipe.ZRem(ctx, s.idxKey(), key)
+	_, err := pipe.Exec(ctx)
+	return err
+}
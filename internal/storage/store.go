@@ -0,0 +1,127 @@
+// Package storage is the durable-blob backend shared by features that write
+// data meant to outlive Redis's working set (the voucher archive and the
+// settlement receipts it carries).
+//
+// A Store holds opaque values under "/"-separated keys. Callers namespace
+// their keys (see Namespace) so several features can share one backend, and
+// list them back by prefix and lexicographic range, which is how date- or
+// sequence-named keys are range-queried.
+//
+// MemStore (tests), FSStore (a local directory) and RedisStore are built in.
+// Another backend, such as 0G storage or an object store, is plugged in by
+// implementing Store; this module carries no 0G storage client.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key that holds no value.
+var ErrNotFound = errors.New("storage: not found")
+
+// Store is a key-value blob store.
+type Store interface {
+	// Put stores data under key, replacing any previous value.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the value under key, or an error satisfying
+	// errors.Is(err, ErrNotFound).
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys with the given prefix that fall in opts' range,
+	// in ascending lexicographic order.
+	List(ctx context.Context, prefix string, opts ListOptions) ([]string, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Appender is implemented by stores that can add to the end of a value
+// without rewriting it. Use Append, which falls back to Get and Put.
+type Appender interface {
+	// Append adds data to the end of the value under key, creating it if
+	// needed.
+	Append(ctx context.Context, key string, data []byte) error
+}
+
+// ListOptions narrows a List to a key range. Zero values mean unbounded.
+type ListOptions struct {
+	Start string // first key to include
+	End   string // first key to exclude
+	Limit int    // max keys returned; <= 0 for all
+}
+
+// includes reports whether key is in the range.
+func (o ListOptions) includes(key string) bool {
+	return (o.Start == "" || key >= o.Start) && (o.End == "" || key < o.End)
+}
+
+// Append adds data to the end of the value under key: natively when s is an
+// Appender, otherwise by rewriting the whole value, which is only safe with
+// a single writer per key.
+func Append(ctx context.Context, s Store, key string, data []byte) error {
+	if a, ok := s.(Appender); ok {
+		return a.Append(ctx, key, data)
+	}
+	old, err := s.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return s.Put(ctx, key, append(bytes.Clone(old), data...))
+}
+
+// CheckKey rejects keys that could escape a namespace or a directory: empty,
+// absolute, or with an empty, "." or ".." segment.
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." || strings.ContainsRune(seg, '\\') {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// Namespace returns a view of s whose keys all live under ns + "/". Keys
+// passed to and returned by the view are relative to the namespace.
+func Namespace(s Store, ns string) Store {
+	return &namespaced{s: s, prefix: strings.TrimSuffix(ns, "/") + "/"}
+}
+
+type namespaced struct {
+	s      Store
+	prefix string
+}
+
+func (n *namespaced) Put(ctx context.Context, key string, data []byte) error {
+	return n.s.Put(ctx, n.prefix+key, data)
+}
+
+func (n *namespaced) Get(ctx context.Context, key string) ([]byte, error) {
+	return n.s.Get(ctx, n.prefix+key)
+}
+
+func (n *namespaced) Delete(ctx context.Context, key string) error {
+	return n.s.Delete(ctx, n.prefix+key)
+}
+
+func (n *namespaced) List(ctx context.Context, prefix string, opts ListOptions) ([]string, error) {
+	if opts.Start != "" {
+		opts.Start = n.prefix + opts.Start
+	}
+	if opts.End != "" {
+		opts.End = n.prefix + opts.End
+	}
+	keys, err := n.s.List(ctx, n.prefix+prefix, opts)
+	for i, k := range keys {
+		keys[i] = strings.TrimPrefix(k, n.prefix)
+	}
+	return keys, err
+}
+
+func (n *namespaced) Append(ctx context.Context, key string, data []byte) error {
+	return Append(ctx, n.s, n.prefix+key, data)
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// backends returns a fresh instance of every built-in Store.
+func backends(t *testing.T) map[string]Store {
+	t.Helper()
+	fsStore, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return map[string]Store{
+		"mem":   NewMemStore(),
+		"fs":    fsStore,
+		"redis": NewRedisStore(rdb, "test:"),
+	}
+}
+
+// appendOnly hides a store's native Append so Append's Get+Put fallback runs.
+type appendOnly struct{ Store }
+
+func TestStore_Conformance(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get missing: %v, want ErrNotFound", err)
+			}
+			if err := s.Put(ctx, "a/2026-03-01", []byte("v1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put(ctx, "a/2026-03-01", []byte("v2")); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.Get(ctx, "a/2026-03-01"); err != nil || string(got) != "v2" {
+				t.Errorf("Get after overwrite: %q, %v", got, err)
+			}
+
+			for _, k := range []string{"a/2026-03-02", "a/2026-03-10", "b/2026-03-01", "ab/x"} {
+				if err := s.Put(ctx, k, []byte(k)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			list := func(prefix string, opts ListOptions) []string {
+				t.Helper()
+				keys, err := s.List(ctx, prefix, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return keys
+			}
+			if got, want := list("a/", ListOptions{}), []string{"a/2026-03-01", "a/2026-03-02", "a/2026-03-10"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("List a/: %v, want %v", got, want)
+			}
+			if got, want := list("a/", ListOptions{Start: "a/2026-03-02", End: "a/2026-03-10"}), []string{"a/2026-03-02"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("List range: %v, want %v", got, want)
+			}
+			if got, want := list("", ListOptions{Limit: 2}), []string{"a/2026-03-01", "a/2026-03-02"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("List limit: %v, want %v", got, want)
+			}
+			if got := list("c/", ListOptions{}); len(got) != 0 {
+				t.Errorf("List empty prefix: %v", got)
+			}
+
+			if err := Append(ctx, s, "log/day", []byte("one\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := Append(ctx, appendOnly{s}, "log/day", []byte("two\n")); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := s.Get(ctx, "log/day"); string(got) != "one\ntwo\n" {
+				t.Errorf("appended: %q", got)
+			}
+
+			if err := s.Delete(ctx, "a/2026-03-01"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(ctx, "a/2026-03-01"); err != nil {
+				t.Errorf("Delete missing: %v", err)
+			}
+			if _, err := s.Get(ctx, "a/2026-03-01"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get deleted: %v", err)
+			}
+			if got := list("a/", ListOptions{}); len(got) != 2 {
+				t.Errorf("List after delete: %v", got)
+			}
+
+			if err := s.Put(ctx, "../escape", []byte("x")); err == nil {
+				t.Error("Put accepted a key escaping the store")
+			}
+		})
+	}
+}
+
+func TestNamespace_IsolatesKeys(t *testing.T) {
+	ctx := context.Background()
+	base := NewMemStore()
+	archive, receipts := Namespace(base, "archive"), Namespace(base, "receipts")
+
+	archive.Put(ctx, "p/2026-03-01", []byte("a"))
+	receipts.Put(ctx, "p/2026-03-01", []byte("r"))
+	if err := Append(ctx, archive, "p/2026-03-01", []byte("+")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := archive.Get(ctx, "p/2026-03-01"); string(got) != "a+" {
+		t.Errorf("archive value: %q", got)
+	}
+	if got, _ := receipts.Get(ctx, "p/2026-03-01"); string(got) != "r" {
+		t.Errorf("receipts value: %q", got)
+	}
+	keys, _ := archive.List(ctx, "p/", ListOptions{Start: "p/2026-01-01"})
+	if !reflect.DeepEqual(keys, []string{"p/2026-03-01"}) {
+		t.Errorf("namespaced List: %v, want keys relative to the namespace", keys)
+	}
+	if all, _ := base.List(ctx, "", ListOptions{}); !reflect.DeepEqual(all, []string{"archive/p/2026-03-01", "receipts/p/2026-03-01"}) {
+		t.Errorf("base keys: %v", all)
+	}
+}
@@ -0,0 +1,116 @@
+// Package units converts between 0G token amounts and neuron, the smallest
+// on-chain unit (1 0G = 1e18 neuron). Conversions are exact: decimal strings
+// are parsed digit by digit, never through floating point.
+package units
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimals is the number of fractional digits of one 0G.
+const Decimals = 18
+
+var neuronPerOG = new(big.Int).Exp(big.NewInt(10), big.NewInt(Decimals), nil)
+
+// ParseOG converts a non-negative decimal 0G amount such as "0.1" or
+// "123.456" to neuron. More than Decimals fractional digits is an error, as
+// the amount would not be representable.
+func ParseOG(s string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return nil, fmt.Errorf("invalid 0G amount %q", s)
+	}
+	if hasDot && fracPart == "" {
+		return nil, fmt.Errorf("invalid 0G amount %q: missing fractional digits", s)
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return nil, fmt.Errorf("invalid 0G amount %q", s)
+	}
+	if len(fracPart) > Decimals {
+		return nil, fmt.Errorf("invalid 0G amount %q: more than %d fractional digits", s, Decimals)
+	}
+	digits := intPart + fracPart + strings.Repeat("0", Decimals-len(fracPart))
+	n, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid 0G amount %q", s)
+	}
+	return n, nil
+}
+
+// ParseAmount parses an amount given either as a plain neuron integer
+// ("60000000000000000") or as a decimal followed by a unit ("0.06 0G",
+// "100 neuron"). It is used for flags and config values that are denominated
+// in neuron but are easier to write in 0G.
+func ParseAmount(s string) (*big.Int, error) {
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 1:
+		return parseNeuron(fields[0], s)
+	case len(fields) == 2 && strings.EqualFold(fields[1], "0G"):
+		return ParseOG(fields[0])
+	case len(fields) == 2 && strings.EqualFold(fields[1], "neuron"):
+		return parseNeuron(fields[0], s)
+	default:
+		return nil, fmt.Errorf("invalid amount %q: want <neuron> or <decimal> 0G", s)
+	}
+}
+
+// FormatOG renders a neuron amount as an exact decimal 0G string with
+// trailing fractional zeros removed, e.g. 1e17 → "0.1".
+func FormatOG(neuron *big.Int) string {
+	sign := ""
+	n := new(big.Int).Set(neuron)
+	if n.Sign() < 0 {
+		sign = "-"
+		n.Neg(n)
+	}
+	q, r := new(big.Int).QuoRem(n, neuronPerOG, new(big.Int))
+	if r.Sign() == 0 {
+		return sign + q.String()
+	}
+	frac := fmt.Sprintf("%0*s", Decimals, r.String())
+	return sign + q.String() + "." + strings.TrimRight(frac, "0")
+}
+
+// FormatOGPlaces renders a neuron amount like FormatOG, rounded half away
+// from zero to at most places fractional digits, e.g. 1.25e18 at one place →
+// "1.3". places >= Decimals is exact; places < 0 is treated as 0.
+func FormatOGPlaces(neuron *big.Int, places int) string {
+	if places >= Decimals {
+		return FormatOG(neuron)
+	}
+	if places < 0 {
+		places = 0
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Decimals-places)), nil)
+	n := new(big.Int).Abs(neuron)
+	q, r := new(big.Int).QuoRem(n, unit, new(big.Int))
+	if r.Lsh(r, 1).Cmp(unit) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	q.Mul(q, unit)
+	if neuron.Sign() < 0 {
+		q.Neg(q)
+	}
+	return FormatOG(q)
+}
+
+func parseNeuron(digits, orig string) (*big.Int, error) {
+	if digits == "" || !isDigits(digits) {
+		return nil, fmt.Errorf("invalid neuron amount %q", orig)
+	}
+	n, _ := new(big.Int).SetString(digits, 10)
+	return n, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
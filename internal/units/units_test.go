@@ -0,0 +1,115 @@
+package units
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseOG(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"0.1", "100000000000000000"},
+		{"0.000000000000000001", "1"},
+		{"123.456", "123456000000000000000"},
+		{"1", "1000000000000000000"},
+		{".5", "500000000000000000"},
+		{"0", "0"},
+		{" 0.01 ", "10000000000000000"},
+	}
+	for _, tc := range cases {
+		got, err := ParseOG(tc.in)
+		if err != nil {
+			t.Errorf("ParseOG(%q): %v", tc.in, err)
+			continue
+		}
+		if got.String() != tc.want {
+			t.Errorf("ParseOG(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseOG_Rejects(t *testing.T) {
+	for _, in := range []string{
+		"0.0000000000000000001", // 19 fractional digits
+		"", ".", "1.", "-1", "1e18", "1,5", "0x10", "1.2.3",
+	} {
+		if got, err := ParseOG(in); err == nil {
+			t.Errorf("ParseOG(%q) = %s, want error", in, got)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"60000000000000000", "60000000000000000"},
+		{"0.06 0G", "60000000000000000"},
+		{"2 0g", "2000000000000000000"},
+		{"100 neuron", "100"},
+	}
+	for _, tc := range cases {
+		got, err := ParseAmount(tc.in)
+		if err != nil {
+			t.Errorf("ParseAmount(%q): %v", tc.in, err)
+			continue
+		}
+		if got.String() != tc.want {
+			t.Errorf("ParseAmount(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"", "0.5", "1.5 neuron", "1 ETH", "-5"} {
+		if _, err := ParseAmount(in); err == nil {
+			t.Errorf("ParseAmount(%q): want error", in)
+		}
+	}
+}
+
+func TestFormatOG(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"100000000000000000", "0.1"},
+		{"1", "0.000000000000000001"},
+		{"123456000000000000000", "123.456"},
+		{"2000000000000000000", "2"},
+		{"0", "0"},
+	}
+	for _, tc := range cases {
+		n, _ := new(big.Int).SetString(tc.in, 10)
+		if got := FormatOG(n); got != tc.want {
+			t.Errorf("FormatOG(%s) = %q, want %q", tc.in, got, tc.want)
+		}
+		if back, err := ParseOG(tc.want); err != nil || back.Cmp(n) != 0 {
+			t.Errorf("round trip %s: got %v, %v", tc.in, back, err)
+		}
+	}
+}
+
+func TestFormatOGPlaces(t *testing.T) {
+	cases := []struct {
+		in     string
+		places int
+		want   string
+	}{
+		{"1250000000000000000", 1, "1.3"},
+		{"1240000000000000000", 1, "1.2"},
+		{"-1250000000000000000", 1, "-1.3"},
+		{"10000000000000000000", 6, "10"},
+		{"16667", 6, "0"},
+		{"16667", 18, "0.000000000000016667"},
+		{"999999999999999999", 4, "1"},
+		{"123456789000000000", 0, "0"},
+		{"500000000000000000", -1, "1"},
+	}
+	for _, tc := range cases {
+		n, _ := new(big.Int).SetString(tc.in, 10)
+		if got := FormatOGPlaces(n, tc.places); got != tc.want {
+			t.Errorf("FormatOGPlaces(%s, %d) = %q, want %q", tc.in, tc.places, got, tc.want)
+		}
+	}
+}
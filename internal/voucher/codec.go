@@ -0,0 +1,131 @@
+package voucher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks a Redis item encrypted by a Codec. The full form is
+// "enc:<keyID>:<base64(nonce||ciphertext)>".
+const sealedPrefix = "enc:"
+
+// ErrUnknownKey is returned by Open for an item sealed under a key ID the
+// codec does not hold.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Codec encrypts vouchers (and the DLQ and archive records derived from them)
+// before they are written to Redis, with AES-256-GCM. Each sealed item names
+// the key that sealed it, so keys can be rotated: new items are sealed with
+// the first key and any configured key opens them.
+//
+// A nil *Codec stores items as plaintext.
+type Codec struct {
+	sealID string
+	keys   map[string]cipher.AEAD
+}
+
+// NewCodec parses spec, a comma-separated list of "<keyID>:<hex key>" with
+// 32-byte keys, e.g. "k2:<64 hex>,k1:<64 hex>". The first key seals; all of
+// them open. An empty spec returns a nil Codec (plaintext).
+func NewCodec(spec string) (*Codec, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	c := &Codec{keys: make(map[string]cipher.AEAD)}
+	// Errors never quote key material.
+	for i, entry := range strings.Split(spec, ",") {
+		id, keyHex, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("encryption key #%d: want <keyID>:<hex key>", i+1)
+		}
+		if strings.ContainsAny(id, " \t") {
+			return nil, fmt.Errorf("encryption key ID %q: must not contain spaces", id)
+		}
+		if _, dup := c.keys[id]; dup {
+			return nil, fmt.Errorf("encryption key ID %q: listed twice", id)
+		}
+		key, err := hex.DecodeString(strings.TrimPrefix(keyHex, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: not hex", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q: %d bytes, want 32", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		if c.sealID == "" {
+			c.sealID = id
+		}
+		c.keys[id] = aead
+	}
+	return c, nil
+}
+
+// KeyID is the ID of the key new items are sealed with, or "" for a nil
+// Codec.
+func (c *Codec) KeyID() string {
+	if c == nil {
+		return ""
+	}
+	return c.sealID
+}
+
+// Seal returns plain as the string to store in Redis: encrypted under the
+// first key, or unchanged for a nil Codec.
+func (c *Codec) Seal(plain []byte) (string, error) {
+	if c == nil {
+		return string(plain), nil
+	}
+	aead := c.keys[c.sealID]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("seal: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(c.sealID))
+	return sealedPrefix + c.sealID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open returns the plaintext of an item read from Redis. Items that are not
+// sealed are returned as-is, so plaintext items queued before encryption was
+// enabled still settle; a nil Codec cannot open sealed items.
+func (c *Codec) Open(item string) ([]byte, error) {
+	rest, sealed := strings.CutPrefix(item, sealedPrefix)
+	if !sealed {
+		return []byte(item), nil
+	}
+	id, payload, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, errors.New("open: malformed sealed item")
+	}
+	if c == nil {
+		return nil, fmt.Errorf("open: item sealed with key %q but encryption is not configured: %w", id, ErrUnknownKey)
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("open: key %q: %w", id, ErrUnknownKey)
+	}
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, errors.New("open: sealed item too short")
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("open: key %q: %w", id, err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,123 @@
+package voucher
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey1 = "k1:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testKey2 = "k2:0x1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+)
+
+func mustCodec(t *testing.T, spec string) *Codec {
+	t.Helper()
+	c, err := NewCodec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	c := mustCodec(t, testKey1)
+	v := SandboxVoucher{SandboxID: "sb-1", TotalFee: big.NewInt(1000), Nonce: big.NewInt(7)}
+	raw, _ := json.Marshal(v)
+
+	item, err := c.Seal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(item, "enc:k1:") || strings.Contains(item, "sb-1") {
+		t.Fatalf("sealed item %q: want an enc:k1: prefix and no cleartext", item)
+	}
+	if again, _ := c.Seal(raw); again == item {
+		t.Error("sealing twice produced the same item; nonce reused")
+	}
+
+	plain, err := c.Open(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SandboxVoucher
+	if err := json.Unmarshal(plain, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SandboxID != "sb-1" || got.TotalFee.Int64() != 1000 || got.Nonce.Int64() != 7 {
+		t.Errorf("round trip: got %+v", got)
+	}
+
+	// Tampering is detected.
+	tampered := item[:len(item)-2] + "AA"
+	if tampered == item {
+		tampered = item[:len(item)-2] + "BB"
+	}
+	if _, err := c.Open(tampered); err == nil {
+		t.Error("tampered item opened")
+	}
+}
+
+func TestCodec_Plaintext(t *testing.T) {
+	var nilCodec *Codec
+	if c := mustCodec(t, " "); c != nil {
+		t.Fatalf("blank spec: got %+v want nil", c)
+	}
+	if item, _ := nilCodec.Seal([]byte(`{"a":1}`)); item != `{"a":1}` {
+		t.Errorf("nil codec sealed %q", item)
+	}
+
+	// Items queued before encryption was enabled still open.
+	c := mustCodec(t, testKey1)
+	if plain, err := c.Open(`{"a":1}`); err != nil || string(plain) != `{"a":1}` {
+		t.Errorf("plaintext item: got %q, %v", plain, err)
+	}
+
+	// Sealed items cannot be read once encryption is switched off.
+	item, _ := c.Seal([]byte(`{"a":1}`))
+	if _, err := nilCodec.Open(item); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("nil codec opening a sealed item: got %v want ErrUnknownKey", err)
+	}
+}
+
+func TestCodec_KeyRotation(t *testing.T) {
+	old := mustCodec(t, testKey1)
+	rotated := mustCodec(t, testKey2+","+testKey1)
+	if rotated.KeyID() != "k2" {
+		t.Fatalf("sealing key %q, want k2", rotated.KeyID())
+	}
+
+	item, _ := old.Seal([]byte("queued before rotation"))
+	if plain, err := rotated.Open(item); err != nil || string(plain) != "queued before rotation" {
+		t.Errorf("old item after rotation: got %q, %v", plain, err)
+	}
+	fresh, _ := rotated.Seal([]byte("queued after rotation"))
+	if !strings.HasPrefix(fresh, "enc:k2:") {
+		t.Errorf("new item %q not sealed with k2", fresh)
+	}
+
+	// Once k1 is retired, its items are reported rather than misread.
+	retired := mustCodec(t, testKey2)
+	if _, err := retired.Open(item); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("retired key: got %v want ErrUnknownKey", err)
+	}
+}
+
+func TestNewCodec_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"deadbeef",                // no key ID
+		"k1:zz",                   // not hex
+		"k1:00ff",                 // too short
+		testKey1 + "," + testKey1, // duplicate ID
+		"a b:" + testKey1[3:],     // space in ID
+	} {
+		if _, err := NewCodec(spec); err == nil {
+			t.Errorf("NewCodec(%q): want error", spec)
+		}
+	}
+	if _, err := NewCodec("k1:zz" + testKey1[3:]); err == nil || strings.Contains(err.Error(), testKey1[3:]) {
+		t.Errorf("bad hex: got %v, want an error that does not quote the key", err)
+	}
+}
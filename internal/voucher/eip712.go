@@ -2,23 +2,43 @@ package voucher
 
 import (
 	"crypto/ecdsa"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// eip712Prefix starts every voucher digest: EIP-191 version 0x01 (typed
+// data). Wallet auth signatures are EIP-191 version 0x45 (personal_sign), so
+// neither kind of signature verifies as the other; the domain separator then
+// keeps vouchers apart from other typed data such as deposit authorizations.
+const eip712Prefix = "\x19\x01"
+
 var voucherTypeHash = crypto.Keccak256Hash([]byte(
 	"SandboxVoucher(address user,address provider,bytes32 usageHash,uint256 nonce,uint256 totalFee)",
 ))
 
-// domainSeparator computes the EIP-712 domain separator.
+// The EIP-712 domain name and version the contract is initialized with.
+const (
+	DefaultDomainName    = "0G Sandbox Serving"
+	DefaultDomainVersion = "1"
+)
+
+// domainSeparator computes the EIP-712 domain separator for the default
+// domain name and version.
 func domainSeparator(chainID *big.Int, contractAddr common.Address) [32]byte {
+	return DomainSeparatorFor(DefaultDomainName, DefaultDomainVersion, chainID, contractAddr)
+}
+
+// DomainSeparatorFor computes the EIP-712 domain separator for a contract
+// initialized with a non-default domain name or version.
+func DomainSeparatorFor(name, version string, chainID *big.Int, contractAddr common.Address) [32]byte {
 	domainTypeHash := crypto.Keccak256Hash([]byte(
 		"EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)",
 	))
-	nameHash := crypto.Keccak256Hash([]byte("0G Sandbox Serving"))
-	versionHash := crypto.Keccak256Hash([]byte("1"))
+	nameHash := crypto.Keccak256Hash([]byte(name))
+	versionHash := crypto.Keccak256Hash([]byte(version))
 
 	// ABI-encode: (bytes32, bytes32, bytes32, uint256, address)
 	// Each element is padded to 32 bytes (left-padded for uint/addr, right-padded isn't used here)
@@ -32,15 +52,87 @@ func domainSeparator(chainID *big.Int, contractAddr common.Address) [32]byte {
 	return crypto.Keccak256Hash(encoded)
 }
 
-// BuildUsageHash builds keccak256(sandboxID, periodStart, periodEnd, usageUnits).
-// usageUnits is the elapsed seconds for compute periods (or 0 for create-fee vouchers).
+// DomainSeparator returns the EIP-712 domain separator the contract derives at
+// initialize() time for the given chain and verifying contract.
+func DomainSeparator(chainID *big.Int, contractAddr common.Address) [32]byte {
+	return domainSeparator(chainID, contractAddr)
+}
+
+// Usage hash schema versions. The contract treats usageHash as an opaque
+// bytes32, so the schema can change without a contract upgrade.
+const (
+	// UsageHashV1 is keccak256(sandboxID || periodStart || periodEnd || usageUnits).
+	UsageHashV1 = 1
+	// UsageHashV2 appends the 32-byte big-endian totalFee to the V1 input, so
+	// the on-chain hash also commits to the fee charged for the usage.
+	UsageHashV2 = 2
+)
+
+// BuildUsageHash builds the V1 usage hash:
+// keccak256(sandboxID || periodStart || periodEnd || usageUnits), with the
+// integers as 8-byte big-endian. usageUnits is the elapsed seconds for
+// compute periods (or 0 for create-fee vouchers). It does not bind the fee;
+// see BuildUsageHashV2.
 func BuildUsageHash(sandboxID string, periodStart, periodEnd, usageUnits int64) [32]byte {
-	data := make([]byte, 0, len(sandboxID)+8+8+8)
+	return crypto.Keccak256Hash(usageHashInput(sandboxID, periodStart, periodEnd, usageUnits))
+}
+
+// BuildUsageHashV2 builds the V2 usage hash: the V1 input followed by
+// totalFee as a 32-byte big-endian uint256.
+func BuildUsageHashV2(sandboxID string, periodStart, periodEnd, usageUnits int64, totalFee *big.Int) [32]byte {
+	data := usageHashInput(sandboxID, periodStart, periodEnd, usageUnits)
+	fee := make([]byte, 32)
+	totalFee.FillBytes(fee)
+	return crypto.Keccak256Hash(append(data, fee...))
+}
+
+func usageHashInput(sandboxID string, periodStart, periodEnd, usageUnits int64) []byte {
+	data := make([]byte, 0, len(sandboxID)+8+8+8+32)
 	data = append(data, []byte(sandboxID)...)
 	data = appendInt64(data, periodStart)
 	data = appendInt64(data, periodEnd)
-	data = appendInt64(data, usageUnits)
-	return crypto.Keccak256Hash(data)
+	return appendInt64(data, usageUnits)
+}
+
+// UsageHashMatches reports whether v.UsageHash equals the hash re-derived from
+// v.Usage. Vouchers without a breakdown (enqueued by older builds) are
+// accepted as-is.
+func (v *SandboxVoucher) UsageHashMatches() bool {
+	if v.Usage == nil {
+		return true
+	}
+	return v.Usage.Hash(v.SandboxID) == v.UsageHash
+}
+
+// FeeMatches reports whether v.TotalFee equals UsageUnits*Rate + CreateFee
+// from v.Usage. Vouchers without fee inputs (enqueued by older builds) are
+// accepted as-is.
+func (v *SandboxVoucher) FeeMatches() bool {
+	if v.Usage == nil || v.Usage.Rate == nil && v.Usage.CreateFee == nil {
+		return true
+	}
+	return v.TotalFee != nil && v.TotalFee.Cmp(v.Usage.Fee()) == 0
+}
+
+// Fee returns UsageUnits*Rate + CreateFee; nil inputs count as zero.
+func (u UsageBreakdown) Fee() *big.Int {
+	fee := new(big.Int)
+	if u.Rate != nil {
+		fee.Mul(u.Rate, big.NewInt(u.UsageUnits))
+	}
+	if u.CreateFee != nil {
+		fee.Add(fee, u.CreateFee)
+	}
+	return fee
+}
+
+// Hash returns the usage hash of the breakdown's schema version for the
+// given sandbox. V2 commits to Fee().
+func (u UsageBreakdown) Hash(sandboxID string) [32]byte {
+	if u.Version == UsageHashV2 {
+		return BuildUsageHashV2(sandboxID, u.PeriodStart, u.PeriodEnd, u.UsageUnits, u.Fee())
+	}
+	return BuildUsageHash(sandboxID, u.PeriodStart, u.PeriodEnd, u.UsageUnits)
 }
 
 func appendInt64(b []byte, v int64) []byte {
@@ -50,10 +142,30 @@ func appendInt64(b []byte, v int64) []byte {
 	)
 }
 
+// Digest returns the EIP-712 digest the TEE key signs for v.
+func (v *SandboxVoucher) Digest(chainID *big.Int, contractAddr common.Address) [32]byte {
+	return hashVoucher(v, domainSeparator(chainID, contractAddr))
+}
+
+// DigestWithDomain returns the EIP-712 digest of v under an explicit domain
+// separator (see SignWithDomain).
+func (v *SandboxVoucher) DigestWithDomain(sep [32]byte) [32]byte {
+	return hashVoucher(v, sep)
+}
+
 // Verify recovers the signer address from a signed voucher.
 // Useful for testing and on-chain pre-verification.
 func Verify(v *SandboxVoucher, chainID *big.Int, contractAddr common.Address) (common.Address, error) {
-	digest := hashVoucher(v, chainID, contractAddr)
+	return RecoverWithDomain(v, domainSeparator(chainID, contractAddr))
+}
+
+// RecoverWithDomain recovers the signer address of a voucher signed against
+// an explicit domain separator (see SignWithDomain).
+func RecoverWithDomain(v *SandboxVoucher, sep [32]byte) (common.Address, error) {
+	if v.Nonce == nil || len(v.Signature) != 65 {
+		return common.Address{}, fmt.Errorf("%w: not signed (sandbox %q)", ErrInvalidVoucher, v.SandboxID)
+	}
+	digest := hashVoucher(v, sep)
 	sig := make([]byte, 65)
 	copy(sig, v.Signature)
 	if sig[64] >= 27 {
@@ -68,7 +180,20 @@ func Verify(v *SandboxVoucher, chainID *big.Int, contractAddr common.Address) (c
 
 // Sign signs the voucher in-place with the TEE private key using EIP-712.
 func Sign(v *SandboxVoucher, privKey *ecdsa.PrivateKey, chainID *big.Int, contractAddr common.Address) error {
-	digest := hashVoucher(v, chainID, contractAddr)
+	return SignWithDomain(v, privKey, domainSeparator(chainID, contractAddr))
+}
+
+// SignWithDomain signs the voucher in-place against an explicit domain
+// separator, e.g. one read back from the contract after an upgrade. It
+// refuses a voucher that fails Validate or has no nonce.
+func SignWithDomain(v *SandboxVoucher, privKey *ecdsa.PrivateKey, sep [32]byte) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+	if v.Nonce == nil {
+		return fmt.Errorf("%w: nil nonce (sandbox %q)", ErrInvalidVoucher, v.SandboxID)
+	}
+	digest := hashVoucher(v, sep)
 	sig, err := crypto.Sign(digest[:], privKey)
 	if err != nil {
 		return err
@@ -79,7 +204,7 @@ func Sign(v *SandboxVoucher, privKey *ecdsa.PrivateKey, chainID *big.Int, contra
 	return nil
 }
 
-func hashVoucher(v *SandboxVoucher, chainID *big.Int, contractAddr common.Address) [32]byte {
+func hashVoucher(v *SandboxVoucher, sep [32]byte) [32]byte {
 	// structHash = keccak256(typeHash || abi.encode(fields))
 	encoded := make([]byte, 6*32)
 	copy(encoded[0:32], voucherTypeHash[:])
@@ -90,12 +215,10 @@ func hashVoucher(v *SandboxVoucher, chainID *big.Int, contractAddr common.Addres
 	v.TotalFee.FillBytes(encoded[160:192])
 
 	structHash := crypto.Keccak256Hash(encoded)
-	sep := domainSeparator(chainID, contractAddr)
 
 	// Final digest: keccak256(0x1901 || domainSeparator || structHash)
 	msg := make([]byte, 2+32+32)
-	msg[0] = 0x19
-	msg[1] = 0x01
+	copy(msg[0:2], eip712Prefix)
 	copy(msg[2:34], sep[:])
 	copy(msg[34:66], structHash[:])
 	return crypto.Keccak256Hash(msg)
@@ -1,6 +1,7 @@
 package voucher
 
 import (
+	"errors"
 	"math/big"
 	"testing"
 
@@ -47,6 +48,108 @@ func TestBuildUsageHash_Returns32Bytes(t *testing.T) {
 	}
 }
 
+// ── UsageHashMatches ───────────────────────────────────────────────────────
+
+func TestUsageHashMatches_Consistent(t *testing.T) {
+	u := UsageBreakdown{PeriodStart: 1000, PeriodEnd: 4600, UsageUnits: 3600}
+	v := &SandboxVoucher{SandboxID: "sb-abc", UsageHash: u.Hash("sb-abc"), Usage: &u}
+	if !v.UsageHashMatches() {
+		t.Fatal("hash built from the breakdown should match")
+	}
+}
+
+func TestUsageHashMatches_Tampered(t *testing.T) {
+	u := UsageBreakdown{PeriodStart: 1000, PeriodEnd: 4600, UsageUnits: 3600}
+	v := &SandboxVoucher{SandboxID: "sb-abc", UsageHash: u.Hash("sb-abc"), Usage: &u}
+	v.Usage.UsageUnits = 7200
+	if v.UsageHashMatches() {
+		t.Fatal("changed breakdown must not match the original hash")
+	}
+}
+
+func TestUsageHashMatches_NoBreakdown(t *testing.T) {
+	v := &SandboxVoucher{SandboxID: "sb-abc", UsageHash: BuildUsageHash("sb-abc", 1, 2, 3)}
+	if !v.UsageHashMatches() {
+		t.Fatal("vouchers without a breakdown should be accepted")
+	}
+}
+
+func TestUsageHashV2_CommitsToFee(t *testing.T) {
+	u := UsageBreakdown{PeriodStart: 1000, PeriodEnd: 4600, UsageUnits: 3600, Rate: big.NewInt(10)}
+	v1 := u.Hash("sb-abc")
+	if v1 != BuildUsageHash("sb-abc", 1000, 4600, 3600) {
+		t.Fatal("version 0 must hash as V1")
+	}
+	u.Version = UsageHashV2
+	v2 := u.Hash("sb-abc")
+	if v2 == v1 {
+		t.Fatal("V2 must differ from V1")
+	}
+	if v2 != BuildUsageHashV2("sb-abc", 1000, 4600, 3600, big.NewInt(36000)) {
+		t.Fatal("V2 must commit to UsageUnits*Rate")
+	}
+	u.Rate = big.NewInt(11)
+	if u.Hash("sb-abc") == v2 {
+		t.Fatal("V2 must change with the fee")
+	}
+}
+
+// ── FeeMatches ─────────────────────────────────────────────────────────────
+
+func TestFeeMatches(t *testing.T) {
+	compute := UsageBreakdown{UsageUnits: 3600, Rate: big.NewInt(10)}
+	create := UsageBreakdown{CreateFee: big.NewInt(5_000_000)}
+	cases := []struct {
+		name  string
+		fee   *big.Int
+		usage *UsageBreakdown
+		want  bool
+	}{
+		{"compute ok", big.NewInt(36000), &compute, true},
+		{"compute wrong", big.NewInt(36001), &compute, false},
+		{"create ok", big.NewInt(5_000_000), &create, true},
+		{"create wrong", big.NewInt(0), &create, false},
+		{"nil fee", nil, &create, false},
+		{"no fee inputs", big.NewInt(1), &UsageBreakdown{UsageUnits: 60}, true},
+		{"no breakdown", big.NewInt(1), nil, true},
+	}
+	for _, tc := range cases {
+		v := &SandboxVoucher{TotalFee: tc.fee, Usage: tc.usage}
+		if got := v.FeeMatches(); got != tc.want {
+			t.Errorf("%s: FeeMatches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// ── UsageBreakdown.Validate ────────────────────────────────────────────────
+
+func TestUsageBreakdownValidate(t *testing.T) {
+	const t0 = 1_700_000_000
+	cases := []struct {
+		name string
+		u    UsageBreakdown
+		ok   bool
+	}{
+		{"compute period", UsageBreakdown{PeriodStart: t0, PeriodEnd: t0 + 3600, UsageUnits: 3600}, true},
+		{"create fee", UsageBreakdown{PeriodStart: t0, PeriodEnd: t0, CreateFee: big.NewInt(1)}, true},
+		{"inverted", UsageBreakdown{PeriodStart: t0 + 3600, PeriodEnd: t0, UsageUnits: -3600}, false},
+		{"inverted, zero units", UsageBreakdown{PeriodStart: t0 + 60, PeriodEnd: t0}, false},
+		{"zeroed session start", UsageBreakdown{PeriodStart: 0, PeriodEnd: t0, UsageUnits: t0}, false},
+		{"clock skewed to ms", UsageBreakdown{PeriodStart: t0, PeriodEnd: t0 * 1000, UsageUnits: t0*1000 - t0}, false},
+		{"negative start", UsageBreakdown{PeriodStart: -60, PeriodEnd: t0, UsageUnits: t0 + 60}, false},
+		{"units off by one", UsageBreakdown{PeriodStart: t0, PeriodEnd: t0 + 60, UsageUnits: 61}, false},
+	}
+	for _, tc := range cases {
+		err := tc.u.Validate()
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidVoucher) {
+			t.Errorf("%s: err %v, want ErrInvalidVoucher", tc.name, err)
+		}
+	}
+}
+
 // ── EIP-712 Sign + Verify ──────────────────────────────────────────────────
 
 func newTestVoucher(t *testing.T) (*SandboxVoucher, common.Address) {
@@ -237,3 +340,68 @@ func TestDomainSeparator_ChainIDDiff(t *testing.T) {
 		t.Fatal("different chainIDs should produce different separators")
 	}
 }
+
+// TestSignWithDomain_CustomNameVersion round-trips a voucher signed for a
+// contract initialized with a non-default domain name and version.
+func TestSignWithDomain_CustomNameVersion(t *testing.T) {
+	privKey, _ := crypto.GenerateKey()
+	expected := crypto.PubkeyToAddress(privKey.PublicKey)
+	sep := DomainSeparatorFor("0G Sandbox Serving Testnet", "2", testChainID, testContractAddr)
+	if sep == domainSeparator(testChainID, testContractAddr) {
+		t.Fatal("custom name/version should produce a different separator")
+	}
+	if DomainSeparatorFor(DefaultDomainName, DefaultDomainVersion, testChainID, testContractAddr) != domainSeparator(testChainID, testContractAddr) {
+		t.Fatal("default name/version should match domainSeparator")
+	}
+
+	v := &SandboxVoucher{
+		User:      common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		Provider:  common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		TotalFee:  big.NewInt(5_000_000),
+		UsageHash: BuildUsageHash("sb-domain", 1_000, 4_600, 60),
+		Nonce:     big.NewInt(7),
+	}
+	if err := SignWithDomain(v, privKey, sep); err != nil {
+		t.Fatalf("SignWithDomain: %v", err)
+	}
+	recovered, err := RecoverWithDomain(v, sep)
+	if err != nil {
+		t.Fatalf("RecoverWithDomain: %v", err)
+	}
+	if recovered != expected {
+		t.Errorf("recovered %s, want %s", recovered.Hex(), expected.Hex())
+	}
+
+	// The default domain does not recover the signer.
+	if recovered, err := Verify(v, testChainID, testContractAddr); err == nil && recovered == expected {
+		t.Error("voucher signed for a custom domain verified under the default domain")
+	}
+}
+
+// TestSign_RejectsInvalidVoucher checks each field Sign refuses to sign
+// without, including a missing nonce.
+func TestSign_RejectsInvalidVoucher(t *testing.T) {
+	privKey, _ := crypto.GenerateKey()
+	cases := map[string]func(v *SandboxVoucher){
+		"zero user":     func(v *SandboxVoucher) { v.User = common.Address{} },
+		"zero provider": func(v *SandboxVoucher) { v.Provider = common.Address{} },
+		"nil fee":       func(v *SandboxVoucher) { v.TotalFee = nil },
+		"negative fee":  func(v *SandboxVoucher) { v.TotalFee = big.NewInt(-5) },
+		"nil nonce":     func(v *SandboxVoucher) { v.Nonce = nil },
+	}
+	for name, corrupt := range cases {
+		v := &SandboxVoucher{
+			User:     common.HexToAddress("0x1111111111111111111111111111111111111111"),
+			Provider: common.HexToAddress("0x2222222222222222222222222222222222222222"),
+			TotalFee: big.NewInt(1),
+			Nonce:    big.NewInt(1),
+		}
+		corrupt(v)
+		if err := Sign(v, privKey, testChainID, testContractAddr); !errors.Is(err, ErrInvalidVoucher) {
+			t.Errorf("%s: got %v, want ErrInvalidVoucher", name, err)
+		}
+		if v.Signature != nil {
+			t.Errorf("%s: invalid voucher was signed", name)
+		}
+	}
+}
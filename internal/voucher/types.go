@@ -1,6 +1,8 @@
 package voucher
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -10,13 +12,67 @@ import (
 // SandboxID is metadata only (not part of the EIP-712 struct); it is carried
 // in JSON so the settler knows which sandbox to stop on failure.
 type SandboxVoucher struct {
-	SandboxID string         `json:"sandbox_id"`
-	User      common.Address `json:"user"`
-	Provider  common.Address `json:"provider"`
-	TotalFee  *big.Int       `json:"total_fee"`
-	UsageHash [32]byte       `json:"usage_hash"`
-	Nonce     *big.Int       `json:"nonce"`
-	Signature []byte         `json:"signature"`
+	SandboxID string            `json:"sandbox_id"`
+	User      common.Address    `json:"user"`
+	Provider  common.Address    `json:"provider"`
+	TotalFee  *big.Int          `json:"total_fee"`
+	UsageHash [32]byte          `json:"usage_hash"`
+	Usage     *UsageBreakdown   `json:"usage,omitempty"`  // cleartext input to UsageHash; metadata only
+	Labels    map[string]string `json:"labels,omitempty"` // echoed user labels; metadata only
+	Nonce     *big.Int          `json:"nonce"`
+	Signature []byte            `json:"signature"`
+
+	// EnqueuedAt is when the voucher first entered the queue (unix seconds);
+	// metadata only, used to measure settlement lag.
+	EnqueuedAt int64 `json:"enqueued_at,omitempty"`
+	// QueueID is a random ID stamped when the voucher is first queued;
+	// metadata only. It tells apart vouchers with the same usage hash in
+	// the pending index (see PendingField).
+	QueueID string `json:"queue_id,omitempty"`
+}
+
+// UsageBreakdown is the cleartext input to BuildUsageHash. It is persisted
+// alongside the voucher so the settler can re-derive UsageHash and catch a
+// generator that produced an inconsistent hash before it reaches the chain.
+//
+// Rate and CreateFee are the fee inputs: TotalFee must equal
+// UsageUnits*Rate + CreateFee (see FeeMatches). Both are nil on vouchers
+// enqueued by older builds. Version selects the usageHash schema
+// (UsageHashV1 when zero).
+type UsageBreakdown struct {
+	PeriodStart int64 `json:"period_start"`
+	PeriodEnd   int64 `json:"period_end"`
+	UsageUnits  int64 `json:"usage_units"`
+
+	Rate      *big.Int `json:"rate,omitempty"`       // neuron per usage unit (second)
+	CreateFee *big.Int `json:"create_fee,omitempty"` // neuron, create-fee vouchers only
+	Version   int      `json:"version,omitempty"`
+}
+
+// Plausible usage period bounds in unix seconds: 2020-01-01 and 2100-01-01.
+// A period outside them comes from a corrupted session or a broken clock.
+const (
+	minUsageTime = 1577836800
+	maxUsageTime = 4102444800
+)
+
+// Validate checks that the breakdown describes a real period before it is
+// hashed and charged: both ends are plausible unix timestamps, PeriodEnd is
+// not before PeriodStart, and UsageUnits is the period's length in seconds
+// (usage is billed per whole second, so no rounding applies). Errors wrap
+// ErrInvalidVoucher.
+func (u UsageBreakdown) Validate() error {
+	switch {
+	case u.PeriodStart < minUsageTime || u.PeriodStart > maxUsageTime:
+		return fmt.Errorf("%w: implausible period start %d", ErrInvalidVoucher, u.PeriodStart)
+	case u.PeriodEnd < minUsageTime || u.PeriodEnd > maxUsageTime:
+		return fmt.Errorf("%w: implausible period end %d", ErrInvalidVoucher, u.PeriodEnd)
+	case u.PeriodEnd < u.PeriodStart:
+		return fmt.Errorf("%w: period ends at %d before it starts at %d", ErrInvalidVoucher, u.PeriodEnd, u.PeriodStart)
+	case u.UsageUnits != u.PeriodEnd-u.PeriodStart:
+		return fmt.Errorf("%w: usage units %d for a %ds period", ErrInvalidVoucher, u.UsageUnits, u.PeriodEnd-u.PeriodStart)
+	}
+	return nil
 }
 
 // Redis key templates
@@ -24,4 +80,44 @@ const (
 	VoucherQueueKeyFmt = "voucher:queue:%s" // %s = provider address (checksummed)
 	VoucherDLQKeyFmt   = "voucher:dlq:%s"
 	NonceKeyFmt        = "billing:nonce:%s:%s" // %s = owner, provider
+	// PendingKeyFmt indexes a sandbox's queued (not yet settled) vouchers:
+	// a hash from PendingField to the voucher's pending entry.
+	PendingKeyFmt = "pending:%s" // %s = sandbox ID
+	// SessionKeyPrefix + sandbox ID is the sandbox's open billing session, a
+	// hash written by the billing package; the settler reads its started_at.
+	SessionKeyPrefix = "billing:compute:"
 )
+
+// PendingField is v's field in the PendingKeyFmt hash: its usage hash as
+// 0x-prefixed hex, then ":" and its QueueID. Two v1 create-fee vouchers for
+// one sandbox in the same second share a usage hash; the QueueID keeps their
+// entries apart. Vouchers queued by older builds have no QueueID and are
+// indexed by the usage hash alone.
+func (v *SandboxVoucher) PendingField() string {
+	if v.QueueID == "" {
+		return common.Hash(v.UsageHash).Hex()
+	}
+	return common.Hash(v.UsageHash).Hex() + ":" + v.QueueID
+}
+
+// ErrInvalidVoucher marks a voucher that can never settle; retrying it only
+// wastes nonces.
+var ErrInvalidVoucher = errors.New("invalid voucher")
+
+// Validate checks the fields a voucher needs before it is queued or signed:
+// a non-zero User and Provider and a non-negative TotalFee. Nonce is not
+// checked; the settler assigns it at signing time. Errors wrap
+// ErrInvalidVoucher.
+func (v *SandboxVoucher) Validate() error {
+	switch {
+	case v.User == (common.Address{}):
+		return fmt.Errorf("%w: zero user address (sandbox %q)", ErrInvalidVoucher, v.SandboxID)
+	case v.Provider == (common.Address{}):
+		return fmt.Errorf("%w: zero provider address (sandbox %q)", ErrInvalidVoucher, v.SandboxID)
+	case v.TotalFee == nil:
+		return fmt.Errorf("%w: nil total fee (sandbox %q)", ErrInvalidVoucher, v.SandboxID)
+	case v.TotalFee.Sign() < 0:
+		return fmt.Errorf("%w: negative total fee %s (sandbox %q)", ErrInvalidVoucher, v.TotalFee, v.SandboxID)
+	}
+	return nil
+}
@@ -1,10 +1,10 @@
 #!/usr/bin/env bash
 # scripts/verify-contracts.sh — verify all three beacon-proxy contracts on the explorer.
 #
-# Only the proxy address is needed. Beacon and impl addresses are derived on-chain:
+# Only the proxy address is needed. cmd/verify --proxy derives the rest on-chain:
 #   proxy → eth_getStorageAt(ERC-1967 beacon slot) → beacon
 #   beacon.implementation()                         → impl
-#   beacon.owner()                                  → owner (needed for constructor args)
+#   beacon.owner(), providerStake()                 → constructor args
 #
 # Usage:
 #   ./scripts/verify-contracts.sh --proxy 0x<proxy-address>
@@ -13,7 +13,7 @@
 #   --rpc     <url>   (default: https://evmrpc-testnet.0g.ai)
 #   --api     <url>   (default: https://chainscan-galileo.0g.ai/open/api)
 #
-# Requires: go, python3, curl
+# Requires: go, python3, curl (python3 only to poll the status)
 
 set -uo pipefail
 
@@ -38,125 +38,44 @@ if [[ -z "$PROXY_ADDR" ]]; then
   exit 1
 fi
 
-strip0x() { echo "${1#0x}" | tr '[:upper:]' '[:lower:]'; }
-
-# ── helpers: read beacon/impl/owner from chain ────────────────────────────────
-
-# eth_getStorageAt(addr, slot) → 32-byte hex value
-eth_storage() {
-  local addr="$1" slot="$2"
-  curl -s -X POST "$RPC_URL" \
-    -H "Content-Type: application/json" \
-    -d "{\"jsonrpc\":\"2.0\",\"method\":\"eth_getStorageAt\",\"params\":[\"$addr\",\"$slot\",\"latest\"],\"id\":1}" \
-  | python3 -c "import sys,json; print(json.load(sys.stdin)['result'])"
-}
-
-# eth_call(to, data) → return data hex
-eth_call() {
-  local to="$1" data="$2"
-  curl -s -X POST "$RPC_URL" \
-    -H "Content-Type: application/json" \
-    -d "{\"jsonrpc\":\"2.0\",\"method\":\"eth_call\",\"params\":[{\"to\":\"$to\",\"data\":\"$data\"},\"latest\"],\"id\":1}" \
-  | python3 -c "import sys,json; print(json.load(sys.stdin)['result'])"
-}
-
-# address from last 20 bytes of a 32-byte hex value
-last20() { echo "0x${1: -40}"; }
-
 echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
-echo "Resolving addresses from proxy $PROXY_ADDR ..."
-
-# ERC-1967 beacon slot: keccak256("eip1967.proxy.beacon") - 1
-BEACON_SLOT="0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50"
-
-BEACON_RAW=$(eth_storage "$PROXY_ADDR" "$BEACON_SLOT")
-BEACON_ADDR=$(last20 "$BEACON_RAW")
-
-# implementation() selector = 0x5c60da1b
-IMPL_RAW=$(eth_call "$BEACON_ADDR" "0x5c60da1b")
-IMPL_ADDR=$(last20 "$IMPL_RAW")
-
-# owner() selector = 0x8da5cb5b
-OWNER_RAW=$(eth_call "$BEACON_ADDR" "0x8da5cb5b")
-OWNER_ADDR=$(last20 "$OWNER_RAW")
-
-echo "  Proxy  : $PROXY_ADDR"
-echo "  Beacon : $BEACON_ADDR"
-echo "  Impl   : $IMPL_ADDR"
-echo "  Owner  : $OWNER_ADDR"
-
-IMPL_HEX=$(strip0x   "$IMPL_ADDR")
-BEACON_HEX=$(strip0x "$BEACON_ADDR")
-OWNER_HEX=$(strip0x  "$OWNER_ADDR")
-
-# ── ABI-encoded constructor args ──────────────────────────────────────────────
-# UpgradeableBeacon(address impl_, address owner_)
-BEACON_CTOR=$(python3 - <<EOF
-print('${IMPL_HEX}'.zfill(64) + '${OWNER_HEX}'.zfill(64))
-EOF
-)
-
-# BeaconProxy(address beacon, bytes data)
-# data = initialize(uint256 0) = selector(fe4b84df) + 32-byte zero = 36 bytes
-PROXY_CTOR=$(python3 - <<EOF
-beacon  = '${BEACON_HEX}'.zfill(64)
-offset  = hex(64)[2:].zfill(64)           # 0x40: bytes arg at word 2
-datalen = hex(36)[2:].zfill(64)           # 0x24: 36 bytes
-raw     = 'fe4b84df' + '0' * 64           # selector + uint256(0)
-padded  = raw + '0' * (128 - len(raw))    # pad to 64-byte boundary
-print(beacon + offset + datalen + padded)
-EOF
-)
+echo "Verifying the contracts behind proxy $PROXY_ADDR ..."
 
-echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
+# cmd/verify's output, to pick up the addresses it resolved
+LOG=$(mktemp)
+trap 'rm -f "$LOG"' EXIT
 
 # ── submit_verify ─────────────────────────────────────────────────────────────
 # Progress → stderr (always visible).  Only GUID → stdout (captured by caller).
 submit_verify() {
-  local label="$1" addr="$2" source_path="$3" source_key="$4"
-  local contract_name="$5" ctor_args="$6"
+  local label="$1" target="$2"
 
   echo "" >&2
-  echo "▶ Verifying $label ($addr)..." >&2
+  echo "▶ Verifying $label..." >&2
 
   local out
   out=$(go run ./cmd/verify/ \
-    --contract      "$addr" \
-    --source        "$source_path" \
-    --source-key    "$source_key" \
-    --contract-name "$contract_name" \
-    --constructor-args "$ctor_args" \
-    --api           "$API_URL" \
-    --compiler      "$COMPILER" \
-    --chain-id      "$CHAIN_ID" \
-    --apikey        "$APIKEY" 2>&1) || true
+    --proxy    "$PROXY_ADDR" \
+    --target   "$target" \
+    --rpc      "$RPC_URL" \
+    --api      "$API_URL" \
+    --compiler "$COMPILER" \
+    --chain-id "$CHAIN_ID" \
+    --apikey   "$APIKEY" 2>&1) || true
 
   echo "$out" >&2
+  echo "$out" >>"$LOG"
 
   # Extract and return GUID via stdout (empty if already verified)
   echo "$out" | grep -oE '[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}' | head -1
 }
 
-GUID_IMPL=$(submit_verify \
-  "SandboxServing impl" "$IMPL_ADDR" \
-  "contracts/src/SandboxServing.sol" \
-  "src/SandboxServing.sol" \
-  "src/SandboxServing.sol:SandboxServing" \
-  "")
-
-GUID_BEACON=$(submit_verify \
-  "UpgradeableBeacon" "$BEACON_ADDR" \
-  "contracts/src/proxy/UpgradeableBeacon.sol" \
-  "src/proxy/UpgradeableBeacon.sol" \
-  "src/proxy/UpgradeableBeacon.sol:UpgradeableBeacon" \
-  "$BEACON_CTOR")
-
-GUID_PROXY=$(submit_verify \
-  "BeaconProxy" "$PROXY_ADDR" \
-  "contracts/src/proxy/BeaconProxy.sol" \
-  "src/proxy/BeaconProxy.sol" \
-  "src/proxy/BeaconProxy.sol:BeaconProxy" \
-  "$PROXY_CTOR")
+GUID_IMPL=$(submit_verify   "SandboxServing impl" impl)
+GUID_BEACON=$(submit_verify "UpgradeableBeacon"   beacon)
+GUID_PROXY=$(submit_verify  "BeaconProxy"         proxy)
+
+IMPL_ADDR=$(awk   '$1 == "Impl"   { print $3; exit }' "$LOG")
+BEACON_ADDR=$(awk '$1 == "Beacon" { print $3; exit }' "$LOG")
 
 # ── poll until confirmed ──────────────────────────────────────────────────────
 echo ""